@@ -0,0 +1,137 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// Features that look at the whole site, such as a search index or a link
+// checker, must not hold every page body in memory. Instead, each page is
+// rendered, post-processed and written on its own, and a pageEvent
+// summarizing it is handed to every pageConsumer. Peak memory then stays
+// proportional to the largest page, plus whatever the consumers keep.
+
+// noIndexAttr marks an element whose text is not part of the page's
+// content, such as a site-wide banner. Consumers that index page text must
+// skip such elements.
+const noIndexAttr = "data-pkgsite-noindex"
+
+// A pageEvent describes a generated page. It carries data extracted while
+// the page was post-processed, never the page body.
+type pageEvent struct {
+	URLPath string   // URL path the page was rendered from, such as "/example.com/m"
+	File    string   // slash-separated path of the written file, relative to the output directory
+	Size    int      // size in bytes of the written file
+	HTML    bool     // whether the page is an HTML document
+	Title   string   // text of the <title> element
+	Links   []string // href values of <a> elements, as written
+	IDs     []string // id attribute values, which include the symbol anchors
+	Assets  []string // URLs of scripts, stylesheets, images and other subresources, as written
+	// Redirect is the URL path, or the external URL, the page redirects
+	// to, for the stub pages written for redirects.
+	Redirect string
+	// Tab is the tab of a unit the page shows, such as "imports", for the
+	// tab pages; see tabPagePath.
+	Tab string
+	// Source reports whether the page shows a source file; see
+	// sourcePages.
+	Source bool
+	// Frozen reports whether the page was copied from a previous run, as a
+	// page of a frozen module, which must not be rewritten; see frozen.go.
+	Frozen bool
+}
+
+// A pageConsumer aggregates data over all pages of the generated site.
+type pageConsumer interface {
+	// consumePage is called once for each page, after it is written.
+	consumePage(ev *pageEvent) error
+	// finish is called once after all pages are written.
+	finish(ctx context.Context, out *siteOutput) error
+}
+
+// pageConsumers hands each event to every consumer in turn.
+type pageConsumers []pageConsumer
+
+func (cs pageConsumers) consumePage(ev *pageEvent) error {
+	for _, c := range cs {
+		if err := c.consumePage(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cs pageConsumers) finish(ctx context.Context, out *siteOutput) error {
+	for _, c := range cs {
+		if err := c.finish(ctx, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A lockedConsumer hands events to a consumer one at a time, for pages
+// written by several workers.
+type lockedConsumer struct {
+	mu sync.Mutex
+	c  pageConsumer
+}
+
+func (l *lockedConsumer) consumePage(ev *pageEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.c.consumePage(ev)
+}
+
+func (l *lockedConsumer) finish(ctx context.Context, out *siteOutput) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.c.finish(ctx, out)
+}
+
+// summarizePage records in ev the title, links, ids and subresources of the
+// post-processed document rooted at n. The subresources include the
+// references of the inline style sheets and the asset paths that the
+// inline scripts load.
+func summarizePage(n *html.Node, ev *pageEvent) {
+	if n.Type == html.ElementNode {
+		if n.Data == "title" && n.FirstChild != nil && ev.Title == "" {
+			ev.Title = strings.TrimSpace(n.FirstChild.Data)
+		}
+		for _, a := range n.Attr {
+			switch {
+			case a.Key == "id":
+				ev.IDs = append(ev.IDs, a.Val)
+			case a.Key == "href" && n.Data == "a":
+				ev.Links = append(ev.Links, a.Val)
+			case a.Key == "src" || (a.Key == "href" && (n.Data == "link" || n.Namespace == "svg")):
+				ev.Assets = append(ev.Assets, a.Val)
+			case a.Key == "srcset" && n.Namespace == "":
+				mapSrcset(a.Val, func(u string) string {
+					ev.Assets = append(ev.Assets, u)
+					return u
+				})
+			case a.Key == "style":
+				ev.Assets = append(ev.Assets, cssReferences([]byte(a.Val))...)
+			}
+		}
+		switch {
+		case n.Data == "style" && n.Namespace == "":
+			ev.Assets = append(ev.Assets, cssReferences([]byte(nodeText(n)))...)
+		case scriptTextKind(n) == scriptJS:
+			for _, m := range scriptAssetRE.FindAllStringSubmatch(nodeText(n), -1) {
+				ev.Assets = append(ev.Assets, m[1])
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		summarizePage(c, ev)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestSummarizePage(t *testing.T) {
+	const page = `<html><head><title> Pkg - Go Packages </title>
+<link rel="stylesheet" href="/static/css/main.css"></head>
+<body><h2 id="F">F</h2><a href="/example.com/m/a">a</a><a href="#F">F</a>
+<img src="/static/icon.svg"><script src="/static/main.js"></script>
+<img srcset="/static/a.png 1x, /static/b.png 2x"><svg><use href="/static/s.svg#i"></use></svg>
+<style>p { background: url(../../static/bg.png) }</style><div style="background: url('../../static/bg2.png')"></div>
+<script>loadScript("/static/x.js"); var s = "/example.com/m";</script></body></html>`
+	ev := &pageEvent{}
+	if _, err := processHTML([]byte(page), "/example.com/m", ev); err != nil {
+		t.Fatal(err)
+	}
+	want := &pageEvent{
+		Title: "Pkg - Go Packages",
+		Links: []string{"../../example.com/m/a", "#F"},
+		IDs:   []string{"F"},
+		Assets: []string{
+			"../../static/css/main.css", "../../static/icon.svg", "../../static/main.js",
+			"../../static/a.png", "../../static/b.png", "../../static/s.svg#i",
+			"../../static/bg.png", "../../static/bg2.png", "../../static/x.js",
+		},
+	}
+	if diff := cmp.Diff(want, ev); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// memCheckpoints is a pageConsumer that records the live heap after every
+// fifth page is written, from the first such checkpoint on.
+type memCheckpoints struct {
+	pages     int
+	totalSize int
+	firstHeap uint64 // the heap at the first checkpoint
+	firstSize int    // the size of the pages written by then
+	maxHeap   uint64
+	finished  bool
+}
+
+func (m *memCheckpoints) consumePage(ev *pageEvent) error {
+	m.pages++
+	m.totalSize += ev.Size
+	if m.pages%5 != 0 {
+		return nil
+	}
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if m.firstHeap == 0 {
+		m.firstHeap, m.firstSize = ms.HeapAlloc, m.totalSize
+	}
+	if ms.HeapAlloc > m.maxHeap {
+		m.maxHeap = ms.HeapAlloc
+	}
+	return nil
+}
+
+func (m *memCheckpoints) finish(context.Context, *siteOutput) error {
+	m.finished = true
+	return nil
+}
+
+func TestGenerateStaticSiteMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates a large site")
+	}
+	testenv.MustHaveExecPath(t, "go")
+
+	// A module with packages whose documentation pages are large, so that
+	// keeping them would show in the heap.
+	const numPackages = 20
+	var b strings.Builder
+	b.WriteString("-- go.mod --\nmodule example.com/big\n")
+	for i := 0; i < numPackages; i++ {
+		fmt.Fprintf(&b, "-- p%03d/p.go --\n// Package p%03d is one of many.\npackage p%03d\n", i, i, i)
+		for j := 0; j < 40; j++ {
+			fmt.Fprintf(&b, "\n// F%d does thing %d. %s\nfunc F%d(x, y int) int { return x + y }\n",
+				j, j, strings.Repeat("It is documented at length. ", 100), j)
+		}
+	}
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, b.String())
+
+	m := &memCheckpoints{}
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	if _, err := generateStaticSite(context.Background(), cfg, GenerateOptions{OutDir: t.TempDir()}, pageConsumers{m}); err != nil {
+		t.Fatal(err)
+	}
+	if !m.finished {
+		t.Error("consumer was not finished")
+	}
+	// The homepage, three static pages, the third-party notices, the module
+	// root and its licenses page, and the packages and their imports and
+	// imported-by pages.
+	if want := 5 + 2 + 3*numPackages; m.pages != want {
+		t.Errorf("got %d pages, want %d", m.pages, want)
+	}
+	// The packages are loaded before the first page is written, for the
+	// search index. From then on the heap may hold their caches, but not
+	// the rendered pages, which would take at least their size.
+	growth := int64(m.maxHeap) - int64(m.firstHeap)
+	ceiling := int64(m.totalSize-m.firstSize) / 2
+	t.Logf("heap growth %d KB for %d pages totaling %d KB", growth>>10, m.pages, m.totalSize>>10)
+	if growth > ceiling {
+		t.Errorf("heap grew by %d KB, want at most %d KB", growth>>10, ceiling>>10)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A run with GenerateOptions.Archive set also keeps a snapshot of the site
+// it generated, for browsing the documentation as it was at a release:
+//
+//	archive/
+//		index.html         lists the snapshots
+//		snapshots.json     describes the snapshots, newest last
+//		manifest.sha256    hashes the files of the snapshots
+//		v1.2.0/            a snapshot named by its tag
+//		20240102T150405Z/  a snapshot named by the time of its run
+//
+// A snapshot holds the files of the site, which link to each other
+// relatively, so that it can be browsed on its own. It leaves out the
+// records of the generator, the sitemap, whose URLs are those of the live
+// site, and the not-found page, which only the root of the site serves.
+// A file that is the same as in the previous snapshot is a hard link to
+// it, where the file system allows, so that the archive grows by what
+// changed. Files of the live site are never linked, as later runs rewrite
+// them in place.
+//
+// The archive is left out of the manifest and change lists of the output
+// directory, and Prune leaves it alone: it is only changed by archiving,
+// and has its own manifest, in the format of sha256sum with paths
+// relative to the archive directory. Snapshots do not change once written,
+// except that a run with the tag of an existing snapshot replaces it.
+const (
+	archiveDir           = "archive"
+	archiveSnapshotsFile = "snapshots.json"
+	archiveManifestFile  = "manifest.sha256"
+	archiveIndexFile     = "index.html"
+)
+
+// archiveTagRE matches the tags that can name a snapshot.
+var archiveTagRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// archiveTimeFormat is the layout of the names of untagged snapshots.
+const archiveTimeFormat = "20060102T150405Z"
+
+// An archivedSnapshot is an entry of snapshots.json.
+type archivedSnapshot struct {
+	Name   string    `json:"name"`
+	Time   time.Time `json:"time"`
+	Tagged bool      `json:"tagged,omitempty"`
+	Files  int       `json:"files"`
+	Bytes  int64     `json:"bytes"`
+}
+
+// checkArchiveTag checks that tag can name a snapshot.
+func checkArchiveTag(tag string) error {
+	if tag != "" && !archiveTagRE.MatchString(tag) {
+		return fmt.Errorf("invalid archive tag %q: want letters, digits and ._+- not starting with a punctuation mark", tag)
+	}
+	switch tag {
+	case archiveSnapshotsFile, archiveManifestFile, archiveIndexFile:
+		return fmt.Errorf("invalid archive tag %q: it names a file of the archive", tag)
+	}
+	return nil
+}
+
+// archiveSite adds a snapshot of the site in outDir to its archive, named
+// tag or, if it is empty, after now. Then, if keep is positive, it removes
+// the untagged snapshots but the keep newest ones. written holds the
+// slash-separated paths of the files of the site.
+func archiveSite(outDir string, written map[string]string, tag string, keep int, now time.Time) (*ArchiveSnapshot, error) {
+	for p := range written {
+		if strings.HasPrefix(p, archiveDir+"/") {
+			return nil, fmt.Errorf("the site has a file %s, in the directory of the archive", p)
+		}
+	}
+	dir := filepath.Join(outDir, archiveDir)
+	snapshots, err := readArchiveSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := readManifest(filepath.Join(dir, archiveManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	now = now.UTC()
+	snap := archivedSnapshot{Name: tag, Time: now, Tagged: tag != ""}
+	if snap.Name == "" {
+		snap.Name = now.Format(archiveTimeFormat)
+	}
+	// A snapshot with the same name is replaced.
+	snapshots = slices.DeleteFunc(snapshots, func(s archivedSnapshot) bool { return s.Name == snap.Name })
+	if err := removeArchivedSnapshot(dir, snap.Name, hashes); err != nil {
+		return nil, err
+	}
+	var prev string
+	if len(snapshots) > 0 {
+		prev = snapshots[len(snapshots)-1].Name
+	}
+
+	summary := &ArchiveSnapshot{Name: snap.Name}
+	paths := make([]string, 0, len(written))
+	for p := range written {
+		switch p {
+		case writtenFile, fingerprintsFile, sitemapFile, notFoundURLPath[1:]:
+			continue
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		src := filepath.Join(outDir, filepath.FromSlash(p))
+		dst := filepath.Join(dir, snap.Name, filepath.FromSlash(p))
+		sum, size, err := hashFile(src)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return nil, err
+		}
+		old := prev + "/" + p
+		linked := prev != "" && hashes[old] == sum &&
+			os.Link(filepath.Join(dir, filepath.FromSlash(old)), dst) == nil
+		if !linked {
+			if err := copyFile(src, dst); err != nil {
+				return nil, err
+			}
+			summary.AddedBytes += size
+		}
+		hashes[snap.Name+"/"+p] = sum
+		summary.Files++
+		summary.Bytes += size
+	}
+	snap.Files, snap.Bytes = summary.Files, summary.Bytes
+	snapshots = append(snapshots, snap)
+
+	if keep > 0 {
+		untagged := 0
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			s := snapshots[i]
+			if s.Tagged {
+				continue
+			}
+			if untagged++; untagged > keep {
+				if err := removeArchivedSnapshot(dir, s.Name, hashes); err != nil {
+					return nil, err
+				}
+				summary.Removed = append(summary.Removed, s.Name)
+				snapshots = slices.Delete(snapshots, i, i+1)
+			}
+		}
+		sort.Strings(summary.Removed)
+	}
+	summary.Snapshots = len(snapshots)
+	if err := writeArchiveRecords(dir, snapshots, hashes); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// readArchiveSnapshots reads the snapshots.json file of the archive
+// directory dir. A missing file has no snapshots.
+func readArchiveSnapshots(dir string) ([]archivedSnapshot, error) {
+	file := filepath.Join(dir, archiveSnapshotsFile)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []archivedSnapshot
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	for _, s := range snapshots {
+		if s.Name == "" || strings.ContainsAny(s.Name, `/\`) || s.Name[0] == '.' {
+			return nil, fmt.Errorf("%s: invalid snapshot name %q", file, s.Name)
+		}
+	}
+	return snapshots, nil
+}
+
+// removeArchivedSnapshot removes the snapshot name from the archive
+// directory dir and its files from hashes.
+func removeArchivedSnapshot(dir, name string, hashes map[string]string) error {
+	for p := range hashes {
+		if strings.HasPrefix(p, name+"/") {
+			delete(hashes, p)
+		}
+	}
+	return os.RemoveAll(filepath.Join(dir, name))
+}
+
+// writeArchiveRecords writes the snapshots.json file, manifest and index
+// page of the archive directory dir.
+func writeArchiveRecords(dir string, snapshots []archivedSnapshot, hashes map[string]string) error {
+	data, err := json.MarshalIndent(snapshots, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := writeSiteFile(filepath.Join(dir, archiveSnapshotsFile), append(data, '\n')); err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(hashes))
+	for p := range hashes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var buf bytes.Buffer
+	for _, p := range paths {
+		fmt.Fprintf(&buf, "%s  %s\n", hashes[p], p)
+	}
+	if err := writeSiteFile(filepath.Join(dir, archiveManifestFile), buf.Bytes()); err != nil {
+		return err
+	}
+	buf.Reset()
+	newest := slices.Clone(snapshots)
+	slices.Reverse(newest)
+	if err := archiveIndexTemplate.Execute(&buf, newest); err != nil {
+		return err
+	}
+	return writeSiteFile(filepath.Join(dir, archiveIndexFile), buf.Bytes())
+}
+
+// hashFile returns the hex SHA-256 hash and the size of file.
+func hashFile(file string) (string, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// archiveIndexTemplate is the index page of the archive, executed with the
+// snapshots, newest first.
+var archiveIndexTemplate = template.Must(template.New("archive").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Archived documentation</title>
+</head>
+<body>
+<h1>Archived documentation</h1>
+<p><a href="../index.html">Current documentation</a></p>
+<ul>
+{{- range .}}
+<li><a href="{{.Name}}/index.html">{{.Name}}</a> ({{.Time.Format "2006-01-02 15:04 MST"}}{{if .Tagged}}, tagged{{end}})</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// skipArchive returns fs.SkipDir if d, the entry of file in a walk of the
+// output directory outDir, is the archive, which is recognized by its
+// snapshots.json file. Otherwise it returns nil.
+func skipArchive(outDir, file string, d fs.DirEntry) error {
+	if !d.IsDir() || file != filepath.Join(outDir, archiveDir) {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(file, archiveSnapshotsFile)); err != nil {
+		return nil
+	}
+	return fs.SkipDir
+}
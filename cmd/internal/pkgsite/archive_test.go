@@ -0,0 +1,212 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestArchiveSite(t *testing.T) {
+	outDir := t.TempDir()
+	write := func(p, content string) {
+		t.Helper()
+		file := filepath.Join(outDir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	written := map[string]string{}
+	for p, content := range map[string]string{
+		"index.html":                 "home",
+		"example.com/m/index.html":   "m v1",
+		"static/style.css":           "css",
+		sitemapFile:                  "sitemap",
+		notFoundURLPath[1:]:          "not found",
+		writtenFile:                  "record",
+		"example.com/m/a/index.html": "a",
+	} {
+		write(p, content)
+		written[p] = ""
+	}
+	start := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	archive := func(tag string, keep int, now time.Time) *ArchiveSnapshot {
+		t.Helper()
+		s, err := archiveSite(outDir, written, tag, keep, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	archiveFile := func(p string) string {
+		return filepath.Join(outDir, archiveDir, filepath.FromSlash(p))
+	}
+
+	got := archive("v1.0.0", 0, start)
+	want := &ArchiveSnapshot{Name: "v1.0.0", Files: 4, Bytes: 12, AddedBytes: 12, Snapshots: 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("first snapshot mismatch (-want +got):\n%s", diff)
+	}
+	for _, p := range []string{sitemapFile, notFoundURLPath[1:], writtenFile} {
+		if _, err := os.Stat(archiveFile("v1.0.0/" + p)); !os.IsNotExist(err) {
+			t.Errorf("%s was archived", p)
+		}
+	}
+
+	// The files that did not change are linked to the previous snapshot.
+	write("example.com/m/index.html", "m v2")
+	got = archive("", 1, start.Add(time.Hour))
+	want = &ArchiveSnapshot{Name: "20240102T160405Z", Files: 4, Bytes: 12, AddedBytes: 4, Snapshots: 2}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("second snapshot mismatch (-want +got):\n%s", diff)
+	}
+	same := func(p string) bool {
+		t.Helper()
+		fi1, err := os.Stat(archiveFile("v1.0.0/" + p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi2, err := os.Stat(archiveFile(want.Name + "/" + p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return os.SameFile(fi1, fi2)
+	}
+	if !same("static/style.css") {
+		t.Error("unchanged file is not linked to the previous snapshot")
+	}
+	if same("example.com/m/index.html") {
+		t.Error("changed file is linked to the previous snapshot")
+	}
+	if data, err := os.ReadFile(archiveFile("v1.0.0/example.com/m/index.html")); err != nil || string(data) != "m v1" {
+		t.Errorf("first snapshot of the changed file: got %q, %v; want %q", data, err, "m v1")
+	}
+
+	// Only the newest untagged snapshot is kept; tagged ones stay.
+	got = archive("", 1, start.Add(2*time.Hour))
+	if diff := cmp.Diff([]string{"20240102T160405Z"}, got.Removed); diff != "" {
+		t.Errorf("removed snapshots mismatch (-want +got):\n%s", diff)
+	}
+	if got.Snapshots != 2 {
+		t.Errorf("got %d snapshots, want 2", got.Snapshots)
+	}
+	if _, err := os.Stat(archiveFile("20240102T160405Z")); !os.IsNotExist(err) {
+		t.Errorf("removed snapshot: got %v, want not exist", err)
+	}
+	index, err := os.ReadFile(archiveFile(archiveIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, j := strings.Index(string(index), `href="20240102T170405Z/index.html"`), strings.Index(string(index), `href="v1.0.0/index.html"`)
+	if i < 0 || j < 0 || i > j {
+		t.Errorf("index does not list the snapshots, newest first:\n%s", index)
+	}
+	hashes, err := readManifest(archiveFile(archiveManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 8 || hashes["v1.0.0/static/style.css"] != hashes["20240102T170405Z/static/style.css"] {
+		t.Errorf("archive manifest: got %v, want the 8 files of the two snapshots", hashes)
+	}
+
+	// A file of the site in the archive directory is an error.
+	written["archive/x.html"] = ""
+	if _, err := archiveSite(outDir, written, "", 0, start); err == nil {
+		t.Error("archiving a site with a file in the archive directory: got nil error")
+	}
+}
+
+func TestCheckArchiveTag(t *testing.T) {
+	for _, tag := range []string{"", "v1.2.3", "release-2024_01+build"} {
+		if err := checkArchiveTag(tag); err != nil {
+			t.Errorf("checkArchiveTag(%q): %v", tag, err)
+		}
+	}
+	for _, tag := range []string{".hidden", "a/b", "..", "v 1", archiveIndexFile, archiveManifestFile} {
+		if err := checkArchiveTag(tag); err == nil {
+			t.Errorf("checkArchiveTag(%q): got nil error", tag)
+		}
+	}
+}
+
+func TestGenerateStaticSiteArchive(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- a/a.go --
+// Package a does other things.
+package a
+`)
+	outDir := t.TempDir()
+	generate := func(tag string) *Report {
+		t.Helper()
+		cfg := ServerConfig{
+			Paths:         []string{modDir},
+			UseListedMods: true,
+			SiteURL:       "https://docs.example.com",
+		}
+		report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{
+			OutDir:     outDir,
+			Sitemap:    true,
+			Prune:      true,
+			Archive:    true,
+			ArchiveTag: tag,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+	report := generate("v1.0.0")
+	if report.Archive == nil || report.Archive.Name != "v1.0.0" || report.Archive.AddedBytes != report.Archive.Bytes {
+		t.Fatalf("archive report: got %+v, want a first snapshot v1.0.0", report.Archive)
+	}
+	snapshot := filepath.Join(outDir, archiveDir, "v1.0.0")
+	for _, p := range []string{"index.html", "example.com/m/index.html", "example.com/m/a/index.html", searchIndexFile} {
+		if _, err := os.Stat(filepath.Join(snapshot, filepath.FromSlash(p))); err != nil {
+			t.Errorf("snapshot: %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(snapshot, sitemapFile)); !os.IsNotExist(err) {
+		t.Errorf("snapshot sitemap: got %v, want not exist", err)
+	}
+	checkInternalLinks(t, snapshot, "example.com/m")
+
+	// A second run with pruning keeps the archive, and leaves it out of
+	// the manifest of the output directory.
+	report = generate("v1.1.0")
+	if report.Archive.Snapshots != 2 || report.Archive.AddedBytes >= report.Archive.Bytes {
+		t.Errorf("archive report: got %+v, want a second snapshot sharing files", report.Archive)
+	}
+	if _, err := os.Stat(filepath.Join(snapshot, "example.com", "m", "index.html")); err != nil {
+		t.Errorf("first snapshot after pruning: %v", err)
+	}
+	manifest, err := readManifest(filepath.Join(outDir, manifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := range manifest {
+		if strings.HasPrefix(p, archiveDir+"/") {
+			t.Errorf("manifest lists %s", p)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Stylesheets reference fonts, images and other stylesheets through url()
+// and @import, and scripts other scripts through import. Those references,
+// and those of both to their source maps, are edges of the asset graph,
+// just like the links of HTML pages, so that a step that renames or drops
+// asset files can tell which files depend on them. References are recorded
+// as written to the output, after they were made relative.
+
+var (
+	cssCommentRE = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssURLRE     = regexp.MustCompile(`url\(\s*(?:'([^']*)'|"([^"]*)"|([^'"\s)]*))\s*\)`)
+	cssImportRE  = regexp.MustCompile(`@import\s+(?:'([^']*)'|"([^"]*)")`)
+
+	// jsImportRE matches the relative module specifiers of the static and
+	// dynamic imports of scripts.
+	jsImportRE = regexp.MustCompile(`(?:\bimport\s*\(?|\bfrom)\s*(?:'(\.{0,2}/[^']*)'|"(\.{0,2}/[^"]*)")`)
+	// sourceMapRE matches the comments of style sheets and scripts naming
+	// their source maps.
+	sourceMapRE = regexp.MustCompile(`(?m)^(?://|/\*)[#@]\s*sourceMappingURL=([^\s*]+)`)
+
+	// scriptFileRE matches the site paths of images, style sheets and
+	// scripts in scripts, which may be preceded by a relative prefix.
+	scriptFileRE = regexp.MustCompile(`(?:static|third_party)/[\w./-]+\.(?:css|gif|ico|jpe?g|js|png|svg|webp)\b`)
+
+	// scriptAssetRE matches the string literals of scripts holding the
+	// relative paths of assets, such as loadScript("../static/frontend/x.js").
+	scriptAssetRE = regexp.MustCompile(`["']((?:\.\.?/)*(?:static|third_party)/[^"'\s]+)["']`)
+)
+
+// cssReferences returns the local references of a stylesheet, in order of
+// appearance. References with a scheme, such as data: URLs, protocol-relative
+// references and fragment-only references are omitted.
+func cssReferences(css []byte) []string {
+	s := cssCommentRE.ReplaceAllString(string(css), "")
+	var refs []string
+	for _, re := range []*regexp.Regexp{cssURLRE, cssImportRE} {
+		for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+			var ref string
+			for i := 2; i < len(m); i += 2 {
+				if m[i] >= 0 {
+					ref = s[m[i]:m[i+1]]
+					break
+				}
+			}
+			if isLocalReference(ref) {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
+
+// jsReferences returns the local references of a script, in order of
+// appearance: the relative specifiers of its imports, and its source map.
+func jsReferences(js []byte) []string {
+	var refs []string
+	for _, m := range jsImportRE.FindAllSubmatch(js, -1) {
+		refs = append(refs, string(m[1])+string(m[2]))
+	}
+	return append(refs, sourceMaps(js)...)
+}
+
+// sourceMaps returns the local references of a style sheet or script to
+// its source maps.
+func sourceMaps(content []byte) []string {
+	var refs []string
+	for _, m := range sourceMapRE.FindAllSubmatch(content, -1) {
+		if ref := string(m[1]); isLocalReference(ref) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// isLocalReference reports whether ref refers to a file of the site.
+func isLocalReference(ref string) bool {
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "//") {
+		return false
+	}
+	if i := strings.IndexAny(ref, ":/?#"); i >= 0 && ref[i] == ':' {
+		return false // has a scheme
+	}
+	return true
+}
+
+// An assetRef is a reference from one asset file to another.
+type assetRef struct {
+	Href   string // reference as written
+	Target string // referenced file, relative to the output directory
+}
+
+// assetGraph records the asset files written to the output directory and
+// the references between them. Paths are slash-separated and relative to
+// the output directory. Scripts build the URLs they load in too many ways
+// to tell all of their references, but the files they mention by their
+// site paths are recorded, so that they are not taken for unused.
+type assetGraph struct {
+	files     map[string]bool
+	size      int64 // bytes of the files
+	refs      map[string][]assetRef
+	mentioned map[string]bool     // files that scripts mention
+	mentions  map[string][]string // the files each script mentions
+}
+
+func newAssetGraph() *assetGraph {
+	return &assetGraph{files: map[string]bool{}, refs: map[string][]assetRef{}, mentioned: map[string]bool{}, mentions: map[string][]string{}}
+}
+
+// addFile records the file at sitePath with the given content, as written.
+func (g *assetGraph) addFile(sitePath string, content []byte) {
+	if !g.files[sitePath] {
+		g.size += int64(len(content))
+	}
+	g.files[sitePath] = true
+	var hrefs []string
+	switch path.Ext(sitePath) {
+	case ".js":
+		for _, p := range scriptFileRE.FindAll(content, -1) {
+			g.mentioned[string(p)] = true
+			g.mentions[sitePath] = append(g.mentions[sitePath], string(p))
+		}
+		hrefs = jsReferences(content)
+	case ".css":
+		hrefs = append(cssReferences(content), sourceMaps(content)...)
+	}
+	for _, href := range hrefs {
+		g.refs[sitePath] = append(g.refs[sitePath], assetRef{Href: href, Target: refTarget(sitePath, href)})
+	}
+}
+
+// refTarget returns the file, relative to the output directory, that the
+// local reference ref of the file at sitePath refers to.
+func refTarget(sitePath, ref string) string {
+	target, _, _ := strings.Cut(ref, "?")
+	target, _, _ = strings.Cut(target, "#")
+	if strings.HasPrefix(target, "/") {
+		return target[1:]
+	}
+	return path.Join(path.Dir(sitePath), target)
+}
+
+// rename records that the files of the graph named as the keys of renamed
+// are now named as their values, in the graph and in the references to
+// them. The size of the graph is left as is.
+func (g *assetGraph) rename(renamed map[string]string) {
+	for old, p := range renamed {
+		if g.files[old] {
+			delete(g.files, old)
+			g.files[p] = true
+		}
+		if refs, ok := g.refs[old]; ok {
+			delete(g.refs, old)
+			g.refs[p] = refs
+		}
+		if mentions, ok := g.mentions[old]; ok {
+			delete(g.mentions, old)
+			g.mentions[p] = mentions
+		}
+	}
+	for _, refs := range g.refs {
+		for i, r := range refs {
+			if p, ok := renamed[r.Target]; ok {
+				refs[i] = assetRef{Href: renamedRef(r.Href, p), Target: p}
+			}
+		}
+	}
+}
+
+// referenced returns the files that stylesheets of the graph refer to.
+func (g *assetGraph) referenced() map[string]bool {
+	referenced := map[string]bool{}
+	for _, refs := range g.refs {
+		for _, r := range refs {
+			referenced[r.Target] = true
+		}
+	}
+	return referenced
+}
+
+// closure returns the files of the graph among roots, and those that they
+// refer to or mention, directly or not, sorted.
+func (g *assetGraph) closure(roots []string) []string {
+	seen := map[string]bool{}
+	var visit func(p string)
+	visit = func(p string) {
+		if seen[p] || !g.files[p] {
+			return
+		}
+		seen[p] = true
+		for _, r := range g.refs[p] {
+			visit(r.Target)
+		}
+		for _, m := range g.mentions[p] {
+			visit(m)
+		}
+	}
+	for _, p := range roots {
+		visit(p)
+	}
+	files := slices.Collect(maps.Keys(seen))
+	sort.Strings(files)
+	return files
+}
+
+// pageAssets returns the local files that the page of ev refers to as
+// subresources, relative to the output directory.
+func pageAssets(ev *pageEvent) []string {
+	var files []string
+	for _, ref := range ev.Assets {
+		if !isLocalReference(ref) {
+			continue
+		}
+		files = append(files, refTarget(ev.File, ref))
+	}
+	return files
+}
+
+// missing returns the references to files that are not in the graph,
+// sorted by referring file.
+func (g *assetGraph) missing() []BrokenLink {
+	var broken []BrokenLink
+	for from, refs := range g.refs {
+		for _, r := range refs {
+			if !g.files[r.Target] {
+				broken = append(broken, BrokenLink{Page: from, Href: r.Href})
+			}
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		if broken[i].Page != broken[j].Page {
+			return broken[i].Page < broken[j].Page
+		}
+		return broken[i].Href < broken[j].Href
+	})
+	return broken
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestCSSReferences(t *testing.T) {
+	const css = `@import url('./reset.css');
+@import "../shared/shared.css";
+/* url(commented.png) */
+@font-face {
+  font-family: Go;
+  src: url("../fonts/go.woff2?v=2#x") format("woff2"), url(../fonts/go.woff) format("woff");
+}
+.a { background: url( data:image/svg+xml;base64,AAAA ); }
+.b { background: url(https://example.com/x.png), url(//cdn.example.com/y.png), url(#grad); }
+.c { background: no-repeat center/2rem url(/static/icon.svg); }`
+	got := cssReferences([]byte(css))
+	want := []string{
+		"./reset.css",
+		"../fonts/go.woff2?v=2#x",
+		"../fonts/go.woff",
+		"/static/icon.svg",
+		"../shared/shared.css",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAssetGraphMissing(t *testing.T) {
+	g := newAssetGraph()
+	g.addFile("static/fonts/go.woff2", nil)
+	g.addFile("static/css/main.css", []byte(`@font-face { src: url("../fonts/go.woff2?v=2") }
+.x { background: url(../img/gone.png) }
+.y { background: url(/images/menu.svg) }`))
+	want := []BrokenLink{
+		{Page: "static/css/main.css", Href: "../img/gone.png"},
+		{Page: "static/css/main.css", Href: "/images/menu.svg"},
+	}
+	if diff := cmp.Diff(want, g.missing()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestGenerateStaticSiteCSSReferences checks that every url() and @import
+// target of every stylesheet in the output exists in the output.
+func TestGenerateStaticSiteCSSReferences(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+-- m.go --
+// Package m does things.
+package m
+`)
+	outDir := t.TempDir()
+	report, err := GenerateStaticSiteReport(context.Background(), ServerConfig{Paths: []string{modDir}, UseListedMods: true}, outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.MissingAssets) > 0 {
+		t.Errorf("report lists missing assets: %v", report.MissingAssets)
+	}
+
+	var numRefs int
+	err = filepath.WalkDir(outDir, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(fpath) != ".css" {
+			return err
+		}
+		data, err := os.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(outDir, fpath)
+		if err != nil {
+			return err
+		}
+		for _, ref := range cssReferences(data) {
+			numRefs++
+			if strings.HasPrefix(ref, "/") {
+				t.Errorf("%s: absolute reference %q", rel, ref)
+				continue
+			}
+			target, _, _ := strings.Cut(ref, "?")
+			target, _, _ = strings.Cut(target, "#")
+			target = path.Join(path.Dir(filepath.ToSlash(rel)), target)
+			if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(target))); err != nil {
+				t.Errorf("%s: reference %q: %v", rel, ref, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numRefs == 0 {
+		t.Error("found no stylesheet references")
+	}
+}
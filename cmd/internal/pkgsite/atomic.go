@@ -0,0 +1,162 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// A run that fails halfway leaves the output directory with a mixture of
+// old and new files. With GenerateOptions.Atomic, a run writes to a
+// staging directory next to the output directory instead, which starts as
+// a copy of it, so that the files a previous run recorded are left alone
+// and removed as they would be in place. Only once the run succeeds does
+// the staging directory replace the output directory; otherwise it is
+// removed, and the output directory is as it was.
+
+// rename is os.Rename, replaced by tests.
+var rename = os.Rename
+
+// stageOutDir returns a new staging directory for a run to outDir, next
+// to it, holding a copy of its files, if it exists.
+func stageOutDir(outDir string) (string, error) {
+	parent, base := filepath.Split(filepath.Clean(outDir))
+	if parent == "" {
+		parent = "."
+	}
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return "", err
+	}
+	staging, err := os.MkdirTemp(parent, "."+base+".pkgsite-")
+	if err != nil {
+		return "", err
+	}
+	if err := copyDir(outDir, staging); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		os.RemoveAll(staging)
+		return "", err
+	}
+	return staging, nil
+}
+
+// replaceDir replaces the directory dst, if it exists, with the directory
+// src. The old dst is moved aside, src is renamed to dst, and the old dst
+// is deleted. If a rename fails, as it does across devices or for a mount
+// point, the contents of dst are replaced with a copy of those of src
+// instead, which is not atomic, and src is deleted.
+func replaceDir(src, dst string) error {
+	dst = filepath.Clean(dst)
+	old := src + ".old"
+	moved := true
+	err := rename(dst, old)
+	if errors.Is(err, fs.ErrNotExist) {
+		moved, err = false, nil
+	}
+	if err == nil {
+		if err = rename(src, dst); err == nil {
+			if moved {
+				return os.RemoveAll(old)
+			}
+			return nil
+		}
+		if moved {
+			if err := rename(old, dst); err != nil {
+				return fmt.Errorf("restoring %s from %s: %w", dst, old, err)
+			}
+		}
+	}
+	var le *os.LinkError
+	if !errors.As(err, &le) {
+		return err
+	}
+	if err := clearDir(dst); err != nil {
+		return err
+	}
+	if err := copyDir(src, dst); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// clearDir deletes the contents of dir, and creates it if it does not
+// exist.
+func clearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.MkdirAll(dir, 0o755)
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDir copies the files and symbolic links of the directory src into
+// the directory dst, which must exist, keeping their modes and
+// modification times.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(file, target)
+		}
+		return nil
+	})
+}
+
+// copyFile copies the regular file src to dst, keeping its mode and
+// modification time.
+func copyFile(src, dst string) (err error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// OpenFile is subject to the umask.
+	if err := os.Chmod(dst, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+// finishFailer is a page consumer that fails once all pages are written.
+type finishFailer struct{}
+
+func (finishFailer) consumePage(*pageEvent) error { return nil }
+
+func (finishFailer) finish(context.Context, *siteOutput) error {
+	return errors.New("disk full")
+}
+
+func TestGenerateStaticSiteAtomic(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- a/a.go --
+// Package a does other things.
+package a
+`)
+	outDir := filepath.Join(t.TempDir(), "site")
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	opts := GenerateOptions{OutDir: outDir, Atomic: true}
+	asset := filepath.Join(outDir, "static", "frontend", "frontend.min.css")
+	pageA := filepath.Join(outDir, "example.com", "m", "a", "index.html")
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	siblings := func() []string {
+		t.Helper()
+		entries, err := os.ReadDir(filepath.Dir(outDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(asset, old, old); err != nil {
+		t.Fatal(err)
+	}
+	before, err := hashOutDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A run that fails after writing its pages leaves the previous site.
+	if err := os.RemoveAll(filepath.Join(modDir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generateStaticSite(context.Background(), cfg, opts, pageConsumers{finishFailer{}}); err == nil {
+		t.Fatal("failing run succeeded")
+	}
+	after, err := hashOutDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(before, after); diff != "" {
+		t.Errorf("failed run changed the output directory (-before +after):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"site"}, siblings()); diff != "" {
+		t.Errorf("failed run left files next to the output directory (-want +got):\n%s", diff)
+	}
+
+	// A run that succeeds replaces the site, keeping unchanged files as
+	// they were.
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pageA); !os.IsNotExist(err) {
+		t.Errorf("page of removed package: got %v, want not exist", err)
+	}
+	fi, err := os.Stat(asset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(old) {
+		t.Error("atomic run rewrote an unchanged file")
+	}
+	if diff := cmp.Diff([]string{"site"}, siblings()); diff != "" {
+		t.Errorf("run left files next to the output directory (-want +got):\n%s", diff)
+	}
+}
+
+func TestReplaceDirCopy(t *testing.T) {
+	defer func(r func(string, string) error) { rename = r }(rename)
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for file, data := range map[string]string{
+		filepath.Join(src, "index.html"):   "new",
+		filepath.Join(src, "d", "a.html"):  "a",
+		filepath.Join(dst, "index.html"):   "old",
+		filepath.Join(dst, "gone", "x.js"): "x",
+	} {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(filepath.Join(src, "d", "a.html"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := replaceDir(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	got, err := hashOutDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["index.html"] == "" || got["d/a.html"] == "" {
+		t.Errorf("replaced directory holds %v, want index.html and d/a.html", got)
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new" {
+		t.Errorf("index.html = %q, want %q", data, "new")
+	}
+	fi, err := os.Stat(filepath.Join(dst, "d", "a.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(old) {
+		t.Errorf("copy has modification time %v, want %v", fi.ModTime(), old)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source directory: got %v, want not exist", err)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	thirdparty "github.com/wow-look-at-my/static-pkgsite/third_party"
+)
+
+// The libraries of third_party that the pages load, such as the dialog
+// polyfill, have licenses that require their notices to go with them,
+// which the site would otherwise only hold as files of their directories.
+// The site has a page of third-party notices, /attributions, linked from
+// the footer of every page, that lists the components of
+// thirdparty.Components whose files are in the output, with the text of
+// their licenses. It is written once the assets are copied, so that a
+// component whose files were left out of the output is left out of the
+// notices too. The page has the layout of the license policy page.
+
+// attributionsURLPath is the URL path of the page of third-party notices.
+const attributionsURLPath = "/attributions"
+
+// attributionsFrame is the URL path of the page whose layout the page of
+// third-party notices has.
+const attributionsFrame = "/license-policy"
+
+// includedComponents returns the components of cs with files among
+// written, the slash-separated paths of the files of the output, other
+// than the file of their license.
+func includedComponents(cs []thirdparty.Component, written map[string]string) []thirdparty.Component {
+	dirs := map[string]bool{}
+	for p := range written {
+		rest, ok := strings.CutPrefix(p, "third_party/")
+		if !ok {
+			continue
+		}
+		dir, _, ok := strings.Cut(rest, "/")
+		if ok && !isLicenseFileOf(cs, rest) {
+			dirs[dir] = true
+		}
+	}
+	var included []thirdparty.Component
+	for _, c := range cs {
+		if dirs[c.Dir] {
+			included = append(included, c)
+		}
+	}
+	return included
+}
+
+// isLicenseFileOf reports whether p is the license file of one of cs.
+func isLicenseFileOf(cs []thirdparty.Component, p string) bool {
+	for _, c := range cs {
+		if c.LicenseFile == p {
+			return true
+		}
+	}
+	return false
+}
+
+// attributionsContent returns the HTML content of the page of third-party
+// notices listing cs.
+func attributionsContent(cs []thirdparty.Component) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("# Third-party notices\n\n")
+	if len(cs) == 0 {
+		b.WriteString("This site includes no third-party components.\n")
+		return renderStaticPage(b.Bytes()), nil
+	}
+	b.WriteString("This site includes the following third-party components, under the licenses below.\n")
+	for _, c := range cs {
+		text, err := fs.ReadFile(thirdparty.FS, c.LicenseFile)
+		if err != nil {
+			return nil, fmt.Errorf("third-party component %s: %w", c.Dir, err)
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", c.Name)
+		fmt.Fprintf(&b, "From <%s>, in `third_party/%s/`, under the %s license:\n\n", c.URL, c.Dir, c.License)
+		fence := "```"
+		for strings.Contains(string(text), fence) {
+			fence += "`"
+		}
+		fmt.Fprintf(&b, "%s\n%s\n%s\n", fence, strings.TrimRight(string(text), "\n"), fence)
+	}
+	return renderStaticPage(b.Bytes()), nil
+}
+
+// attributionsTransform returns the page transform making the page of
+// attributionsFrame the page of third-party notices with the HTML content.
+func attributionsTransform(content []byte) pageTransform {
+	replace := replaceContent(content)
+	return func(doc *html.Node, head *headManager) {
+		replace(doc, head)
+		setPageTitle(doc, "Third-party notices")
+	}
+}
+
+// setPageTitle makes text the title of the page doc, keeping the name of
+// the site that follows it.
+func setPageTitle(doc *html.Node, text string) {
+	title := findElement(doc, "title")
+	if title == nil {
+		return
+	}
+	if c := title.FirstChild; c != nil && c.Type == html.TextNode {
+		if _, site, ok := strings.Cut(c.Data, " - "); ok {
+			text += " - " + site
+		}
+	}
+	for title.FirstChild != nil {
+		title.RemoveChild(title.FirstChild)
+	}
+	title.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+}
+
+// attributionsLinkTransform returns the page transform adding the link to
+// the page of third-party notices to the footer, after its other links.
+func attributionsLinkTransform() pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		row := findElementFunc(doc, func(n *html.Node) bool {
+			return n.DataAtom == atom.Ul && hasClass(n, "go-Footer-listRow")
+		})
+		if row == nil {
+			return
+		}
+		a := &html.Node{
+			Type:     html.ElementNode,
+			Data:     "a",
+			DataAtom: atom.A,
+			Attr:     []html.Attribute{{Key: "href", Val: attributionsURLPath}, {Key: "data-gtmc", Val: "footer link"}},
+		}
+		a.AppendChild(&html.Node{Type: html.TextNode, Data: "Third-party notices"})
+		li := &html.Node{
+			Type:     html.ElementNode,
+			Data:     "li",
+			DataAtom: atom.Li,
+			Attr:     []html.Attribute{{Key: "class", Val: "go-Footer-listItem"}},
+		}
+		li.AppendChild(a)
+		// The links come before the buttons of the row.
+		var before *html.Node
+		for c := row.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.Li && findElement(c, "button") != nil {
+				before = c
+				break
+			}
+		}
+		row.InsertBefore(li, before)
+	}
+}
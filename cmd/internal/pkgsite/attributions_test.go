@@ -0,0 +1,94 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	thirdparty "github.com/wow-look-at-my/static-pkgsite/third_party"
+)
+
+func TestIncludedComponents(t *testing.T) {
+	a := thirdparty.Component{Dir: "a", Name: "A", LicenseFile: "a/LICENSE"}
+	b := thirdparty.Component{Dir: "b", Name: "B", LicenseFile: "b/COPYING"}
+	cs := []thirdparty.Component{a, b}
+	for _, test := range []struct {
+		name    string
+		written []string
+		want    []thirdparty.Component
+	}{
+		{"all", []string{"index.html", "third_party/a/a.js", "third_party/b/b.css", "third_party/b/COPYING"}, cs},
+		// A component whose files were pruned has no entry, even if its
+		// license file is left.
+		{"pruned", []string{"third_party/a/a.js", "third_party/b/COPYING"}, []thirdparty.Component{a}},
+		{"none", []string{"index.html", "static/x.js"}, nil},
+	} {
+		written := map[string]string{}
+		for _, p := range test.written {
+			written[p] = "hash"
+		}
+		if diff := cmp.Diff(test.want, includedComponents(cs, written)); diff != "" {
+			t.Errorf("%s: mismatch (-want +got):\n%s", test.name, diff)
+		}
+	}
+
+	content, err := attributionsContent(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(content, []byte("no third-party components")) {
+		t.Errorf("the notices of no components are %s", content)
+	}
+}
+
+func TestGenerateStaticSiteAttributions(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	mods := writeStaticPagesModules(t)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: mods, UseListedMods: true}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.BrokenLinks) != 0 {
+		t.Errorf("broken links: %v", report.BrokenLinks)
+	}
+	page, err := os.ReadFile(filepath.Join(outDir, "attributions", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	license, err := os.ReadFile(filepath.Join(outDir, "third_party", "dialog-polyfill", "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<title>Third-party notices",
+		"<h2>dialog-polyfill</h2>",
+		"https://github.com/GoogleChrome/dialog-polyfill",
+		"BSD-3-Clause",
+		"Redistribution and use in source and binary forms",
+	} {
+		if !bytes.Contains(page, []byte(want)) {
+			t.Errorf("the notices do not contain %s", want)
+		}
+	}
+	if !bytes.Contains(license, []byte("Redistribution and use in source and binary forms")) {
+		t.Fatal("the test expects dialog-polyfill to be under the BSD license")
+	}
+	home, err := os.ReadFile(filepath.Join(outDir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(home, []byte(`<a href="./attributions" data-gtmc="footer link">Third-party notices</a>`)) {
+		t.Error("the footer of the homepage does not link the notices")
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+}
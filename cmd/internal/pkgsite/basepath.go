@@ -0,0 +1,97 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Pages are served from anywhere under the site's base path, and most of
+// them link to the site relatively. The frontend scripts, however, were
+// written for a site at the root of its host, and a few of them build URLs
+// from root paths at run time. processHTML records the site root of each
+// page on its <html> element, and the scripts are patched as they are
+// copied to resolve those URLs against it instead.
+//
+// The patches match the minified scripts exactly, so they stop applying
+// when the scripts are rebuilt. The tests check that each patch applies
+// and that the copied scripts are free of the root-path navigation
+// patterns of rootNavigationREs.
+
+// baseAttr is the attribute of the <html> element holding the site root,
+// relative to the page or absolute.
+const baseAttr = "data-pkgsite-base"
+
+// jsBaseURL is a JavaScript expression for the URL of the site root of the
+// current page.
+const jsBaseURL = `new URL(document.documentElement.dataset.pkgsiteBase||"/",location.href)`
+
+// A jsPatch replaces old with new in the copied scripts.
+type jsPatch struct {
+	name     string
+	old, new string
+}
+
+var jsPatches = []jsPatch{
+	{
+		// The left navigation of the about page is set up only on that
+		// page, which is recognized by its path from the site root.
+		name: "about jump links",
+		old:  `["/about"].includes(window.location.pathname)`,
+		new:  `["about"].includes(window.location.pathname.slice(` + jsBaseURL + `.pathname.length).replace(/\/?(index\.html)?$/,""))`,
+	},
+	{
+		// The "y" shortcut replaces the URL with the canonical URL path of
+		// the page, which is a root path.
+		name: "canonical URL shortcut",
+		old:  `window.history.replaceState(null,"",n)}});`,
+		new:  `window.history.replaceState(null,"",new URL(n.replace(/^\//,""),` + jsBaseURL + `).href)}});`,
+	},
+}
+
+// patchJS applies jsPatches to the script js.
+func patchJS(js []byte) []byte {
+	s := string(js)
+	for _, p := range jsPatches {
+		s = strings.ReplaceAll(s, p.old, p.new)
+	}
+	return []byte(s)
+}
+
+// rootNavigationREs match script code that navigates to, or compares the
+// current location with, a root path.
+var rootNavigationREs = []*regexp.Regexp{
+	regexp.MustCompile(`location\.href\s*=\s*["'` + "`" + `]/[^/]`),
+	regexp.MustCompile(`(?:location\.assign|location\.replace|pushState|replaceState)\([^)]*["'` + "`" + `]/[^/]`),
+	regexp.MustCompile(`["'` + "`" + `]/[^/"'` + "`" + `][^"'` + "`" + `]*["'` + "`" + `]\]\.includes\((?:window\.)?location\.pathname\)`),
+	regexp.MustCompile(`location\.pathname\s*[!=]==?\s*["'` + "`" + `]/`),
+	// The canonical URL path of a page is a root path.
+	regexp.MustCompile(`canonicalUrlPath;[^}]*(?:pushState|replaceState)\(null,\s*"",\s*\w+\)`),
+}
+
+// rootNavigations returns the code of the script js matching
+// rootNavigationREs.
+func rootNavigations(js []byte) []string {
+	var found []string
+	for _, re := range rootNavigationREs {
+		for _, m := range re.FindAll(js, -1) {
+			found = append(found, string(m))
+		}
+	}
+	return found
+}
+
+// setBase records prefix, the site root relative to the page or the
+// absolute base path, on the <html> element of doc.
+func setBase(doc *html.Node, prefix string) {
+	root := findElement(doc, "html")
+	if root == nil {
+		return
+	}
+	setAttr(root, baseAttr, prefix)
+}
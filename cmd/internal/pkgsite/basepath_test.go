@@ -0,0 +1,180 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	"github.com/wow-look-at-my/static-pkgsite/static"
+)
+
+func TestJSPatches(t *testing.T) {
+	applied := map[string]bool{}
+	var before, after []string
+	err := fs.WalkDir(static.FS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".js" {
+			return err
+		}
+		data, err := fs.ReadFile(static.FS, p)
+		if err != nil {
+			return err
+		}
+		for _, patch := range jsPatches {
+			if strings.Contains(string(data), patch.old) {
+				applied[patch.name] = true
+			}
+		}
+		before = append(before, rootNavigations(data)...)
+		for _, m := range rootNavigations(patchJS(data)) {
+			after = append(after, p+": "+m)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, patch := range jsPatches {
+		if !applied[patch.name] {
+			t.Errorf("patch %q matches no script", patch.name)
+		}
+	}
+	// The check finds what the patches fix.
+	if len(before) == 0 {
+		t.Error("no root-path navigation found in the unpatched scripts")
+	}
+	for _, m := range after {
+		t.Errorf("root-path navigation left after patching: %s", m)
+	}
+}
+
+func TestRootNavigations(t *testing.T) {
+	for _, test := range []struct {
+		js   string
+		want bool
+	}{
+		{`window.location.href="/search?q="+q`, true},
+		{`history.pushState(null,"","/about")`, true},
+		{`if(location.pathname==="/")return`, true},
+		{`["/about","/help"].includes(location.pathname)`, true},
+		{`["about"].includes(path)`, false},
+		{`["/about"].includes(window.location.pathname)`, true},
+		{`window.location.href="//example.com/"`, false},
+		{`history.replaceState(null,"",t.toString())`, false},
+		{`history.replaceState(null,"",` + "`${location.pathname}#x`" + `)`, false},
+		{`fetch("/play/share")`, false},
+	} {
+		if got := len(rootNavigations([]byte(test.js))) > 0; got != test.want {
+			t.Errorf("rootNavigations(%q) found %t, want %t", test.js, got, test.want)
+		}
+	}
+}
+
+// TestJSBaseURL runs the patched code in node for pages at different
+// depths, in relative and absolute mode.
+func TestJSBaseURL(t *testing.T) {
+	testenv.MustHaveExecPath(t, "node")
+	var about, canonical string
+	for _, p := range jsPatches {
+		switch p.name {
+		case "about jump links":
+			about = p.new
+		case "canonical URL shortcut":
+			canonical = strings.TrimSuffix(strings.TrimPrefix(p.new, `window.history.replaceState(null,"",`), `)}});`)
+		}
+	}
+	for _, test := range []struct {
+		href, base    string
+		wantAbout     bool
+		wantCanonical string
+	}{
+		{"https://h/about/", "../", true, "https://h/example.com/m@v1.0.0#X"},
+		{"https://h/docs/about/index.html", "../", true, "https://h/docs/example.com/m@v1.0.0#X"},
+		{"https://h/docs/example.com/m/", "../../", false, "https://h/docs/example.com/m@v1.0.0#X"},
+		{"https://h/docs/missing/page", "/docs/", false, "https://h/docs/example.com/m@v1.0.0#X"},
+		{"https://h/", "", false, "https://h/example.com/m@v1.0.0#X"},
+	} {
+		script := `const location = new URL(` + jsString(test.href) + `);
+const window = {location};
+const document = {documentElement: {dataset: {pkgsiteBase: ` + jsString(test.base) + `}}};
+const n = "/example.com/m@v1.0.0#X";
+console.log(` + about + `, ` + canonical + `);`
+		out, err := exec.Command("node", "-e", script).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", test.href, err, out)
+		}
+		got := strings.TrimSpace(string(out))
+		want := fmt.Sprintf("%t %s", test.wantAbout, test.wantCanonical)
+		if got != want {
+			t.Errorf("%s with base %q: got %q, want %q", test.href, test.base, got, want)
+		}
+	}
+}
+
+func jsString(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func TestGenerateStaticSiteBaseAttr(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true, SiteURL: "https://example.org/docs/"}
+	if err := GenerateStaticSite(context.Background(), cfg, outDir); err != nil {
+		t.Fatal(err)
+	}
+	attrRE := regexp.MustCompile(`<html[^>]* data-pkgsite-base="([^"]*)"`)
+	for file, want := range map[string]string{
+		"index.html":               "./",
+		"about/index.html":         "../",
+		"example.com/m/index.html": "../../",
+		"404.html":                 "/docs/",
+	} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := attrRE.FindSubmatch(data)
+		if m == nil {
+			t.Errorf("%s: no %s attribute", file, baseAttr)
+		} else if string(m[1]) != want {
+			t.Errorf("%s: %s = %q, want %q", file, baseAttr, m[1], want)
+		}
+	}
+
+	err := filepath.WalkDir(outDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".js" {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		for _, m := range rootNavigations(data) {
+			t.Errorf("%s: root-path navigation %s", p, m)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
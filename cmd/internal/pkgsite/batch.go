@@ -0,0 +1,734 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// A site can document many independent modules, such as the hundreds of
+// small repositories of a platform, in one batch, as GenerateBatch does
+// with the entries of a manifest. Each entry is a module read from a local
+// directory, a clone of a git repository, or a download from the module
+// proxy. The entries are generated in waves of BatchOptions.WaveSize, each
+// a run of the generator into the output directory that loads only the
+// modules of its wave, so that memory stays bounded whatever the size of
+// the batch. The modules of the other entries that the output directory
+// already has pages of, from earlier waves or an earlier batch, are frozen
+// in the run (see frozen.go): their files are copied as they are, and they
+// contribute their units to the homepage, the search index, the imported-by
+// pages and the checks of the site, which has one copy of the assets.
+//
+// The entries of a wave are cloned or downloaded BatchOptions.Concurrency
+// at a time, and their pages are rendered by GenerateOptions.Workers. An
+// entry that cannot be fetched fails alone. A wave whose run fails is run
+// again one entry at a time, so that a failing entry fails alone too. A
+// failed entry is left out of the site, along with any pages it had, and
+// the report says why; in strict mode, it also fails the batch, once the
+// other entries are done.
+//
+// After each run, the entries it generated are recorded in batchFile in
+// the output directory, the checkpoint of the batch. With
+// BatchOptions.Resume, the entries that the checkpoint records as
+// generated, with the same settings, keep their pages, and only the others
+// are generated, as after a run that was stopped or had failed entries. A
+// resumed entry is not checked for changes of its sources.
+//
+// The pages of every module are at its module path, so an entry cannot be
+// mounted elsewhere in the site. The modules of the output directory that
+// are not of an entry, such as those of entries since removed from the
+// manifest, are removed from the site.
+const batchFile = ".pkgsite-batch.json"
+
+// The getters of batch entries.
+const (
+	batchLocal = "local"
+	batchGit   = "git"
+	batchProxy = "proxy"
+)
+
+// The statuses of batch entries, as schema.BatchOutcome has them.
+const (
+	batchGenerated = "generated"
+	batchResumed   = "resumed"
+	batchFailed    = "failed"
+)
+
+// A BatchEntry is a module of a batch.
+type BatchEntry struct {
+	// Name names the entry in the report and the checkpoint. If empty, it
+	// is the module path, or else the source.
+	Name string `json:"name,omitempty"`
+	// Getter is what the module is read from: "local", the default, for a
+	// directory, "git" for a clone of a git repository, or "proxy" for a
+	// download from the module proxy, as for ServerConfig.RemoteModules.
+	Getter string `json:"getter,omitempty"`
+	// Source is the directory of a local module, or the URL of the
+	// repository of a git module.
+	Source string `json:"source,omitempty"`
+	// Dir is the directory of a git module in its repository, if it is not
+	// the root.
+	Dir string `json:"dir,omitempty"`
+	// Version is the branch or tag of a git module to clone, rather than
+	// the default branch, or the version of a proxy module, or a query
+	// such as latest, the default.
+	Version string `json:"version,omitempty"`
+	// Module is the module path. A proxy module needs it; that of another
+	// module, if set, must be the one its go.mod file declares.
+	Module string `json:"module,omitempty"`
+	// Mount is the path of the pages of the module in the site. As the
+	// pages of a module are at its module path, it must be empty or the
+	// module path.
+	Mount string `json:"mount,omitempty"`
+}
+
+// name returns the name of e in the report and the checkpoint.
+func (e BatchEntry) name() string {
+	switch {
+	case e.Name != "":
+		return e.Name
+	case e.Module != "":
+		return e.Module
+	}
+	return e.Source
+}
+
+// check reports whether e is a valid entry.
+func (e BatchEntry) check() error {
+	switch e.Getter {
+	case "", batchLocal:
+		if e.Source == "" {
+			return fmt.Errorf("batch entry %s: no source directory", e.name())
+		}
+		if e.Dir != "" {
+			return fmt.Errorf("batch entry %s: dir is for git modules", e.name())
+		}
+	case batchGit:
+		if e.Source == "" {
+			return fmt.Errorf("batch entry %s: no repository URL", e.name())
+		}
+		if e.Dir != "" && !filepath.IsLocal(e.Dir) {
+			return fmt.Errorf("batch entry %s: dir %q is not a directory of the repository", e.name(), e.Dir)
+		}
+	case batchProxy:
+		if e.Module == "" {
+			return fmt.Errorf("batch entry %s: a proxy module needs its module path", e.name())
+		}
+		if e.Source != "" || e.Dir != "" {
+			return fmt.Errorf("batch entry %s: a proxy module has no source or dir", e.name())
+		}
+	default:
+		return fmt.Errorf("batch entry %s: unknown getter %q: want local, git or proxy", e.name(), e.Getter)
+	}
+	if e.name() == "" {
+		return errors.New("batch entry without a name, module or source")
+	}
+	return e.checkMount(e.Module)
+}
+
+// checkMount reports whether the mount path of e, if any, is the module
+// path mod, if it is known.
+func (e BatchEntry) checkMount(mod string) error {
+	mount := strings.Trim(e.Mount, "/")
+	if mount == "" || mod == "" || mount == mod {
+		return nil
+	}
+	return fmt.Errorf("batch entry %s: cannot mount module %s at %s: the pages of a module are at its module path", e.name(), mod, e.Mount)
+}
+
+// spec returns the hex SHA-256 hash of e, which tells the checkpoint
+// whether an entry changed since it was generated.
+func (e BatchEntry) spec() string {
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadBatchManifest reads the entries of a batch from a JSON file, an
+// object whose "entries" field is an array of BatchEntry. The source
+// directories of local modules are relative to the directory of the file.
+func LoadBatchManifest(file string) ([]BatchEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m struct {
+		Entries []BatchEntry `json:"entries"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	dir := filepath.Dir(file)
+	for i := range m.Entries {
+		e := &m.Entries[i]
+		if err := e.check(); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if (e.Getter == "" || e.Getter == batchLocal) && !filepath.IsAbs(e.Source) {
+			e.Source = filepath.Join(dir, e.Source)
+		}
+	}
+	return m.Entries, nil
+}
+
+// BatchOptions holds the settings of a batch run.
+type BatchOptions struct {
+	// Entries are the modules of the batch.
+	Entries []BatchEntry
+	// WaveSize is the number of entries generated by each run of the
+	// generator. If it is not positive, it is 16.
+	WaveSize int
+	// Concurrency is the number of entries of a wave cloned or downloaded
+	// at once. If it is not positive, it is 4.
+	Concurrency int
+	// Resume keeps the pages of the entries that the checkpoint in the
+	// output directory records as generated with the same entry and
+	// options, rather than generating them again.
+	Resume bool
+}
+
+// A batchCheckpoint is the contents of batchFile.
+type batchCheckpoint struct {
+	// Options is the hash of the options of the pages of the batch, as
+	// optionsRecord.Page has it.
+	Options string                          `json:"options"`
+	Entries map[string]batchCheckpointEntry `json:"entries"` // by name
+}
+
+// A batchCheckpointEntry records the outcome of an entry.
+type batchCheckpointEntry struct {
+	Spec    string `json:"spec"` // BatchEntry.spec
+	Module  string `json:"module,omitempty"`
+	Version string `json:"version,omitempty"`
+	Status  string `json:"status"`
+}
+
+// readBatchCheckpoint returns the checkpoint in the output directory dir,
+// or an empty one if there is none.
+func readBatchCheckpoint(dir string) (*batchCheckpoint, error) {
+	ckpt := &batchCheckpoint{Entries: map[string]batchCheckpointEntry{}}
+	data, err := os.ReadFile(filepath.Join(dir, batchFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ckpt, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, ckpt); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, batchFile), err)
+	}
+	if ckpt.Entries == nil {
+		ckpt.Entries = map[string]batchCheckpointEntry{}
+	}
+	return ckpt, nil
+}
+
+// write records ckpt in the output directory dir.
+func (ckpt *batchCheckpoint) write(dir string) error {
+	data, err := json.MarshalIndent(ckpt, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeSiteFile(filepath.Join(dir, batchFile), append(data, '\n'))
+}
+
+// A fetchedEntry is an entry of a wave, ready to be generated.
+type fetchedEntry struct {
+	module  string
+	version string        // of a proxy or git module
+	dir     string        // the module directory of a local or git module
+	remote  ModuleVersion // a proxy module
+}
+
+// fetchEntry readies the entry e to be generated, cloning a git module
+// into the directory tmp.
+func fetchEntry(ctx context.Context, e BatchEntry, tmp string) (*fetchedEntry, error) {
+	f := &fetchedEntry{}
+	switch e.Getter {
+	case batchProxy:
+		version := e.Version
+		if version == "" {
+			version = "latest"
+		}
+		mods, err := downloadModules([]ModuleVersion{{Path: e.Module, Version: version}})
+		if err != nil {
+			return nil, err
+		}
+		f.module, f.version = mods[0].Path, mods[0].Version
+		f.remote = ModuleVersion{Path: f.module, Version: f.version}
+		return f, nil
+	case batchGit:
+		args := []string{"clone", "--quiet", "--depth", "1"}
+		if e.Version != "" {
+			args = append(args, "--branch", e.Version)
+		}
+		args = append(args, "--", e.Source, tmp)
+		if err := runGit(ctx, "", args...); err != nil {
+			return nil, err
+		}
+		out, err := exec.CommandContext(ctx, "git", "-C", tmp, "rev-parse", "HEAD").Output()
+		if err != nil {
+			return nil, fmt.Errorf("git rev-parse: %v", err)
+		}
+		f.version = strings.TrimSpace(string(out))
+		f.dir = filepath.Join(tmp, filepath.FromSlash(e.Dir))
+	default:
+		f.dir = e.Source
+	}
+	data, err := os.ReadFile(filepath.Join(f.dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	f.module = modfile.ModulePath(data)
+	switch {
+	case f.module == "":
+		return nil, fmt.Errorf("%s: no module directive", filepath.Join(f.dir, "go.mod"))
+	case e.Module != "" && e.Module != f.module:
+		return nil, fmt.Errorf("%s declares module %s, not %s", filepath.Join(f.dir, "go.mod"), f.module, e.Module)
+	}
+	return f, nil
+}
+
+// runGit runs git with args in dir, returning an error with its output if
+// it fails.
+func runGit(ctx context.Context, dir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// A repository that needs credentials fails rather than prompting.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %v: %s", args[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// checkBatchConfig reports whether serverCfg and opts can be those of a
+// batch, whose modules are those of its entries, and whose output is a
+// directory of its own.
+func checkBatchConfig(serverCfg ServerConfig, opts GenerateOptions) error {
+	if len(serverCfg.Paths) > 0 || len(serverCfg.ModuleVersions) > 0 || len(serverCfg.RemoteModules) > 0 ||
+		len(serverCfg.ModuleZips) > 0 || len(serverCfg.CachedModules) > 0 || serverCfg.Workspace != "" ||
+		serverCfg.Stdlib || serverCfg.DiscoverModules || serverCfg.GOPATHMode || len(opts.Frozen) > 0 {
+		return errors.New("the modules of a batch are those of its entries")
+	}
+	format, err := outputFormat(opts.OutDir, opts.Format)
+	if err != nil {
+		return err
+	}
+	switch {
+	case format != formatDir:
+		return errors.New("a batch is generated into an output directory, not an archive")
+	case opts.Archive:
+		return errors.New("cannot archive the snapshots of a batch")
+	case opts.ReproBundle != "":
+		return errors.New("cannot write a repro bundle of a batch")
+	}
+	return nil
+}
+
+// intactModules returns the modules of recorded whose records are intact
+// and whose files in the output directory dir are as its manifest records
+// them, leaving out those that a run stopped halfway may have left
+// otherwise, with a warning to state.
+func intactModules(dir string, recorded map[string]*moduleContribution, state *batchState) (map[string]*moduleContribution, error) {
+	if len(recorded) == 0 {
+		return recorded, nil
+	}
+	manifest, err := readManifest(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	intact := map[string]*moduleContribution{}
+	for mod, c := range recorded {
+		if !recordIntact(c) {
+			state.warnf("the record of module %s is corrupt; generating it again", mod)
+			continue
+		}
+		ok := true
+		for _, p := range c.Files {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+			if err != nil {
+				ok = false
+				break
+			}
+			sum := sha256.Sum256(data)
+			if manifest[p] != hex.EncodeToString(sum[:]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			intact[mod] = c
+		} else {
+			state.warnf("the files of module %s changed since they were recorded; generating it again", mod)
+		}
+	}
+	return intact, nil
+}
+
+// A batchState is the state of a batch run.
+type batchState struct {
+	serverCfg ServerConfig // as given, without the modules of the runs
+	opts      GenerateOptions
+	strict    bool
+	logw      io.Writer
+	entries   []BatchEntry
+	outcomes  []BatchOutcome // by entry
+	specs     []string       // by entry
+	waves     [][]int        // the entries of each wave
+	ckpt      *batchCheckpoint
+	recorded  map[string]*moduleContribution // the modules with pages in the output directory
+	reports   []*Report                      // of the runs that succeeded
+	// clean reports whether the last run succeeded, and no entry failed
+	// since.
+	clean bool
+}
+
+func (s *batchState) warnf(format string, args ...any) {
+	fmt.Fprintf(s.logw, "Warning: "+format+"\n", args...)
+}
+
+// GenerateBatch generates the site of the entries of batch into
+// opts.OutDir, with the other settings of serverCfg and opts, which must
+// not list modules of their own. It returns the report of the batch, with
+// the outcome of each entry. Entries that fail are left out of the site;
+// in strict mode, they also make it return an error, along with the
+// report.
+func GenerateBatch(ctx context.Context, serverCfg ServerConfig, opts GenerateOptions, batch BatchOptions) (*Report, error) {
+	if err := checkBatchConfig(serverCfg, opts); err != nil {
+		return nil, err
+	}
+	applied, outDir, err := opts.apply(serverCfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(batch.Entries) == 0 {
+		return nil, errors.New("no entries in the batch")
+	}
+	s := &batchState{
+		serverCfg: serverCfg,
+		opts:      opts,
+		strict:    opts.Strict,
+		logw:      applied.logOutput(),
+		entries:   batch.Entries,
+		outcomes:  make([]BatchOutcome, len(batch.Entries)),
+		specs:     make([]string, len(batch.Entries)),
+	}
+	names := map[string]bool{}
+	for i, e := range s.entries {
+		if err := e.check(); err != nil {
+			return nil, err
+		}
+		if names[e.name()] {
+			return nil, fmt.Errorf("batch entry %s is given twice", e.name())
+		}
+		names[e.name()] = true
+		getter := e.Getter
+		if getter == "" {
+			getter = batchLocal
+		}
+		s.outcomes[i] = BatchOutcome{Name: e.name(), Getter: getter, Module: e.Module}
+		s.specs[i] = e.spec()
+	}
+	options, err := newOptionsRecord(serverCfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if s.ckpt, err = readBatchCheckpoint(outDir); err != nil {
+		return nil, err
+	}
+	recorded, err := readModulesFile(outDir)
+	if err != nil {
+		return nil, err
+	}
+	if s.recorded, err = intactModules(outDir, recorded, s); err != nil {
+		return nil, err
+	}
+	s.clean = len(s.recorded) == len(recorded)
+
+	// The entries that the checkpoint records as generated are resumed,
+	// and the modules of the others that it knows are kept until they are
+	// generated again.
+	resume := batch.Resume
+	if resume && s.ckpt.Options != options.Page {
+		s.warnf("the options changed since the checkpoint of the batch; generating every entry again")
+		resume = false
+	}
+	var pending []int
+	for i := range s.entries {
+		c, ok := s.ckpt.Entries[s.outcomes[i].Name]
+		if ok && c.Spec == s.specs[i] {
+			if s.outcomes[i].Module == "" {
+				s.outcomes[i].Module = c.Module
+			}
+			if resume && (c.Status == batchGenerated || c.Status == batchResumed) && s.recorded[c.Module] != nil {
+				s.outcomes[i].Status = batchResumed
+				s.outcomes[i].Version = c.Version
+				continue
+			}
+		}
+		pending = append(pending, i)
+	}
+	s.ckpt = &batchCheckpoint{Options: options.Page, Entries: map[string]batchCheckpointEntry{}}
+	for i, o := range s.outcomes {
+		if o.Status == batchResumed {
+			s.record(i)
+		}
+	}
+
+	waveSize := batch.WaveSize
+	if waveSize <= 0 {
+		waveSize = 16
+	}
+	concurrency := batch.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	s.waves = slices.Collect(slices.Chunk(pending, waveSize))
+	for w, wave := range s.waves {
+		fmt.Fprintf(s.logw, "Generating wave %d of %d of the batch: %d entries\n", w+1, len(s.waves), len(wave))
+		if err := s.generateWave(ctx, outDir, wave, concurrency); err != nil {
+			return nil, err
+		}
+	}
+
+	// The site is generated once more, with every module frozen, if the
+	// last run failed or an entry failed since, or if there was no run.
+	if !s.clean || len(s.reports) == 0 {
+		var frozen []string
+		for _, o := range s.outcomes {
+			if o.Status != batchFailed && s.recorded[o.Module] != nil {
+				frozen = append(frozen, o.Module)
+			}
+		}
+		if len(frozen) > 0 {
+			fmt.Fprintf(s.logw, "Generating the site of the batch\n")
+			if err := s.run(ctx, outDir, nil, frozen, nil); err != nil {
+				return nil, fmt.Errorf("generating the site of the batch: %w", err)
+			}
+		}
+	}
+	return s.report(outDir)
+}
+
+// generateWave generates the entries of wave.
+func (s *batchState) generateWave(ctx context.Context, outDir string, wave []int, concurrency int) error {
+	tmp, err := os.MkdirTemp("", "pkgsite-batch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	fetched := make([]*fetchedEntry, len(s.entries))
+	errs := make([]error, len(s.entries))
+	forEach(ctx, len(wave), concurrency, func(j int) {
+		i := wave[j]
+		fetched[i], errs[i] = fetchEntry(ctx, s.entries[i], filepath.Join(tmp, strconv.Itoa(j)))
+	})
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The modules of the other entries are frozen, so that they stay in
+	// the site.
+	inWave := map[int]bool{}
+	for _, i := range wave {
+		inWave[i] = true
+	}
+	modules := map[string]string{} // the entry names of the modules
+	var frozen []string
+	for i, o := range s.outcomes {
+		if !inWave[i] && o.Status != batchFailed && o.Module != "" {
+			modules[o.Module] = o.Name
+			if s.recorded[o.Module] != nil {
+				frozen = append(frozen, o.Module)
+			}
+		}
+	}
+	var gen []int
+	for _, i := range wave {
+		f := fetched[i]
+		switch {
+		case errs[i] != nil:
+			s.fail(i, errs[i])
+			continue
+		case modules[f.module] != "":
+			s.fail(i, fmt.Errorf("module %s is also that of batch entry %s", f.module, modules[f.module]))
+			continue
+		}
+		if err := s.entries[i].checkMount(f.module); err != nil {
+			s.fail(i, err)
+			continue
+		}
+		modules[f.module] = s.outcomes[i].Name
+		s.outcomes[i].Module, s.outcomes[i].Version = f.module, f.version
+		gen = append(gen, i)
+	}
+	if len(gen) == 0 {
+		return nil
+	}
+	err = s.run(ctx, outDir, gen, frozen, fetched)
+	if err == nil || ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(gen) == 1 {
+		s.fail(gen[0], err)
+		return nil
+	}
+	// The entries are run one at a time, to find those that fail. Those
+	// of the wave already generated stay in the site.
+	s.warnf("generating %d entries at once failed; generating them one at a time: %v", len(gen), err)
+	for _, i := range gen {
+		if err := s.run(ctx, outDir, []int{i}, frozen, fetched); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.fail(i, err)
+			continue
+		}
+		frozen = append(frozen, s.outcomes[i].Module)
+	}
+	return nil
+}
+
+// run generates the entries gen, fetched as fetched has them by entry,
+// and freezes the modules of frozen. Once it succeeds, the entries are
+// recorded as generated in the checkpoint.
+func (s *batchState) run(ctx context.Context, outDir string, gen []int, frozen []string, fetched []*fetchedEntry) error {
+	cfg := s.serverCfg
+	for _, i := range gen {
+		f := fetched[i]
+		if f.dir != "" {
+			cfg.Paths = append(cfg.Paths, f.dir)
+		} else {
+			cfg.RemoteModules = append(cfg.RemoteModules, f.remote)
+		}
+	}
+	opts := s.opts
+	opts.Frozen = frozen
+	report, err := GenerateStaticSiteWithOptions(ctx, cfg, opts)
+	if err != nil {
+		s.clean = false
+		return err
+	}
+	s.reports = append(s.reports, report)
+	s.clean = true
+	if s.recorded, err = readModulesFile(outDir); err != nil {
+		return err
+	}
+	for _, i := range gen {
+		s.outcomes[i].Status = batchGenerated
+		s.record(i)
+	}
+	return s.ckpt.write(outDir)
+}
+
+// record records the outcome of the entry i in the checkpoint.
+func (s *batchState) record(i int) {
+	o := s.outcomes[i]
+	s.ckpt.Entries[o.Name] = batchCheckpointEntry{Spec: s.specs[i], Module: o.Module, Version: o.Version, Status: o.Status}
+}
+
+// fail records that the entry i failed with err.
+func (s *batchState) fail(i int, err error) {
+	s.outcomes[i].Status = batchFailed
+	s.outcomes[i].Error = err.Error()
+	s.record(i)
+	s.clean = false
+	s.warnf("batch entry %s failed: %v", s.outcomes[i].Name, err)
+}
+
+// report returns the report of the batch: that of its last run, with the
+// outcomes of the entries, the units of the site, and the lists about the
+// pages of the entries generated by the earlier runs.
+func (s *batchState) report(outDir string) (*Report, error) {
+	if err := s.ckpt.write(outDir); err != nil {
+		return nil, err
+	}
+	report := &Report{SchemaVersion: schema.ReportArtifact.Version.String()}
+	if n := len(s.reports); n > 0 {
+		report = s.reports[n-1]
+		for _, r := range s.reports[:n-1] {
+			report.FailedPages = append(r.FailedPages, report.FailedPages...)
+			report.Redactions = append(r.Redactions, report.Redactions...)
+			report.HiddenSymbols = append(r.HiddenSymbols, report.HiddenSymbols...)
+			report.PlatformDivergence = append(r.PlatformDivergence, report.PlatformDivergence...)
+			report.EmptyDocs = append(r.EmptyDocs, report.EmptyDocs...)
+			report.LeftOut = append(r.LeftOut, report.LeftOut...)
+			report.Degradations = append(r.Degradations, report.Degradations...)
+		}
+	}
+	report.Units = 0
+	for _, mod := range slices.Sorted(maps.Keys(s.recorded)) {
+		report.Units += len(s.recorded[mod].Units)
+	}
+	failed := 0
+	for i := range s.outcomes {
+		o := &s.outcomes[i]
+		if o.Status == batchFailed {
+			failed++
+			continue
+		}
+		if c := s.recorded[o.Module]; c != nil {
+			o.Units, o.Pages = len(c.Units), len(c.Pages)
+		}
+		for _, p := range report.FailedPages {
+			if unitInModule(strings.TrimPrefix(p.URLPath, "/"), o.Module) {
+				o.FailedPages = append(o.FailedPages, p)
+			}
+		}
+	}
+	report.Batch = &Batch{Waves: len(s.waves), Entries: s.outcomes}
+	writeBatchReport(s.logw, report.Batch)
+	if failed == len(s.outcomes) {
+		return report, errors.New("every entry of the batch failed")
+	}
+	if failed > 0 && s.strict {
+		return report, fmt.Errorf("%d of %d entries of the batch failed", failed, len(s.outcomes))
+	}
+	return report, nil
+}
+
+// unitInModule reports whether the unit path p, which may name a version
+// or a tab, is in the module mod.
+func unitInModule(p, mod string) bool {
+	rest, ok := strings.CutPrefix(p, mod)
+	return ok && (rest == "" || rest[0] == '/' || rest[0] == '@' || rest[0] == '?')
+}
+
+// writeBatchReport writes a summary of b for humans.
+func writeBatchReport(w io.Writer, b *Batch) {
+	counts := map[string]int{}
+	for _, o := range b.Entries {
+		counts[o.Status]++
+	}
+	fmt.Fprintf(w, "Batch of %d entries in %d waves: %d generated, %d resumed, %d failed\n",
+		len(b.Entries), b.Waves, counts[batchGenerated], counts[batchResumed], counts[batchFailed])
+	for _, o := range b.Entries {
+		if o.Status == batchFailed {
+			fmt.Fprintf(w, "  %s: %s\n", o.Name, o.Error)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestLoadBatchManifest(t *testing.T) {
+	dir := t.TempDir()
+	load := func(manifest string) ([]BatchEntry, error) {
+		t.Helper()
+		file := filepath.Join(dir, "batch.json")
+		if err := os.WriteFile(file, []byte(manifest), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return LoadBatchManifest(file)
+	}
+	got, err := load(`{"entries": [
+		{"source": "repos/a"},
+		{"name": "b", "getter": "git", "source": "https://example.com/b.git", "dir": "go", "version": "v1.0.0", "module": "example.com/b", "mount": "/example.com/b/"},
+		{"getter": "proxy", "module": "golang.org/x/text", "version": "v0.14.0"}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BatchEntry{
+		{Source: filepath.Join(dir, "repos", "a")},
+		{Name: "b", Getter: "git", Source: "https://example.com/b.git", Dir: "go", Version: "v1.0.0", Module: "example.com/b", Mount: "/example.com/b/"},
+		{Getter: "proxy", Module: "golang.org/x/text", Version: "v0.14.0"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, test := range []struct {
+		manifest, want string
+	}{
+		{`{"entries": [{"source": "a", "path": "x"}]}`, `unknown field "path"`},
+		{`{"entries": [{"getter": "svn", "source": "a"}]}`, `unknown getter "svn"`},
+		{`{"entries": [{"getter": "proxy", "version": "v1.0.0"}]}`, "needs its module path"},
+		{`{"entries": [{"getter": "git", "source": "https://example.com/a.git", "dir": "../a"}]}`, "not a directory of the repository"},
+		{`{"entries": [{"source": "a", "module": "example.com/a", "mount": "docs/a"}]}`, "cannot mount module example.com/a at docs/a"},
+	} {
+		if _, err := load(test.manifest); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one containing %q", test.manifest, err, test.want)
+		}
+	}
+}
+
+func TestGenerateBatch(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	testenv.MustHaveExecPath(t, "git")
+	reposDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- a/go.mod --
+module example.com/a
+-- a/a.go --
+// Package a is the first.
+package a
+-- b/go.mod --
+module example.com/b
+-- b/b.go --
+// Package b is the second.
+package b
+-- c/go.mod --
+module example.com/c
+-- c/c.go --
+// Package c is the third.
+package c
+-- bad/go.mod --
+module example.com/bad
+
+require (
+-- bad/bad.go --
+package bad
+-- wrong/go.mod --
+module example.com/right
+-- wrong/w.go --
+package w
+-- repo/go/go.mod --
+module example.com/g
+-- repo/go/g.go --
+// Package g is cloned.
+package g
+`)
+	repo := filepath.Join(reposDir, "repo")
+	for _, args := range [][]string{
+		{"init", "--quiet", "--initial-branch", "main"},
+		{"add", "."},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "--quiet", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+	// The entry b is given the directory of c at first, which c has too.
+	entries := []BatchEntry{
+		{Source: filepath.Join(reposDir, "a"), Module: "example.com/a"},
+		{Name: "b", Source: filepath.Join(reposDir, "c")},
+		{Name: "c", Source: filepath.Join(reposDir, "c")},
+		{Name: "bad", Source: filepath.Join(reposDir, "bad")},
+		{Name: "g", Getter: "git", Source: repo, Dir: "go", Mount: "example.com/g"},
+		{Name: "wrong", Source: filepath.Join(reposDir, "wrong"), Module: "example.com/wrong"},
+	}
+	outDir := t.TempDir()
+	generate := func(entries []BatchEntry, resume bool) *Report {
+		t.Helper()
+		report, err := GenerateBatch(context.Background(), ServerConfig{}, GenerateOptions{OutDir: outDir}, BatchOptions{
+			Entries:     entries,
+			WaveSize:    2,
+			Concurrency: 2,
+			Resume:      resume,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+	statuses := func(r *Report) map[string]string {
+		m := map[string]string{}
+		for _, o := range r.Batch.Entries {
+			m[o.Name] = o.Status
+			if o.Error != "" {
+				m[o.Name] += ": " + o.Error
+			}
+		}
+		return m
+	}
+	check := func(r *Report, want map[string]string, modules []string) {
+		t.Helper()
+		got := statuses(r)
+		for name, w := range want {
+			if !strings.HasPrefix(got[name], w) {
+				t.Errorf("entry %s: got %q, want %q", name, got[name], w)
+			}
+		}
+		recorded, err := readModulesFile(outDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(modules, slices.Sorted(maps.Keys(recorded))); diff != "" {
+			t.Errorf("modules of the site mismatch (-want +got):\n%s", diff)
+		}
+		home, err := os.ReadFile(filepath.Join(outDir, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, err := os.ReadFile(filepath.Join(outDir, searchIndexFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mod := range modules {
+			if _, err := os.Stat(filepath.Join(outDir, mod, "index.html")); err != nil {
+				t.Errorf("module %s has no page: %v", mod, err)
+			}
+			if !strings.Contains(string(home), mod) {
+				t.Errorf("the homepage does not list %s", mod)
+			}
+			if !strings.Contains(string(index), `"`+mod+`"`) {
+				t.Errorf("the search index has no %s", mod)
+			}
+		}
+	}
+
+	report := generate(entries, false)
+	if report.Batch.Waves != 3 {
+		t.Errorf("got %d waves, want 3", report.Batch.Waves)
+	}
+	check(report, map[string]string{
+		"example.com/a": "generated",
+		"b":             "generated",
+		"c":             "failed: module example.com/c is also that of batch entry b",
+		"bad":           "failed",
+		"g":             "generated",
+		"wrong":         "failed: " + filepath.Join(reposDir, "wrong", "go.mod") + " declares module example.com/right, not example.com/wrong",
+	}, []string{"example.com/a", "example.com/c", "example.com/g"})
+	for _, o := range report.Batch.Entries {
+		if o.Name == "g" && (o.Module != "example.com/g" || len(o.Version) != 40 || o.Units != 1 || o.Pages == 0) {
+			t.Errorf("entry g: got %+v, want module example.com/g at a commit, with a unit and its pages", o)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, batchFile)); err != nil {
+		t.Errorf("no checkpoint: %v", err)
+	}
+
+	// Resuming generates only the failed entries, and those that changed.
+	entries[1].Source = filepath.Join(reposDir, "b")
+	report = generate(entries, true)
+	if report.Batch.Waves != 2 {
+		t.Errorf("resumed: got %d waves, want 2", report.Batch.Waves)
+	}
+	check(report, map[string]string{
+		"example.com/a": "resumed",
+		"b":             "generated",
+		"c":             "generated",
+		"bad":           "failed",
+		"g":             "resumed",
+		"wrong":         "failed",
+	}, []string{"example.com/a", "example.com/b", "example.com/c", "example.com/g"})
+	if !slices.ContainsFunc(report.Batch.Entries, func(o BatchOutcome) bool { return o.Name == "bad" && strings.Contains(o.Error, "go.mod") }) {
+		t.Errorf("entry bad does not fail on its go.mod file: %+v", report.Batch.Entries)
+	}
+
+	// The modules of the entries removed from the batch are removed from
+	// the site.
+	report = generate(entries[:2], true)
+	check(report, map[string]string{"example.com/a": "resumed", "b": "resumed"}, []string{"example.com/a", "example.com/b"})
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "c")); err == nil {
+		t.Error("the pages of example.com/c are left")
+	}
+}
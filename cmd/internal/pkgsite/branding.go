@@ -0,0 +1,246 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Every page gets theme-color meta tags for the light and dark color
+// schemes, or for the scheme of GenerateOptions.ColorScheme, and icon links: the .ico favicon, which all browsers support,
+// followed by any SVG favicons, which browsers that support them prefer.
+// An SVG favicon can differ between the color schemes. The branding
+// settings replace these together.
+
+// Default theme colors, matching the header in the light scheme and the
+// page background in the dark one.
+const (
+	defaultThemeColor     = "#007d9c"
+	defaultThemeColorDark = "#202224"
+)
+
+// brandingDir is the directory of the output holding the favicons of the
+// branding settings. Their file names include a hash of their contents, so
+// that they can be cached indefinitely.
+const brandingDir = "static/branding"
+
+// builtinFavicon is the site path of the built-in .ico favicon.
+const builtinFavicon = "static/shared/icon/favicon.ico"
+
+// Branding replaces the icons and theme colors of the site. File names are
+// relative to the directory of the file the settings are loaded from.
+type Branding struct {
+	// ThemeColor and ThemeColorDark are the CSS colors of the theme-color
+	// meta tags for the light and dark color schemes.
+	ThemeColor     string `json:"themeColor,omitempty"`
+	ThemeColorDark string `json:"themeColorDark,omitempty"`
+	// Favicon is an .ico file replacing the built-in favicon.
+	Favicon string `json:"favicon,omitempty"`
+	// FaviconSVG is an SVG favicon. If FaviconSVGDark is also set,
+	// FaviconSVG is used only in the light color scheme.
+	FaviconSVG     string `json:"faviconSVG,omitempty"`
+	FaviconSVGDark string `json:"faviconSVGDark,omitempty"`
+}
+
+// LoadBranding reads branding settings from a JSON file.
+func LoadBranding(file string) (*Branding, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var b Branding
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&b); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	dir := filepath.Dir(file)
+	for _, f := range []*string{&b.Favicon, &b.FaviconSVG, &b.FaviconSVGDark} {
+		if *f != "" && !filepath.IsAbs(*f) {
+			*f = filepath.Join(dir, *f)
+		}
+	}
+	return &b, nil
+}
+
+// cssColorRE matches the CSS colors accepted as theme colors: hex colors,
+// named colors and rgb() or hsl() functions.
+var cssColorRE = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+|(rgb|hsl)a?\([0-9a-z., %/+-]+\))$`)
+
+// A siteBranding holds the branding of the generated site, with the
+// contents of its favicons.
+type siteBranding struct {
+	themeColor, themeColorDark string
+	favicon                    string            // site path of the .ico favicon
+	svg, svgDark               string            // site paths of the SVG favicons, or ""
+	files                      map[string][]byte // favicons to write, by site path
+	rootFavicon                []byte            // replacement for favicon.ico, or nil
+	scheme                     *colorScheme      // the color scheme of the pages
+}
+
+// newSiteBranding reads the favicons of b, which may be nil, and returns
+// the site's branding.
+func newSiteBranding(b *Branding) (*siteBranding, error) {
+	if b == nil {
+		b = &Branding{}
+	}
+	sb := &siteBranding{
+		themeColor:     b.ThemeColor,
+		themeColorDark: b.ThemeColorDark,
+		favicon:        builtinFavicon,
+		files:          map[string][]byte{},
+		scheme:         &colorScheme{},
+	}
+	if sb.themeColor == "" {
+		sb.themeColor = defaultThemeColor
+	}
+	if sb.themeColorDark == "" {
+		sb.themeColorDark = defaultThemeColorDark
+	}
+	for _, c := range []string{sb.themeColor, sb.themeColorDark} {
+		if !cssColorRE.MatchString(c) {
+			return nil, fmt.Errorf("invalid theme color %q", c)
+		}
+	}
+	add := func(file, ext string) (string, []byte, error) {
+		if file == "" {
+			return "", nil, nil
+		}
+		if !strings.EqualFold(filepath.Ext(file), ext) {
+			return "", nil, fmt.Errorf("favicon %s is not a %s file", file, ext)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", nil, fmt.Errorf("reading favicon: %w", err)
+		}
+		sum := sha256.Sum256(normalizeText(filepath.ToSlash(file), data, false))
+		sitePath := path.Join(brandingDir, "favicon-"+hex.EncodeToString(sum[:6])+ext)
+		sb.files[sitePath] = data
+		return sitePath, data, nil
+	}
+	var err error
+	if sb.svg, _, err = add(b.FaviconSVG, ".svg"); err != nil {
+		return nil, err
+	}
+	if sb.svgDark, _, err = add(b.FaviconSVGDark, ".svg"); err != nil {
+		return nil, err
+	}
+	if sb.svgDark != "" && sb.svg == "" {
+		return nil, fmt.Errorf("a dark SVG favicon needs a light one")
+	}
+	var ico string
+	if ico, sb.rootFavicon, err = add(b.Favicon, ".ico"); err != nil {
+		return nil, err
+	}
+	if ico != "" {
+		sb.favicon = ico
+	}
+	return sb, nil
+}
+
+// transform returns the page transform replacing the page's icon links
+// with those of the branding, adding its theme colors and pinning its
+// color scheme.
+func (sb *siteBranding) transform() pageTransform {
+	return func(doc *html.Node, head *headManager) {
+		sb.scheme.pin(doc)
+		if h := findElement(doc, "head"); h != nil {
+			for c := h.FirstChild; c != nil; {
+				next := c.NextSibling
+				if c.Type == html.ElementNode && c.Data == "link" && isIconLink(c) {
+					h.RemoveChild(c)
+				}
+				c = next
+			}
+		}
+		link := func(href string, attrs ...html.Attribute) *html.Node {
+			return &html.Node{
+				Type:     html.ElementNode,
+				Data:     "link",
+				DataAtom: atom.Link,
+				Attr:     append([]html.Attribute{{Key: "rel", Val: "icon"}, {Key: "href", Val: "/" + href}}, attrs...),
+			}
+		}
+		// The theme color of a pinned scheme is for every system scheme.
+		meta := func(color, scheme string) *html.Node {
+			n := &html.Node{
+				Type:     html.ElementNode,
+				Data:     "meta",
+				DataAtom: atom.Meta,
+				Attr: []html.Attribute{
+					{Key: "name", Val: "theme-color"},
+					{Key: "content", Val: color},
+				},
+			}
+			if scheme != "" {
+				n.Attr = append(n.Attr, html.Attribute{Key: "media", Val: "(prefers-color-scheme: " + scheme + ")"})
+			}
+			return n
+		}
+		nodes := []*html.Node{link(sb.favicon, html.Attribute{Key: "sizes", Val: "any"})}
+		svgType := html.Attribute{Key: "type", Val: "image/svg+xml"}
+		switch {
+		case sb.svgDark != "":
+			nodes = append(nodes,
+				link(sb.svg, svgType, html.Attribute{Key: "media", Val: "(prefers-color-scheme: light)"}),
+				link(sb.svgDark, svgType, html.Attribute{Key: "media", Val: "(prefers-color-scheme: dark)"}))
+		case sb.svg != "":
+			nodes = append(nodes, link(sb.svg, svgType))
+		}
+		switch sb.scheme.scheme {
+		case "light":
+			nodes = append(nodes, meta(sb.themeColor, ""))
+		case "dark":
+			nodes = append(nodes, meta(sb.themeColorDark, ""))
+		default:
+			nodes = append(nodes, meta(sb.themeColor, "light"), meta(sb.themeColorDark, "dark"))
+		}
+		head.register("branding", headOrderBranding, nodes...)
+	}
+}
+
+// isIconLink reports whether the <link> element n links a favicon.
+func isIconLink(n *html.Node) bool {
+	for _, rel := range strings.Fields(strings.ToLower(attrValue(n, "rel"))) {
+		if rel == "icon" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFiles writes the branding favicons to out, and the replacement for
+// the built-in favicon.ico, if any. The files are added to assets.
+func (sb *siteBranding) writeFiles(out *siteOutput, assets *assetGraph) error {
+	for sitePath, data := range sb.files {
+		file := filepath.Join(out.dir, filepath.FromSlash(sitePath))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return err
+		}
+		if err := out.writeFile(file, data); err != nil {
+			return err
+		}
+		assets.addFile(sitePath, data)
+	}
+	if sb.rootFavicon != nil {
+		if err := out.writeFile(filepath.Join(out.dir, "favicon.ico"), sb.rootFavicon); err != nil {
+			return err
+		}
+		assets.addFile("favicon.ico", sb.rootFavicon)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestNewSiteBrandingErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte("<svg/>"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	svg, png := write("icon.svg"), write("icon.png")
+	for _, b := range []*Branding{
+		{ThemeColor: "red; x"},
+		{ThemeColorDark: "url(x)"},
+		{FaviconSVGDark: svg},
+		{FaviconSVG: png},
+		{Favicon: svg},
+		{FaviconSVG: filepath.Join(dir, "missing.svg")},
+	} {
+		if _, err := newSiteBranding(b); err == nil {
+			t.Errorf("newSiteBranding(%+v): got nil error", b)
+		}
+	}
+}
+
+func TestLoadBranding(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "branding.json")
+	if err := os.WriteFile(file, []byte(`{"themeColor": "#fff", "faviconSVG": "icons/light.svg"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadBranding(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Branding{ThemeColor: "#fff", FaviconSVG: filepath.Join(dir, "icons", "light.svg")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"themeColour": "#fff"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBranding(file); err == nil {
+		t.Error("unknown field: got nil error")
+	}
+}
+
+func TestGenerateStaticSiteBranding(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`)
+	iconDir := t.TempDir()
+	for name, data := range map[string]string{
+		"light.svg": `<svg xmlns="http://www.w3.org/2000/svg"><circle r="1" fill="black"/></svg>`,
+		"dark.svg":  `<svg xmlns="http://www.w3.org/2000/svg"><circle r="1" fill="white"/></svg>`,
+	} {
+		if err := os.WriteFile(filepath.Join(iconDir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	linkRE := regexp.MustCompile(`<link rel="icon" href="([^"]*)"[^>]*>`)
+	metaRE := regexp.MustCompile(`<meta name="theme-color"[^>]*>`)
+	checkPage := func(t *testing.T, outDir, file string, wantIcons, wantMetas []string) {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := string(data)
+		if diff := cmp.Diff(wantIcons, linkRE.FindAllString(page, -1)); diff != "" {
+			t.Errorf("%s: icon links mismatch (-want +got):\n%s", file, diff)
+		}
+		if diff := cmp.Diff(wantMetas, metaRE.FindAllString(page, -1)); diff != "" {
+			t.Errorf("%s: theme-color tags mismatch (-want +got):\n%s", file, diff)
+		}
+		if strings.Contains(page, `rel="shortcut icon"`) {
+			t.Errorf("%s: the template's favicon link was not replaced", file)
+		}
+		for _, m := range linkRE.FindAllStringSubmatch(page, -1) {
+			target := filepath.Join(filepath.Dir(filepath.Join(outDir, filepath.FromSlash(file))), filepath.FromSlash(m[1]))
+			if _, err := os.Stat(target); err != nil {
+				t.Errorf("%s: icon %s: %v", file, m[1], err)
+			}
+		}
+	}
+
+	t.Run("default", func(t *testing.T) {
+		outDir := t.TempDir()
+		cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+		if err := GenerateStaticSite(context.Background(), cfg, outDir); err != nil {
+			t.Fatal(err)
+		}
+		checkPage(t, outDir, "example.com/m/index.html",
+			[]string{`<link rel="icon" href="../../static/shared/icon/favicon.ico" sizes="any"/>`},
+			[]string{
+				`<meta name="theme-color" content="#007d9c" media="(prefers-color-scheme: light)"/>`,
+				`<meta name="theme-color" content="#202224" media="(prefers-color-scheme: dark)"/>`,
+			})
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		outDir := t.TempDir()
+		cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+		opts := GenerateOptions{
+			OutDir: outDir,
+			Branding: &Branding{
+				ThemeColor:     "#ffffff",
+				ThemeColorDark: "rgb(0, 0, 0)",
+				FaviconSVG:     filepath.Join(iconDir, "light.svg"),
+				FaviconSVGDark: filepath.Join(iconDir, "dark.svg"),
+			},
+		}
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+			t.Fatal(err)
+		}
+		sb, err := newSiteBranding(opts.Branding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metas := []string{
+			`<meta name="theme-color" content="#ffffff" media="(prefers-color-scheme: light)"/>`,
+			`<meta name="theme-color" content="rgb(0, 0, 0)" media="(prefers-color-scheme: dark)"/>`,
+		}
+		for _, test := range []struct {
+			file, prefix string
+		}{
+			{"index.html", "./"},
+			{"example.com/m/index.html", "../../"},
+			{"404.html", "/"},
+		} {
+			checkPage(t, outDir, test.file, []string{
+				`<link rel="icon" href="` + test.prefix + `static/shared/icon/favicon.ico" sizes="any"/>`,
+				`<link rel="icon" href="` + test.prefix + sb.svg + `" type="image/svg+xml" media="(prefers-color-scheme: light)"/>`,
+				`<link rel="icon" href="` + test.prefix + sb.svgDark + `" type="image/svg+xml" media="(prefers-color-scheme: dark)"/>`,
+			}, metas)
+		}
+		if !regexp.MustCompile(`^static/branding/favicon-[0-9a-f]{12}\.svg$`).MatchString(sb.svg) || sb.svg == sb.svgDark {
+			t.Errorf("favicon paths %q and %q are not fingerprinted", sb.svg, sb.svgDark)
+		}
+	})
+}
@@ -0,0 +1,259 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A CI job with a hard time limit would rather publish a reduced site than
+// none. With GenerateOptions.TimeBudget, a run projects when it will be
+// done from the time it has taken so far and the pages it has left,
+// estimated from the durations of the recent pages, as the progress
+// reporter estimates the time left. Once the projection passes the soft
+// threshold of the budget, three quarters of it, the run gives up its
+// optional features, a tier at a time, in budgetTiers order, until it no
+// longer does:
+//
+//   - the source pages of the packages not yet rendered;
+//   - the symbol indexes of the modules not yet rendered;
+//   - the download bundles of the modules not yet rendered, and the
+//     archived snapshot of the site.
+//
+// Finally, if the unit pages left would take the run past the budget
+// itself, the remaining units get stubs of their metadata instead of their
+// pages, with no tabs.
+//
+// A feature is given up only for the pages not yet rendered, so that the
+// pages already written keep working links: the source pages of packages
+// whose pages link them are still written, as are the bundles of modules
+// whose pages link them. Each degradation is warned about and recorded in
+// the report.
+
+// Tiers of budgetTiers, also the Feature of a Degradation.
+const (
+	degradeSourcePages = "source-pages"
+	degradeSymbolIndex = "symbol-index"
+	degradeArchives    = "archives"
+	degradeUnitPages   = "unit-pages"
+)
+
+// budgetTiers are the features given up to meet a time budget, in order.
+var budgetTiers = []string{degradeSourcePages, degradeSymbolIndex, degradeArchives, degradeUnitPages}
+
+// budgetClock is the clock of time budgets, replaced by tests.
+var budgetClock = time.Now
+
+// A timeBudget decides what a run gives up to meet its time budget. A nil
+// *timeBudget has no budget, and gives up nothing. It is safe for
+// concurrent use.
+type timeBudget struct {
+	limit, soft time.Duration
+	start       time.Time
+	now         func() time.Time
+	estimate    func(pages int) (time.Duration, bool) // time the pages take, if known
+	w           io.Writer                             // where degradations are warned about
+
+	mu           sync.Mutex
+	left         map[string]int // pages or files left, by tier
+	degradations []Degradation  // in the order the tiers were given up
+}
+
+// newTimeBudget returns a time budget of limit from start, or nil if limit
+// is not positive. estimate returns the time that a number of pages takes
+// to render. Degradations are warned about on w.
+func newTimeBudget(limit time.Duration, start time.Time, estimate func(pages int) (time.Duration, bool), w io.Writer) *timeBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &timeBudget{
+		limit:    limit,
+		soft:     limit * 3 / 4,
+		start:    start,
+		now:      budgetClock,
+		estimate: estimate,
+		w:        w,
+		left:     map[string]int{},
+	}
+}
+
+// plan adds n pages or files to those left of tier.
+func (b *timeBudget) plan(tier string, n int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.left[tier] += n
+}
+
+// done records that n pages or files of tier were written, or skipped.
+func (b *timeBudget) done(tier string, n int) {
+	b.plan(tier, -n)
+}
+
+// check gives up the tiers whose work, with that of the tiers after them,
+// projects the run past its threshold: the soft one, or the budget itself
+// for the unit pages. Tiers with nothing left are not given up.
+func (b *timeBudget) check() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	elapsed := b.now().Sub(b.start)
+	for i, tier := range budgetTiers {
+		if b.givenUp(tier) || b.left[tier] <= 0 {
+			continue
+		}
+		pages := 0
+		for _, t := range budgetTiers[i:] {
+			if !b.givenUp(t) {
+				pages += b.left[t]
+			}
+		}
+		projected := elapsed
+		if d, ok := b.estimate(pages); ok {
+			projected += d
+		}
+		threshold := b.soft
+		if tier == degradeUnitPages {
+			threshold = b.limit
+		}
+		if projected <= threshold {
+			return
+		}
+		b.giveUp(tier, elapsed)
+	}
+}
+
+// skip reports whether tier was given up, and if so records that n of its
+// pages or files were skipped.
+func (b *timeBudget) skip(tier string, n int) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.givenUp(tier) {
+		return false
+	}
+	b.left[tier] -= n
+	for i := range b.degradations {
+		if b.degradations[i].Feature == tier {
+			b.degradations[i].Skipped += n
+		}
+	}
+	return true
+}
+
+// gaveUp reports whether tier was given up.
+func (b *timeBudget) gaveUp(tier string) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.givenUp(tier)
+}
+
+// givenUp is gaveUp with b.mu held.
+func (b *timeBudget) givenUp(tier string) bool {
+	for _, d := range b.degradations {
+		if d.Feature == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// giveUp gives up tier, elapsed into the run. b.mu must be held.
+func (b *timeBudget) giveUp(tier string, elapsed time.Duration) {
+	b.degradations = append(b.degradations, Degradation{Feature: tier, Elapsed: elapsed.Seconds()})
+	what := map[string]string{
+		degradeSourcePages: "the source pages of the packages left",
+		degradeSymbolIndex: "the symbol indexes of the modules left",
+		degradeArchives:    "the download bundles of the modules left and the archived snapshot",
+		degradeUnitPages:   "the pages of the units left, writing stubs instead",
+	}[tier]
+	fmt.Fprintf(b.w, "Warning: %s into a time budget of %s, with %d pages or files left of %s, skipping %s\n",
+		formatETA(elapsed), b.limit, b.left[tier], tier, what)
+}
+
+// degraded returns the degradations, in the order the tiers were given up.
+func (b *timeBudget) degraded() []Degradation {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Degradation(nil), b.degradations...)
+}
+
+// unitStub is the page written for a unit whose page was given up, with
+// its path, its kind and its module.
+const unitStub = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>%[1]s</title>
+</head>
+<body>
+<h1>%[1]s</h1>
+<p>%[2]s in module %[3]s.</p>
+<p>The documentation of this %[4]s was left out of this build of the site, which ran out of time. See the <a href="/">other pages of the site</a>.</p>
+</body>
+</html>
+`
+
+// writeUnitStub writes the stub page of u, in place of its page.
+func writeUnitStub(u *siteUnit, out *siteOutput, consumers pageConsumers) error {
+	urlPath := "/" + u.path
+	kind := "directory"
+	switch {
+	case u.meta.IsCommand():
+		kind = "command"
+	case u.meta.IsPackage():
+		kind = "package"
+	case u.meta.IsModule():
+		kind = "module"
+	}
+	mod := u.meta.ModulePath
+	if v := u.meta.Version; v != "" {
+		mod += "@" + v
+	}
+	body := fmt.Sprintf(unitStub, template.HTMLEscapeString(u.meta.Path), strings.ToUpper(kind[:1])+kind[1:], template.HTMLEscapeString(mod), kind)
+	ev := &pageEvent{URLPath: urlPath, HTML: true}
+	processed, err := processHTML([]byte(body), urlPath, ev, out.pageTransforms(urlPath, nil)...)
+	if err != nil {
+		return fmt.Errorf("processing the stub of %s: %w", urlPath, err)
+	}
+	outPath, err := urlPathToFilePath(urlPath, out.dir, pagePathKind)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+		return err
+	}
+	processed = out.normalize(outPath, processed)
+	if err := out.writeFile(outPath, processed); err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(out.dir, outPath)
+	if err != nil {
+		return err
+	}
+	ev.File = filepath.ToSlash(rel)
+	ev.Size = len(processed)
+	return consumers.consumePage(ev)
+}
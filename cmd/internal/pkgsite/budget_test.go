@@ -0,0 +1,217 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+var budgetStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestTimeBudgetTiers(t *testing.T) {
+	var (
+		elapsed time.Duration
+		warned  strings.Builder
+	)
+	// A page takes a minute, and the pages left take 37 minutes.
+	b := newTimeBudget(time.Hour, budgetStart, func(pages int) (time.Duration, bool) {
+		return time.Duration(pages) * time.Minute, true
+	}, &warned)
+	b.now = func() time.Time { return budgetStart.Add(elapsed) }
+	b.plan(degradeSourcePages, 10)
+	b.plan(degradeSymbolIndex, 5)
+	b.plan(degradeArchives, 2)
+	b.plan(degradeUnitPages, 20)
+
+	for _, step := range []struct {
+		elapsed time.Duration
+		want    []string // tiers given up so far
+	}{
+		{0, nil},
+		{8 * time.Minute, nil}, // 45 minutes, the soft threshold
+		{10 * time.Minute, []string{degradeSourcePages}},
+		{20 * time.Minute, []string{degradeSourcePages, degradeSymbolIndex}},
+		{25 * time.Minute, []string{degradeSourcePages, degradeSymbolIndex, degradeArchives}},
+		{40 * time.Minute, []string{degradeSourcePages, degradeSymbolIndex, degradeArchives}}, // 60 minutes, the budget
+		{41 * time.Minute, budgetTiers},
+	} {
+		elapsed = step.elapsed
+		b.check()
+		var got []string
+		for _, tier := range budgetTiers {
+			if b.gaveUp(tier) {
+				got = append(got, tier)
+			}
+		}
+		if !cmp.Equal(got, step.want) {
+			t.Fatalf("after %s, gave up %v, want %v", elapsed, got, step.want)
+		}
+	}
+
+	if b.skip(degradeSourcePages, 10) != true || b.skip(degradeUnitPages, 3) != true {
+		t.Error("skip of a tier given up returned false")
+	}
+	want := []Degradation{
+		{Feature: degradeSourcePages, Elapsed: 600, Skipped: 10},
+		{Feature: degradeSymbolIndex, Elapsed: 1200},
+		{Feature: degradeArchives, Elapsed: 1500},
+		{Feature: degradeUnitPages, Elapsed: 2460, Skipped: 3},
+	}
+	if diff := cmp.Diff(want, b.degraded()); diff != "" {
+		t.Errorf("degradations mismatch (-want +got):\n%s", diff)
+	}
+	for _, w := range []string{
+		"Warning: 10m0s into a time budget of 1h0m0s, with 10 pages or files left of source-pages, skipping the source pages of the packages left\n",
+		"Warning: 41m0s into a time budget of 1h0m0s, with 20 pages or files left of unit-pages, skipping the pages of the units left, writing stubs instead\n",
+	} {
+		if !strings.Contains(warned.String(), w) {
+			t.Errorf("warnings do not contain %q:\n%s", w, warned.String())
+		}
+	}
+
+	// Without a budget, nothing is given up.
+	var none *timeBudget
+	none.plan(degradeUnitPages, 1)
+	none.check()
+	if none.skip(degradeUnitPages, 1) || none.gaveUp(degradeUnitPages) || none.degraded() != nil {
+		t.Error("a nil budget gave up a tier")
+	}
+	if newTimeBudget(0, budgetStart, nil, nil) != nil {
+		t.Error("got a budget of no time")
+	}
+}
+
+// setBudgetClock makes the clock of time budgets start at budgetStart, and
+// be elapsed after it from its second reading on.
+func setBudgetClock(t *testing.T, elapsed time.Duration) {
+	var (
+		mu      sync.Mutex
+		started bool
+	)
+	budgetClock = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		if !started {
+			started = true
+			return budgetStart
+		}
+		return budgetStart.Add(elapsed)
+	}
+	t.Cleanup(func() { budgetClock = time.Now })
+}
+
+func TestGenerateStaticSiteTimeBudget(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+
+// F does things.
+func F() {}
+-- a/a.go --
+// Package a does other things.
+package a
+
+// G does other things.
+func G() {}
+`)
+	cfg := ServerConfig{
+		Paths:         []string{modDir},
+		UseListedMods: true,
+		SymbolIndex:   true,
+	}
+	for _, test := range []struct {
+		name    string
+		elapsed time.Duration
+		want    []Degradation
+		stubs   bool
+	}{
+		{
+			name:    "within the budget",
+			elapsed: 30 * time.Minute,
+		},
+		{
+			name:    "past the soft threshold",
+			elapsed: 50 * time.Minute,
+			want: []Degradation{
+				{Feature: degradeSourcePages, Elapsed: 3000, Skipped: 2},
+				{Feature: degradeSymbolIndex, Elapsed: 3000, Skipped: 1},
+				{Feature: degradeArchives, Elapsed: 3000, Skipped: 2},
+			},
+		},
+		{
+			name:    "past the budget",
+			elapsed: 2 * time.Hour,
+			want: []Degradation{
+				{Feature: degradeSourcePages, Elapsed: 7200, Skipped: 2},
+				{Feature: degradeSymbolIndex, Elapsed: 7200, Skipped: 1},
+				{Feature: degradeArchives, Elapsed: 7200, Skipped: 2},
+				{Feature: degradeUnitPages, Elapsed: 7200, Skipped: 7}, // with their tabs
+			},
+			stubs: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			setBudgetClock(t, test.elapsed)
+			outDir := t.TempDir()
+			opts := GenerateOptions{OutDir: outDir, TimeBudget: time.Hour, Archive: true, SourcePages: true, DownloadBundles: true}
+			report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, report.Degradations); diff != "" {
+				t.Errorf("degradations mismatch (-want +got):\n%s", diff)
+			}
+			if len(report.BrokenLinks) > 0 {
+				t.Errorf("broken links: %v", report.BrokenLinks)
+			}
+			exists := func(p string) bool {
+				_, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p)))
+				return err == nil
+			}
+			for _, p := range []string{
+				"example.com/m/file/m.go/index.html",
+				"example.com/m/a/file/a.go/index.html",
+				"example.com/m/index/index.html",
+				"downloads/example.com/m.zip",
+			} {
+				if got, want := exists(p), test.want == nil; got != want {
+					t.Errorf("%s exists: %t, want %t", p, got, want)
+				}
+			}
+			if got, want := report.Archive != nil, test.want == nil; got != want {
+				t.Errorf("archived: %t, want %t", got, want)
+			}
+			page, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "a", "index.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(page), "was left out of this build of the site"); got != test.stubs {
+				t.Errorf("the page of example.com/m/a is a stub: %t, want %t", got, test.stubs)
+			}
+			if test.stubs && !strings.Contains(string(page), "<p>Package in module example.com/m@") {
+				t.Errorf("the stub of example.com/m/a does not name its module:\n%s", page)
+			}
+			if got, want := exists("example.com/m/a/imports/index.html"), !test.stubs; got != want {
+				t.Errorf("tab page of example.com/m/a exists: %t, want %t", got, want)
+			}
+		})
+	}
+}
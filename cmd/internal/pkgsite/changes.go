@@ -0,0 +1,167 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A site is often published incrementally, for example with
+//
+//	rsync --files-from=changed-files.txt
+//
+// Every run ends by listing the files of the output directory whose
+// contents changed since the previous run, and those that are gone, by
+// comparing the hashes of the files with those the previous run recorded
+// in its manifest. The lists hold one slash-separated path per line,
+// relative to the output directory, sorted, and are written even when
+// they are empty. The manifest has the format of sha256sum, so that
+//
+//	sha256sum -c manifest.sha256
+//
+// checks the output directory. None of the three files is listed, nor are
+// the files of the archive of snapshots (see archive.go).
+const (
+	manifestFile     = "manifest.sha256"
+	changedFilesFile = "changed-files.txt"
+	deletedFilesFile = "deleted-files.txt"
+)
+
+// writeChangeLists writes the manifest of outDir, and the lists of the
+// files changed and deleted since the previous manifest. It returns the
+// lists.
+func writeChangeLists(outDir string) (changed, deleted []string, err error) {
+	prev, err := readManifest(filepath.Join(outDir, manifestFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	cur, err := hashOutDir(outDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for p, sum := range cur {
+		if prev[p] != sum {
+			changed = append(changed, p)
+		}
+	}
+	for p := range prev {
+		if _, ok := cur[p]; !ok {
+			deleted = append(deleted, p)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(deleted)
+
+	if err := writeLines(filepath.Join(outDir, changedFilesFile), changed); err != nil {
+		return nil, nil, err
+	}
+	if err := writeLines(filepath.Join(outDir, deletedFilesFile), deleted); err != nil {
+		return nil, nil, err
+	}
+	paths := make([]string, 0, len(cur))
+	for p := range cur {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var buf bytes.Buffer
+	for _, p := range paths {
+		fmt.Fprintf(&buf, "%s  %s\n", cur[p], p)
+	}
+	// The manifest is written last, and replaced at once, so that an
+	// interrupted run leaves the previous one in place.
+	tmp := filepath.Join(outDir, manifestFile+".tmp")
+	if err := writeSiteFile(tmp, buf.Bytes()); err != nil {
+		return nil, nil, err
+	}
+	if err := os.Rename(tmp, filepath.Join(outDir, manifestFile)); err != nil {
+		return nil, nil, err
+	}
+	return changed, deleted, nil
+}
+
+// readManifest returns the hashes of the manifest file, by path. A missing
+// manifest has no hashes.
+func readManifest(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hashes := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		sum, p, ok := strings.Cut(sc.Text(), "  ")
+		if !ok || len(sum) != sha256.Size*2 || p == "" {
+			return nil, fmt.Errorf("%s:%d: malformed line; delete the file to list every file as changed", file, line)
+		}
+		hashes[p] = sum
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// hashOutDir returns the hex SHA-256 hashes of the files of outDir, by
+// slash-separated path, leaving out the manifest, change lists and record
+// of written files, and the archive, which has its own manifest.
+func hashOutDir(outDir string) (map[string]string, error) {
+	hashes := map[string]string{}
+	err := filepath.WalkDir(outDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return skipArchive(outDir, file, d)
+		}
+		rel, err := filepath.Rel(outDir, file)
+		if err != nil {
+			return err
+		}
+		p := filepath.ToSlash(rel)
+		switch p {
+		case manifestFile, manifestFile + ".tmp", changedFilesFile, deletedFilesFile, writtenFile, writtenFile + ".tmp", optionsFile, modulesFile, batchFile:
+			return nil
+		}
+		if strings.ContainsAny(p, "\r\n") {
+			return fmt.Errorf("cannot list file name %q", p)
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		hashes[p] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	return hashes, err
+}
+
+// writeLines writes lines to file, each followed by a newline.
+func writeLines(file string, lines []string) error {
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+	return writeSiteFile(file, buf.Bytes())
+}
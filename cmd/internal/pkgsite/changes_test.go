@@ -0,0 +1,137 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func readLines(t *testing.T, file string) []string {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if data[len(data)-1] != '\n' {
+		t.Errorf("%s does not end in a newline", file)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestGenerateStaticSiteChangeLists(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- a/a.go --
+// Package a does other things.
+package a
+-- b/b.go --
+// Package b does more things.
+package b
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{modDir},
+		UseListedMods: true,
+		SiteURL:       "https://example.org/",
+	}
+	opts := GenerateOptions{OutDir: outDir, EmitMarkdown: true, Sitemap: true}
+	generate := func() *Report {
+		t.Helper()
+		report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+	changed := func() []string { return readLines(t, filepath.Join(outDir, changedFilesFile)) }
+	deleted := func() []string { return readLines(t, filepath.Join(outDir, deletedFilesFile)) }
+
+	// The first run changes every file.
+	report := generate()
+	manifest := readLines(t, filepath.Join(outDir, manifestFile))
+	if got := changed(); len(got) != len(manifest) || report.ChangedFiles != len(got) {
+		t.Errorf("first run: %d files changed, reported %d, want all %d", len(got), report.ChangedFiles, len(manifest))
+	}
+	for _, p := range changed() {
+		if p == manifestFile || p == changedFilesFile || p == deletedFilesFile {
+			t.Errorf("first run: %s is listed", p)
+		}
+	}
+
+	// Nothing changes in the second.
+	generate()
+	if got := changed(); got != nil {
+		t.Errorf("second run: changed %v, want none", got)
+	}
+	if got := deleted(); got != nil {
+		t.Errorf("second run: deleted %v, want none", got)
+	}
+
+	// The third changes the doc comment of a. Its pages change, and so
+	// do the search index and the list of the pages, with its synopsis,
+	// the sitemap, with the modification time of the module, and the
+	// fingerprints.
+	aFile := filepath.Join(modDir, "a", "a.go")
+	if err := os.WriteFile(aFile, []byte("// Package a does different things.\npackage a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(aFile, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	generate()
+	want := []string{"example.com/m/a/doc.md", "example.com/m/a/index.html", "fingerprints.json", "pages.json", "search-index.json", "sitemap.xml"}
+	if diff := cmp.Diff(want, changed()); diff != "" {
+		t.Errorf("third run: changed files mismatch (-want +got):\n%s", diff)
+	}
+	if got := deleted(); got != nil {
+		t.Errorf("third run: deleted %v, want none", got)
+	}
+
+	// The fourth no longer writes Markdown, which changes only the
+	// fingerprints.
+	opts.EmitMarkdown = false
+	for _, p := range []string{"example.com/m/doc.md", "example.com/m/a/doc.md", "example.com/m/b/doc.md"} {
+		if err := os.Remove(filepath.Join(outDir, filepath.FromSlash(p))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	generate()
+	if diff := cmp.Diff([]string{"fingerprints.json"}, changed()); diff != "" {
+		t.Errorf("fourth run: changed files mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"example.com/m/a/doc.md", "example.com/m/b/doc.md", "example.com/m/doc.md"}, deleted()); diff != "" {
+		t.Errorf("fourth run: deleted files mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadManifestErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), manifestFile)
+	if err := os.WriteFile(file, []byte("abc  index.html\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readManifest(file); err == nil {
+		t.Error("got nil error")
+	}
+}
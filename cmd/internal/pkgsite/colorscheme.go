@@ -0,0 +1,342 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// The pages have a theme toggle in their footer, which switches between
+// the light and dark color schemes and the scheme of the system, and a
+// script restoring the choice of an earlier visit. The style sheets select
+// the colors of a scheme by the data-theme attribute of the html element
+// and by the prefers-color-scheme media feature.
+//
+// GenerateOptions.ColorScheme "light" or "dark" pins the scheme of a build:
+// the toggle and the script are removed, the html element gets the scheme
+// as its data-theme, the pages get the one theme-color of the scheme, and
+// the rules of the style sheets of the site that cannot apply any more,
+// those of the other scheme or of the toggle, are left out of them. With
+// GenerateOptions.Prune, the icons of the toggle are removed too, unless
+// something else uses them. "auto", like "", keeps the toggle.
+
+// A colorScheme pins the color scheme of the pages and style sheets.
+type colorScheme struct {
+	scheme string // "light" or "dark", or "" if the scheme is not pinned
+
+	mu    sync.Mutex
+	icons map[string]bool // site paths of the icons of the removed toggles
+	used  map[string]bool // site paths of the files that pages refer to
+}
+
+// newColorScheme returns the colorScheme for a GenerateOptions.ColorScheme.
+func newColorScheme(scheme string) (*colorScheme, error) {
+	switch scheme {
+	case "", "auto":
+		return &colorScheme{}, nil
+	case "light", "dark":
+		return &colorScheme{scheme: scheme, icons: map[string]bool{}, used: map[string]bool{}}, nil
+	}
+	return nil, fmt.Errorf("unknown color scheme %q; want auto, light or dark", scheme)
+}
+
+// pin pins the scheme of the page doc, if the scheme is pinned.
+func (cs *colorScheme) pin(doc *html.Node) {
+	if cs.scheme == "" {
+		return
+	}
+	var removed []*html.Node
+	walkElements(doc, func(n *html.Node) {
+		switch {
+		case n.Data == "html":
+			setAttr(n, "data-theme", cs.scheme)
+		case n.Data == "script" && n.FirstChild != nil && strings.Contains(n.FirstChild.Data, "prefers-color-scheme="):
+			removed = append(removed, n)
+		case hasClass(n, "js-toggleTheme"):
+			if n.Parent != nil && n.Parent.Data == "li" && hasClass(n.Parent, "go-Footer-listItem") {
+				n = n.Parent
+			}
+			removed = append(removed, n)
+		}
+	})
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, n := range removed {
+		walkElements(n, func(img *html.Node) {
+			if src := attrValue(img, "src"); img.Data == "img" && strings.HasPrefix(src, "/") && !strings.HasPrefix(src, "//") {
+				cs.icons[src[1:]] = true
+			}
+		})
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
+
+// consumePage records the files that the page of ev refers to.
+func (cs *colorScheme) consumePage(ev *pageEvent) error {
+	if cs.scheme == "" {
+		return nil
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, p := range pageAssets(ev) {
+		cs.used[p] = true
+	}
+	return nil
+}
+
+func (cs *colorScheme) finish(context.Context, *siteOutput) error { return nil }
+
+// unused returns the icons of the removed toggles that are asset files of
+// assets that no page or stylesheet refers to, and no script mentions,
+// sorted.
+func (cs *colorScheme) unused(assets *assetGraph) []string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	referenced := assets.referenced()
+	var unused []string
+	for p := range cs.icons {
+		if assets.files[p] && !cs.used[p] && !referenced[p] && !assets.mentioned[p] {
+			unused = append(unused, p)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+var (
+	// cssThemeRE matches an attribute selector on the data-theme
+	// attribute, with its value in the first of the groups 2 to 4 that
+	// matched, if group 1, the = and the value, matched.
+	cssThemeRE = regexp.MustCompile(`\[\s*data-theme\s*(=\s*(?:'([^']*)'|"([^"]*)"|([\w-]*)))?\s*\]`)
+	// cssNotThemeRE matches a negation of an attribute selector on the
+	// data-theme attribute, with the groups of cssThemeRE.
+	cssNotThemeRE = regexp.MustCompile(`:not\(\s*\[\s*data-theme\s*(=\s*(?:'([^']*)'|"([^"]*)"|([\w-]*)))?\s*\]\s*\)`)
+)
+
+// themeSelector returns whether the submatch m of cssThemeRE or
+// cssNotThemeRE in s has a value, and the value.
+func themeSelector(s string, m []int) (string, bool) {
+	if m[2] < 0 {
+		return "", false
+	}
+	for i := 4; i < len(m); i += 2 {
+		if m[i] >= 0 {
+			return s[m[i]:m[i+1]], true
+		}
+	}
+	return "", true
+}
+
+// neverMatches reports whether the selector sel cannot match an element
+// of a page whose html element has the pinned scheme as its data-theme.
+func (cs *colorScheme) neverMatches(sel string) bool {
+	for _, m := range cssNotThemeRE.FindAllStringSubmatchIndex(sel, -1) {
+		if v, ok := themeSelector(sel, m); !ok || v == cs.scheme {
+			return true
+		}
+	}
+	sel = cssNotThemeRE.ReplaceAllString(sel, "")
+	for _, m := range cssThemeRE.FindAllStringSubmatchIndex(sel, -1) {
+		if v, ok := themeSelector(sel, m); ok && v != cs.scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// excludesMedia reports whether every query of the media query list q
+// requires the color scheme that is not pinned.
+func (cs *colorScheme) excludesMedia(q string) bool {
+	other := "prefers-color-scheme:dark"
+	if cs.scheme == "dark" {
+		other = "prefers-color-scheme:light"
+	}
+	for _, query := range splitCSSList(q) {
+		query = strings.ToLower(strings.Join(strings.Fields(query), ""))
+		if strings.HasPrefix(query, "not") || !strings.Contains(query, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterCSS returns the style sheet css without the rules that cannot
+// apply with the pinned scheme, or css itself if the scheme is not pinned.
+func (cs *colorScheme) filterCSS(css []byte) []byte {
+	if cs.scheme == "" {
+		return css
+	}
+	return []byte(cs.filterRules(string(css)))
+}
+
+// filterRules filters the rules of s, a style sheet or the block of a
+// conditional group rule such as @media.
+func (cs *colorScheme) filterRules(s string) string {
+	var b strings.Builder
+	for s != "" {
+		open := cssScan(s, 0)
+		if open == len(s) || s[open] != '{' {
+			// A statement such as @import, or a stray ; or }.
+			end := min(open+1, len(s))
+			b.WriteString(s[:end])
+			s = s[end:]
+			continue
+		}
+		end := cssBlockEnd(s, open)
+		if end == len(s) {
+			b.WriteString(s) // an unterminated block is left as it is
+			break
+		}
+		b.WriteString(cs.filterRule(s[:open], s[open+1:end], s[:end+1]))
+		s = s[end+1:]
+	}
+	return b.String()
+}
+
+// filterRule returns the filtered rule with the prelude and the block body,
+// written as rule. The comments and spaces before the rule are kept.
+func (cs *colorScheme) filterRule(prelude, body, rule string) string {
+	lead := prelude[:len(prelude)-len(trimCSSSpace(prelude))]
+	p := prelude[len(lead):]
+	if strings.HasPrefix(p, "@") {
+		name := strings.ToLower(p[:strings.IndexFunc(p+" ", func(r rune) bool { return r == ' ' || r == '(' || r == '\t' || r == '\n' })])
+		switch name {
+		case "@media", "@supports", "@layer", "@container":
+			if name == "@media" && cs.excludesMedia(p[len(name):]) {
+				return lead
+			}
+			inner := cs.filterRules(body)
+			if trimCSSSpace(inner) == "" {
+				return lead
+			}
+			return prelude + "{" + inner + "}"
+		}
+		return rule // such as @font-face and @keyframes
+	}
+	sels := splitCSSList(p)
+	var kept []string
+	for _, sel := range sels {
+		if !cs.neverMatches(sel) {
+			kept = append(kept, strings.TrimSpace(sel))
+		}
+	}
+	switch len(kept) {
+	case 0:
+		return lead
+	case len(sels):
+		return rule
+	}
+	return lead + strings.Join(kept, ", ") + p[len(strings.TrimRight(p, " \t\r\n\f")):] + "{" + body + "}"
+}
+
+// trimCSSSpace returns s without its leading spaces and comments.
+func trimCSSSpace(s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n\f")
+		if !strings.HasPrefix(s, "/*") {
+			return s
+		}
+		end := strings.Index(s[2:], "*/")
+		if end < 0 {
+			return ""
+		}
+		s = s[2+end+2:]
+	}
+}
+
+// cssScan returns the index in s of the first {, } or ; at or after i that
+// is not in a comment, a string or parentheses, or len(s).
+func cssScan(s string, i int) int {
+	depth := 0
+	for i < len(s) {
+		switch c := s[i]; c {
+		case '/':
+			if strings.HasPrefix(s[i:], "/*") {
+				end := strings.Index(s[i+2:], "*/")
+				if end < 0 {
+					return len(s)
+				}
+				i += 2 + end + 2
+				continue
+			}
+		case '"', '\'':
+			i++
+			for i < len(s) && s[i] != c {
+				if s[i] == '\\' {
+					i++
+				}
+				i++
+			}
+		case '\\':
+			i++
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case '{', '}', ';':
+			if depth <= 0 {
+				return i
+			}
+		}
+		i++
+	}
+	return len(s)
+}
+
+// cssBlockEnd returns the index in s of the } closing the block opened by
+// the { at open, or len(s).
+func cssBlockEnd(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i = cssScan(s, i+1) {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// splitCSSList splits s, a selector or media query list, at the commas
+// that are not in a string or parentheses.
+func splitCSSList(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\'':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '\\':
+			i++
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestNewColorScheme(t *testing.T) {
+	for _, s := range []string{"", "auto", "light", "dark"} {
+		if _, err := newColorScheme(s); err != nil {
+			t.Errorf("newColorScheme(%q): %v", s, err)
+		}
+	}
+	if _, err := newColorScheme("sepia"); err == nil {
+		t.Error(`newColorScheme("sepia"): got nil error`)
+	}
+}
+
+func TestColorSchemeFilterCSS(t *testing.T) {
+	const css = `/* colors */
+:root { --bg: white; }
+[data-theme='dark'] { --bg: black; }
+@media (prefers-color-scheme: dark) {
+  :root:not([data-theme='light']) { --bg: black; }
+}
+@media (forced-colors: active) and (prefers-color-scheme: light) {
+  .go-Icon { filter: none; }
+}
+[data-theme="dark"] .a, .b { color: red; }
+:root:not([data-theme]) .c { color: blue; }
+@font-face { font-family: x; src: url(x.woff2); }
+@media screen { [data-theme=dark] .d { color: green; } }
+`
+	for _, test := range []struct {
+		scheme      string
+		want, avoid []string
+	}{
+		{"", []string{`[data-theme='dark'] {`, `@media (prefers-color-scheme: dark)`}, nil},
+		{"light", []string{
+			"/* colors */\n:root { --bg: white; }",
+			"(prefers-color-scheme: light) {\n  .go-Icon",
+			".b { color: red; }",
+			"@font-face { font-family: x; src: url(x.woff2); }",
+		}, []string{"data-theme", "prefers-color-scheme: dark", "@media screen"}},
+		{"dark", []string{
+			`[data-theme='dark'] { --bg: black; }`,
+			`@media (prefers-color-scheme: dark) {`,
+			`[data-theme="dark"] .a, .b { color: red; }`,
+			`@media screen { [data-theme=dark] .d { color: green; } }`,
+		}, []string{"prefers-color-scheme: light", ":not([data-theme])"}},
+	} {
+		cs, err := newColorScheme(test.scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(cs.filterCSS([]byte(css)))
+		if test.scheme == "" && got != css {
+			t.Errorf("unpinned: got\n%s\nwant the style sheet as it is", got)
+		}
+		for _, w := range test.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: got\n%s\nwant it to contain %s", test.scheme, got, w)
+			}
+		}
+		for _, a := range test.avoid {
+			if strings.Contains(got, a) {
+				t.Errorf("%s: got\n%s\nwant it not to contain %s", test.scheme, got, a)
+			}
+		}
+	}
+}
+
+// darkCSSRE matches the rules of style sheets that are for the dark color
+// scheme.
+var darkCSSRE = regexp.MustCompile(`data-theme\s*=\s*['"]?dark|prefers-color-scheme\s*:\s*dark`)
+
+func TestGenerateStaticSiteColorScheme(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m has light colors.
+package m
+
+// F does it.
+func F() {}
+`)
+	for _, prune := range []bool{false, true} {
+		outDir := t.TempDir()
+		cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+		opts := GenerateOptions{
+			OutDir:         outDir,
+			Prune:          prune,
+			ColorScheme:    "light",
+			HighlightTheme: "default",
+			CopyAllAssets:  true, // the unused icons are not copied otherwise
+		}
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+			t.Fatal(err)
+		}
+		var sheets int
+		err := filepath.WalkDir(outDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			switch filepath.Ext(p) {
+			case ".css":
+				sheets++
+				data, err := os.ReadFile(p)
+				if err != nil {
+					return err
+				}
+				if loc := darkCSSRE.FindIndex(data); loc != nil {
+					t.Errorf("prune %t: %s has a dark theme rule at %q", prune, p, data[loc[0]:min(loc[1]+40, len(data))])
+				}
+			case ".html":
+				data, err := os.ReadFile(p)
+				if err != nil {
+					return err
+				}
+				page := string(data)
+				if !strings.Contains(page, `data-theme="light"`) {
+					t.Errorf("prune %t: %s does not pin the light scheme", prune, p)
+				}
+				if strings.Contains(page, "js-toggleTheme") {
+					t.Errorf("prune %t: %s has the theme toggle", prune, p)
+				}
+				if n := strings.Count(page, `name="theme-color"`); n != 1 {
+					t.Errorf("prune %t: %s has %d theme-color metas, want 1", prune, p, n)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sheets == 0 {
+			t.Errorf("prune %t: no style sheets", prune)
+		}
+		// The icons of the toggle, copied, are only removed with Prune.
+		_, err = os.Stat(filepath.Join(outDir, "static", "shared", "icon", "brightness_6_gm_grey_24dp.svg"))
+		if removed := os.IsNotExist(err); removed != prune {
+			t.Errorf("prune %t: toggle icon removed %t, want %t", prune, removed, prune)
+		}
+		checkInternalLinks(t, outDir, "example.com/")
+	}
+}
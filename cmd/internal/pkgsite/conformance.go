@@ -0,0 +1,278 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The static site is meant to hold the same pages as the dynamic server.
+// VerifyAgainstDynamic checks that: it compares the main content of every
+// generated page with the page the dynamic server returns for the same URL,
+// after undoing the differences the generator introduces on purpose, such
+// as relative URLs.
+
+// A ConformanceDiff describes a page whose main content differs between the
+// static site and the dynamic server.
+type ConformanceDiff struct {
+	URLPath string
+	// Diff is a line diff of the normalized main content, with lines only
+	// in the dynamic page prefixed by "-" and lines only in the static page
+	// prefixed by "+".
+	Diff string
+}
+
+// VerifyAgainstDynamic generates the static site for serverCfg and opts
+// into a temporary directory, rather than opts.OutDir, and compares each
+// generated HTML page with the page served by the dynamic server built from
+// the same configuration. Module settings and platform tables, which
+// change pages on purpose, are not applied.
+func VerifyAgainstDynamic(ctx context.Context, serverCfg ServerConfig, opts GenerateOptions) ([]*ConformanceDiff, error) {
+	opts.ModuleSettings = nil
+	opts.PlatformTable = false
+	outDir, err := os.MkdirTemp("", "pkgsite-verify-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outDir)
+
+	var pages pageList
+	opts.OutDir, opts.Format = outDir, ""
+	if _, err := generateStaticSite(ctx, serverCfg, opts, pageConsumers{&pages}); err != nil {
+		return nil, err
+	}
+
+	server, err := BuildServer(ctx, serverCfg)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	server.Install(mux.Handle, nil, nil)
+
+	var diffs []*ConformanceDiff
+	for _, p := range pages {
+		dynamic, err := getDynamic(mux, p.URLPath)
+		if err != nil {
+			return nil, err
+		}
+		static, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p.File)))
+		if err != nil {
+			return nil, err
+		}
+		want, err := normalizeMain(dynamic, p.URLPath, false)
+		if err != nil {
+			return nil, fmt.Errorf("%s: dynamic page: %w", p.URLPath, err)
+		}
+		got, err := normalizeMain(static, p.URLPath, true)
+		if err != nil {
+			return nil, fmt.Errorf("%s: static page: %w", p.URLPath, err)
+		}
+		if d := lineDiff(want, got); d != "" {
+			diffs = append(diffs, &ConformanceDiff{URLPath: p.URLPath, Diff: d})
+		}
+	}
+	return diffs, nil
+}
+
+// pageList is a pageConsumer that records the HTML pages written.
+type pageList []*pageEvent
+
+func (l *pageList) consumePage(ev *pageEvent) error {
+	if ev.HTML && ev.Redirect == "" {
+		*l = append(*l, &pageEvent{URLPath: ev.URLPath, File: ev.File})
+	}
+	return nil
+}
+
+func (l *pageList) finish(context.Context, *siteOutput) error { return nil }
+
+// getDynamic returns the body the mux serves for urlPath.
+func getDynamic(mux *http.ServeMux, urlPath string) ([]byte, error) {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", urlPath, nil))
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned status %d", urlPath, w.Code)
+	}
+	return w.Body.Bytes(), nil
+}
+
+// normalizeMain returns the main content of an HTML page as lines of text,
+// one per element or text node, indented by depth. Comments, whitespace and
+// the content of volatile elements are dropped, and attributes are sorted.
+// For a static page, relative URLs are made absolute again; for a dynamic
+// page, the host of URLs and display text get the canonical forms the
+// generator uses.
+func normalizeMain(content []byte, urlPath string, static bool) ([]string, error) {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	root := findElement(doc, "main")
+	if root == nil {
+		root = findElement(doc, "body")
+	}
+	if root == nil {
+		return nil, nil
+	}
+	prefix := relativePrefix(urlPath)
+	var lines []string
+	var walk func(n *html.Node, depth int)
+	walk = func(n *html.Node, depth int) {
+		indent := strings.Repeat("  ", depth)
+		switch n.Type {
+		case html.TextNode:
+			text := strings.TrimSpace(n.Data)
+			if text == "" {
+				return
+			}
+			if !static && isDisplayTextParent(n.Parent) {
+				text = displayText(text)
+			}
+			switch scriptTextKind(n.Parent) {
+			case scriptJS:
+				if static {
+					text = absolutizeScriptText(text, prefix)
+				}
+			case scriptJSONLD:
+				text = rewriteJSONLD(text, func(val string) string {
+					return normalizeURL(val, prefix, static)
+				})
+			}
+			lines = append(lines, indent+strings.Join(strings.Fields(text), " "))
+			return
+		case html.ElementNode:
+			if isVolatile(n) {
+				lines = append(lines, indent+"<"+n.Data+" volatile>")
+				return
+			}
+			var attrs []string
+			for _, a := range n.Attr {
+				val := a.Val
+				if r, ok := urlAttrRule(n, a); ok {
+					val = mapURLs(r, val, func(u string) string { return normalizeURL(u, prefix, static) })
+				}
+				attrs = append(attrs, fmt.Sprintf("%s=%q", a.Key, val))
+			}
+			sort.Strings(attrs)
+			lines = append(lines, indent+"<"+strings.Join(append([]string{n.Data}, attrs...), " ")+">")
+		default:
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, depth+1)
+		}
+	}
+	walk(root, 0)
+	return lines, nil
+}
+
+// isVolatile reports whether the content of n can differ between two
+// renderings of the same page: the commit time of a local module is the
+// time it was loaded, and the homepage carousel starts at a random slide.
+func isVolatile(n *html.Node) bool {
+	return attrValue(n, "data-test-id") == "UnitHeader-commitTime" || hasClass(n, "js-carousel")
+}
+
+// normalizeURL returns the site-absolute form of a URL attribute value of
+// a page whose relative prefix is prefix.
+func normalizeURL(val, prefix string, static bool) string {
+	if !static {
+		if strings.HasPrefix(val, "/") && !strings.HasPrefix(val, "//") {
+			return canonicalURLPath(val)
+		}
+		return val
+	}
+	if strings.HasPrefix(val, prefix) {
+		return "/" + val[len(prefix):]
+	}
+	return val
+}
+
+// absolutizeScriptText undoes relativizeScriptText.
+func absolutizeScriptText(script, prefix string) string {
+	for _, dir := range []string{"/static/", "/third_party/"} {
+		script = strings.ReplaceAll(script, `"`+prefix+dir[1:], `"`+dir)
+		script = strings.ReplaceAll(script, `'`+prefix+dir[1:], `'`+dir)
+	}
+	return script
+}
+
+// lineDiff returns a diff of the lines of a and b, with three lines of
+// context around each change, or "" if they are equal.
+func lineDiff(a, b []string) string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', b[j]})
+			j++
+		}
+	}
+
+	// Show the changed lines and up to three lines around each.
+	const contextLines = 3
+	show := make([]bool, len(lines))
+	changed := false
+	for k, l := range lines {
+		if l.op == ' ' {
+			continue
+		}
+		changed = true
+		for n := max(k-contextLines, 0); n <= min(k+contextLines, len(lines)-1); n++ {
+			show[n] = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	var buf strings.Builder
+	for k, l := range lines {
+		if !show[k] {
+			continue
+		}
+		if k > 0 && !show[k-1] {
+			buf.WriteString("...\n")
+		}
+		fmt.Fprintf(&buf, "%c %s\n", l.op, l.text)
+	}
+	return buf.String()
+}
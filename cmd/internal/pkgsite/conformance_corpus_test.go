@@ -0,0 +1,106 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The conformance test generates and serves every fixture module, which
+// takes a while. Run it with:
+//
+//	go test -tags conformance -run TestConformance ./cmd/internal/pkgsite
+//go:build conformance
+
+package pkgsite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+// conformanceCorpus holds fixture modules exercising the parts of unit
+// pages that the generator rewrites.
+var conformanceCorpus = map[string]string{
+	"basic": `
+-- go.mod --
+module example.com/basic
+-- README.md --
+# Basic
+
+See [the docs](https://pkg.go.dev) and the [sub package](./sub).
+-- basic.go --
+// Package basic does things.
+package basic
+
+// T is a type.
+type T struct{ N int }
+
+// F returns a [T].
+func F() T { return T{} }
+-- basic_test.go --
+package basic_test
+
+import "example.com/basic"
+
+func ExampleF() {
+	_ = basic.F()
+	// Output:
+}
+-- sub/sub.go --
+// Package sub uses [basic.F].
+package sub
+
+import "example.com/basic"
+
+// G calls [basic.F].
+func G() basic.T { return basic.F() }
+`,
+	"idn": `
+-- go.mod --
+module xn--bcher-kva.example/lib
+-- lib.go --
+// Package lib does things.
+package lib
+
+// F is a function.
+func F() {}
+-- sub/sub.go --
+// Package sub uses lib.
+package sub
+
+import "xn--bcher-kva.example/lib"
+
+// G calls [lib.F].
+func G() { lib.F() }
+`,
+	"nested": `
+-- go.mod --
+module example.com/nested
+-- a/b/c/c.go --
+// Package c is deep.
+package c
+
+// Deprecated: use something else.
+func Old() {}
+-- internal/i/i.go --
+// Package i is internal.
+package i
+`,
+}
+
+func TestConformance(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	for name, txtar := range conformanceCorpus {
+		t.Run(name, func(t *testing.T) {
+			modDir, _ := testhelper.WriteTxtarToTempDir(t, txtar)
+			cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+			diffs, err := VerifyAgainstDynamic(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range diffs {
+				t.Errorf("%s differs from the dynamic page (-dynamic +static):\n%s", d.URLPath, d.Diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMain(t *testing.T) {
+	const dynamic = `<html><head><title>T</title></head><body>
+<header><a href="/">Home</a></header>
+<main class="go-Main" id="main-content">
+  <!-- comment -->
+  <a href="/xn--bcher-kva.example/lib?tab=doc#F" class="b a">xn--bcher-kva.example/lib</a>
+  <img src="/static/icon.svg"><a href="https://example.com">out</a>
+  <span data-test-id="UnitHeader-commitTime">Published: Jan 1, 2024</span>
+  <script>loadScript("/static/frontend/unit/main/main.js")</script>
+</main></body></html>`
+	const urlPath = "/xn--bcher-kva.example/lib/sub"
+
+	static, err := processHTML([]byte(dynamic), urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The commit time is expected to differ.
+	static = []byte(strings.Replace(string(static), "Jan 1, 2024", "Jan 2, 2024", 1))
+	want, err := normalizeMain([]byte(dynamic), urlPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := normalizeMain(static, urlPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := lineDiff(want, got); d != "" {
+		t.Errorf("normalized pages differ:\n%s", d)
+	}
+
+	// A change in the main content is reported.
+	changed := strings.Replace(string(static), ">out<", ">elsewhere<", 1)
+	got, err = normalizeMain([]byte(changed), urlPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := lineDiff(want, got); !strings.Contains(d, "out\n") || !strings.Contains(d, "elsewhere\n") {
+		t.Errorf("got diff\n%s\nwant the changed link text", d)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	if d := lineDiff([]string{"a", "b"}, []string{"a", "b"}); d != "" {
+		t.Errorf("equal lines: got diff %q", d)
+	}
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+	b := []string{"1", "2", "3", "4", "five", "6", "7", "8", "9", "10", "11", "12", "13"}
+	want := `...
+  2
+  3
+  4
+- 5
++ five
+  6
+  7
+  8
+...
+  10
+  11
+  12
++ 13
+`
+	if got := lineDiff(a, b); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
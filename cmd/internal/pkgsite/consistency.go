@@ -0,0 +1,152 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// More than one getter can serve a module, such as a local directory and
+// the proxy. The units of a module are enumerated from the first getter
+// that serves it at the local version, but the frontend renders them from
+// the module the data source resolves for the latest version, which may
+// come from another getter. If the two getters serve different contents,
+// the pages document symbols that the source links do not have. The
+// generator compares the contents of the modules served by both getters,
+// and fails the modules that differ, or warns about them.
+
+// A moduleFingerprint summarizes the contents of a module as served by a
+// getter.
+type moduleFingerprint struct {
+	goMod string // hash of the go.mod file
+	files int    // number of files
+	dir   string // hash of the files, as by dirhash.Hash1
+}
+
+func (f moduleFingerprint) String() string {
+	return fmt.Sprintf("go.mod %s, %d files, %s", f.goMod, f.files, f.dir)
+}
+
+// fingerprintModule returns the fingerprint of the module at modulePath and
+// version served by g, from the files listed by moduleFiles.
+func fingerprintModule(ctx context.Context, g fetch.ModuleGetter, modulePath, version string) (moduleFingerprint, error) {
+	mod, err := g.Mod(ctx, modulePath, version)
+	if err != nil {
+		return moduleFingerprint{}, err
+	}
+	fsys, err := g.ContentDir(ctx, modulePath, version)
+	if err != nil {
+		return moduleFingerprint{}, err
+	}
+	files, err := moduleFiles(fsys)
+	if err != nil {
+		return moduleFingerprint{}, err
+	}
+	dir, err := dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		return fsys.Open(name)
+	})
+	if err != nil {
+		return moduleFingerprint{}, err
+	}
+	return moduleFingerprint{
+		goMod: contentHash(mod, false),
+		files: len(files),
+		dir:   dir,
+	}, nil
+}
+
+// moduleFiles returns the slash-separated paths of the files of the module
+// in fsys, as the go command sees them: those of directories whose names
+// start with "." or "_", of testdata and vendor directories, and of nested
+// modules are left out.
+func moduleFiles(fsys fs.FS) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == "." {
+				return nil
+			}
+			name := path.Base(p)
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" {
+				return fs.SkipDir
+			}
+			if _, err := fs.Stat(fsys, path.Join(p, "go.mod")); err == nil {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// A getterMismatch is a module whose contents differ between the getter its
+// units were enumerated from and the getter the frontend renders it from.
+type getterMismatch struct {
+	modulePath           string
+	enumerated, rendered string // the getters
+	enumeratedFP         moduleFingerprint
+	renderedFP           moduleFingerprint
+}
+
+func (m *getterMismatch) Error() string {
+	return fmt.Sprintf("getters disagree about the contents of %s: enumerated from %s (%s), rendered from %s (%s)",
+		m.modulePath, m.enumerated, m.enumeratedFP, m.rendered, m.renderedFP)
+}
+
+// A moduleResolver returns the getter that the frontend renders the module
+// at modulePath from, and the module.
+type moduleResolver func(ctx context.Context, modulePath string) (fetch.ModuleGetter, *fetch.LazyModule, error)
+
+// checkModuleGetters compares, for each module of units rendered from
+// another getter than the one it was enumerated from, the contents served by
+// the two getters. It returns the modules that differ. A module that the
+// frontend cannot get, or whose contents cannot be read, is left to fail
+// when it is rendered.
+func checkModuleGetters(ctx context.Context, units []*siteUnit, resolve moduleResolver) []*getterMismatch {
+	var mismatches []*getterMismatch
+	seen := map[string]bool{}
+	for _, u := range units {
+		modulePath := u.meta.ModulePath
+		if seen[modulePath] || u.getter == nil {
+			continue
+		}
+		seen[modulePath] = true
+		g, m, err := resolve(ctx, modulePath)
+		if err != nil || g == nil || g == u.getter {
+			continue
+		}
+		enumerated, err := fingerprintModule(ctx, u.getter, modulePath, u.module.Version)
+		if err != nil {
+			continue
+		}
+		rendered, err := fingerprintModule(ctx, g, modulePath, m.Version)
+		if err != nil || rendered == enumerated {
+			continue
+		}
+		mismatches = append(mismatches, &getterMismatch{
+			modulePath:   modulePath,
+			enumerated:   u.getter.String(),
+			rendered:     g.String(),
+			enumeratedFP: enumerated,
+			renderedFP:   rendered,
+		})
+	}
+	return mismatches
+}
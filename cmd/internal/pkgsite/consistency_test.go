@@ -0,0 +1,129 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+const consistencyModule = `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+
+func F() {}
+-- a/a.go --
+package a
+`
+
+// dirGetter returns a getter for a copy of consistencyModule, changed by
+// writing the given files.
+func dirGetter(t *testing.T, files map[string]string) fetch.ModuleGetter {
+	t.Helper()
+	dir, _ := testhelper.WriteTxtarToTempDir(t, consistencyModule)
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := fetch.NewDirectoryModuleGetter("", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestFingerprintModule(t *testing.T) {
+	ctx := context.Background()
+	fingerprint := func(g fetch.ModuleGetter) moduleFingerprint {
+		t.Helper()
+		fp, err := fingerprintModule(ctx, g, "example.com/m", fetch.LocalVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fp
+	}
+	base := fingerprint(dirGetter(t, nil))
+	if base.files != 3 {
+		t.Errorf("got %d files, want 3", base.files)
+	}
+
+	// Files the go command ignores do not count.
+	ignored := fingerprint(dirGetter(t, map[string]string{
+		".git/HEAD":          "ref: refs/heads/main\n",
+		"_old/old.go":        "package old\n",
+		"a/testdata/x.txt":   "x\n",
+		"vendor/modules.txt": "# example.com/dep v1.0.0\n",
+		"sub/go.mod":         "module example.com/m/sub\n",
+		"sub/sub.go":         "package sub\n",
+	}))
+	if ignored != base {
+		t.Errorf("ignored files changed the fingerprint: %s, want %s", ignored, base)
+	}
+
+	changed := fingerprint(dirGetter(t, map[string]string{"m.go": "package m\n"}))
+	if changed.dir == base.dir || changed.goMod != base.goMod || changed.files != base.files {
+		t.Errorf("changing m.go: got %s, from %s", changed, base)
+	}
+	added := fingerprint(dirGetter(t, map[string]string{"b/b.go": "package b\n", "go.mod": "module example.com/m\n"}))
+	if added.dir == base.dir || added.goMod == base.goMod || added.files != base.files+1 {
+		t.Errorf("adding b/b.go and changing go.mod: got %s, from %s", added, base)
+	}
+}
+
+func TestCheckModuleGetters(t *testing.T) {
+	ctx := context.Background()
+	enumerated := dirGetter(t, nil)
+	same := dirGetter(t, nil)
+	different := dirGetter(t, map[string]string{"m.go": "package m\n\nfunc G() {}\n"})
+
+	lm := &fetch.LazyModule{ModuleInfo: internal.ModuleInfo{ModulePath: "example.com/m", Version: fetch.LocalVersion}}
+	meta := func(p string) *internal.UnitMeta {
+		return &internal.UnitMeta{Path: p, ModuleInfo: lm.ModuleInfo}
+	}
+	units := []*siteUnit{
+		{path: "example.com/m", meta: meta("example.com/m"), module: lm, getter: enumerated},
+		{path: "example.com/m/a", meta: meta("example.com/m/a"), module: lm, getter: enumerated},
+	}
+	check := func(g fetch.ModuleGetter) []*getterMismatch {
+		return checkModuleGetters(ctx, units, func(context.Context, string) (fetch.ModuleGetter, *fetch.LazyModule, error) {
+			return g, lm, nil
+		})
+	}
+	for _, g := range []fetch.ModuleGetter{enumerated, same} {
+		if got := check(g); len(got) != 0 {
+			t.Errorf("rendering from %s: got mismatches %v, want none", g, got)
+		}
+	}
+	got := check(different)
+	if len(got) != 1 {
+		t.Fatalf("got %d mismatches, want 1", len(got))
+	}
+	msg := got[0].Error()
+	for _, want := range []string{"example.com/m", enumerated.String(), different.String(), "3 files", "h1:"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not contain %q", msg, want)
+		}
+	}
+	if got[0].enumeratedFP.dir == got[0].renderedFP.dir {
+		t.Errorf("mismatch reports the same fingerprint %s for both getters", got[0].enumeratedFP)
+	}
+}
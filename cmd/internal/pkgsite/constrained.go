@@ -0,0 +1,132 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+)
+
+// A ConstrainedPolicy decides whether packages whose Go files are all
+// excluded by build constraints, such as a tools.go package or a program
+// guarded by "//go:build ignore", are served. Included packages are shown
+// with a banner naming their build constraint; excluded packages are listed
+// at the end of static site generation.
+type ConstrainedPolicy struct {
+	IncludeByDefault bool
+	Rules            []ConstrainedRule // checked in order; the first match wins
+}
+
+// A ConstrainedRule overrides the default policy for the packages matching
+// Pattern, a package pattern in which "..." matches any string.
+type ConstrainedRule struct {
+	Pattern string
+	Include bool
+}
+
+// ParseConstrainedPolicy parses a comma-separated policy such as
+// "exclude,example.com/m/tools/...=include". A bare "include" or "exclude"
+// sets the default, and pattern=include or pattern=exclude adds a rule.
+func ParseConstrainedPolicy(s string) (ConstrainedPolicy, error) {
+	var p ConstrainedPolicy
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		pattern, action, isRule := strings.Cut(f, "=")
+		if !isRule {
+			pattern, action = "", f
+		}
+		var include bool
+		switch action {
+		case "include":
+			include = true
+		case "exclude":
+		default:
+			return ConstrainedPolicy{}, fmt.Errorf("constrained package policy %q: want include or exclude, got %q", f, action)
+		}
+		if !isRule {
+			p.IncludeByDefault = include
+			continue
+		}
+		if pattern == "" {
+			return ConstrainedPolicy{}, fmt.Errorf("constrained package policy %q: missing pattern", f)
+		}
+		p.Rules = append(p.Rules, ConstrainedRule{Pattern: pattern, Include: include})
+	}
+	return p, nil
+}
+
+// includes reports whether the package at importPath is included.
+func (p ConstrainedPolicy) includes(importPath string) bool {
+	for _, r := range p.Rules {
+		if matchPattern(r.Pattern, importPath) {
+			return r.Include
+		}
+	}
+	return p.IncludeByDefault
+}
+
+// loadOptions returns the fetch options implementing p.
+func (p ConstrainedPolicy) loadOptions() fetch.LoadOptions {
+	if !p.IncludeByDefault && len(p.Rules) == 0 {
+		return fetch.LoadOptions{}
+	}
+	return fetch.LoadOptions{IncludeConstrained: p.includes}
+}
+
+// matchPattern reports whether importPath matches pattern, using the go
+// command's rules: "..." matches any string, and a trailing "/..." also
+// matches the path without it.
+func matchPattern(pattern, importPath string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\.\.\.`, `.*`)
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+	return regexp.MustCompile(`^` + re + `$`).MatchString(importPath)
+}
+
+// excludedPackages returns the constrained packages of the units' modules
+// that were left out of the site.
+func excludedPackages(units []*siteUnit) []*fetch.ConstrainedPackage {
+	seen := map[*fetch.LazyModule]bool{}
+	var excluded []*fetch.ConstrainedPackage
+	for _, u := range units {
+		if seen[u.module] {
+			continue
+		}
+		seen[u.module] = true
+		for _, cp := range u.module.ConstrainedPackages {
+			if !cp.Included {
+				excluded = append(excluded, cp)
+			}
+		}
+	}
+	sort.Slice(excluded, func(i, j int) bool { return excluded[i].Path < excluded[j].Path })
+	return excluded
+}
+
+// writeExcludedReport lists the excluded packages and the constraints that
+// exclude them.
+func writeExcludedReport(w io.Writer, excluded []*fetch.ConstrainedPackage) {
+	if len(excluded) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Excluded %d packages whose files are all excluded by build constraints:\n", len(excluded))
+	for _, cp := range excluded {
+		if cp.Constraint == "" {
+			fmt.Fprintf(w, "  %s\n", cp.Path)
+		} else {
+			fmt.Fprintf(w, "  %s (//go:build %s)\n", cp.Path, cp.Constraint)
+		}
+	}
+}
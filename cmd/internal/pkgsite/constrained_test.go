@@ -0,0 +1,161 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+)
+
+func TestParseConstrainedPolicy(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want ConstrainedPolicy
+	}{
+		{"", ConstrainedPolicy{}},
+		{"exclude", ConstrainedPolicy{}},
+		{"include", ConstrainedPolicy{IncludeByDefault: true}},
+		{
+			"exclude, example.com/m/tools/...=include,example.com/m/gen=exclude",
+			ConstrainedPolicy{Rules: []ConstrainedRule{
+				{Pattern: "example.com/m/tools/...", Include: true},
+				{Pattern: "example.com/m/gen"},
+			}},
+		},
+	} {
+		got, err := ParseConstrainedPolicy(test.in)
+		if err != nil {
+			t.Errorf("ParseConstrainedPolicy(%q): %v", test.in, err)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("ParseConstrainedPolicy(%q) mismatch (-want +got):\n%s", test.in, diff)
+		}
+	}
+	for _, in := range []string{"skip", "=include", "example.com/m=maybe"} {
+		if _, err := ParseConstrainedPolicy(in); err == nil {
+			t.Errorf("ParseConstrainedPolicy(%q): got nil error", in)
+		}
+	}
+}
+
+func TestConstrainedPolicyIncludes(t *testing.T) {
+	p := ConstrainedPolicy{
+		IncludeByDefault: true,
+		Rules: []ConstrainedRule{
+			{Pattern: "example.com/m/internal/tools", Include: true},
+			{Pattern: "example.com/m/internal/..."},
+		},
+	}
+	for path, want := range map[string]bool{
+		"example.com/m/gen":            true,
+		"example.com/m/internal":       false,
+		"example.com/m/internal/gen":   false,
+		"example.com/m/internal/tools": true,
+		"example.com/m/internalx":      true,
+	} {
+		if got := p.includes(path); got != want {
+			t.Errorf("includes(%q) = %t, want %t", path, got, want)
+		}
+	}
+}
+
+func TestWriteExcludedReport(t *testing.T) {
+	var b strings.Builder
+	writeExcludedReport(&b, []*fetch.ConstrainedPackage{
+		{Path: "example.com/m/gen", Constraint: "ignore"},
+		{Path: "example.com/m/odd"},
+	})
+	want := `Excluded 2 packages whose files are all excluded by build constraints:
+  example.com/m/gen (//go:build ignore)
+  example.com/m/odd
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+const constrainedFixture = `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m is the root package.
+package m
+-- gen/gen.go --
+//go:build ignore
+
+// Command gen generates code.
+package main
+
+func main() {}
+-- tools/tools.go --
+//go:build tools
+
+// Package tools tracks tool dependencies.
+package tools
+`
+
+func TestGenerateStaticSiteConstrained(t *testing.T) {
+	readPage := func(t *testing.T, outDir, unit string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(unit), "index.html"))
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+
+	t.Run("exclude", func(t *testing.T) {
+		outDir := generateTestSite(t, constrainedFixture, nil)
+		for _, unit := range []string{"example.com/m/gen", "example.com/m/tools"} {
+			if page := readPage(t, outDir, unit); page != "" {
+				t.Errorf("%s was generated", unit)
+			}
+		}
+	})
+
+	t.Run("include", func(t *testing.T) {
+		outDir := generateTestSite(t, constrainedFixture, func(cfg *ServerConfig, _ *GenerateOptions) {
+			cfg.ConstrainedPackages = ConstrainedPolicy{IncludeByDefault: true}
+		})
+		for unit, want := range map[string]string{
+			"example.com/m/gen":   "//go:build ignore",
+			"example.com/m/tools": "//go:build tools",
+		} {
+			page := readPage(t, outDir, unit)
+			if page == "" {
+				t.Errorf("%s was not generated", unit)
+				continue
+			}
+			if !strings.Contains(page, "UnitHeader-buildConstraintBanner") || !strings.Contains(page, want) {
+				t.Errorf("%s: banner with %q not found", unit, want)
+			}
+		}
+		if page := readPage(t, outDir, "example.com/m"); strings.Contains(page, "UnitHeader-buildConstraintBanner") {
+			t.Error("unconstrained package has a build constraint banner")
+		}
+	})
+
+	t.Run("per pattern", func(t *testing.T) {
+		outDir := generateTestSite(t, constrainedFixture, func(cfg *ServerConfig, _ *GenerateOptions) {
+			cfg.ConstrainedPackages = ConstrainedPolicy{
+				Rules: []ConstrainedRule{{Pattern: "example.com/m/tools", Include: true}},
+			}
+		})
+		if page := readPage(t, outDir, "example.com/m/tools"); !strings.Contains(page, "//go:build tools") {
+			t.Error("tools package not generated with its banner")
+		}
+		if page := readPage(t, outDir, "example.com/m/gen"); page != "" {
+			t.Error("gen package was generated")
+		}
+	})
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// With ServerConfig.DiscoverModules set, each directory of Paths is the
+// root of a tree that is walked for go.mod files, as in a repository of
+// several modules without a go.work file, and every module found is served
+// from its own directory, as if it were in Paths. The walk skips the
+// directories that the go command leaves out of the patterns with "...":
+// vendor and testdata directories, and those whose names start with "."
+// or "_". A module nested in another one is discovered too, as the go
+// command leaves its directory out of the enclosing module. Modules are
+// found in lexical order of their directories, so that runs are
+// reproducible, and each is listed with GOWORK=off, so that a go.work file
+// above it does not bring in the modules of the workspace.
+
+// discoverModules returns the directories of the modules under the
+// directories roots, in order of roots and then in lexical order. It is an
+// error for two of them to have the same module path, or for a root to
+// have none.
+func discoverModules(roots []string) ([]string, error) {
+	var dirs []string
+	seen := map[string]string{} // go.mod files by module path
+	for _, root := range roots {
+		n := len(dirs)
+		err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if file != root && skipDiscoveryDir(d.Name()) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Name() != "go.mod" {
+				return nil
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			modPath := modfile.ModulePath(data)
+			if modPath == "" {
+				return fmt.Errorf("%s: no module directive", file)
+			}
+			if prev, ok := seen[modPath]; ok {
+				return fmt.Errorf("module %s is both in %s and in %s", modPath, prev, file)
+			}
+			seen[modPath] = file
+			dirs = append(dirs, filepath.Dir(file))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("discovering modules: %w", err)
+		}
+		if len(dirs) == n {
+			return nil, fmt.Errorf("discovering modules: no go.mod file under %s", root)
+		}
+		// The walk visits a subdirectory before a go.mod file that sorts
+		// after it.
+		sort.Strings(dirs[n:])
+	}
+	return dirs, nil
+}
+
+// skipDiscoveryDir reports whether discoverModules skips the directories
+// named name, other than the roots.
+func skipDiscoveryDir(name string) bool {
+	return name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
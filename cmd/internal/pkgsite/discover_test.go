@@ -0,0 +1,107 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+// nestedModulesTxtar is a repository of three nested modules, with modules
+// in directories that discovery skips.
+const nestedModulesTxtar = `
+-- go.mod --
+module example.com/repo
+
+go 1.21
+-- repo.go --
+// Package repo is the root.
+package repo
+-- tools/go.mod --
+module example.com/repo/tools
+
+go 1.21
+-- tools/tools.go --
+// Package tools is nested.
+package tools
+-- tools/gen/go.mod --
+module example.com/gen
+
+go 1.21
+-- tools/gen/gen.go --
+// Package gen is nested twice.
+package gen
+-- vendor/example.com/v/go.mod --
+module example.com/v
+-- testdata/go.mod --
+module example.com/testdata
+-- .git/go.mod --
+module example.com/git
+-- _old/go.mod --
+module example.com/old
+`
+
+func TestDiscoverModules(t *testing.T) {
+	dir, _ := testhelper.WriteTxtarToTempDir(t, nestedModulesTxtar)
+	got, err := discoverModules([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{dir, filepath.Join(dir, "tools"), filepath.Join(dir, "tools", "gen")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	dup, _ := testhelper.WriteTxtarToTempDir(t, `
+-- a/go.mod --
+module example.com/same
+-- b/go.mod --
+module example.com/same
+`)
+	_, err = discoverModules([]string{dup})
+	for _, want := range []string{filepath.Join(dup, "a", "go.mod"), filepath.Join(dup, "b", "go.mod")} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("duplicate module: got error %v, want one naming %s", err, want)
+		}
+	}
+
+	if _, err := discoverModules([]string{t.TempDir()}); err == nil {
+		t.Error("no modules: got nil error")
+	}
+}
+
+func TestBuildServerDiscoverModules(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, nestedModulesTxtar)
+	result, err := buildServerAndGetters(context.Background(), ServerConfig{
+		Paths:           []string{dir},
+		DiscoverModules: true,
+		UseListedMods:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	units, err := enumerateUnits(context.Background(), result.Getters, result.AllModules, result.LoadOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules := map[string]bool{}
+	for _, u := range units {
+		modules[u.meta.ModulePath] = true
+	}
+	want := map[string]bool{"example.com/repo": true, "example.com/repo/tools": true, "example.com/gen": true}
+	if diff := cmp.Diff(want, modules); diff != "" {
+		t.Errorf("modules mismatch (-want +got):\n%s", diff)
+	}
+	if len(result.AllModules) != 3 {
+		t.Errorf("got %d modules, want 3: %v", len(result.AllModules), result.AllModules)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/log"
+)
+
+// A package is loaded once for each build context in
+// internal.BuildContexts, and its documentation is kept for each one whose
+// set of files differs. Symbols documented on only some platforms often
+// mean that a platform-specific API lacks its doc comment elsewhere, or
+// that a platform is missing an implementation.
+
+// unitDivergence returns the platform divergence of the package u, or nil
+// if its documentation is the same on all platforms.
+func unitDivergence(ctx context.Context, u *siteUnit) (*PlatformDivergence, error) {
+	if !u.meta.IsPackage() {
+		return nil, nil
+	}
+	unit, err := u.module.Unit(ctx, u.meta.Path)
+	if err != nil {
+		return nil, err
+	}
+	platforms, syms := divergentSymbols(unit.Documentation)
+	if len(syms) == 0 {
+		return nil, nil
+	}
+	return &PlatformDivergence{Package: u.meta.Path, Platforms: platforms, Symbols: syms}, nil
+}
+
+// A divergenceCheck is the unitCheck finding the platform divergences of
+// the packages, enforced for those that match the patterns of enforce.
+type divergenceCheck struct {
+	enforce []string
+	table   bool                  // whether pages get a table of their divergences
+	listed  bool                  // whether the report lists the divergences
+	found   []*PlatformDivergence // by unit index
+}
+
+// newDivergenceCheck returns the check of the given number of units. With
+// table, their pages get tables of their divergences, and with listed, the
+// report lists them.
+func newDivergenceCheck(units int, enforce []string, table, listed bool) *divergenceCheck {
+	return &divergenceCheck{enforce: enforce, table: table, listed: listed, found: make([]*PlatformDivergence, units)}
+}
+
+func (c *divergenceCheck) checkUnit(ctx context.Context, i int, u *siteUnit) pageTransform {
+	if u.version != "" {
+		return nil
+	}
+	d, err := unitDivergence(ctx, u)
+	if err != nil {
+		log.Errorf(ctx, "comparing platforms of %s: %v", u.path, err)
+	}
+	if d == nil {
+		return nil
+	}
+	for _, p := range c.enforce {
+		if matchPattern(p, d.Package) {
+			d.Enforced = true
+		}
+	}
+	c.found[i] = d
+	if !c.table {
+		return nil
+	}
+	return platformTableTransform(d)
+}
+
+func (c *divergenceCheck) report(r *Report) {
+	if !c.listed {
+		return
+	}
+	for _, d := range c.found {
+		if d != nil {
+			r.PlatformDivergence = append(r.PlatformDivergence, d)
+		}
+	}
+}
+
+// divergentSymbols returns the platforms of docs and the symbols that are
+// not in all of them, sorted by name.
+func divergentSymbols(docs []*internal.Documentation) ([]string, []DivergentSymbol) {
+	if len(docs) < 2 {
+		return nil, nil
+	}
+	var platforms []string
+	present := map[string][]string{} // symbol name to platforms
+	for _, d := range docs {
+		p := d.GOOS + "/" + d.GOARCH
+		platforms = append(platforms, p)
+		for _, s := range d.API {
+			present[s.Name] = append(present[s.Name], p)
+			for _, c := range s.Children {
+				present[c.Name] = append(present[c.Name], p)
+			}
+		}
+	}
+	var syms []DivergentSymbol
+	for name, ps := range present {
+		if len(ps) < len(docs) {
+			syms = append(syms, DivergentSymbol{Name: name, Platforms: ps})
+		}
+	}
+	sort.Slice(syms, func(i, j int) bool { return syms[i].Name < syms[j].Name })
+	return platforms, syms
+}
+
+// writeDivergenceReport writes a summary of ds for humans.
+func writeDivergenceReport(w io.Writer, ds []*PlatformDivergence) {
+	if len(ds) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Found %d packages whose documentation differs across platforms:\n", len(ds))
+	for _, d := range ds {
+		mark := ""
+		if d.Enforced {
+			mark = " (enforced)"
+		}
+		fmt.Fprintf(w, "  %s%s:\n", d.Package, mark)
+		for _, s := range d.Symbols {
+			fmt.Fprintf(w, "    %s: only on %s\n", s.Name, strings.Join(s.Platforms, ", "))
+		}
+	}
+}
+
+// platformTableStyle lays out the platform availability table like the
+// other tables of the documentation.
+const platformTableStyle = `.spk-PlatformTable-table {
+  border-collapse: collapse;
+  margin: 1rem 0;
+}
+.spk-PlatformTable-table th,
+.spk-PlatformTable-table td {
+  border: var(--border);
+  padding: 0.25rem 0.5rem;
+  text-align: center;
+}
+.spk-PlatformTable-table th[scope='row'] {
+  font-weight: normal;
+  text-align: left;
+}`
+
+// platformTableTransform returns a pageTransform that adds a table of the
+// platforms each divergent symbol of d is documented on after the index
+// of the package documentation.
+func platformTableTransform(d *PlatformDivergence) pageTransform {
+	return func(doc *html.Node, head *headManager) {
+		index := findElementFunc(doc, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && n.Data == "section" && hasClass(n, "Documentation-index")
+		})
+		if index == nil || index.Parent == nil {
+			return
+		}
+		var b strings.Builder
+		b.WriteString(`<h3 tabindex="-1" id="spk-platforms" class="spk-PlatformTable-header">Platform availability ` +
+			`<a href="#spk-platforms" title="Go to Platform availability" aria-label="Go to Platform availability">¶</a></h3>`)
+		b.WriteString(`<table class="spk-PlatformTable-table"><caption>Symbols documented on only some platforms</caption>`)
+		b.WriteString(`<thead><tr><th scope="col">Symbol</th>`)
+		for _, p := range d.Platforms {
+			fmt.Fprintf(&b, `<th scope="col">%s</th>`, html.EscapeString(p))
+		}
+		b.WriteString(`</tr></thead><tbody>`)
+		// The page shows the documentation of one platform, so only the
+		// symbols it documents can be linked.
+		ids := map[string]bool{}
+		findElementFunc(doc, func(n *html.Node) bool {
+			if id := attrValue(n, "id"); id != "" {
+				ids[id] = true
+			}
+			return false
+		})
+		for _, s := range d.Symbols {
+			name := html.EscapeString(s.Name)
+			if ids[s.Name] {
+				fmt.Fprintf(&b, `<tr><th scope="row"><a href="#%s">%s</a></th>`, name, name)
+			} else {
+				fmt.Fprintf(&b, `<tr><th scope="row">%s</th>`, name)
+			}
+			on := map[string]bool{}
+			for _, p := range s.Platforms {
+				on[p] = true
+			}
+			for _, p := range d.Platforms {
+				if on[p] {
+					b.WriteString(`<td title="Documented">✓</td>`)
+				} else {
+					b.WriteString(`<td title="Not documented">—</td>`)
+				}
+			}
+			b.WriteString(`</tr>`)
+		}
+		b.WriteString(`</tbody></table>`)
+
+		section := &html.Node{
+			Type:     html.ElementNode,
+			Data:     "section",
+			DataAtom: atom.Section,
+			Attr: []html.Attribute{
+				{Key: "class", Val: "spk-PlatformTable"},
+				{Key: "data-test-id", Val: "UnitDoc-platforms"},
+			},
+		}
+		nodes, err := html.ParseFragment(strings.NewReader(b.String()), section)
+		if err != nil {
+			return
+		}
+		for _, n := range nodes {
+			section.AppendChild(n)
+		}
+		index.Parent.InsertBefore(section, index.NextSibling)
+
+		style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: platformTableStyle})
+		head.register("platform-table-style", headOrderStyle, style)
+	}
+}
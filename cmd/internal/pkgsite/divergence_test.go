@@ -0,0 +1,145 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestDivergentSymbols(t *testing.T) {
+	sym := func(name string, children ...string) *internal.Symbol {
+		s := &internal.Symbol{SymbolMeta: internal.SymbolMeta{Name: name}}
+		for _, c := range children {
+			s.Children = append(s.Children, &internal.SymbolMeta{Name: c})
+		}
+		return s
+	}
+	docs := []*internal.Documentation{
+		{GOOS: "linux", GOARCH: "amd64", API: []*internal.Symbol{sym("F"), sym("T", "T.M", "T.Linux")}},
+		{GOOS: "windows", GOARCH: "amd64", API: []*internal.Symbol{sym("F"), sym("T", "T.M"), sym("Handle")}},
+		{GOOS: "js", GOARCH: "wasm", API: []*internal.Symbol{sym("F"), sym("T", "T.M", "T.Linux")}},
+	}
+	platforms, syms := divergentSymbols(docs)
+	if want := []string{"linux/amd64", "windows/amd64", "js/wasm"}; !cmp.Equal(platforms, want) {
+		t.Errorf("platforms = %q, want %q", platforms, want)
+	}
+	want := []DivergentSymbol{
+		{Name: "Handle", Platforms: []string{"windows/amd64"}},
+		{Name: "T.Linux", Platforms: []string{"linux/amd64", "js/wasm"}},
+	}
+	if diff := cmp.Diff(want, syms); diff != "" {
+		t.Errorf("symbols mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, syms := divergentSymbols(docs[:1]); syms != nil {
+		t.Errorf("one platform: got %v, want no symbols", syms)
+	}
+}
+
+func TestPlatformTableTransform(t *testing.T) {
+	d := &PlatformDivergence{
+		Package:   "example.com/m",
+		Platforms: []string{"linux/amd64", "windows/amd64"},
+		Symbols: []DivergentSymbol{
+			{Name: "Handle", Platforms: []string{"windows/amd64"}},
+			{Name: "Linux", Platforms: []string{"linux/amd64"}},
+		},
+	}
+	page := `<!DOCTYPE html><html><head></head><body><div class="Documentation-content">` +
+		`<section class="Documentation-index"></section><h4 id="Linux">func Linux</h4></div></body></html>`
+	got, err := processHTML([]byte(page), "/example.com/m", nil, platformTableTransform(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<section class="Documentation-index"></section><section class="spk-PlatformTable Documentation-platforms" data-test-id="UnitDoc-platforms"><span id="pkg-platforms"></span><h3 tabindex="-1" id="spk-platforms" class="spk-PlatformTable-header Documentation-platformsHeader">`,
+		`<th scope="col">linux/amd64</th><th scope="col">windows/amd64</th>`,
+		// Handle is not on the page, which shows the Linux documentation.
+		`<tr><th scope="row">Handle</th><td title="Not documented">—</td><td title="Documented">✓</td></tr>`,
+		`<tr><th scope="row"><a href="#Linux">Linux</a></th><td title="Documented">✓</td><td title="Not documented">—</td></tr>`,
+		`.spk-PlatformTable-table {`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("page does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerateStaticSitePlatformDivergence(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+
+// F is everywhere.
+func F() {}
+-- m_windows.go --
+package m
+
+// Handle is a Windows handle.
+type Handle uintptr
+-- sub/sub.go --
+// Package sub does other things.
+package sub
+
+// G is everywhere.
+func G() {}
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{
+		OutDir:             outDir,
+		PlatformDivergence: true,
+		PlatformTable:      true,
+		FailOnDivergence:   []string{"example.com/m"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.PlatformDivergence) != 1 {
+		t.Fatalf("got %d divergent packages, want 1", len(report.PlatformDivergence))
+	}
+	d := report.PlatformDivergence[0]
+	if d.Package != "example.com/m" || !d.Enforced {
+		t.Errorf("got package %q, enforced %t; want example.com/m, enforced", d.Package, d.Enforced)
+	}
+	want := []DivergentSymbol{{Name: "Handle", Platforms: []string{"windows/amd64"}}}
+	if diff := cmp.Diff(want, d.Symbols); diff != "" {
+		t.Errorf("symbols mismatch (-want +got):\n%s", diff)
+	}
+	if n := report.DivergenceFailures(); n != 1 {
+		t.Errorf("DivergenceFailures() = %d, want 1", n)
+	}
+
+	for _, test := range []struct {
+		page      string
+		wantTable bool
+	}{
+		{"example.com/m/index.html", true},
+		{"example.com/m/sub/index.html", false},
+	} {
+		page, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(test.page)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has := strings.Contains(string(page), `class="spk-PlatformTable Documentation-platforms"`); has != test.wantTable {
+			t.Errorf("%s has a platform table: %t, want %t", test.page, has, test.wantTable)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The documentation of a package links the identifiers of the packages it
+// uses to their pages, such as /golang.org/x/sync/errgroup#Group, which on a
+// static site only exist for the packages of the site. The links of the
+// documentation and of the imports tab to other packages are pointed at
+// their documentation under GenerateOptions.ExternalDocsURL, or, with
+// GenerateOptions.StripExternalLinks, replaced by their text, rather than left
+// to fail. The Markdown export links them as externalDocsURL does.
+
+// externalLinkPath returns the path, with any fragment, of the package
+// outside units, the canonical paths of the site's units, that the link
+// href of a frontend page points at. Links with a query, to the files of
+// local modules or within the page are not to packages.
+func externalLinkPath(href string, units map[string]bool) (string, bool) {
+	p, ok := strings.CutPrefix(href, "/")
+	if !ok || strings.HasPrefix(p, "/") || strings.HasPrefix(href, filesPrefix) || strings.Contains(p, "?") {
+		return "", false
+	}
+	target, _, _ := strings.Cut(p, "#")
+	if target == "" || units[canonicalUnitPath(target)] {
+		return "", false
+	}
+	return p, true
+}
+
+// pointExternalLink points the link a at the documentation of the package
+// at p, with any fragment, under externalBase, as externalDocsURL does, or,
+// if strip is set, replaces it by its contents.
+func pointExternalLink(a *html.Node, p, externalBase string, strip bool) {
+	if !strip {
+		setAttr(a, "href", externalDocsURL(externalBase, p))
+		return
+	}
+	for a.FirstChild != nil {
+		c := a.FirstChild
+		a.RemoveChild(c)
+		a.Parent.InsertBefore(c, a)
+	}
+	a.Parent.RemoveChild(a)
+}
+
+// docLinksTransform returns the page transform for unit pages that points
+// the links of the documentation to packages outside units, the canonical
+// paths of the site's units, at their documentation under externalBase, or,
+// if strip is set, replaces them by their text.
+func docLinksTransform(units map[string]bool, externalBase string, strip bool) pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		var links []*html.Node
+		var paths []string
+		var walk func(n *html.Node, inDoc bool)
+		walk = func(n *html.Node, inDoc bool) {
+			if n.Type == html.ElementNode {
+				if hasClass(n, "Documentation") {
+					inDoc = true
+				}
+				if inDoc && n.Data == "a" {
+					if p, ok := externalLinkPath(attrValue(n, "href"), units); ok {
+						links = append(links, n)
+						paths = append(paths, p)
+					}
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c, inDoc)
+			}
+		}
+		walk(doc, false)
+		for i, a := range links {
+			pointExternalLink(a, paths[i], externalBase, strip)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDocLinksTransform(t *testing.T) {
+	page := `<html><head></head><body>` +
+		`<a href="/fmt">Outside the documentation</a>` +
+		`<div class="Documentation"><p>Uses <a href="/example.com/m/a#T">a.T</a>, <a href="#F">F</a>, ` +
+		`<a href="/golang.org/x/sync/errgroup#Group">errgroup.Group</a>, <a href="/files/src/example.com/m/m.go">m.go</a> ` +
+		`and <a href="/example.com/m/a?tab=imports">imports</a>.</p></div>` +
+		`</body></html>`
+	units := map[string]bool{"example.com/m": true, "example.com/m/a": true}
+	for _, test := range []struct {
+		base  string
+		strip bool
+		want  []string
+	}{
+		{"", false, []string{
+			`<a href="../../fmt">Outside the documentation</a>`,
+			`<a href="../../example.com/m/a#T">a.T</a>`,
+			`<a href="#F">F</a>`,
+			`<a href="https://pkg.go.dev/golang.org/x/sync/errgroup#Group">errgroup.Group</a>`,
+			`<a href="../../files/src/example.com/m/m.go">m.go</a>`,
+			`<a href="../../example.com/m/a?tab=imports">imports</a>`,
+		}},
+		{"https://docs.example.com/", false, []string{
+			`<a href="../../example.com/m/a#T">a.T</a>`,
+			`<a href="https://docs.example.com/golang.org/x/sync/errgroup#Group">errgroup.Group</a>`,
+		}},
+		{"", true, []string{
+			`<a href="../../fmt">Outside the documentation</a>`,
+			`<a href="../../example.com/m/a#T">a.T</a>`,
+			`, errgroup.Group, `,
+		}},
+	} {
+		got, err := processHTML([]byte(page), "/example.com/m", nil, docLinksTransform(units, test.base, test.strip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(got), want) {
+				t.Errorf("base %q, strip %t: page does not contain %s:\n%s", test.base, test.strip, want, got)
+			}
+		}
+	}
+}
+
+func TestGenerateStaticSiteExternalLinks(t *testing.T) {
+	const txtar = `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m waits for [golang.org/x/sync/errgroup.Group] and uses [example.com/m/a.T].
+package m
+-- a/a.go --
+// Package a has a type.
+package a
+
+// T is a type.
+type T struct{}
+`
+	for _, strip := range []bool{false, true} {
+		outDir := generateTestSite(t, txtar, func(_ *ServerConfig, opts *GenerateOptions) {
+			opts.StripExternalLinks = strip
+		})
+		data, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := string(data)
+		if !strings.Contains(page, `href="../../example.com/m/a#T"`) {
+			t.Errorf("strip %t: page lacks the relative link to a.T", strip)
+		}
+		external := strings.Contains(page, `href="https://pkg.go.dev/golang.org/x/sync/errgroup#Group"`)
+		if external == strip {
+			t.Errorf("strip %t: got link to pkg.go.dev %t, want %t", strip, external, !strip)
+		}
+		if strip && strings.Contains(page, `golang.org/x/sync/errgroup#Group"`) {
+			t.Error("strip true: page still links errgroup.Group")
+		}
+		checkInternalLinks(t, outDir, "example.com/")
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// With GenerateOptions.DownloadBundles, each module gets a download bundle,
+// downloads/<module>.zip, for distributing its documentation to be viewed
+// offline, linked from a "Download docs" item in the header of the module
+// page. A bundle holds the files of the module's pages, at their paths in
+// the site, and the assets they need, once each: the scripts, style sheets
+// and images the pages load, and those that the style sheets refer to and
+// the scripts mention, as the asset graph records them. In the pages of a
+// bundle, the links to other pages of the bundle point at their index.html
+// files, which browsers open from a file system; links to the rest of the
+// site point at it under ServerConfig.SiteURL, if it is set. Bundles are
+// not pages: the sitemap leaves them out, and the report lists them apart.
+const downloadsDir = "downloads"
+
+// downloadBundlePath returns the site path of the download bundle of the
+// module at modulePath.
+func downloadBundlePath(modulePath string) string {
+	return downloadsDir + "/" + canonicalUnitPath(modulePath) + ".zip"
+}
+
+// isBundledUnit reports whether the page of u links the download bundle of
+// its module: whether it is the unversioned page of the module.
+func isBundledUnit(u *siteUnit) bool {
+	return u.version == "" && u.path == canonicalUnitPath(u.meta.ModulePath)
+}
+
+// downloadLinkTransform returns the page transform adding the link to the
+// download bundle of the module at modulePath to the header of its page.
+func downloadLinkTransform(modulePath string) pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		details := findElementFunc(doc, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && hasClass(n, "go-Main-headerDetails")
+		})
+		if details == nil {
+			return
+		}
+		item := &html.Node{
+			Type:     html.ElementNode,
+			Data:     "span",
+			DataAtom: atom.Span,
+			Attr: []html.Attribute{
+				{Key: "class", Val: "go-Main-headerDetailItem"},
+				{Key: "data-test-id", Val: "UnitHeader-downloadDocs"},
+			},
+		}
+		a := &html.Node{
+			Type:     html.ElementNode,
+			Data:     "a",
+			DataAtom: atom.A,
+			Attr: []html.Attribute{
+				{Key: "href", Val: "/" + downloadBundlePath(modulePath)},
+				{Key: "download", Val: ""},
+			},
+		}
+		a.AppendChild(&html.Node{Type: html.TextNode, Data: "Download docs"})
+		item.AppendChild(a)
+		details.AppendChild(item)
+	}
+}
+
+// writeDownloadBundles writes the download bundles of the modules that r
+// recorded pages of to out, with the assets of assets, and returns them,
+// sorted by module path. siteURL is the URL of the site, or "". If keep is
+// not nil, only the modules it holds get bundles.
+func writeDownloadBundles(out *siteOutput, r *moduleRecorder, assets *assetGraph, siteURL string, keep map[string]bool) ([]DownloadBundle, error) {
+	files := map[string][]string{}
+	for p := range out.written {
+		if mod, ok := r.moduleOf(p); ok && (keep == nil || keep[mod]) {
+			files[mod] = append(files[mod], p)
+		}
+	}
+	mods := make([]string, 0, len(files))
+	for mod := range files {
+		mods = append(mods, mod)
+	}
+	sort.Strings(mods)
+	var bundles []DownloadBundle
+	for _, mod := range mods {
+		b, err := writeDownloadBundle(out, mod, files[mod], assets, siteURL)
+		if err != nil {
+			return nil, fmt.Errorf("download bundle of %s: %w", mod, err)
+		}
+		bundles = append(bundles, b)
+	}
+	return bundles, nil
+}
+
+// writeDownloadBundle writes the download bundle of the module mod, whose
+// files in out are files.
+func writeDownloadBundle(out *siteOutput, mod string, files []string, assets *assetGraph, siteURL string) (DownloadBundle, error) {
+	sort.Strings(files)
+	// bundled holds the files of the bundle, and the site paths of its
+	// pages, as links point at them, mapped to true for the pages.
+	bundled := map[string]bool{}
+	for _, f := range files {
+		bundled[f] = false
+		if dir, ok := strings.CutSuffix(f, "/index.html"); ok {
+			bundled[dir] = true
+		}
+	}
+	contents := map[string][]byte{}
+	var roots []string
+	for _, f := range files {
+		file, err := outputPath(out.dir, f)
+		if err != nil {
+			return DownloadBundle{}, err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return DownloadBundle{}, err
+		}
+		if path.Ext(f) == ".html" {
+			var refs []string
+			data, refs, err = bundlePage(data, f, bundled, siteURL)
+			if err != nil {
+				return DownloadBundle{}, fmt.Errorf("%s: %w", f, err)
+			}
+			roots = append(roots, refs...)
+		}
+		contents[f] = data
+	}
+	assetFiles := assets.closure(roots)
+	for _, f := range assetFiles {
+		file, err := outputPath(out.dir, f)
+		if err != nil {
+			return DownloadBundle{}, err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return DownloadBundle{}, err
+		}
+		contents[f] = data
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range slices.Sorted(maps.Keys(contents)) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			return DownloadBundle{}, err
+		}
+		if _, err := w.Write(contents[name]); err != nil {
+			return DownloadBundle{}, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return DownloadBundle{}, err
+	}
+	sitePath := downloadBundlePath(mod)
+	file, err := outputPath(out.dir, sitePath)
+	if err != nil {
+		return DownloadBundle{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return DownloadBundle{}, err
+	}
+	if err := out.writeFile(file, buf.Bytes()); err != nil {
+		return DownloadBundle{}, err
+	}
+	return DownloadBundle{
+		Module: mod,
+		File:   sitePath,
+		Pages:  len(files),
+		Assets: len(assetFiles),
+		Bytes:  int64(buf.Len()),
+	}, nil
+}
+
+// bundlePage returns the page data at the site path file, as the download
+// bundle with the files and pages of bundled holds it, and the site paths
+// of the assets it loads. The link to the bundle itself is removed.
+func bundlePage(data []byte, file string, bundled map[string]bool, siteURL string) ([]byte, []string, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	ev := &pageEvent{File: file}
+	summarizePage(doc, ev)
+	refs := pageAssets(ev)
+	dir := path.Dir(file)
+	var removed []*html.Node
+	walkElements(doc, func(n *html.Node) {
+		switch {
+		case attrValue(n, "data-test-id") == "UnitHeader-downloadDocs":
+			removed = append(removed, n)
+		case n.Data == "a":
+			href := attrValue(n, "href")
+			if !isLocalReference(href) || strings.HasPrefix(href, "/") {
+				return
+			}
+			target, rest := href, ""
+			if i := strings.IndexAny(href, "?#"); i >= 0 {
+				target, rest = href[:i], href[i:]
+			}
+			if target == "" {
+				return // within the page
+			}
+			dest := path.Join(dir, target)
+			page, ok := bundled[dest]
+			switch {
+			case page:
+				setAttr(n, "href", strings.TrimSuffix(target, "/")+"/index.html"+rest)
+			case !ok && siteURL != "" && !strings.HasPrefix(dest, "../") && dest != "..":
+				if dest == "." {
+					dest = ""
+				}
+				setAttr(n, "href", strings.TrimSuffix(siteURL, "/")+"/"+dest+rest)
+			}
+		}
+	})
+	for _, n := range removed {
+		n.Parent.RemoveChild(n)
+	}
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), refs, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestAssetGraphClosure(t *testing.T) {
+	g := newAssetGraph()
+	g.addFile("static/a.css", []byte(`@import "b.css"; .x { background: url(x.svg) }`))
+	g.addFile("static/b.css", []byte(`.y { background: url(/static/y.svg) }`))
+	g.addFile("static/x.svg", nil)
+	g.addFile("static/y.svg", nil)
+	g.addFile("static/z.svg", nil)
+	g.addFile("static/s.js", []byte(`img.src = "../static/w.svg"`))
+	g.addFile("static/w.svg", nil)
+	got := strings.Join(g.closure([]string{"static/a.css", "static/s.js", "static/missing.css"}), " ")
+	if want := "static/a.css static/b.css static/s.js static/w.svg static/x.svg static/y.svg"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// readZip returns the files of the zip file at file, by name.
+func readZip(t *testing.T, file string) map[string][]byte {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		if _, ok := files[f.Name]; ok {
+			t.Errorf("%s: %s is in the zip twice", file, f.Name)
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], err = io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func TestGenerateStaticSiteDownloadBundles(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	// The go command rejects -mod=mod in workspace mode.
+	t.Setenv("GOFLAGS", "")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.work --
+go 1.21
+
+use (
+	./a
+	./b
+)
+-- a/go.mod --
+module example.com/a
+
+go 1.21
+-- a/a.go --
+// Package a is used by b.
+package a
+
+// A is a.
+const A = 1
+-- a/sub/sub.go --
+// Package sub is in a.
+package sub
+-- b/go.mod --
+module example.com/b
+
+go 1.21
+
+require example.com/a v0.0.0
+-- b/b.go --
+// Package b uses a.
+package b
+
+import "example.com/a"
+
+// B is b.
+const B = a.A
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Workspace:     dir,
+		UseListedMods: true,
+		SiteURL:       "https://example.com/docs/",
+	}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Sitemap: true, DownloadBundles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.DownloadBundles) != 2 {
+		t.Fatalf("report lists %d download bundles, want 2: %+v", len(report.DownloadBundles), report.DownloadBundles)
+	}
+	for i, mod := range []string{"example.com/a", "example.com/b"} {
+		if b := report.DownloadBundles[i]; b.Module != mod || b.File != "downloads/"+mod+".zip" || b.Pages == 0 || b.Assets == 0 || b.Bytes == 0 {
+			t.Errorf("download bundle %d: got %+v", i, b)
+		}
+	}
+
+	// The module page links its bundle.
+	page, err := os.ReadFile(filepath.Join(outDir, "example.com", "a", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), `href="../../downloads/example.com/a.zip"`) {
+		t.Error("module page does not link its download bundle")
+	}
+	sitemap, err := os.ReadFile(filepath.Join(outDir, sitemapFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sitemap), downloadsDir) {
+		t.Errorf("sitemap lists the download bundles:\n%s", sitemap)
+	}
+
+	a := readZip(t, filepath.Join(outDir, "downloads", "example.com", "a.zip"))
+	for _, name := range []string{"example.com/a/index.html", "example.com/a/sub/index.html", "static/frontend/frontend.js"} {
+		if _, ok := a[name]; !ok {
+			t.Errorf("bundle of example.com/a does not hold %s", name)
+		}
+	}
+	for name, data := range a {
+		if strings.HasPrefix(name, "example.com/b/") {
+			t.Errorf("bundle of example.com/a holds %s", name)
+		}
+		if path.Ext(name) != ".html" {
+			continue
+		}
+		if strings.Contains(string(data), "UnitHeader-downloadDocs") {
+			t.Errorf("%s in the bundle links the bundle", name)
+		}
+		// The bundle holds the assets of its pages.
+		doc, err := html.Parse(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev := &pageEvent{File: name}
+		summarizePage(doc, ev)
+		for _, p := range pageAssets(ev) {
+			if _, ok := a[p]; !ok {
+				t.Errorf("%s in the bundle loads %s, which the bundle lacks", name, p)
+			}
+		}
+	}
+	if !strings.Contains(string(a["example.com/a/index.html"]), `href="../../example.com/a/sub/index.html"`) {
+		t.Error("the module page in the bundle does not link the index.html file of its package")
+	}
+
+	b := readZip(t, filepath.Join(outDir, "downloads", "example.com", "b.zip"))
+	imports := string(b["example.com/b/imports/index.html"])
+	if !strings.Contains(imports, `href="https://example.com/docs/example.com/a"`) {
+		t.Errorf("the imports page in the bundle of example.com/b does not link example.com/a on the site:\n%s", imports)
+	}
+}
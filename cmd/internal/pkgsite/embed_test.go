@@ -0,0 +1,92 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+const embedFixture = `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- data/data.go --
+// Package data embeds its data.
+package data
+
+import _ "embed"
+
+// Big is a large table.
+//
+//go:embed big.bin
+var Big []byte
+
+// Gone names a file the module does not have.
+//
+//go:embed gone.txt
+var Gone string
+
+// Size returns the size of Big.
+func Size() int { return len(Big) }
+-- data/big.bin --
+`
+
+func TestGenerateStaticSiteEmbed(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, embedFixture)
+	// A sparse file, which takes no space on disk but is large to read.
+	const bigSize = 200 << 20
+	if err := os.Truncate(filepath.Join(modDir, "data", "big.bin"), bigSize); err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, SourcePages: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "data", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		"Package data embeds its data.",
+		`id="Big"`,
+		`id="Gone"`,
+		`id="Size"`,
+		"Big is a large table.",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the page of the package does not contain %q", want)
+		}
+	}
+
+	// Neither the embedded file nor a page of it is written.
+	err = filepath.WalkDir(outDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.Contains(d.Name(), "big.bin") {
+			t.Errorf("%s was written", p)
+		}
+		if fi, err := d.Info(); err == nil && fi.Size() >= bigSize {
+			t.Errorf("%s has %d bytes", p, fi.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/godoc"
+	"github.com/wow-look-at-my/static-pkgsite/internal/log"
+)
+
+// The documentation of a package whose Go files declare exported
+// identifiers can still have none of them: build constraints, such as
+// "//go:build !codeanalysis" on generated files, can leave the files that
+// declare them out of every build context the documentation is loaded for,
+// so that only a doc.go is left, and the page shows an empty index. A
+// package whose documentation has no exported declarations on any
+// platform is checked against a count of the exported identifiers that its
+// files declare at top level, from their syntax trees; if they declare at
+// least GenerateOptions.EmptyDocMinExported, the package is listed in the
+// report, with the likely causes, and its page gets a note saying so.
+
+// The likely causes of empty documentation, as EmptyDoc.Causes lists them.
+const (
+	emptyDocConstraints = "build-constraints"
+	emptyDocGenerated   = "generated-files"
+)
+
+// unitEmptyDoc returns the empty documentation of the package u, or nil if
+// its documentation has exported declarations, or its files declare fewer
+// than min exported identifiers.
+func unitEmptyDoc(ctx context.Context, u *siteUnit, min int) (*EmptyDoc, error) {
+	if !u.meta.IsPackage() || u.getter == nil {
+		return nil, nil
+	}
+	unit, err := u.module.Unit(ctx, u.meta.Path)
+	if err != nil {
+		return nil, err
+	}
+	documented := map[string]bool{} // by file name
+	for _, d := range unit.Documentation {
+		if len(d.API) > 0 {
+			return nil, nil
+		}
+		pkg, err := godoc.DecodePackage(d.Source)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range pkg.Files {
+			documented[path.Base(f.Name)] = true
+		}
+	}
+	fsys, err := u.getter.ContentDir(ctx, u.meta.ModulePath, u.module.Version)
+	if err != nil {
+		return nil, err
+	}
+	dir := strings.TrimPrefix(strings.TrimPrefix(u.meta.Path, u.meta.ModulePath), "/")
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	e := &EmptyDoc{Package: u.meta.Path}
+	causes := map[string]bool{}
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || path.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") ||
+			strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		src, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments|parser.SkipObjectResolution)
+		// A program guarded by "//go:build ignore" is not part of the
+		// package.
+		if err != nil || f.Name.Name != u.meta.Name {
+			continue
+		}
+		n := exportedIdents(f)
+		if n == 0 {
+			continue
+		}
+		e.Exported += n
+		e.Files = append(e.Files, name)
+		if !documented[name] {
+			causes[emptyDocConstraints] = true
+		}
+		if ast.IsGenerated(f) {
+			causes[emptyDocGenerated] = true
+		}
+	}
+	if e.Exported == 0 || e.Exported < min {
+		return nil, nil
+	}
+	e.Causes = slices.Sorted(maps.Keys(causes))
+	return e, nil
+}
+
+// exportedIdents returns the number of exported identifiers that f
+// declares at top level, not counting methods.
+func exportedIdents(f *ast.File) int {
+	n := 0
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil && decl.Name.IsExported() {
+				n++
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if spec.Name.IsExported() {
+						n++
+					}
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						if name.IsExported() {
+							n++
+						}
+					}
+				}
+			}
+		}
+	}
+	return n
+}
+
+// emptyDocNote returns the note on the page of the package of e: note, if
+// it is set, or else a note naming the likely causes.
+func emptyDocNote(e *EmptyDoc, note string) string {
+	if note != "" {
+		return note
+	}
+	s := fmt.Sprintf("The Go files of this package declare %d exported identifiers, but its documentation shows none of them.", e.Exported)
+	constraints, generated := slices.Contains(e.Causes, emptyDocConstraints), slices.Contains(e.Causes, emptyDocGenerated)
+	switch {
+	case constraints && generated:
+		s += " The files that declare them are generated, and build constraints leave them out of the documentation of every platform."
+	case constraints:
+		s += " Build constraints leave the files that declare them out of the documentation of every platform."
+	case generated:
+		s += " The files that declare them are generated."
+	}
+	return s
+}
+
+// An emptyDocCheck is the unitCheck finding the packages with empty
+// documentation, whose pages get the note of emptyDocTransform.
+type emptyDocCheck struct {
+	min   int
+	note  string
+	found []*EmptyDoc // by unit index
+}
+
+// newEmptyDocCheck returns the check of the given number of units, for
+// packages whose files declare at least min exported identifiers.
+func newEmptyDocCheck(units, min int, note string) *emptyDocCheck {
+	return &emptyDocCheck{min: min, note: note, found: make([]*EmptyDoc, units)}
+}
+
+func (c *emptyDocCheck) checkUnit(ctx context.Context, i int, u *siteUnit) pageTransform {
+	e, err := unitEmptyDoc(ctx, u, c.min)
+	if err != nil {
+		log.Errorf(ctx, "counting the exported identifiers of %s: %v", u.path, err)
+	}
+	if e == nil {
+		return nil
+	}
+	c.found[i] = e
+	return emptyDocTransform(e, c.note)
+}
+
+func (c *emptyDocCheck) report(r *Report) {
+	for _, e := range c.found {
+		if e != nil {
+			r.EmptyDocs = append(r.EmptyDocs, e)
+		}
+	}
+}
+
+// emptyDocTransform returns the page transform adding the note of e, or
+// note if it is set, at the top of the documentation of the page.
+func emptyDocTransform(e *EmptyDoc, note string) pageTransform {
+	text := emptyDocNote(e, note)
+	return func(doc *html.Node, _ *headManager) {
+		section := findElementFunc(doc, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && hasClass(n, "Documentation")
+		})
+		if section == nil {
+			return
+		}
+		div := &html.Node{
+			Type:     html.ElementNode,
+			Data:     "div",
+			DataAtom: atom.Div,
+			Attr: []html.Attribute{
+				{Key: "class", Val: "go-Message go-Message--notice"},
+				{Key: "data-test-id", Val: "UnitDoc-emptyNote"},
+				{Key: "role", Val: "note"},
+			},
+		}
+		div.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+		section.InsertBefore(div, section.FirstChild)
+	}
+}
+
+// writeEmptyDocReport writes a summary of es for humans.
+func writeEmptyDocReport(w io.Writer, es []*EmptyDoc) {
+	if len(es) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Found %d packages whose documentation shows none of the exported identifiers of their files:\n", len(es))
+	for _, e := range es {
+		cause := ""
+		if len(e.Causes) > 0 {
+			cause = " (likely " + strings.Join(e.Causes, ", ") + ")"
+		}
+		fmt.Fprintf(w, "  %s: %d in %s%s\n", e.Package, e.Exported, strings.Join(e.Files, ", "), cause)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestExportedIdents(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "x.go", `package x
+
+const A, b = 1, 2
+
+var (
+	C int
+	d int
+)
+
+type E struct{}
+
+type f int
+
+func G() {}
+
+func h() {}
+
+func (E) M() {}
+`, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := exportedIdents(f), 4; got != want {
+		t.Errorf("exportedIdents = %d, want %d", got, want)
+	}
+}
+
+// emptyDocModule has a package all of whose files are generated, and
+// whose declarations are all in a file that a build constraint leaves out.
+const emptyDocModule = `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+
+// F does a thing.
+func F() {}
+-- gen/doc.go --
+// Code generated by gen; DO NOT EDIT.
+
+// Package gen holds generated code.
+package gen
+-- gen/gen.go --
+// Code generated by gen; DO NOT EDIT.
+
+//go:build codegen
+
+package gen
+
+// Kind is a kind.
+type Kind int
+
+// The kinds.
+const (
+	KindA Kind = iota
+	KindB
+)
+
+// Parse parses a kind.
+func Parse(s string) Kind { return KindA }
+-- gen/ignored.go --
+//go:build ignore
+
+package main
+
+func Main() {}
+`
+
+func TestGenerateStaticSiteEmptyDocs(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, emptyDocModule)
+	outDir := t.TempDir()
+	generate := func(modify func(*GenerateOptions)) *Report {
+		t.Helper()
+		cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+		opts := GenerateOptions{OutDir: outDir}
+		modify(&opts)
+		report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+	note := func(unit string) string {
+		t.Helper()
+		page, err := os.ReadFile(filepath.Join(outDir, unit, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, after, ok := strings.Cut(string(page), `data-test-id="UnitDoc-emptyNote" role="note">`)
+		if !ok {
+			return ""
+		}
+		text, _, _ := strings.Cut(after, "<")
+		return text
+	}
+
+	report := generate(func(*GenerateOptions) {})
+	want := []*EmptyDoc{{
+		Package:  "example.com/m/gen",
+		Exported: 4,
+		Files:    []string{"gen.go"},
+		Causes:   []string{emptyDocConstraints, emptyDocGenerated},
+	}}
+	if diff := cmp.Diff(want, report.EmptyDocs); diff != "" {
+		t.Errorf("empty docs mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := note("example.com/m/gen"), "The Go files of this package declare 4 exported identifiers, but its documentation shows none of them. "+
+		"The files that declare them are generated, and build constraints leave them out of the documentation of every platform."; got != want {
+		t.Errorf("note = %q, want %q", got, want)
+	}
+	if got := note("example.com/m"); got != "" {
+		t.Errorf("example.com/m has a note: %q", got)
+	}
+	var b bytes.Buffer
+	writeReport(&b, report)
+	if want := "  example.com/m/gen: 4 in gen.go (likely build-constraints, generated-files)\n"; !strings.Contains(b.String(), want) {
+		t.Errorf("report does not contain %q:\n%s", want, b.String())
+	}
+
+	generate(func(opts *GenerateOptions) { opts.EmptyDocNote = "Built with -tags codegen only." })
+	if got, want := note("example.com/m/gen"), "Built with -tags codegen only."; got != want {
+		t.Errorf("note with EmptyDocNote = %q, want %q", got, want)
+	}
+
+	for _, min := range []int{5, -1} {
+		report := generate(func(opts *GenerateOptions) { opts.EmptyDocMinExported = min })
+		if len(report.EmptyDocs) > 0 {
+			t.Errorf("EmptyDocMinExported %d: got empty docs %v", min, report.EmptyDocs)
+		}
+		if got := note("example.com/m/gen"); got != "" {
+			t.Errorf("EmptyDocMinExported %d: note %q", min, got)
+		}
+	}
+}
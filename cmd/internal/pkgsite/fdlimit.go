@@ -0,0 +1,53 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"io"
+)
+
+// Each worker of a generation can hold files open at once: the page it
+// writes, a file of a module it reads, such as a source file or the zip
+// of a module in the module cache, and a temporary file of the go command
+// or of the post-processing. With GenerateOptions.Workers set high, that
+// can exceed the limit on open files of the process, which is low by
+// default on macOS, and fail with "too many open files". So the number of
+// workers is lowered to what the limit allows, after setting aside
+// fdReserve files for the rest of the process.
+const (
+	fdsPerWorker = 4
+	fdReserve    = 64
+)
+
+// workerLimit returns the number of workers, at most workers and at least
+// one, that a limit of limit open files allows.
+func workerLimit(workers int, limit uint64) int {
+	if workers < 1 {
+		return 1
+	}
+	if limit < fdReserve+fdsPerWorker {
+		return 1
+	}
+	if n := (limit - fdReserve) / fdsPerWorker; uint64(workers) > n {
+		return int(n)
+	}
+	return workers
+}
+
+// limitWorkers returns the number of workers of a generation that asks for
+// workers, lowered to what the limit on open files of the process allows.
+// If it is lowered, it says so on w.
+func limitWorkers(w io.Writer, workers int) int {
+	limit, ok := openFileLimit()
+	if !ok {
+		return max(workers, 1)
+	}
+	n := workerLimit(workers, limit)
+	if n < workers {
+		fmt.Fprintf(w, "Rendering with %d workers instead of %d: each can hold %d files open, and the process can open %d\n", n, workers, fdsPerWorker, limit)
+	}
+	return n
+}
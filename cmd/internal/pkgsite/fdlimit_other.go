@@ -0,0 +1,13 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+
+package pkgsite
+
+// openFileLimit reports that there is no limit on the number of files the
+// process can open that it knows of.
+func openFileLimit() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestWorkerLimit(t *testing.T) {
+	for _, test := range []struct {
+		workers int
+		limit   uint64
+		want    int
+	}{
+		{0, 1024, 1},
+		{1, 1024, 1},
+		{8, 1024, 8},
+		{1000, 1024, (1024 - fdReserve) / fdsPerWorker},
+		{1000, 256, (256 - fdReserve) / fdsPerWorker},
+		{8, fdReserve, 1},
+		{8, 0, 1},
+		{8, 1 << 63, 8},
+	} {
+		if got := workerLimit(test.workers, test.limit); got != test.want {
+			t.Errorf("workerLimit(%d, %d) = %d, want %d", test.workers, test.limit, got, test.want)
+		}
+	}
+}
+
+// siteTxtar returns a module of n packages, for the tests of workers.
+func siteTxtar(n int) string {
+	var b strings.Builder
+	b.WriteString("-- go.mod --\nmodule example.com/m\n\ngo 1.21\n")
+	b.WriteString("-- m.go --\n// Package m does things.\npackage m\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "-- p%d/p.go --\n// Package p%d does thing %d.\npackage p%d\n\n// F returns %d.\nfunc F() int { return %d }\n", i, i, i, i, i, i)
+	}
+	return b.String()
+}
+
+func TestGenerateStaticSiteWorkers(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, siteTxtar(12))
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true, SymbolIndex: true}
+	generate := func(workers int) []string {
+		t.Helper()
+		outDir := t.TempDir()
+		report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Workers: workers, SourcePages: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.FailedPages) > 0 {
+			t.Errorf("workers=%d: failed pages %+v", workers, report.FailedPages)
+		}
+		files, err := hashOutDir(outDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The contents can differ from run to run, as the dates of local
+		// modules do.
+		return slices.Sorted(maps.Keys(files))
+	}
+	// Workers write the same files as a single one.
+	if diff := cmp.Diff(generate(1), generate(8)); diff != "" {
+		t.Errorf("files mismatch (-1 worker +8 workers):\n%s", diff)
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package pkgsite
+
+import "syscall"
+
+// openFileLimit returns the soft limit on the number of files the process
+// can open, and whether it is known. No limit is a very large one.
+func openFileLimit() (uint64, bool) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, false
+	}
+	return uint64(rlim.Cur), true
+}
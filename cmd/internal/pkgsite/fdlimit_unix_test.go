@@ -0,0 +1,55 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestGenerateStaticSiteLowFileLimit(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, siteTxtar(40))
+
+	const limit = 256
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		t.Skipf("getting the limit on open files: %v", err)
+	}
+	if rlim.Cur < limit {
+		t.Skipf("limit on open files is already %d", rlim.Cur)
+	}
+	low := rlim
+	low.Cur = limit
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &low); err != nil {
+		t.Skipf("lowering the limit on open files: %v", err)
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlim)
+
+	var buf bytes.Buffer
+	if got, want := limitWorkers(&buf, 1000), (limit-fdReserve)/fdsPerWorker; got != want {
+		t.Errorf("limitWorkers(1000) = %d, want %d", got, want)
+	}
+	if !strings.Contains(buf.String(), "instead of 1000") {
+		t.Errorf("limitWorkers(1000) said %q, want an explanation", buf.String())
+	}
+
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: t.TempDir(), Workers: 1000, SourcePages: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.FailedPages) > 0 {
+		t.Errorf("failed pages %+v", report.FailedPages)
+	}
+}
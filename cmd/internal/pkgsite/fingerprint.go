@@ -0,0 +1,192 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+	"golang.org/x/net/html"
+)
+
+// Mirrors of a site sync it conditionally, like HTTP caches with ETags:
+// fingerprints.json maps the URL path of every file of the output
+// directory to a fingerprint, a short hash of the file's contents, and a
+// mirror fetches only the files whose fingerprints changed. The
+// fingerprints are computed at the end of a run, from the files as
+// written, so that they cover the aggregate files such as the sitemap.
+//
+// With GenerateOptions.ContentHash, each HTML page also records its own
+// fingerprint on its <html> element. The fingerprint of a page is then
+// that of its contents with the attribute empty.
+const (
+	fingerprintsFile = "fingerprints.json"
+	contentHashAttr  = "data-content-hash"
+	fingerprintLen   = 16 // hex digits
+)
+
+// fingerprintedFiles calls f with the slash-separated path and the name of
+// each file of out that has a fingerprint: all but the manifest, change
+// lists, record of written files and compressed siblings (see
+// precompress.go).
+func fingerprintedFiles(out *siteOutput, f func(p, file string) error) error {
+	return filepath.WalkDir(out.dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(out.dir, file)
+		if err != nil {
+			return err
+		}
+		p := filepath.ToSlash(rel)
+		switch p {
+		case manifestFile, manifestFile + ".tmp", changedFilesFile, deletedFilesFile, fingerprintsFile, writtenFile, writtenFile + ".tmp", optionsFile, modulesFile, batchFile:
+			return nil
+		}
+		if out.isCompressedSibling(p) {
+			return nil
+		}
+		return f(p, file)
+	})
+}
+
+// markContentHashes records the fingerprint of each HTML page of out on the
+// page.
+func markContentHashes(out *siteOutput) error {
+	return fingerprintedFiles(out, func(p, file string) error {
+		if !strings.HasSuffix(p, ".html") {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		blank, ok := setContentHash(data, "")
+		if !ok {
+			return nil
+		}
+		marked, _ := setContentHash(blank, contentHash(blank, true))
+		if bytes.Equal(marked, data) {
+			return nil
+		}
+		return out.writeFile(file, marked)
+	})
+}
+
+// writeFingerprints writes the fingerprints of the files of out. With
+// GenerateOptions.ContentHash, the pages must be marked by markContentHashes
+// first.
+func writeFingerprints(out *siteOutput) error {
+	fps := map[string]string{}
+	err := fingerprintedFiles(out, func(p, file string) error {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fps[fileURLPath(p)] = contentHash(data, strings.HasSuffix(p, ".html"))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&schema.Fingerprints{
+		SchemaVersion: schema.FingerprintsArtifact.Version.String(),
+		Paths:         fps,
+	})
+	if err != nil {
+		return err
+	}
+	return out.writeFile(filepath.Join(out.dir, fingerprintsFile), data)
+}
+
+// fileURLPath returns the URL path of the file at the slash-separated path
+// p of the output directory. Pages are directories, so the URL path of an
+// index.html file ends in a slash.
+func fileURLPath(p string) string {
+	if p == "index.html" {
+		return "/"
+	}
+	if strings.HasSuffix(p, "/index.html") {
+		return "/" + strings.TrimSuffix(p, "index.html")
+	}
+	return "/" + p
+}
+
+// contentHash returns the fingerprint of a file with contents data. If
+// isHTML is set and the <html> element has a content hash attribute, the
+// attribute is emptied first.
+func contentHash(data []byte, isHTML bool) string {
+	if isHTML {
+		if _, _, tok, ok := htmlStartTag(data); ok && hasTokenAttr(tok, contentHashAttr) {
+			data, _ = setContentHash(data, "")
+		}
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:fingerprintLen]
+}
+
+// setContentHash returns the HTML document data with the content hash
+// attribute of its <html> element set to fp. It reports false if the
+// document has no <html> start tag.
+func setContentHash(data []byte, fp string) ([]byte, bool) {
+	start, end, tok, ok := htmlStartTag(data)
+	if !ok {
+		return nil, false
+	}
+	found := false
+	for i, a := range tok.Attr {
+		if a.Key == contentHashAttr {
+			tok.Attr[i].Val = fp
+			found = true
+		}
+	}
+	if !found {
+		tok.Attr = append(tok.Attr, html.Attribute{Key: contentHashAttr, Val: fp})
+	}
+	var buf bytes.Buffer
+	buf.Write(data[:start])
+	buf.WriteString(tok.String())
+	buf.Write(data[end:])
+	return buf.Bytes(), true
+}
+
+// htmlStartTag returns the start tag of the <html> element of the HTML
+// document data, and its offsets. It reports false if the document has no
+// <html> start tag before any other.
+func htmlStartTag(data []byte) (start, end int, tok html.Token, ok bool) {
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		tt := z.Next()
+		raw := len(z.Raw())
+		switch tt {
+		case html.ErrorToken:
+			return 0, 0, html.Token{}, false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok = z.Token()
+			if tok.Data != "html" {
+				return 0, 0, html.Token{}, false
+			}
+			return start, start + raw, tok, true
+		}
+		start += raw
+	}
+}
+
+// hasTokenAttr reports whether tok has the attribute key.
+func hasTokenAttr(tok html.Token, key string) bool {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+func TestGenerateStaticSiteFingerprints(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- a/a.go --
+// Package a does other things.
+package a
+-- b/b.go --
+// Package b does more things.
+package b
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	generate := func() map[string]string {
+		t.Helper()
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, ContentHash: true}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(outDir, fingerprintsFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fps, err := schema.DecodeFingerprints(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fps.Paths
+	}
+
+	// Every file written has the fingerprint of its contents on disk, and
+	// every page records it.
+	first := generate()
+	var paths []string
+	err := filepath.WalkDir(outDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(outDir, file)
+		if err != nil {
+			return err
+		}
+		p := filepath.ToSlash(rel)
+		switch p {
+		case manifestFile, changedFilesFile, deletedFilesFile, fingerprintsFile, writtenFile, optionsFile, modulesFile:
+			return nil
+		}
+		urlPath := fileURLPath(p)
+		paths = append(paths, urlPath)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fp, ok := first[urlPath]
+		if !ok {
+			t.Errorf("%s: no fingerprint", urlPath)
+			return nil
+		}
+		if got := contentHash(data, strings.HasSuffix(p, ".html")); got != fp {
+			t.Errorf("%s: fingerprint %s, want %s", urlPath, fp, got)
+		}
+		if strings.HasSuffix(p, ".html") && !strings.Contains(string(data), contentHashAttr+`="`+fp+`"`) {
+			t.Errorf("%s: page does not record its fingerprint %s", urlPath, fp)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != len(first) {
+		t.Errorf("got %d fingerprints for %d files", len(first), len(paths))
+	}
+	for _, p := range []string{"/", "/about/", "/example.com/m/a/", "/404.html", "/search-index.json"} {
+		if _, ok := first[p]; !ok {
+			t.Errorf("no fingerprint for %s", p)
+		}
+	}
+
+	// Changing the doc comment of a changes its page, the search index
+	// with its synopsis, and the list of the pages with both.
+	if err := os.WriteFile(filepath.Join(modDir, "a", "a.go"), []byte("// Package a does different things.\npackage a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	second := generate()
+	var changed []string
+	for p, fp := range second {
+		if first[p] != fp {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	if diff := cmp.Diff([]string{"/example.com/m/a/", "/pages.json", "/search-index.json"}, changed); diff != "" {
+		t.Errorf("changed fingerprints mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetContentHash(t *testing.T) {
+	page := []byte(`<!DOCTYPE html><html lang="en" data-pkgsite-base="../"><head></head><body>x</body></html>`)
+	blank, ok := setContentHash(page, "")
+	if !ok {
+		t.Fatal("no <html> start tag")
+	}
+	fp := contentHash(blank, true)
+	marked, _ := setContentHash(page, fp)
+	want := `<!DOCTYPE html><html lang="en" data-pkgsite-base="../" data-content-hash="` + fp + `"><head>`
+	if !strings.HasPrefix(string(marked), want) {
+		t.Errorf("got %s, want prefix %s", marked, want)
+	}
+	// The fingerprint of the page does not depend on the one it records.
+	if got := contentHash(marked, true); got != contentHash([]byte(strings.Replace(string(marked), fp, "", 1)), true) {
+		t.Errorf("fingerprint of marked page %s depends on the recorded one", got)
+	}
+	again, _ := setContentHash(marked, contentHash(marked, true))
+	if string(again) != string(marked) {
+		t.Errorf("marking twice changed the page:\n%s\n%s", marked, again)
+	}
+
+	if _, ok := setContentHash([]byte(`<p>fragment</p>`), fp); ok {
+		t.Error("got ok for a fragment without <html>")
+	}
+	// Files that do not record a fingerprint are hashed as they are.
+	if got, want := contentHash([]byte("<p>x</p>"), true), contentHash([]byte("<p>x</p>"), false); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestFileURLPath(t *testing.T) {
+	for _, test := range []struct{ in, want string }{
+		{"index.html", "/"},
+		{"example.com/m/index.html", "/example.com/m/"},
+		{"404.html", "/404.html"},
+		{"static/frontend/frontend.js", "/static/frontend/frontend.js"},
+	} {
+		if got := fileURLPath(test.in); got != test.want {
+			t.Errorf("fileURLPath(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+	"golang.org/x/net/html"
+)
+
+// With GenerateOptions.FingerprintAssets, the style sheets and scripts of the
+// site are named after their contents, as name.<hash>.ext, so that hosts
+// can serve them with immutable cache headers: a file that changes gets a
+// new name, and so do the files referring to it. Like the integrity
+// attributes of sri.go, the names are of the files as served, so the files
+// are renamed at the end of a run, once every file is written, and the
+// references of the pages are rewritten after that.
+//
+// A file is renamed after those it refers to, since its hash covers their
+// new names: a style sheet after those it imports, and a script moved out
+// of the pages (see strictcsp.go) after the scripts it loads. A file that
+// refers to itself through others, which no hash can cover, keeps its name.
+// asset-manifest.json maps the URL path of each renamed file to its new
+// one, for tools that refer to the files from outside the site.
+//
+// The fingerprinted files of a previous run that this run does not write
+// again are removed with the other stale files. The download bundles keep
+// the plain names, so they are written before the files are renamed.
+const (
+	assetManifestFile = "asset-manifest.json"
+	assetHashLen      = 8 // hex digits
+)
+
+// assetPathRE returns a regular expression matching the paths of style
+// sheets and scripts in scripts, such as "../static/frontend/frontend.js",
+// or "/base/static/frontend/frontend.js" where the paths from the root of
+// the host are under /base/. Group 1 is the path from the site root.
+// Scripts build their URLs in too many ways to resolve them as the pages
+// do, but they all name the files by their paths from the site root, after
+// a relative prefix or the base path.
+func assetPathRE(basePath string) *regexp.Regexp {
+	return regexp.MustCompile(`(?:^|[^\w./-])(?:(?:\.\.?/)*|` + regexp.QuoteMeta(basePath) + `)((?:static|third_party)/[\w./-]*\.(?:css|js))`)
+}
+
+// fingerprintAssets renames the style sheets and scripts of assets after
+// their contents, rewrites the references of the other files of out to
+// them, and writes the asset manifest. The paths from the root of the host
+// are under basePath.
+func fingerprintAssets(out *siteOutput, assets *assetGraph, basePath string) error {
+	re := assetPathRE(basePath)
+	contents := map[string][]byte{}
+	for p := range assets.files {
+		if ext := path.Ext(p); ext != ".css" && ext != ".js" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(out.dir, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		contents[p] = data
+	}
+	renamed := map[string]string{} // new paths of the renamed files, by old path
+	rename := func(target string) string { return renamed[target] }
+	order, kept := assetOrder(contents, re)
+	for _, p := range order {
+		file := filepath.Join(out.dir, filepath.FromSlash(p))
+		data := rewriteAssetRefs(p, contents[p], re, rename)
+		hashed := fingerprintedPath(p, out.normalize(file, data))
+		if hashed == p {
+			continue
+		}
+		if err := out.writeFile(filepath.Join(out.dir, filepath.FromSlash(hashed)), data); err != nil {
+			return err
+		}
+		out.forget(p)
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		renamed[p] = hashed
+	}
+	for _, p := range kept {
+		if data := rewriteAssetRefs(p, contents[p], re, rename); !bytes.Equal(data, contents[p]) {
+			if err := out.writeFile(filepath.Join(out.dir, filepath.FromSlash(p)), data); err != nil {
+				return err
+			}
+		}
+	}
+	assets.rename(renamed)
+	for _, p := range slices.Sorted(maps.Keys(out.written)) {
+		if path.Ext(p) != ".html" {
+			continue
+		}
+		file := filepath.Join(out.dir, filepath.FromSlash(p))
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		resolve := func(ref string) (string, bool) { return integrityTarget(p, ref, basePath) }
+		if rewritten := rewritePageAssets(data, re, resolve, rename); !bytes.Equal(rewritten, data) {
+			if err := out.writeFile(file, rewritten); err != nil {
+				return err
+			}
+		}
+	}
+	manifest := map[string]string{}
+	for old, p := range renamed {
+		manifest[fileURLPath(old)] = fileURLPath(p)
+	}
+	data, err := json.Marshal(&schema.AssetManifest{
+		SchemaVersion: schema.AssetManifestArtifact.Version.String(),
+		Assets:        manifest,
+	})
+	if err != nil {
+		return err
+	}
+	return out.writeFile(filepath.Join(out.dir, assetManifestFile), data)
+}
+
+// assetOrder returns the paths of contents, the style sheets and scripts
+// by path, in an order in which each comes after those it refers to, and
+// the paths of those that refer to themselves, directly or not, or to such
+// files, sorted.
+func assetOrder(contents map[string][]byte, re *regexp.Regexp) (order, kept []string) {
+	deps := map[string][]string{}
+	for p, data := range contents {
+		rewriteAssetRefs(p, data, re, func(target string) string {
+			if _, ok := contents[target]; ok && target != p && !slices.Contains(deps[p], target) {
+				deps[p] = append(deps[p], target)
+			}
+			return ""
+		})
+	}
+	done := map[string]bool{}
+	for {
+		var ready []string
+		for p := range contents {
+			if !done[p] && !slices.ContainsFunc(deps[p], func(d string) bool { return !done[d] }) {
+				ready = append(ready, p)
+			}
+		}
+		if len(ready) == 0 {
+			break
+		}
+		slices.Sort(ready)
+		for _, p := range ready {
+			done[p] = true
+		}
+		order = append(order, ready...)
+	}
+	for p := range contents {
+		if !done[p] {
+			kept = append(kept, p)
+		}
+	}
+	slices.Sort(kept)
+	return order, kept
+}
+
+// fingerprintedPath returns the path of the file at the slash-separated
+// path p, with contents data, named after its contents. The code moved out
+// of the pages is named after its contents already, as by
+// cspExternalizer.add, and keeps that form.
+func fingerprintedPath(p string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := path.Ext(p)
+	if path.Dir(p) == inlineCodeDir {
+		return inlineCodeDir + "/" + hex.EncodeToString(sum[:8]) + ext
+	}
+	return strings.TrimSuffix(p, ext) + "." + hex.EncodeToString(sum[:])[:assetHashLen] + ext
+}
+
+// renamedRef returns the reference ref with its file name replaced by that
+// of the file at the slash-separated path p.
+func renamedRef(ref, p string) string {
+	end := len(ref)
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		end = i
+	}
+	dir := ref[:strings.LastIndex(ref[:end], "/")+1]
+	return dir + path.Base(p) + ref[end:]
+}
+
+// rewriteAssetRefs returns the contents data of the style sheet or script
+// at the slash-separated path p with its references to the files that
+// rename returns a new path for renamed.
+func rewriteAssetRefs(p string, data []byte, re *regexp.Regexp, rename func(target string) string) []byte {
+	switch path.Ext(p) {
+	case ".css":
+		return rewriteCSSAssets(data, func(ref string) (string, bool) { return refTarget(p, ref), true }, rename)
+	case ".js":
+		return rewriteScriptAssets(data, re, rename)
+	}
+	return data
+}
+
+// rewriteCSSAssets returns the style sheet css with the url() and @import
+// references that resolve returns the target of, and rename a new path
+// for, renamed.
+func rewriteCSSAssets(css []byte, resolve func(ref string) (string, bool), rename func(target string) string) []byte {
+	for _, re := range []*regexp.Regexp{cssURLRE, cssImportRE} {
+		css = re.ReplaceAllFunc(css, func(m []byte) []byte {
+			sm := re.FindSubmatchIndex(m)
+			for i := 2; i < len(sm); i += 2 {
+				if sm[i] < 0 {
+					continue
+				}
+				ref := string(m[sm[i]:sm[i+1]])
+				if !isLocalReference(ref) {
+					return m
+				}
+				target, ok := resolve(ref)
+				if !ok {
+					return m
+				}
+				p := rename(target)
+				if p == "" {
+					return m
+				}
+				return slices.Concat(m[:sm[i]], []byte(renamedRef(ref, p)), m[sm[i+1]:])
+			}
+			return m
+		})
+	}
+	return css
+}
+
+// rewriteScriptAssets returns the script js with the paths of files
+// matched by re, built by assetPathRE, that rename returns a new path
+// for renamed.
+func rewriteScriptAssets(js []byte, re *regexp.Regexp, rename func(target string) string) []byte {
+	var buf []byte
+	last := 0
+	for _, m := range re.FindAllSubmatchIndex(js, -1) {
+		start, end := m[2], m[3]
+		if end < len(js) && isAssetPathByte(js[end]) {
+			continue // a longer path, such as that of a source map
+		}
+		p := rename(string(js[start:end]))
+		if p == "" {
+			continue
+		}
+		buf = append(buf, js[last:start]...)
+		buf = append(buf, p...)
+		last = end
+	}
+	if buf == nil {
+		return js
+	}
+	return append(buf, js[last:]...)
+}
+
+// isAssetPathByte reports whether c may be part of the paths matched by
+// assetPathRE.
+func isAssetPathByte(c byte) bool {
+	return c == '.' || c == '/' || c == '-' || c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// rewritePageAssets returns the HTML document data with the references to
+// the files that rename returns a new path for renamed: the src and href
+// attributes that resolve returns the target of, and the paths of the
+// inline scripts and style sheets. The rest of the document is kept byte
+// for byte.
+func rewritePageAssets(data []byte, re *regexp.Regexp, resolve func(ref string) (string, bool), rename func(target string) string) []byte {
+	z := html.NewTokenizer(bytes.NewReader(data))
+	var buf bytes.Buffer
+	rawText := "" // the element whose text the next text token is, if raw
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return data
+			}
+			return buf.Bytes()
+		}
+		raw := append([]byte(nil), z.Raw()...)
+		switch tt {
+		case html.TextToken:
+			switch rawText {
+			case "script":
+				raw = rewriteScriptAssets(raw, re, rename)
+			case "style":
+				raw = rewriteCSSAssets(raw, resolve, rename)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			rawText = ""
+			if tt == html.StartTagToken && (tok.Data == "script" || tok.Data == "style") {
+				rawText = tok.Data
+			}
+			changed := false
+			for i, a := range tok.Attr {
+				if a.Namespace != "" || a.Key != "src" && a.Key != "href" {
+					continue
+				}
+				target, ok := resolve(a.Val)
+				if !ok {
+					continue
+				}
+				if p := rename(target); p != "" {
+					tok.Attr[i].Val = renamedRef(a.Val, p)
+					changed = true
+				}
+			}
+			if changed {
+				buf.WriteString(tok.String())
+				continue
+			}
+		default:
+			rawText = ""
+		}
+		buf.Write(raw)
+	}
+}
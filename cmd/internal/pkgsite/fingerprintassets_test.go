@@ -0,0 +1,193 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+func TestAssetOrder(t *testing.T) {
+	contents := map[string][]byte{
+		"static/a.css":       []byte(`@import url('./b.css'); body { background: url(img/x.png) }`),
+		"static/b.css":       []byte(`@import "../third_party/c.css";`),
+		"third_party/c.css":  []byte(`p {}`),
+		"static/inline/d.js": []byte(`loadScript(new URL("static/e.js",base).href); // static/e.js.map`),
+		"static/e.js":        []byte(`x()`),
+		"static/x.js":        []byte(`import("./y.js"); load("static/y.js")`),
+		"static/y.js":        []byte(`load("static/x.js")`),
+		"static/z.js":        []byte(`load("static/x.js")`),
+	}
+	order, kept := assetOrder(contents, assetPathRE("/"))
+	wantOrder := []string{"static/e.js", "third_party/c.css", "static/b.css", "static/inline/d.js", "static/a.css"}
+	if diff := cmp.Diff(wantOrder, order); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"static/x.js", "static/y.js", "static/z.js"}, kept); diff != "" {
+		t.Errorf("kept mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRewriteAssetRefs(t *testing.T) {
+	renamed := map[string]string{
+		"static/b.css":      "static/b.12345678.css",
+		"third_party/c.css": "third_party/c.87654321.css",
+		"static/e.js":       "static/e.abcdef01.js",
+	}
+	rename := func(target string) string { return renamed[target] }
+	re := assetPathRE("/docs/")
+	for _, test := range []struct {
+		p, in, want string
+	}{
+		{
+			"static/a.css",
+			`@import url('./b.css?v=1'); @import "../third_party/c.css"; body { background: url(b.css#x) url(data:x) }`,
+			`@import url('./b.12345678.css?v=1'); @import "../third_party/c.87654321.css"; body { background: url(b.12345678.css#x) url(data:x) }`,
+		},
+		{
+			"static/inline/d.js",
+			`loadScript(new URL("static/e.js",base).href); f('../static/e.js', "/docs/static/e.js", "/other/static/e.js", "static/e.js.map", "xstatic/e.js")`,
+			`loadScript(new URL("static/e.abcdef01.js",base).href); f('../static/e.abcdef01.js', "/docs/static/e.abcdef01.js", "/other/static/e.js", "static/e.js.map", "xstatic/e.js")`,
+		},
+		{"static/e.js", `static/e.js`, `static/e.abcdef01.js`},
+		{"static/f.svg", `static/e.js`, `static/e.js`},
+	} {
+		if got := string(rewriteAssetRefs(test.p, []byte(test.in), re, rename)); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.p, got, test.want)
+		}
+	}
+}
+
+func TestRewritePageAssets(t *testing.T) {
+	renamed := map[string]string{
+		"static/x.css": "static/x.12345678.css",
+		"static/x.js":  "static/x.abcdef01.js",
+	}
+	const page = `<!DOCTYPE html><html><head>` +
+		`<link rel="stylesheet" href="../static/x.css?v=1"/>` +
+		`<link rel="icon" href="../static/x.svg"/>` +
+		`<script src="/docs/static/x.js" defer></script>` +
+		`<script>loadScript('../static/x.js'); var s = "<a href=../static/x.js>";</script>` +
+		`<style>@import url("../static/x.css");</style>` +
+		`</head><body><p class=x>../static/x.js</p><a href="https://example.com/static/x.js">x</a></body></html>`
+	resolve := func(ref string) (string, bool) { return integrityTarget("m/index.html", ref, "/docs/") }
+	got := string(rewritePageAssets([]byte(page), assetPathRE("/docs/"), resolve, func(target string) string { return renamed[target] }))
+	want := `<!DOCTYPE html><html><head>` +
+		`<link rel="stylesheet" href="../static/x.12345678.css?v=1"/>` +
+		`<link rel="icon" href="../static/x.svg"/>` +
+		`<script src="/docs/static/x.abcdef01.js" defer="">` + `</script>` +
+		`<script>loadScript('../static/x.abcdef01.js'); var s = "<a href=../static/x.abcdef01.js>";</script>` +
+		`<style>@import url("../static/x.12345678.css");</style>` +
+		`</head><body><p class=x>../static/x.js</p><a href="https://example.com/static/x.js">x</a></body></html>`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGenerateStaticSiteFingerprintAssets(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`)
+	outDir := t.TempDir()
+	generate := func(opts GenerateOptions) *schema.AssetManifest {
+		t.Helper()
+		opts.OutDir, opts.BasePath, opts.FingerprintAssets = outDir, "/docs/", true
+		cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+		report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.MissingAssets) > 0 {
+			t.Errorf("missing assets: %v", report.MissingAssets)
+		}
+		data, err := os.ReadFile(filepath.Join(outDir, assetManifestFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := schema.DecodeAssetManifest(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	first := generate(GenerateOptions{})
+	m := generate(GenerateOptions{StrictCSP: true, SubresourceIntegrity: true, ColorScheme: "dark"})
+
+	const style = "/static/frontend/frontend.min.css"
+	if first.Assets[style] == "" || m.Assets[style] == "" || first.Assets[style] == m.Assets[style] {
+		t.Errorf("%s: fingerprinted as %q, then as %q with a color scheme; want two names", style, first.Assets[style], m.Assets[style])
+	}
+	for old, p := range first.Assets {
+		if p == m.Assets[old] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p))); err == nil {
+			t.Errorf("%s: the file of the first run is left", p)
+		}
+	}
+	for old, p := range m.Assets {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(old))); err == nil {
+			t.Errorf("%s: the file is left under its name", old)
+		}
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if want := "/" + fingerprintedPath(old[1:], data); p != want {
+			t.Errorf("%s: named %s, want %s", old, p, want)
+		}
+	}
+
+	// Every style sheet and script that the pages and the scripts moved out
+	// of them name is there.
+	refRE := regexp.MustCompile(`((?:static|third_party)/[\w./-]*\.(?:css|js))(?:[^\w./-]|$)`)
+	pages := 0
+	err := filepath.WalkDir(outDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(outDir, file)
+		rel = filepath.ToSlash(rel)
+		if filepath.Ext(file) == ".html" {
+			pages++
+		} else if !strings.HasPrefix(rel, inlineCodeDir+"/") {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		for _, m := range refRE.FindAllStringSubmatch(string(data), -1) {
+			if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(m[1]))); err != nil {
+				t.Errorf("%s: refers to %s, which is missing", rel, m[1])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages == 0 {
+		t.Fatal("no pages")
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+	"golang.org/x/net/html"
+)
+
+// Some modules never change, such as archived ones, and yet take long to
+// fetch and render on every run. The modules of GenerateOptions.Frozen are
+// not loaded at all: their files are copied as they are from the output
+// of a previous run, in GenerateOptions.FrozenFrom or, if it is empty, in the
+// output directory itself, after checking them against the manifest there.
+//
+// Every run records in modulesFile what each module contributed to the
+// site: its units, its files and pages, its entries in the search index,
+// the imports of its packages, from which the imported-by pages of the
+// other packages are made, and the texts of its licenses, whose pages the
+// modules share; see licensetexts.go. A frozen module contributes what was
+// recorded for it, so that the search index, the imported-by pages, the
+// links from other modules to its pages and the checks and files made
+// from every page, such as the link check and the sitemap, are as if it
+// had been generated; its pages are read back for their links and ids.
+// Its record is carried over to the record of the run, so that it can
+// stay frozen.
+//
+// The aggregates made from every module, such as the sitemap and the
+// search index, are thus made from the records of the frozen modules with
+// what the others contribute, as they are by a run that generates every
+// module. Each record holds the hash of its contents: a module whose record
+// does not match it, or whose record cannot be read at all, is not frozen
+// but generated again, if the run loads it, so that no aggregate is made
+// from a corrupt record.
+//
+// A frozen page is left as the run that generated it wrote it, with the
+// assets and the links to other modules of that time: generate the module
+// again once the options that affect pages change, or the modules it
+// links to move. Freezing a module that the previous output has no record
+// of is an error.
+const modulesFile = ".pkgsite-modules.json"
+
+// What a module contributed to a site is recorded in modulesFile as
+// defined by package schema, from which package sitequery answers the
+// queries of tools about the site.
+type (
+	moduleContribution = schema.ModuleRecord
+	recordedPage       = schema.PageRecord
+)
+
+// errCorruptRecord is the error of a record of the modules that cannot be
+// decoded.
+var errCorruptRecord = errors.New("corrupt record")
+
+// readModulesFile returns the contributions recorded in the output
+// directory dir, by module path, or nil if there is no record.
+func readModulesFile(dir string) (map[string]*moduleContribution, error) {
+	data, err := os.ReadFile(filepath.Join(dir, modulesFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	modules, err := schema.DecodeModules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", filepath.Join(dir, modulesFile), errCorruptRecord, err)
+	}
+	return modules.Modules, nil
+}
+
+// recordSum returns the hash of the record c without its Sum.
+func recordSum(c *moduleContribution) (string, error) {
+	rec := *c
+	rec.Sum = ""
+	data, err := json.Marshal(&rec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// recordIntact reports whether the record c holds the hash of its contents.
+func recordIntact(c *moduleContribution) bool {
+	sum, err := recordSum(c)
+	return err == nil && sum == c.Sum
+}
+
+// frozenModules returns the contributions of the modules of paths recorded
+// in the output directory from, and the modules of paths whose records are
+// corrupt, sorted, which the run must generate again. It warns about the
+// corrupt records to logw. The contributions are nil only if paths is
+// empty.
+func frozenModules(paths []string, from string, logw io.Writer) (frozen map[string]*moduleContribution, corrupt []string, err error) {
+	if len(paths) == 0 {
+		return nil, nil, nil
+	}
+	recorded, err := readModulesFile(from)
+	if errors.Is(err, errCorruptRecord) {
+		fmt.Fprintf(logw, "Warning: %v; generating the frozen modules again\n", err)
+		return map[string]*moduleContribution{}, slices.Sorted(slices.Values(paths)), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	frozen = map[string]*moduleContribution{}
+	for _, p := range paths {
+		c, ok := recorded[p]
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot freeze %s: %s has no record of its pages from a previous run", p, from)
+		}
+		if !recordIntact(c) {
+			fmt.Fprintf(logw, "Warning: the record of frozen module %s in %s is corrupt; generating it again\n", p, from)
+			corrupt = append(corrupt, p)
+			continue
+		}
+		if err := checkRecordPaths(c); err != nil {
+			fmt.Fprintf(logw, "Warning: the record of frozen module %s in %s is corrupt: %v; generating it again\n", p, from, err)
+			corrupt = append(corrupt, p)
+			continue
+		}
+		frozen[p] = c
+	}
+	sort.Strings(corrupt)
+	return frozen, corrupt, nil
+}
+
+// checkRecordPaths checks that the files and pages that c records are at
+// site paths within the output directory, as checkSitePath has them.
+func checkRecordPaths(c *moduleContribution) error {
+	for _, f := range c.Files {
+		if err := checkSitePath(f); err != nil {
+			return err
+		}
+	}
+	for _, pg := range c.Pages {
+		if err := checkSitePath(pg.File); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutFrozen returns dirs without the frozen modules, leaving out the
+// directories with no other module.
+func withoutFrozen(dirs map[string][]frontend.LocalModule, frozen map[string]*moduleContribution) map[string][]frontend.LocalModule {
+	kept := map[string][]frontend.LocalModule{}
+	for dir, modules := range dirs {
+		modules = slices.DeleteFunc(slices.Clone(modules), func(m frontend.LocalModule) bool {
+			return frozen[m.ModulePath] != nil
+		})
+		if len(modules) > 0 {
+			kept[dir] = modules
+		}
+	}
+	return kept
+}
+
+// frozenLocalModules returns the frozen modules as listed on the homepage.
+func frozenLocalModules(frozen map[string]*moduleContribution) []frontend.LocalModule {
+	var modules []frontend.LocalModule
+	for _, p := range slices.Sorted(maps.Keys(frozen)) {
+		modules = append(modules, frontend.LocalModule{ModulePath: p, Dir: frozen[p].Dir})
+	}
+	return modules
+}
+
+// copyFrozen copies the files of the frozen modules from the output
+// directory from to out, checking them against the manifest there, and
+// hands the events of their pages to consumers.
+func copyFrozen(from string, frozen map[string]*moduleContribution, out *siteOutput, consumers pageConsumers) error {
+	manifest, err := readManifest(filepath.Join(from, manifestFile))
+	if err != nil {
+		return err
+	}
+	for _, mod := range slices.Sorted(maps.Keys(frozen)) {
+		c := frozen[mod]
+		pages := map[string]recordedPage{}
+		for _, pg := range c.Pages {
+			pages[pg.File] = pg
+		}
+		for _, p := range c.Files {
+			src, err := outputPath(from, p)
+			if err != nil {
+				return fmt.Errorf("frozen module %s: %w", mod, err)
+			}
+			data, err := os.ReadFile(src)
+			if err != nil {
+				return fmt.Errorf("frozen module %s: %w", mod, err)
+			}
+			sum := sha256.Sum256(data)
+			if manifest[p] != hex.EncodeToString(sum[:]) {
+				return fmt.Errorf("frozen module %s: %s is not as the manifest of %s records it", mod, p, from)
+			}
+			file, err := outputPath(out.dir, p)
+			if err != nil {
+				return fmt.Errorf("frozen module %s: %w", mod, err)
+			}
+			if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+				return err
+			}
+			if err := out.writeFile(file, data); err != nil {
+				return err
+			}
+			pg, ok := pages[p]
+			if !ok {
+				continue
+			}
+			ev := &pageEvent{
+				URLPath:  pg.URLPath,
+				File:     p,
+				Size:     len(out.normalize(p, data)),
+				HTML:     pg.HTML,
+				Redirect: pg.Redirect,
+				Tab:      pg.Tab,
+				Source:   pg.Source,
+				Frozen:   true,
+			}
+			if pg.HTML {
+				doc, err := html.Parse(bytes.NewReader(data))
+				if err != nil {
+					return fmt.Errorf("frozen module %s: %s: %w", mod, p, err)
+				}
+				summarizePage(doc, ev)
+			}
+			if err := consumers.consumePage(ev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// A moduleRecorder is a pageConsumer that records the contributions of
+// the modules of a run, to be written to modulesFile.
+type moduleRecorder struct {
+	modules map[string]*moduleContribution
+	units   map[string]string // the module path of each unit with pages
+	frozen  map[string]*moduleContribution
+}
+
+// newModuleRecorder returns a recorder of the modules, generating their
+// units, and of the frozen modules. The modules have the modification
+// times of lastMods, by module path; see moduleLastMods.
+func newModuleRecorder(modules []frontend.LocalModule, units []*siteUnit, lastMods map[string]time.Time, frozen map[string]*moduleContribution) *moduleRecorder {
+	r := &moduleRecorder{
+		modules: map[string]*moduleContribution{},
+		units:   map[string]string{},
+		frozen:  frozen,
+	}
+	for _, m := range modules {
+		c := &moduleContribution{Dir: m.Dir}
+		if t, ok := lastMods[m.ModulePath]; ok {
+			t = t.UTC()
+			c.LastMod = &t
+		}
+		r.modules[m.ModulePath] = c
+	}
+	for _, u := range units {
+		c, ok := r.modules[u.meta.ModulePath]
+		if !ok {
+			c = &moduleContribution{}
+			r.modules[u.meta.ModulePath] = c
+		}
+		c.Units = append(c.Units, u.path)
+		if u.version == "" {
+			c.Version = u.meta.Version
+		}
+		r.units[u.path] = u.meta.ModulePath
+	}
+	for mod, c := range frozen {
+		for _, u := range c.Units {
+			r.units[u] = mod
+		}
+	}
+	return r
+}
+
+// addPackage records the search entry and imports of the package u.
+func (r *moduleRecorder) addPackage(u *siteUnit, entry schema.SearchEntry, imports []string) {
+	c := r.modules[u.meta.ModulePath]
+	c.Search = append(c.Search, entry)
+	if len(imports) > 0 {
+		if c.Imports == nil {
+			c.Imports = map[string][]string{}
+		}
+		c.Imports[u.meta.Path] = imports
+	}
+}
+
+// addLicenseTexts records the texts of the licenses of the module mod,
+// by hash, whose pages its licenses pages link to.
+func (r *moduleRecorder) addLicenseTexts(mod string, texts map[string]string) {
+	if c := r.modules[mod]; c != nil {
+		c.LicenseTexts = texts
+	}
+}
+
+// moduleOf returns the module whose unit holds the file at the
+// slash-separated path p, if any.
+func (r *moduleRecorder) moduleOf(p string) (string, bool) {
+	for d := path.Dir(p); d != "."; d = path.Dir(d) {
+		if mod, ok := r.units[d]; ok {
+			return mod, true
+		}
+	}
+	return "", false
+}
+
+func (r *moduleRecorder) consumePage(ev *pageEvent) error {
+	if ev.Frozen {
+		return nil
+	}
+	mod, ok := r.moduleOf(ev.File)
+	if !ok || r.frozen[mod] != nil {
+		return nil
+	}
+	c := r.modules[mod]
+	c.Pages = append(c.Pages, recordedPage{
+		URLPath:  ev.URLPath,
+		File:     ev.File,
+		HTML:     ev.HTML,
+		Redirect: ev.Redirect,
+		Tab:      ev.Tab,
+		Source:   ev.Source,
+	})
+	return nil
+}
+
+func (r *moduleRecorder) finish(context.Context, *siteOutput) error { return nil }
+
+// write writes the record of the modules, whose files are among written,
+// to the output directory dir.
+func (r *moduleRecorder) write(dir string, written map[string]string) error {
+	for p := range written {
+		if mod, ok := r.moduleOf(p); ok && r.frozen[mod] == nil {
+			c := r.modules[mod]
+			c.Files = append(c.Files, p)
+		}
+	}
+	record := map[string]*moduleContribution{}
+	for mod, c := range r.modules {
+		sort.Strings(c.Units)
+		sort.Strings(c.Files)
+		sort.Slice(c.Pages, func(i, j int) bool { return c.Pages[i].File < c.Pages[j].File })
+		sort.Slice(c.Search, func(i, j int) bool { return c.Search[i].Path < c.Search[j].Path })
+		record[mod] = c
+	}
+	maps.Copy(record, r.frozen)
+	for _, c := range record {
+		sum, err := recordSum(c)
+		if err != nil {
+			return err
+		}
+		c.Sum = sum
+	}
+	data, err := json.MarshalIndent(&schema.Modules{
+		SchemaVersion: schema.ModulesArtifact.Version.String(),
+		Modules:       record,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeSiteFile(filepath.Join(dir, modulesFile), append(data, '\n'))
+}
@@ -0,0 +1,374 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// frozenTxtar is a module a that imports a module b.
+const frozenTxtar = `
+-- a/go.mod --
+module example.com/a
+
+go 1.21
+
+require example.com/b v0.0.0
+
+replace example.com/b => ../b
+-- a/a.go --
+// Package a is archived.
+package a
+
+import "example.com/b"
+
+// F returns a [b.T].
+func F() b.T { return b.T{} }
+-- b/go.mod --
+module example.com/b
+
+go 1.21
+-- b/LICENSE --
+` + testhelper.BSD0License + `
+-- b/b.go --
+// Package b is alive.
+package b
+
+// T is a type.
+type T struct{}
+`
+
+func TestGenerateStaticSiteFrozen(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, frozenTxtar)
+	outDir := t.TempDir()
+	generate := func(frozen ...string) (*Report, error) {
+		return GenerateStaticSiteWithOptions(context.Background(), ServerConfig{
+			Paths:         []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")},
+			UseListedMods: true,
+		}, GenerateOptions{OutDir: outDir, Frozen: frozen})
+	}
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// Without a previous run, there is nothing to copy.
+	if _, err := generate("example.com/a"); err == nil || !strings.Contains(err.Error(), "cannot freeze example.com/a") {
+		t.Fatalf("got %v, want an error about freezing example.com/a", err)
+	}
+
+	if _, err := generate(); err != nil {
+		t.Fatal(err)
+	}
+	before := read("example.com/a/index.html")
+
+	// The frozen module is not loaded: a change to it, even one that
+	// breaks it, does not show.
+	if err := os.WriteFile(filepath.Join(dir, "a", "a.go"), []byte("// Package a changed.\npackage a\n\nfunc ("), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b", "b.go"), []byte("// Package b changed.\npackage b\n\n// T is a type.\ntype T struct{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := generate("example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.Frozen, []string{"example.com/a"}) {
+		t.Errorf("got frozen modules %v, want [example.com/a]", report.Frozen)
+	}
+	if len(report.BrokenLinks) > 0 {
+		t.Errorf("broken links: %v", report.BrokenLinks)
+	}
+	if got := read("example.com/a/index.html"); got != before {
+		t.Error("the page of the frozen module changed")
+	}
+	if !strings.Contains(read("example.com/b/index.html"), "Package b changed.") {
+		t.Error("the page of example.com/b was not generated again")
+	}
+	// The aggregates still hold what the frozen module contributed.
+	if !strings.Contains(read(searchIndexFile), `"example.com/a"`) {
+		t.Error("search index lacks example.com/a")
+	}
+	if !strings.Contains(read("example.com/b/importedby/index.html"), "example.com/a") {
+		t.Error("imported-by page of example.com/b lacks example.com/a")
+	}
+	if !strings.Contains(read("index.html"), "example.com/a") {
+		t.Error("homepage lacks example.com/a")
+	}
+	modules, err := readModulesFile(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := modules["example.com/a"]; c == nil || !slices.Contains(c.Files, "example.com/a/index.html") {
+		t.Errorf("record of example.com/a was not carried over: %+v", c)
+	}
+
+	// A frozen file that is not as the manifest records it is not copied.
+	if err := os.WriteFile(filepath.Join(outDir, "example.com", "a", "index.html"), []byte("edited"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generate("example.com/a"); err == nil || !strings.Contains(err.Error(), "is not as the manifest") {
+		t.Errorf("got %v, want an error about the manifest", err)
+	}
+}
+
+// TestGenerateStaticSiteFrozenAggregates checks that the files made from
+// every module, such as the sitemap and the search index, are as a full
+// run writes them, whichever modules are frozen.
+func TestGenerateStaticSiteFrozenAggregates(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	// The go command rejects -mod=mod in workspace mode.
+	t.Setenv("GOFLAGS", "")
+	// The modules are those of a workspace, whose modules are loaded
+	// from their own directories however many are frozen. Two of them
+	// share the text of their license.
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.work --
+go 1.21
+
+use (
+	./a
+	./b
+	./c
+)
+-- a/go.mod --
+module example.com/a
+
+go 1.21
+-- a/LICENSE --
+`+testhelper.MITLicense+`
+-- a/a.go --
+// Package a uses b.
+package a
+
+import "example.com/b"
+
+// F returns a [b.T].
+func F() b.T { return b.T{} }
+-- b/go.mod --
+module example.com/b
+
+go 1.21
+-- b/LICENSE --
+`+testhelper.BSD0License+`
+-- b/b.go --
+// Package b is used.
+package b
+
+// T is a type.
+type T struct{}
+-- c/go.mod --
+module example.com/c
+
+go 1.21
+-- c/LICENSE --
+`+testhelper.MITLicense+`
+-- c/c.go --
+// Package c uses b too.
+package c
+
+import "example.com/b"
+
+// V is a [b.T].
+var V b.T
+`)
+	modules := []string{"example.com/a", "example.com/b", "example.com/c"}
+	// Each module has files of its own time, for the sitemap.
+	for i, m := range []string{"a", "b", "c"} {
+		mtime := time.Date(2024, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC)
+		for _, f := range []string{"go.mod", "LICENSE", m + ".go"} {
+			if err := os.Chtimes(filepath.Join(dir, m, f), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	generate := func(outDir string, frozen ...string) *Report {
+		t.Helper()
+		report, err := GenerateStaticSiteWithOptions(context.Background(), ServerConfig{
+			Workspace:     dir,
+			UseListedMods: true,
+			SiteURL:       "https://example.com/docs",
+		}, GenerateOptions{OutDir: outDir, Sitemap: true, Frozen: frozen})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+	fullDir := t.TempDir()
+	generate(fullDir)
+	files := func(dir string) map[string]string {
+		t.Helper()
+		m := map[string]string{}
+		err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return err
+			}
+			switch p := filepath.ToSlash(rel); p {
+			// The options record frozen modules.
+			case changedFilesFile, deletedFilesFile, optionsFile:
+			default:
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return err
+				}
+				m[p] = string(data)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	want := files(fullDir)
+	if !strings.Contains(want[sitemapFile], "<lastmod>2024-03-01T00:00:00Z</lastmod>") {
+		t.Fatalf("the sitemap has no time of example.com/c:\n%s", want[sitemapFile])
+	}
+	var texts []string
+	for p := range want {
+		if strings.HasPrefix(p, licenseTextsDir+"/") {
+			texts = append(texts, p)
+		}
+	}
+	if len(texts) != 2 {
+		t.Fatalf("a full run writes the license texts %v, want two", texts)
+	}
+	check := func(outDir string) {
+		t.Helper()
+		got := files(outDir)
+		for _, p := range slices.Sorted(maps.Keys(want)) {
+			if got[p] != want[p] {
+				t.Errorf("%s differs from that of a full run:\n%s", p, cmp.Diff(want[p], got[p]))
+			}
+		}
+		for p := range got {
+			if _, ok := want[p]; !ok {
+				t.Errorf("%s is not written by a full run", p)
+			}
+		}
+	}
+
+	// Every set of frozen modules recombines to the same files.
+	for set := 1; set < 1<<len(modules); set++ {
+		var frozen []string
+		for i, m := range modules {
+			if set&(1<<i) != 0 {
+				frozen = append(frozen, m)
+			}
+		}
+		t.Run(strings.Join(frozen, ","), func(t *testing.T) {
+			outDir := t.TempDir()
+			if err := copyDir(fullDir, outDir); err != nil {
+				t.Fatal(err)
+			}
+			report := generate(outDir, frozen...)
+			if !slices.Equal(report.Frozen, frozen) {
+				t.Errorf("got frozen modules %v, want %v", report.Frozen, frozen)
+			}
+			check(outDir)
+		})
+	}
+	// A corrupt record is not used: its module is generated again.
+	corrupt := func(t *testing.T, outDir string, edit func(string) string) {
+		t.Helper()
+		if err := copyDir(fullDir, outDir); err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(outDir, modulesFile)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(edit(string(data))), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Run("corrupt record", func(t *testing.T) {
+		outDir := t.TempDir()
+		corrupt(t, outDir, func(s string) string {
+			return strings.Replace(s, "Package a uses b.", "Package a uses nothing.", 1)
+		})
+		report := generate(outDir, "example.com/a", "example.com/c")
+		if !slices.Equal(report.Frozen, []string{"example.com/c"}) {
+			t.Errorf("got frozen modules %v, want [example.com/c]", report.Frozen)
+		}
+		check(outDir)
+	})
+	t.Run("corrupt file", func(t *testing.T) {
+		outDir := t.TempDir()
+		corrupt(t, outDir, func(s string) string { return s[:len(s)/2] })
+		report := generate(outDir, "example.com/a", "example.com/c")
+		if len(report.Frozen) > 0 {
+			t.Errorf("got frozen modules %v, want none", report.Frozen)
+		}
+		check(outDir)
+	})
+	// So is a record of files outside the output directory, even if its
+	// hash matches.
+	t.Run("record outside the output directory", func(t *testing.T) {
+		outDir := t.TempDir()
+		corrupt(t, outDir, func(s string) string {
+			modules, err := schema.DecodeModules([]byte(s))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := modules.Modules["example.com/a"]
+			c.Files = append(c.Files, "../outside.html")
+			c.Pages = append(c.Pages, recordedPage{File: "../outside.html", HTML: true})
+			if c.Sum, err = recordSum(c); err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(modules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(data)
+		})
+		report := generate(outDir, "example.com/a", "example.com/c")
+		if !slices.Equal(report.Frozen, []string{"example.com/c"}) {
+			t.Errorf("got frozen modules %v, want [example.com/c]", report.Frozen)
+		}
+		check(outDir)
+	})
+	// A module that the run does not load cannot be generated again.
+	t.Run("corrupt record of a module not loaded", func(t *testing.T) {
+		outDir := t.TempDir()
+		corrupt(t, outDir, func(s string) string {
+			return strings.Replace(s, "Package c uses b too.", "Package c uses a.", 1)
+		})
+		_, err := GenerateStaticSiteWithOptions(context.Background(), ServerConfig{}, GenerateOptions{
+			OutDir: outDir,
+			Frozen: []string{"example.com/c"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "its record in "+outDir+" is corrupt") {
+			t.Errorf("got %v, want an error about the corrupt record of example.com/c", err)
+		}
+	})
+}
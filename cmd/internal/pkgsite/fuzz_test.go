@@ -0,0 +1,378 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// The documentation of third-party modules is written by their authors, so
+// the rewriting of pages and assets is fuzzed. Each fuzz target checks its
+// invariants in a check function, which a test also runs on a fixed number
+// of mutations of the seeds, so that plain "go test" exercises more than
+// the seeds. The corpus of interesting inputs is in testdata/fuzz.
+
+// maxGrowth bounds the size of rewritten output: at most maxGrowth times
+// the size of the input, plus the fragments added to <head>.
+const (
+	maxGrowth     = 8
+	maxHeadGrowth = 1024
+)
+
+// fuzzTokens are spliced into the seeds by mutate.
+var fuzzTokens = []string{
+	"<", ">", `"`, "'", "/", "\\", "..", "%2e", "%2E%2e", "\t", "\x00", "\xff", "é",
+	"/static/", "/third_party/", `"/static/`, "(/static/", "../",
+	`<a href="/`, `<img src="/`, `<form action="/`, `<object data="/`,
+	`<meta http-equiv="Content-Security-Policy" content="default-src *">`,
+	"<!--pkgsite:begin csp-->", "<!--pkgsite:end csp-->", "<!--", "-->",
+	"<script>", "</script>", `<script type="application/ld+json">`, "<style>", "</style>",
+	"<svg>", "<math>", "<template>", "<noscript>", "<title>", "<head>", "</head>", "<body>",
+	"xn--bcher-kva.example/lib", "bücher.example",
+}
+
+// mutate returns n deterministic mutations of the seeds.
+func mutate(seeds []string, n int) []string {
+	r := rand.New(rand.NewPCG(1, 2))
+	var ms []string
+	for range n {
+		s := seeds[r.IntN(len(seeds))]
+		for range 1 + r.IntN(4) {
+			i := 0
+			if len(s) > 0 {
+				i = r.IntN(len(s) + 1)
+			}
+			switch r.IntN(4) {
+			case 0: // insert a token
+				s = s[:i] + fuzzTokens[r.IntN(len(fuzzTokens))] + s[i:]
+			case 1: // delete a run
+				j := min(len(s), i+r.IntN(16))
+				s = s[:i] + s[j:]
+			case 2: // replace a byte
+				if i < len(s) {
+					s = s[:i] + string(rune(r.IntN(128))) + s[i+1:]
+				}
+			case 3: // duplicate a run
+				j := min(len(s), i+r.IntN(64))
+				s = s[:j] + s[i:j] + s[j:]
+			}
+		}
+		ms = append(ms, s)
+	}
+	return ms
+}
+
+// fuzzIterations is the number of mutations the tests of the fuzz targets
+// check.
+func fuzzIterations() int {
+	if testing.Short() {
+		return 200
+	}
+	return 2000
+}
+
+// pageSeeds returns small documents and the pages of testdata/rewrite, as
+// seeds of the page fuzz targets. With corpus set, it also returns the
+// pages of the corpus of FuzzProcessHTML, which the fuzz target reads
+// itself.
+func pageSeeds(t testing.TB, corpus bool) []string {
+	seeds := []string{
+		"",
+		`<html><head><title>T</title></head><body><a href="/example.com/m">m</a></body></html>`,
+		`<a href="/../../etc/passwd">x</a><img src="/%2e%2e/%2E%2E/x"><a href="/..\..\x">y</a>`,
+		`<script>loadScript("/static/frontend/x.js")</script><style>a{background:url(/static/x.svg)}</style>`,
+		`<head><meta http-equiv="content-security-policy" content="default-src *"></head>`,
+		"<p>\xff\xfe</p><a href=\"/a\x80\">x</a>",
+	}
+	files, err := filepath.Glob(filepath.Join("testdata", "rewrite", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeds = append(seeds, string(data))
+	}
+	if !corpus {
+		return seeds
+	}
+	files, err = filepath.Glob(filepath.Join("testdata", "fuzz", "FuzzProcessHTML", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The second line of an entry is its content, as a []byte
+		// conversion of a Go string literal.
+		lines := strings.Split(string(data), "\n")
+		if len(lines) < 2 || !strings.HasPrefix(lines[1], "[]byte(") {
+			t.Fatalf("%s: not a corpus entry of FuzzProcessHTML", file)
+		}
+		page, err := strconv.Unquote(strings.TrimSuffix(strings.TrimPrefix(lines[1], "[]byte("), ")"))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		seeds = append(seeds, page)
+	}
+	return seeds
+}
+
+var fuzzURLPaths = []string{"/", "/about", "/example.com/m", "/example.com/m/a/b"}
+
+func FuzzProcessHTML(f *testing.F) {
+	for i, s := range pageSeeds(f, false) {
+		f.Add([]byte(s), fuzzURLPaths[i%len(fuzzURLPaths)])
+	}
+	f.Fuzz(checkProcessHTML)
+}
+
+func TestProcessHTMLMutations(t *testing.T) {
+	for i, s := range mutate(pageSeeds(t, true), fuzzIterations()) {
+		checkProcessHTML(t, []byte(s), fuzzURLPaths[i%len(fuzzURLPaths)])
+	}
+}
+
+// checkProcessHTML checks the invariants of processing the page content at
+// urlPath: the result is valid UTF-8, has one Content-Security-Policy, does
+// not grow without bound, is unchanged by processing it again, and has no
+// link, rewritten from an absolute path, that leaves the site.
+func checkProcessHTML(t *testing.T, content []byte, urlPath string) {
+	if !strings.HasPrefix(urlPath, "/") || strings.ContainsAny(urlPath, "?#\\") || path.Clean(urlPath) != urlPath {
+		return
+	}
+	got, err := processHTML(content, urlPath, nil)
+	if err != nil {
+		return
+	}
+	if !utf8.Valid(got) {
+		t.Fatalf("processHTML(%q, %q) is not valid UTF-8: %q", content, urlPath, got)
+	}
+	if len(got) > maxGrowth*len(content)+maxHeadGrowth {
+		t.Fatalf("processHTML(%q, %q) grew from %d to %d bytes", content, urlPath, len(content), len(got))
+	}
+	doc, err := html.Parse(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countCSP(doc); n != 1 {
+		t.Fatalf("processHTML(%q, %q) has %d Content-Security-Policy elements:\n%s", content, urlPath, n, got)
+	}
+	again, err := processHTML(got, urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, got) {
+		t.Fatalf("processing %q at %q again changes it:\n%s\nto\n%s", content, urlPath, got, again)
+	}
+
+	// The links that were relative before processing are the content's
+	// own; the others must stay on the site.
+	in, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return
+	}
+	relative := map[string]bool{}
+	for _, v := range urlAttrValues(in) {
+		relative[v] = true
+	}
+	depth := strings.Count(strings.TrimPrefix(urlPath, "/"), "/") + 1
+	if urlPath == "/" {
+		depth = 0
+	}
+	for _, v := range urlAttrValues(doc) {
+		if !relative[v] && escapesRoot(v, depth) {
+			t.Fatalf("processHTML(%q, %q) links outside the site: %q", content, urlPath, v)
+		}
+	}
+}
+
+// countCSP returns the number of Content-Security-Policy <meta> elements
+// of the document.
+func countCSP(n *html.Node) int {
+	count := 0
+	if n.Type == html.ElementNode && n.Namespace == "" && n.Data == "meta" && strings.EqualFold(strings.TrimSpace(attrValue(n, "http-equiv")), "content-security-policy") {
+		count++
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		count += countCSP(c)
+	}
+	return count
+}
+
+// urlAttrValues returns the relative URLs of the URL-valued attributes of
+// the document.
+func urlAttrValues(n *html.Node) []string {
+	var vals []string
+	if n.Type == html.ElementNode {
+		for _, a := range n.Attr {
+			if r, ok := urlAttrRule(n, a); ok {
+				mapURLs(r, a.Val, func(u string) string {
+					if !hasScheme.MatchString(u) && !strings.HasPrefix(u, "/") {
+						vals = append(vals, u)
+					}
+					return u
+				})
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		vals = append(vals, urlAttrValues(c)...)
+	}
+	return vals
+}
+
+var hasScheme = regexp.MustCompile(`^[\t\n\r ]*[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+// escapesRoot reports whether the relative URL ref, resolved as a browser
+// does from a page depth directories below the root of the site, leaves it.
+func escapesRoot(ref string, depth int) bool {
+	ref = strings.Map(func(r rune) rune {
+		switch r {
+		case '\t', '\n', '\r':
+			return -1
+		case '\\':
+			return '/'
+		}
+		return r
+	}, ref)
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		ref = ref[:i]
+	}
+	if strings.HasPrefix(ref, "/") {
+		return true // it leaves the base path of the site
+	}
+	segs := strings.Split(ref, "/")
+	for i, seg := range segs {
+		switch strings.ToLower(seg) {
+		case "..", ".%2e", "%2e.", "%2e%2e":
+			depth--
+			if depth < 0 {
+				return true
+			}
+		case ".", "%2e":
+		default:
+			if i < len(segs)-1 {
+				depth++
+			}
+		}
+	}
+	return false
+}
+
+func FuzzRelativizeScriptText(f *testing.F) {
+	for _, s := range []string{
+		`loadScript("/static/frontend/x.js")`,
+		`import x from '/third_party/dialog-polyfill/dialog-polyfill.esm.js';`,
+		`fetch("/static//static/"); a = '/static/' + "/third_party/"`,
+		"",
+	} {
+		f.Add(s, uint8(2))
+	}
+	f.Fuzz(checkRelativizeScriptText)
+}
+
+func TestRelativizeScriptTextMutations(t *testing.T) {
+	seeds := []string{`loadScript("/static/frontend/x.js")`, `a = '/third_party/x' + "/static/"`}
+	for i, s := range mutate(seeds, fuzzIterations()) {
+		checkRelativizeScriptText(t, s, uint8(i%6))
+	}
+}
+
+// checkRelativizeScriptText checks that rewriting script in a page depth
+// directories below the root keeps it valid UTF-8, does not grow it without
+// bound, leaves no absolute asset path, points its references at the root
+// of the site, and is idempotent.
+func checkRelativizeScriptText(t *testing.T, script string, depth uint8) {
+	// Pages are a few directories deep.
+	if depth > 8 {
+		return
+	}
+	prefix := relativePrefix("/" + strings.TrimSuffix(strings.Repeat("d/", int(depth)), "/"))
+	got := relativizeScriptText(script, prefix)
+	if utf8.ValidString(script) && !utf8.ValidString(got) {
+		t.Fatalf("relativizeScriptText(%q, %q) is not valid UTF-8: %q", script, prefix, got)
+	}
+	if len(got) > 4*len(script) {
+		t.Fatalf("relativizeScriptText(%q, %q) grew from %d to %d bytes", script, prefix, len(script), len(got))
+	}
+	for _, s := range []string{`"/static/`, `'/static/`, `"/third_party/`, `'/third_party/`} {
+		if strings.Contains(got, s) {
+			t.Fatalf("relativizeScriptText(%q, %q) = %q, which contains %s", script, prefix, got, s)
+		}
+	}
+	if again := relativizeScriptText(got, prefix); again != got {
+		t.Fatalf("relativizeScriptText(%q, %q) = %q, and again %q", script, prefix, got, again)
+	}
+	// A reference to an asset leads to it from the directory of the page.
+	marked := relativizeScriptText(script+`"/static/x`, prefix)
+	ref := marked[strings.LastIndexByte(marked, '"')+1:]
+	if p := path.Join(strings.Repeat("d/", int(depth)), ref); p != "static/x" {
+		t.Fatalf("relativizeScriptText(%q, %q) points /static/x at %s", script, prefix, p)
+	}
+}
+
+func FuzzAbsoluteToRelativeAsset(f *testing.F) {
+	for _, s := range []string{
+		`.a { background: url(/static/shared/icon/search.svg); }`,
+		`.b { background: url("/third_party/x.png"); } .c { content: '/static/'; }`,
+		`import x from "/static/frontend/x.js";`,
+	} {
+		f.Add([]byte(s), "static/frontend/homepage/homepage.css")
+	}
+	f.Add([]byte(`url(/static/a)`), "a.css")
+	f.Fuzz(checkAbsoluteToRelativeAsset)
+}
+
+func TestAbsoluteToRelativeAssetMutations(t *testing.T) {
+	seeds := []string{`.a { background: url(/static/a.svg); } .b { content: "/third_party/" }`}
+	files := []string{"a.css", "static/a.css", "static/frontend/homepage/homepage.css"}
+	for i, s := range mutate(seeds, fuzzIterations()) {
+		checkAbsoluteToRelativeAsset(t, []byte(s), files[i%len(files)])
+	}
+}
+
+// checkAbsoluteToRelativeAsset checks that rewriting the asset at filePath
+// keeps it valid UTF-8, does not grow it without bound, points its
+// references at the root of the site, and is idempotent.
+func checkAbsoluteToRelativeAsset(t *testing.T, content []byte, filePath string) {
+	// Assets are copied from file systems, whose paths are valid; the
+	// deepest is a few directories deep.
+	if !fs.ValidPath(filePath) || strings.Count(filePath, "/") > 8 {
+		return
+	}
+	got := absoluteToRelativeAsset(content, filePath)
+	if utf8.Valid(content) && !utf8.Valid(got) {
+		t.Fatalf("absoluteToRelativeAsset(%q, %q) is not valid UTF-8: %q", content, filePath, got)
+	}
+	if len(got) > 4*len(content) {
+		t.Fatalf("absoluteToRelativeAsset(%q, %q) grew from %d to %d bytes", content, filePath, len(content), len(got))
+	}
+	if again := absoluteToRelativeAsset(got, filePath); !bytes.Equal(again, got) {
+		t.Fatalf("absoluteToRelativeAsset(%q, %q) = %q, and again %q", content, filePath, got, again)
+	}
+	// A reference to an asset leads to it from the directory of the file.
+	marked := absoluteToRelativeAsset(append(bytes.Clone(content), `"/static/x`...), filePath)
+	ref := string(marked[bytes.LastIndexByte(marked, '"')+1:])
+	if p := path.Join(path.Dir(filePath), ref); p != "static/x" {
+		t.Fatalf("absoluteToRelativeAsset(%q, %q) points /static/x at %s", content, filePath, p)
+	}
+}
@@ -8,20 +8,29 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/fs"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/net/html"
 
+	"github.com/wow-look-at-my/static-pkgsite/internal"
 	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
 	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+	pagepkg "github.com/wow-look-at-my/static-pkgsite/internal/frontend/page"
 	"github.com/wow-look-at-my/static-pkgsite/internal/log"
+	"github.com/wow-look-at-my/static-pkgsite/internal/version"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
 	"github.com/wow-look-at-my/static-pkgsite/static"
 	thirdparty "github.com/wow-look-at-my/static-pkgsite/third_party"
 )
@@ -33,7 +42,7 @@ const cspContent = `default-src 'self'; ` +
 	`style-src 'self' 'unsafe-inline'; ` +
 	`img-src 'self' data:; ` +
 	`font-src 'self'; ` +
-	`connect-src 'none'; ` +
+	`connect-src 'self'; ` +
 	`frame-src 'none'; ` +
 	`object-src 'none'; ` +
 	`base-uri 'none'`
@@ -46,112 +55,1294 @@ const cspContent = `default-src 'self'; ` +
 // to relative paths so the site works when served from any directory, including
 // GitHub Pages project subpaths.
 func GenerateStaticSite(ctx context.Context, serverCfg ServerConfig, outDir string) error {
-	// Build the server and get the getters/modules for package enumeration.
-	result, err := buildServerAndGetters(ctx, serverCfg)
+	_, err := GenerateStaticSiteReport(ctx, serverCfg, outDir)
+	return err
+}
+
+// GenerateStaticSiteReport is like GenerateStaticSite, but also returns a
+// report on the generated site. Pages that fail to render are left out and
+// listed in the report. If opts.Strict is set, they also make it
+// return a *PageFailuresError, along with the report, as references to
+// paths from the root of the host in the output make it return a
+// *RootPathsError.
+func GenerateStaticSiteReport(ctx context.Context, serverCfg ServerConfig, outDir string) (*Report, error) {
+	return GenerateStaticSiteWithOptions(ctx, serverCfg, GenerateOptions{OutDir: outDir})
+}
+
+// generateStaticSite is GenerateStaticSiteWithOptions with a set of
+// consumers that receive an event for every page written.
+func generateStaticSite(ctx context.Context, serverCfg ServerConfig, opts GenerateOptions, consumers pageConsumers) (*Report, error) {
+	serverCfg, outDir, err := opts.apply(serverCfg)
+	if err != nil {
+		return nil, err
+	}
+	logw := serverCfg.logOutput()
+	format, _ := outputFormat(outDir, opts.Format) // checked by apply
+	dir := outDir
+	switch {
+	case format != formatDir:
+		// The site is packed from a temporary directory; see outformat.go.
+		dir, err = os.MkdirTemp("", "pkgsite-site-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+	case opts.Atomic:
+		dir, err = stageOutDir(outDir)
+		if err != nil {
+			return nil, fmt.Errorf("copying the output directory: %w", err)
+		}
+		// Once the run succeeds, the staging directory is renamed; until
+		// then, even if the run panics, it is removed.
+		defer os.RemoveAll(dir)
+	}
+	report, err := generateSite(ctx, serverCfg, opts, dir, consumers)
+	if err != nil {
+		return nil, err
+	}
+	failure := strictFailure(opts, report)
+	if format != formatDir {
+		if failure != nil {
+			fmt.Fprintf(logw, "Left %s as it was, as the site failed its checks\n", outDir)
+			return report, failure
+		}
+		if err := writeSiteArchive(dir, outDir, format); err != nil {
+			return nil, fmt.Errorf("writing the output archive: %w", err)
+		}
+		fmt.Fprintf(logw, "Static site written to %s\n", outDir)
+		return report, nil
+	}
+	if opts.Atomic {
+		if failure != nil {
+			fmt.Fprintf(logw, "Left %s as it was, as the site failed its checks\n", outDir)
+			return report, failure
+		}
+		if err := replaceDir(dir, outDir); err != nil {
+			return nil, fmt.Errorf("replacing the output directory: %w", err)
+		}
+	}
+	fmt.Fprintf(logw, "Static site generated in %s\n", outDir)
+	return report, failure
+}
+
+// strictFailure returns the error failing a run with opts in strict
+// mode, given its report, or nil: a *PageFailuresError if pages failed, or
+// else a *RootPathsError if the output has paths from the root.
+func strictFailure(opts GenerateOptions, report *Report) error {
+	switch {
+	case !opts.Strict:
+		return nil
+	case len(report.FailedPages) > 0:
+		return &PageFailuresError{Pages: report.FailedPages}
+	case len(report.RootPaths) > 0:
+		return &RootPathsError{Paths: report.RootPaths}
+	}
+	return nil
+}
+
+// generateSite writes the site of a generation with serverCfg and opts,
+// which have been checked and applied, to outDir, and returns its report.
+// Pages that fail to render are listed in the report, even in strict mode.
+func generateSite(ctx context.Context, serverCfg ServerConfig, opts GenerateOptions, outDir string, consumers pageConsumers) (*Report, error) {
+	r, err := newSiteRun(serverCfg, opts, outDir, consumers)
+	if err != nil {
+		return nil, err
+	}
+	for _, phase := range []func(context.Context) error{
+		r.enumerate,
+		r.addConsumers,
+		r.planPages,
+		r.loadAggregates,
+		r.render,
+		r.writeExports,
+		r.writeAssets,
+	} {
+		if err := phase(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return r.finish(ctx)
+}
+
+// A siteRun holds the state of a generation as it goes through its
+// phases, in the order generateSite runs them:
+//
+//   - enumerate loads the modules and lists the units of the site, and
+//     those that get pages;
+//   - addConsumers sets up the consumers of the page events, which make
+//     the checks and files that span pages, such as the link check and
+//     the sitemap;
+//   - planPages lists the pages besides those of the units, such as the
+//     tab pages and the source pages;
+//   - loadAggregates loads the data that spans pages, such as the search
+//     index and the importers of each package;
+//   - render writes the pages, each transformed by the page transforms of
+//     the features that apply to it;
+//   - writeExports writes the other documents of each unit, such as their
+//     Markdown;
+//   - writeAssets writes the assets of the site, and the page of the
+//     third-party notices, which lists those written;
+//   - finish has the consumers write their files, makes the changes that
+//     need the whole output, records the run for the next, and returns the
+//     report.
+type siteRun struct {
+	cfg     ServerConfig
+	opts    GenerateOptions
+	outDir  string
+	logw    io.Writer
+	started time.Time // for the time budget
+	site    pagepkg.SiteData
+	out     *siteOutput
+	options optionsRecord
+
+	// Set up from the configuration before any module is loaded.
+	moduleSettings moduleSettingsIndex
+	branding       *siteBranding
+	staticPages    *siteStaticPages
+	diagramScript  []byte
+	highlighter    *highlighter
+	filter         *unitFilter
+	frozenFrom     string   // the output directory the frozen modules are copied from
+	corrupt        []string // the frozen modules generated again
+
+	// Set by enumerate.
+	result        *buildResult
+	mux           *http.ServeMux
+	units         []*siteUnit     // all units of the loaded modules
+	left          map[string]bool // the units filtered out by path
+	paths         []string        // the canonical paths of the units of the site, frozen or not
+	selected      []*siteUnit     // the units generated, of units
+	versionUnits  []*siteUnit     // the versioned units
+	pageUnits     []*siteUnit     // the units that get pages: selected and versionUnits
+	versioned     map[string]bool // the canonical paths of the modules with versions
+	unitSet       map[string]bool // the canonical paths of the units with pages
+	failedModules []FailedPage    // the pages of the modules failing their checks
+
+	// Set by addConsumers.
+	consumers pageConsumers
+	checker   *linkChecker
+	recorder  *moduleRecorder
+	lister    *pageLister
+	inliner   *imageInliner
+	shaker    *assetShaker
+	checks    []unitCheck // the checks of the units with pages
+
+	// Set by planPages.
+	tabPaths          map[string]bool
+	tabLinks          map[string]string
+	unindexedTabLinks map[string]string // tabLinks without the symbol indexes
+	indexPages        map[string][]string
+	sources           []sourcePage
+	sourceLinks       map[string]string
+	downloads         bool // whether modules get download bundles
+	shareTexts        bool // whether the texts of licenses get pages
+
+	// Set by loadAggregates.
+	index       searchIndex
+	sharedTexts map[string]string
+
+	// Set by render.
+	workers       int
+	prog          *progressTracker
+	budget        *timeBudget
+	pages         *pageRenderer
+	total         int // the pages of the run, for progress
+	brand         pageTransform
+	search        pageTransform
+	selfLinks     pageTransform
+	leftOut       pageTransform
+	unlinked      pageTransform
+	inline        pageTransform
+	linkedMu      sync.Mutex
+	linkedSources map[string]bool // by package path
+	linkedBundles map[string]bool // by module path
+
+	// Set by writeAssets.
+	assets *assetGraph
+}
+
+// newSiteRun returns the run of a generation with serverCfg and opts to
+// outDir, which hands the page events to consumers. The settings have been
+// checked by apply; the files they name, such as those of the branding,
+// and the records of the frozen modules are read before any module is
+// loaded.
+func newSiteRun(serverCfg ServerConfig, opts GenerateOptions, outDir string, consumers pageConsumers) (*siteRun, error) {
+	r := &siteRun{
+		cfg:       serverCfg,
+		opts:      opts,
+		outDir:    outDir,
+		logw:      serverCfg.logOutput(),
+		started:   budgetClock(),
+		consumers: consumers,
+	}
+	var err error
+	r.site, err = siteData(serverCfg.SiteName, serverCfg.SiteURL, serverCfg.basePath)
+	if err != nil {
+		return nil, err
+	}
+	r.moduleSettings, err = newModuleSettingsIndex(opts.ModuleSettings)
+	if err != nil {
+		return nil, err
+	}
+	r.branding, err = newSiteBranding(opts.Branding)
+	if err != nil {
+		return nil, err
+	}
+	r.branding.scheme, err = newColorScheme(opts.ColorScheme)
+	if err != nil {
+		return nil, err
+	}
+	r.staticPages, err = newSiteStaticPages(opts.StaticPages)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DiagramScript != "" {
+		r.diagramScript, err = os.ReadFile(opts.DiagramScript)
+		if err != nil {
+			return nil, fmt.Errorf("reading diagram script: %w", err)
+		}
+	}
+	r.highlighter, err = newHighlighter(opts.HighlightTheme, opts.HighlightCSS)
+	if err != nil {
+		return nil, err
+	}
+	r.filter, err = newUnitFilter(opts.IncludeGlobs, opts.ExcludeGlobs, opts.NoInternal)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Smoke {
+		err = prepareSmokeOutDir(outDir)
+	} else {
+		err = removeSmokeMarker(outDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.out, err = newSiteOutput(outDir, opts.Force, opts.CRLF)
+	if err != nil {
+		return nil, fmt.Errorf("reading the files of the previous run: %w", err)
+	}
+	r.out.precompress = opts.Precompress
+	r.out.minify = opts.Minify
+	if opts.StrictCSP {
+		r.out.external = newCSPExternalizer()
+	}
+	r.options, err = newOptionsRecord(serverCfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	// The records of the frozen modules are read before any module is
+	// loaded, so that freezing one without a record fails fast.
+	r.frozenFrom = opts.FrozenFrom
+	if r.frozenFrom == "" {
+		r.frozenFrom = outDir
+	}
+	r.cfg.frozen, r.corrupt, err = frozenModules(opts.Frozen, r.frozenFrom, r.logw)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// enumerate builds the server, and lists the units of its modules and
+// those of them that get pages.
+func (r *siteRun) enumerate(ctx context.Context) error {
+	cfg := &r.cfg
+	var err error
+	r.result, err = buildServerAndGetters(ctx, *cfg)
 	if err != nil {
 		return fmt.Errorf("building server: %w", err)
 	}
+	// The settings and filters naming a module by a path that its go.mod
+	// file does not declare apply to the declared path; see modpath.go.
+	if len(r.result.Renamed) > 0 {
+		r.moduleSettings = r.moduleSettings.rename(r.result.Renamed)
+		r.filter, err = newUnitFilter(renamePatterns(r.opts.IncludeGlobs, r.result.Renamed), renamePatterns(r.opts.ExcludeGlobs, r.result.Renamed), r.opts.NoInternal)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Install all routes on a ServeMux.
-	mux := http.NewServeMux()
-	result.Server.Install(mux.Handle, nil, nil)
+	r.mux = http.NewServeMux()
+	r.result.Server.Install(r.mux.Handle, nil, nil)
+	if !r.opts.SkipNotFoundPage {
+		r.mux.Handle("GET "+notFoundURLPath, http.HandlerFunc(r.result.Server.ServeNotFound))
+	}
 
 	// Enumerate all package/directory paths from the loaded modules.
-	paths, err := enumerateUnitPaths(ctx, result.Getters, result.AllModules)
+	units, err := enumerateUnits(ctx, r.result.Getters, r.result.AllModules, r.result.LoadOptions)
 	if err != nil {
 		return fmt.Errorf("enumerating packages: %w", err)
 	}
+	// A frozen module with a corrupt record is generated again, which it
+	// cannot be if the run does not load it.
+	for _, mod := range r.corrupt {
+		if !slices.ContainsFunc(units, func(u *siteUnit) bool { return u.meta.ModulePath == mod }) {
+			return fmt.Errorf("cannot freeze %s: its record in %s is corrupt, and the run does not load it to generate it again", mod, r.frozenFrom)
+		}
+	}
+	// Units filtered out by path are as if the modules did not have them.
+	units, r.left = r.filter.filter(units)
+	if cfg.Stdlib && !cfg.StdlibInternal {
+		units = dropStdlibInternal(units, r.left)
+	}
+	if len(r.left) > 0 {
+		fmt.Fprintf(r.logw, "Leaving out %d units filtered by path\n", len(r.left))
+	}
+	r.units = units
+	r.paths = unitPaths(units)
+	// The units of frozen modules are linked to as the others are.
+	if len(cfg.frozen) > 0 {
+		for _, c := range cfg.frozen {
+			r.paths = append(r.paths, c.Units...)
+		}
+		sort.Strings(r.paths)
+	}
+
+	// A smoke test generates one unit per module.
+	r.selected = units
+	if r.opts.Smoke {
+		r.selected = smokeUnits(units)
+	}
+
+	// A module rendered from other contents than its units were enumerated
+	// from fails in strict mode, and is warned about otherwise.
+	mismatches := checkModuleGetters(ctx, units, func(ctx context.Context, modulePath string) (fetch.ModuleGetter, *fetch.LazyModule, error) {
+		return r.result.DataSource.ModuleGetter(ctx, modulePath, version.Latest)
+	})
+	for _, m := range mismatches {
+		if !r.opts.Strict {
+			fmt.Fprintf(r.logw, "Warning: %v\n", m)
+			continue
+		}
+		r.selected = slices.DeleteFunc(slices.Clone(r.selected), func(u *siteUnit) bool {
+			if u.meta.ModulePath != m.modulePath {
+				return false
+			}
+			r.failedModules = append(r.failedModules, FailedPage{URLPath: "/" + u.path, Error: m.Error()})
+			return true
+		})
+	}
+
+	// The versions of modules get pages of their own, filtered like the
+	// unversioned units.
+	if len(r.result.Versions) > 0 && !r.opts.Smoke {
+		r.versionUnits, err = enumerateVersionUnits(ctx, r.result.Versions, r.result.LoadOptions)
+		if err != nil {
+			return fmt.Errorf("enumerating versions: %w", err)
+		}
+		r.versionUnits = slices.DeleteFunc(r.versionUnits, func(u *siteUnit) bool {
+			if r.filter.keeps(u.unversionedPath()) {
+				return false
+			}
+			r.left[u.unversionedPath()] = true
+			return true
+		})
+	}
+	r.versioned = map[string]bool{}
+	for _, g := range r.result.Versions {
+		r.versioned[canonicalUnitPath(g.modulePath)] = true
+	}
+	r.pageUnits = slices.Concat(r.selected, r.versionUnits)
+	r.unitSet = map[string]bool{}
+	for _, p := range r.paths {
+		r.unitSet[p] = true
+	}
+	for _, u := range r.versionUnits {
+		r.unitSet[u.path] = true
+	}
+	return nil
+}
+
+// addConsumers sets up the consumers of the page events, besides those
+// that generateSite was given, and the checks of the units with pages.
+func (r *siteRun) addConsumers(context.Context) error {
+	cfg := &r.cfg
+	r.checker = newLinkChecker(r.units, r.selected)
+	r.checker.addFrozen(cfg.frozen)
+	r.consumers = append(pageConsumers{r.checker}, r.consumers...)
+	r.consumers = append(r.consumers, newIDChecker(r.logw))
+	// The times of the modules are recorded whether or not there is a
+	// sitemap, for a later run with a sitemap that freezes them.
+	lastMods, err := moduleLastMods(r.result.AllModules)
+	if err != nil {
+		return fmt.Errorf("finding modification times: %w", err)
+	}
+	r.recorder = newModuleRecorder(r.result.AllModules, r.pageUnits, lastMods, cfg.frozen)
+	r.lister = newPageLister(r.staticPages.urlPaths, r.recorder)
+	r.consumers = append(r.consumers, r.recorder, r.lister)
 
+	if r.opts.Sitemap {
+		if cfg.SiteURL == "" {
+			fmt.Fprintf(r.logw, "Warning: not writing %s, which needs a site URL\n", sitemapFile)
+		} else {
+			lastMod := sitemapLastMods(lastMods, r.units, cfg.frozen)
+			capTimes(lastMod, r.opts.BuildTime)
+			r.consumers = append(r.consumers, newSitemapWriter(cfg.SiteURL, lastMod))
+		}
+	}
+
+	if r.opts.Prefetch > 0 {
+		r.consumers = append(r.consumers, newPrefetcher(r.opts.Prefetch, r.units))
+	}
+
+	// Small images are inlined into the pages.
+	if r.opts.InlineSmallImages > 0 {
+		r.inliner = newImageInliner(r.mux, r.opts.InlineSmallImages)
+		r.inline = r.inliner.transform()
+		r.consumers = append(r.consumers, r.inliner)
+	}
+	r.consumers = append(r.consumers, r.branding.scheme)
+	if !r.opts.CopyAllAssets {
+		components, err := thirdparty.Components()
+		if err != nil {
+			return err
+		}
+		r.shaker = newAssetShaker(r.site.BasePath, components)
+		r.consumers = append(r.consumers, r.shaker)
+	}
+
+	if r.opts.PlatformDivergence || r.opts.PlatformTable || len(r.opts.FailOnDivergence) > 0 {
+		r.checks = append(r.checks, newDivergenceCheck(len(r.pageUnits), r.opts.FailOnDivergence, r.opts.PlatformTable, r.opts.PlatformDivergence || len(r.opts.FailOnDivergence) > 0))
+	}
+	if r.opts.EmptyDocMinExported >= 0 {
+		r.checks = append(r.checks, newEmptyDocCheck(len(r.pageUnits), r.opts.EmptyDocMinExported, r.opts.EmptyDocNote))
+	}
+	return nil
+}
+
+// planPages lists the pages that the units get besides their own: their
+// tab pages, the pages of their symbol indexes and of their source files,
+// and the pages of the texts of their licenses and their download bundles,
+// unless a unit has the path of one of them.
+func (r *siteRun) planPages(ctx context.Context) error {
+	cfg := &r.cfg
+	var clashes []string
+	r.tabPaths, r.tabLinks, clashes = tabPages(r.unitSet, r.pageUnits, r.versioned)
+	for _, p := range clashes {
+		fmt.Fprintf(r.logw, "Warning: not writing the %s page of %s, which would have the path of package %s\n", path.Base(p), path.Dir(p), p)
+	}
+
+	// Modules get download bundles, unless a unit has their directory.
+	r.downloads = r.opts.DownloadBundles
+	for p := range r.unitSet {
+		if r.downloads && (p == downloadsDir || strings.HasPrefix(p, downloadsDir+"/")) {
+			fmt.Fprintf(r.logw, "Warning: not writing download bundles, whose directory would hold package %s\n", p)
+			r.downloads = false
+		}
+	}
+
+	// The texts of licenses get pages of their own, unless a unit has
+	// their directory.
+	r.shareTexts = true
+	for p := range r.unitSet {
+		if r.shareTexts && (p == path.Dir(licenseTextsDir) || p == licenseTextsDir || strings.HasPrefix(p, licenseTextsDir+"/")) {
+			fmt.Fprintf(r.logw, "Warning: not sharing the texts of licenses, whose directory would hold package %s\n", p)
+			r.shareTexts = false
+		}
+	}
+	if r.shareTexts {
+		r.checker.addDir(licenseTextsDir)
+	}
+
+	// Modules get the pages of their symbol indexes.
+	r.unindexedTabLinks = r.tabLinks
+	if cfg.SymbolIndex {
+		r.unindexedTabLinks = maps.Clone(r.tabLinks)
+		var indexLinks map[string]string
+		r.indexPages, indexLinks, clashes = symbolIndexPages(ctx, r.result.DataSource, r.unitSet, r.pageUnits, symbolIndexPageSize(*cfg))
+		for _, p := range clashes {
+			fmt.Fprintf(r.logw, "Warning: not writing the symbol index with a page at the path of package %s\n", p)
+		}
+		maps.Copy(r.tabLinks, indexLinks)
+	}
+
+	// Packages of local modules get pages for their source files.
+	if r.opts.SourcePages {
+		var skipped []string
+		r.sources, r.sourceLinks, skipped, clashes = sourcePages(ctx, r.unitSet, r.pageUnits, r.opts.MaxSourceSize)
+		for _, p := range clashes {
+			fmt.Fprintf(r.logw, "Warning: not writing the source pages of %s, which would have the path of package %s\n", path.Dir(p), p)
+		}
+		for _, f := range skipped {
+			fmt.Fprintf(r.logw, "Warning: not writing the source page of %s, which is larger than %d bytes\n", f, r.opts.MaxSourceSize)
+		}
+	}
+	return nil
+}
+
+// loadAggregates loads each package once for the data that spans pages:
+// its entry in the search index, and its imports, from which the data
+// source reports the importers of packages on their imported-by pages. It
+// also loads the licenses of the modules for the pages of their texts.
+// Frozen modules contribute what they did when they were generated.
+func (r *siteRun) loadAggregates(ctx context.Context) error {
+	importedBy := map[string][]string{}
+	for _, u := range r.selected {
+		if !u.meta.IsPackage() {
+			continue
+		}
+		unit, err := u.module.Unit(ctx, u.meta.Path)
+		if err != nil {
+			log.Errorf(ctx, "loading %s: %v", u.path, err)
+			continue
+		}
+		r.index.add(u, unit)
+		r.recorder.addPackage(u, r.index.entries[len(r.index.entries)-1], unit.Imports)
+		for _, p := range unit.Imports {
+			importedBy[p] = append(importedBy[p], u.meta.Path)
+		}
+	}
+	for _, c := range r.cfg.frozen {
+		r.index.entries = append(r.index.entries, c.Search...)
+		for importer, imports := range c.Imports {
+			for _, p := range imports {
+				importedBy[p] = append(importedBy[p], importer)
+			}
+		}
+	}
+	for _, importers := range importedBy {
+		sort.Strings(importers)
+	}
+	r.lister.setSynopses(r.index.entries)
+	r.result.DataSource.SetImportedBy(importedBy)
+
+	if r.shareTexts {
+		var moduleTexts map[string]map[string]string
+		r.sharedTexts, moduleTexts = licenseTexts(ctx, r.result.DataSource, r.pageUnits, r.tabPaths)
+		for mod, texts := range moduleTexts {
+			r.recorder.addLicenseTexts(mod, texts)
+		}
+		for _, c := range r.cfg.frozen {
+			maps.Copy(r.sharedTexts, c.LicenseTexts)
+		}
+	}
+	return nil
+}
+
+// render copies the files of the frozen modules, and writes the pages of
+// the site: the homepage, the static pages and the not-found page, the
+// pages of the units and their tabs, the pages of the license texts, and
+// the source pages.
+func (r *siteRun) render(ctx context.Context) error {
+	cfg := &r.cfg
 	// Count total pages for progress reporting.
-	staticPages := []string{"/about", "/license-policy", "/search-help"}
-	total := 1 + len(staticPages) + len(paths) // homepage + static pages + unit pages
-	current := 0
+	r.total = 1 + len(r.staticPages.urlPaths) + len(r.pageUnits) + len(r.tabPaths) + len(r.sources) + len(r.sharedTexts) // homepage + static pages + unit pages + tab pages + source pages + license texts
+	for _, urls := range r.indexPages {
+		r.total += len(urls)
+	}
+	if !r.opts.SkipNotFoundPage {
+		r.total++
+	}
+	r.total++ // third-party notices
 
-	progress := func(urlPath string) {
-		current++
-		fmt.Fprintf(os.Stderr, "  [%d/%d] %s\n", current, total, urlPath)
+	// The pages of units and source files are rendered by workers, which
+	// take turns writing them and handing them to the consumers.
+	r.workers = limitWorkers(r.logw, r.opts.Workers)
+	reporter, err := r.opts.progressReporter(r.logw)
+	if err != nil {
+		return err
+	}
+	r.prog = newProgressTracker(reporter, r.workers, r.started)
+	if r.workers > 1 {
+		r.consumers = pageConsumers{&lockedConsumer{c: r.consumers}}
 	}
 
-	fmt.Fprintf(os.Stderr, "Generating %d pages...\n", total)
+	// Over its time budget, the run gives up features of the pages it has
+	// left, estimating their time as the progress reporter does; see
+	// budget.go.
+	r.budget = newTimeBudget(r.opts.TimeBudget, r.started, r.prog.estimate, r.logw)
+	r.budget.plan(degradeUnitPages, len(r.pageUnits)+len(r.tabPaths))
+	r.budget.plan(degradeSourcePages, len(r.sources))
+	for _, urls := range r.indexPages {
+		r.budget.plan(degradeSymbolIndex, len(urls))
+	}
+	if r.opts.Archive {
+		r.budget.plan(degradeArchives, 1)
+	}
+	if r.downloads {
+		for _, u := range r.pageUnits {
+			if isBundledUnit(u) {
+				r.budget.plan(degradeArchives, 1)
+			}
+		}
+	}
+
+	if len(cfg.frozen) > 0 {
+		fmt.Fprintf(r.logw, "Copying the files of %d frozen modules from %s...\n", len(cfg.frozen), r.frozenFrom)
+		if err := copyFrozen(r.frozenFrom, cfg.frozen, r.out, r.consumers); err != nil {
+			return fmt.Errorf("copying frozen modules: %w", err)
+		}
+	}
+
+	r.prog.startPhase(r.total)
+	r.pages = &pageRenderer{mux: r.mux, out: r.out, consumers: r.consumers, progress: r.prog, failed: r.failedModules}
+	r.brand = r.branding.transform()
+	r.search = searchTransform()
+	if r.opts.NoClientSearch {
+		r.search = searchFallbackTransform(r.opts.SearchFallback)
+	}
+	r.leftOut = leftOutLinksTransform(r.unitSet, r.left)
+	if !r.opts.AbsoluteSelfLinks {
+		r.selfLinks = selfLinksTransform(cfg.SiteURL, sitePageSet(r.staticPages, r.pageUnits, r.tabPaths, r.indexPages, r.sources, cfg.frozen))
+	}
+	// The footer links to the page of third-party notices before the links
+	// to disabled pages are removed, in case it is one of them.
+	r.unlinked = joinTransforms(attributionsLinkTransform(), r.staticPages.linksTransform())
+
+	if err := r.renderSitePages(ctx); err != nil {
+		return err
+	}
+	if err := r.renderUnits(ctx); err != nil {
+		return err
+	}
+	// Render the pages of the texts of the licenses.
+	for _, hash := range slices.Sorted(maps.Keys(r.sharedTexts)) {
+		if err := r.pages.stopped(ctx, r.total); err != nil {
+			return err
+		}
+		p := "/" + licenseTextsDir + "/" + hash
+		r.prog.next(p)
+		r.pages.renderAt(ctx, attributionsFrame, p, r.transforms(licenseTextTransform(r.sharedTexts[hash]))...)
+	}
+	if err := r.renderSources(ctx); err != nil {
+		return err
+	}
+	// Workers fail pages in no particular order.
+	if r.workers > 1 {
+		sort.SliceStable(r.pages.failed, func(i, j int) bool { return r.pages.failed[i].URLPath < r.pages.failed[j].URLPath })
+	}
+	return nil
+}
+
+// transforms returns the transforms of a page: those of every page, with
+// the given ones, which may be nil, before the last of them.
+func (r *siteRun) transforms(page ...pageTransform) []pageTransform {
+	return slices.Concat([]pageTransform{r.brand, r.search, r.selfLinks, r.leftOut}, page, []pageTransform{r.unlinked, r.inline})
+}
 
-	// Render the homepage.
-	progress("/")
-	if err := renderAndWrite(mux, "/", outDir); err != nil {
+// renderSitePages writes the pages of the site that are not of its
+// units: the homepage, the static informational pages and the not-found
+// page.
+func (r *siteRun) renderSitePages(ctx context.Context) error {
+	r.prog.next("/")
+	var homepage pageSizer
+	err := renderAndWrite(r.mux, "/", r.out, append(pageConsumers{&homepage}, r.consumers...), r.transforms()...)
+	r.prog.pageDone("/", homepage.size, err)
+	if err != nil {
 		return fmt.Errorf("rendering homepage: %w", err)
 	}
+	r.pages.done++
+
+	for _, p := range r.staticPages.urlPaths {
+		if err := r.pages.stopped(ctx, r.total); err != nil {
+			return err
+		}
+		r.prog.next(p)
+		r.pages.render(ctx, p, r.transforms(r.staticPages.contentTransform(p))...)
+	}
+
+	if r.opts.SkipNotFoundPage {
+		return nil
+	}
+	r.prog.next(notFoundURLPath)
+	ev := &pageEvent{URLPath: notFoundURLPath, File: notFoundURLPath[1:], HTML: true}
+	size, err := writeNotFoundPage(r.mux, r.out, r.site.BasePath, ev, r.transforms()...)
+	r.prog.pageDone(notFoundURLPath, size, err)
+	if err != nil {
+		return fmt.Errorf("writing not-found page: %w", err)
+	}
+	// The page is not one of the site's, but loads its assets.
+	if r.shaker != nil {
+		r.shaker.consumePage(ev)
+	}
+	r.pages.done++
+	return nil
+}
+
+// renderUnits writes the page of each unit, and its tab pages and the pages
+// of its symbol index. Over the time budget, a unit gets a stub instead,
+// and only the source pages and the bundles that pages link are written.
+func (r *siteRun) renderUnits(ctx context.Context) error {
+	// Pages with README diagrams load the diagram script, if there is one.
+	var diagrams pageTransform
+	if r.diagramScript != nil {
+		diagrams = diagramScriptTransform()
+	}
+	// Pages with code highlight it, if there is a theme.
+	var highlight pageTransform
+	if r.highlighter != nil {
+		highlight = r.highlighter.transform()
+	}
+	tabs := tabLinksTransform(r.tabLinks)
+	unindexedTabs := tabLinksTransform(r.unindexedTabLinks)
+	tabTransforms := map[string]pageTransform{
+		importsTab:    importLinksTransform(r.unitSet, r.opts.ExternalDocsURL, r.opts.StripExternalLinks),
+		importedByTab: importedByTransform(),
+		licensesTab:   joinTransforms(licensesTransform(), licenseTextsTransform(r.sharedTexts)),
+	}
+	readmeLinks := readmeLinksTransform(r.unitSet)
+	docLinks := docLinksTransform(r.unitSet, r.opts.ExternalDocsURL, r.opts.StripExternalLinks)
+	versionLinks := newVersionLinker(r.units)
+	var sourceFiles pageTransform
+	if r.sourceLinks != nil {
+		sourceFiles = sourceLinksTransform(r.sourceLinks)
+	}
+	sourceRepos, err := newSourceLinker(r.moduleSettings, r.result.AllModules, r.opts.SourceRef)
+	if err != nil {
+		return err
+	}
+	r.linkedSources = map[string]bool{}
+	r.linkedBundles = map[string]bool{}
+	forEach(ctx, len(r.pageUnits), r.workers, func(i int) {
+		u := r.pageUnits[i]
+		urlPath := "/" + u.path
+		r.prog.next(urlPath)
+		r.budget.check()
+		unitTabs, indexURLs := tabs, r.indexPages[u.path]
+		if r.budget.skip(degradeSymbolIndex, len(indexURLs)) {
+			unitTabs, indexURLs = unindexedTabs, nil
+		}
+		unitPages := 1
+		for _, tab := range staticTabs {
+			if r.tabPaths[u.path+"/"+tab] {
+				unitPages++
+			}
+		}
+		if r.budget.skip(degradeUnitPages, unitPages) {
+			if r.downloads && isBundledUnit(u) {
+				r.budget.skip(degradeArchives, 1)
+			}
+			var stub pageSizer
+			err := writeUnitStub(u, r.out, append(pageConsumers{&stub}, r.consumers...))
+			r.prog.pageDone(urlPath, stub.size, err)
+			if err != nil {
+				log.Errorf(ctx, "writing the stub of %s: %v", u.path, err)
+				r.pages.fail(urlPath, err)
+			}
+			return
+		}
+		unitSources := sourceFiles
+		if unitSources != nil {
+			if r.budget.gaveUp(degradeSourcePages) {
+				unitSources = nil
+			} else {
+				r.linkedMu.Lock()
+				r.linkedSources[u.path] = true
+				r.linkedMu.Unlock()
+			}
+		}
+		var checked []pageTransform
+		for _, c := range r.checks {
+			checked = append(checked, c.checkUnit(ctx, i, u))
+		}
+		settings := r.moduleSettings.transform(u.meta)
+		links := versionLinks.transform(u)
+		var versionsLink pageTransform
+		if r.tabPaths[u.path+"/"+versionsTab] {
+			versionsLink = versionsHeaderLinkTransform(u.path)
+		}
+		var downloadLink pageTransform
+		if r.downloads && isBundledUnit(u) && !r.budget.skip(degradeArchives, 1) {
+			downloadLink = downloadLinkTransform(u.meta.ModulePath)
+			r.linkedMu.Lock()
+			r.linkedBundles[u.meta.ModulePath] = true
+			r.linkedMu.Unlock()
+		}
+		unitPage := slices.Concat(
+			[]pageTransform{settings, links, versionsLink, unitTabs, readmeLinks, docLinks, unitSources, sourceRepos.transform(u), downloadLink, diagrams},
+			checked,
+			[]pageTransform{highlight})
+		r.pages.render(ctx, urlPath, r.transforms(unitPage...)...)
+		for _, tab := range staticTabs {
+			if !r.tabPaths[u.path+"/"+tab] {
+				continue
+			}
+			tabURL := urlPath + "?tab=" + tab
+			r.prog.next(tabPagePath(tabURL))
+			r.pages.render(ctx, tabURL, r.transforms(settings, links, versionsLink, unitTabs, tabTransforms[tab])...)
+		}
+		for _, indexURL := range indexURLs {
+			r.prog.next(tabPagePath(indexURL))
+			r.pages.render(ctx, indexURL, r.transforms(settings, links, versionsLink, unitTabs)...)
+		}
+		r.budget.done(degradeUnitPages, unitPages)
+		r.budget.done(degradeSymbolIndex, len(indexURLs))
+	})
+	return r.pages.stopped(ctx, r.total)
+}
+
+// renderSources writes the source pages, splitting those of large files.
+// Over the time budget, only those that pages link are written.
+func (r *siteRun) renderSources(ctx context.Context) error {
+	var highlight pageTransform
+	if r.highlighter != nil {
+		highlight = r.highlighter.transform()
+	}
+	r.sources = slices.DeleteFunc(r.sources, func(f sourcePage) bool {
+		return !r.linkedSources[path.Dir(path.Dir(f.sitePath))] && r.budget.skip(degradeSourcePages, 1)
+	})
+	chunker := newSourceChunker(r.opts.SourceChunkLines)
+	forEach(ctx, len(r.sources), r.workers, func(i int) {
+		f := r.sources[i]
+		r.prog.next("/" + f.sitePath)
+		r.pages.renderAt(ctx, f.urlPath, "/"+f.sitePath, r.transforms(sourcePageTransform(), highlight, chunker.transform(f.sitePath))...)
+		if err := chunker.write(r.out, f.sitePath); err != nil {
+			log.Errorf(ctx, "writing the chunks of %s: %v", f.sitePath, err)
+			r.pages.fail("/"+f.sitePath, err)
+		}
+		r.budget.done(degradeSourcePages, 1)
+	})
+	if err := r.pages.stopped(ctx, r.total); err != nil {
+		return err
+	}
+	for _, p := range chunker.written() {
+		r.checker.addFile(p)
+	}
+	return nil
+}
 
-	// Render static informational pages.
-	for _, p := range staticPages {
-		progress(p)
-		if err := renderAndWrite(mux, p, outDir); err != nil {
-			log.Errorf(ctx, "rendering %s: %v", p, err)
+// writeExports writes the Markdown and the plain text of the documentation
+// of each generated unit, and llms.txt, if the configuration asks for
+// them.
+func (r *siteRun) writeExports(ctx context.Context) error {
+	cfg := &r.cfg
+	if r.opts.EmitMarkdown {
+		fmt.Fprintf(r.logw, "Writing Markdown documentation...\n")
+		links := markdownLinks{units: r.paths, externalDocs: r.opts.ExternalDocsURL}
+		if r.opts.MarkdownAbsoluteLinks {
+			links.siteURL = cfg.SiteURL
+		}
+		for _, u := range r.selected {
+			if err := r.pages.stopped(ctx, r.total); err != nil {
+				return err
+			}
+			if err := writeUnitMarkdown(ctx, u, links, r.out); err != nil {
+				log.Errorf(ctx, "writing Markdown for %s: %v", u.path, err)
+				r.pages.fail("/"+u.path+"/doc.md", err)
+			}
 		}
 	}
 
-	// Render each unit (package/module/directory) page.
-	for _, p := range paths {
-		urlPath := "/" + p
-		progress(urlPath)
-		if err := renderAndWrite(mux, urlPath, outDir); err != nil {
-			log.Errorf(ctx, "rendering %s: %v", urlPath, err)
+	if r.opts.EmitText {
+		fmt.Fprintf(r.logw, "Writing plain-text documentation...\n")
+		var entries []textEntry
+		for _, u := range r.selected {
+			if err := r.pages.stopped(ctx, r.total); err != nil {
+				return err
+			}
+			synopsis, ok, err := writeUnitText(ctx, u, r.out)
+			if err != nil {
+				log.Errorf(ctx, "writing the text of %s: %v", u.path, err)
+				r.pages.fail("/"+u.path+"/doc.txt", err)
+			} else if ok {
+				entries = append(entries, textEntry{path: u.path, synopsis: synopsis})
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+		if err := r.out.writeFile(filepath.Join(r.out.dir, llmsFile), llmsText(cfg.SiteName, entries)); err != nil {
+			return fmt.Errorf("writing %s: %w", llmsFile, err)
 		}
 	}
+	return nil
+}
 
-	// Copy static assets, converting absolute paths to relative in CSS/JS.
-	fmt.Fprintf(os.Stderr, "Copying static assets...\n")
-	if err := copyEmbeddedFS(static.FS, ".", filepath.Join(outDir, "static")); err != nil {
+// writeAssets copies the static assets, converting absolute paths to
+// relative in CSS/JS, writes the other files that pages load, such as the
+// search index, and renders the page of the third-party notices.
+func (r *siteRun) writeAssets(ctx context.Context) error {
+	fmt.Fprintf(r.logw, "Copying static assets...\n")
+	r.assets = newAssetGraph()
+	if err := copyEmbeddedFS(ctx, static.FS, ".", r.out, "static", r.assets, r.branding.scheme, r.shaker); err != nil {
+		if err := r.pages.stopped(ctx, r.total); err != nil {
+			return err
+		}
 		return fmt.Errorf("copying static assets: %w", err)
 	}
-	if err := copyEmbeddedFS(thirdparty.FS, ".", filepath.Join(outDir, "third_party")); err != nil {
+	if err := copyEmbeddedFS(ctx, thirdparty.FS, ".", r.out, "third_party", r.assets, r.branding.scheme, r.shaker); err != nil {
+		if err := r.pages.stopped(ctx, r.total); err != nil {
+			return err
+		}
 		return fmt.Errorf("copying third_party assets: %w", err)
 	}
 
 	// Copy favicon to root.
 	favicon, err := fs.ReadFile(static.FS, "shared/icon/favicon.ico")
 	if err == nil {
-		_ = os.WriteFile(filepath.Join(outDir, "favicon.ico"), favicon, 0o644)
+		if r.out.writeFile(filepath.Join(r.outDir, "favicon.ico"), favicon) == nil {
+			r.assets.addFile("favicon.ico", favicon)
+		}
+	}
+	if !r.opts.NoClientSearch {
+		indexSize, err := r.index.write(r.out, r.assets)
+		if err != nil {
+			return fmt.Errorf("writing search index: %w", err)
+		}
+		fmt.Fprintf(r.logw, "Search index is %d bytes, %d of them for the normalized text of non-ASCII names and synopses\n", indexSize.bytes, indexSize.keyBytes)
+	}
+	if err := r.branding.writeFiles(r.out, r.assets); err != nil {
+		return fmt.Errorf("writing favicons: %w", err)
+	}
+	if r.opts.Schemas {
+		if err := writeSchemas(r.out, r.assets); err != nil {
+			return fmt.Errorf("writing schemas: %w", err)
+		}
+	}
+	if r.highlighter != nil {
+		if err := r.highlighter.writeFiles(r.out, r.assets, r.branding.scheme); err != nil {
+			return fmt.Errorf("writing highlight style sheets: %w", err)
+		}
+	}
+	if r.diagramScript != nil {
+		if err := writeDiagramScript(r.diagramScript, r.out, r.assets); err != nil {
+			return fmt.Errorf("writing diagram script: %w", err)
+		}
 	}
+	// The files held back that the site uses so far are written before
+	// the notices, which list the components whose files were written;
+	// the code moved out of the pages is written later, but what it loads
+	// is known.
+	if r.shaker != nil {
+		var loads []string
+		if r.out.external != nil {
+			loads = r.out.external.loads()
+		}
+		if err := r.shaker.write(r.out, r.assets, loads); err != nil {
+			return fmt.Errorf("copying static assets: %w", err)
+		}
+	}
+	r.prog.assetsCopied(len(r.assets.files), r.assets.size)
 
-	fmt.Fprintf(os.Stderr, "Static site generated in %s\n", outDir)
+	// The notices list the third-party components whose files were written.
+	components, err := thirdparty.Components()
+	if err != nil {
+		return err
+	}
+	notices, err := attributionsContent(includedComponents(components, r.out.written))
+	if err != nil {
+		return err
+	}
+	if err := r.pages.stopped(ctx, r.total); err != nil {
+		return err
+	}
+	r.prog.next(attributionsURLPath)
+	r.pages.renderAt(ctx, attributionsFrame, attributionsURLPath, r.transforms(attributionsTransform(notices))...)
 	return nil
 }
 
-// enumerateUnitPaths discovers all package/directory paths from the given
+// finish has the consumers write the files made from every page, writes
+// the files that need the whole output, such as the download bundles,
+// removes the files that the run no longer writes, records the run for
+// the next one, and returns the report.
+func (r *siteRun) finish(ctx context.Context) (*Report, error) {
+	cfg, out, logw := &r.cfg, r.out, r.logw
+	if err := r.consumers.finish(ctx, out); err != nil {
+		return nil, err
+	}
+	// The code moved out of the pages is written once every page is,
+	// including their prefetch hints.
+	if out.external != nil {
+		if err := out.external.writeFiles(out, r.assets); err != nil {
+			return nil, fmt.Errorf("writing the inline code of the pages: %w", err)
+		}
+		out.external.warn(logw)
+	}
+	if r.shaker != nil {
+		if err := r.shaker.write(out, r.assets, nil); err != nil {
+			return nil, fmt.Errorf("copying static assets: %w", err)
+		}
+		fmt.Fprintf(logw, "Left out %d static assets that the site does not use\n", r.shaker.left())
+	}
+	var bundles []DownloadBundle
+	if r.downloads {
+		var keep map[string]bool
+		if r.budget.gaveUp(degradeArchives) {
+			keep = r.linkedBundles
+		}
+		var err error
+		bundles, err = writeDownloadBundles(out, r.recorder, r.assets, cfg.SiteURL, keep)
+		if err != nil {
+			return nil, fmt.Errorf("writing download bundles: %w", err)
+		}
+		r.budget.done(degradeArchives, len(r.linkedBundles))
+	}
+	// The style sheets and scripts are renamed after their contents once
+	// every file is written, and before the files no longer written are
+	// removed, including the previous names.
+	if r.opts.FingerprintAssets {
+		if err := fingerprintAssets(out, r.assets, r.site.BasePath); err != nil {
+			return nil, fmt.Errorf("naming assets after their contents: %w", err)
+		}
+	}
+	var (
+		removed []string
+		err     error
+	)
+	if r.opts.Prune {
+		if r.inliner != nil {
+			for _, p := range r.inliner.unused(r.assets) {
+				out.forget(p)
+			}
+		}
+		for _, p := range r.branding.scheme.unused(r.assets) {
+			out.forget(p)
+		}
+		removed, err = out.prune()
+	} else {
+		removed, err = out.removeStale()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("removing stale files: %w", err)
+	}
+	rootPaths, err := findRootPaths(r.outDir, out.written, r.site.BasePath)
+	if err != nil {
+		return nil, fmt.Errorf("checking for paths from the root: %w", err)
+	}
+	// A hidden symbol that was not found is likely misspelled.
+	for _, s := range r.result.Hider.unmatched() {
+		fmt.Fprintf(logw, "Warning: hidden symbol %s was not found\n", s)
+	}
+	report := &Report{
+		SchemaVersion:   schema.ReportArtifact.Version.String(),
+		Partial:         r.opts.Smoke,
+		Units:           len(r.units),
+		Pages:           len(r.checker.pages),
+		BrokenLinks:     r.checker.broken,
+		IgnoredLinks:    r.checker.ignored,
+		MissingAssets:   r.assets.missing(),
+		Redactions:      r.result.Redactor.redactions(),
+		FailedPages:     r.pages.failed,
+		HiddenSymbols:   r.result.Hider.hidings(),
+		Invalidated:     r.options.invalidated(r.outDir),
+		Frozen:          slices.Sorted(maps.Keys(cfg.frozen)),
+		DownloadBundles: bundles,
+		LeftOut:         slices.Sorted(maps.Keys(r.left)),
+		RootPaths:       rootPaths,
+	}
+	for _, c := range r.checks {
+		c.report(report)
+	}
+	// The integrity attributes are of the files as written, so they are
+	// added once every file is, and before the pages are fingerprinted.
+	if r.opts.SubresourceIntegrity {
+		if err := addIntegrity(out, r.site.BasePath); err != nil {
+			return nil, fmt.Errorf("adding integrity attributes: %w", err)
+		}
+	}
+	// The list of the pages has the hashes of their files as final, and
+	// the fingerprints cover it.
+	if r.opts.ContentHash {
+		if err := markContentHashes(out); err != nil {
+			return nil, fmt.Errorf("recording fingerprints on the pages: %w", err)
+		}
+	}
+	report.PageList = r.lister.list(out.written)
+	if err := writePageList(out, report.PageList); err != nil {
+		return nil, fmt.Errorf("writing the list of pages: %w", err)
+	}
+	if err := writeFingerprints(out); err != nil {
+		return nil, fmt.Errorf("writing fingerprints: %w", err)
+	}
+	if r.opts.Precompress {
+		fmt.Fprintf(logw, "Compressing files...\n")
+		if err := out.compress(ctx, r.workers); err != nil {
+			return nil, fmt.Errorf("compressing files: %w", err)
+		}
+	}
+	if err := out.finish(); err != nil {
+		return nil, fmt.Errorf("recording written files: %w", err)
+	}
+	if err := r.options.write(r.outDir); err != nil {
+		return nil, fmt.Errorf("recording options: %w", err)
+	}
+	if err := r.recorder.write(r.outDir, out.written); err != nil {
+		return nil, fmt.Errorf("recording modules: %w", err)
+	}
+	fmt.Fprintf(logw, "Left %d unchanged files alone, removed %d stale files\n", out.skipped, len(removed))
+	changed, deleted, err := writeChangeLists(r.outDir)
+	if err != nil {
+		return nil, fmt.Errorf("writing change lists: %w", err)
+	}
+	report.ChangedFiles, report.DeletedFiles = len(changed), len(deleted)
+	r.budget.check()
+	if r.opts.Archive && strictFailure(r.opts, report) == nil && !r.budget.skip(degradeArchives, 1) {
+		report.Archive, err = archiveSite(r.outDir, out.written, r.opts.ArchiveTag, r.opts.ArchiveKeep, buildTime(r.opts))
+		if err != nil {
+			return nil, fmt.Errorf("archiving the site: %w", err)
+		}
+	}
+	report.Degradations = r.budget.degraded()
+	writeExcludedReport(logw, excludedPackages(r.units))
+	writeReport(logw, report)
+	if r.opts.ReproBundle != "" {
+		if err := writeReproBundle(r.opts.ReproBundle, *cfg, r.opts, r.result.AllModules, report); err != nil {
+			return nil, fmt.Errorf("writing repro bundle: %w", err)
+		}
+	}
+	r.prog.done(report)
+	return report, nil
+}
+
+// A unitCheck looks at each unit with a page, and adds what it finds to
+// the page and to the report. It is safe for concurrent use on different
+// units.
+type unitCheck interface {
+	// checkUnit checks u, the i-th unit with a page, and returns the
+	// transform of its page, or nil.
+	checkUnit(ctx context.Context, i int, u *siteUnit) pageTransform
+	// report adds what was found to the report.
+	report(r *Report)
+}
+
+// siteUnit is a unit (module, package or directory) included in the
+// generated site.
+type siteUnit struct {
+	path    string             // canonical unit path, with the version for a versioned unit
+	version string             // the version of a versioned unit; see versions.go
+	meta    *internal.UnitMeta // metadata as reported by the module
+	module  *fetch.LazyModule  // the module containing the unit
+	getter  fetch.ModuleGetter // the getter the module was enumerated from
+}
+
+// enumerateUnits discovers all package/directory units from the given
 // modules by fetching each module with the available getters and collecting
-// their UnitMetas.
-func enumerateUnitPaths(ctx context.Context, getters []fetch.ModuleGetter, modules []frontend.LocalModule) ([]string, error) {
+// their UnitMetas. The result is sorted by path.
+func enumerateUnits(ctx context.Context, getters []fetch.ModuleGetter, modules []frontend.LocalModule, opts fetch.LoadOptions) ([]*siteUnit, error) {
 	seen := make(map[string]bool)
-	var paths []string
+	var units []*siteUnit
 
 	for _, mod := range modules {
 		for _, g := range getters {
-			lm := fetch.FetchLazyModule(ctx, mod.ModulePath, fetch.LocalVersion, g)
+			lm := fetch.FetchLazyModuleWithOptions(ctx, mod.ModulePath, fetch.LocalVersion, g, opts)
 			if lm.Error != nil {
 				continue // this getter doesn't have this module, try next
 			}
 			for _, um := range lm.UnitMetas {
-				if !seen[um.Path] {
-					seen[um.Path] = true
-					paths = append(paths, um.Path)
+				p := canonicalUnitPath(um.Path)
+				if !seen[p] {
+					seen[p] = true
+					units = append(units, &siteUnit{path: p, meta: um, module: lm, getter: g})
 				}
 			}
 			break // found it with this getter, no need to try others
 		}
 	}
 
-	sort.Strings(paths)
-	return paths, nil
+	sort.Slice(units, func(i, j int) bool { return units[i].path < units[j].path })
+	return units, nil
+}
+
+// unitPaths returns the paths of the given units.
+func unitPaths(units []*siteUnit) []string {
+	paths := make([]string, len(units))
+	for i, u := range units {
+		paths[i] = u.path
+	}
+	return paths
+}
+
+// forEach calls f with each index of n items, on up to workers goroutines
+// at once. With one worker, the items are done in order. Once ctx is done,
+// no more items are started.
+func forEach(ctx context.Context, n, workers int, f func(i int)) {
+	if workers <= 1 {
+		for i := 0; i < n && ctx.Err() == nil; i++ {
+			f(i)
+		}
+		return
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// A pageRenderer renders pages with renderAndWrite, and records those that
+// fail. It is safe for concurrent use if its consumers are.
+type pageRenderer struct {
+	mux       *http.ServeMux
+	out       *siteOutput
+	consumers pageConsumers
+	progress  *progressTracker
+	mu        sync.Mutex
+	done      int // pages rendered, whether or not they failed
+	failed    []FailedPage
+}
+
+// stopped returns an error wrapping the error of ctx, saying how many of
+// the total pages were rendered, if ctx is done.
+func (r *pageRenderer) stopped(ctx context.Context, total int) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fmt.Errorf("generation stopped after %d of %d pages: %w", r.done, total, ctx.Err())
+}
+
+// render renders the page at urlPath. A failure is logged and recorded.
+func (r *pageRenderer) render(ctx context.Context, urlPath string, transforms ...pageTransform) {
+	r.renderAt(ctx, urlPath, "", transforms...)
+}
+
+// renderAt is like render, but writes the page at the URL path pagePath,
+// unless it is empty.
+func (r *pageRenderer) renderAt(ctx context.Context, urlPath, pagePath string, transforms ...pageTransform) {
+	var sizer pageSizer
+	err := renderAndWriteN(r.mux, urlPath, pagePath, r.out, append(pageConsumers{&sizer}, r.consumers...), transforms, 0)
+	r.mu.Lock()
+	r.done++
+	r.mu.Unlock()
+	// Progress is reported at the path the page is written at.
+	if pagePath != "" {
+		r.progress.pageDone(pagePath, sizer.size, err)
+	} else {
+		r.progress.pageDone(tabPagePath(urlPath), sizer.size, err)
+	}
+	if err != nil {
+		failed := urlPath
+		if pagePath != "" {
+			failed = pagePath
+		}
+		log.Errorf(ctx, "rendering %s: %v", failed, err)
+		r.fail(failed, err)
+	}
+}
+
+// fail records that the page at urlPath could not be written.
+func (r *pageRenderer) fail(urlPath string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed = append(r.failed, FailedPage{URLPath: urlPath, Error: err.Error()})
 }
 
 // renderAndWrite renders the given URL path using the mux and writes the
-// response body to the appropriate file under outDir. For HTML responses,
+// response body to the appropriate file of out. For HTML responses,
 // it injects a strict Content-Security-Policy meta tag and converts absolute
-// URL paths to relative paths.
-func renderAndWrite(mux *http.ServeMux, urlPath, outDir string) error {
-	return renderAndWriteN(mux, urlPath, outDir, 0)
+// URL paths to relative paths. Once the file is written, a summary of the
+// page is passed to the consumers. The transforms are applied to HTML pages.
+// Redirects are followed, and a stub page is written for each.
+func renderAndWrite(mux *http.ServeMux, urlPath string, out *siteOutput, consumers pageConsumers, transforms ...pageTransform) error {
+	return renderAndWriteN(mux, urlPath, "", out, consumers, transforms, 0)
 }
 
-func renderAndWriteN(mux *http.ServeMux, urlPath, outDir string, depth int) error {
+// renderAndWriteN is like renderAndWrite, but writes the page at the URL
+// path pagePath, unless it is empty, and gives up after depth redirects.
+func renderAndWriteN(mux *http.ServeMux, urlPath, pagePath string, out *siteOutput, consumers pageConsumers, transforms []pageTransform, depth int) error {
 	if depth > 5 {
 		return fmt.Errorf("too many redirects for %s", urlPath)
 	}
@@ -160,11 +1351,19 @@ func renderAndWriteN(mux *http.ServeMux, urlPath, outDir string, depth int) erro
 	r := httptest.NewRequest("GET", urlPath, nil)
 	mux.ServeHTTP(w, r)
 
-	// Follow redirects.
+	// Follow redirects within the site, and leave a stub page behind.
 	if w.Code == http.StatusMovedPermanently || w.Code == http.StatusFound {
-		loc := w.Header().Get("Location")
-		if loc != "" {
-			return renderAndWriteN(mux, loc, outDir, depth+1)
+		if loc := w.Header().Get("Location"); loc != "" {
+			target, local, err := redirectTarget(urlPath, loc)
+			if err != nil {
+				return fmt.Errorf("GET %s: %w", urlPath, err)
+			}
+			if local {
+				if err := renderAndWriteN(mux, target, "", out, consumers, transforms, depth+1); err != nil {
+					return err
+				}
+			}
+			return writeRedirectStub(urlPath, target, out, consumers)
 		}
 	}
 
@@ -172,41 +1371,82 @@ func renderAndWriteN(mux *http.ServeMux, urlPath, outDir string, depth int) erro
 		return fmt.Errorf("GET %s returned status %d", urlPath, w.Code)
 	}
 
+	// Tabs are written as pages of their own.
+	if pagePath == "" {
+		pagePath = tabPagePath(urlPath)
+	}
 	body := w.Body.Bytes()
+	ev := &pageEvent{URLPath: pagePath}
+	_, ev.Tab, _ = tabRequest(urlPath)
+	ev.Source = strings.HasPrefix(urlPath, sourcePrefix)
 
 	// For HTML responses, parse the DOM, inject CSP, and relativize paths.
 	contentType := w.Header().Get("Content-Type")
 	if strings.Contains(contentType, "text/html") || contentType == "" {
-		processed, err := processHTML(body, urlPath)
+		processed, err := processHTML(body, pagePath, ev, out.pageTransforms(pagePath, transforms)...)
 		if err != nil {
 			return fmt.Errorf("processing HTML for %s: %w", urlPath, err)
 		}
 		body = processed
+		if out.minify {
+			body = minifyHTML(body)
+		}
+		ev.HTML = true
 	}
 
 	// Determine output file path.
-	outPath := urlPathToFilePath(urlPath, outDir)
+	outPath, err := urlPathToFilePath(pagePath, out.dir, pagePathKind)
+	if err != nil {
+		return err
+	}
 
 	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
 		return err
 	}
-	return os.WriteFile(outPath, body, 0o644)
+	// The size of the page is that of the file as written.
+	body = out.normalize(outPath, body)
+	if err := out.writeFile(outPath, body); err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(out.dir, outPath)
+	if err != nil {
+		return err
+	}
+	ev.File = filepath.ToSlash(rel)
+	ev.Size = len(body)
+	return consumers.consumePage(ev)
 }
 
-// urlPathToFilePath maps a URL path to a filesystem path under outDir.
-// "/" becomes "outDir/index.html", "/foo/bar" becomes "outDir/foo/bar/index.html",
-// and paths with file extensions (like "/favicon.ico") stay as-is.
-func urlPathToFilePath(urlPath, outDir string) string {
-	clean := strings.TrimPrefix(urlPath, "/")
+// A urlPathKind says what a URL path names, for urlPathToFilePath. A page
+// cannot be told from a file by its path: package paths such as
+// gopkg.in/yaml.v3 or example.com/lib.js end in what looks like an
+// extension.
+type urlPathKind int
+
+const (
+	// pagePathKind is the kind of the URL paths of pages, such as those of
+	// units, which are written as directories with an index.html.
+	pagePathKind urlPathKind = iota
+	// filePathKind is the kind of the URL paths of files, such as
+	// /favicon.ico, which are written as they are.
+	filePathKind
+)
+
+// urlPathToFilePath maps a URL path of the given kind to a filesystem path
+// under outDir. "/" becomes "outDir/index.html", the page "/foo/bar"
+// becomes "outDir/foo/bar/index.html", and the file "/favicon.ico" becomes
+// "outDir/favicon.ico". URL paths with segments that could escape outDir
+// are rejected.
+func urlPathToFilePath(urlPath, outDir string, kind urlPathKind) (string, error) {
+	clean := strings.TrimPrefix(canonicalURLPath(urlPath), "/")
+	clean = strings.TrimSuffix(clean, "/")
 	if clean == "" {
-		return filepath.Join(outDir, "index.html")
+		return filepath.Join(outDir, "index.html"), nil
 	}
-	// If the path has a file extension, keep it as-is.
-	if ext := filepath.Ext(clean); ext != "" {
-		return filepath.Join(outDir, filepath.FromSlash(clean))
+	if kind == filePathKind {
+		return outputPath(outDir, clean)
 	}
-	// Otherwise, treat it as a directory with index.html.
-	return filepath.Join(outDir, filepath.FromSlash(clean), "index.html")
+	return outputPath(outDir, clean+"/index.html")
 }
 
 // relativePrefix returns the "../" prefix needed to navigate from a page at
@@ -228,18 +1468,61 @@ func relativePrefix(urlPath string) string {
 	return strings.Repeat("../", depth)
 }
 
-// processHTML parses the HTML document, injects a Content-Security-Policy
-// meta tag into <head>, and rewrites all absolute URL paths to relative
-// paths based on the page's depth in the URL hierarchy.
-func processHTML(content []byte, urlPath string) ([]byte, error) {
-	prefix := relativePrefix(urlPath)
+// A pageTransform modifies a parsed page before its URLs are relativized.
+// It can register fragments for the page's <head> with head.
+type pageTransform func(doc *html.Node, head *headManager)
+
+// joinTransforms returns the page transform applying the transforms in
+// order, skipping nil ones.
+func joinTransforms(transforms ...pageTransform) pageTransform {
+	return func(doc *html.Node, head *headManager) {
+		for _, t := range transforms {
+			if t != nil {
+				t(doc, head)
+			}
+		}
+	}
+}
+
+// processHTML parses the HTML document, applies the transforms, writes the
+// managed <head> fragments such as a Content-Security-Policy meta tag, and
+// rewrites all absolute URL paths to relative paths based on the page's
+// depth in the URL hierarchy. If ev is non-nil, the title, links, ids and
+// subresources of the result are recorded in it.
+func processHTML(content []byte, urlPath string, ev *pageEvent, transforms ...pageTransform) ([]byte, error) {
+	return processHTMLWithPrefix(content, relativePrefix(urlPath), ev, transforms...)
+}
 
-	doc, err := html.Parse(bytes.NewReader(content))
+// processHTMLWithPrefix is like processHTML, but rewrites absolute URL
+// paths to start with prefix.
+func processHTMLWithPrefix(content []byte, prefix string, ev *pageEvent, transforms ...pageTransform) ([]byte, error) {
+	// Browsers decode invalid UTF-8 as U+FFFD, which the output spells out.
+	doc, err := html.Parse(bytes.NewReader(bytes.ToValidUTF8(content, []byte("\uFFFD"))))
 	if err != nil {
 		return nil, fmt.Errorf("parsing HTML: %w", err)
 	}
+	removeCSPMeta(doc)
 
+	var head headManager
+	head.register("csp", headOrderCSP, cspMeta())
+	for _, t := range transforms {
+		if t != nil {
+			t(doc, &head)
+		}
+	}
+	addLegacyNames(doc)
+
+	// The head fragments are written first, so that their URLs are
+	// rewritten too.
+	if h := findElement(doc, "head"); h != nil {
+		head.apply(h)
+	}
 	walkNodes(doc, prefix)
+	setBase(doc, prefix)
+
+	if ev != nil {
+		summarizePage(doc, ev)
+	}
 
 	var buf bytes.Buffer
 	if err := html.Render(&buf, doc); err != nil {
@@ -249,36 +1532,41 @@ func processHTML(content []byte, urlPath string) ([]byte, error) {
 }
 
 // walkNodes recursively walks the HTML node tree, rewriting absolute URL
-// attribute values to relative paths and injecting the CSP meta tag.
+// attribute values to relative paths.
 func walkNodes(n *html.Node, prefix string) {
+	if n.Type == html.TextNode && isDisplayTextParent(n.Parent) {
+		n.Data = displayText(n.Data)
+	}
 	if n.Type == html.ElementNode {
-		// Rewrite URL-valued attributes from absolute to relative paths.
+		// Rewrite URL-valued attributes as the rules of urlrules.go have
+		// it: absolute paths become relative, using the canonical
+		// (punycode) form of any IDN host.
 		for i, a := range n.Attr {
-			if isURLAttr(a.Key) && strings.HasPrefix(a.Val, "/") && !strings.HasPrefix(a.Val, "//") {
-				n.Attr[i].Val = prefix + a.Val[1:]
-			}
-		}
-
-		// Inject CSP <meta> as the first child of <head>.
-		if n.Data == "head" {
-			meta := &html.Node{
-				Type: html.ElementNode,
-				Data: "meta",
-				Attr: []html.Attribute{
-					{Key: "http-equiv", Val: "Content-Security-Policy"},
-					{Key: "content", Val: cspContent},
-				},
+			if r, ok := urlAttrRule(n, a); ok {
+				n.Attr[i].Val = mapURLs(r, a.Val, func(u string) string { return rewriteURL(n, u, prefix) })
 			}
-			n.InsertBefore(meta, n.FirstChild)
 		}
 
-		// Rewrite absolute paths inside inline <script> text.
-		if n.Data == "script" {
+		// Rewrite absolute paths inside inline <script> text, as its kind
+		// allows.
+		switch scriptTextKind(n) {
+		case scriptJS:
 			for c := n.FirstChild; c != nil; c = c.NextSibling {
 				if c.Type == html.TextNode {
 					c.Data = relativizeScriptText(c.Data, prefix)
 				}
 			}
+		case scriptJSONLD:
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.TextNode {
+					c.Data = rewriteJSONLD(c.Data, func(val string) string {
+						if strings.HasPrefix(val, "/") && !strings.HasPrefix(val, "//") {
+							return prefix + canonicalURLPath(val)[1:]
+						}
+						return val
+					})
+				}
+			}
 		}
 	}
 
@@ -287,15 +1575,130 @@ func walkNodes(n *html.Node, prefix string) {
 	}
 }
 
-// isURLAttr reports whether the given attribute name typically contains a URL.
-func isURLAttr(attr string) bool {
-	switch attr {
-	case "href", "src", "action", "poster", "data":
-		return true
+// findElement returns the first element named tag in the tree rooted at n,
+// or nil if there is none.
+func findElement(n *html.Node, tag string) *html.Node {
+	return findElementFunc(n, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == tag
+	})
+}
+
+// findElementFunc returns the first node in the tree rooted at n, in
+// document order, for which match returns true, or nil if there is none.
+func findElementFunc(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if e := findElementFunc(c, match); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// attrValue returns the value of n's attribute key, or "" if it has none.
+func attrValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasAttr reports whether n has the attribute key.
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// setAttr sets n's attribute key to val, adding it if n has none.
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+// hasClass reports whether class is one of n's classes.
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attrValue(n, "class")) {
+		if c == class {
+			return true
+		}
 	}
 	return false
 }
 
+// isDisplayTextParent reports whether text directly inside n is shown to
+// readers as a unit path, such as a page title, heading, or link text, and
+// is not part of preformatted source code.
+func isDisplayTextParent(n *html.Node) bool {
+	if n == nil || n.Type != html.ElementNode {
+		return false
+	}
+	switch n.Data {
+	case "title", "h1", "a":
+	default:
+		return false
+	}
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && (p.Data == "pre" || p.Data == "code") {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanURLPath resolves the dot segments of the site-absolute URL path u,
+// keeping its query and fragment, so that a path such as "/../x" cannot
+// climb out of the site once it is made relative. Like a browser, it takes
+// backslashes for slashes, ignores tabs and newlines, and takes
+// percent-encoded dots for dots.
+func cleanURLPath(u string) string {
+	p, suffix := u, ""
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p, suffix = p[:i], p[i:]
+	}
+	p = strings.Map(func(r rune) rune {
+		switch r {
+		case '\t', '\n', '\r':
+			return -1
+		case '\\':
+			return '/'
+		}
+		return r
+	}, p)
+	segs := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	var clean []string
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		switch strings.ToLower(seg) {
+		case "..", ".%2e", "%2e.", "%2e%2e":
+			if len(clean) > 0 {
+				clean = clean[:len(clean)-1]
+			}
+		case ".", "%2e":
+		default:
+			clean = append(clean, seg)
+			continue
+		}
+		// A path ending in a dot segment names a directory.
+		if last {
+			clean = append(clean, "")
+		}
+	}
+	return "/" + strings.Join(clean, "/") + suffix
+}
+
 // relativizeScriptText rewrites absolute path string literals inside inline
 // JavaScript. This handles patterns like loadScript("/static/...").
 func relativizeScriptText(script, prefix string) string {
@@ -334,32 +1737,64 @@ func absoluteToRelativeAsset(content []byte, filePath string) []byte {
 }
 
 // copyEmbeddedFS recursively copies all files from an embedded filesystem
-// to a destination directory on disk. CSS and JS files have their absolute
-// URL path references converted to relative paths.
-func copyEmbeddedFS(fsys fs.FS, root, destDir string) error {
+// to the top-level directory siteDir of out, such as "static". CSS and JS
+// files have their absolute URL path references converted to relative
+// paths, JS files are patched to build URLs from the site root, and CSS
+// files lose the rules that the pinned color scheme leaves out. The
+// written files are added to graph. If shaker is not nil, the files are
+// held by it instead, to be written if the site uses them; see
+// treeshake.go. The copy stops once ctx is done.
+func copyEmbeddedFS(ctx context.Context, fsys fs.FS, root string, out *siteOutput, siteDir string, graph *assetGraph, scheme *colorScheme, shaker *assetShaker) error {
+	destDir := filepath.Join(out.dir, siteDir)
 	return fs.WalkDir(fsys, root, func(fpath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		dest := filepath.Join(destDir, filepath.FromSlash(fpath))
 		if d.IsDir() {
+			if shaker != nil {
+				return nil
+			}
 			return os.MkdirAll(dest, 0o755)
 		}
 		data, err := fs.ReadFile(fsys, fpath)
 		if err != nil {
 			return err
 		}
+		// The file's path relative to the site root includes the
+		// top-level directory name (e.g., "static/" or "third_party/").
+		siteRelPath := path.Join(siteDir, fpath)
 		ext := filepath.Ext(fpath)
 		if ext == ".css" || ext == ".js" {
-			// The file's path relative to the site root includes the
-			// top-level directory name (e.g., "static/" or "third_party/").
-			// We derive this from destDir's base name + the embedded path.
-			siteRelPath := path.Join(filepath.Base(destDir), fpath)
 			data = absoluteToRelativeAsset(data, siteRelPath)
 		}
+		if ext == ".js" {
+			data = patchJS(data)
+		}
+		if ext == ".css" {
+			data = scheme.filterCSS(data)
+		}
+		if out.minify {
+			minified, err := minifyAsset(data, ext)
+			if err != nil {
+				log.Warningf(ctx, "minifying %s: %v; copying it as it is", siteRelPath, err)
+			}
+			data = minified
+		}
+		if shaker != nil {
+			shaker.hold(siteRelPath, data)
+			return nil
+		}
 		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
 			return err
 		}
-		return os.WriteFile(dest, data, 0o644)
+		if err := out.writeFile(dest, data); err != nil {
+			return err
+		}
+		graph.addFile(siteRelPath, data)
+		return nil
 	})
 }
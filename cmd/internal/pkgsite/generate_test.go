@@ -5,11 +5,37 @@
 package pkgsite
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"html"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	nethtml "golang.org/x/net/html"
 )
 
+func TestMain(m *testing.M) {
+	// Pages do not look up their module on deps.dev, which would make
+	// every test wait on the network.
+	httpClient = &http.Client{Transport: offlineTransport{}}
+	os.Exit(m.Run())
+}
+
+// offlineTransport is an http.RoundTripper that fails every request.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("%s: no network in tests", req.URL)
+}
+
 func TestRelativePrefix(t *testing.T) {
 	tests := []struct {
 		urlPath string
@@ -29,25 +55,25 @@ func TestRelativePrefix(t *testing.T) {
 	}
 }
 
-func TestIsURLAttr(t *testing.T) {
+func TestCleanURLPath(t *testing.T) {
 	tests := []struct {
-		attr string
-		want bool
+		in, want string
 	}{
-		{"href", true},
-		{"src", true},
-		{"action", true},
-		{"poster", true},
-		{"data", true},
-		{"class", false},
-		{"id", false},
-		{"style", false},
-		{"value", false},
+		{"/", "/"},
+		{"/example.com/m?tab=doc#F", "/example.com/m?tab=doc#F"},
+		{"/example.com/m/", "/example.com/m/"},
+		{"/a/../b", "/b"},
+		{"/../../etc/passwd", "/etc/passwd"},
+		{"/a/%2e%2E/%2e/b", "/b"},
+		{`/..\..\x`, "/x"},
+		{"/.\t./x", "/x"},
+		{"/a/..", "/"},
+		{"/a/b/.", "/a/b/"},
+		{"/a/..?q=/../x", "/?q=/../x"},
 	}
 	for _, tt := range tests {
-		got := isURLAttr(tt.attr)
-		if got != tt.want {
-			t.Errorf("isURLAttr(%q) = %v, want %v", tt.attr, got, tt.want)
+		if got := cleanURLPath(tt.in); got != tt.want {
+			t.Errorf("cleanURLPath(%q) = %q, want %q", tt.in, got, tt.want)
 		}
 	}
 }
@@ -163,19 +189,33 @@ func TestAbsoluteToRelativeAsset(t *testing.T) {
 func TestURLPathToFilePath(t *testing.T) {
 	tests := []struct {
 		urlPath string
+		kind    urlPathKind
 		outDir  string
 		want    string
 	}{
-		{"/", "out", "out/index.html"},
-		{"/about", "out", "out/about/index.html"},
-		{"/net/http", "out", "out/net/http/index.html"},
-		{"/favicon.ico", "out", "out/favicon.ico"},
-		{"/static/frontend/frontend.css", "out", "out/static/frontend/frontend.css"},
+		{"/", pagePathKind, "out", "out/index.html"},
+		{"/about", pagePathKind, "out", "out/about/index.html"},
+		{"/net/http", pagePathKind, "out", "out/net/http/index.html"},
+		{"/favicon.ico", filePathKind, "out", "out/favicon.ico"},
+		{"/static/frontend/frontend.css", filePathKind, "out", "out/static/frontend/frontend.css"},
+		{"/bücher.example/lib", pagePathKind, "out", "out/xn--bcher-kva.example/lib/index.html"},
+		{"/gopkg.in/yaml.v3", pagePathKind, "out", "out/gopkg.in/yaml.v3/index.html"},
+		{"/github.com/foo/bar.v2", pagePathKind, "out", "out/github.com/foo/bar.v2/index.html"},
+		{"/k8s.io/api", pagePathKind, "out", "out/k8s.io/api/index.html"},
+		{"/404.html", filePathKind, "out", "out/404.html"},
+		// Package paths may end in the extensions of files.
+		{"/example.com/lib.js", pagePathKind, "out", "out/example.com/lib.js/index.html"},
+		{"/example.com/m/doc.md", pagePathKind, "out", "out/example.com/m/doc.md/index.html"},
+		{"/example.com/m/v.json", pagePathKind, "out", "out/example.com/m/v.json/index.html"},
 	}
 	for _, tt := range tests {
-		got := urlPathToFilePath(tt.urlPath, tt.outDir)
+		got, err := urlPathToFilePath(tt.urlPath, tt.outDir, tt.kind)
+		if err != nil {
+			t.Errorf("urlPathToFilePath(%q, %q, %d): %v", tt.urlPath, tt.outDir, tt.kind, err)
+			continue
+		}
 		if got != tt.want {
-			t.Errorf("urlPathToFilePath(%q, %q) = %q, want %q", tt.urlPath, tt.outDir, got, tt.want)
+			t.Errorf("urlPathToFilePath(%q, %q, %d) = %q, want %q", tt.urlPath, tt.outDir, tt.kind, got, tt.want)
 		}
 	}
 }
@@ -245,6 +285,25 @@ func TestProcessHTML(t *testing.T) {
 				contains(`loadScript("../../static/frontend/frontend.js")`),
 			},
 		},
+		{
+			name:    "canonicalizes IDN hosts in links",
+			html:    `<html><head></head><body><a href="/bücher.example/lib">L</a><a href="/b%C3%BCcher.example/lib/sub">S</a></body></html>`,
+			urlPath: "/",
+			checks: []func(t *testing.T, result string){
+				contains(`href="./xn--bcher-kva.example/lib"`),
+				contains(`href="./xn--bcher-kva.example/lib/sub"`),
+			},
+		},
+		{
+			name:    "displays IDN hosts in Unicode",
+			html:    `<html><head><title>lib - xn--bcher-kva.example/lib</title></head><body><a href="/xn--bcher-kva.example/lib">xn--bcher-kva.example/lib</a><pre><a href="/xn--bcher-kva.example/lib">xn--bcher-kva.example/lib</a></pre></body></html>`,
+			urlPath: "/",
+			checks: []func(t *testing.T, result string){
+				contains(`<title>lib - bücher.example/lib</title>`),
+				contains(`<a href="./xn--bcher-kva.example/lib">bücher.example/lib</a>`),
+				contains(`<pre><a href="./xn--bcher-kva.example/lib">xn--bcher-kva.example/lib</a></pre>`),
+			},
+		},
 		{
 			name:    "deep path gets correct prefix",
 			html:    `<html><head><link href="/static/style.css"></head><body><a href="/about">About</a></body></html>`,
@@ -257,7 +316,7 @@ func TestProcessHTML(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := processHTML([]byte(tt.html), tt.urlPath)
+			result, err := processHTML([]byte(tt.html), tt.urlPath, nil)
 			if err != nil {
 				t.Fatalf("processHTML() error: %v", err)
 			}
@@ -278,3 +337,232 @@ func contains(substr string) func(t *testing.T, result string) {
 		}
 	}
 }
+
+func TestGenerateStaticSiteIDN(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module xn--bcher-kva.example/lib
+-- a.go --
+// Package lib does things.
+package lib
+
+// F is a function.
+func F() {}
+-- sub/b.go --
+// Package sub uses lib.
+package sub
+
+import "xn--bcher-kva.example/lib"
+
+// G calls [lib.F].
+func G() { lib.F() }
+`, nil)
+	for _, p := range []string{"xn--bcher-kva.example/lib/index.html", "xn--bcher-kva.example/lib/sub/index.html"} {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p))); err != nil {
+			t.Errorf("missing page: %v", err)
+		}
+	}
+	checkInternalLinks(t, outDir, "xn--bcher-kva.example/")
+
+	data, err := os.ReadFile(filepath.Join(outDir, "xn--bcher-kva.example", "lib", "sub", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<title>sub package - bücher.example/lib/sub - Go Packages</title>") {
+		t.Errorf("page title does not use the Unicode host")
+	}
+}
+
+// TestGenerateStaticSiteFileLikePaths checks that the pages of packages
+// whose paths end in the extensions of files are written as directories.
+func TestGenerateStaticSiteFileLikePaths(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/lib.js
+-- a.go --
+// Package lib binds a JavaScript library.
+package lib
+
+// F is a function.
+func F() {}
+-- schema.json/b.go --
+// Package schema uses lib.
+package schema
+
+import "example.com/lib.js"
+
+// G calls [lib.F].
+func G() { lib.F() }
+`, nil)
+	for _, p := range []string{"example.com/lib.js/index.html", "example.com/lib.js/schema.json/index.html"} {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p))); err != nil {
+			t.Errorf("missing page: %v", err)
+		}
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+}
+
+func TestGenerateStaticSiteGlance(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+-- m.go --
+// Package m has four symbols.
+package m
+
+// T is a type.
+type T struct{}
+
+// NewT returns a T.
+func NewT() *T { return nil }
+
+// M is a method.
+func (*T) M() {}
+
+// F is a function.
+func F() {}
+-- small/small.go --
+// Package small has one symbol.
+package small
+
+// F is a function.
+func F() {}
+`, func(cfg *ServerConfig, _ *GenerateOptions) { cfg.GlanceThreshold = 3 })
+
+	page, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<details tabindex="-1" id="pkg-glance" class="Documentation-glance" data-pkgsite-noindex="" data-nosnippet="">`,
+		`<a href="#pkg-glance" data-gtmc="doc outline link">`,
+		`<td><a href="#NewT">NewT</a></td>`,
+	} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("the page of m does not contain %s", want)
+		}
+	}
+	small, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "small", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(small), "pkg-glance") {
+		t.Error("the page of a package under the threshold has an At a glance section")
+	}
+}
+
+// canceler is a page consumer that cancels a generation once it has seen
+// a number of pages.
+type canceler struct {
+	after  int
+	cancel context.CancelFunc
+	pages  int
+}
+
+func (c *canceler) consumePage(*pageEvent) error {
+	c.pages++
+	if c.pages == c.after {
+		c.cancel()
+	}
+	return nil
+}
+
+func (c *canceler) finish(context.Context, *siteOutput) error { return nil }
+
+func TestGenerateStaticSiteCancel(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, siteTxtar(40))
+	outDir := filepath.Join(t.TempDir(), "site")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &canceler{after: 10, cancel: cancel}
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	_, err := generateStaticSite(ctx, cfg, GenerateOptions{OutDir: outDir, Atomic: true, SourcePages: true}, pageConsumers{c})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want one wrapping context.Canceled", err)
+	}
+	if !strings.Contains(err.Error(), "stopped after ") {
+		t.Errorf("error %q does not say how many pages were rendered", err)
+	}
+	// The page being rendered is finished, and those of its unit, but no
+	// more.
+	if c.pages > c.after+10 {
+		t.Errorf("%d pages were rendered after the generation was canceled", c.pages-c.after)
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Errorf("canceled atomic run: output directory: got %v, want not exist", err)
+	}
+}
+
+// generateTestSite writes the txtar archive to a temporary module directory,
+// generates a static site for it, and returns the output directory. If
+// modify is non-nil, it is applied to the configuration and the options
+// first.
+func generateTestSite(t *testing.T, txtar string, modify func(*ServerConfig, *GenerateOptions)) string {
+	t.Helper()
+	testenv.MustHaveExecPath(t, "go")
+
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, txtar)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{modDir},
+		UseListedMods: true,
+	}
+	opts := GenerateOptions{OutDir: outDir}
+	if modify != nil {
+		modify(&cfg, &opts)
+	}
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+		t.Fatal(err)
+	}
+	return outDir
+}
+
+// checkInternalLinks verifies that every relative link in the generated HTML
+// whose target lies under the site path prefix resolves to a generated page.
+// Version-qualified links (containing "@") are not checked.
+func checkInternalLinks(t *testing.T, outDir, prefix string) {
+	t.Helper()
+	err := filepath.WalkDir(outDir, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(fpath) != ".html" {
+			return err
+		}
+		f, err := os.Open(fpath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		doc, err := nethtml.Parse(f)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(outDir, filepath.Dir(fpath))
+		var walk func(*nethtml.Node)
+		walk = func(n *nethtml.Node) {
+			if n.Type == nethtml.ElementNode && n.Data == "a" {
+				for _, a := range n.Attr {
+					if a.Key != "href" || !strings.HasPrefix(a.Val, ".") {
+						continue
+					}
+					target, _, _ := strings.Cut(a.Val, "?")
+					target, _, _ = strings.Cut(target, "#")
+					sitePath := path.Join(filepath.ToSlash(rel), target)
+					if !strings.HasPrefix(sitePath+"/", prefix) || strings.Contains(sitePath, "@") {
+						continue
+					}
+					if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(sitePath), "index.html")); err != nil {
+						t.Errorf("%s: broken link %q", fpath, a.Val)
+					}
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
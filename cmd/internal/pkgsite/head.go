@@ -0,0 +1,179 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Everything the generator adds to a page's <head> goes through a
+// headManager. Each feature registers a named fragment; the manager writes
+// the fragments at the start of <head>, each wrapped in marker comments:
+//
+//	<!--pkgsite:begin csp--><meta http-equiv="Content-Security-Policy" ...><!--pkgsite:end csp-->
+//
+// Processing a page that already contains managed fragments, such as
+// existing output or a page run through the post-processor twice, replaces
+// them instead of adding copies.
+
+const (
+	headBeginMarker = "pkgsite:begin "
+	headEndMarker   = "pkgsite:end "
+)
+
+// Orders of the fragments, which are written in increasing order. The CSP
+// must come first so that it covers everything after it.
+const (
+	headOrderCSP      = 0
+	headOrderBranding = 10
+	headOrderStyle    = 50
+	headOrderScript   = 90
+)
+
+// A headFragment is a named group of nodes for <head>.
+type headFragment struct {
+	name  string
+	order int
+	nodes []*html.Node
+}
+
+// A headManager collects the head fragments of one page.
+type headManager struct {
+	fragments map[string]headFragment
+}
+
+// register adds the fragment with the given name, replacing any earlier
+// fragment of that name.
+func (m *headManager) register(name string, order int, nodes ...*html.Node) {
+	if m.fragments == nil {
+		m.fragments = map[string]headFragment{}
+	}
+	m.fragments[name] = headFragment{name: name, order: order, nodes: nodes}
+}
+
+// sorted returns the fragments ordered by order, then name.
+func (m *headManager) sorted() []headFragment {
+	var fs []headFragment
+	for _, f := range m.fragments {
+		fs = append(fs, f)
+	}
+	sort.Slice(fs, func(i, j int) bool {
+		if fs[i].order != fs[j].order {
+			return fs[i].order < fs[j].order
+		}
+		return fs[i].name < fs[j].name
+	})
+	return fs
+}
+
+// apply removes the managed fragments already in head and inserts the
+// registered ones at its start.
+func (m *headManager) apply(head *html.Node) {
+	removeManagedFragments(head)
+	first := head.FirstChild
+	for _, f := range m.sorted() {
+		head.InsertBefore(&html.Node{Type: html.CommentNode, Data: headBeginMarker + f.name}, first)
+		for _, n := range f.nodes {
+			head.InsertBefore(n, first)
+		}
+		head.InsertBefore(&html.Node{Type: html.CommentNode, Data: headEndMarker + f.name}, first)
+	}
+}
+
+// appendFragment removes the managed fragment named name from head and
+// adds nodes as that fragment at the end of head. It is for fragments
+// added to a page after it is written, whose order does not matter.
+func appendFragment(head *html.Node, name string, nodes ...*html.Node) {
+	removeFragments(head, func(n string) bool { return n == name })
+	head.AppendChild(&html.Node{Type: html.CommentNode, Data: headBeginMarker + name})
+	for _, n := range nodes {
+		head.AppendChild(n)
+	}
+	head.AppendChild(&html.Node{Type: html.CommentNode, Data: headEndMarker + name})
+}
+
+// removeManagedFragments removes the children of head between begin and
+// end markers, and the markers themselves. A begin marker without an end
+// marker removes only itself.
+func removeManagedFragments(head *html.Node) {
+	removeFragments(head, func(string) bool { return true })
+}
+
+// removeFragments is like removeManagedFragments, but removes only the
+// fragments whose names match.
+func removeFragments(head *html.Node, match func(name string) bool) {
+	for c := head.FirstChild; c != nil; {
+		name, ok := markerName(c, headBeginMarker)
+		if !ok || !match(name) {
+			c = c.NextSibling
+			continue
+		}
+		end := c.NextSibling
+		for end != nil {
+			if n, ok := markerName(end, headEndMarker); ok && n == name {
+				break
+			}
+			end = end.NextSibling
+		}
+		if end == nil {
+			next := c.NextSibling
+			head.RemoveChild(c)
+			c = next
+			continue
+		}
+		stop := end.NextSibling
+		for n := c; n != stop; {
+			next := n.NextSibling
+			head.RemoveChild(n)
+			n = next
+		}
+		c = stop
+	}
+}
+
+// markerName returns the fragment name of a marker comment with the given
+// prefix.
+func markerName(n *html.Node, prefix string) (string, bool) {
+	if n.Type != html.CommentNode || !strings.HasPrefix(n.Data, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(n.Data, prefix), true
+}
+
+// cspMeta returns the Content-Security-Policy <meta> element, with the
+// given directives added to cspContent.
+func cspMeta(directives ...string) *html.Node {
+	content := cspContent
+	for _, d := range directives {
+		content += "; " + d
+	}
+	return &html.Node{
+		Type: html.ElementNode,
+		Data: "meta",
+		Attr: []html.Attribute{
+			{Key: "http-equiv", Val: "Content-Security-Policy"},
+			{Key: "content", Val: content},
+		},
+	}
+}
+
+// removeCSPMeta removes the Content-Security-Policy <meta> elements of the
+// document, wherever they are, so that the page has only the managed one.
+// A policy in the content of a page, such as its documentation, would
+// otherwise be enforced along with it.
+func removeCSPMeta(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && c.Namespace == "" && c.Data == "meta" && strings.EqualFold(strings.TrimSpace(attrValue(c, "http-equiv")), "content-security-policy") {
+			n.RemoveChild(c)
+		} else {
+			removeCSPMeta(c)
+		}
+		c = next
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestHeadManager(t *testing.T) {
+	meta := func(name string) *html.Node {
+		return &html.Node{Type: html.ElementNode, Data: "meta", Attr: []html.Attribute{{Key: "name", Val: name}}}
+	}
+	doc, err := html.Parse(strings.NewReader(`<html><head>` +
+		`<!--pkgsite:begin old--><meta name="stale"><!--pkgsite:end old-->` +
+		`<title>T</title><!--pkgsite:begin b--><meta name="b0"><!--pkgsite:end b-->` +
+		`<!--pkgsite:begin unterminated--><link rel="x"></head></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m headManager
+	m.register("b", 10, meta("b1"))
+	m.register("a", 10, meta("a"))
+	m.register("first", 0, meta("first"))
+	m.register("b", 10, meta("b2"))
+	m.apply(findElement(doc, "head"))
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, findElement(doc, "head")); err != nil {
+		t.Fatal(err)
+	}
+	want := `<head>` +
+		`<!--pkgsite:begin first--><meta name="first"/><!--pkgsite:end first-->` +
+		`<!--pkgsite:begin a--><meta name="a"/><!--pkgsite:end a-->` +
+		`<!--pkgsite:begin b--><meta name="b2"/><!--pkgsite:end b-->` +
+		`<title>T</title><link rel="x"/></head>`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestProcessHTMLIdempotent(t *testing.T) {
+	check := func(t *testing.T, page []byte, urlPath string) {
+		t.Helper()
+		once, err := processHTML(page, urlPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		twice, err := processHTML(once, urlPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(once, twice) {
+			t.Errorf("%s: processing twice changed the page", urlPath)
+		}
+		if n := bytes.Count(twice, []byte(`http-equiv="Content-Security-Policy"`)); n != 1 {
+			t.Errorf("%s: got %d CSP meta tags, want 1", urlPath, n)
+		}
+	}
+
+	check(t, []byte(`<html><head><title>T</title><link href="/static/a.css"></head>`+
+		`<body><a href="/about">About</a><script>loadScript('/static/a.js')</script></body></html>`), "/example.com/m")
+
+	// Generated pages are the output of processHTML; processing them again
+	// must leave them unchanged.
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+-- a/a.go --
+// Package a is documented.
+package a
+
+// F is a function.
+func F() {}
+`, nil)
+	// Every generated page has the default branding and the search script.
+	branding, err := newSiteBranding(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, urlPath := range []string{"/", "/about", "/example.com/m", "/example.com/m/a"} {
+		file, err := urlPathToFilePath(urlPath, outDir, pagePathKind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The generated page has already been processed once.
+		twice, err := processHTML(page, urlPath, nil, branding.transform(), searchTransform())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(page, twice) {
+			t.Errorf("%s: reprocessing changed the page", urlPath)
+		}
+		check(t, page, urlPath)
+	}
+}
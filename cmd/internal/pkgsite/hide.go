@@ -0,0 +1,432 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+)
+
+// Hiding withholds the documentation of individual symbols without
+// changing their source. Like redaction, it applies to the Go files of a
+// package as they are loaded, before anything is rendered from them, so a
+// hidden symbol is hidden from every page and export derived from the
+// documentation: the package page, the search and symbol indexes and the
+// Markdown export. Source pages still show the files as they are.
+//
+// A withheld symbol keeps its declaration, whose doc comment is replaced
+// by a note and whose other comments, such as those of struct fields, are
+// removed. A removed symbol is deleted from the package, so that nothing
+// links to it. Either way, its examples are removed. The methods of a
+// hidden type are hidden with it; a method can also be hidden by itself,
+// as "T.M".
+
+// A HideMode says how the documentation of a symbol is hidden.
+type HideMode string
+
+const (
+	// HideWithhold lists the declaration of the symbol with a note in place
+	// of its documentation.
+	HideWithhold HideMode = "withhold"
+	// HideRemove removes the symbol from the documentation.
+	HideRemove HideMode = "remove"
+)
+
+// withheldDoc is the doc comment of a withheld symbol.
+const withheldDoc = "// Documentation withheld."
+
+// A HiddenSymbol is a symbol of a package whose documentation is hidden.
+type HiddenSymbol struct {
+	// Name is the name of the symbol, such as "F" or "T", or "T.M" for a
+	// method.
+	Name string `json:"name"`
+	// Mode says how the symbol is hidden. If empty, it is HideWithhold.
+	Mode HideMode `json:"mode,omitempty"`
+}
+
+// LoadHiddenSymbols reads a JSON file holding an object that maps import
+// paths to arrays of hidden symbols.
+func LoadHiddenSymbols(file string) (map[string][]HiddenSymbol, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var symbols map[string][]HiddenSymbol
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&symbols); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return symbols, nil
+}
+
+// A hider hides symbols and records the hidings applied. It is safe for
+// concurrent use.
+type hider struct {
+	modes map[string]map[string]HideMode // by import path, then name
+
+	mu      sync.Mutex
+	applied map[Hiding]bool
+}
+
+// newHider validates symbols and returns a hider for them, or nil if there
+// are none.
+func newHider(symbols map[string][]HiddenSymbol) (*hider, error) {
+	if len(symbols) == 0 {
+		return nil, nil
+	}
+	hd := &hider{modes: map[string]map[string]HideMode{}, applied: map[Hiding]bool{}}
+	for importPath, syms := range symbols {
+		modes := map[string]HideMode{}
+		for _, s := range syms {
+			typ, method, isMethod := strings.Cut(s.Name, ".")
+			if !token.IsIdentifier(typ) || isMethod && !token.IsIdentifier(method) {
+				return nil, fmt.Errorf("hidden symbol %q of %s: want a name such as F, T or T.M", s.Name, importPath)
+			}
+			mode := s.Mode
+			switch mode {
+			case "":
+				mode = HideWithhold
+			case HideWithhold, HideRemove:
+			default:
+				return nil, fmt.Errorf("hidden symbol %s of %s: mode %q: want %s or %s", s.Name, importPath, s.Mode, HideWithhold, HideRemove)
+			}
+			if m, ok := modes[s.Name]; ok && m != mode {
+				return nil, fmt.Errorf("hidden symbol %s of %s is listed with modes %s and %s", s.Name, importPath, m, mode)
+			}
+			modes[s.Name] = mode
+		}
+		if len(modes) > 0 {
+			hd.modes[importPath] = modes
+		}
+	}
+	return hd, nil
+}
+
+// loadOptions adds the hider's rewriting to opts, after any rewriting
+// opts already does.
+func (hd *hider) loadOptions(opts fetch.LoadOptions) fetch.LoadOptions {
+	if hd != nil {
+		rewrite := opts.RewriteFiles
+		opts.RewriteFiles = func(modulePath, importPath string, files map[string]*ast.File) {
+			if rewrite != nil {
+				rewrite(modulePath, importPath, files)
+			}
+			hd.rewriteFiles(importPath, files)
+		}
+	}
+	return opts
+}
+
+// hidings returns the hidings applied, sorted.
+func (hd *hider) hidings() []Hiding {
+	if hd == nil {
+		return nil
+	}
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+	var hs []Hiding
+	for h := range hd.applied {
+		hs = append(hs, h)
+	}
+	sort.Slice(hs, func(i, j int) bool {
+		if hs[i].Package != hs[j].Package {
+			return hs[i].Package < hs[j].Package
+		}
+		return hs[i].Symbol < hs[j].Symbol
+	})
+	return hs
+}
+
+// unmatched returns the hidden symbols, as importPath.Name, that no
+// package loaded had, sorted.
+func (hd *hider) unmatched() []string {
+	if hd == nil {
+		return nil
+	}
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+	found := map[string]bool{}
+	for h := range hd.applied {
+		found[h.Package+"."+h.Symbol] = true
+	}
+	var syms []string
+	for importPath, modes := range hd.modes {
+		for name := range modes {
+			if !found[importPath+"."+name] {
+				syms = append(syms, importPath+"."+name)
+			}
+		}
+	}
+	sort.Strings(syms)
+	return syms
+}
+
+// modeOf returns the mode of the symbol name, which may be "T.M", among
+// modes, or "" if it is not hidden. A method is hidden with its type.
+func modeOf(modes map[string]HideMode, name string) HideMode {
+	if typ, _, ok := strings.Cut(name, "."); ok {
+		if m := modes[typ]; m != "" {
+			return m
+		}
+	}
+	return modes[name]
+}
+
+func (hd *hider) rewriteFiles(importPath string, files map[string]*ast.File) {
+	modes := hd.modes[importPath]
+	if len(modes) == 0 {
+		return
+	}
+	record := func(name string, mode HideMode) {
+		hd.mu.Lock()
+		hd.applied[Hiding{Package: importPath, Symbol: name, Mode: string(mode)}] = true
+		hd.mu.Unlock()
+	}
+	for name, f := range files {
+		h := fileHider{file: f, removed: map[*ast.CommentGroup]bool{}}
+		// Test files only contribute examples to the documentation.
+		test := strings.HasSuffix(name, "_test.go")
+		var decls []ast.Decl
+		for _, d := range f.Decls {
+			switch {
+			case test && isHiddenExample(modes, d):
+				h.drop(d)
+			case test || h.hideDecl(d, modes, record):
+				decls = append(decls, d)
+			}
+		}
+		f.Decls = decls
+		h.dropComments()
+	}
+}
+
+// isHiddenExample reports whether d is an example function of a hidden
+// symbol, or of a method of a hidden type.
+func isHiddenExample(modes map[string]HideMode, d ast.Decl) bool {
+	fd, ok := d.(*ast.FuncDecl)
+	if !ok || fd.Recv != nil {
+		return false
+	}
+	suffix, ok := strings.CutPrefix(fd.Name.Name, "Example")
+	if !ok {
+		return false
+	}
+	for name := range modes {
+		sym := strings.ReplaceAll(name, ".", "_")
+		if suffix == sym || strings.HasPrefix(suffix, sym+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// A fileHider hides the symbols of the declarations of a file.
+type fileHider struct {
+	file    *ast.File
+	removed map[*ast.CommentGroup]bool // comments to remove from the file
+}
+
+// hideDecl hides the symbols of d among modes, and reports whether d is
+// to be kept.
+func (h *fileHider) hideDecl(d ast.Decl, modes map[string]HideMode, record func(string, HideMode)) bool {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		name := d.Name.Name
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			name = recvTypeName(d.Recv.List[0].Type) + "." + name
+		}
+		mode := modeOf(modes, name)
+		switch mode {
+		case HideRemove:
+			h.drop(d)
+			record(name, mode)
+			return false
+		case HideWithhold:
+			d.Doc = h.withhold(d.Doc)
+			record(name, mode)
+		}
+	case *ast.GenDecl:
+		// A declaration of a single symbol, without parentheses, holds its
+		// doc comment.
+		single := !d.Lparen.IsValid() && len(d.Specs) == 1
+		var specs []ast.Spec
+		for _, s := range d.Specs {
+			var doc **ast.CommentGroup
+			var mode HideMode
+			switch s := s.(type) {
+			case *ast.TypeSpec:
+				if mode = modes[s.Name.Name]; mode != "" {
+					record(s.Name.Name, mode)
+				}
+				doc = &s.Doc
+			case *ast.ValueSpec:
+				if !h.hideValues(s, modes, record) {
+					continue
+				}
+				for _, n := range s.Names {
+					if modes[n.Name] == HideWithhold {
+						mode = HideWithhold
+					}
+				}
+				doc = &s.Doc
+			}
+			switch mode {
+			case HideRemove:
+				h.drop(s)
+				continue
+			case HideWithhold:
+				h.dropInner(s)
+				if single {
+					doc = &d.Doc
+				}
+				*doc = h.withhold(*doc)
+			}
+			specs = append(specs, s)
+		}
+		if len(specs) == 0 && len(d.Specs) > 0 {
+			h.drop(d)
+			return false
+		}
+		d.Specs = specs
+	}
+	return true
+}
+
+// hideValues removes the names of s that are to be removed, with their
+// values, and reports whether any names are left. A name whose value
+// cannot be told apart from the others, as in "var a, b = f()", becomes
+// the blank identifier instead.
+func (h *fileHider) hideValues(s *ast.ValueSpec, modes map[string]HideMode, record func(string, HideMode)) bool {
+	var names []*ast.Ident
+	var values []ast.Expr
+	paired := len(s.Values) == len(s.Names)
+	for i, n := range s.Names {
+		mode := modes[n.Name]
+		if mode != "" {
+			record(n.Name, mode)
+		}
+		if mode != HideRemove {
+			names = append(names, n)
+			if paired {
+				values = append(values, s.Values[i])
+			}
+			continue
+		}
+		if !paired && len(s.Values) > 0 {
+			names = append(names, ast.NewIdent("_"))
+		}
+	}
+	if len(names) == 0 {
+		h.drop(s)
+		return false
+	}
+	s.Names = names
+	if paired {
+		s.Values = values
+	}
+	return true
+}
+
+// withhold returns the doc comment replacing doc, which may be nil.
+func (h *fileHider) withhold(doc *ast.CommentGroup) *ast.CommentGroup {
+	if doc == nil {
+		return &ast.CommentGroup{List: []*ast.Comment{{Text: withheldDoc}}}
+	}
+	// The comment group is also among those of the file, so it is
+	// replaced in place.
+	doc.List = []*ast.Comment{{Slash: doc.Pos(), Text: withheldDoc}}
+	return doc
+}
+
+// drop removes the comments of the node n, which is removed, from the
+// file.
+func (h *fileHider) drop(n ast.Node) {
+	var doc *ast.CommentGroup
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		doc = n.Doc
+	case *ast.GenDecl:
+		doc = n.Doc
+	case *ast.TypeSpec:
+		doc = n.Doc
+	case *ast.ValueSpec:
+		doc = n.Doc
+	}
+	if doc != nil {
+		h.removed[doc] = true
+	}
+	h.dropRange(n.Pos(), n.End())
+}
+
+// dropInner removes the comments within the spec s, such as those of the
+// fields of a struct type, which are printed with its declaration.
+func (h *fileHider) dropInner(s ast.Spec) {
+	ast.Inspect(s, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Field:
+			n.Doc, n.Comment = nil, nil
+		case *ast.TypeSpec:
+			n.Comment = nil
+		case *ast.ValueSpec:
+			n.Comment = nil
+		}
+		return true
+	})
+	h.dropRange(s.Pos(), s.End())
+}
+
+// dropRange removes the comments of the file from pos to end.
+func (h *fileHider) dropRange(pos, end token.Pos) {
+	for _, cg := range h.file.Comments {
+		if cg.Pos() >= pos && cg.End() <= end {
+			h.removed[cg] = true
+		}
+	}
+}
+
+// dropComments removes the comments to be removed from the file.
+func (h *fileHider) dropComments() {
+	if len(h.removed) == 0 {
+		return
+	}
+	var comments []*ast.CommentGroup
+	for _, cg := range h.file.Comments {
+		if !h.removed[cg] {
+			comments = append(comments, cg)
+		}
+	}
+	h.file.Comments = comments
+}
+
+// recvTypeName returns the name of the type of a method receiver, without
+// its pointer or type parameters.
+func recvTypeName(x ast.Expr) string {
+	for {
+		switch t := x.(type) {
+		case *ast.StarExpr:
+			x = t.X
+		case *ast.ParenExpr:
+			x = t.X
+		case *ast.IndexExpr:
+			x = t.X
+		case *ast.IndexListExpr:
+			x = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
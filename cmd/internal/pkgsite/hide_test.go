@@ -0,0 +1,257 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestHideFiles(t *testing.T) {
+	hd, err := newHider(map[string][]HiddenSymbol{
+		"example.com/m/p": {
+			{Name: "F"},
+			{Name: "T"},
+			{Name: "U", Mode: HideRemove},
+			{Name: "V.Hidden", Mode: HideRemove},
+			{Name: "B", Mode: HideRemove},
+			{Name: "D", Mode: HideRemove},
+			{Name: "Missing"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const src = `// Package p does things.
+package p
+
+// F does secret things.
+func F() {}
+
+// G does public things.
+func G() {}
+
+// T is a secret type.
+type T struct {
+	// X is a secret field.
+	X int // secret
+}
+
+// M is a secret method.
+func (t *T) M() {}
+
+// U is removed.
+type U int
+
+// N is a method of U.
+func (U) N() {}
+
+// V is a type.
+type V int
+
+// Hidden is removed.
+func (V) Hidden() {}
+
+// Values.
+const (
+	// A is kept.
+	A = 1
+	// B is removed.
+	B = 2
+)
+
+var C, D = 3, 4
+`
+	const testSrc = `package p_test
+
+func ExampleF() {}
+
+func ExampleG() {}
+
+func ExampleT_M() {}
+
+func ExampleV() {}
+
+func ExampleV_Hidden_second() {}
+`
+	const want = `// Package p does things.
+package p
+
+// Documentation withheld.
+func F() {}
+
+// G does public things.
+func G() {}
+
+// Documentation withheld.
+type T struct {
+	X int
+}
+
+// Documentation withheld.
+func (t *T) M() {}
+
+// V is a type.
+type V int
+
+// Values.
+const (
+	// A is kept.
+	A = 1
+)
+
+var C = 3
+`
+	const wantTest = `package p_test
+
+func ExampleG() {}
+
+func ExampleV() {}
+`
+	fset := token.NewFileSet()
+	files := map[string]*ast.File{}
+	for name, src := range map[string]string{"p.go": src, "p_test.go": testSrc} {
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = f
+	}
+	hd.rewriteFiles("example.com/m/p", files)
+	for name, want := range map[string]string{"p.go": want, "p_test.go": wantTest} {
+		var b strings.Builder
+		if err := format.Node(&b, fset, files[name]); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, b.String()); diff != "" {
+			t.Errorf("%s mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+
+	wantHidings := []Hiding{
+		{Package: "example.com/m/p", Symbol: "B", Mode: "remove"},
+		{Package: "example.com/m/p", Symbol: "D", Mode: "remove"},
+		{Package: "example.com/m/p", Symbol: "F", Mode: "withhold"},
+		{Package: "example.com/m/p", Symbol: "T", Mode: "withhold"},
+		{Package: "example.com/m/p", Symbol: "T.M", Mode: "withhold"},
+		{Package: "example.com/m/p", Symbol: "U", Mode: "remove"},
+		{Package: "example.com/m/p", Symbol: "U.N", Mode: "remove"},
+		{Package: "example.com/m/p", Symbol: "V.Hidden", Mode: "remove"},
+	}
+	if diff := cmp.Diff(wantHidings, hd.hidings()); diff != "" {
+		t.Errorf("hidings mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"example.com/m/p.Missing"}, hd.unmatched()); diff != "" {
+		t.Errorf("unmatched mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewHiderErrors(t *testing.T) {
+	for _, syms := range [][]HiddenSymbol{
+		{{Name: ""}},
+		{{Name: "T.M.X"}},
+		{{Name: "p.F"}, {Name: "1F"}},
+		{{Name: "F", Mode: "delete"}},
+		{{Name: "F"}, {Name: "F", Mode: HideRemove}},
+	} {
+		if _, err := newHider(map[string][]HiddenSymbol{"example.com/m": syms}); err == nil {
+			t.Errorf("newHider(%+v): got nil error", syms)
+		}
+	}
+}
+
+func TestGenerateStaticSiteHiddenSymbols(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things. See [Secret] and [Gone].
+package m
+
+// Secret does something confidential.
+func Secret() {}
+
+// Gone is a type nobody may know about.
+type Gone struct{}
+
+// Method does something else confidential.
+func (Gone) Method() {}
+
+// Public is documented.
+func Public() {}
+-- example_test.go --
+package m_test
+
+func ExampleSecret() {
+	// Confidential example.
+}
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{modDir},
+		UseListedMods: true,
+		HiddenSymbols: map[string][]HiddenSymbol{
+			"example.com/m": {{Name: "Secret"}, {Name: "Gone", Mode: HideRemove}},
+		},
+	}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, EmitMarkdown: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"example.com/m/index.html", "example.com/m/doc.md", searchIndexFile} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := string(data)
+		for _, secret := range []string{"confidential", "Confidential", "Method", "#Gone", `id="Gone"`} {
+			if strings.Contains(page, secret) {
+				t.Errorf("%s contains %q", file, secret)
+			}
+		}
+		if !strings.Contains(page, "Public") {
+			t.Errorf("%s does not document Public", file)
+		}
+	}
+	page, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`id="Secret"`, "Documentation withheld."} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("page does not contain %q", want)
+		}
+	}
+	// The doc link to the removed type is left as text, as one to a
+	// symbol that does not exist.
+	if !strings.Contains(string(page), `See <a href="#Secret">Secret</a> and [Gone].`) {
+		t.Error("package documentation does not link to Secret only")
+	}
+	want := []Hiding{
+		{Package: "example.com/m", Symbol: "Gone", Mode: "remove"},
+		{Package: "example.com/m", Symbol: "Gone.Method", Mode: "remove"},
+		{Package: "example.com/m", Symbol: "Secret", Mode: "withhold"},
+	}
+	if diff := cmp.Diff(want, report.HiddenSymbols); diff != "" {
+		t.Errorf("hidden symbols mismatch (-want +got):\n%s", diff)
+	}
+	if len(report.BrokenLinks) > 0 {
+		t.Errorf("broken links: %+v", report.BrokenLinks)
+	}
+}
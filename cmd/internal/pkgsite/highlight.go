@@ -0,0 +1,318 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// With GenerateOptions.HighlightTheme, the generator highlights the Go code
+// of source pages, declarations and examples: it wraps keywords, string
+// and character literals, numbers and comments in spans of the classes
+// "keyword", "string", "number" and "comment", the last of which the
+// frontend already puts around the comments of declarations and examples.
+// A theme is a style sheet for these classes, with colors for the light and
+// dark color schemes, and is written to highlightDir only if it is
+// selected. GenerateOptions.HighlightCSS is a style sheet loaded after the
+// theme, to override it.
+
+// highlightDir is the directory of the output holding the style sheets of
+// the highlight theme.
+const highlightDir = "static/highlight"
+
+// highlightThemes holds the built-in themes, as highlight/<name>.css.
+//
+//go:embed highlight/*.css
+var highlightThemes embed.FS
+
+// defaultHighlightTheme is the theme used with a HighlightCSS and no
+// HighlightTheme.
+const defaultHighlightTheme = "default"
+
+// A highlighter highlights the code of pages with the style sheets of a
+// theme.
+type highlighter struct {
+	styles []string          // site paths of the style sheets, in order
+	files  map[string][]byte // style sheets to write, by site path
+}
+
+// newHighlighter returns the highlighter for the built-in theme and the
+// style sheet file, which may be empty, or nil if both are.
+func newHighlighter(theme, file string) (*highlighter, error) {
+	if theme == "" && file == "" {
+		return nil, nil
+	}
+	if theme == "" {
+		theme = defaultHighlightTheme
+	}
+	data, err := highlightThemes.ReadFile("highlight/" + theme + ".css")
+	if err != nil {
+		return nil, fmt.Errorf("unknown highlight theme %q; want one of %s", theme, strings.Join(highlightThemeNames(), ", "))
+	}
+	h := &highlighter{files: map[string][]byte{}}
+	add := func(sitePath string, data []byte) {
+		h.styles = append(h.styles, sitePath)
+		h.files[sitePath] = data
+	}
+	add(path.Join(highlightDir, theme+".css"), data)
+	if file != "" {
+		if !strings.EqualFold(filepath.Ext(file), ".css") {
+			return nil, fmt.Errorf("highlight style sheet %s is not a .css file", file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading highlight style sheet: %w", err)
+		}
+		// As the favicons of the branding, the file name includes a hash of
+		// the contents, with LF line endings.
+		sum := sha256.Sum256(normalizeText(filepath.ToSlash(file), data, false))
+		add(path.Join(highlightDir, "custom-"+hex.EncodeToString(sum[:6])+".css"), data)
+	}
+	return h, nil
+}
+
+// highlightThemeNames returns the names of the built-in themes, sorted.
+func highlightThemeNames() []string {
+	entries, _ := highlightThemes.ReadDir("highlight")
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".css"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeFiles writes the style sheets of h to out, without the rules that
+// the pinned color scheme leaves out, and records them in assets.
+func (h *highlighter) writeFiles(out *siteOutput, assets *assetGraph, scheme *colorScheme) error {
+	for sitePath, data := range h.files {
+		data = scheme.filterCSS(data)
+		file := filepath.Join(out.dir, filepath.FromSlash(sitePath))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return err
+		}
+		if err := out.writeFile(file, data); err != nil {
+			return err
+		}
+		assets.addFile(sitePath, data)
+	}
+	return nil
+}
+
+// transform returns the page transform highlighting the lines of source
+// pages and the code of declarations and examples, and loading the style
+// sheets of pages with code.
+func (h *highlighter) transform() pageTransform {
+	return func(doc *html.Node, head *headManager) {
+		var lines, blocks []*html.Node
+		var walk func(n *html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode {
+				switch {
+				case n.Data == "td" && hasClass(n, "Source-text"):
+					lines = append(lines, n)
+					return
+				case n.Data == "pre" && (hasClass(n, "Documentation-exampleCode") || n.Parent != nil && hasClass(n.Parent, "Documentation-declaration")):
+					blocks = append(blocks, n)
+					return
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+		if len(lines) == 0 && len(blocks) == 0 {
+			return
+		}
+		highlightLines(lines)
+		for _, b := range blocks {
+			highlightBlock(b)
+		}
+		var links []*html.Node
+		for _, s := range h.styles {
+			links = append(links, &html.Node{
+				Type:     html.ElementNode,
+				Data:     "link",
+				DataAtom: atom.Link,
+				Attr: []html.Attribute{
+					{Key: "rel", Val: "stylesheet"},
+					{Key: "href", Val: "/" + s},
+				},
+			})
+		}
+		head.register("highlight", headOrderStyle, links...)
+	}
+}
+
+// highlightLines highlights the cells of the lines of a source file, in
+// order, which each hold the text of a line. The file is scanned as a
+// whole, so that comments and raw strings can span lines.
+func highlightLines(cells []*html.Node) {
+	texts := make([]string, len(cells))
+	for i, c := range cells {
+		texts[i] = nodeText(c)
+	}
+	src := strings.Join(texts, "\n")
+	spans := goTokenSpans(src)
+	start := 0
+	for i, c := range cells {
+		end := start + len(texts[i])
+		replaceChildren(c, spanNodes(src, start, end, spans))
+		start = end + 1
+	}
+}
+
+// highlightBlock highlights the text of the preformatted code block pre.
+// The text outside of comments and links is scanned piece by piece, as the
+// frontend has already split it there.
+func highlightBlock(pre *html.Node) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			switch {
+			case c.Type == html.TextNode:
+				for _, s := range spanNodes(c.Data, 0, len(c.Data), goTokenSpans(c.Data)) {
+					n.InsertBefore(s, c)
+				}
+				n.RemoveChild(c)
+			case c.Type == html.ElementNode && c.Data != "a" && !hasClass(c, "comment"):
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(pre)
+}
+
+// A tokenSpan is the range of bytes of a token to highlight, and its class.
+type tokenSpan struct {
+	start, end int
+	class      string
+}
+
+// goTokenSpans returns the spans of the tokens of the Go code src to
+// highlight, in order. Code that does not scan, such as part of a
+// declaration, is highlighted as far as possible.
+func goTokenSpans(src string) []tokenSpan {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, scanner.ScanComments)
+	// until returns the offset after the first sep at or after from, or
+	// the end of src.
+	until := func(from int, sep string) int {
+		if i := strings.Index(src[from:], sep); i >= 0 {
+			return from + i + len(sep)
+		}
+		return len(src)
+	}
+	var spans []tokenSpan
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		start := file.Offset(pos)
+		var class string
+		end := start + len(lit)
+		switch {
+		case tok.IsKeyword():
+			class, end = "keyword", start+len(tok.String())
+		case tok == token.STRING || tok == token.CHAR:
+			class = "string"
+			// The scanner removes carriage returns from raw strings.
+			if strings.HasPrefix(lit, "`") {
+				end = until(start+1, "`")
+			}
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			class = "number"
+		case tok == token.COMMENT:
+			// It also removes them from comments, and the newline ending a
+			// line comment.
+			class = "comment"
+			if strings.HasPrefix(lit, "//") {
+				end = until(start, "\n")
+				if end > start && src[end-1] == '\n' {
+					end--
+				}
+			} else {
+				end = until(start+2, "*/")
+			}
+		}
+		if class != "" && start < end && end <= len(src) {
+			spans = append(spans, tokenSpan{start, end, class})
+		}
+	}
+	return spans
+}
+
+// spanNodes returns the nodes of src[start:end], with the parts of the
+// spans in it wrapped in span elements of their classes.
+func spanNodes(src string, start, end int, spans []tokenSpan) []*html.Node {
+	var nodes []*html.Node
+	text := func(s string) {
+		if s != "" {
+			nodes = append(nodes, &html.Node{Type: html.TextNode, Data: s})
+		}
+	}
+	i := sort.Search(len(spans), func(i int) bool { return spans[i].end > start })
+	at := start
+	for ; i < len(spans) && spans[i].start < end; i++ {
+		s := spans[i]
+		from, to := max(s.start, at), min(s.end, end)
+		if from >= to {
+			continue
+		}
+		text(src[at:from])
+		span := &html.Node{
+			Type:     html.ElementNode,
+			Data:     "span",
+			DataAtom: atom.Span,
+			Attr:     []html.Attribute{{Key: "class", Val: s.class}},
+		}
+		span.AppendChild(&html.Node{Type: html.TextNode, Data: src[from:to]})
+		nodes = append(nodes, span)
+		at = to
+	}
+	text(src[at:end])
+	return nodes
+}
+
+// nodeText returns the text of the tree rooted at n.
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(nodeText(c))
+	}
+	return b.String()
+}
+
+// replaceChildren replaces the children of n with nodes.
+func replaceChildren(n *html.Node, nodes []*html.Node) {
+	for n.FirstChild != nil {
+		n.RemoveChild(n.FirstChild)
+	}
+	for _, c := range nodes {
+		n.AppendChild(c)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestHighlightTransform(t *testing.T) {
+	h, err := newHighlighter("default", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := func(text string) string {
+		return `<tr class="Source-line"><td class="Source-text">` + text + `</td></tr>`
+	}
+	page := `<html><head></head><body>` +
+		`<table class="Source-lines">` +
+		line(`package m // m`) +
+		line(`/* a`) +
+		line(`b */ var s = `+"`x") +
+		line("y` + &#34;z&#34; + 0x1F") +
+		`</table>` +
+		`<div class="Documentation-declaration"><pre>func <a href="#F">F</a>(n int) <span class="comment">// func</span></pre></div>` +
+		`<pre>func in a doc comment</pre>` +
+		`</body></html>`
+	got, err := processHTML([]byte(page), "/example.com/m/file/m.go", nil, h.transform())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		line(`<span class="keyword">package</span> m <span class="comment">// m</span>`),
+		line(`<span class="comment">/* a</span>`),
+		line(`<span class="comment">b */</span> <span class="keyword">var</span> s = <span class="string">` + "`x</span>"),
+		line(`<span class="string">` + "y`</span> + " + `<span class="string">&#34;z&#34;</span> + <span class="number">0x1F</span>`),
+		`<pre><span class="keyword">func</span> <a href="#F">F</a>(n int) <span class="comment">// func</span></pre>`,
+		`<pre>func in a doc comment</pre>`,
+		`<link rel="stylesheet" href="../../../../static/highlight/default.css"/>`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("page does not contain %s:\n%s", want, got)
+		}
+	}
+
+	// Pages without code load no style sheet.
+	got, err = processHTML([]byte(`<html><head></head><body><p>text</p></body></html>`), "/about", nil, h.transform())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "highlight") {
+		t.Errorf("page without code loads the highlight theme:\n%s", got)
+	}
+}
+
+func TestNewHighlighter(t *testing.T) {
+	if h, err := newHighlighter("", ""); h != nil || err != nil {
+		t.Errorf(`newHighlighter("", "") = %v, %v; want nil, nil`, h, err)
+	}
+	for _, test := range []struct {
+		theme, file, wantErr string
+	}{
+		{"neon", "", `unknown highlight theme "neon"; want one of default, high-contrast`},
+		{"", "theme.txt", "not a .css file"},
+		{"", "missing.css", "reading highlight style sheet"},
+	} {
+		_, err := newHighlighter(test.theme, test.file)
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("newHighlighter(%q, %q): got error %v, want %q", test.theme, test.file, err, test.wantErr)
+		}
+	}
+}
+
+func TestGenerateStaticSiteHighlight(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+
+// F returns 42.
+func F() int { return 42 }
+-- example_test.go --
+package m_test
+
+func ExampleF() {
+	_ = "example"
+}
+`)
+	outDir := t.TempDir()
+	custom := filepath.Join(t.TempDir(), "brand.css")
+	if err := os.WriteFile(custom, []byte(".Source-text .keyword { color: #123456; }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	generate := func(theme, css string) {
+		t.Helper()
+		cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+		opts := GenerateOptions{
+			OutDir:         outDir,
+			Prune:          true,
+			SourcePages:    true,
+			HighlightTheme: theme,
+			HighlightCSS:   css,
+		}
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(p string) bool {
+		t.Helper()
+		_, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	generate("default", "")
+	if !exists("static/highlight/default.css") {
+		t.Fatal("default theme was not written")
+	}
+
+	generate("high-contrast", custom)
+	if exists("static/highlight/default.css") {
+		t.Error("theme that is no longer selected was not pruned")
+	}
+	if !strings.Contains(read("static/highlight/high-contrast.css"), "font-weight: bold") {
+		t.Error("high-contrast theme was not written")
+	}
+	entries, err := os.ReadDir(filepath.Join(outDir, "static", "highlight"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || !strings.HasPrefix(entries[1].Name(), "high-contrast") || !strings.HasPrefix(entries[0].Name(), "custom-") {
+		t.Errorf("highlight style sheets are %v, want the custom one and high-contrast.css", entries)
+	}
+	source := read("example.com/m/file/m.go/index.html")
+	for _, want := range []string{
+		`<td class="Source-text"><span class="keyword">func</span> F() int { <span class="keyword">return</span> <span class="number">42</span> }</td>`,
+		`href="../../../../static/highlight/high-contrast.css"`,
+		`href="../../../../static/highlight/` + entries[0].Name() + `"`,
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("source page does not contain %s", want)
+		}
+	}
+	if main := read("example.com/m/index.html"); !strings.Contains(main, `<span class="string">&#34;example&#34;</span>`) {
+		t.Error("example code is not highlighted")
+	}
+
+	// Without a theme, code is not highlighted.
+	generate("", "")
+	if exists("static/highlight") {
+		t.Error("highlight style sheets were kept without a theme")
+	}
+	if strings.Contains(read("example.com/m/file/m.go/index.html"), `class="keyword"`) {
+		t.Error("source page is highlighted without a theme")
+	}
+}
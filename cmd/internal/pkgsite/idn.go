@@ -0,0 +1,115 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// Module paths whose host is an internationalized domain name can reach the
+// generator in two shapes: the ASCII (punycode, "xn--") form that the go
+// command requires in go.mod, and the Unicode form a human may type in a doc
+// comment or README link. The generated site uses the punycode form for every
+// on-disk path and URL, and the Unicode form only for display text.
+
+// canonicalUnitPath returns the canonical form of a unit path, with a
+// Unicode host element converted to punycode. Paths that are already ASCII,
+// or whose host cannot be converted, are returned unchanged.
+func canonicalUnitPath(p string) string {
+	host, rest, _ := strings.Cut(p, "/")
+	if isASCII(host) {
+		return p
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return p
+	}
+	if rest == "" && !strings.HasSuffix(p, "/") {
+		return ascii
+	}
+	return ascii + "/" + rest
+}
+
+// displayUnitPath returns the form of a unit path suitable for showing to
+// readers, with a punycode host element converted to Unicode.
+func displayUnitPath(p string) string {
+	host, rest, found := strings.Cut(p, "/")
+	if !hasPunycodeLabel(host) {
+		return p
+	}
+	uni, err := idna.Lookup.ToUnicode(host)
+	if err != nil {
+		return p
+	}
+	if !found {
+		return uni
+	}
+	return uni + "/" + rest
+}
+
+// canonicalURLPath canonicalizes the host element of a site-absolute URL
+// path such as "/bücher.example/lib?tab=doc#F", leaving the query and
+// fragment intact. Percent-encoded Unicode hosts are decoded first.
+func canonicalURLPath(u string) string {
+	if !strings.HasPrefix(u, "/") || strings.HasPrefix(u, "//") {
+		return u
+	}
+	p, suffix := u[1:], ""
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p, suffix = p[:i], p[i:]
+	}
+	host, rest, found := strings.Cut(p, "/")
+	if strings.Contains(host, "%") {
+		if h, err := url.PathUnescape(host); err == nil && utf8.ValidString(h) && !isASCII(h) {
+			host = h
+		}
+	}
+	if found {
+		host += "/" + rest
+	}
+	return "/" + canonicalUnitPath(host) + suffix
+}
+
+// displayText replaces each punycode unit path in display text with its
+// Unicode form, leaving all other text unchanged.
+func displayText(s string) string {
+	if !strings.Contains(strings.ToLower(s), "xn--") {
+		return s
+	}
+	return nonSpaceRE.ReplaceAllStringFunc(s, func(word string) string {
+		if !hasPunycodeLabel(word) {
+			return word
+		}
+		return displayUnitPath(word)
+	})
+}
+
+var nonSpaceRE = regexp.MustCompile(`\S+`)
+
+// hasPunycodeLabel reports whether the host element of p contains an
+// "xn--" label.
+func hasPunycodeLabel(p string) bool {
+	host, _, _ := strings.Cut(p, "/")
+	for _, label := range strings.Split(host, ".") {
+		if strings.HasPrefix(strings.ToLower(label), "xn--") {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import "testing"
+
+func TestCanonicalUnitPath(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"example.com/m", "example.com/m"},
+		{"bücher.example/lib", "xn--bcher-kva.example/lib"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"xn--bcher-kva.example/lib/sub", "xn--bcher-kva.example/lib/sub"},
+		{"std", "std"},
+	} {
+		if got := canonicalUnitPath(test.in); got != test.want {
+			t.Errorf("canonicalUnitPath(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestDisplayUnitPath(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"example.com/m", "example.com/m"},
+		{"xn--bcher-kva.example/lib", "bücher.example/lib"},
+		{"xn--bcher-kva.example", "bücher.example"},
+		{"example.com/xn--bcher-kva", "example.com/xn--bcher-kva"}, // only the host is converted
+	} {
+		if got := displayUnitPath(test.in); got != test.want {
+			t.Errorf("displayUnitPath(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestCanonicalURLPath(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"/bücher.example/lib", "/xn--bcher-kva.example/lib"},
+		{"/b%C3%BCcher.example/lib?tab=imports#F", "/xn--bcher-kva.example/lib?tab=imports#F"},
+		{"/xn--bcher-kva.example/lib", "/xn--bcher-kva.example/lib"},
+		{"/example.com/a%20b", "/example.com/a%20b"},
+		{"//bücher.example/lib", "//bücher.example/lib"},
+		{"https://bücher.example/lib", "https://bücher.example/lib"},
+		{"/", "/"},
+	} {
+		if got := canonicalURLPath(test.in); got != test.want {
+			t.Errorf("canonicalURLPath(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestDisplayText(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"sub package - xn--bcher-kva.example/lib/sub - Go Packages", "sub package - bücher.example/lib/sub - Go Packages"},
+		{"\n  xn--bcher-kva.example/lib\n", "\n  bücher.example/lib\n"},
+		{"example.com/m", "example.com/m"},
+	} {
+		if got := displayText(test.in); got != test.want {
+			t.Errorf("displayText(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
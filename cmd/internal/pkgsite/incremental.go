@@ -0,0 +1,231 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Regenerating a site would rewrite every file, and a sync that compares
+// modification times, as rsync does by default, would then upload them all.
+// Instead, every file is written through a siteOutput, which records the
+// hash of each file it writes in writtenFile, in the format of the
+// manifest. A later run leaves a file alone if the hash of its new
+// contents is the recorded one and the file is still there, so that it
+// keeps its modification time. A file written more than once, such as a
+// page that gets its content hash, keeps its modification time if it ends
+// up as it was. The recorded files that a run does not write are deleted;
+// with GenerateOptions.Prune, so are all other files of the output
+// directory that it does not write. GenerateOptions.Force writes every
+// file.
+//
+// A run still loads and renders every module, and makes the aggregates,
+// such as the sitemap and the search index, from all of them. It does not
+// reuse what the previous run recorded of the modules that look
+// unchanged: their modification times change with every checkout, and
+// their pages depend on the other modules, whose units they link to and
+// whose imports make their imported-by pages. Only the modules that the
+// user vouches for with GenerateOptions.Frozen are left out of loading and
+// rendering, with their recorded contributions recombined; see frozen.go.
+const writtenFile = ".pkgsite-manifest.sha256"
+
+// A siteOutput writes the files of a run to the output directory. Its
+// writeFile method is safe for concurrent use.
+type siteOutput struct {
+	dir         string
+	force       bool
+	crlf        bool                 // whether text files get CRLF line endings; see newline.go
+	precompress bool                 // whether files get compressed siblings; see precompress.go
+	minify      bool                 // whether pages, style sheets and scripts are minified; see minify.go
+	external    *cspExternalizer     // with StrictCSP, the inline code moved out of the pages; see strictcsp.go
+	mu          sync.Mutex           // guards the maps and skipped in writeFile
+	prev        map[string]string    // hashes recorded by the previous run, by slash-separated path
+	written     map[string]string    // hashes of the files written by this run
+	mtimes      map[string]time.Time // modification times before this run of the recorded files
+	touched     map[string]bool      // files actually written by this run
+	skipped     int                  // number of writes left out
+}
+
+// newSiteOutput returns the output of a run to dir, reading the files that
+// the previous run recorded. With force, every file is written. With
+// crlf, text files are written with CRLF line endings.
+func newSiteOutput(dir string, force, crlf bool) (*siteOutput, error) {
+	prev, err := readManifest(filepath.Join(dir, writtenFile))
+	if err != nil {
+		return nil, err
+	}
+	return &siteOutput{
+		dir:     dir,
+		force:   force,
+		crlf:    crlf,
+		prev:    prev,
+		written: map[string]string{},
+		mtimes:  map[string]time.Time{},
+		touched: map[string]bool{},
+	}, nil
+}
+
+// writeFile writes data to file, which must be under the output directory,
+// unless the file already holds it, as recorded by the previous run. Text
+// is normalized first, as by normalize. The file's directory must exist.
+func (o *siteOutput) writeFile(file string, data []byte) error {
+	rel, err := filepath.Rel(o.dir, file)
+	if err != nil {
+		return err
+	}
+	p := filepath.ToSlash(rel)
+	data = normalizeText(p, data, o.crlf)
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, again := o.written[p]
+	o.written[p] = hash
+	if prev, ok := o.prev[p]; ok && !o.force && !again {
+		if fi, err := os.Stat(file); err == nil && fi.Mode().IsRegular() {
+			o.mtimes[p] = fi.ModTime()
+			if prev == hash && fi.Size() == int64(len(data)) && fi.Mode().Perm() == siteFileMode {
+				o.skipped++
+				return nil
+			}
+		}
+	}
+	o.touched[p] = true
+	return writeSiteFile(file, data)
+}
+
+// normalize returns data as writeFile writes it to file.
+func (o *siteOutput) normalize(file string, data []byte) []byte {
+	return normalizeText(filepath.ToSlash(file), data, o.crlf)
+}
+
+// forget drops the file at the slash-separated path p from those written
+// by this run, so that prune deletes it.
+func (o *siteOutput) forget(p string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.written, p)
+	delete(o.touched, p)
+}
+
+// removeStale deletes the files recorded by the previous run that this run
+// has not written, and the directories they leave empty. It returns the
+// slash-separated paths of the deleted files, sorted.
+func (o *siteOutput) removeStale() ([]string, error) {
+	var stale []string
+	for p := range o.prev {
+		if _, ok := o.written[p]; !ok && !o.isCompressedSibling(p) {
+			stale = append(stale, p)
+		}
+	}
+	sort.Strings(stale)
+	var removed []string
+	for _, p := range stale {
+		file := filepath.Join(o.dir, filepath.FromSlash(p))
+		err := os.Remove(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, p)
+		// Remove the directories left empty, up to the output directory.
+		for dir := filepath.Dir(file); dir != o.dir && len(dir) > len(o.dir); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return removed, nil
+}
+
+// prune deletes the files of the output directory that this run has not
+// written, other than the records the generator keeps there and the
+// archive of snapshots, and the directories left empty. Unlike
+// removeStale, it also deletes files that no run recorded, such as those
+// of a version of the generator that kept no record, or those put there by
+// hand. It returns the slash-separated paths
+// of the deleted files, sorted.
+func (o *siteOutput) prune() ([]string, error) {
+	var removed, dirs []string
+	err := filepath.WalkDir(o.dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := skipArchive(o.dir, file, d); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if file != o.dir {
+				dirs = append(dirs, file)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(o.dir, file)
+		if err != nil {
+			return err
+		}
+		p := filepath.ToSlash(rel)
+		switch p {
+		case manifestFile, manifestFile + ".tmp", changedFilesFile, deletedFilesFile, fingerprintsFile, writtenFile, writtenFile + ".tmp", optionsFile, modulesFile, batchFile, smokeMarkerFile:
+			return nil
+		}
+		if _, ok := o.written[p]; ok || o.isCompressedSibling(p) {
+			return nil
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		removed = append(removed, p)
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+	// A directory is walked before its contents, so going backwards removes
+	// the contents first. Directories that are not empty stay.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return removed, nil
+}
+
+// finish restores the modification times of the files that were rewritten
+// as they were, and records the files written by this run.
+func (o *siteOutput) finish() error {
+	for p := range o.touched {
+		if mtime, ok := o.mtimes[p]; ok && o.written[p] == o.prev[p] {
+			if err := os.Chtimes(filepath.Join(o.dir, filepath.FromSlash(p)), time.Time{}, mtime); err != nil {
+				return err
+			}
+		}
+	}
+	paths := make([]string, 0, len(o.written))
+	for p := range o.written {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var buf bytes.Buffer
+	for _, p := range paths {
+		fmt.Fprintf(&buf, "%s  %s\n", o.written[p], p)
+	}
+	// As the manifest, the record is replaced at once.
+	tmp := filepath.Join(o.dir, writtenFile+".tmp")
+	if err := writeSiteFile(tmp, buf.Bytes()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(o.dir, writtenFile))
+}
@@ -0,0 +1,252 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+// testSiteOutput returns the output of a run to dir.
+func testSiteOutput(t *testing.T, dir string) *siteOutput {
+	t.Helper()
+	out, err := newSiteOutput(dir, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSiteOutput(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(out *siteOutput, files map[string]string) {
+		t.Helper()
+		for p, data := range files {
+			file := filepath.Join(dir, filepath.FromSlash(p))
+			if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := out.writeFile(file, []byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	age := func() {
+		t.Helper()
+		for _, p := range []string{"same", "changed", "rewritten", "d/stale"} {
+			if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(p)), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	mtime := func(p string) time.Time {
+		t.Helper()
+		fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.ModTime()
+	}
+
+	out := testSiteOutput(t, dir)
+	write(out, map[string]string{"same": "a", "changed": "b", "rewritten": "c", "d/stale": "d"})
+	if err := out.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "CNAME"), []byte("example.org\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	age()
+
+	out = testSiteOutput(t, dir)
+	write(out, map[string]string{"same": "a", "changed": "B", "rewritten": "x"})
+	// A second write of a file restores its contents.
+	write(out, map[string]string{"rewritten": "c"})
+	removed, err := out.removeStale()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"d/stale"}, removed); diff != "" {
+		t.Errorf("removed mismatch (-want +got):\n%s", diff)
+	}
+	if out.skipped != 1 {
+		t.Errorf("skipped %d writes, want 1", out.skipped)
+	}
+	for _, p := range []string{"same", "rewritten"} {
+		if got := mtime(p); !got.Equal(old) {
+			t.Errorf("%s: modification time %v, want %v", p, got, old)
+		}
+	}
+	if got := mtime("changed"); got.Equal(old) {
+		t.Error("changed: modification time was kept")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "d")); !os.IsNotExist(err) {
+		t.Errorf("directory of a stale file: got %v, want not exist", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "CNAME")); err != nil {
+		t.Errorf("file not written by a run: %v", err)
+	}
+	written, err := readManifest(filepath.Join(dir, writtenFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for p := range written {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	if diff := cmp.Diff([]string{"changed", "rewritten", "same"}, paths); diff != "" {
+		t.Errorf("recorded files mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateStaticSiteIncremental(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- a/a.go --
+// Package a does other things.
+package a
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	generate := func(force bool) {
+		t.Helper()
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Force: force}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	page := filepath.Join(outDir, "example.com", "m", "index.html")
+	age := func() {
+		t.Helper()
+		if err := os.Chtimes(page, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unchanged := func() bool {
+		t.Helper()
+		fi, err := os.Stat(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.ModTime().Equal(old)
+	}
+
+	generate(false)
+	cname := filepath.Join(outDir, "CNAME")
+	if err := os.WriteFile(cname, []byte("example.org\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	age()
+	generate(false)
+	if !unchanged() {
+		t.Error("second run rewrote an unchanged page")
+	}
+	generate(true)
+	if unchanged() {
+		t.Error("forced run left an unchanged page alone")
+	}
+
+	// Without package a, its page is removed, and the rest stays.
+	if err := os.RemoveAll(filepath.Join(modDir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	generate(false)
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "m", "a")); !os.IsNotExist(err) {
+		t.Errorf("page of removed package: got %v, want not exist", err)
+	}
+	written, err := readManifest(filepath.Join(outDir, writtenFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := written["example.com/m/a/index.html"]; ok {
+		t.Error("page of removed package is recorded")
+	}
+	if _, ok := written["CNAME"]; ok {
+		t.Error("CNAME is recorded")
+	}
+	if _, err := os.Stat(cname); err != nil {
+		t.Errorf("file not written by the generator: %v", err)
+	}
+}
+
+func TestGenerateStaticSitePrune(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- a/a.go --
+// Package a does other things.
+package a
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	generate := func(prune bool) {
+		t.Helper()
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Prune: prune}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orphan := filepath.Join(outDir, "example.com", "m", "a")
+	exists := func(file string) bool {
+		t.Helper()
+		_, err := os.Stat(file)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+
+	generate(false)
+	if !exists(orphan) {
+		t.Fatal("no page for package a")
+	}
+	// Without its record, as after a run of a version of the generator
+	// that kept none, a run leaves the pages of removed packages behind.
+	if err := os.RemoveAll(filepath.Join(modDir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(outDir, writtenFile)); err != nil {
+		t.Fatal(err)
+	}
+	generate(false)
+	if !exists(orphan) {
+		t.Fatal("run without -prune removed a file it did not record")
+	}
+
+	generate(true)
+	if exists(orphan) {
+		t.Error("directory of removed package was not pruned")
+	}
+	for _, p := range []string{"example.com/m/index.html", "static/frontend/frontend.min.css", manifestFile, writtenFile} {
+		if !exists(filepath.Join(outDir, filepath.FromSlash(p))) {
+			t.Errorf("%s was pruned", p)
+		}
+	}
+}
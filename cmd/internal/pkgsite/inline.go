@@ -0,0 +1,296 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// With GenerateOptions.InlineSmallImages set, an <img> of a page whose src is
+// a path of the site, to an image smaller than that many bytes, gets the
+// image as a data: URL, which the Content-Security-Policy of the pages
+// allows, so that the page loads without a request for it. The image is
+// read through the mux, as the page was, so this also covers the pictures
+// in the READMEs of local modules, which point at the files of the module
+// under filesPrefix, which the site does not otherwise have. SVG images are
+// sanitized first, and are not inlined if they cannot be; other images must
+// look like what their extension says. Larger images, and images of other
+// types, are left alone.
+//
+// An asset file that is inlined everywhere it is used is no longer needed.
+// With GenerateOptions.Prune, such files are left out of the output
+// directory, unless a page still refers to them, a stylesheet does, or a
+// script mentions them.
+
+// inlineImageTypes are the media types of the images that are inlined, by
+// extension.
+var inlineImageTypes = map[string]string{
+	".gif":  "image/gif",
+	".ico":  "image/x-icon",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+}
+
+// An imageInliner inlines the small images of pages. It is also a
+// pageConsumer, which records the files that pages still refer to. It is
+// safe for concurrent use.
+type imageInliner struct {
+	mux       http.Handler
+	threshold int // size in bytes of the smallest image that is not inlined
+
+	mu   sync.Mutex
+	urls map[string]string // data: URLs by site path, without the leading slash; "" if not inlined
+	used map[string]bool   // files that pages refer to, relative to the output directory
+}
+
+// newImageInliner returns an imageInliner of the images smaller than
+// threshold bytes that mux serves.
+func newImageInliner(mux http.Handler, threshold int) *imageInliner {
+	return &imageInliner{
+		mux:       mux,
+		threshold: threshold,
+		urls:      map[string]string{},
+		used:      map[string]bool{},
+	}
+}
+
+// transform returns a pageTransform that inlines the small images of a
+// page.
+func (in *imageInliner) transform() pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		var walk func(n *html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode && n.Data == "img" {
+				src := attrValue(n, "src")
+				if strings.HasPrefix(src, "/") && !strings.HasPrefix(src, "//") {
+					if u := in.dataURL(src); u != "" {
+						setAttr(n, "src", u)
+					}
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+	}
+}
+
+// dataURL returns the data: URL of the image at the site-absolute URL src,
+// or "" if it is not inlined.
+func (in *imageInliner) dataURL(src string) string {
+	p := cleanURLPath(src)
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	p = p[1:]
+	in.mu.Lock()
+	u, ok := in.urls[p]
+	in.mu.Unlock()
+	if ok {
+		return u
+	}
+	u = in.load(p)
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.urls[p] = u
+	return u
+}
+
+// load returns the data: URL of the image at the site path p, as served by
+// the mux, or "" if it is not inlined.
+func (in *imageInliner) load(p string) string {
+	typ, ok := inlineImageTypes[strings.ToLower(path.Ext(p))]
+	if !ok {
+		return ""
+	}
+	r, err := http.NewRequest("GET", "/"+p, nil)
+	if err != nil {
+		return ""
+	}
+	w := httptest.NewRecorder()
+	in.mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.Len() >= in.threshold {
+		return ""
+	}
+	u, err := imageDataURL(w.Body.Bytes(), typ)
+	if err != nil {
+		return ""
+	}
+	return u
+}
+
+// imageDataURL returns the data: URL of the image data of media type typ.
+// An SVG image is sanitized by sanitizeSVG; other images must have the
+// signature of their type.
+func imageDataURL(data []byte, typ string) (string, error) {
+	if typ == "image/svg+xml" {
+		var err error
+		if data, err = sanitizeSVG(data); err != nil {
+			return "", err
+		}
+	} else if got := http.DetectContentType(data); got != typ {
+		return "", fmt.Errorf("got an image of type %s, want %s", got, typ)
+	}
+	return "data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// sanitizeSVG returns the SVG document data without what could run code or
+// load other documents, were it opened on its own: scripts, foreign
+// objects, event handler attributes, animations of such attributes or of
+// links, and links that are not to fragments of the document. Comments,
+// processing instructions and directives, such as a DOCTYPE declaring
+// entities, are left out too. Data that is not well-formed XML with an svg
+// root element is rejected.
+func sanitizeSVG(data []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		buf      bytes.Buffer
+		depth    int // of the elements written
+		skip     int // depth inside an element left out
+		hasRoot  bool
+		finished bool
+	)
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case skip > 0 || unsafeSVGElement(t):
+				skip++
+				continue
+			case finished:
+				return nil, errors.New("content after the svg element")
+			case !hasRoot && t.Name.Local != "svg":
+				return nil, fmt.Errorf("root element is %s, want svg", xmlName(t.Name))
+			}
+			hasRoot = true
+			depth++
+			buf.WriteString("<" + xmlName(t.Name))
+			for _, a := range t.Attr {
+				if unsafeSVGAttr(a) {
+					continue
+				}
+				buf.WriteString(" " + xmlName(a.Name) + `="`)
+				xml.EscapeText(&buf, []byte(a.Value))
+				buf.WriteString(`"`)
+			}
+			buf.WriteString(">")
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			buf.WriteString("</" + xmlName(t.Name) + ">")
+			if depth--; depth == 0 {
+				finished = true
+			}
+		case xml.CharData:
+			if skip == 0 && depth > 0 {
+				xml.EscapeText(&buf, t)
+			}
+		}
+	}
+	if !finished {
+		return nil, errors.New("no complete svg element")
+	}
+	return buf.Bytes(), nil
+}
+
+// xmlName returns n as written, with its prefix, as returned by RawToken.
+func xmlName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// unsafeSVGElement reports whether sanitizeSVG leaves out the element that
+// starts with t, with its content.
+func unsafeSVGElement(t xml.StartElement) bool {
+	switch strings.ToLower(t.Name.Local) {
+	case "script", "foreignobject", "handler", "listener":
+		return true
+	case "animate", "set":
+		for _, a := range t.Attr {
+			if a.Name.Local != "attributeName" {
+				continue
+			}
+			name := strings.ToLower(a.Value)
+			if _, local, ok := strings.Cut(name, ":"); ok {
+				name = local
+			}
+			if name == "href" || strings.HasPrefix(name, "on") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unsafeSVGAttr reports whether sanitizeSVG leaves out the attribute a.
+func unsafeSVGAttr(a xml.Attr) bool {
+	name := strings.ToLower(a.Name.Local)
+	switch {
+	case strings.HasPrefix(name, "on"):
+		return true
+	case name == "href":
+		return !strings.HasPrefix(strings.TrimSpace(a.Value), "#")
+	}
+	return false
+}
+
+// consumePage records the local files that the page of ev still refers to.
+func (in *imageInliner) consumePage(ev *pageEvent) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, p := range pageAssets(ev) {
+		in.used[p] = true
+	}
+	return nil
+}
+
+func (in *imageInliner) finish(context.Context, *siteOutput) error { return nil }
+
+// unused returns the asset files of assets that were inlined and that no
+// page or stylesheet refers to, and no script mentions, sorted.
+func (in *imageInliner) unused(assets *assetGraph) []string {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	used := maps.Clone(in.used)
+	maps.Copy(used, assets.referenced())
+	var unused []string
+	for p, u := range in.urls {
+		if u != "" && assets.files[p] && !used[p] && !assets.mentioned[p] {
+			unused = append(unused, p)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
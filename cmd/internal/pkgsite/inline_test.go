@@ -0,0 +1,154 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	for _, test := range []struct {
+		in, want string // want is "" for an error
+	}{
+		{
+			`<?xml version="1.0"?><!-- icon --><svg xmlns="http://www.w3.org/2000/svg" width="2"><path d="M0 0h2"/></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg" width="2"><path d="M0 0h2"></path></svg>`,
+		},
+		{
+			`<svg onload="alert(1)"><script>alert(2)</script><g ONCLICK="x"><text>a &lt; b</text></g></svg>`,
+			`<svg><g><text>a &lt; b</text></g></svg>`,
+		},
+		{
+			`<svg xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="#a"/><use xlink:href="https://example.com/x.svg#a"/><image href="data:image/png;base64,AA"/></svg>`,
+			`<svg xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="#a"></use><use></use><image></image></svg>`,
+		},
+		{
+			`<svg><foreignObject><div>x</div></foreignObject><a href="javascript:x()"><set attributeName="xlink:href" to="javascript:y()"/><animate attributeName="fill"/></a></svg>`,
+			`<svg><a><animate attributeName="fill"></animate></a></svg>`,
+		},
+		{`<!DOCTYPE svg [<!ENTITY x "y">]><svg>&x;</svg>`, ""},
+		{`<html><svg/></html>`, ""},
+		{`<svg><g></svg>`, ""},
+		{`<svg/><svg/>`, ""},
+		{`not XML`, ""},
+	} {
+		got, err := sanitizeSVG([]byte(test.in))
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("sanitizeSVG(%q) = %q, want error", test.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("sanitizeSVG(%q): %v", test.in, err)
+		} else if string(got) != test.want {
+			t.Errorf("sanitizeSVG(%q) =\n%s\nwant\n%s", test.in, got, test.want)
+		}
+	}
+}
+
+// testPNG returns image data of size bytes that starts with the PNG
+// signature.
+func testPNG(size int) []byte {
+	sig := []byte("\x89PNG\r\n\x1a\n")
+	return append(sig, bytes.Repeat([]byte{0}, size-len(sig))...)
+}
+
+func TestImageDataURL(t *testing.T) {
+	png := testPNG(16)
+	got, err := imageDataURL(png, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, err := imageDataURL([]byte("not a PNG"), "image/png"); err == nil {
+		t.Errorf("text as a PNG: got %s, want error", got)
+	}
+}
+
+func TestGenerateStaticSiteInlineImages(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- README.md --
+# M
+
+![small](small.png) ![big](img/big.png) ![icon](icon.svg)
+-- icon.svg --
+<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"><script>alert(2)</script><circle r="1"/></svg>
+-- m.go --
+// Package m does things.
+package m
+`)
+	small, big := testPNG(100), testPNG(5000)
+	if err := os.WriteFile(filepath.Join(modDir, "small.png"), small, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(modDir, "img"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(modDir, "img", "big.png"), big, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	const github = "static/shared/logo/social/github.svg" // 2434 bytes, used only by pages
+	for _, prune := range []bool{false, true} {
+		outDir := t.TempDir()
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{
+			OutDir:            outDir,
+			Prune:             prune,
+			InlineSmallImages: 4096,
+			CopyAllAssets:     true, // the inlined images are not copied otherwise
+		}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := string(data)
+		icon := `<svg xmlns="http://www.w3.org/2000/svg"><circle r="1"></circle></svg>`
+		for _, want := range []string{
+			`src="data:image/png;base64,` + base64.StdEncoding.EncodeToString(small) + `"`,
+			`src="data:image/svg+xml;base64,` + base64.StdEncoding.EncodeToString([]byte(icon)) + `"`,
+			`/img/big.png"`,
+			`src="data:image/svg+xml;base64,`,
+		} {
+			if !strings.Contains(page, want) {
+				t.Errorf("prune=%t: page does not contain %s", prune, want)
+			}
+		}
+		if strings.Contains(page, github) {
+			t.Errorf("prune=%t: page refers to %s, which is small", prune, github)
+		}
+		// The gopher of the footer is larger than the threshold.
+		if !strings.Contains(page, "static/shared/gopher/pilot-bust-1431x901.svg") {
+			t.Errorf("prune=%t: large image was inlined", prune)
+		}
+		_, err = os.Stat(filepath.Join(outDir, filepath.FromSlash(github)))
+		if prune != os.IsNotExist(err) {
+			t.Errorf("prune=%t: inlined asset %s: got %v", prune, github, err)
+		}
+		// Scripts mention the icons of the carousel.
+		if _, err := os.Stat(filepath.Join(outDir, "static", "shared", "icon", "arrow_left_gm_grey_24dp.svg")); err != nil {
+			t.Errorf("prune=%t: %v", prune, err)
+		}
+		checkInternalLinks(t, outDir, "example.com/")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/log"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Most modules have one of a few licenses, such as Apache-2.0, whose text
+// the licenses page of each would repeat. Each text of the licenses pages
+// is written once instead, at licenseTextsDir/<hash>, where <hash> is the
+// SHA-256 hash, in hex, of the text as the licenses pages show it. The
+// licenses pages link to it in place of the text, and keep the types,
+// source and disclaimer of each license. Texts are only shared when they
+// are the same to the byte, so that a modified license keeps a page of its
+// own. The pages of the texts are listed in the sitemap, and the links to
+// them checked, as the other pages of the site.
+const licenseTextsDir = "licenses/texts"
+
+// licensePageText returns the text of a license with contents as its
+// licenses page shows it: the frontend drops carriage returns, and HTML
+// drops a newline right after <pre>.
+func licensePageText(contents []byte) string {
+	return strings.TrimPrefix(strings.ReplaceAll(string(contents), "\r", ""), "\n")
+}
+
+// licenseTextHash returns the hash of text, as the path of its page has it.
+func licenseTextHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// licenseTexts returns the texts of the licenses on the licenses pages of
+// the units of selected, by hash, out of tabs, the site paths of the tab
+// pages that a run writes, and those of each module, by module path.
+// Licenses whose text the data source leaves out, such as those that do
+// not allow redistribution, have none.
+func licenseTexts(ctx context.Context, ds internal.DataSource, selected []*siteUnit, tabs map[string]bool) (texts map[string]string, byModule map[string]map[string]string) {
+	texts = map[string]string{}
+	byModule = map[string]map[string]string{}
+	for _, u := range selected {
+		if !tabs[u.path+"/"+licensesTab] {
+			continue
+		}
+		unit, err := ds.GetUnit(ctx, u.meta, internal.WithMain|internal.WithLicenses, internal.BuildContext{})
+		if err != nil {
+			log.Errorf(ctx, "loading the licenses of %s: %v", u.path, err)
+			continue
+		}
+		for _, l := range unit.LicenseContents {
+			if len(l.Contents) == 0 {
+				continue
+			}
+			text := licensePageText(l.Contents)
+			hash := licenseTextHash(text)
+			texts[hash] = text
+			if byModule[u.meta.ModulePath] == nil {
+				byModule[u.meta.ModulePath] = map[string]string{}
+			}
+			byModule[u.meta.ModulePath][hash] = text
+		}
+	}
+	return texts, byModule
+}
+
+// licenseTextsTransform returns the page transform for licenses pages that
+// replaces the texts among texts, by hash, with links to their pages.
+// Other texts, such as those the page shows differently than expected,
+// are left alone.
+func licenseTextsTransform(texts map[string]string) pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		var pres []*html.Node
+		walkElements(doc, func(n *html.Node) {
+			if n.DataAtom == atom.Pre && hasClass(n, "License-contents") {
+				pres = append(pres, n)
+			}
+		})
+		for _, pre := range pres {
+			hash := licenseTextHash(nodeText(pre))
+			if _, ok := texts[hash]; !ok || pre.Parent == nil {
+				continue
+			}
+			a := &html.Node{
+				Type:     html.ElementNode,
+				Data:     "a",
+				DataAtom: atom.A,
+				Attr:     []html.Attribute{{Key: "href", Val: "/" + licenseTextsDir + "/" + hash}},
+			}
+			a.AppendChild(&html.Node{Type: html.TextNode, Data: "Read the text of this license."})
+			p := &html.Node{
+				Type:     html.ElementNode,
+				Data:     "p",
+				DataAtom: atom.P,
+				Attr:     []html.Attribute{{Key: "class", Val: "License-text"}},
+			}
+			p.AppendChild(a)
+			pre.Parent.InsertBefore(p, pre)
+			pre.Parent.RemoveChild(pre)
+		}
+	}
+}
+
+// licenseTextTransform returns the page transform making the page of
+// attributionsFrame the page of a license text.
+func licenseTextTransform(text string) pageTransform {
+	var b bytes.Buffer
+	b.WriteString(`<h1>License text</h1>`)
+	b.WriteString(`<p>The licenses pages of the modules of this site with this license link to this text. `)
+	b.WriteString(`This is not legal advice. <a href="/license-policy">Read disclaimer.</a></p>`)
+	// HTML drops a newline right after <pre>, which the text may start with.
+	b.WriteString("<pre class=\"License-contents\">\n")
+	b.WriteString(html.EscapeString(text))
+	b.WriteString("</pre>")
+	replace := replaceContent(b.Bytes())
+	return func(doc *html.Node, head *headManager) {
+		replace(doc, head)
+		setPageTitle(doc, "License text")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	"golang.org/x/net/html"
+)
+
+func TestLicenseTextsTransform(t *testing.T) {
+	shared := licensePageText([]byte("\nSome license.\r\nAll rights reserved.\r\n"))
+	if want := "Some license.\nAll rights reserved.\n"; shared != want {
+		t.Fatalf("licensePageText = %q, want %q", shared, want)
+	}
+	hash := licenseTextHash(shared)
+	doc, err := html.Parse(strings.NewReader(`<section class="License"><div>MIT</div>` +
+		"<pre class=\"License-contents\">\nSome license.\nAll rights reserved.\n</pre></section>" +
+		`<section class="License"><pre class="License-contents">Some license, modified.</pre></section>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	licenseTextsTransform(map[string]string{hash: shared})(doc, nil)
+	var buf strings.Builder
+	if err := html.Render(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		`<div>MIT</div><p class="License-text"><a href="/licenses/texts/` + hash + `">`,
+		`<pre class="License-contents">Some license, modified.</pre>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("transformed page does not contain %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "All rights reserved.") {
+		t.Errorf("transformed page still has the shared text:\n%s", got)
+	}
+}
+
+func TestGenerateStaticSiteLicenseTexts(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modified := strings.Replace(testhelper.MITLicense, "Copyright 2019 Google Inc", "Copyright 2024 Example Authors", 1)
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- a/go.mod --
+module example.com/a
+
+go 1.21
+-- a/LICENSE --
+`+testhelper.MITLicense+`
+-- a/a.go --
+// Package a is under the MIT license.
+package a
+-- b/go.mod --
+module example.com/b
+
+go 1.21
+-- b/LICENSE --
+`+testhelper.MITLicense+`
+-- b/b.go --
+// Package b is under the same MIT license.
+package b
+-- c/go.mod --
+module example.com/c
+
+go 1.21
+-- c/LICENSE --
+`+modified+`
+-- c/c.go --
+// Package c is under a modified MIT license.
+package c
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")},
+		UseListedMods: true,
+		SiteURL:       "https://example.com/docs",
+	}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Sitemap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.BrokenLinks) != 0 {
+		t.Errorf("broken links: %v", report.BrokenLinks)
+	}
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// The modules with the same text link to one page of it, and the
+	// module with a modified text to another.
+	textPath := func(license string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, license))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path.Join(licenseTextsDir, licenseTextHash(licensePageText(data)))
+	}
+	mit, other := textPath("a/LICENSE"), textPath("c/LICENSE")
+	for _, test := range []struct{ page, text string }{
+		{"example.com/a/licenses/index.html", mit},
+		{"example.com/b/licenses/index.html", mit},
+		{"example.com/c/licenses/index.html", other},
+	} {
+		page := read(test.page)
+		if want := `href="../../../` + test.text + `"`; !strings.Contains(page, want) {
+			t.Errorf("%s does not link to its text with %s", test.page, want)
+		}
+		if strings.Contains(page, "Permission is hereby granted") {
+			t.Errorf("%s still has the text of its license", test.page)
+		}
+		if !strings.Contains(page, `<div id="#lic-0">MIT</div>`) {
+			t.Errorf("%s lost the type of its license", test.page)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(outDir, filepath.FromSlash(licenseTextsDir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %d license texts, want 2", len(entries))
+	}
+	for _, test := range []struct{ text, want string }{
+		{mit, "Copyright 2019 Google Inc"},
+		{other, "Copyright 2024 Example Authors"},
+	} {
+		page := read(test.text + "/index.html")
+		for _, want := range []string{"<title>License text", test.want, "Permission is hereby granted"} {
+			if !strings.Contains(page, want) {
+				t.Errorf("%s does not contain %s", test.text, want)
+			}
+		}
+	}
+	sitemap := read(sitemapFile)
+	for _, text := range []string{mit, other} {
+		if want := "<loc>https://example.com/docs/" + text + "/</loc>"; !strings.Contains(sitemap, want) {
+			t.Errorf("sitemap lacks %s", want)
+		}
+	}
+
+	// A link to a text that has no page is broken.
+	lc := newLinkChecker(nil, nil)
+	lc.addDir(licenseTextsDir)
+	lc.consumePage(&pageEvent{File: "example.com/a/licenses/index.html", Links: []string{"../../../" + mit, "../../../licenses/texts/missing"}})
+	lc.consumePage(&pageEvent{File: mit + "/index.html"})
+	if err := lc.finish(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(lc.broken) != 1 || lc.broken[0].Href != "../../../licenses/texts/missing" {
+		t.Errorf("got broken links %v, want the link to the missing text", lc.broken)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+)
+
+// linkChecker is a pageConsumer that checks the links between unit pages.
+// Only links into the site's own modules are checked; links to other
+// modules, to versioned pages and to dynamic pages such as search are not.
+type linkChecker struct {
+	modules map[string]bool // canonical paths of the site's modules
+	units   map[string]bool // canonical paths of all units of the modules
+	skipped map[string]bool // units deliberately left out of the site
+	dirs    map[string]bool // directories of pages shared by the modules
+
+	pages map[string]bool // site paths of the generated pages
+	links []BrokenLink    // links to check, with the linking page
+	dests []string        // site path each link points at, parallel to links
+
+	broken  []BrokenLink
+	ignored int
+}
+
+// newLinkChecker returns a linkChecker for a site holding the generated
+// units out of all the units of the modules.
+func newLinkChecker(all, generated []*siteUnit) *linkChecker {
+	lc := &linkChecker{
+		modules: map[string]bool{},
+		units:   map[string]bool{},
+		skipped: map[string]bool{},
+		dirs:    map[string]bool{},
+		pages:   map[string]bool{},
+	}
+	for _, u := range all {
+		lc.modules[canonicalUnitPath(u.meta.ModulePath)] = true
+		lc.units[u.path] = true
+		lc.skipped[u.path] = true
+	}
+	for _, u := range generated {
+		delete(lc.skipped, u.path)
+	}
+	return lc
+}
+
+// addFrozen adds the modules and units of the frozen modules to those the
+// links into are checked.
+func (lc *linkChecker) addFrozen(frozen map[string]*moduleContribution) {
+	for mod, c := range frozen {
+		lc.modules[canonicalUnitPath(mod)] = true
+		for _, u := range c.Units {
+			lc.units[u] = true
+		}
+	}
+}
+
+// addDir adds the directory dir of pages shared by the modules, such as
+// licenseTextsDir, to those the links into are checked.
+func (lc *linkChecker) addDir(dir string) {
+	lc.dirs[dir] = true
+}
+
+// addFile adds the file at the site path p, which is not a page, such as
+// the text of a source file, to those links can point at.
+func (lc *linkChecker) addFile(p string) {
+	lc.pages[p] = true
+}
+
+func (lc *linkChecker) consumePage(ev *pageEvent) error {
+	dir := path.Dir(ev.File)
+	if path.Base(ev.File) == "index.html" {
+		lc.pages[dir] = true
+	} else {
+		lc.pages[ev.File] = true
+	}
+	for _, href := range ev.Links {
+		// Links to other pages of the site are relative after
+		// post-processing.
+		if !strings.HasPrefix(href, ".") {
+			continue
+		}
+		target, _, _ := strings.Cut(href, "?")
+		target, _, _ = strings.Cut(target, "#")
+		dest := path.Join(dir, target)
+		if strings.Contains(dest, "@") || !lc.inScope(dest) {
+			continue
+		}
+		lc.links = append(lc.links, BrokenLink{Page: ev.File, Href: href})
+		lc.dests = append(lc.dests, dest)
+	}
+	return nil
+}
+
+// inScope reports whether a link to the site path dest is checked.
+func (lc *linkChecker) inScope(dest string) bool {
+	if lc.units[dest] {
+		return true
+	}
+	for p := dest; p != "." && p != "/"; p = path.Dir(p) {
+		if lc.modules[p] || lc.dirs[p] {
+			return true
+		}
+	}
+	return false
+}
+
+func (lc *linkChecker) finish(context.Context, *siteOutput) error {
+	for i, l := range lc.links {
+		dest := lc.dests[i]
+		switch {
+		case lc.pages[dest]:
+		case lc.skipped[dest]:
+			lc.ignored++
+		default:
+			lc.broken = append(lc.broken, l)
+		}
+	}
+	sort.Slice(lc.broken, func(i, j int) bool {
+		if lc.broken[i].Page != lc.broken[j].Page {
+			return lc.broken[i].Page < lc.broken[j].Page
+		}
+		return lc.broken[i].Href < lc.broken[j].Href
+	})
+	lc.links, lc.dests = nil, nil
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// A Logger receives the messages of a run, such as its warnings and its
+// summary, one line at a time, without the final newline. A *log.Logger is
+// one.
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
+// logOutput returns the writer of the messages of a run: os.Stderr, or a
+// writer passing each line written to it to l if l is not nil.
+func logOutput(l Logger) io.Writer {
+	if l == nil {
+		return os.Stderr
+	}
+	return &logWriter{l: l}
+}
+
+// A logWriter passes the lines written to it to a Logger. A line is passed
+// once its newline is written. It may be written to by several goroutines
+// at once.
+type logWriter struct {
+	l   Logger
+	mu  sync.Mutex
+	buf []byte // the start of a line
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.l.Printf("%s", w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	// Do not keep the start of a large write alive for a short line.
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	return len(p), nil
+}
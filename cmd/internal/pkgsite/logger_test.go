@@ -0,0 +1,123 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// A recordingLogger is a Logger that records the lines it receives.
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestLogWriter(t *testing.T) {
+	var l recordingLogger
+	w := logOutput(&l)
+	fmt.Fprintf(w, "Warning: %s\n", "one")
+	fmt.Fprint(w, "two, in ")
+	fmt.Fprint(w, "parts\nthree\nfour")
+	want := []string{"Warning: one", "two, in parts", "three"}
+	if diff := cmp.Diff(want, l.lines); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateStaticSiteHooks(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	cfg := ServerConfig{Paths: writeStaticPagesModules(t), UseListedMods: true}
+
+	t.Run("progress", func(t *testing.T) {
+		var (
+			l      recordingLogger
+			mu     sync.Mutex
+			events []ProgressEvent
+		)
+		opts := GenerateOptions{
+			OutDir:  t.TempDir(),
+			Workers: 2,
+			Logger:  &l,
+			Progress: func(ev ProgressEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, ev)
+			},
+		}
+		report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first := events[0]; first.Event != schema.ProgressStart || first.Total == 0 {
+			t.Fatalf("first event %+v, want a start event with the number of pages", first)
+		}
+		if last := events[len(events)-1]; last.Event != schema.ProgressDone || last.Pages != report.Pages {
+			t.Errorf("last event %+v, want a done event with %d pages", last, report.Pages)
+		}
+		total := events[0].Total
+		started := map[string]int{}
+		rendered := 0
+		for _, ev := range events {
+			switch ev.Event {
+			case schema.ProgressPageStarted:
+				if ev.Index < 1 || ev.Index > total || ev.Total != total {
+					t.Errorf("bad page-started event %+v", ev)
+				}
+				started[ev.URLPath] = ev.Index
+			case schema.ProgressPageRendered:
+				if i, ok := started[ev.URLPath]; !ok || i != ev.Index || ev.Duration < 0 || ev.Error != "" {
+					t.Errorf("page-rendered event %+v does not match a page started", ev)
+				}
+				rendered++
+			}
+		}
+		if rendered != total {
+			t.Errorf("%d pages rendered, want %d", rendered, total)
+		}
+		// The messages go to the logger, and the progress only to the
+		// callback.
+		messages := strings.Join(l.lines, "\n")
+		if !strings.Contains(messages, "Static site generated in "+opts.OutDir) {
+			t.Errorf("the logger did not get the summary of the run:\n%s", messages)
+		}
+		if strings.Contains(messages, "Generating ") {
+			t.Errorf("the logger got the progress of the run:\n%s", messages)
+		}
+	})
+
+	t.Run("logger", func(t *testing.T) {
+		var l recordingLogger
+		opts := GenerateOptions{OutDir: t.TempDir(), Logger: &l}
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+			t.Fatal(err)
+		}
+		// Without a callback, the progress goes to the logger too.
+		messages := strings.Join(l.lines, "\n")
+		for _, want := range []string{"Generating ", "Copying static assets...", "Static site generated in "} {
+			if !strings.Contains(messages, want) {
+				t.Errorf("the logger did not get %q:\n%s", want, messages)
+			}
+		}
+		for _, line := range l.lines {
+			if strings.HasSuffix(line, "\n") {
+				t.Errorf("line %q ends with a newline", line)
+			}
+		}
+	})
+}
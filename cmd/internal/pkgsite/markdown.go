@@ -0,0 +1,264 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/doc/comment"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/godoc"
+)
+
+// defaultExternalDocsBase is where documentation for packages outside the
+// generated site is linked.
+const defaultExternalDocsBase = "https://pkg.go.dev"
+
+// externalDocsURL returns the URL of the documentation of the package at
+// path, which is not part of the site, under base, or under
+// defaultExternalDocsBase if base is empty.
+func externalDocsURL(base, path string) string {
+	if base == "" {
+		base = defaultExternalDocsBase
+	}
+	return strings.TrimSuffix(base, "/") + "/" + path
+}
+
+// markdownLinks resolves links between units in the Markdown export.
+type markdownLinks struct {
+	units        []string // sorted canonical paths of the generated units
+	siteURL      string   // if set, link to the HTML pages under this URL
+	externalDocs string   // base URL of the documentation of other packages
+}
+
+// unitURL returns the URL of the documentation for the unit at path, as
+// seen from the doc.md file of the unit at from.
+func (l markdownLinks) unitURL(from, path string) string {
+	i := sort.SearchStrings(l.units, path)
+	if i == len(l.units) || l.units[i] != path {
+		return externalDocsURL(l.externalDocs, path)
+	}
+	if l.siteURL != "" {
+		return strings.TrimSuffix(l.siteURL, "/") + "/" + path + "/"
+	}
+	return relativePrefix("/"+from) + path + "/doc.md"
+}
+
+// unitDoc returns the documentation model of u, and its synopsis. It
+// returns a nil package for the units that are not packages, or have no
+// documentation.
+func unitDoc(ctx context.Context, u *siteUnit) (*token.FileSet, *doc.Package, string, error) {
+	if !u.meta.IsPackage() {
+		return nil, nil, "", nil
+	}
+	unit, err := u.module.Unit(ctx, u.meta.Path)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if len(unit.Documentation) == 0 {
+		return nil, nil, "", nil
+	}
+	fset, d, err := godoc.DocPackageFromUnit(unit)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return fset, d, unit.Documentation[0].Synopsis, nil
+}
+
+// writeUnitMarkdown writes the Markdown documentation of u to <unit>/doc.md
+// in out. Units that are not packages are skipped.
+func writeUnitMarkdown(ctx context.Context, u *siteUnit, links markdownLinks, out *siteOutput) error {
+	fset, d, synopsis, err := unitDoc(ctx, u)
+	if err != nil || d == nil {
+		return err
+	}
+	md, err := unitMarkdown(fset, d, synopsis, func(importPath string) string {
+		return links.unitURL(u.path, canonicalUnitPath(importPath))
+	})
+	if err != nil {
+		return err
+	}
+	outPath, err := outputPath(out.dir, u.path+"/doc.md")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+		return err
+	}
+	return out.writeFile(outPath, md)
+}
+
+// unitMarkdown renders the documentation of d as CommonMark: a title, the
+// synopsis and import path, the package doc comment, and a section per
+// exported symbol with its declaration in a fenced go block. unitURL
+// returns the documentation URL for an import path other than d's.
+func unitMarkdown(fset *token.FileSet, d *doc.Package, synopsis string, unitURL func(importPath string) string) ([]byte, error) {
+	mw := &markdownWriter{fset: fset, pkg: d}
+	mw.printer = d.Printer()
+	mw.printer.HeadingLevel = 3
+	mw.printer.DocLinkURL = func(link *comment.DocLink) string {
+		anchor := link.Name
+		if link.Recv != "" {
+			anchor = link.Recv + "." + link.Name
+		}
+		if link.ImportPath == "" || link.ImportPath == d.ImportPath {
+			return "#" + anchor
+		}
+		u := unitURL(link.ImportPath)
+		if anchor != "" {
+			u += "#" + anchor
+		}
+		return u
+	}
+
+	fmt.Fprintf(&mw.buf, "# package %s\n\n", d.Name)
+	if synopsis != "" {
+		fmt.Fprintf(&mw.buf, "> %s\n\n", synopsis)
+	}
+	fmt.Fprintf(&mw.buf, "```go\nimport %q\n```\n\n", d.ImportPath)
+	mw.docComment(d.Doc)
+
+	if len(d.Consts) > 0 {
+		mw.buf.WriteString("## Constants\n\n")
+		mw.values(d.Consts)
+	}
+	if len(d.Vars) > 0 {
+		mw.buf.WriteString("## Variables\n\n")
+		mw.values(d.Vars)
+	}
+	if len(d.Funcs) > 0 {
+		mw.buf.WriteString("## Functions\n\n")
+		for _, f := range d.Funcs {
+			mw.function(f, "")
+		}
+	}
+	if len(d.Types) > 0 {
+		mw.buf.WriteString("## Types\n\n")
+		for _, t := range d.Types {
+			mw.typ(t)
+		}
+	}
+	return mw.buf.Bytes(), mw.err
+}
+
+type markdownWriter struct {
+	buf     bytes.Buffer
+	fset    *token.FileSet
+	pkg     *doc.Package
+	printer *comment.Printer
+	err     error
+}
+
+// docComment writes a doc comment converted to Markdown. Code blocks are
+// written as fenced blocks rather than the indented blocks that
+// comment.Printer produces.
+func (mw *markdownWriter) docComment(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	parsed := mw.pkg.Parser().Parse(text)
+	var pending []comment.Block
+	flush := func() {
+		if len(pending) > 0 {
+			mw.buf.Write(mw.printer.Markdown(&comment.Doc{Content: pending, Links: parsed.Links}))
+			mw.buf.WriteString("\n")
+			pending = nil
+		}
+	}
+	for _, b := range parsed.Content {
+		code, ok := b.(*comment.Code)
+		if !ok {
+			pending = append(pending, b)
+			continue
+		}
+		flush()
+		fmt.Fprintf(&mw.buf, "```\n%s```\n\n", code.Text)
+	}
+	flush()
+}
+
+// heading writes a symbol heading preceded by an HTML anchor matching the
+// id used for the symbol on the unit's HTML page.
+func (mw *markdownWriter) heading(level int, id, text string) {
+	if id != "" {
+		fmt.Fprintf(&mw.buf, "<a id=%q></a>\n\n", id)
+	}
+	fmt.Fprintf(&mw.buf, "%s %s\n\n", strings.Repeat("#", level), text)
+}
+
+// decl writes a declaration, without its doc comment, as a fenced go block.
+func (mw *markdownWriter) decl(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		c := *n
+		c.Doc = nil
+		c.Body = nil
+		mw.fenced(&c)
+	case *ast.GenDecl:
+		c := *n
+		c.Doc = nil
+		mw.fenced(&c)
+	}
+}
+
+func (mw *markdownWriter) fenced(n ast.Node) {
+	var b bytes.Buffer
+	if err := format.Node(&b, mw.fset, n); err != nil {
+		if mw.err == nil {
+			mw.err = err
+		}
+		return
+	}
+	fmt.Fprintf(&mw.buf, "```go\n%s\n```\n\n", b.Bytes())
+}
+
+func (mw *markdownWriter) values(vs []*doc.Value) {
+	for _, v := range vs {
+		id := ""
+		if len(v.Names) > 0 {
+			id = v.Names[0]
+		}
+		if id != "" {
+			fmt.Fprintf(&mw.buf, "<a id=%q></a>\n\n", id)
+		}
+		mw.decl(v.Decl)
+		mw.docComment(v.Doc)
+	}
+}
+
+// function writes a function or, if recv is non-empty, a method of recv.
+func (mw *markdownWriter) function(f *doc.Func, recv string) {
+	id, title := f.Name, "func "+f.Name
+	if recv != "" {
+		id = recv + "." + f.Name
+		title = fmt.Sprintf("func (%s) %s", f.Recv, f.Name)
+	}
+	mw.heading(3, id, title)
+	mw.decl(f.Decl)
+	mw.docComment(f.Doc)
+}
+
+func (mw *markdownWriter) typ(t *doc.Type) {
+	mw.heading(3, t.Name, "type "+t.Name)
+	mw.decl(t.Decl)
+	mw.docComment(t.Doc)
+	mw.values(t.Consts)
+	mw.values(t.Vars)
+	for _, f := range t.Funcs {
+		mw.function(f, "")
+	}
+	for _, m := range t.Methods {
+		mw.function(m, t.Name)
+	}
+}
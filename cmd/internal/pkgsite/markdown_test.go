@@ -0,0 +1,147 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"flag"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("update", false, "update goldens instead of checking against them")
+
+const markdownFixture = `// Package pkg exercises the Markdown export.
+//
+// # Usage
+//
+// Call [F] with a [Config], or see [example.com/m/other.T] and
+// [errgroup.Group]. More at https://go.dev/doc.
+//
+//   - first item
+//   - second item
+//
+// Example:
+//
+//	c := pkg.Config{Name: "x"}
+//	pkg.F(c)
+package pkg
+
+import "golang.org/x/sync/errgroup"
+
+// Version is the package version.
+const Version = "1.0"
+
+// Config configures F.
+type Config struct {
+	Name string // the name
+}
+
+// NewConfig returns a default [Config].
+func NewConfig() *Config { return nil }
+
+// Validate reports whether c is usable.
+func (c *Config) Validate() error { return nil }
+
+// F does the thing.
+//
+// Deprecated: use [G] instead.
+func F(c Config) error { return nil }
+
+// G does the thing better.
+func G(c Config) error { var _ errgroup.Group; return nil }
+`
+
+func TestUnitMarkdown(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "pkg.go", markdownFixture, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := doc.NewFromFiles(fset, []*ast.File{f}, "example.com/m/pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := markdownLinks{units: []string{"example.com/m", "example.com/m/other", "example.com/m/pkg"}}
+	got, err := unitMarkdown(fset, d, "Package pkg exercises the Markdown export.", func(importPath string) string {
+		return links.unitURL("example.com/m/pkg", importPath)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "markdown.golden")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestMarkdownLinks(t *testing.T) {
+	units := []string{"example.com/m", "example.com/m/a", "example.com/m/b/c"}
+	for _, test := range []struct {
+		siteURL, from, to, want string
+	}{
+		{"", "example.com/m/a", "example.com/m/b/c", "../../../example.com/m/b/c/doc.md"},
+		{"", "example.com/m/a", "golang.org/x/sync/errgroup", "https://pkg.go.dev/golang.org/x/sync/errgroup"},
+		{"https://docs.example.com/", "example.com/m/a", "example.com/m", "https://docs.example.com/example.com/m/"},
+	} {
+		l := markdownLinks{units: units, siteURL: test.siteURL}
+		if got := l.unitURL(test.from, test.to); got != test.want {
+			t.Errorf("unitURL(%q, %q) with site URL %q = %q, want %q", test.from, test.to, test.siteURL, got, test.want)
+		}
+	}
+}
+
+func TestGenerateStaticSiteMarkdown(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+-- a/a.go --
+// Package a is documented.
+package a
+
+// F returns [b.T].
+func F() {}
+-- b/b.go --
+// Package b is documented too.
+package b
+
+// T is a type.
+type T int
+`, func(_ *ServerConfig, opts *GenerateOptions) { opts.EmitMarkdown = true })
+
+	data, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "a", "doc.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# package a", "> Package a is documented.", "### func F"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("a/doc.md does not contain %q:\n%s", want, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "m", "b", "doc.md")); err != nil {
+		t.Error(err)
+	}
+	// The module root is not a package.
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "m", "doc.md")); err == nil {
+		t.Error("doc.md written for module root")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// With GenerateOptions.Minify, the pages are minified as they are written,
+// once every transform, the Content-Security-Policy and the rewriting of
+// their URLs are done with them, and the style sheets and scripts copied
+// into the site are minified as they are copied. Correctness comes before
+// size: in the HTML, runs of white space between and inside the elements
+// become a single space or newline, and comments go, but tags and their
+// attributes are written as they were, and the contents of the elements
+// whose white space shows or matters, such as <pre>, <textarea>, the lines
+// of source pages, <script> and <style>, are left alone, so that code and
+// the hashes of inline code stay as they were. The marker comments of the
+// fragments of <head> stay too, for the pages to be processed again. Style
+// sheets and scripts lose their white space and comments other than
+// license comments; those that are already minified, with a source map,
+// are copied as they are. See minify_esbuild.go.
+
+// minifyPreserved holds the elements whose contents minifyHTML leaves
+// alone: those whose white space shows, and those with raw text.
+var minifyPreserved = map[string]bool{
+	"iframe":    true,
+	"listing":   true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"plaintext": true,
+	"pre":       true,
+	"script":    true,
+	"style":     true,
+	"textarea":  true,
+	"title":     true,
+	"xmp":       true,
+}
+
+// minifyPreservedClasses holds the classes of the elements that the style
+// sheets of the site lay out with white-space: pre, whose contents
+// minifyHTML leaves alone too.
+var minifyPreservedClasses = []string{"Source-text"}
+
+// minifyHTML returns the page data with the white space of its text
+// collapsed and its comments removed, other than the marker comments of
+// head.go and conditional comments. A page that the tokenizer of the HTML
+// package cannot read to the end is returned as it is.
+func minifyHTML(data []byte) []byte {
+	var b bytes.Buffer
+	b.Grow(len(data))
+	z := html.NewTokenizer(bytes.NewReader(data))
+	// preserved is the element whose contents are left alone, and depth
+	// the number of its elements open, including it.
+	var preserved string
+	depth := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return data
+			}
+			b.Write(z.Raw())
+			return b.Bytes()
+		}
+		// Reading the name and attributes of a tag lowers their case in
+		// the raw bytes, which are written as they were.
+		raw := bytes.Clone(z.Raw())
+		switch tt {
+		case html.StartTagToken, html.EndTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			switch {
+			case depth > 0 && tag == preserved && tt == html.StartTagToken:
+				depth++
+			case depth > 0 && tag == preserved:
+				depth--
+			case depth == 0 && tt == html.StartTagToken && (minifyPreserved[tag] || hasAttr && hasPreservedClass(z)):
+				preserved, depth = tag, 1
+			}
+		case html.TextToken:
+			if depth == 0 {
+				raw = collapseSpace(raw)
+			}
+		case html.CommentToken:
+			if c := string(z.Text()); depth == 0 && !strings.HasPrefix(c, headBeginMarker) && !strings.HasPrefix(c, headEndMarker) && !strings.HasPrefix(c, "[if") && !strings.HasPrefix(c, "<![endif") {
+				continue
+			}
+		}
+		b.Write(raw)
+	}
+}
+
+// hasPreservedClass reports whether the tag that z is at has one of
+// minifyPreservedClasses. It reads the attributes of the tag.
+func hasPreservedClass(z *html.Tokenizer) bool {
+	for {
+		key, val, more := z.TagAttr()
+		if string(key) == "class" {
+			for _, c := range strings.Fields(string(val)) {
+				if slices.Contains(minifyPreservedClasses, c) {
+					return true
+				}
+			}
+		}
+		if !more {
+			return false
+		}
+	}
+}
+
+// collapseSpace returns text with each run of HTML white space replaced by
+// a newline, if it has one, or else a space.
+func collapseSpace(text []byte) []byte {
+	out := text[:0:0]
+	for i := 0; i < len(text); {
+		if !isHTMLSpace(text[i]) {
+			out = append(out, text[i])
+			i++
+			continue
+		}
+		sep := byte(' ')
+		for ; i < len(text) && isHTMLSpace(text[i]); i++ {
+			if text[i] == '\n' {
+				sep = '\n'
+			}
+		}
+		out = append(out, sep)
+	}
+	return out
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
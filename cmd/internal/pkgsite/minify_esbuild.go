@@ -0,0 +1,45 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// github.com/evanw/esbuild doesn't compile on plan9
+//go:build !plan9
+
+package pkgsite
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// minifyAsset returns the style sheet or script data, with extension ext,
+// without its white space and comments other than license comments. It
+// returns data as it is if the file is already minified, with a source map,
+// or is not CSS or JavaScript.
+func minifyAsset(data []byte, ext string) ([]byte, error) {
+	var loader api.Loader
+	switch ext {
+	case ".css":
+		loader = api.LoaderCSS
+	case ".js", ".mjs":
+		loader = api.LoaderJS
+	default:
+		return data, nil
+	}
+	if bytes.Contains(data, []byte("sourceMappingURL=")) {
+		return data, nil
+	}
+	result := api.Transform(string(data), api.TransformOptions{
+		Loader:           loader,
+		MinifyWhitespace: true,
+		LegalComments:    api.LegalCommentsInline,
+		Charset:          api.CharsetUTF8,
+		LogLevel:         api.LogLevelSilent,
+	})
+	if len(result.Errors) > 0 {
+		return data, fmt.Errorf("%s", result.Errors[0].Text)
+	}
+	return result.Code, nil
+}
@@ -0,0 +1,14 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Since github.com/evanw/esbuild doesn't build on plan9, style sheets and
+// scripts are copied as they are there.
+
+//go:build plan9
+
+package pkgsite
+
+func minifyAsset(data []byte, ext string) ([]byte, error) {
+	return data, nil
+}
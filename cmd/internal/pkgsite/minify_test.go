@@ -0,0 +1,153 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestMinifyHTML(t *testing.T) {
+	for _, test := range []struct {
+		name, in, want string
+	}{
+		{
+			"white space",
+			"<!DOCTYPE html>\n<html lang=\"en\">\n  <head>\n    <title>A  page</title>\n  </head>\n  <body>\n    <p>Some   <b>bold</b>\ttext</p>\n  </body>\n</html>\n",
+			"<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<title>A  page</title>\n</head>\n<body>\n<p>Some <b>bold</b> text</p>\n</body>\n</html>\n",
+		},
+		{
+			"comments",
+			"<head><!--pkgsite:begin csp--><meta charset=\"utf-8\"><!--pkgsite:end csp--><!-- a comment --></head><body><!--[if IE]>old<![endif]--><p>x</p></body>",
+			"<head><!--pkgsite:begin csp--><meta charset=\"utf-8\"><!--pkgsite:end csp--></head><body><!--[if IE]>old<![endif]--><p>x</p></body>",
+		},
+		{
+			"code",
+			"<div>\n  <pre>\nfunc F() {\n\treturn  <span class=\"x\">1</span>\n}\n<!-- kept --><pre>nested  </pre>  kept\n</pre>\n  <textarea>  a\n\n  b</textarea>\n</div>",
+			"<div>\n<pre>\nfunc F() {\n\treturn  <span class=\"x\">1</span>\n}\n<!-- kept --><pre>nested  </pre>  kept\n</pre>\n<textarea>  a\n\n  b</textarea>\n</div>",
+		},
+		{
+			"scripts and styles",
+			"<script>\n  if (a  <  b) {}\n</script>\n  <style>\n  p  { color: red }\n</style>",
+			"<script>\n  if (a  <  b) {}\n</script>\n<style>\n  p  { color: red }\n</style>",
+		},
+		{
+			"source lines",
+			`<tr class="Source-line"><td class="Source-number">  1  </td><td class="Source-text">	if  x {  <span>y</span>  }</td></tr>`,
+			`<tr class="Source-line"><td class="Source-number"> 1 </td><td class="Source-text">	if  x {  <span>y</span>  }</td></tr>`,
+		},
+		{
+			"attributes",
+			"<svg viewBox=\"0 0 1 1\">\n  <a href=\"#A  B\" id=\"A  B\">x</a>\n</svg>",
+			"<svg viewBox=\"0 0 1 1\">\n<a href=\"#A  B\" id=\"A  B\">x</a>\n</svg>",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, string(minifyHTML([]byte(test.in)))); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGenerateStaticSiteMinify(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+//
+// For example:
+//
+//	if err := m.F(); err != nil {
+//		log.Fatal(err)
+//	}
+package m
+
+// F does a thing.
+func F() error { return nil }
+-- example_test.go --
+package m_test
+
+import (
+	"fmt"
+
+	"example.com/m"
+)
+
+func ExampleF() {
+	if err := m.F(); err == nil {
+		fmt.Println("done")  // two spaces
+	}
+	// Output:
+	// done
+}
+`)
+	generate := func(minify bool) string {
+		t.Helper()
+		outDir := t.TempDir()
+		cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Minify: minify}); err != nil {
+			t.Fatal(err)
+		}
+		return outDir
+	}
+	plainDir, minDir := generate(false), generate(true)
+	read := func(dir, file string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	plain, minified := read(plainDir, "example.com/m/index.html"), read(minDir, "example.com/m/index.html")
+	if len(minified) >= len(plain) {
+		t.Errorf("the minified page is %d bytes, the page %d", len(minified), len(plain))
+	}
+
+	// The code of the example, its output and the code blocks are as they
+	// were, and so are the ids of the page.
+	elemRE := regexp.MustCompile(`(?s)<(textarea|pre)[^>]*>.*?</(?:textarea|pre)>`)
+	code := elemRE.FindAllString(minified, -1)
+	if diff := cmp.Diff(elemRE.FindAllString(plain, -1), code); diff != "" {
+		t.Errorf("code mismatch (-plain +minified):\n%s", diff)
+	}
+	if want := "\tif err := m.F(); err == nil {\n\t\tfmt.Println(&#34;done&#34;) // two spaces\n\t}\n"; !slices.ContainsFunc(code, func(s string) bool { return strings.Contains(s, want) }) {
+		t.Errorf("no code block has the example %q:\n%s", want, strings.Join(code, "\n"))
+	}
+	idRE := regexp.MustCompile(`\sid="[^"]*"`)
+	if diff := cmp.Diff(idRE.FindAllString(plain, -1), idRE.FindAllString(minified, -1)); diff != "" {
+		t.Errorf("ids mismatch (-plain +minified):\n%s", diff)
+	}
+
+	// Scripts lose their white space, and those already minified, with a
+	// source map, are as they were.
+	for _, test := range []struct {
+		file     string
+		minified bool
+	}{
+		{"third_party/dialog-polyfill/dialog-polyfill.js", true},
+		{"static/frontend/frontend.js", false},
+		{"static/frontend/frontend.min.css", false},
+	} {
+		p, m := read(plainDir, test.file), read(minDir, test.file)
+		if got := len(m) < len(p); got != test.minified {
+			t.Errorf("%s: minified = %t, want %t (%d bytes, %d before)", test.file, got, test.minified, len(m), len(p))
+		}
+	}
+}
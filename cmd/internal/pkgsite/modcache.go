@@ -0,0 +1,67 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+)
+
+// Modules already in a module cache, such as the warm cache of a CI
+// machine, can be documented from it without network access, as
+// ServerConfig.CachedModules lists them. The cache is that of CacheDir, or
+// else $(go env GOMODCACHE). A module is read from its extracted
+// <module>@<version> directory, or else from its zip in cache/download,
+// and the cache is never written to. A version that is not in the cache
+// is an error, which names the "go mod download" command that adds it.
+// Like remote modules, cached modules are served at their versions only,
+// and their pages are at their module paths.
+
+// ParseCachedModule parses a cached module written as "path@version", such
+// as "golang.org/x/text@v0.14.0". The version is a canonical semantic
+// version, as the cache has no queries to resolve it.
+func ParseCachedModule(s string) (ModuleVersion, error) {
+	mv, err := ParseRemoteModule(s)
+	if err != nil {
+		return ModuleVersion{}, fmt.Errorf("invalid cached module %q: want path@version", s)
+	}
+	return mv, nil
+}
+
+// newCachedGetters returns the getters of the cached modules mvs, which
+// read them from the module cache at cacheDir at their versions. local
+// holds the paths of the modules read from Paths, versioned those of the
+// modules with ModuleVersions, remote those of the remote modules and
+// zipped those of the module zips, none of which can also be cached.
+func newCachedGetters(mvs []ModuleVersion, cacheDir string, local, versioned, remote, zipped map[string]bool) ([]*versionGetter, error) {
+	seen := map[string]bool{}
+	var getters []*versionGetter
+	for _, mv := range mvs {
+		mv.Dir = cacheDir
+		if err := mv.check(); err != nil {
+			return nil, err
+		}
+		switch {
+		case seen[mv.Path]:
+			return nil, fmt.Errorf("cached module %s is given twice", mv.Path)
+		case local[mv.Path]:
+			return nil, fmt.Errorf("cached module %s is also a local module", mv.Path)
+		case versioned[mv.Path]:
+			return nil, fmt.Errorf("cached module %s also has module versions", mv.Path)
+		case remote[mv.Path]:
+			return nil, fmt.Errorf("cached module %s is also a remote module", mv.Path)
+		case zipped[mv.Path]:
+			return nil, fmt.Errorf("cached module %s is also read from a module zip", mv.Path)
+		}
+		seen[mv.Path] = true
+		g, err := fetch.NewCachedModuleGetter(cacheDir, mv.Path, mv.Version)
+		if err != nil {
+			return nil, err
+		}
+		getters = append(getters, &versionGetter{ModuleGetter: g, modulePath: mv.Path, version: mv.Version, dir: g.Dir(), latest: true})
+	}
+	return getters, nil
+}
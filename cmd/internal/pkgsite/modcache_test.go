@@ -0,0 +1,195 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestParseCachedModule(t *testing.T) {
+	got, err := ParseCachedModule("example.com/m@v1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ModuleVersion{Path: "example.com/m", Version: "v1.2.3"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	for _, s := range []string{"example.com/m", "@v1.2.3", "example.com/m@"} {
+		if _, err := ParseCachedModule(s); err == nil {
+			t.Errorf("ParseCachedModule(%q): got nil error", s)
+		}
+	}
+}
+
+// writeFakeModCache writes a module cache holding example.com/Upper at
+// v1.0.0, extracted, and example.com/zipped at v0.3.0, as a zip only, and
+// makes it read-only, as the go command does. It returns the cache and a
+// function returning the modification times of its files.
+func writeFakeModCache(t *testing.T) (string, func() map[string]time.Time) {
+	t.Helper()
+	zipData, err := testhelper.ZipContents(map[string]string{
+		"example.com/zipped@v0.3.0/go.mod": "module example.com/zipped\n\ngo 1.21\n",
+		"example.com/zipped@v0.3.0/z.go":   "// Package zipped is in the download cache.\npackage zipped\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := t.TempDir()
+	for name, content := range map[string]string{
+		"example.com/!upper@v1.0.0/go.mod":                 "module example.com/Upper\n\ngo 1.21\n",
+		"example.com/!upper@v1.0.0/u.go":                   "// Package Upper is extracted.\npackage upper\n",
+		"example.com/!upper@v1.0.0/sub/s.go":               "// Package sub is extracted too.\npackage sub\n\n// F does it.\nfunc F() {}\n",
+		"cache/download/example.com/!upper/@v/v1.0.0.info": `{"Version":"v1.0.0","Time":"2023-04-05T06:07:08Z"}`,
+		"cache/download/example.com/!upper/@v/v1.0.0.mod":  "module example.com/Upper\n\ngo 1.21\n",
+		"cache/download/example.com/zipped/@v/v0.3.0.info": `{"Version":"v0.3.0","Time":"2022-01-02T03:04:05Z"}`,
+		"cache/download/example.com/zipped/@v/v0.3.0.mod":  "module example.com/zipped\n\ngo 1.21\n",
+		"cache/download/example.com/zipped/@v/v0.3.0.zip":  string(zipData),
+	} {
+		file := filepath.Join(cache, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o444); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var dirs []string
+	filepath.WalkDir(cache, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			dirs = append(dirs, p)
+		}
+		return err
+	})
+	for _, d := range dirs {
+		os.Chmod(d, 0o555)
+	}
+	t.Cleanup(func() {
+		for _, d := range dirs {
+			os.Chmod(d, 0o755)
+		}
+	})
+	snapshot := func() map[string]time.Time {
+		files := map[string]time.Time{}
+		filepath.WalkDir(cache, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files[p] = info.ModTime()
+			return nil
+		})
+		return files
+	}
+	return cache, snapshot
+}
+
+func TestGenerateStaticSiteCachedModules(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	// Nothing is downloaded.
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	cache, snapshot := writeFakeModCache(t)
+	before := snapshot()
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/local
+
+go 1.21
+-- local.go --
+// Package local is on disk.
+package local
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{modDir},
+		UseListedMods: true,
+		CacheDir:      cache,
+		CachedModules: []ModuleVersion{
+			{Path: "example.com/Upper", Version: "v1.0.0"},
+			{Path: "example.com/zipped", Version: "v0.3.0"},
+		},
+	}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string][]string{
+		"example.com/Upper":     {"Package Upper is extracted.", `href="../../example.com/Upper/sub"`, "v1.0.0"},
+		"example.com/Upper/sub": {"Package sub is extracted too.", "func F()"},
+		"example.com/zipped":    {"Package zipped is in the download cache.", "v0.3.0"},
+		"example.com/local":     {"Package local is on disk."},
+	} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p), "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(data), w) {
+				t.Errorf("page of %s does not contain %s", p, w)
+			}
+		}
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+	if len(report.BrokenLinks) > 0 {
+		t.Errorf("broken links: %+v", report.BrokenLinks)
+	}
+	if diff := cmp.Diff(before, snapshot()); diff != "" {
+		t.Errorf("the module cache changed (-before +after):\n%s", diff)
+	}
+}
+
+func TestCachedModuleErrors(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	cache, _ := writeFakeModCache(t)
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/local
+
+go 1.21
+-- local.go --
+package local
+`)
+	good := ModuleVersion{Path: "example.com/zipped", Version: "v0.3.0"}
+	for _, test := range []struct {
+		name   string
+		cached []ModuleVersion
+		zips   []ModuleVersion
+		want   string
+	}{
+		{"absent", []ModuleVersion{{Path: "example.com/zipped", Version: "v0.4.0"}}, nil, `run "go mod download example.com/zipped@v0.4.0"`},
+		{"case", []ModuleVersion{{Path: "example.com/upper", Version: "v1.0.0"}}, nil, `run "go mod download example.com/upper@v1.0.0"`},
+		{"not canonical", []ModuleVersion{{Path: "example.com/zipped", Version: "latest"}}, nil, "not a canonical semantic version"},
+		{"local", []ModuleVersion{{Path: "example.com/local", Version: "v1.0.0"}}, nil, "also a local module"},
+		{"twice", []ModuleVersion{good, good}, nil, "given twice"},
+		{"zip", []ModuleVersion{good}, []ModuleVersion{{Path: "example.com/zipped", Version: "v0.3.0", Dir: filepath.Join(cache, "cache", "download", "example.com", "zipped", "@v", "v0.3.0.zip")}}, "also read from a module zip"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := ServerConfig{
+				Paths:         []string{modDir},
+				UseListedMods: true,
+				CacheDir:      cache,
+				CachedModules: test.cached,
+				ModuleZips:    test.zips,
+			}
+			err := GenerateStaticSite(context.Background(), cfg, t.TempDir())
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// The configuration can give a module a path of its own: GOPATH mode
+// finds a module's directory from its path, and ServerConfig.ModuleVersions
+// names the module of each directory. The path that the go.mod file of the
+// directory declares is the one the go command loads the packages under,
+// so it is the module's path for every page, link, setting and filter of
+// the site. A configured path that differs from it is warned about, and
+// fails the run in strict mode.
+
+// A modulePathMismatch is a module directory whose go.mod file declares
+// another path than the configuration gives it.
+type modulePathMismatch struct {
+	configured string // path given by the configuration
+	declared   string // path of the module directive
+	dir        string
+}
+
+func (m modulePathMismatch) Error() string {
+	return fmt.Sprintf("%s is configured as module %s, but its go.mod file declares module %s; documenting it as %s", m.dir, m.configured, m.declared, m.declared)
+}
+
+// declaredModulePath returns the path that the go.mod file of dir declares,
+// and a mismatch if it is not configured, the path the configuration gives
+// the module. A directory without a go.mod file, as in GOPATH mode, has
+// the configured path.
+func declaredModulePath(configured, dir string) (string, *modulePathMismatch, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if errors.Is(err, os.ErrNotExist) {
+		return configured, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	declared := modfile.ModulePath(data)
+	if declared == "" {
+		return "", nil, fmt.Errorf("%s: no module directive", filepath.Join(dir, "go.mod"))
+	}
+	if declared == configured {
+		return declared, nil, nil
+	}
+	return declared, &modulePathMismatch{configured: configured, declared: declared, dir: dir}, nil
+}
+
+// checkModulePaths warns about the mismatches to w, or returns an error
+// listing them in strict mode. It returns the declared paths of the
+// mismatches by configured path.
+func checkModulePaths(mismatches []modulePathMismatch, strict bool, w io.Writer) (map[string]string, error) {
+	if len(mismatches) == 0 {
+		return nil, nil
+	}
+	if strict {
+		msgs := make([]string, len(mismatches))
+		for i, m := range mismatches {
+			msgs[i] = m.Error()
+		}
+		return nil, fmt.Errorf("module paths differ from their go.mod files:\n\t%s", strings.Join(msgs, "\n\t"))
+	}
+	renamed := map[string]string{}
+	for _, m := range mismatches {
+		fmt.Fprintf(w, "Warning: %s\n", m)
+		renamed[m.configured] = m.declared
+	}
+	return renamed, nil
+}
+
+// renamePattern returns the path or path pattern p, with a configured
+// module path of renamed at its start replaced by the declared path.
+func renamePattern(p string, renamed map[string]string) string {
+	for configured, declared := range renamed {
+		if p == configured {
+			return declared
+		}
+		if rest, ok := strings.CutPrefix(p, configured+"/"); ok {
+			return declared + "/" + rest
+		}
+	}
+	return p
+}
+
+// renamePatterns returns patterns with renamePattern applied to each.
+func renamePatterns(patterns []string, renamed map[string]string) []string {
+	if len(renamed) == 0 {
+		return patterns
+	}
+	out := make([]string, len(patterns))
+	for i, p := range patterns {
+		out[i] = renamePattern(p, renamed)
+	}
+	return out
+}
+
+// rename returns idx with the settings of the configured module paths of
+// renamed moved to their declared paths, unless those have settings of
+// their own.
+func (idx moduleSettingsIndex) rename(renamed map[string]string) moduleSettingsIndex {
+	out := moduleSettingsIndex{}
+	for p, s := range idx {
+		out[p] = s
+	}
+	for configured, declared := range renamed {
+		s, ok := idx[canonicalUnitPath(configured)]
+		if !ok {
+			continue
+		}
+		delete(out, canonicalUnitPath(configured))
+		if _, ok := idx[canonicalUnitPath(declared)]; !ok {
+			out[canonicalUnitPath(declared)] = s
+		}
+	}
+	return out
+}
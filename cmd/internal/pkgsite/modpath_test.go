@@ -0,0 +1,193 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestDeclaredModulePath(t *testing.T) {
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- same/go.mod --
+module example.com/bar
+-- other/go.mod --
+module example.com/foo
+-- none/go.mod --
+go 1.21
+-- gopath/bar.go --
+package bar
+`)
+	for _, test := range []struct {
+		dir          string
+		wantPath     string
+		wantMismatch bool
+		wantErr      bool
+	}{
+		{"same", "example.com/bar", false, false},
+		{"other", "example.com/foo", true, false},
+		{"gopath", "example.com/bar", false, false},
+		{"none", "", false, true},
+	} {
+		got, mismatch, err := declaredModulePath("example.com/bar", filepath.Join(dir, test.dir))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error %t", test.dir, err, test.wantErr)
+			continue
+		}
+		if got != test.wantPath || (mismatch != nil) != test.wantMismatch {
+			t.Errorf("%s: got %q, mismatch %v, want %q, mismatch %t", test.dir, got, mismatch, test.wantPath, test.wantMismatch)
+		}
+	}
+}
+
+func TestRenamePattern(t *testing.T) {
+	renamed := map[string]string{"example.com/bar": "example.com/foo"}
+	for in, want := range map[string]string{
+		"example.com/bar":            "example.com/foo",
+		"example.com/bar/sub":        "example.com/foo/sub",
+		"example.com/bar/**":         "example.com/foo/**",
+		"example.com/barx":           "example.com/barx",
+		"**/internal/**":             "**/internal/**",
+		"example.com/other/bar/more": "example.com/other/bar/more",
+	} {
+		if got := renamePattern(in, renamed); got != want {
+			t.Errorf("renamePattern(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestModuleSettingsRename(t *testing.T) {
+	idx := moduleSettingsIndex{
+		"example.com/bar": {VersionSuffix: "(bar)"},
+		"example.com/baz": {VersionSuffix: "(baz)"},
+		"example.com/qux": {VersionSuffix: "(qux)"},
+	}
+	got := idx.rename(map[string]string{"example.com/bar": "example.com/foo", "example.com/baz": "example.com/qux"})
+	want := moduleSettingsIndex{
+		"example.com/foo": {VersionSuffix: "(bar)"},
+		"example.com/qux": {VersionSuffix: "(qux)"}, // its own settings win
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// modulePathMismatchFixture is a GOPATH whose directory of example.com/bar
+// holds module example.com/foo.
+const modulePathMismatchFixture = `
+-- src/example.com/bar/go.mod --
+module example.com/foo
+
+go 1.21
+-- src/example.com/bar/foo.go --
+// Package foo is the root of the module.
+package foo
+
+import _ "example.com/foo/sub"
+-- src/example.com/bar/sub/sub.go --
+// Package sub is a package of the module.
+package sub
+-- src/example.com/bar/gen/gen.go --
+// Package gen is left out by the filters.
+package gen
+`
+
+func TestGenerateStaticSiteModulePathMismatch(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	gopath, _ := testhelper.WriteTxtarToTempDir(t, modulePathMismatchFixture)
+	t.Setenv("GOPATH", gopath)
+	t.Setenv("GOMODCACHE", filepath.Join(t.TempDir(), "mod"))
+	cfg := ServerConfig{Paths: []string{"example.com/bar"}, GOPATHMode: true}
+	var l recordingLogger
+	outDir := t.TempDir()
+	opts := GenerateOptions{
+		OutDir:       outDir,
+		Logger:       &l,
+		ExcludeGlobs: []string{"example.com/bar/gen"},
+		ModuleSettings: map[string]ModuleSettings{
+			"example.com/bar": {Banner: "Configured as bar.", BannerOnAllUnits: true},
+		},
+	}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages := strings.Join(l.lines, "\n"); !strings.Contains(messages, "Warning: "+filepath.Join(gopath, "src", "example.com", "bar")+" is configured as module example.com/bar, but its go.mod file declares module example.com/foo") {
+		t.Errorf("no warning about the module path:\n%s", messages)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "bar")); !os.IsNotExist(err) {
+		t.Errorf("pages were written under the configured path: %v", err)
+	}
+	home, err := os.ReadFile(filepath.Join(outDir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(home), `href="./example.com/bar"`) || !strings.Contains(string(home), `href="./example.com/foo"`) {
+		t.Error("the homepage does not list the module by its declared path")
+	}
+	// The settings and filters of the configured path apply to the module.
+	for _, unit := range []string{"example.com/foo", "example.com/foo/sub"} {
+		page, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(unit), "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(page), "Configured as bar.") {
+			t.Errorf("%s: no banner of the module settings", unit)
+		}
+	}
+	if diff := cmp.Diff([]string{"example.com/foo/gen"}, report.LeftOut); diff != "" {
+		t.Errorf("left out units mismatch (-want +got):\n%s", diff)
+	}
+
+	// In strict mode, the mismatch fails the run.
+	opts.OutDir, opts.Strict = t.TempDir(), true
+	_, err = GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+	if err == nil || !strings.Contains(err.Error(), "declares module example.com/foo") {
+		t.Errorf("strict: got error %v, want one about the module path", err)
+	}
+}
+
+func TestGenerateStaticSiteModuleVersionPathMismatch(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- m/go.mod --
+module example.com/m
+
+go 1.21
+-- m/m.go --
+// Package m is documented at its latest version.
+package m
+-- v1.0.0/go.mod --
+module example.com/foo
+
+go 1.21
+-- v1.0.0/foo.go --
+// Package foo is the root of the module.
+package foo
+`)
+	cfg := ServerConfig{
+		Paths:          []string{filepath.Join(dir, "m")},
+		UseListedMods:  true,
+		ModuleVersions: []ModuleVersion{{Path: "example.com/bar", Version: "v1.0.0", Dir: filepath.Join(dir, "v1.0.0")}},
+	}
+	var l recordingLogger
+	outDir := t.TempDir()
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Logger: &l}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "foo@v1.0.0", "index.html")); err != nil {
+		t.Errorf("the version was not written under the declared path: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "bar@v1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("pages were written under the configured path: %v", err)
+	}
+}
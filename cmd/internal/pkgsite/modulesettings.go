@@ -0,0 +1,173 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/sanitizer"
+)
+
+// ModuleSettings customizes the generated pages of one module.
+type ModuleSettings struct {
+	// VersionSuffix is shown after the version in the page header, as in
+	// "v2.3.0 (LTS)".
+	VersionSuffix string `json:"versionSuffix,omitempty"`
+	// Banner is an HTML message shown on the module's root page. It is
+	// sanitized like a README, and limited to maxModuleBannerSize bytes.
+	Banner string `json:"banner,omitempty"`
+	// BannerOnAllUnits shows the banner on every unit page of the module
+	// rather than only on its root page.
+	BannerOnAllUnits bool `json:"bannerOnAllUnits,omitempty"`
+	// SourceLink is the URL template of the repository links of the files
+	// of a local module, such as
+	// "https://github.com/org/repo/blob/{commit}/{path}#L{line}". See
+	// sourcelinks.go.
+	SourceLink string `json:"sourceLink,omitempty"`
+}
+
+const (
+	maxModuleBannerSize  = 2048
+	maxVersionSuffixSize = 64
+)
+
+// LoadModuleSettings reads per-module settings from a JSON file holding an
+// object keyed by module path.
+func LoadModuleSettings(file string) (map[string]ModuleSettings, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]ModuleSettings
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&settings); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return settings, nil
+}
+
+// moduleSettingsIndex looks up module settings by canonical module path.
+type moduleSettingsIndex map[string]ModuleSettings
+
+// newModuleSettingsIndex validates settings and indexes them by canonical
+// module path.
+func newModuleSettingsIndex(settings map[string]ModuleSettings) (moduleSettingsIndex, error) {
+	idx := moduleSettingsIndex{}
+	for modulePath, s := range settings {
+		if len(s.Banner) > maxModuleBannerSize {
+			return nil, fmt.Errorf("module %s: banner is %d bytes, more than the limit of %d", modulePath, len(s.Banner), maxModuleBannerSize)
+		}
+		if len(s.VersionSuffix) > maxVersionSuffixSize {
+			return nil, fmt.Errorf("module %s: version suffix is %d bytes, more than the limit of %d", modulePath, len(s.VersionSuffix), maxVersionSuffixSize)
+		}
+		if strings.ContainsAny(s.VersionSuffix, "\n\r") {
+			return nil, fmt.Errorf("module %s: version suffix contains a newline", modulePath)
+		}
+		if s.SourceLink != "" {
+			if err := checkSourceLink(s.SourceLink); err != nil {
+				return nil, fmt.Errorf("module %s: source link: %v", modulePath, err)
+			}
+		}
+		idx[canonicalUnitPath(modulePath)] = s
+	}
+	return idx, nil
+}
+
+// transform returns the page transform applying the settings of the
+// unit's module to its page, or nil if there is nothing to apply.
+func (idx moduleSettingsIndex) transform(um *internal.UnitMeta) pageTransform {
+	s, ok := idx[canonicalUnitPath(um.ModulePath)]
+	if !ok {
+		return nil
+	}
+	showBanner := s.Banner != "" && (um.IsModule() || s.BannerOnAllUnits)
+	if s.VersionSuffix == "" && !showBanner {
+		return nil
+	}
+	return func(doc *html.Node, head *headManager) {
+		if s.VersionSuffix != "" {
+			addVersionSuffix(doc, s.VersionSuffix)
+		}
+		if showBanner {
+			addModuleBanner(doc, head, s.Banner)
+		}
+	}
+}
+
+// addVersionSuffix appends suffix to the version in the unit page header.
+func addVersionSuffix(doc *html.Node, suffix string) {
+	item := findElementFunc(doc, func(n *html.Node) bool {
+		return attrValue(n, "data-test-id") == "UnitHeader-version"
+	})
+	if item == nil {
+		return
+	}
+	a := findElement(item, "a")
+	if a == nil {
+		return
+	}
+	for i, attr := range a.Attr {
+		if attr.Key == "aria-label" {
+			a.Attr[i].Val = attr.Val + " " + suffix
+		}
+	}
+	// The version is the last text in the link.
+	for c := a.LastChild; c != nil; c = c.PrevSibling {
+		if c.Type == html.TextNode && strings.TrimSpace(c.Data) != "" {
+			trimmed := strings.TrimRight(c.Data, " \t\n")
+			c.Data = trimmed + " " + suffix + c.Data[len(trimmed):]
+			return
+		}
+	}
+}
+
+// moduleBannerStyle sets module banners apart from the notice, warning and
+// alert messages used for redirects, deprecation and vulnerabilities.
+const moduleBannerStyle = `.spk-ModuleBanner {
+  background-color: var(--color-background-accented);
+  border-left: 0.25rem solid var(--color-brand-primary);
+}`
+
+// addModuleBanner adds the sanitized banner HTML at the end of the unit
+// page's banner area. The banner is marked as not being page content.
+func addModuleBanner(doc *html.Node, head *headManager, banner string) {
+	area := findElementFunc(doc, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && hasClass(n, "go-Main-banner")
+	})
+	if area == nil {
+		return
+	}
+	div := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "div",
+		DataAtom: atom.Div,
+		Attr: []html.Attribute{
+			{Key: "class", Val: "go-Message spk-ModuleBanner"},
+			{Key: "data-test-id", Val: "UnitHeader-moduleBanner"},
+			{Key: noIndexAttr, Val: ""},
+		},
+	}
+	nodes, err := html.ParseFragment(bytes.NewReader(sanitizer.SanitizeBytes([]byte(banner))), div)
+	if err != nil {
+		return
+	}
+	for _, n := range nodes {
+		div.AppendChild(n)
+	}
+	area.AppendChild(div)
+
+	style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+	style.AppendChild(&html.Node{Type: html.TextNode, Data: moduleBannerStyle})
+	head.register("module-banner-style", headOrderStyle, style)
+}
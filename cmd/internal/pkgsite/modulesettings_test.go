@@ -0,0 +1,163 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+)
+
+func TestLoadModuleSettings(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	if err := os.WriteFile(good, []byte(`{"example.com/sdk": {"versionSuffix": "(LTS)", "banner": "v3 is in beta", "bannerOnAllUnits": true}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadModuleSettings(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ModuleSettings{
+		"example.com/sdk": {VersionSuffix: "(LTS)", Banner: "v3 is in beta", BannerOnAllUnits: true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"example.com/sdk": {"suffix": "(LTS)"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadModuleSettings(bad); err == nil {
+		t.Error("got nil error for an unknown field")
+	}
+}
+
+func TestNewModuleSettingsIndex(t *testing.T) {
+	for _, s := range []ModuleSettings{
+		{Banner: strings.Repeat("x", maxModuleBannerSize+1)},
+		{VersionSuffix: strings.Repeat("x", maxVersionSuffixSize+1)},
+		{VersionSuffix: "(LTS)\n"},
+		{SourceLink: "/blob/{commit}/{path}"},
+	} {
+		if _, err := newModuleSettingsIndex(map[string]ModuleSettings{"example.com/m": s}); err == nil {
+			t.Errorf("%+v: got nil error", s)
+		}
+	}
+	idx, err := newModuleSettingsIndex(map[string]ModuleSettings{
+		"bücher.example/m": {VersionSuffix: "(LTS)"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	um := &internal.UnitMeta{Path: "xn--bcher-kva.example/m", ModuleInfo: internal.ModuleInfo{ModulePath: "xn--bcher-kva.example/m"}}
+	if idx.transform(um) == nil {
+		t.Error("settings keyed by the Unicode module path do not apply to the punycode path")
+	}
+}
+
+func TestModuleSettingsTransform(t *testing.T) {
+	const page = `<html><head><title>T</title></head><body><main>` +
+		`<div class="go-Main-banner" role="alert"><div class="go-Message go-Message--warning">Deprecated</div></div>` +
+		`<span class="go-Main-headerDetailItem" data-test-id="UnitHeader-version">` +
+		`<a href="?tab=versions" aria-label="Version: v2.3.0"><span aria-hidden="true">Version: </span>
+        v2.3.0
+    </a></span></main></body></html>`
+	settings := map[string]ModuleSettings{
+		"example.com/sdk": {
+			VersionSuffix: "(LTS)",
+			Banner:        `v3 is in beta — see <a href="/example.com/sdk/v3">example.com/sdk/v3</a><script>alert(1)</script>`,
+		},
+	}
+	idx, err := newModuleSettingsIndex(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit := func(path string) *internal.UnitMeta {
+		return &internal.UnitMeta{Path: path, ModuleInfo: internal.ModuleInfo{ModulePath: "example.com/sdk"}}
+	}
+
+	got, err := processHTML([]byte(page), "/example.com/sdk", nil, idx.transform(unit("example.com/sdk")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`aria-label="Version: v2.3.0 (LTS)"`,
+		"v2.3.0 (LTS)\n",
+		`<div class="go-Message go-Message--warning">Deprecated</div><div class="go-Message spk-ModuleBanner go-Message--module" data-test-id="UnitHeader-moduleBanner" data-pkgsite-noindex="">v3 is in beta — see <a href="../../example.com/sdk/v3"`,
+		".spk-ModuleBanner {",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("root page does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(string(got), "alert(1)") {
+		t.Error("banner script was not sanitized")
+	}
+
+	// Other units get the version suffix but not the banner.
+	got, err = processHTML([]byte(page), "/example.com/sdk/sub", nil, idx.transform(unit("example.com/sdk/sub")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "v2.3.0 (LTS)") || strings.Contains(string(got), "spk-ModuleBanner") {
+		t.Errorf("unexpected subpackage page:\n%s", got)
+	}
+
+	// Unless the banner is shown on all units.
+	settings["example.com/sdk"] = ModuleSettings{Banner: "Beta", BannerOnAllUnits: true}
+	idx, err = newModuleSettingsIndex(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = processHTML([]byte(page), "/example.com/sdk/sub", nil, idx.transform(unit("example.com/sdk/sub")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), `data-pkgsite-noindex="">Beta</div>`) {
+		t.Errorf("banner missing from subpackage page:\n%s", got)
+	}
+	if idx.transform(&internal.UnitMeta{Path: "example.com/other", ModuleInfo: internal.ModuleInfo{ModulePath: "example.com/other"}}) != nil {
+		t.Error("settings applied to another module")
+	}
+}
+
+func TestGenerateStaticSiteModuleSettings(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/sdk
+-- sdk.go --
+// Package sdk is the SDK.
+package sdk
+-- sub/sub.go --
+// Package sub is part of the SDK.
+package sub
+`, func(_ *ServerConfig, opts *GenerateOptions) {
+		opts.ModuleSettings = map[string]ModuleSettings{
+			"example.com/sdk": {VersionSuffix: "(LTS)", Banner: "<strong>v3</strong> is in beta"},
+		}
+	})
+	root, err := os.ReadFile(filepath.Join(outDir, "example.com", "sdk", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"UnitHeader-moduleBanner", "<strong>v3</strong> is in beta", "(LTS)"} {
+		if !strings.Contains(string(root), want) {
+			t.Errorf("module page does not contain %q", want)
+		}
+	}
+	sub, err := os.ReadFile(filepath.Join(outDir, "example.com", "sdk", "sub", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sub), "UnitHeader-moduleBanner") {
+		t.Error("subpackage page has the module banner")
+	}
+}
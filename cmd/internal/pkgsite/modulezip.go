@@ -0,0 +1,100 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+)
+
+// Modules can be documented from module zip files, such as those of a
+// module proxy or of the download cache, as ServerConfig.ModuleZips lists
+// them, each with its module path and version and the zip file as its Dir.
+// A zip holds the files of the module under a <module>@<version>/
+// directory; it is checked as the go command checks the zips it
+// downloads, and a malformed zip is an error naming the offending file.
+// Like remote modules, the modules of zips are served at their versions
+// only, and their pages are at their module paths.
+
+// ParseModuleZip parses a module zip written as "path@version=file", such
+// as "example.com/m@v1.2.3=./m.zip".
+func ParseModuleZip(s string) (ModuleVersion, error) {
+	modver, file, ok := strings.Cut(s, "=")
+	i := strings.LastIndex(modver, "@")
+	if !ok || i <= 0 || i == len(modver)-1 || file == "" {
+		return ModuleVersion{}, fmt.Errorf("invalid module zip %q: want path@version=file", s)
+	}
+	return ModuleVersion{Path: modver[:i], Version: modver[i+1:], Dir: file}, nil
+}
+
+// newZipGetters returns the getters of the module zips mvs, which read the
+// modules from their zip files at their versions. local holds the paths of
+// the modules read from Paths, versioned those of the modules with
+// ModuleVersions and remote those of the remote modules, none of which can
+// also be read from a zip.
+func newZipGetters(mvs []ModuleVersion, local, versioned, remote map[string]bool) ([]*versionGetter, error) {
+	seen := map[string]bool{}
+	var getters []*versionGetter
+	for _, mv := range mvs {
+		if err := mv.check(); err != nil {
+			return nil, err
+		}
+		switch {
+		case seen[mv.Path]:
+			return nil, fmt.Errorf("module zip of %s is given twice", mv.Path)
+		case local[mv.Path]:
+			return nil, fmt.Errorf("module zip of %s: it is also a local module", mv.Path)
+		case versioned[mv.Path]:
+			return nil, fmt.Errorf("module zip of %s: it also has module versions", mv.Path)
+		case remote[mv.Path]:
+			return nil, fmt.Errorf("module zip of %s: it is also a remote module", mv.Path)
+		}
+		seen[mv.Path] = true
+		g, err := fetch.NewZipModuleGetter(mv.Path, mv.Version, mv.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("module zip %s: %v", mv.Dir, err)
+		}
+		getters = append(getters, &versionGetter{ModuleGetter: g, modulePath: mv.Path, version: mv.Version, dir: mv.Dir, latest: true})
+	}
+	return getters, nil
+}
+
+// moduleFS returns the files of the module at dir, a directory or, for a
+// module read from a zip, the zip file.
+func moduleFS(dir string) (fs.FS, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return os.DirFS(dir), nil
+	}
+	data, err := os.ReadFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	if len(zr.File) == 0 {
+		return zr, nil
+	}
+	// The files are under the <module>@<version>/ directory, and module
+	// paths have no @.
+	name := zr.File[0].Name
+	at := strings.Index(name, "@")
+	slash := strings.Index(name[at+1:], "/")
+	if at < 0 || slash < 0 {
+		return nil, fmt.Errorf("%s: %s is not under a <module>@<version>/ directory", dir, name)
+	}
+	return fs.Sub(zr, name[:at+1+slash])
+}
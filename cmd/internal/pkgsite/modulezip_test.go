@@ -0,0 +1,153 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestParseModuleZip(t *testing.T) {
+	got, err := ParseModuleZip("example.com/m@v1.2.3=./m.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ModuleVersion{Path: "example.com/m", Version: "v1.2.3", Dir: "./m.zip"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	for _, s := range []string{"example.com/m@v1.2.3", "example.com/m=./m.zip", "@v1.2.3=./m.zip", "example.com/m@=./m.zip", "example.com/m@v1.2.3="} {
+		if _, err := ParseModuleZip(s); err == nil {
+			t.Errorf("ParseModuleZip(%q): got nil error", s)
+		}
+	}
+}
+
+// writeModuleZip writes a zip of files, named as they are, to a file in a
+// temporary directory and returns its path.
+func writeModuleZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+	data, err := testhelper.ZipContents(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "m.zip")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestGenerateStaticSiteModuleZip(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	file := writeModuleZip(t, map[string]string{
+		"example.com/z@v1.2.3/go.mod":   "module example.com/z\n\ngo 1.21\n",
+		"example.com/z@v1.2.3/z.go":     "// Package z is zipped.\npackage z\n",
+		"example.com/z@v1.2.3/sub/s.go": "// Package sub is zipped too.\npackage sub\n\n// F does it.\nfunc F() {}\n",
+	})
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/local
+
+go 1.21
+-- local.go --
+// Package local is on disk.
+package local
+`)
+	outDir := t.TempDir()
+	bundle := filepath.Join(t.TempDir(), "repro.zip")
+	cfg := ServerConfig{
+		Paths:         []string{modDir},
+		UseListedMods: true,
+		ModuleZips:    []ModuleVersion{{Path: "example.com/z", Version: "v1.2.3", Dir: file}},
+	}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, ReproBundle: bundle, IncludeSources: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string][]string{
+		"example.com/z":     {"Package z is zipped.", `href="../../example.com/z/sub"`, "v1.2.3"},
+		"example.com/z/sub": {"Package sub is zipped too.", "func F()"},
+		"example.com/local": {"Package local is on disk."},
+	} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p), "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(data), w) {
+				t.Errorf("page of %s does not contain %s", p, w)
+			}
+		}
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+	if len(report.BrokenLinks) > 0 {
+		t.Errorf("broken links: %+v", report.BrokenLinks)
+	}
+
+	// The sources of the module in the repro bundle are those in the zip.
+	data, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zr.Open("sources/example.com/z/sub/s.go"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestModuleZipErrors(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/local
+
+go 1.21
+-- local.go --
+package local
+`)
+	good := writeModuleZip(t, map[string]string{
+		"example.com/z@v1.0.0/go.mod": "module example.com/z\n",
+		"example.com/z@v1.0.0/z.go":   "package z\n",
+	})
+	stray := writeModuleZip(t, map[string]string{
+		"example.com/z@v1.0.0/go.mod": "module example.com/z\n",
+		"example.com/z@v1.0.0/z.go":   "package z\n",
+		"stray/z.go":                  "package z\n",
+	})
+	for _, test := range []struct {
+		name string
+		zips []ModuleVersion
+		want string
+	}{
+		{"malformed", []ModuleVersion{{Path: "example.com/z", Version: "v1.0.0", Dir: stray}}, "stray/z.go"},
+		{"other version", []ModuleVersion{{Path: "example.com/z", Version: "v1.1.0", Dir: good}}, "example.com/z@v1.0.0/go.mod"},
+		{"not canonical", []ModuleVersion{{Path: "example.com/z", Version: "v1", Dir: good}}, "not a canonical semantic version"},
+		{"local", []ModuleVersion{{Path: "example.com/local", Version: "v1.0.0", Dir: good}}, "also a local module"},
+		{"twice", []ModuleVersion{{Path: "example.com/z", Version: "v1.0.0", Dir: good}, {Path: "example.com/z", Version: "v1.0.0", Dir: good}}, "given twice"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := ServerConfig{
+				Paths:         []string{modDir},
+				UseListedMods: true,
+				ModuleZips:    test.zips,
+			}
+			err := GenerateStaticSite(context.Background(), cfg, t.TempDir())
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
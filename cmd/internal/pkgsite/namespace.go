@@ -0,0 +1,126 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// The elements that the generator adds to pages, such as the platform
+// table, the module banner, the symbol index and the results of the
+// client-side search, have ids and classes starting with injectedPrefix.
+// The anchors of the documentation are Go identifiers, such as Banner or
+// T.M, or start with a prefix of pkgsite's own, such as pkg- or hdr-, and
+// the sanitizer keeps classes out of READMEs but for those of diagrams,
+// so the prefixed names cannot collide with those of the documentation.
+// A check run on every page, idChecker, warns about any id that is on
+// more than one element, whatever its origin.
+//
+// The elements had unprefixed names before; the old names are added
+// along with the new ones by addLegacyNames, so that custom CSS and links
+// that use them keep working for one release, with the same names in the
+// search script. The shim will then be removed.
+const injectedPrefix = "spk-"
+
+// legacyClasses and legacyIDs map the prefixed classes and ids of the
+// injected elements rendered on the server to their old names.
+var (
+	legacyClasses = map[string]string{
+		"spk-PlatformTable":        "Documentation-platforms",
+		"spk-PlatformTable-header": "Documentation-platformsHeader",
+		"spk-PlatformTable-table":  "Documentation-platformsTable",
+		"spk-ModuleBanner":         "go-Message--module",
+		"spk-SymbolIndex":          "SymbolIndex",
+		"spk-SymbolIndex-package":  "SymbolIndex-package",
+		"spk-SymbolIndex-heading":  "SymbolIndex-heading",
+		"spk-SymbolIndex-list":     "SymbolIndex-list",
+		"spk-SymbolIndex-symbol":   "SymbolIndex-symbol",
+		"spk-SymbolIndex-kind":     "SymbolIndex-kind",
+		"spk-SymbolIndex-synopsis": "SymbolIndex-synopsis",
+		"spk-SymbolIndex-pages":    "SymbolIndex-pages",
+	}
+	legacyIDs = map[string]string{
+		"spk-platforms": "pkg-platforms",
+	}
+)
+
+// addLegacyNames adds to the injected elements of the document rooted at
+// n their old classes, and before each element with a renamed id an empty
+// element with the old id, as the target of old links. It is idempotent.
+func addLegacyNames(n *html.Node) {
+	if n.Type == html.ElementNode {
+		if classes := strings.Fields(attrValue(n, "class")); len(classes) > 0 {
+			added := classes
+			for _, c := range classes {
+				if old, ok := legacyClasses[c]; ok && !slices.Contains(added, old) {
+					added = append(slices.Clip(added), old)
+				}
+			}
+			if len(added) > len(classes) {
+				setAttr(n, "class", strings.Join(added, " "))
+			}
+		}
+		if old, ok := legacyIDs[attrValue(n, "id")]; ok && n.Parent != nil {
+			prev := n.PrevSibling
+			if prev == nil || prev.Type != html.ElementNode || attrValue(prev, "id") != old {
+				n.Parent.InsertBefore(&html.Node{
+					Type:     html.ElementNode,
+					Data:     "span",
+					DataAtom: atom.Span,
+					Attr:     []html.Attribute{{Key: "id", Val: old}},
+				}, n)
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		addLegacyNames(c)
+	}
+}
+
+// An idChecker is a pageConsumer that finds the ids that are on more than
+// one element of a page, such as an injected element whose id is that of
+// a symbol, and warns about them when the site is written.
+type idChecker struct {
+	w    io.Writer           // where the warnings are written
+	dups map[string][]string // ids on several elements, by page file
+}
+
+func newIDChecker(w io.Writer) *idChecker {
+	return &idChecker{w: w, dups: map[string][]string{}}
+}
+
+func (c *idChecker) consumePage(ev *pageEvent) error {
+	if !ev.HTML {
+		return nil
+	}
+	seen := map[string]int{}
+	for _, id := range ev.IDs {
+		seen[id]++
+		if seen[id] == 2 {
+			c.dups[ev.File] = append(c.dups[ev.File], id)
+		}
+	}
+	return nil
+}
+
+func (c *idChecker) finish(context.Context, *siteOutput) error {
+	files := make([]string, 0, len(c.dups))
+	for f := range c.dups {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		fmt.Fprintf(c.w, "Warning: %s: ids on several elements, so that links to them are ambiguous: %s\n", f, strings.Join(c.dups[f], ", "))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLegacyNames(t *testing.T) {
+	for _, m := range []map[string]string{legacyClasses, legacyIDs} {
+		for name := range m {
+			if !strings.HasPrefix(name, injectedPrefix) {
+				t.Errorf("%s does not start with %s", name, injectedPrefix)
+			}
+		}
+	}
+
+	page := `<!DOCTYPE html><html><head></head><body>` +
+		`<section class="spk-PlatformTable"><h3 id="spk-platforms" class="spk-PlatformTable-header x">Platforms</h3></section>` +
+		`<div class="go-Message spk-ModuleBanner">Beta</div><p class="Other">Text</p></body></html>`
+	want := `<section class="spk-PlatformTable Documentation-platforms">` +
+		`<span id="pkg-platforms"></span><h3 id="spk-platforms" class="spk-PlatformTable-header x Documentation-platformsHeader">Platforms</h3></section>` +
+		`<div class="go-Message spk-ModuleBanner go-Message--module">Beta</div><p class="Other">Text</p>`
+	got, err := processHTML([]byte(page), "/example.com/m", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), want) {
+		t.Errorf("got\n%s\nwant it to contain\n%s", got, want)
+	}
+	again, err := processHTML(got, "/example.com/m", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(got), string(again)); diff != "" {
+		t.Errorf("processing twice (-once +twice):\n%s", diff)
+	}
+}
+
+func TestIDChecker(t *testing.T) {
+	var w strings.Builder
+	c := newIDChecker(&w)
+	for _, ev := range []*pageEvent{
+		{File: "a/index.html", HTML: true, IDs: []string{"pkg-overview", "T", "spk-platforms", "T", "T"}},
+		{File: "b/index.html", HTML: true, IDs: []string{"T", "T.M"}},
+		{File: "a/index.md", IDs: []string{"T", "T"}},
+	} {
+		if err := c.consumePage(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string][]string{"a/index.html": {"T"}}
+	if diff := cmp.Diff(want, c.dups); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if err := c.finish(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := w.String(), "Warning: a/index.html: ids on several elements, so that links to them are ambiguous: T\n"; got != want {
+		t.Errorf("warnings: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// The text files of a site are written with LF line endings and in UTF-8
+// without a byte order mark, whatever the system the generator runs on and
+// the files it copies, so that generations on different systems write the
+// same bytes. GenerateOptions.CRLF writes CRLF line endings instead, for
+// hosts that need them. siteOutput.writeFile normalizes every file it
+// writes, before hashing it, so that the manifest, the fingerprints and
+// the content hashes of the pages are those of the files as written. The
+// files named after a hash of their contents, such as the favicons of the
+// branding, are named after their contents with LF line endings.
+//
+// A file is text if its extension is that of a text format, or, for other
+// extensions, if its contents sniff as text; either way, it must be valid
+// UTF-8 without NUL bytes. Other files are written as they are.
+
+// textExtensions are the extensions of the text formats of a site.
+var textExtensions = map[string]bool{
+	".css":         true,
+	".csv":         true,
+	".htm":         true,
+	".html":        true,
+	".js":          true,
+	".json":        true,
+	".map":         true,
+	".md":          true,
+	".mjs":         true,
+	".svg":         true,
+	".txt":         true,
+	".webmanifest": true,
+	".xml":         true,
+}
+
+// binaryExtensions are the extensions of the binary formats of a site,
+// which are never sniffed.
+var binaryExtensions = map[string]bool{
+	".br":    true,
+	".eot":   true,
+	".gif":   true,
+	".gz":    true,
+	".ico":   true,
+	".jpeg":  true,
+	".jpg":   true,
+	".otf":   true,
+	".pdf":   true,
+	".png":   true,
+	".ttf":   true,
+	".wasm":  true,
+	".webp":  true,
+	".woff":  true,
+	".woff2": true,
+	".zip":   true,
+}
+
+var utf8BOM = []byte("\ufeff")
+
+// isTextFile reports whether the file at the slash-separated path p, with
+// contents data, is a text file.
+func isTextFile(p string, data []byte) bool {
+	ext := strings.ToLower(path.Ext(p))
+	if binaryExtensions[ext] || bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return false
+	}
+	return textExtensions[ext] || strings.HasPrefix(http.DetectContentType(data), "text/")
+}
+
+// normalizeText returns the contents data of the file at the
+// slash-separated path p without a byte order mark and with LF line
+// endings, or CRLF ones if crlf is set, if the file is text. Otherwise it
+// returns data. Carriage returns that do not end a line are kept.
+func normalizeText(p string, data []byte, crlf bool) []byte {
+	if !isTextFile(p, data) {
+		return data
+	}
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if bytes.Contains(data, []byte("\r\n")) {
+		data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	}
+	if crlf && bytes.IndexByte(data, '\n') >= 0 {
+		data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	}
+	return data
+}
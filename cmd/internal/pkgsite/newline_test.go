@@ -0,0 +1,108 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+func TestNormalizeText(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n\x00\x00"
+	for _, test := range []struct {
+		path, in string
+		crlf     bool
+		want     string
+	}{
+		{"a.css", "a {}\r\nb {}\r\n", false, "a {}\nb {}\n"},
+		{"a.js", "\ufeffvar x;\r\n", false, "var x;\n"},
+		{"a.json", `{"a": 1}`, false, `{"a": 1}`},
+		{"a/index.html", "<p>\r</p>\n", false, "<p>\r</p>\n"},
+		{"a/index.html", "<p>\n</p>\r\n", true, "<p>\r\n</p>\r\n"},
+		{"a.txt", "\xff\xfe\r\n", false, "\xff\xfe\r\n"},
+		{"a.png", png, false, png},
+		{"a.png", "text\r\n", false, "text\r\n"},
+		{"_headers", "/*\r\n  X: y\r\n", false, "/*\n  X: y\n"},
+		{"data.bin", "a\x00\r\n", false, "a\x00\r\n"},
+	} {
+		got := string(normalizeText(test.path, []byte(test.in), test.crlf))
+		if got != test.want {
+			t.Errorf("normalizeText(%q, %q, %t) = %q, want %q", test.path, test.in, test.crlf, got, test.want)
+		}
+		// Normalizing is idempotent.
+		if again := string(normalizeText(test.path, []byte(got), test.crlf)); again != got {
+			t.Errorf("normalizeText(%q, %q, %t) = %q, want it unchanged", test.path, got, test.crlf, again)
+		}
+	}
+}
+
+func TestSiteOutputNormalizesText(t *testing.T) {
+	dir := t.TempDir()
+	out := testSiteOutput(t, dir)
+	file := filepath.Join(dir, "style.css")
+	if err := out.writeFile(file, []byte("\ufeffa {}\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a {}\n" {
+		t.Errorf("got %q, want %q", data, "a {}\n")
+	}
+	// The recorded hash is that of the file as written.
+	sum := sha256.Sum256(data)
+	if got, want := out.written["style.css"], hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("recorded hash %s, want %s", got, want)
+	}
+}
+
+func TestGenerateStaticSiteCRLF(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+//
+// It does them well.
+package m
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, CRLF: true, ContentHash: true}); err != nil {
+		t.Fatal(err)
+	}
+	page, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lf := regexp.MustCompile("(^|[^\r])\n").Find(page); lf != nil {
+		t.Errorf("page has an LF line ending: %q", lf)
+	}
+	// The fingerprints are those of the files as written.
+	data, err := os.ReadFile(filepath.Join(outDir, fingerprintsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fps, err := schema.DecodeFingerprints(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fps.Paths["/example.com/m/"], contentHash(page, true); got != want {
+		t.Errorf("fingerprint of the page is %s, want %s", got, want)
+	}
+}
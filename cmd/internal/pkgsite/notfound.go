@@ -0,0 +1,42 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+)
+
+// Static hosts such as GitHub Pages, Netlify and S3 with CloudFront serve
+// 404.html from the site root for any missing path. Since the page is
+// served at arbitrary depths, its links are absolute paths under the base
+// path of the site URL rather than relative ones.
+
+// notFoundURLPath is the path at which the generator's mux serves the
+// frontend's not-found page, and the page's file in the output.
+const notFoundURLPath = "/404.html"
+
+// writeNotFoundPage renders the not-found page and writes it to 404.html in
+// out, with its links under basePath, and returns the size of the file. The
+// transforms are applied to the page, which is summarized in ev, if not nil.
+func writeNotFoundPage(mux *http.ServeMux, out *siteOutput, basePath string, ev *pageEvent, transforms ...pageTransform) (int, error) {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", notFoundURLPath, nil))
+	if w.Code != http.StatusNotFound {
+		return 0, fmt.Errorf("GET %s returned status %d", notFoundURLPath, w.Code)
+	}
+	body, err := processHTMLWithPrefix(w.Body.Bytes(), basePath, ev, out.pageTransforms(notFoundURLPath, transforms)...)
+	if err != nil {
+		return 0, fmt.Errorf("processing HTML for %s: %w", notFoundURLPath, err)
+	}
+	if out.minify {
+		body = minifyHTML(body)
+	}
+	file := filepath.Join(out.dir, notFoundURLPath[1:])
+	body = out.normalize(file, body)
+	return len(body), out.writeFile(file, body)
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestGenerateStaticSiteNotFoundPage(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`)
+	for _, test := range []struct {
+		name     string
+		siteURL  string
+		basePath string
+		skip     bool
+		want     []string // in the page
+	}{
+		{
+			name: "root",
+			want: []string{`href="/static/`, `src="/static/`},
+		},
+		{
+			name:    "subpath",
+			siteURL: "https://example.com/docs/",
+			want:    []string{`href="/docs/static/`, `src="/docs/static/`, `href="/docs/"`},
+		},
+		{
+			name:     "base path",
+			basePath: "/docs",
+			want:     []string{`href="/docs/static/`, `src="/docs/static/`, `href="/docs/"`},
+		},
+		{
+			name: "skipped",
+			skip: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			outDir := t.TempDir()
+			cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true, SiteURL: test.siteURL}
+			opts := GenerateOptions{OutDir: outDir, BasePath: test.basePath, SkipNotFoundPage: test.skip}
+			if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join(outDir, "404.html"))
+			if test.skip {
+				if !os.IsNotExist(err) {
+					t.Errorf("404.html: got %v, want not exist", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			page := string(data)
+			want := append([]string{"404 Not Found", `http-equiv="Content-Security-Policy"`}, test.want...)
+			for _, w := range want {
+				if !strings.Contains(page, w) {
+					t.Errorf("404.html does not contain %q", w)
+				}
+			}
+			// Relative links would break when the page is served for a
+			// deeper path.
+			if strings.Contains(page, `"../`) || strings.Contains(page, `"./`) {
+				t.Errorf("404.html has relative links:\n%s", page)
+			}
+		})
+	}
+}
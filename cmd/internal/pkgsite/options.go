@@ -0,0 +1,386 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// GenerateOptions holds the settings of a static site generation that
+// the server of ServerConfig has no use for: where and how the site is
+// written, and the files and features of the site besides the pages that
+// the server serves.
+type GenerateOptions struct {
+	// OutDir is the directory the site is written to. It must be set, and
+	// is created if it does not exist. With an archive format, it is the
+	// archive file instead.
+	OutDir string
+	// Format is the format of the output: "dir", a directory, or "tar.gz"
+	// or "zip", an archive of the site, written only once the run
+	// succeeds. If empty, it is "tar.gz" for an OutDir ending in .tar.gz or
+	// .tgz, "zip" for one ending in .zip, and "dir" otherwise. See
+	// outformat.go.
+	Format string
+	// BasePath is the URL path the site is served under, such as "/docs/".
+	// If empty, it is the path of ServerConfig.SiteURL, or "/". If the
+	// site URL is set too, its path must be BasePath.
+	BasePath string
+	// Force writes every file of the site. Otherwise a file that a
+	// previous run wrote with the same contents is left alone, keeping its
+	// modification time.
+	Force bool
+	// Prune deletes every file of the output directory that the run does
+	// not write, and the directories left empty, other than the records the
+	// generator keeps there. Otherwise only the files that the previous run
+	// wrote are deleted, so that the output directory can hold other files.
+	Prune bool
+	// Atomic writes the site to a copy of the output directory next to it,
+	// which replaces the output directory only once the run succeeds, so
+	// that a failed run leaves the output directory as it was. See
+	// atomic.go. An archive is always written that way.
+	Atomic bool
+	// CRLF writes the text files of the site with CRLF line endings rather
+	// than LF ones, for hosts that need them. See newline.go.
+	CRLF bool
+	// Minify removes the white space and comments of the pages, and of
+	// the style sheets and scripts copied into the site, leaving code
+	// blocks as they are. See minify.go.
+	Minify bool
+	// Precompress writes a gzip and a brotli compressed copy next to each
+	// text file of the site, as file.gz and file.br, for hosts that serve
+	// them to the browsers that accept them. See precompress.go.
+	Precompress bool
+	// TimeBudget, if positive, is the time the run should take at most. A
+	// run projected to take longer gives up optional features of the pages
+	// it has left, and finally writes stubs of the units it has left
+	// instead of their pages, as the report records. See budget.go.
+	TimeBudget time.Duration
+	// BuildTime, if set, is the time of the build that pages record, for
+	// templates that show it, rather than the time of the run, as with
+	// SOURCE_DATE_EPOCH for reproducible builds. It also names untagged
+	// archived snapshots, and caps the modification times of the sitemap.
+	// See reproducible.go.
+	BuildTime time.Time
+	// Workers is the number of unit and source pages rendered at once. If
+	// it is less than two, pages are rendered one at a time. It is lowered
+	// to what the limit on open files of the process allows; see
+	// fdlimit.go.
+	Workers int
+	// ReproBundle, if set, is a file to write a zip archive to with what it
+	// takes to reproduce the run, for a bug report: its settings and
+	// environment without secrets, the hashes of the local modules, the
+	// versions of the generator and of Go, and the report. See repro.go.
+	ReproBundle string
+	// IncludeSources adds the files of the local modules to the repro
+	// bundle. Only set it for modules that can be shared.
+	IncludeSources bool
+	// Archive adds a snapshot of the site to the archive directory of the
+	// output directory, named ArchiveTag or, if it is empty, after the time
+	// of the run. A run in strict mode with failed pages archives nothing.
+	// With Atomic, the archive is copied with the rest of the output
+	// directory, and its files stop sharing their contents. See archive.go.
+	Archive    bool
+	ArchiveTag string
+	// ArchiveKeep, if positive, is the number of untagged snapshots kept in
+	// the archive, the newest ones. Tagged snapshots are always kept.
+	ArchiveKeep int
+	// ProgressFormat is the format of the progress of the run: "text", the
+	// default, a line for humans for each page, or "json", a line of JSON
+	// for each event, as schema.ProgressEvent describes. See progress.go.
+	ProgressFormat string
+	// ProgressOutput is where the progress is written. If nil, it is
+	// written to Logger, or to os.Stderr if Logger is nil too.
+	ProgressOutput io.Writer
+	// Progress, if set, is called with each progress event of the run,
+	// which is then not written to ProgressOutput. It may be called by
+	// several workers at once, and must return quickly, as the pages wait
+	// for it.
+	Progress func(ProgressEvent)
+	// Logger, if set, receives the messages of the run, such as its
+	// warnings and summary, rather than os.Stderr.
+	Logger Logger
+
+	// EmitMarkdown writes a CommonMark rendering of each package's
+	// documentation to <unit>/doc.md.
+	EmitMarkdown bool
+	// MarkdownAbsoluteLinks makes links between units in the Markdown
+	// export point at the HTML pages under ServerConfig.SiteURL instead of
+	// at the neighboring doc.md files, which it must be set for.
+	MarkdownAbsoluteLinks bool
+	// EmitText writes a plain-text rendering of each package's
+	// documentation to <unit>/doc.txt, and llms.txt at the root of the site
+	// listing them. See textdoc.go.
+	EmitText bool
+	// ModuleSettings customizes the pages of individual modules, keyed by
+	// module path.
+	ModuleSettings map[string]ModuleSettings
+	// IncludeGlobs and ExcludeGlobs select the units that get pages, by
+	// path patterns such as "**/internal/**". Exclusion wins. See
+	// unitfilter.go.
+	IncludeGlobs []string
+	ExcludeGlobs []string
+	// NoInternal leaves out the units with an "internal" path element,
+	// which only their own module can import.
+	NoInternal bool
+	// Smoke generates only the homepage, the static pages, the root unit
+	// of each module and the assets, and marks the report as partial.
+	Smoke bool
+	// Sitemap writes a sitemap.xml listing the absolute URLs of the pages
+	// under ServerConfig.SiteURL, which must be set.
+	Sitemap bool
+	// DiagramScript, if set, is a JavaScript file copied into the site and
+	// loaded by the pages with README diagrams, to render them. Without it,
+	// diagrams are shown as collapsed source.
+	DiagramScript string
+	// PlatformDivergence adds to the report the packages with symbols
+	// documented on only some of the platforms they build on.
+	PlatformDivergence bool
+	// PlatformTable adds to the pages of those packages a table of the
+	// platforms each such symbol is documented on.
+	PlatformTable bool
+	// FailOnDivergence lists the import path patterns, as in the go
+	// command, of the packages whose platform divergence fails generation.
+	FailOnDivergence []string
+	// EmptyDocMinExported is the number of exported identifiers that the
+	// Go files of a package whose documentation has none must declare for
+	// the package to be reported, with a note on its page. 0 means 1, and
+	// a negative number turns the check off. See emptydocs.go.
+	EmptyDocMinExported int
+	// EmptyDocNote, if set, replaces the text of the note on the pages of
+	// those packages, which otherwise names the likely causes.
+	EmptyDocNote string
+	// Branding replaces the favicons and theme colors of the pages. If nil,
+	// the built-in favicon and default theme colors are used.
+	Branding *Branding
+	// ColorScheme pins the color scheme of the pages: "light" or "dark"
+	// removes the theme toggle and the rules of the other scheme from the
+	// style sheets. If empty or "auto", the pages keep the toggle. See
+	// colorscheme.go.
+	ColorScheme string
+	// StaticPages configures the informational pages of the site, keyed
+	// by their names: "about", "license-policy" and "search-help". A page
+	// that is not listed gets the built-in content. See staticpages.go.
+	StaticPages map[string]StaticPage
+	// SourcePages writes a page for each Go file of the packages of local
+	// modules, and points the "View Source" links of the site at them.
+	SourcePages bool
+	// SourceRef is the commit, or other git ref, of the SourceLink
+	// templates of ModuleSettings. If empty, it is the commit checked out
+	// in the git repository of each module's directory.
+	SourceRef string
+	// MaxSourceSize is the size in bytes of the largest file that gets a
+	// source page, if positive.
+	MaxSourceSize int64
+	// SourceChunkLines, if positive, splits the source pages of files with
+	// more lines into chunks of that many lines, loaded by a script as they
+	// are scrolled to. See sourcechunks.go.
+	SourceChunkLines int
+	// HighlightTheme highlights the Go code of source pages, declarations
+	// and examples with the built-in theme of that name: "default" or
+	// "high-contrast". If empty, code is not highlighted, unless
+	// HighlightCSS is set.
+	HighlightTheme string
+	// HighlightCSS, if set, is a CSS file loaded after the highlight theme,
+	// to override the colors of its token classes. See highlight.go.
+	HighlightCSS string
+	// Prefetch is the most links to child and parent unit pages that each
+	// unit page asks the browser to prefetch. Zero disables prefetching.
+	Prefetch int
+	// DownloadBundles writes a zip file of the pages of each module and
+	// the assets they need, downloads/<module>.zip, linked from the module
+	// page. See downloads.go.
+	DownloadBundles bool
+	// SkipNotFoundPage leaves out the 404.html page, for hosts that do not
+	// serve a custom not-found page.
+	SkipNotFoundPage bool
+	// Strict makes generation fail if any page fails to render. The pages
+	// of a module that getters disagree about the contents of also fail;
+	// otherwise they are written, with a warning. So do references to
+	// paths from the root of the host in the output; see rootpaths.go.
+	Strict bool
+	// Schemas writes the JSON Schema documents of the machine-readable
+	// files, such as the report, to the schemas directory of the site.
+	Schemas bool
+	// ContentHash records the fingerprint of each HTML page on its <html>
+	// element, as the data-content-hash attribute.
+	ContentHash bool
+	// NoClientSearch leaves out the search index and the script that
+	// searches it, which the search forms of the pages otherwise use.
+	// Instead, the forms are handled as SearchFallback says.
+	NoClientSearch bool
+	// SearchFallback decides what becomes of the search forms when
+	// NoClientSearch is set.
+	SearchFallback SearchFallback
+	// InlineSmallImages, if positive, inlines the images of the pages that
+	// are smaller than that many bytes as data: URLs. See inline.go.
+	InlineSmallImages int
+	// StrictCSP drops 'unsafe-inline' from the Content-Security-Policy of
+	// the pages, moving their inline scripts and styles to files of the
+	// site. See strictcsp.go.
+	StrictCSP bool
+	// SubresourceIntegrity gives the elements of the pages loading the
+	// scripts and style sheets of the site integrity attributes with the
+	// hashes of the files. See sri.go.
+	SubresourceIntegrity bool
+	// FingerprintAssets names the style sheets and scripts of the site
+	// after their contents, for immutable caching, and writes
+	// asset-manifest.json with their new names. See fingerprintassets.go.
+	FingerprintAssets bool
+	// CopyAllAssets copies every file of the static and third_party
+	// directories to the site, rather than only those that the site uses.
+	// See treeshake.go.
+	CopyAllAssets bool
+	// ExternalDocsURL is the base URL under which the documentation of
+	// packages outside the site is linked. If empty, it is
+	// https://pkg.go.dev.
+	ExternalDocsURL string
+	// StripExternalLinks replaces the links of the documentation and of
+	// the imports tabs to packages outside the site by their text, rather
+	// than linking them under ExternalDocsURL. See doclinks.go.
+	StripExternalLinks bool
+	// AbsoluteSelfLinks leaves the links of the pages to other pages of
+	// the site by their absolute URLs under ServerConfig.SiteURL as they
+	// are, rather than making them relative. See selflinks.go.
+	AbsoluteSelfLinks bool
+	// Frozen lists the paths of modules that are not loaded, but whose
+	// files are copied from the output of a previous run, in FrozenFrom
+	// or, if it is empty, in the output directory. See frozen.go.
+	Frozen     []string
+	FrozenFrom string
+}
+
+// A ProgressEvent is an event of the progress of a run, passed to
+// GenerateOptions.Progress. Its Event field is the phase of the run it
+// reports, one of the schema.Progress constants.
+type ProgressEvent = schema.ProgressEvent
+
+// GenerateStaticSiteWithOptions is like GenerateStaticSiteReport, with the
+// settings of the generation in opts. The options are checked before any
+// module is fetched.
+func GenerateStaticSiteWithOptions(ctx context.Context, serverCfg ServerConfig, opts GenerateOptions) (*Report, error) {
+	return generateStaticSite(ctx, serverCfg, opts, nil)
+}
+
+// progressReporter returns the reporter of the progress of the run, whose
+// messages are written to w.
+func (opts GenerateOptions) progressReporter(w io.Writer) (progressReporter, error) {
+	if opts.Progress != nil {
+		return callbackProgress(opts.Progress), nil
+	}
+	if opts.ProgressOutput != nil {
+		w = opts.ProgressOutput
+	}
+	return newProgressReporter(opts.ProgressFormat, w)
+}
+
+// apply checks opts and returns serverCfg with them applied, and the
+// output directory.
+func (opts GenerateOptions) apply(serverCfg ServerConfig) (ServerConfig, string, error) {
+	if opts.OutDir == "" {
+		return serverCfg, "", errors.New("no output directory")
+	}
+	format, err := outputFormat(opts.OutDir, opts.Format)
+	if err != nil {
+		return serverCfg, "", err
+	}
+	if fi, err := os.Stat(opts.OutDir); err == nil && fi.IsDir() != (format == formatDir) {
+		if format == formatDir {
+			return serverCfg, "", fmt.Errorf("output directory %s is not a directory", opts.OutDir)
+		}
+		return serverCfg, "", fmt.Errorf("output archive %s is a directory", opts.OutDir)
+	}
+	if _, err := newProgressReporter(opts.ProgressFormat, nil); err != nil {
+		return serverCfg, "", err
+	}
+	if format != formatDir && opts.Archive {
+		return serverCfg, "", errors.New("cannot keep archived snapshots in an output archive")
+	}
+	site, err := siteData(serverCfg.SiteName, serverCfg.SiteURL, "")
+	if err != nil {
+		return serverCfg, "", err
+	}
+	if opts.BasePath != "" {
+		basePath, err := cleanBasePath(opts.BasePath)
+		if err != nil {
+			return serverCfg, "", err
+		}
+		if serverCfg.SiteURL != "" && basePath != site.BasePath {
+			return serverCfg, "", fmt.Errorf("base path %s differs from the path %s of site URL %s", basePath, site.BasePath, serverCfg.SiteURL)
+		}
+		serverCfg.basePath = basePath
+	}
+	if (opts.ArchiveTag != "" || opts.ArchiveKeep != 0) && !opts.Archive {
+		return serverCfg, "", errors.New("archive tag or retention without archiving")
+	}
+	if opts.ArchiveKeep < 0 {
+		return serverCfg, "", fmt.Errorf("negative number of archived snapshots to keep: %d", opts.ArchiveKeep)
+	}
+	if err := checkArchiveTag(opts.ArchiveTag); err != nil {
+		return serverCfg, "", err
+	}
+	if opts.Archive && opts.Smoke {
+		return serverCfg, "", errors.New("cannot archive the partial site of a smoke test")
+	}
+	if err := opts.checkSite(serverCfg); err != nil {
+		return serverCfg, "", err
+	}
+	serverCfg.buildTime = opts.BuildTime.UTC()
+	serverCfg.strict = opts.Strict
+	serverCfg.logOut = logOutput(opts.Logger)
+	return serverCfg, opts.OutDir, nil
+}
+
+// checkSite checks the settings of opts for the files and features of the
+// site, given the server configuration, so that a bad one fails the run
+// before any module is fetched or any file is written. The files they
+// name are read again as the run sets up.
+func (opts GenerateOptions) checkSite(serverCfg ServerConfig) error {
+	if _, err := newModuleSettingsIndex(opts.ModuleSettings); err != nil {
+		return err
+	}
+	if _, err := newSiteBranding(opts.Branding); err != nil {
+		return err
+	}
+	if _, err := newColorScheme(opts.ColorScheme); err != nil {
+		return err
+	}
+	if _, err := newSiteStaticPages(opts.StaticPages); err != nil {
+		return err
+	}
+	if _, err := newHighlighter(opts.HighlightTheme, opts.HighlightCSS); err != nil {
+		return err
+	}
+	if _, err := newUnitFilter(opts.IncludeGlobs, opts.ExcludeGlobs, opts.NoInternal); err != nil {
+		return err
+	}
+	if opts.DiagramScript != "" {
+		if _, err := os.Stat(opts.DiagramScript); err != nil {
+			return fmt.Errorf("reading diagram script: %w", err)
+		}
+	}
+	if opts.EmitMarkdown && opts.MarkdownAbsoluteLinks && serverCfg.SiteURL == "" {
+		return errors.New("absolute Markdown links require a site URL")
+	}
+	return nil
+}
+
+// cleanBasePath returns p with leading and trailing slashes, as the
+// BasePath of page.SiteData has them. p must be a clean, absolute URL path.
+func cleanBasePath(p string) (string, error) {
+	trimmed := strings.TrimSuffix(p, "/")
+	if !strings.HasPrefix(p, "/") || strings.ContainsAny(p, "?#\\") || trimmed != "" && path.Clean(trimmed) != trimmed {
+		return "", fmt.Errorf("invalid base path %q: want a clean absolute URL path, such as /docs/", p)
+	}
+	return trimmed + "/", nil
+}
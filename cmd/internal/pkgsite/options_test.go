@@ -0,0 +1,117 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateOptionsApply(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name    string
+		cfg     ServerConfig
+		opts    GenerateOptions
+		want    ServerConfig // the fields checked: SiteURL, strict, basePath
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			opts: GenerateOptions{OutDir: "out"},
+		},
+		{
+			name: "site URL and strict",
+			cfg:  ServerConfig{SiteURL: "https://example.com/docs/"},
+			opts: GenerateOptions{OutDir: "out", Strict: true},
+			want: ServerConfig{SiteURL: "https://example.com/docs/", strict: true},
+		},
+		{
+			name: "base path",
+			opts: GenerateOptions{OutDir: "out", BasePath: "/a/b"},
+			want: ServerConfig{basePath: "/a/b/"},
+		},
+		{
+			name: "root base path",
+			opts: GenerateOptions{OutDir: "out", BasePath: "/"},
+			want: ServerConfig{basePath: "/"},
+		},
+		{
+			name: "base path of the site URL",
+			cfg:  ServerConfig{SiteURL: "https://example.com/docs"},
+			opts: GenerateOptions{OutDir: "out", BasePath: "/docs/"},
+			want: ServerConfig{SiteURL: "https://example.com/docs", basePath: "/docs/"},
+		},
+		{name: "no output directory", opts: GenerateOptions{}, wantErr: "no output directory"},
+		{name: "output file", opts: GenerateOptions{OutDir: file}, wantErr: "is not a directory"},
+		{name: "output archive file", opts: GenerateOptions{OutDir: file, Format: "zip"}},
+		{name: "output archive directory", opts: GenerateOptions{OutDir: t.TempDir(), Format: "tar.gz"}, wantErr: "is a directory"},
+		{name: "unknown format", opts: GenerateOptions{OutDir: "out", Format: "rar"}, wantErr: "unknown output format"},
+		{name: "snapshots in an archive", opts: GenerateOptions{OutDir: "site.zip", Archive: true}, wantErr: "archived snapshots"},
+		{name: "relative site URL", cfg: ServerConfig{SiteURL: "/docs/"}, opts: GenerateOptions{OutDir: "out"}, wantErr: "not an absolute URL"},
+		{name: "unknown color scheme", opts: GenerateOptions{OutDir: "out", ColorScheme: "sepia"}, wantErr: "unknown color scheme"},
+		{name: "empty unit pattern", opts: GenerateOptions{OutDir: "out", ExcludeGlobs: []string{""}}, wantErr: "empty unit path pattern"},
+		{name: "missing diagram script", opts: GenerateOptions{OutDir: "out", DiagramScript: file + ".missing"}, wantErr: "reading diagram script"},
+		{
+			name:    "absolute Markdown links without a site URL",
+			opts:    GenerateOptions{OutDir: "out", EmitMarkdown: true, MarkdownAbsoluteLinks: true},
+			wantErr: "require a site URL",
+		},
+		{name: "relative base path", opts: GenerateOptions{OutDir: "out", BasePath: "docs/"}, wantErr: "invalid base path"},
+		{name: "unclean base path", opts: GenerateOptions{OutDir: "out", BasePath: "/a/../b/"}, wantErr: "invalid base path"},
+		{name: "double slash", opts: GenerateOptions{OutDir: "out", BasePath: "/a//b"}, wantErr: "invalid base path"},
+		{name: "query", opts: GenerateOptions{OutDir: "out", BasePath: "/a?b"}, wantErr: "invalid base path"},
+		{
+			name:    "base path and site URL differ",
+			cfg:     ServerConfig{SiteURL: "https://example.com/docs/"},
+			opts:    GenerateOptions{OutDir: "out", BasePath: "/other/"},
+			wantErr: "differs from the path /docs/",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, outDir, err := test.opts.apply(test.cfg)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if outDir != test.opts.OutDir {
+				t.Errorf("got output directory %q, want %q", outDir, test.opts.OutDir)
+			}
+			if got.SiteURL != test.want.SiteURL || got.strict != test.want.strict || got.basePath != test.want.basePath {
+				t.Errorf("got SiteURL %q, strict %t, basePath %q; want %q, %t, %q",
+					got.SiteURL, got.strict, got.basePath, test.want.SiteURL, test.want.strict, test.want.basePath)
+			}
+		})
+	}
+}
+
+func TestGenerateStaticSiteWithOptionsValidatesFirst(t *testing.T) {
+	// The options are rejected before the missing module directory is
+	// looked at, or the smoke test prepares the output directory.
+	outDir := filepath.Join(t.TempDir(), "out")
+	cfg := ServerConfig{Paths: []string{filepath.Join(t.TempDir(), "missing")}}
+	_, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, BasePath: "docs", Smoke: true})
+	if err == nil || !strings.Contains(err.Error(), "invalid base path") {
+		t.Fatalf("got error %v, want an invalid base path", err)
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Errorf("output directory: got %v, want not exist", err)
+	}
+
+	if err := GenerateStaticSite(context.Background(), cfg, ""); err == nil || !strings.Contains(err.Error(), "no output directory") {
+		t.Errorf("GenerateStaticSite with no output directory: got error %v", err)
+	}
+}
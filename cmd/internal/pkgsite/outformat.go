@@ -0,0 +1,190 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A deployment that takes an archive rather than a directory can have the
+// site written as one, a tar.gz or zip file, with GenerateOptions.Format or
+// the suffix of the output path. The steps of a run read back the files
+// they wrote, to fingerprint them, bundle them or compress them, so the
+// site is generated to a temporary directory as in directory mode, and
+// packed once the run succeeds. The archive is written next to the output
+// path and renamed to it, so that a failed run leaves it as it was.
+//
+// The archive extracts to the tree of the site: its files are in order of
+// path, with slash-separated names, the modes of the files, and the same
+// modification time, archiveModTime, so that the same site makes the same
+// archive.
+
+// Output formats of GenerateOptions.Format.
+const (
+	formatDir   = "dir"
+	formatTarGz = "tar.gz"
+	formatZip   = "zip"
+)
+
+// archiveModTime is the modification time of the files of an archived
+// site, the earliest that zip files can record.
+var archiveModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// outputFormat returns the output format of a run to out: format if set,
+// or else the one named by the suffix of out.
+func outputFormat(out, format string) (string, error) {
+	switch format {
+	case formatDir, formatTarGz, formatZip:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown output format %q: want %s, %s or %s", format, formatDir, formatTarGz, formatZip)
+	}
+	lower := strings.ToLower(out)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return formatTarGz, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return formatZip, nil
+	}
+	return formatDir, nil
+}
+
+// A siteWriter writes the files of a site to an archive.
+type siteWriter interface {
+	// WriteFile writes the file at the slash-separated path p of the site.
+	WriteFile(p string, data []byte, mode fs.FileMode) error
+	// Close finishes the archive.
+	Close() error
+}
+
+// tarGzWriter is the siteWriter of tar.gz archives.
+type tarGzWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarGzWriter(w io.Writer) *tarGzWriter {
+	gz, _ := gzip.NewWriterLevel(w, gzip.BestCompression) // the level is valid
+	return &tarGzWriter{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (w *tarGzWriter) WriteFile(p string, data []byte, mode fs.FileMode) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     p,
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(data)),
+		ModTime:  archiveModTime,
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := w.tw.Write(data)
+	return err
+}
+
+func (w *tarGzWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// zipWriter is the siteWriter of zip archives.
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func newZipWriter(w io.Writer) *zipWriter {
+	return &zipWriter{zw: zip.NewWriter(w)}
+}
+
+func (w *zipWriter) WriteFile(p string, data []byte, mode fs.FileMode) error {
+	hdr := &zip.FileHeader{Name: p, Method: zip.Deflate, Modified: archiveModTime}
+	hdr.SetMode(mode.Perm())
+	fw, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+// packSite writes the regular files of the site in dir to w, in order of
+// path.
+func packSite(dir string, w siteWriter) error {
+	return filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return w.WriteFile(filepath.ToSlash(rel), data, fi.Mode())
+	})
+}
+
+// writeSiteArchive writes the site in dir to the archive out, in format.
+func writeSiteArchive(dir, out, format string) (err error) {
+	parent, base := filepath.Split(filepath.Clean(out))
+	if parent == "" {
+		parent = "."
+	}
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(parent, "."+base+".pkgsite-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	var w siteWriter
+	if format == formatZip {
+		w = newZipWriter(f)
+	} else {
+		w = newTarGzWriter(f)
+	}
+	if err := packSite(dir, w); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return rename(f.Name(), out)
+}
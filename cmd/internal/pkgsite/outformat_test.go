@@ -0,0 +1,184 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestOutputFormat(t *testing.T) {
+	for _, test := range []struct {
+		out, format, want string
+	}{
+		{"site", "", formatDir},
+		{"site.tar.gz", "", formatTarGz},
+		{"SITE.TGZ", "", formatTarGz},
+		{"out/site.zip", "", formatZip},
+		{"site.gz", "", formatDir},
+		{"site.zip", "dir", formatDir},
+		{"site", "tar.gz", formatTarGz},
+	} {
+		got, err := outputFormat(test.out, test.format)
+		if err != nil || got != test.want {
+			t.Errorf("outputFormat(%q, %q) = %q, %v, want %q", test.out, test.format, got, err, test.want)
+		}
+	}
+	if _, err := outputFormat("site", "tar"); err == nil {
+		t.Error("got no error for an unknown format")
+	}
+}
+
+// readTarGz returns the files of the tar.gz file at file, by name.
+func readTarGz(t *testing.T, file string) map[string][]byte {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Mode != 0o644 || !hdr.ModTime.Equal(archiveModTime) {
+			t.Errorf("%s: %s has mode %o and time %v", file, hdr.Name, hdr.Mode, hdr.ModTime)
+		}
+		if files[hdr.Name], err = io.ReadAll(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPackSite(t *testing.T) {
+	dir := t.TempDir()
+	want := map[string][]byte{
+		"index.html":         []byte("<p>home</p>\n"),
+		"a/b/index.html":     []byte("<p>b</p>\n"),
+		"static/x.css":       []byte("p{}\n"),
+		".pkgsite-meta.json": []byte("{}\n"),
+	}
+	for p, data := range want {
+		file := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for format, read := range map[string]func(*testing.T, string) map[string][]byte{
+		formatTarGz: readTarGz,
+		formatZip:   readZip,
+	} {
+		out := filepath.Join(t.TempDir(), "site."+format)
+		if err := writeSiteArchive(dir, out, format); err != nil {
+			t.Fatal(err)
+		}
+		first, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, read(t, out)); diff != "" {
+			t.Errorf("%s: files mismatch (-want +got):\n%s", format, diff)
+		}
+		// Packing the same files again, with new modification times, makes
+		// the same archive, which replaces the previous one.
+		if err := os.Chtimes(filepath.Join(dir, "index.html"), archiveModTime, archiveModTime); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeSiteArchive(dir, out, format); err != nil {
+			t.Fatal(err)
+		}
+		second, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(first, second) {
+			t.Errorf("%s: the same files make different archives", format)
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(out)); len(entries) != 1 {
+			t.Errorf("%s: left files next to the archive: %v", format, entries)
+		}
+	}
+}
+
+func TestGenerateStaticSiteOutputArchive(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`)
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	dir := t.TempDir()
+	if _, err := GenerateStaticSiteReport(context.Background(), cfg, dir); err != nil {
+		t.Fatal(err)
+	}
+	tree := map[string]bool{}
+	if err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(dir, file)
+			tree[filepath.ToSlash(rel)] = true
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		out, format string
+		read        func(*testing.T, string) map[string][]byte
+	}{
+		{"site.tar.gz", "", readTarGz},
+		{"site.zip", "", readZip},
+		{"site.out", "zip", readZip},
+	} {
+		out := filepath.Join(t.TempDir(), test.out)
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: out, Format: test.format}); err != nil {
+			t.Fatal(err)
+		}
+		files := test.read(t, out)
+		got := map[string]bool{}
+		for p := range files {
+			got[p] = true
+		}
+		if diff := cmp.Diff(tree, got); diff != "" {
+			t.Errorf("%s: files mismatch with the directory (-want +got):\n%s", test.out, diff)
+		}
+		want, err := os.ReadFile(filepath.Join(dir, "static", "frontend", "frontend.min.css"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(files["static/frontend/frontend.min.css"], want) {
+			t.Errorf("%s: static/frontend/frontend.min.css differs from the directory", test.out)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Output file paths are derived from unit paths, which come from module
+// content that may be hostile. Every such path is checked segment by
+// segment before it is joined to the output directory, and the result is
+// checked to lie within the output directory.
+
+// checkSitePath reports an error if the slash-separated path p, relative
+// to the site root, has a segment that could address a file other than
+// the one it names: an empty segment, "." or "..", or one containing a
+// separator or NUL, whether as written or after unescaping.
+func checkSitePath(p string) error {
+	for _, seg := range strings.Split(p, "/") {
+		if err := checkSegment(seg); err != nil {
+			return fmt.Errorf("path %q: %w", p, err)
+		}
+		if unescaped, err := url.PathUnescape(seg); err == nil && unescaped != seg {
+			if err := checkSegment(unescaped); err != nil {
+				return fmt.Errorf("path %q: unescaped %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkSegment(seg string) error {
+	switch {
+	case seg == "":
+		return fmt.Errorf("empty segment")
+	case seg == "." || seg == "..":
+		return fmt.Errorf("segment %q", seg)
+	case strings.ContainsAny(seg, "/\\\x00"):
+		return fmt.Errorf("segment %q contains a separator or NUL", seg)
+	}
+	return nil
+}
+
+// outputPath returns the file path for the slash-separated path p under
+// outDir, or an error if p is not a safe site path.
+func outputPath(outDir, p string) (string, error) {
+	if err := checkSitePath(p); err != nil {
+		return "", err
+	}
+	out := filepath.Join(outDir, filepath.FromSlash(p))
+	if !withinDir(outDir, out) {
+		return "", fmt.Errorf("path %q is outside the output directory", p)
+	}
+	return out, nil
+}
+
+// withinDir reports whether the file path p lies lexically within dir.
+func withinDir(dir, p string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(p))
+	if err != nil || filepath.IsAbs(rel) {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
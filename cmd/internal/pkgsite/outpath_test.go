@@ -0,0 +1,129 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCheckSitePath(t *testing.T) {
+	for _, p := range []string{
+		"example.com/m",
+		"example.com/m/..foo",
+		"example.com/m/foo..",
+		"example.com/m/.hidden",
+		"example.com/m/a%20b",
+		"static/frontend/frontend.css",
+	} {
+		if err := checkSitePath(p); err != nil {
+			t.Errorf("checkSitePath(%q): %v", p, err)
+		}
+	}
+	for _, p := range []string{
+		"",
+		"..",
+		"example.com/m/../../etc",
+		"example.com/m/./a",
+		"example.com//m",
+		"example.com/m/",
+		`example.com/m/..\..\etc`,
+		"example.com/m/a\x00b",
+		"example.com/m/%2e%2e",
+		"example.com/m/a%2fb",
+		"example.com/m/a%5cb",
+		"example.com/m/%00",
+	} {
+		if err := checkSitePath(p); err == nil {
+			t.Errorf("checkSitePath(%q): got nil error", p)
+		}
+	}
+}
+
+func TestURLPathToFilePathRejects(t *testing.T) {
+	for _, urlPath := range []string{
+		"/../etc/passwd",
+		"/example.com/m/../../../etc",
+		"/example.com/m/..",
+		"/example.com/%2e%2e/%2e%2e/etc",
+		"/example.com/m//x",
+	} {
+		if got, err := urlPathToFilePath(urlPath, "out", pagePathKind); err == nil {
+			t.Errorf("urlPathToFilePath(%q) = %q, want error", urlPath, got)
+		}
+	}
+}
+
+func TestWithinDir(t *testing.T) {
+	for _, tt := range []struct {
+		dir, p string
+		want   bool
+	}{
+		{"out", "out/index.html", true},
+		{"out", "out", true},
+		{"out", "out/..foo/index.html", true},
+		{"out", "out/../x", false},
+		{"out", "outside/x", false},
+		{"/srv/out", "/srv/out/a/b", true},
+		{"/srv/out", "/srv/other", false},
+		{"/srv/out", "rel", false},
+	} {
+		if got := withinDir(tt.dir, tt.p); got != tt.want {
+			t.Errorf("withinDir(%q, %q) = %t, want %t", tt.dir, tt.p, got, tt.want)
+		}
+	}
+}
+
+var urlPathSeeds = []string{"/", "/about", "/example.com/m", "/../x", "/a/%2e%2e/b", "/bücher.example/lib", "/a/..b/c.css"}
+
+func FuzzURLPathToFilePath(f *testing.F) {
+	for _, s := range urlPathSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(checkURLPathToFilePath)
+}
+
+func TestURLPathToFilePathMutations(t *testing.T) {
+	for _, s := range mutate(urlPathSeeds, fuzzIterations()) {
+		checkURLPathToFilePath(t, s)
+	}
+}
+
+// checkURLPathToFilePath checks that the file of urlPath is within the
+// output directory, and that its name is valid UTF-8 if urlPath is and
+// not much longer.
+func checkURLPathToFilePath(t *testing.T, urlPath string) {
+	outDir := filepath.Join("srv", "out")
+	got, err := urlPathToFilePath(urlPath, outDir, pagePathKind)
+	if err != nil {
+		return
+	}
+	if !withinDir(outDir, got) || filepath.Clean(got) == filepath.Clean(outDir) {
+		t.Errorf("urlPathToFilePath(%q) = %q, not a file within %q", urlPath, got, outDir)
+	}
+	if utf8.ValidString(urlPath) && !utf8.ValidString(got) {
+		t.Errorf("urlPathToFilePath(%q) = %q, not valid UTF-8", urlPath, got)
+	}
+	if len(got) > len(outDir)+maxGrowth*len(urlPath)+len("/index.html") {
+		t.Errorf("urlPathToFilePath(%q) = %q, which is too long", urlPath, got)
+	}
+}
+
+func FuzzOutputPath(f *testing.F) {
+	for _, s := range []string{"example.com/m/doc.md", "../doc.md", "a/%2e%2e/doc.md", "a\\..\\..\\b"} {
+		f.Add(s)
+	}
+	outDir := filepath.Join("srv", "out")
+	f.Fuzz(func(t *testing.T, p string) {
+		got, err := outputPath(outDir, p)
+		if err != nil {
+			return
+		}
+		if !withinDir(outDir, got) || filepath.Clean(got) == filepath.Clean(outDir) {
+			t.Errorf("outputPath(%q) = %q, not a file within %q", p, got, outDir)
+		}
+	})
+}
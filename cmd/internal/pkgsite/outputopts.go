@@ -0,0 +1,260 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// Every option of ServerConfig and GenerateOptions is classified by what
+// of the site it can change the bytes of, in serverConfigScopes and
+// generateOptionScopes, which a test keeps complete: a new option fails it
+// until it is added to one of them. The tables tell which options to look
+// at when a page changes unexpectedly, and which are safe to vary between
+// runs, such as Workers.
+//
+// The hashes of the options of each scope are recorded in optionsFile in
+// the output directory, and the report says what the changes since the
+// previous run invalidated: every page, only the aggregate files, or
+// nothing. A run still renders every page, and writes only the files whose
+// contents changed, so the hashes do not change what is written; they
+// tell a deployment whether a change of options alone calls for purging
+// the cached pages of the site, or only its aggregate files. The hashes
+// cover the values of the options, not the contents of the files they
+// name, such as TemplateOverrideDir or DiagramScript.
+const optionsFile = ".pkgsite-options.json"
+
+// An optionScope is what of a site an option can change the bytes of.
+type optionScope int
+
+const (
+	// scopeNone options change how a run goes, or what it writes outside
+	// the site, but not the files of the site.
+	scopeNone optionScope = iota
+	// scopeAggregate options change only the files derived from the site
+	// as a whole, such as the sitemap, or files of their own.
+	scopeAggregate
+	// scopePage options can change any page, and so the aggregate files.
+	scopePage
+)
+
+// Values of Report.Invalidated.
+const (
+	invalidatedPages      = "pages"
+	invalidatedAggregates = "aggregates"
+)
+
+// serverConfigScopes holds the scope of each exported field of
+// ServerConfig.
+var serverConfigScopes = map[string]optionScope{
+	// The modules documented.
+	"Paths":           scopePage,
+	"GOPATHMode":      scopePage,
+	"UseCache":        scopePage,
+	"CacheDir":        scopePage,
+	"UseListedMods":   scopePage,
+	"UseLocalStdlib":  scopePage,
+	"GoRepoPath":      scopePage,
+	"ModuleVersions":  scopePage,
+	"DiscoverModules": scopePage,
+	"Workspace":       scopePage,
+	"RemoteModules":   scopePage,
+	"ModuleZips":      scopePage,
+	"CachedModules":   scopePage,
+	"Stdlib":          scopePage,
+	"StdlibArchive":   scopePage,
+	"StdlibInternal":  scopePage,
+	"Proxy":           scopePage,
+
+	// How their documentation is loaded and rendered.
+	"DevMode":             scopePage, // serves the assets unminified
+	"DevModeStaticDir":    scopePage,
+	"GoDocMode":           scopePage,
+	"TemplateOverrideDir": scopePage,
+	"SiteName":            scopePage,
+	"SiteURL":             scopePage,
+	"ConstrainedPackages": scopePage,
+	"ReadmeOptions":       scopePage,
+	"ReadmeNames":         scopePage,
+	"Redactions":          scopePage,
+	"HiddenSymbols":       scopePage,
+	"SymbolIndex":         scopePage,
+	"SymbolIndexPageSize": scopePage,
+	"GlanceThreshold":     scopePage,
+
+	"RecordCodeWikiMetrics": scopeNone, // the dynamic server only
+}
+
+// generateOptionScopes holds the scope of each exported field of
+// GenerateOptions.
+var generateOptionScopes = map[string]optionScope{
+	// The units that get pages.
+	"IncludeGlobs": scopePage,
+	"ExcludeGlobs": scopePage,
+	"NoInternal":   scopePage,
+	"Smoke":        scopePage,
+	"Frozen":       scopePage,
+	"FrozenFrom":   scopePage,
+
+	// What becomes of their pages.
+	"BasePath":              scopePage,
+	"CRLF":                  scopePage,
+	"Minify":                scopePage,
+	"TimeBudget":            scopePage, // degrades the pages left when over it
+	"BuildTime":             scopePage, // for templates that show it
+	"EmitMarkdown":          scopePage,
+	"MarkdownAbsoluteLinks": scopePage,
+	"ModuleSettings":        scopePage,
+	"DiagramScript":         scopePage,
+	"PlatformTable":         scopePage,
+	"EmptyDocMinExported":   scopePage,
+	"EmptyDocNote":          scopePage,
+	"Branding":              scopePage,
+	"ColorScheme":           scopePage,
+	"StaticPages":           scopePage,
+	"SourcePages":           scopePage,
+	"MaxSourceSize":         scopePage,
+	"SourceChunkLines":      scopePage,
+	"SourceRef":             scopePage,
+	"HighlightTheme":        scopePage,
+	"HighlightCSS":          scopePage,
+	"Prefetch":              scopePage,
+	"DownloadBundles":       scopePage, // adds the link to the module pages
+	"Strict":                scopePage, // leaves out the pages of disputed modules
+	"ContentHash":           scopePage,
+	"NoClientSearch":        scopePage, // changes the search forms
+	"SearchFallback":        scopePage,
+	"InlineSmallImages":     scopePage,
+	"StrictCSP":             scopePage,
+	"SubresourceIntegrity":  scopePage,
+	"FingerprintAssets":     scopePage,
+	"ExternalDocsURL":       scopePage,
+	"StripExternalLinks":    scopePage,
+	"AbsoluteSelfLinks":     scopePage,
+
+	"Precompress":        scopeAggregate, // files of their own
+	"Archive":            scopeAggregate,
+	"ArchiveTag":         scopeAggregate,
+	"ArchiveKeep":        scopeAggregate,
+	"Sitemap":            scopeAggregate,
+	"PlatformDivergence": scopeAggregate, // the report only
+	"FailOnDivergence":   scopeAggregate,
+	"SkipNotFoundPage":   scopeAggregate, // 404.html, which no page links
+	"Schemas":            scopeAggregate,
+	"CopyAllAssets":      scopeAggregate, // the notices, and files of their own
+	"EmitText":           scopeAggregate, // files of their own
+
+	"OutDir":         scopeNone,
+	"Format":         scopeNone, // the same files, packed or not
+	"Force":          scopeNone, // the same bytes, with new modification times
+	"Prune":          scopeNone, // deletes only files that are not the site's
+	"Atomic":         scopeNone,
+	"Workers":        scopeNone,
+	"ReproBundle":    scopeNone, // written outside the site
+	"IncludeSources": scopeNone,
+	"ProgressFormat": scopeNone,
+	"ProgressOutput": scopeNone,
+	"Progress":       scopeNone,
+	"Logger":         scopeNone,
+}
+
+// An optionsRecord is the contents of optionsFile: the hex SHA-256 hashes
+// of the options of a run, by scope.
+type optionsRecord struct {
+	Page      string `json:"page"`
+	Aggregate string `json:"aggregate"`
+}
+
+// newOptionsRecord returns the record of a run with serverCfg and opts.
+func newOptionsRecord(serverCfg ServerConfig, opts GenerateOptions) (optionsRecord, error) {
+	var rec optionsRecord
+	for _, s := range []struct {
+		scope optionScope
+		hash  *string
+	}{
+		{scopePage, &rec.Page},
+		{scopeAggregate, &rec.Aggregate},
+	} {
+		h := sha256.New()
+		if err := hashOptions(h, "ServerConfig", serverCfg, serverConfigScopes, s.scope); err != nil {
+			return rec, err
+		}
+		if err := hashOptions(h, "GenerateOptions", opts, generateOptionScopes, s.scope); err != nil {
+			return rec, err
+		}
+		*s.hash = hex.EncodeToString(h.Sum(nil))
+	}
+	return rec, nil
+}
+
+// hashOptions writes to w the exported fields of the struct v, named
+// typ, whose scope in scopes is scope, as name=JSON lines in order of
+// name. Functions and the proxy are written only as set or not.
+func hashOptions(w io.Writer, typ string, v any, scopes map[string]optionScope, scope optionScope) error {
+	rv := reflect.ValueOf(v)
+	var names []string
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		sc, ok := scopes[f.Name]
+		if !ok {
+			return fmt.Errorf("%s.%s has no option scope", typ, f.Name)
+		}
+		if sc == scope {
+			names = append(names, f.Name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fv := rv.FieldByName(name)
+		var val any = fv.Interface()
+		if fv.Kind() == reflect.Func || name == "Proxy" {
+			val = !fv.IsNil()
+		}
+		data, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Errorf("hashing %s.%s: %w", typ, name, err)
+		}
+		fmt.Fprintf(w, "%s.%s=%s\n", typ, name, data)
+	}
+	return nil
+}
+
+// invalidated returns what of the site in outDir the options of rec
+// invalidate since the run that recorded its options there: "pages",
+// "aggregates" or "". Without a record, the pages are invalidated.
+func (rec optionsRecord) invalidated(outDir string) string {
+	data, err := os.ReadFile(filepath.Join(outDir, optionsFile))
+	if err != nil {
+		return invalidatedPages
+	}
+	var prev optionsRecord
+	if err := json.Unmarshal(data, &prev); err != nil || prev.Page != rec.Page {
+		return invalidatedPages
+	}
+	if prev.Aggregate != rec.Aggregate {
+		return invalidatedAggregates
+	}
+	return ""
+}
+
+// write records rec in outDir.
+func (rec optionsRecord) write(outDir string) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeSiteFile(filepath.Join(outDir, optionsFile), append(data, '\n'))
+}
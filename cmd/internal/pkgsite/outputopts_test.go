@@ -0,0 +1,129 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+// TestOptionScopes checks that every option has a scope, so that a new
+// option fails it until its effect on the output is decided.
+func TestOptionScopes(t *testing.T) {
+	for _, c := range []struct {
+		v      any
+		scopes map[string]optionScope
+	}{
+		{ServerConfig{}, serverConfigScopes},
+		{GenerateOptions{}, generateOptionScopes},
+	} {
+		typ := reflect.TypeOf(c.v)
+		fields := map[string]bool{}
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			fields[f.Name] = true
+			if _, ok := c.scopes[f.Name]; !ok {
+				t.Errorf("%s.%s has no scope: add it to the table of outputopts.go, as changing what a run writes or not", typ.Name(), f.Name)
+			}
+		}
+		for name := range c.scopes {
+			if !fields[name] {
+				t.Errorf("%s has no option %s, which has a scope", typ.Name(), name)
+			}
+		}
+	}
+}
+
+func TestOptionsRecord(t *testing.T) {
+	base, err := newOptionsRecord(ServerConfig{SiteName: "a"}, GenerateOptions{OutDir: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if got := base.invalidated(dir); got != invalidatedPages {
+		t.Errorf("without a record: got %q, want %q", got, invalidatedPages)
+	}
+	if err := base.write(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name      string
+		serverCfg ServerConfig
+		opts      GenerateOptions
+		want      string
+	}{
+		{"same", ServerConfig{SiteName: "a"}, GenerateOptions{OutDir: "x"}, ""},
+		{"no effect", ServerConfig{SiteName: "a"}, GenerateOptions{OutDir: "y", Workers: 8, Force: true}, ""},
+		{"aggregate", ServerConfig{SiteName: "a"}, GenerateOptions{OutDir: "x", Sitemap: true}, invalidatedAggregates},
+		{"page", ServerConfig{SiteName: "b"}, GenerateOptions{OutDir: "x"}, invalidatedPages},
+		{"page and aggregate", ServerConfig{SiteName: "b"}, GenerateOptions{OutDir: "x", Schemas: true}, invalidatedPages},
+		{"generate option", ServerConfig{SiteName: "a"}, GenerateOptions{OutDir: "x", CRLF: true}, invalidatedPages},
+		{"rule", ServerConfig{SiteName: "a", Redactions: []*RedactionRule{{Name: "r", Pattern: "x"}}}, GenerateOptions{OutDir: "x"}, invalidatedPages},
+	} {
+		rec, err := newOptionsRecord(test.serverCfg, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rec.invalidated(dir); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGenerateStaticSiteInvalidated(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`)
+	outDir := t.TempDir()
+	for _, run := range []struct {
+		name string
+		cfg  ServerConfig
+		opts GenerateOptions
+		want string
+	}{
+		{"first", ServerConfig{}, GenerateOptions{}, invalidatedPages},
+		{"workers", ServerConfig{}, GenerateOptions{Workers: 4}, ""},
+		{"sitemap", ServerConfig{SiteURL: "https://example.org/"}, GenerateOptions{Sitemap: true}, invalidatedPages},
+		{"schemas", ServerConfig{SiteURL: "https://example.org/"}, GenerateOptions{Sitemap: true, Schemas: true}, invalidatedAggregates},
+	} {
+		run.cfg.Paths = []string{modDir}
+		run.cfg.UseListedMods = true
+		run.opts.OutDir = outDir
+		report, err := GenerateStaticSiteWithOptions(context.Background(), run.cfg, run.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", run.name, err)
+		}
+		if report.Invalidated != run.want {
+			t.Errorf("%s: invalidated %q, want %q", run.name, report.Invalidated, run.want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, optionsFile)); err != nil {
+		t.Error(err)
+	}
+	// The record is not part of the site.
+	m, err := readManifest(filepath.Join(outDir, manifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m[optionsFile]; ok {
+		t.Errorf("manifest lists %s", optionsFile)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// Tools that work on a generated site, such as a docs portal or a link
+// checker, learn what it holds from pages.json, which lists every page of
+// the output with its kind, module and the hash of its file, rather than
+// by crawling it. The list is written at the end of a run, once the files
+// of the site are final, so that it holds only the pages that were
+// written and kept, and is also returned in Report.PageList.
+
+// pagesFile is the file of the output listing its pages.
+const pagesFile = "pages.json"
+
+// A pageLister is a pageConsumer that lists the pages of the site, to be
+// written to pagesFile.
+type pageLister struct {
+	static   map[string]bool   // URL paths of the informational pages
+	recorder *moduleRecorder   // for the modules of the pages
+	synopses map[string]string // synopses of the packages, by path
+	events   []*pageEvent
+}
+
+// newPageLister returns a lister of the pages of a site whose informational
+// pages have the URL paths static, and whose modules recorder records.
+func newPageLister(static []string, recorder *moduleRecorder) *pageLister {
+	l := &pageLister{
+		static:   map[string]bool{attributionsURLPath: true},
+		recorder: recorder,
+	}
+	for _, p := range static {
+		l.static[p] = true
+	}
+	return l
+}
+
+// setSynopses sets the synopses of the packages from the entries of the
+// search index.
+func (l *pageLister) setSynopses(entries []schema.SearchEntry) {
+	l.synopses = map[string]string{}
+	for _, e := range entries {
+		l.synopses[e.Path] = e.Synopsis
+	}
+}
+
+func (l *pageLister) consumePage(ev *pageEvent) error {
+	l.events = append(l.events, &pageEvent{
+		URLPath:  ev.URLPath,
+		File:     ev.File,
+		Redirect: ev.Redirect,
+		Tab:      ev.Tab,
+		Source:   ev.Source,
+	})
+	return nil
+}
+
+func (l *pageLister) finish(context.Context, *siteOutput) error { return nil }
+
+// list returns the pages of the site whose files are among written, and
+// the not-found page if it is, sorted by file.
+func (l *pageLister) list(written map[string]string) *schema.Pages {
+	pages := &schema.Pages{
+		SchemaVersion: schema.PagesArtifact.Version.String(),
+		Pages:         []schema.Page{},
+	}
+	for _, ev := range l.events {
+		hash, ok := written[ev.File]
+		if !ok {
+			continue
+		}
+		p := schema.Page{
+			URLPath:  ev.URLPath,
+			File:     ev.File,
+			Redirect: ev.Redirect,
+			Hash:     hash,
+		}
+		p.Module, _ = l.recorder.moduleOf(ev.File)
+		switch {
+		case ev.File == "index.html":
+			p.Kind = schema.PageHome
+		case l.static[ev.URLPath]:
+			p.Kind = schema.PageStatic
+		case ev.Redirect != "":
+			p.Kind = schema.PageRedirect
+		case ev.Source:
+			p.Kind = schema.PageSource
+		case ev.Tab != "":
+			p.Kind = schema.PageTab
+		default:
+			p.Kind = schema.PageUnit
+			p.Synopsis = l.synopses[path.Dir(ev.File)]
+		}
+		pages.Pages = append(pages.Pages, p)
+	}
+	notFound := notFoundURLPath[1:]
+	if hash, ok := written[notFound]; ok {
+		pages.Pages = append(pages.Pages, schema.Page{URLPath: notFoundURLPath, File: notFound, Kind: schema.PageNotFound, Hash: hash})
+	}
+	sort.Slice(pages.Pages, func(i, j int) bool { return pages.Pages[i].File < pages.Pages[j].File })
+	return pages
+}
+
+// writePageList writes pages to pagesFile in out.
+func writePageList(out *siteOutput, pages *schema.Pages) error {
+	data, err := json.Marshal(pages)
+	if err != nil {
+		return err
+	}
+	return out.writeFile(filepath.Join(out.dir, pagesFile), data)
+}
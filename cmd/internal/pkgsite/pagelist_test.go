@@ -0,0 +1,78 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+func TestGenerateStaticSitePageList(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	mods := writeStaticPagesModules(t)
+	outDir := t.TempDir()
+	// The fingerprints recorded on the pages change their files once they
+	// are written, which the hashes of the list must follow.
+	cfg := ServerConfig{Paths: mods, UseListedMods: true}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, SourcePages: true, ContentHash: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, pagesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := schema.DecodePages(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(report.PageList, pages); diff != "" {
+		t.Errorf("the list of the report and pages.json differ (-report +file):\n%s", diff)
+	}
+
+	byFile := map[string]schema.Page{}
+	for _, p := range pages.Pages {
+		byFile[p.File] = p
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p.File)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); p.Hash != got {
+			t.Errorf("%s: hash %s, want that of the file, %s", p.File, p.Hash, got)
+		}
+	}
+	for _, want := range []schema.Page{
+		{URLPath: "/", File: "index.html", Kind: schema.PageHome},
+		{URLPath: "/about", File: "about/index.html", Kind: schema.PageStatic},
+		{URLPath: "/attributions", File: "attributions/index.html", Kind: schema.PageStatic},
+		{URLPath: "/404.html", File: "404.html", Kind: schema.PageNotFound},
+		{URLPath: "/example.com/a", File: "example.com/a/index.html", Kind: schema.PageUnit, Module: "example.com/a", Synopsis: "Package a is licensed."},
+		{URLPath: "/example.com/a/imports", File: "example.com/a/imports/index.html", Kind: schema.PageTab, Module: "example.com/a"},
+		{URLPath: "/example.com/a/file/a.go", File: "example.com/a/file/a.go/index.html", Kind: schema.PageSource, Module: "example.com/a"},
+	} {
+		got, ok := byFile[want.File]
+		if !ok {
+			t.Errorf("%s is not listed", want.File)
+			continue
+		}
+		want.Hash = got.Hash
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s mismatch (-want +got):\n%s", want.File, diff)
+		}
+	}
+	if _, ok := byFile[pagesFile]; ok {
+		t.Errorf("%s lists itself", pagesFile)
+	}
+}
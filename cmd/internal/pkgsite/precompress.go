@@ -0,0 +1,173 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Static file servers such as nginx, with gzip_static and brotli_static,
+// and some CDNs serve a file compressed if it has a sibling with the
+// compressed contents, file.gz or file.br. With GenerateOptions.Precompress,
+// every text file of the site that is worth compressing gets both, once
+// all the files are written, including the pages that get their content
+// hashes. fingerprints.json, which mirrors fetch rather than browsers, does
+// not.
+//
+// The siblings are written through the siteOutput, so that they are
+// recorded, listed in the manifest and change lists, and archived like the
+// other files, and removeStale and prune keep those of the files written
+// by the run. A file that the previous run left as it is keeps its
+// siblings without compressing it again. The siblings are left out of the
+// fingerprints, as they change only with their files.
+
+// precompressExtensions are the extensions of the files that get
+// compressed siblings. Images other than SVG, fonts and archives are
+// compressed already.
+var precompressExtensions = map[string]bool{
+	".css":         true,
+	".htm":         true,
+	".html":        true,
+	".js":          true,
+	".json":        true,
+	".map":         true,
+	".md":          true,
+	".mjs":         true,
+	".svg":         true,
+	".txt":         true,
+	".webmanifest": true,
+	".xml":         true,
+}
+
+// compressedExtensions are the extensions of the compressed siblings.
+var compressedExtensions = []string{".gz", ".br"}
+
+// brotliLevel is the quality of the brotli siblings. The best, 11, is
+// several times slower for a few percent less.
+const brotliLevel = 9
+
+// shouldPrecompress reports whether the file at the slash-separated path
+// p gets compressed siblings.
+func shouldPrecompress(p string) bool {
+	return p != fingerprintsFile && precompressExtensions[strings.ToLower(path.Ext(p))]
+}
+
+// isCompressedSibling reports whether the file at the slash-separated
+// path p is the compressed sibling of a file written by this run, which
+// compress writes. It is false unless the output is precompressed.
+func (o *siteOutput) isCompressedSibling(p string) bool {
+	if !o.precompress {
+		return false
+	}
+	for _, ext := range compressedExtensions {
+		if base, ok := strings.CutSuffix(p, ext); ok && shouldPrecompress(base) {
+			_, written := o.written[base]
+			return written
+		}
+	}
+	return false
+}
+
+// compress writes the gzip and brotli siblings of the files written by
+// this run that are worth compressing, on up to workers goroutines at once.
+func (o *siteOutput) compress(ctx context.Context, workers int) error {
+	var paths []string
+	for p := range o.written {
+		if shouldPrecompress(p) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	forEach(ctx, len(paths), workers, func(i int) {
+		if err := o.compressFile(paths[i]); err != nil {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+		}
+	})
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// compressFile writes the compressed siblings of the written file at the
+// slash-separated path p, unless the file and its siblings are as the
+// previous run left them.
+func (o *siteOutput) compressFile(p string) error {
+	if o.keepSiblings(p) {
+		return nil
+	}
+	file := filepath.Join(o.dir, filepath.FromSlash(p))
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var gz bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := o.writeFile(file+".gz", gz.Bytes()); err != nil {
+		return err
+	}
+	var br bytes.Buffer
+	bw := brotli.NewWriterLevel(&br, brotliLevel)
+	if _, err := bw.Write(data); err != nil {
+		return err
+	}
+	if err := bw.Close(); err != nil {
+		return err
+	}
+	return o.writeFile(file+".br", br.Bytes())
+}
+
+// keepSiblings reports whether the file at the slash-separated path p has
+// the contents the previous run recorded, and the siblings the previous
+// run wrote for them are still there, in which case it records them as
+// written by this run.
+func (o *siteOutput) keepSiblings(p string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.force || o.prev[p] == "" || o.prev[p] != o.written[p] {
+		return false
+	}
+	for _, ext := range compressedExtensions {
+		if _, ok := o.prev[p+ext]; !ok {
+			return false
+		}
+		fi, err := os.Stat(filepath.Join(o.dir, filepath.FromSlash(p+ext)))
+		if err != nil || !fi.Mode().IsRegular() {
+			return false
+		}
+	}
+	for _, ext := range compressedExtensions {
+		o.written[p+ext] = o.prev[p+ext]
+		o.skipped++
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+func TestShouldPrecompress(t *testing.T) {
+	for p, want := range map[string]bool{
+		"index.html":                       true,
+		"example.com/m/index.html":         true,
+		"static/frontend/frontend.min.css": true,
+		"static/frontend/frontend.js":      true,
+		"search-index.json":                true,
+		"static/shared/icon/x.svg":         true,
+		"sitemap.xml":                      true,
+		"INDEX.HTML":                       true,
+		"favicon.ico":                      false,
+		"static/shared/logo.png":           false,
+		"third_party/font.woff2":           false,
+		"downloads/example.com/m.zip":      false,
+		"index.html.gz":                    false,
+		fingerprintsFile:                   false,
+	} {
+		if got := shouldPrecompress(p); got != want {
+			t.Errorf("shouldPrecompress(%q) = %t, want %t", p, got, want)
+		}
+	}
+}
+
+func TestGenerateStaticSitePrecompress(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	generate := func(precompress bool) {
+		t.Helper()
+		opts := GenerateOptions{OutDir: outDir, Prune: true, Workers: 4, Precompress: precompress, ContentHash: true}
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(p string) bool {
+		t.Helper()
+		_, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+
+	generate(true)
+	// The siblings decompress to the files as written, after their content
+	// hashes were recorded on them.
+	for _, p := range []string{"index.html", "example.com/m/index.html", "static/frontend/frontend.min.css"} {
+		want, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ext, newReader := range map[string]func(io.Reader) (io.Reader, error){
+			".gz": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+			".br": func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		} {
+			f, err := os.Open(filepath.Join(outDir, filepath.FromSlash(p+ext)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := newReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			f.Close()
+			if err != nil {
+				t.Fatalf("%s%s: %v", p, ext, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s%s does not decompress to %s", p, ext, p)
+			}
+		}
+	}
+	for _, p := range []string{"favicon.ico.gz", "favicon.ico.br", fingerprintsFile + ".gz"} {
+		if exists(p) {
+			t.Errorf("%s is written", p)
+		}
+	}
+	written, err := readManifest(filepath.Join(outDir, writtenFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := written["index.html.br"]; !ok {
+		t.Error("index.html.br is not recorded")
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, fingerprintsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fps, err := schema.DecodeFingerprints(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := range fps.Paths {
+		if strings.HasSuffix(p, ".gz") || strings.HasSuffix(p, ".br") {
+			t.Errorf("compressed sibling %s has a fingerprint", p)
+		}
+	}
+
+	// A second run keeps the siblings of the unchanged files, even with
+	// Prune, without writing them again.
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	gz := filepath.Join(outDir, "static", "frontend", "frontend.min.css.gz")
+	if err := os.Chtimes(gz, old, old); err != nil {
+		t.Fatal(err)
+	}
+	generate(true)
+	fi, err := os.Stat(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(old) {
+		t.Error("second run rewrote the sibling of an unchanged file")
+	}
+
+	// A run that does not compress removes the siblings.
+	generate(false)
+	for _, p := range []string{"index.html.gz", "example.com/m/index.html.br"} {
+		if exists(p) {
+			t.Errorf("%s is left behind", p)
+		}
+	}
+}
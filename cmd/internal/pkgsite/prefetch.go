@@ -0,0 +1,165 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Unit pages can ask the browser to prefetch the pages a reader is likely
+// to visit next: their child units, then their parent. The hints are added
+// once every page is written, so that pages too large to be worth
+// prefetching can be left out.
+//
+// The links are kept in a <template> and copied into <head> by a script,
+// unless the browser asks to save data. The CSP allows both: the
+// prefetches are same-origin, and the script is inline, or, with
+// StrictCSP, a file of the site.
+
+const (
+	// prefetchFragment names the head fragment of the hints.
+	prefetchFragment = "prefetch"
+	// prefetchMaxPageSize is the size of the largest page prefetched.
+	prefetchMaxPageSize = 256 << 10
+)
+
+// prefetchScript adds the links of the template before it to <head>,
+// unless the Save-Data preference is set or the connection is slow.
+const prefetchScript = `(function() {
+  const c = navigator.connection;
+  if (c && (c.saveData || /2g/.test(c.effectiveType))) return;
+  const t = document.currentScript.previousElementSibling;
+  document.head.appendChild(t.content.cloneNode(true));
+})();`
+
+// A prefetcher is a pageConsumer that adds prefetch hints to unit pages.
+type prefetcher struct {
+	max      int                 // most hints per page
+	children map[string][]string // unit URL path to child unit URL paths
+	parent   map[string]string   // unit URL path to parent unit URL path
+	pages    map[string]*pageEvent
+}
+
+// newPrefetcher returns a prefetcher adding at most max hints to the pages
+// of units, which must be sorted by path.
+func newPrefetcher(max int, units []*siteUnit) *prefetcher {
+	p := &prefetcher{
+		max:      max,
+		children: map[string][]string{},
+		parent:   map[string]string{},
+		pages:    map[string]*pageEvent{},
+	}
+	paths := map[string]bool{}
+	for _, u := range units {
+		paths[u.path] = true
+	}
+	for _, u := range units {
+		for dir := u.path; strings.Contains(dir, "/"); {
+			dir = dir[:strings.LastIndex(dir, "/")]
+			if paths[dir] {
+				p.parent["/"+u.path] = "/" + dir
+				p.children["/"+dir] = append(p.children["/"+dir], "/"+u.path)
+				break
+			}
+		}
+	}
+	return p
+}
+
+func (p *prefetcher) consumePage(ev *pageEvent) error {
+	if ev.HTML && ev.Redirect == "" {
+		p.pages[ev.URLPath] = ev
+	}
+	return nil
+}
+
+func (p *prefetcher) finish(_ context.Context, out *siteOutput) error {
+	urlPaths := make([]string, 0, len(p.pages))
+	for urlPath := range p.pages {
+		urlPaths = append(urlPaths, urlPath)
+	}
+	sort.Strings(urlPaths)
+	for _, urlPath := range urlPaths {
+		targets := p.targets(urlPath)
+		if len(targets) == 0 || p.pages[urlPath].Frozen {
+			continue
+		}
+		if err := addPrefetchHints(out, filepath.Join(out.dir, filepath.FromSlash(p.pages[urlPath].File)), urlPath, targets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targets returns the URL paths of the pages to prefetch from the page at
+// urlPath: its children, then its parent, leaving out pages that were not
+// written or are too large.
+func (p *prefetcher) targets(urlPath string) []string {
+	var targets []string
+	candidates := p.children[urlPath]
+	if parent, ok := p.parent[urlPath]; ok {
+		candidates = append(candidates[:len(candidates):len(candidates)], parent)
+	}
+	for _, t := range candidates {
+		if len(targets) == p.max {
+			break
+		}
+		if ev, ok := p.pages[t]; ok && ev.Size <= prefetchMaxPageSize {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// addPrefetchHints adds hints for targets to the page at urlPath written
+// to file in out.
+func addPrefetchHints(out *siteOutput, file, urlPath string, targets []string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	head := findElement(doc, "head")
+	if head == nil {
+		return nil
+	}
+	prefix := relativePrefix(urlPath)
+	tmpl := &html.Node{Type: html.ElementNode, Data: "template", DataAtom: atom.Template}
+	for _, t := range targets {
+		tmpl.AppendChild(&html.Node{
+			Type:     html.ElementNode,
+			Data:     "link",
+			DataAtom: atom.Link,
+			Attr: []html.Attribute{
+				{Key: "rel", Val: "prefetch"},
+				{Key: "href", Val: prefix + canonicalURLPath(t)[1:]},
+			},
+		})
+	}
+	script := &html.Node{Type: html.ElementNode, Data: "script", DataAtom: atom.Script}
+	if out.external != nil {
+		script.Attr = []html.Attribute{{Key: "src", Val: prefix + out.external.add([]byte(prefetchScript), ".js", nil)}}
+	} else {
+		script.AppendChild(&html.Node{Type: html.TextNode, Data: prefetchScript})
+	}
+	appendFragment(head, prefetchFragment, tmpl, script)
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return err
+	}
+	return out.writeFile(file, buf.Bytes())
+}
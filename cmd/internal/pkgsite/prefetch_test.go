@@ -0,0 +1,97 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestPrefetchTargets(t *testing.T) {
+	var units []*siteUnit
+	for _, p := range []string{"example.com/m", "example.com/m/a", "example.com/m/b", "example.com/m/b/deep/c", "example.com/m/d"} {
+		units = append(units, &siteUnit{path: p})
+	}
+	p := newPrefetcher(2, units)
+	for _, u := range units {
+		size := 1000
+		if u.path == "example.com/m/d" {
+			size = prefetchMaxPageSize + 1
+		}
+		p.consumePage(&pageEvent{URLPath: "/" + u.path, HTML: true, Size: size})
+	}
+	for _, test := range []struct {
+		urlPath string
+		want    []string
+	}{
+		// Children first, up to the limit; d is too large.
+		{"/example.com/m", []string{"/example.com/m/a", "/example.com/m/b"}},
+		// The nearest unit above is the parent.
+		{"/example.com/m/b", []string{"/example.com/m/b/deep/c", "/example.com/m"}},
+		{"/example.com/m/b/deep/c", []string{"/example.com/m/b"}},
+		{"/about", nil},
+	} {
+		if diff := cmp.Diff(test.want, p.targets(test.urlPath)); diff != "" {
+			t.Errorf("targets(%q) mismatch (-want +got):\n%s", test.urlPath, diff)
+		}
+	}
+}
+
+func TestGenerateStaticSitePrefetch(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- a/a.go --
+// Package a does other things.
+package a
+-- b/b.go --
+// Package b does more things.
+package b
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Prefetch: 1}); err != nil {
+		t.Fatal(err)
+	}
+	linkRE := regexp.MustCompile(`<link rel="prefetch" href="([^"]*)"/>`)
+	for _, test := range []struct {
+		page string
+		want []string
+	}{
+		{"example.com/m/index.html", []string{"../../example.com/m/a"}},
+		{"example.com/m/b/index.html", []string{"../../../example.com/m"}},
+		{"about/index.html", nil},
+	} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(test.page)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := string(data)
+		var got []string
+		for _, m := range linkRE.FindAllStringSubmatch(page, -1) {
+			got = append(got, m[1])
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%s: prefetch links mismatch (-want +got):\n%s", test.page, diff)
+		}
+		if test.want != nil && !strings.Contains(page, "<template><link") {
+			t.Errorf("%s: links are not in a template", test.page)
+		}
+	}
+}
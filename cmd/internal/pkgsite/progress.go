@@ -0,0 +1,273 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// etaWindow is the number of recent item durations the estimate is based
+// on, and etaMinSamples the number needed before there is an estimate.
+const (
+	etaWindow     = 50
+	etaMinSamples = 3
+)
+
+// etaEstimator estimates the time left in a phase of the generation from
+// the median duration of its most recent items. Unlike the mean, the
+// median does not jump when a few slow pages come along.
+type etaEstimator struct {
+	workers int             // number of items processed at once
+	recent  []time.Duration // ring buffer of the last etaWindow durations
+	next    int             // index in recent of the next sample
+}
+
+func newETAEstimator(workers int) *etaEstimator {
+	if workers < 1 {
+		workers = 1
+	}
+	return &etaEstimator{workers: workers}
+}
+
+// reset discards the samples, at the start of a phase whose items take a
+// different time than the previous phase's.
+func (e *etaEstimator) reset() {
+	e.recent = e.recent[:0]
+	e.next = 0
+}
+
+// add records the duration of one item.
+func (e *etaEstimator) add(d time.Duration) {
+	if len(e.recent) < etaWindow {
+		e.recent = append(e.recent, d)
+		return
+	}
+	e.recent[e.next] = d
+	e.next = (e.next + 1) % etaWindow
+}
+
+// estimate returns the time needed for the remaining items, and false if
+// there are too few samples for an estimate.
+func (e *etaEstimator) estimate(remaining int) (time.Duration, bool) {
+	if len(e.recent) < etaMinSamples {
+		return 0, false
+	}
+	sorted := append([]time.Duration(nil), e.recent...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+	rounds := (remaining + e.workers - 1) / e.workers
+	return time.Duration(rounds) * median, true
+}
+
+// The progress of a run is reported to a progressReporter as events, from
+// the start of the rendering of the pages to the end of the run. The text
+// format, the default, writes a line for each page started, with the
+// number of pages started and an estimate of the time left; the JSON
+// format writes each event as a line of JSON, for the dashboards of CI
+// systems. See schema.ProgressEvent.
+
+// The progress formats of GenerateOptions.ProgressFormat.
+const (
+	progressText = "text"
+	progressJSON = "json"
+)
+
+// A progressReporter writes the progress events of a run.
+type progressReporter interface {
+	report(ev *schema.ProgressEvent)
+}
+
+// newProgressReporter returns the reporter writing the progress events of
+// a run to w in format, which is progressText if empty.
+func newProgressReporter(format string, w io.Writer) (progressReporter, error) {
+	switch format {
+	case "", progressText:
+		return textProgress{w}, nil
+	case progressJSON:
+		return jsonProgress{json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown progress format %q: want %s or %s", format, progressText, progressJSON)
+}
+
+// A textProgress writes the progress of a run for humans.
+type textProgress struct {
+	w io.Writer
+}
+
+func (p textProgress) report(ev *schema.ProgressEvent) {
+	switch ev.Event {
+	case schema.ProgressStart:
+		fmt.Fprintf(p.w, "Generating %d pages...\n", ev.Total)
+	case schema.ProgressPageStarted:
+		line := fmt.Sprintf("  [%d/%d] %s", ev.Index, ev.Total, ev.URLPath)
+		if ev.ETA > 0 {
+			line += fmt.Sprintf(" (about %s left)", formatETA(seconds(ev.ETA)))
+		}
+		fmt.Fprintln(p.w, line)
+	}
+	// Failed pages are logged as they fail, and listed in the report.
+}
+
+// A jsonProgress writes each progress event as a line of JSON.
+type jsonProgress struct {
+	enc *json.Encoder
+}
+
+func (p jsonProgress) report(ev *schema.ProgressEvent) {
+	p.enc.Encode(ev)
+}
+
+// A callbackProgress passes each progress event to a function, as
+// GenerateOptions.Progress.
+type callbackProgress func(ProgressEvent)
+
+func (f callbackProgress) report(ev *schema.ProgressEvent) {
+	f(*ev)
+}
+
+// A progressTracker follows the pages of a run, reporting their events to
+// a progressReporter with the number of pages started and an estimate of
+// the time left. Its methods may be called by several workers at once.
+type progressTracker struct {
+	r        progressReporter
+	now      func() time.Time
+	mu       sync.Mutex
+	runStart time.Time
+	eta      *etaEstimator
+	total    int                    // pages of the run
+	current  int                    // pages started
+	started  time.Time              // when the last page started
+	pages    map[string]startedPage // pages started and not done, by URL path
+}
+
+// A startedPage is a page that started rendering.
+type startedPage struct {
+	index int
+	at    time.Time
+}
+
+// newProgressTracker returns a tracker of the pages of a run started at
+// runStart, which renders pages with workers, reporting to r.
+func newProgressTracker(r progressReporter, workers int, runStart time.Time) *progressTracker {
+	return &progressTracker{r: r, now: time.Now, runStart: runStart, eta: newETAEstimator(workers), pages: map[string]startedPage{}}
+}
+
+// emit reports ev, with the time since the start of the run. p.mu must be
+// held.
+func (p *progressTracker) emit(ev *schema.ProgressEvent) {
+	ev.SchemaVersion = schema.ProgressArtifact.Version.String()
+	ev.Elapsed = p.now().Sub(p.runStart).Seconds()
+	p.r.report(ev)
+}
+
+// startPhase starts the rendering of total pages. Time spent before, such
+// as enumerating packages, does not count toward any page.
+func (p *progressTracker) startPhase(total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+	p.current = 0
+	p.eta.reset()
+	p.emit(&schema.ProgressEvent{Event: schema.ProgressStart, Total: total})
+}
+
+// next reports that the page at urlPath starts. The time since the
+// previous page started is its duration for the estimate.
+func (p *progressTracker) next(urlPath string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if p.current > 0 {
+		p.eta.add(now.Sub(p.started))
+	}
+	p.started = now
+	p.current++
+	p.pages[urlPath] = startedPage{index: p.current, at: now}
+	ev := &schema.ProgressEvent{Event: schema.ProgressPageStarted, URLPath: urlPath, Index: p.current, Total: p.total}
+	if left, ok := p.eta.estimate(p.total - p.current + 1); ok {
+		ev.ETA = left.Seconds()
+	}
+	p.emit(ev)
+}
+
+// pageDone reports that the page at urlPath was written, in files of size
+// bytes, or failed with err.
+func (p *progressTracker) pageDone(urlPath string, size int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sp := p.pages[urlPath]
+	delete(p.pages, urlPath)
+	ev := &schema.ProgressEvent{Event: schema.ProgressPageRendered, URLPath: urlPath, Index: sp.index, Total: p.total, Bytes: int64(size)}
+	if !sp.at.IsZero() {
+		ev.Duration = p.now().Sub(sp.at).Seconds()
+	}
+	if err != nil {
+		ev.Event, ev.Bytes, ev.Error = schema.ProgressPageFailed, 0, err.Error()
+	}
+	p.emit(ev)
+}
+
+// assetsCopied reports that the assets of the site were written, in files
+// files of size bytes.
+func (p *progressTracker) assetsCopied(files int, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit(&schema.ProgressEvent{Event: schema.ProgressAssetsCopied, Files: files, Bytes: size})
+}
+
+// done reports the end of a run with report.
+func (p *progressTracker) done(report *Report) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit(&schema.ProgressEvent{Event: schema.ProgressDone, Pages: report.Pages, FailedPages: len(report.FailedPages)})
+}
+
+// estimate returns the time needed for the given number of pages, and
+// false if there is no estimate yet.
+func (p *progressTracker) estimate(pages int) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.eta.estimate(pages)
+}
+
+// seconds returns the duration of s seconds.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// A pageSizer is a pageConsumer adding up the sizes of the files of pages.
+type pageSizer struct {
+	size int
+}
+
+func (s *pageSizer) consumePage(ev *pageEvent) error {
+	s.size += ev.Size
+	return nil
+}
+
+func (s *pageSizer) finish(context.Context, *siteOutput) error { return nil }
+
+// formatETA rounds d to a precision suited to its size.
+func formatETA(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return d.Round(time.Second).String()
+	case d < time.Hour:
+		return d.Round(10 * time.Second).String()
+	default:
+		return d.Round(time.Minute).String()
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+func TestETAEstimator(t *testing.T) {
+	ms := time.Millisecond
+	for _, tt := range []struct {
+		name      string
+		workers   int
+		durations []time.Duration
+		remaining int
+		want      time.Duration
+		wantOK    bool
+	}{
+		{
+			name:      "too few samples",
+			durations: []time.Duration{10 * ms, 10 * ms},
+			remaining: 100,
+		},
+		{
+			name:      "steady",
+			durations: []time.Duration{10 * ms, 10 * ms, 10 * ms, 10 * ms},
+			remaining: 100,
+			want:      time.Second,
+			wantOK:    true,
+		},
+		{
+			name:      "a few slow pages do not move the estimate",
+			durations: []time.Duration{10 * ms, 10 * ms, 5 * time.Second, 10 * ms, 8 * time.Second, 10 * ms, 10 * ms},
+			remaining: 100,
+			want:      time.Second,
+			wantOK:    true,
+		},
+		{
+			name:      "even number of samples",
+			durations: []time.Duration{10 * ms, 20 * ms, 30 * ms, 40 * ms},
+			remaining: 10,
+			want:      250 * ms,
+			wantOK:    true,
+		},
+		{
+			name:      "workers",
+			workers:   4,
+			durations: []time.Duration{10 * ms, 10 * ms, 10 * ms},
+			remaining: 10, // three rounds of four
+			want:      30 * ms,
+			wantOK:    true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newETAEstimator(tt.workers)
+			for _, d := range tt.durations {
+				e.add(d)
+			}
+			got, ok := e.estimate(tt.remaining)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got (%v, %t), want (%v, %t)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestETAEstimatorWindow(t *testing.T) {
+	// The estimate follows a lasting change of pace once the window is
+	// filled with the new durations.
+	e := newETAEstimator(1)
+	for i := 0; i < etaWindow; i++ {
+		e.add(time.Millisecond)
+	}
+	for i := 0; i < etaWindow/2+1; i++ {
+		e.add(time.Second)
+	}
+	if got, _ := e.estimate(10); got != 10*time.Second {
+		t.Errorf("got %v, want 10s", got)
+	}
+
+	// A new phase starts without an estimate.
+	e.reset()
+	if _, ok := e.estimate(10); ok {
+		t.Error("got an estimate after reset")
+	}
+}
+
+func TestProgressReporter(t *testing.T) {
+	var b strings.Builder
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newProgressTracker(textProgress{&b}, 1, now)
+	p.now = func() time.Time { return now }
+
+	// Time before the phase, such as enumeration, is not counted.
+	now = now.Add(time.Hour)
+	p.startPhase(6)
+	for _, d := range []time.Duration{2, 2, 2, 30, 2, 2} {
+		p.next("/p")
+		now = now.Add(d * time.Second)
+	}
+	want := `Generating 6 pages...
+  [1/6] /p
+  [2/6] /p
+  [3/6] /p
+  [4/6] /p (about 6s left)
+  [5/6] /p (about 4s left)
+  [6/6] /p (about 2s left)
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestJSONProgress(t *testing.T) {
+	var b strings.Builder
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newProgressTracker(jsonProgress{json.NewEncoder(&b)}, 1, now)
+	p.now = func() time.Time { return now }
+	now = now.Add(time.Second)
+	p.startPhase(2)
+	p.next("/a")
+	p.next("/b")
+	now = now.Add(500 * time.Millisecond)
+	p.pageDone("/b", 10, nil)
+	p.pageDone("/a", 0, errors.New("boom"))
+	want := `{"schemaVersion":"1.0","event":"start","elapsed":1,"total":2}
+{"schemaVersion":"1.0","event":"page-started","elapsed":1,"urlPath":"/a","index":1,"total":2}
+{"schemaVersion":"1.0","event":"page-started","elapsed":1,"urlPath":"/b","index":2,"total":2}
+{"schemaVersion":"1.0","event":"page-rendered","elapsed":1.5,"urlPath":"/b","index":2,"total":2,"duration":0.5,"bytes":10}
+{"schemaVersion":"1.0","event":"page-failed","elapsed":1.5,"urlPath":"/a","index":1,"total":2,"duration":0.5,"error":"boom"}
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGenerateStaticSiteJSONProgress(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	var b bytes.Buffer
+	cfg := ServerConfig{Paths: writeStaticPagesModules(t), UseListedMods: true}
+	opts := GenerateOptions{OutDir: t.TempDir(), ProgressFormat: progressJSON, ProgressOutput: &b, Workers: 2}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []*schema.ProgressEvent
+	counts := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		ev, err := schema.DecodeProgressEvent([]byte(line))
+		if err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		events = append(events, ev)
+		counts[ev.Event]++
+	}
+	if first := events[0]; first.Event != schema.ProgressStart || first.Total == 0 {
+		t.Fatalf("first event %+v, want a start event with the number of pages", first)
+	}
+	if last := events[len(events)-1]; last.Event != schema.ProgressDone || last.Pages != report.Pages || last.FailedPages != 0 {
+		t.Errorf("last event %+v, want a done event with %d pages", last, report.Pages)
+	}
+	total := events[0].Total
+	want := map[string]int{
+		schema.ProgressStart:        1,
+		schema.ProgressPageStarted:  total,
+		schema.ProgressPageRendered: total,
+		schema.ProgressAssetsCopied: 1,
+		schema.ProgressDone:         1,
+	}
+	if diff := cmp.Diff(want, counts); diff != "" {
+		t.Errorf("event counts mismatch (-want +got):\n%s", diff)
+	}
+	rendered := map[int]bool{}
+	for _, ev := range events {
+		switch ev.Event {
+		case schema.ProgressPageRendered:
+			if ev.Index < 1 || ev.Index > total || rendered[ev.Index] || ev.Bytes == 0 || ev.URLPath == "" {
+				t.Errorf("bad page-rendered event %+v", ev)
+			}
+			rendered[ev.Index] = true
+		case schema.ProgressAssetsCopied:
+			if ev.Files == 0 || ev.Bytes == 0 {
+				t.Errorf("assets-copied event %+v, want files and bytes", ev)
+			}
+		}
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	for _, tt := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{1500 * time.Millisecond, "2s"},
+		{2*time.Minute + 14*time.Second, "2m10s"},
+		{time.Hour + 20*time.Minute + 40*time.Second, "1h21m0s"},
+	} {
+		if got := formatETA(tt.d); got != tt.want {
+			t.Errorf("formatETA(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A generated site is published to GitHub Pages by committing it to the
+// branch the repository serves, gh-pages by default. The commit is made
+// with git plumbing in a temporary repository, which fetches only the tip
+// of the branch: the files of the output directory are added to an index
+// of their own, the files of the branch that the host needs but the
+// output does not manage are kept, and the tree is committed on top of the
+// tip, so that the history of the branch is kept and the push is a fast
+// forward. Neither the output directory nor a checkout of the repository
+// is touched. The git command does the fetching and pushing, with the
+// credentials it is configured with, unless PublishOptions gives others.
+
+// defaultPublishBranch is the branch GitHub Pages serves by default.
+const defaultPublishBranch = "gh-pages"
+
+// protectedFiles are the files of the branch that are kept when the output
+// does not have them: CNAME holds the custom domain of the site, and
+// .nojekyll turns off Jekyll, which would leave out the files and
+// directories starting with "_" or ".".
+var protectedFiles = []string{"CNAME", ".nojekyll"}
+
+// internalFiles is the pathspec of the files that the generator keeps in
+// the output directory for its next runs, such as modulesFile, which are
+// not part of the site and are not published.
+const internalFiles = ":(exclude,glob).pkgsite-*"
+
+// defaultPublishAuthor is the author of the commit when neither
+// PublishOptions.Author nor the git configuration give one.
+const defaultPublishAuthor = "pkgsite <pkgsite@localhost>"
+
+// PublishOptions configures PublishGitHubPages.
+type PublishOptions struct {
+	// OutDir is the output directory of the generated site.
+	OutDir string
+	// Remote is the URL or path of the repository to publish to, or the
+	// name of a remote of the git repository of the current directory,
+	// such as origin.
+	Remote string
+	// Branch is the branch to commit the site to, gh-pages by default. It
+	// is created if the repository does not have it.
+	Branch string
+	// Message is the first paragraph of the commit message, by default
+	// "Publish the documentation site".
+	Message string
+	// Report is the report of the run that generated the site, whose
+	// summary is added to the commit message. A partial site is not
+	// published, nor is the output of a smoke test, whatever the report.
+	Report *Report
+	// Keep lists more files of the branch, such as "googleXXXX.html", to
+	// keep when the output does not have them, besides CNAME and .nojekyll.
+	Keep []string
+	// Author is the author of the commit, as "Name <email>", by default
+	// the user of the git configuration.
+	Author string
+	// Token is a token sent in the HTTP requests to an https remote, such
+	// as the GITHUB_TOKEN of a workflow, instead of the credentials git is
+	// configured with.
+	Token string
+	// SSHCommand is the ssh command run for an ssh remote, such as
+	// "ssh -i deploy_key", instead of that git is configured with.
+	SSHCommand string
+	// DryRun makes the commit without pushing it, to learn how the branch
+	// would change.
+	DryRun bool
+}
+
+// A PublishResult describes the outcome of PublishGitHubPages.
+type PublishResult struct {
+	// Branch is the branch the site was committed to.
+	Branch string
+	// Commit is the hash of the commit, which was pushed unless DryRun was
+	// set. It is empty if the branch already held the site.
+	Commit string
+	// Parent is the hash of the tip of the branch the commit is on top
+	// of, or empty if the branch was created.
+	Parent string
+	// Unchanged reports whether the branch already held the site.
+	Unchanged bool
+	// Stat is the diff stat of the commit, as printed by git diff --stat.
+	Stat string
+}
+
+// PublishGitHubPages commits the site generated in opts.OutDir to the
+// branch of opts.Remote that GitHub Pages serves and pushes it.
+func PublishGitHubPages(ctx context.Context, opts PublishOptions) (*PublishResult, error) {
+	if opts.Remote == "" {
+		return nil, errors.New("publish: no remote")
+	}
+	if r := opts.Report; r != nil && r.Partial {
+		return nil, errors.New("publish: the site is partial; generate the whole site to publish it")
+	}
+	outDir, err := filepath.Abs(opts.OutDir)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(outDir); err != nil {
+		return nil, fmt.Errorf("publish: %w", err)
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("publish: %s is not a directory", opts.OutDir)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, smokeMarkerFile)); err == nil {
+		return nil, errors.New("publish: the site is the output of a smoke test; generate the whole site to publish it")
+	}
+	branch := opts.Branch
+	if branch == "" {
+		branch = defaultPublishBranch
+	}
+	gitDir, err := os.MkdirTemp("", "pkgsite-publish-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(gitDir)
+	p := &publisher{gitDir: gitDir, env: publishEnv(opts)}
+	if _, err := p.git(ctx, "", "init", "--bare", "-q", gitDir); err != nil {
+		return nil, err
+	}
+	p.env = append(p.env, "GIT_INDEX_FILE="+filepath.Join(gitDir, "publish-index"))
+	if err := p.setAuthor(ctx, opts.Author); err != nil {
+		return nil, err
+	}
+	remote := resolveRemote(ctx, opts.Remote)
+
+	res := &PublishResult{Branch: branch}
+	ref := "refs/heads/" + branch
+	heads, err := p.git(ctx, "", "ls-remote", "--heads", remote, ref)
+	if err != nil {
+		return nil, err
+	}
+	if heads != "" {
+		if _, err := p.git(ctx, "", "fetch", "-q", "--depth=1", "--no-tags", remote, ref+":refs/publish/tip"); err != nil {
+			return nil, err
+		}
+		if res.Parent, err = p.git(ctx, "", "rev-parse", "refs/publish/tip"); err != nil {
+			return nil, err
+		}
+	}
+
+	// The files of the output, whatever the ignore files say, but for the
+	// internal files of the generator.
+	if _, err := p.git(ctx, outDir, "--work-tree="+outDir, "add", "--all", "--force", "--", ".", internalFiles); err != nil {
+		return nil, err
+	}
+	if err := p.keepFiles(ctx, res.Parent, append(protectedFiles, opts.Keep...)); err != nil {
+		return nil, err
+	}
+	if err := p.addNoJekyll(ctx); err != nil {
+		return nil, err
+	}
+	tree, err := p.git(ctx, "", "write-tree")
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := p.git(ctx, "", "mktree")
+	if err != nil {
+		return nil, err
+	}
+	if res.Parent != "" {
+		if base, err = p.git(ctx, "", "rev-parse", res.Parent+"^{tree}"); err != nil {
+			return nil, err
+		}
+	}
+	if tree == base && res.Parent != "" {
+		res.Unchanged = true
+		return res, nil
+	}
+	if res.Stat, err = p.git(ctx, "", "diff-tree", "--stat", "--no-color", "-r", base, tree); err != nil {
+		return nil, err
+	}
+	args := []string{"commit-tree", tree, "-F", "-"}
+	if res.Parent != "" {
+		args = append(args, "-p", res.Parent)
+	}
+	p.stdin = publishMessage(opts)
+	res.Commit, err = p.git(ctx, "", args...)
+	p.stdin = ""
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return res, nil
+	}
+	// Without force, the push fails if the branch moved since it was
+	// fetched, rather than dropping the commits made since.
+	if _, err := p.git(ctx, "", "push", "-q", remote, res.Commit+":"+ref); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// A publisher runs the git commands of PublishGitHubPages on its temporary
+// repository.
+type publisher struct {
+	gitDir string
+	env    []string // added to the environment of the commands
+	stdin  string
+}
+
+// git runs git with args on the repository of p in dir, or the current
+// directory if dir is empty, and returns its output without the final
+// newline.
+func (p *publisher) git(ctx context.Context, dir string, args ...string) (string, error) {
+	name := args[0]
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			name = a
+			break
+		}
+	}
+	args = append([]string{"--git-dir=" + p.gitDir, "-c", "core.autocrlf=false"}, args...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), p.env...)
+	cmd.Stdin = strings.NewReader(p.stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", name, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", name, err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// setAuthor sets the author and committer of the commit to author, or the
+// default one if neither author nor the git configuration give one.
+func (p *publisher) setAuthor(ctx context.Context, author string) error {
+	if author == "" {
+		if _, err := p.git(ctx, "", "var", "GIT_COMMITTER_IDENT"); err == nil {
+			return nil
+		}
+		author = defaultPublishAuthor
+	}
+	addr, err := mail.ParseAddress(author)
+	if err != nil {
+		return fmt.Errorf("publish: invalid author %q: want \"Name <email>\"", author)
+	}
+	p.env = append(p.env,
+		"GIT_AUTHOR_NAME="+addr.Name, "GIT_AUTHOR_EMAIL="+addr.Address,
+		"GIT_COMMITTER_NAME="+addr.Name, "GIT_COMMITTER_EMAIL="+addr.Address)
+	return nil
+}
+
+// keepFiles adds to the index the files among names that parent has and
+// the index does not.
+func (p *publisher) keepFiles(ctx context.Context, parent string, names []string) error {
+	if parent == "" {
+		return nil
+	}
+	for _, name := range names {
+		if staged, err := p.git(ctx, "", "ls-files", "--", name); err != nil {
+			return err
+		} else if staged != "" {
+			continue
+		}
+		// mode SP type SP hash TAB name
+		entry, err := p.git(ctx, "", "ls-tree", parent, "--", name)
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(entry)
+		if len(fields) < 3 || fields[1] != "blob" {
+			continue
+		}
+		if _, err := p.git(ctx, "", "update-index", "--add", "--cacheinfo", fields[0]+","+fields[2]+","+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addNoJekyll adds an empty .nojekyll file to the index if it has none.
+func (p *publisher) addNoJekyll(ctx context.Context) error {
+	if staged, err := p.git(ctx, "", "ls-files", "--", ".nojekyll"); err != nil || staged != "" {
+		return err
+	}
+	blob, err := p.git(ctx, "", "hash-object", "-w", "--stdin")
+	if err != nil {
+		return err
+	}
+	_, err = p.git(ctx, "", "update-index", "--add", "--cacheinfo", "100644,"+blob+",.nojekyll")
+	return err
+}
+
+// publishEnv returns the environment that gives git the credentials of
+// opts, if any. The token is passed in the environment rather than on the
+// command line, where other users could see it. It is added after the
+// configuration the environment already has, which it keeps.
+func publishEnv(opts PublishOptions) []string {
+	var env []string
+	if opts.Token != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + opts.Token))
+		n, err := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+		if err != nil || n < 0 {
+			n = 0
+		}
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_COUNT=%d", n+1),
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=http.extraHeader", n),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=Authorization: Basic %s", n, auth))
+	}
+	if opts.SSHCommand != "" {
+		env = append(env, "GIT_SSH_COMMAND="+opts.SSHCommand)
+	}
+	// Fail rather than wait for a password that nobody types.
+	return append(env, "GIT_TERMINAL_PROMPT=0")
+}
+
+// resolveRemote returns the URL of the remote of the git repository of the
+// current directory named remote, or remote itself if there is none.
+func resolveRemote(ctx context.Context, remote string) string {
+	out, err := exec.CommandContext(ctx, "git", "remote", "get-url", remote).Output()
+	if url := strings.TrimSpace(string(out)); err == nil && url != "" {
+		return url
+	}
+	return remote
+}
+
+// publishMessage returns the commit message of the site of opts.
+func publishMessage(opts PublishOptions) string {
+	var b strings.Builder
+	msg := strings.TrimSpace(opts.Message)
+	if msg == "" {
+		msg = "Publish the documentation site"
+	}
+	b.WriteString(msg + "\n")
+	if r := opts.Report; r != nil {
+		fmt.Fprintf(&b, "\nWrote %d pages for %d units.\n", r.Pages, r.Units)
+		writeReport(&b, r)
+	}
+	return b.String()
+}
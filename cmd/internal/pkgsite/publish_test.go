@@ -0,0 +1,176 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+)
+
+// gitOutput runs git with args in the repository dir and returns its
+// output, trimmed.
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"--git-dir=" + dir}, args...)...).Output()
+	if err != nil {
+		t.Fatalf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeSite writes files, keyed by their slash-separated paths, to a new
+// directory, which it returns.
+func writeSite(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPublishGitHubPages(t *testing.T) {
+	testenv.MustHaveExecPath(t, "git")
+	// Leave out the configuration of the user, which could sign commits.
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	ctx := context.Background()
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if out, err := exec.Command("git", "init", "--bare", "-q", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	files := func() []string {
+		return strings.Split(gitOutput(t, remote, "ls-tree", "-r", "--name-only", "gh-pages"), "\n")
+	}
+
+	// The first run creates the branch, with a .nojekyll file.
+	opts := PublishOptions{
+		OutDir: writeSite(t, map[string]string{
+			"index.html":               "home",
+			"example.com/a/index.html": "a",
+			"_static/site.css":         "css",
+			"CNAME":                    "docs.example.com",
+			".gitignore":               "*.css",
+			modulesFile:                "{}",
+			".pkgsite-manifest.sha256": "",
+		}),
+		Remote: remote,
+		Author: "Site Bot <bot@example.com>",
+		Report: &Report{Pages: 3, Units: 1},
+	}
+	res, err := PublishGitHubPages(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Commit == "" || res.Parent != "" || res.Unchanged {
+		t.Fatalf("first run: got %+v, want a commit without parent", res)
+	}
+	want := []string{".gitignore", ".nojekyll", "CNAME", "_static/site.css", "example.com/a/index.html", "index.html"}
+	if diff := cmp.Diff(want, files()); diff != "" {
+		t.Errorf("first run: files mismatch (-want +got):\n%s", diff)
+	}
+	msg := gitOutput(t, remote, "log", "-1", "--format=%an <%ae>%n%B", "gh-pages")
+	for _, w := range []string{"Site Bot <bot@example.com>", "Publish the documentation site", "Wrote 3 pages for 1 units."} {
+		if !strings.Contains(msg, w) {
+			t.Errorf("the commit message does not contain %q:\n%s", w, msg)
+		}
+	}
+	first := res.Commit
+
+	// The second run keeps CNAME, which the output no longer has, and drops
+	// the other files it does not have.
+	opts.OutDir = writeSite(t, map[string]string{
+		"index.html":               "home, again",
+		"example.com/b/index.html": "b",
+	})
+	opts.Report = nil
+	res, err = PublishGitHubPages(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Parent != first {
+		t.Errorf("second run: parent %s, want the first commit %s", res.Parent, first)
+	}
+	want = []string{".nojekyll", "CNAME", "example.com/b/index.html", "index.html"}
+	if diff := cmp.Diff(want, files()); diff != "" {
+		t.Errorf("second run: files mismatch (-want +got):\n%s", diff)
+	}
+	if got := gitOutput(t, remote, "show", "gh-pages:CNAME"); got != "docs.example.com" {
+		t.Errorf("CNAME = %q, want that of the first run", got)
+	}
+	second := res.Commit
+
+	// Publishing the same site again changes nothing.
+	res, err = PublishGitHubPages(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Unchanged || res.Commit != "" {
+		t.Errorf("third run: got %+v, want it unchanged", res)
+	}
+
+	// A dry run reports the change without pushing it.
+	opts.OutDir = writeSite(t, map[string]string{"index.html": "home, for the third time"})
+	opts.DryRun = true
+	res, err = PublishGitHubPages(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res.Stat, "example.com/b/index.html") || !strings.Contains(res.Stat, "2 files changed") {
+		t.Errorf("dry run: stat\n%s\ndoes not show the two files changed", res.Stat)
+	}
+	if got := gitOutput(t, remote, "rev-parse", "gh-pages"); got != second {
+		t.Errorf("dry run: the branch is at %s, want it left at %s", got, second)
+	}
+
+	// A partial site is not published.
+	opts.DryRun = false
+	opts.Report = &Report{Partial: true}
+	if _, err := PublishGitHubPages(ctx, opts); err == nil {
+		t.Error("publishing a partial site: got no error")
+	}
+
+	// Nor is the output of a smoke test.
+	opts.Report = nil
+	opts.OutDir = writeSite(t, map[string]string{"index.html": "home", smokeMarkerFile: smokeMarkerContent})
+	if _, err := PublishGitHubPages(ctx, opts); err == nil {
+		t.Error("publishing the output of a smoke test: got no error")
+	}
+	if got := gitOutput(t, remote, "rev-parse", "gh-pages"); got != second {
+		t.Errorf("the branch is at %s, want it left at %s", got, second)
+	}
+}
+
+func TestPublishEnv(t *testing.T) {
+	opts := PublishOptions{Token: "secret"}
+	header := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("x-access-token:secret"))
+
+	t.Setenv("GIT_CONFIG_COUNT", "")
+	want := []string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=" + header, "GIT_TERMINAL_PROMPT=0"}
+	if diff := cmp.Diff(want, publishEnv(opts)); diff != "" {
+		t.Errorf("without configuration: mismatch (-want +got):\n%s", diff)
+	}
+
+	// The configuration the environment has is kept.
+	t.Setenv("GIT_CONFIG_COUNT", "2")
+	want = []string{"GIT_CONFIG_COUNT=3", "GIT_CONFIG_KEY_2=http.extraHeader", "GIT_CONFIG_VALUE_2=" + header, "GIT_TERMINAL_PROMPT=0"}
+	if diff := cmp.Diff(want, publishEnv(opts)); diff != "" {
+		t.Errorf("with two entries: mismatch (-want +got):\n%s", diff)
+	}
+}
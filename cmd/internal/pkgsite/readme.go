@@ -0,0 +1,145 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+)
+
+// ParseReadmeOptions parses a comma-separated list of the README Markdown
+// extensions to enable, such as "tables,footnotes,diagram=mermaid". The
+// extensions are tables, strikethrough, tasklists and footnotes, and
+// diagram=LANG shows fenced code blocks in language LANG as collapsed
+// diagram source. Extensions that are not listed are disabled.
+func ParseReadmeOptions(s string) (*frontend.ReadmeOptions, error) {
+	var o frontend.ReadmeOptions
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if lang, ok := strings.CutPrefix(f, "diagram="); ok {
+			if lang == "" {
+				return nil, fmt.Errorf("README extension %q: missing language", f)
+			}
+			o.DiagramLanguages = append(o.DiagramLanguages, lang)
+			continue
+		}
+		switch f {
+		case "":
+		case "tables":
+			o.Tables = true
+		case "strikethrough":
+			o.Strikethrough = true
+		case "tasklists":
+			o.TaskLists = true
+		case "footnotes":
+			o.Footnotes = true
+		default:
+			return nil, fmt.Errorf("unknown README extension %q", f)
+		}
+	}
+	return &o, nil
+}
+
+// diagramScriptPath is the site path the DiagramScript is copied to.
+const diagramScriptPath = "static/readme-diagrams.js"
+
+// writeDiagramScript writes the diagram script content to diagramScriptPath
+// in out and records it in assets.
+func writeDiagramScript(content []byte, out *siteOutput, assets *assetGraph) error {
+	file := filepath.Join(out.dir, filepath.FromSlash(diagramScriptPath))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	if err := out.writeFile(file, content); err != nil {
+		return err
+	}
+	assets.addFile(diagramScriptPath, content)
+	return nil
+}
+
+// diagramScriptTransform returns a pageTransform that loads the diagram
+// script at the end of the pages with README diagrams.
+func diagramScriptTransform() pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		diagram := findElementFunc(doc, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && n.Data == "details" && hasClass(n, "readme-diagram")
+		})
+		body := findElement(doc, "body")
+		if diagram == nil || body == nil {
+			return
+		}
+		body.AppendChild(&html.Node{
+			Type:     html.ElementNode,
+			DataAtom: atom.Script,
+			Data:     "script",
+			Attr: []html.Attribute{
+				{Key: "src", Val: "/" + diagramScriptPath},
+				{Key: "defer"},
+			},
+		})
+	}
+}
+
+// filesPrefix is the URL path prefix under which the dynamic server serves
+// the files of local modules, and against which relative links in their
+// READMEs resolve. A static site has no such files.
+const filesPrefix = "/files/"
+
+// readmeLinksTransform returns a pageTransform that points the links of
+// READMEs to the directories of units, out of units, the canonical paths of
+// the site's units, at the pages of those units. Links in the READMEs of
+// local modules resolve to the module's files on the dynamic server, under
+// filesPrefix, whatever the directory of the README.
+func readmeLinksTransform(units map[string]bool) pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		var walk func(n *html.Node, inReadme bool)
+		walk = func(n *html.Node, inReadme bool) {
+			if n.Type == html.ElementNode {
+				if hasClass(n, "Overview-readmeContent") {
+					inReadme = true
+				}
+				if inReadme && n.Data == "a" {
+					if unit, ok := readmeLinkUnit(attrValue(n, "href"), units); ok {
+						setAttr(n, "href", unit)
+					}
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c, inReadme)
+			}
+		}
+		walk(doc, false)
+	}
+}
+
+// readmeLinkUnit returns the site path, with any fragment, of the unit of
+// units whose directory href links to under filesPrefix. The file path of a
+// module's files ends with the module path, so the unit path is the
+// longest trailing part of the file path that is in units.
+func readmeLinkUnit(href string, units map[string]bool) (string, bool) {
+	p, ok := strings.CutPrefix(href, filesPrefix)
+	if !ok {
+		return "", false
+	}
+	p, frag, hasFrag := strings.Cut(p, "#")
+	p = strings.Trim(p, "/")
+	for p != "" {
+		if c := canonicalUnitPath(p); units[c] {
+			if hasFrag {
+				return "/" + c + "#" + frag, true
+			}
+			return "/" + c, true
+		}
+		_, p, _ = strings.Cut(p, "/")
+	}
+	return "", false
+}
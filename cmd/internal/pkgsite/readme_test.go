@@ -0,0 +1,214 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestParseReadmeOptions(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want frontend.ReadmeOptions
+	}{
+		{"", frontend.ReadmeOptions{}},
+		{"tables, footnotes", frontend.ReadmeOptions{Tables: true, Footnotes: true}},
+		{
+			"strikethrough,tasklists,diagram=mermaid,diagram=d2",
+			frontend.ReadmeOptions{Strikethrough: true, TaskLists: true, DiagramLanguages: []string{"mermaid", "d2"}},
+		},
+	} {
+		got, err := ParseReadmeOptions(test.in)
+		if err != nil {
+			t.Errorf("ParseReadmeOptions(%q): %v", test.in, err)
+			continue
+		}
+		if diff := cmp.Diff(test.want, *got); diff != "" {
+			t.Errorf("ParseReadmeOptions(%q) mismatch (-want +got):\n%s", test.in, diff)
+		}
+	}
+	for _, in := range []string{"emoji", "diagram=", "tables,mermaid"} {
+		if _, err := ParseReadmeOptions(in); err == nil {
+			t.Errorf("ParseReadmeOptions(%q): got nil error", in)
+		}
+	}
+}
+
+func TestDiagramScriptTransform(t *testing.T) {
+	for _, test := range []struct {
+		name, body string
+		want       bool
+	}{
+		{"diagram", `<details class="readme-diagram readme-diagram-mermaid"><summary>s</summary></details>`, true},
+		{"no diagram", `<details><summary>s</summary></details>`, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			page := "<!DOCTYPE html><html><head></head><body>" + test.body + "</body></html>"
+			got, err := processHTML([]byte(page), "/example.com/m", nil, diagramScriptTransform())
+			if err != nil {
+				t.Fatal(err)
+			}
+			const script = `<script src="../../static/readme-diagrams.js" defer=""></script></body>`
+			if has := strings.Contains(string(got), script); has != test.want {
+				t.Errorf("page has script: %t, want %t\n%s", has, test.want, got)
+			}
+		})
+	}
+}
+
+func TestGenerateStaticSiteDiagramScript(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+-- README.md --
+# M
+
+`+"```mermaid"+`
+graph TD
+  A-->B
+`+"```"+`
+-- m.go --
+// Package m does things.
+package m
+-- sub/sub.go --
+// Package sub does other things.
+package sub
+`)
+	script := filepath.Join(t.TempDir(), "render.js")
+	if err := os.WriteFile(script, []byte("// render diagrams\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, DiagramScript: script}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outDir, "static", "readme-diagrams.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "// render diagrams\n" {
+		t.Errorf("diagram script = %q", got)
+	}
+	for _, test := range []struct {
+		page       string
+		wantScript bool
+	}{
+		{"example.com/m/index.html", true},
+		{"example.com/m/sub/index.html", false},
+	} {
+		page, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(test.page)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has := strings.Contains(string(page), `src="../../static/readme-diagrams.js"`) ||
+			strings.Contains(string(page), `src="../../../static/readme-diagrams.js"`); has != test.wantScript {
+			t.Errorf("%s loads the diagram script: %t, want %t", test.page, has, test.wantScript)
+		}
+	}
+	page, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), `<details class="readme-diagram readme-diagram-mermaid">`) {
+		t.Error("module page does not show the diagram source")
+	}
+}
+
+func TestReadmeLinkUnit(t *testing.T) {
+	units := map[string]bool{"example.com/m": true, "example.com/m/other": true, "xn--bcher-kva.example/b": true}
+	for _, test := range []struct {
+		href, want string
+	}{
+		{"/files/home/u/m/example.com/m/other", "/example.com/m/other"},
+		{"/files/home/u/m/example.com/m/other/", "/example.com/m/other"},
+		{"/files/home/u/m/example.com/m/other#usage", "/example.com/m/other#usage"},
+		{"/files/home/u/m/example.com/m", "/example.com/m"},
+		{"/files/home/u/b/bücher.example/b", "/xn--bcher-kva.example/b"},
+		{"/files/home/u/m/example.com/m/other/other.go", ""},
+		{"/files/home/u/m/example.com/m/sub/img.png", ""},
+		{"/example.com/m/other", ""},
+		{"https://example.com/m/other", ""},
+	} {
+		got, ok := readmeLinkUnit(test.href, units)
+		if got != test.want || ok != (test.want != "") {
+			t.Errorf("readmeLinkUnit(%q) = %q, %t, want %q", test.href, got, ok, test.want)
+		}
+	}
+}
+
+func TestGenerateStaticSiteSubdirectoryReadme(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- README.md --
+# Module
+
+See [sub](sub).
+-- m.go --
+// Package m does things.
+package m
+-- sub/README.md --
+# Sub readme
+
+See the [sibling](../other).
+-- sub/README --
+Not this one.
+-- sub/sub.go --
+// Package sub does things.
+package sub
+-- other/doc.md --
+# Other doc
+-- other/other.go --
+// Package other does other things.
+package other
+`, func(cfg *ServerConfig, _ *GenerateOptions) {
+		cfg.ReadmeNames = []string{"README.md", "README", "doc.md"}
+	})
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	for _, test := range []struct {
+		page string
+		want []string
+	}{
+		{"example.com/m/index.html", []string{`<a href="../../example.com/m/sub" rel="nofollow">sub</a>`}},
+		{"example.com/m/sub/index.html", []string{
+			`Sub readme`,
+			`<a href="../../../example.com/m/other" rel="nofollow">sibling</a>`,
+			// The package comment is shown along with the README.
+			`Package sub does things.`,
+		}},
+		{"example.com/m/other/index.html", []string{`Other doc`}},
+	} {
+		got := read(test.page)
+		for _, want := range test.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s does not contain %s", test.page, want)
+			}
+		}
+	}
+	if strings.Contains(read("example.com/m/sub/index.html"), "Not this one") {
+		t.Error("sub: got the README listed after README.md")
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+)
+
+// Redaction rewrites the text of the documentation model as packages are
+// loaded, before anything is rendered from it: comments, including doc
+// comments, and string literals in Go files, including the examples in
+// test files, and README contents. Identifiers and the rest of the code
+// are left alone.
+//
+// Rules apply line by line, after the indentation, so they cannot change
+// the structure of a comment or README, such as its code blocks. A doc
+// link like [example.com/pkg.Name] whose text a rule changes is replaced
+// by its redacted text, without the link.
+
+// A RedactionRule replaces the matches of a regular expression.
+type RedactionRule struct {
+	// Name identifies the rule in the report.
+	Name string `json:"name"`
+	// Pattern is a regular expression in RE2 syntax.
+	Pattern string `json:"pattern"`
+	// Replacement replaces each match, and may refer to submatches as in
+	// regexp.Regexp.Expand.
+	Replacement string `json:"replacement"`
+	// Modules lists the module path patterns, as in the go command, of the
+	// modules the rule applies to. If empty, it applies to all modules.
+	Modules []string `json:"modules,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// LoadRedactionRules reads a JSON file holding an array of redaction rules.
+func LoadRedactionRules(file string) ([]*RedactionRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*RedactionRule
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return rules, nil
+}
+
+// A redactor applies redaction rules and records the redactions applied.
+// It is safe for concurrent use.
+type redactor struct {
+	rules []*RedactionRule
+
+	mu      sync.Mutex
+	applied map[Redaction]bool
+}
+
+// newRedactor validates rules and returns a redactor for them, or nil if
+// there are none.
+func newRedactor(rules []*RedactionRule) (*redactor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	for i, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("redaction rule %d has no name", i+1)
+		}
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("redaction rule %s has no pattern", r.Name)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %s: %v", r.Name, err)
+		}
+		if strings.ContainsAny(r.Replacement, "\n\r") || strings.Contains(r.Replacement, "*/") {
+			return nil, fmt.Errorf("redaction rule %s: replacement contains a newline or */", r.Name)
+		}
+		r.re = re
+	}
+	return &redactor{rules: rules, applied: map[Redaction]bool{}}, nil
+}
+
+// loadOptions adds the redactor's rewriting to opts.
+func (rd *redactor) loadOptions(opts fetch.LoadOptions) fetch.LoadOptions {
+	if rd != nil {
+		opts.RewriteFiles = rd.rewriteFiles
+		opts.RewriteReadme = rd.rewriteReadme
+	}
+	return opts
+}
+
+// redactions returns the redactions applied, sorted.
+func (rd *redactor) redactions() []Redaction {
+	if rd == nil {
+		return nil
+	}
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	var rs []Redaction
+	for r := range rd.applied {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Page != rs[j].Page {
+			return rs[i].Page < rs[j].Page
+		}
+		if rs[i].Rule != rs[j].Rule {
+			return rs[i].Rule < rs[j].Rule
+		}
+		return rs[i].Hash < rs[j].Hash
+	})
+	return rs
+}
+
+// rulesFor returns the rules that apply to the module.
+func (rd *redactor) rulesFor(modulePath string) []*RedactionRule {
+	var rules []*RedactionRule
+	for _, r := range rd.rules {
+		if len(r.Modules) == 0 {
+			rules = append(rules, r)
+			continue
+		}
+		for _, p := range r.Modules {
+			if matchPattern(p, modulePath) {
+				rules = append(rules, r)
+				break
+			}
+		}
+	}
+	return rules
+}
+
+func (rd *redactor) rewriteReadme(modulePath, unitPath, contents string) string {
+	rules := rd.rulesFor(modulePath)
+	if len(rules) == 0 {
+		return contents
+	}
+	return rd.redactLines(unitPath, rules, contents, false)
+}
+
+func (rd *redactor) rewriteFiles(modulePath, importPath string, files map[string]*ast.File) {
+	rules := rd.rulesFor(modulePath)
+	if len(rules) == 0 {
+		return
+	}
+	for _, f := range files {
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				c.Text = rd.redactComment(importPath, rules, c.Text)
+			}
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				lit.Value = rd.redactLiteral(importPath, rules, lit.Value)
+			}
+			return true
+		})
+	}
+}
+
+// redactComment redacts the text of a // or /* */ comment.
+func (rd *redactor) redactComment(page string, rules []*RedactionRule, text string) string {
+	if strings.HasPrefix(text, "//") {
+		// A directive, such as //go:build, is not text.
+		if directiveRE.MatchString(text) {
+			return text
+		}
+		return "//" + rd.redactLines(page, rules, text[2:], true)
+	}
+	if body, ok := strings.CutPrefix(text, "/*"); ok {
+		if body, ok := strings.CutSuffix(body, "*/"); ok {
+			return "/*" + rd.redactLines(page, rules, body, true) + "*/"
+		}
+	}
+	return text
+}
+
+// redactLiteral redacts the contents of a string literal, keeping it a
+// valid literal.
+func (rd *redactor) redactLiteral(page string, rules []*RedactionRule, lit string) string {
+	s, err := strconv.Unquote(lit)
+	if err != nil {
+		return lit
+	}
+	r := rd.redactLines(page, rules, s, false)
+	if r == s {
+		return lit
+	}
+	if strings.HasPrefix(lit, "`") && strconv.CanBackquote(r) {
+		return "`" + r + "`"
+	}
+	return strconv.Quote(r)
+}
+
+// directiveRE matches a comment that is a directive to a tool.
+var directiveRE = regexp.MustCompile(`^//(line |extern |export |[a-z0-9]+:[a-z0-9])`)
+
+// docLinkRE matches a doc link, as in [Name], [pkg.Name] or
+// [example.com/pkg.T.M].
+var docLinkRE = regexp.MustCompile(`\[\*?[\pL_][\pL\pN_./-]*\]`)
+
+// redactLines applies rules to each line of text after its indentation.
+// If docLinks is set, text is a comment, and a doc link that a rule
+// changes is replaced by its redacted text.
+func (rd *redactor) redactLines(page string, rules []*RedactionRule, text string, docLinks bool) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		rest := strings.TrimLeft(line, " \t")
+		indent := line[:len(line)-len(rest)]
+		if !docLinks {
+			lines[i] = indent + rd.redact(page, rules, rest)
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range docLinkRE.FindAllStringIndex(rest, -1) {
+			b.WriteString(rd.redact(page, rules, rest[last:m[0]]))
+			link := rest[m[0]:m[1]]
+			inner := link[1 : len(link)-1]
+			if r := rd.redact(page, rules, inner); r != inner {
+				link = r
+			}
+			b.WriteString(link)
+			last = m[1]
+		}
+		b.WriteString(rd.redact(page, rules, rest[last:]))
+		lines[i] = indent + b.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// redact applies rules to s and records the matches on page.
+func (rd *redactor) redact(page string, rules []*RedactionRule, s string) string {
+	for _, r := range rules {
+		matches := r.re.FindAllStringSubmatchIndex(s, -1)
+		if matches == nil {
+			continue
+		}
+		var b []byte
+		last := 0
+		for _, m := range matches {
+			sum := sha256.Sum256([]byte(s[m[0]:m[1]]))
+			rd.mu.Lock()
+			rd.applied[Redaction{Page: page, Rule: r.Name, Hash: hex.EncodeToString(sum[:])}] = true
+			rd.mu.Unlock()
+			b = append(b, s[last:m[0]]...)
+			b = r.re.ExpandString(b, r.Replacement, s, m)
+			last = m[1]
+		}
+		s = string(append(b, s[last:]...))
+	}
+	return s
+}
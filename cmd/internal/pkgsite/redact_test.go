@@ -0,0 +1,229 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func testRedactor(t *testing.T, rules ...*RedactionRule) *redactor {
+	t.Helper()
+	rd, err := newRedactor(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rd
+}
+
+var hostRule = &RedactionRule{
+	Name:        "hosts",
+	Pattern:     `[a-z0-9-]+\.corp\.example\.com`,
+	Replacement: "internal.invalid",
+}
+
+func TestRedactFiles(t *testing.T) {
+	rd := testRedactor(t, hostRule, &RedactionRule{
+		Name:        "tickets",
+		Pattern:     `TICKET-([0-9]+)`,
+		Replacement: "ticket-$1",
+		Modules:     []string{"example.com/..."},
+	})
+	const src = `//go:generate fetch build.corp.example.com
+
+// Package p talks to db.corp.example.com (TICKET-12).
+// See [db.corp.example.com/api.Client] and [Client].
+//
+//	client := Dial("db.corp.example.com")
+package p
+
+/* Mirrors live at mirror.corp.example.com. */
+
+const (
+	Host  = "db.corp.example.com"
+	Raw   = ` + "`" + `at "db.corp.example.com"` + "`" + `
+	Mixed = ` + "`" + `x db.corp.example.com` + "`" + `
+)
+`
+	for _, test := range []struct {
+		modulePath string
+		want       string
+	}{
+		{
+			modulePath: "example.com/m",
+			want: `//go:generate fetch build.corp.example.com
+
+// Package p talks to internal.invalid (ticket-12).
+// See internal.invalid/api.Client and [Client].
+//
+//	client := Dial("internal.invalid")
+package p
+
+/* Mirrors live at internal.invalid. */
+
+const (
+	Host  = "internal.invalid"
+	Raw   = ` + "`" + `at "internal.invalid"` + "`" + `
+	Mixed = ` + "`" + `x internal.invalid` + "`" + `
+)
+`,
+		},
+		{
+			// The tickets rule applies only to example.com modules.
+			modulePath: "golang.org/x/m",
+			want:       "(TICKET-12)",
+		},
+	} {
+		t.Run(test.modulePath, func(t *testing.T) {
+			fset := token.NewFileSet()
+			f, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rd.rewriteFiles(test.modulePath, test.modulePath+"/p", map[string]*ast.File{"p.go": f})
+			var b strings.Builder
+			if err := format.Node(&b, fset, f); err != nil {
+				t.Fatal(err)
+			}
+			got := b.String()
+			if !strings.HasPrefix(test.want, "//") {
+				if !strings.Contains(got, test.want) {
+					t.Errorf("got\n%s\nwant it to contain %q", got, test.want)
+				}
+				return
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	sum := sha256.Sum256([]byte("TICKET-12"))
+	want := Redaction{Page: "example.com/m/p", Rule: "tickets", Hash: hex.EncodeToString(sum[:])}
+	found := false
+	for _, r := range rd.redactions() {
+		if r.Page == "golang.org/x/m/p" && r.Rule == "tickets" {
+			t.Errorf("tickets rule applied outside its modules: %+v", r)
+		}
+		if r == want {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("redactions %+v do not include %+v", rd.redactions(), want)
+	}
+}
+
+func TestRedactReadme(t *testing.T) {
+	rd := testRedactor(t, hostRule)
+	const in = "# M\n\nSee [docs](https://wiki.corp.example.com/m) and [M].\n\n```\n  curl api.corp.example.com\n```\n"
+	const want = "# M\n\nSee [docs](https://internal.invalid/m) and [M].\n\n```\n  curl internal.invalid\n```\n"
+	if got := rd.rewriteReadme("example.com/m", "example.com/m", in); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNewRedactorErrors(t *testing.T) {
+	for _, r := range []*RedactionRule{
+		{Pattern: "x"},
+		{Name: "empty"},
+		{Name: "bad", Pattern: "("},
+		{Name: "newline", Pattern: "x", Replacement: "a\nb"},
+		{Name: "comment", Pattern: "x", Replacement: "*/"},
+	} {
+		if _, err := newRedactor([]*RedactionRule{r}); err == nil {
+			t.Errorf("newRedactor(%+v): got nil error", r)
+		}
+	}
+}
+
+func TestGenerateStaticSiteRedactions(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m connects to db.corp.example.com.
+package m
+
+// Dial connects to the server at addr.
+func Dial(addr string) {}
+-- example_test.go --
+package m_test
+
+import "example.com/m"
+
+func Example() {
+	// The staging server is stage.corp.example.com.
+	m.Dial("db.corp.example.com:5432")
+}
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{modDir},
+		UseListedMods: true,
+		Redactions:    []*RedactionRule{hostRule},
+	}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, EmitMarkdown: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"example.com/m/index.html", "example.com/m/doc.md"} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := string(data)
+		if strings.Contains(page, "corp.example.com") {
+			t.Errorf("%s contains an internal hostname", file)
+		}
+		if !strings.Contains(page, "internal.invalid") {
+			t.Errorf("%s does not contain the redacted text", file)
+		}
+	}
+	page, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The example's comment and string literal are redacted, and its code
+	// is intact.
+	for _, want := range []string{"The staging server is internal.invalid.", "m.Dial(&#34;internal.invalid:5432&#34;)"} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("page does not contain %q", want)
+		}
+	}
+
+	var hashes []string
+	for _, r := range report.Redactions {
+		if r.Page != "example.com/m" || r.Rule != "hosts" {
+			t.Errorf("unexpected redaction %+v", r)
+		}
+		hashes = append(hashes, r.Hash)
+	}
+	var want []string
+	for _, s := range []string{"db.corp.example.com", "stage.corp.example.com"} {
+		sum := sha256.Sum256([]byte(s))
+		want = append(want, hex.EncodeToString(sum[:]))
+	}
+	if diff := cmp.Diff(want, hashes, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Errorf("redaction hashes mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A static host cannot redirect, so each URL path the server redirects
+// from gets a stub page that sends the browser on to the target. Chains of
+// redirects get a stub for each hop. Redirects out of the site are not
+// followed; their stubs send the browser to the external URL.
+
+// redirectStub is the page written for a redirect. Its arguments are the
+// target as written in the canonical link, which is rewritten like other
+// links, and as written in the refresh header, which is not.
+const redirectStub = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url=%[2]s">
+<link rel="canonical" href="%[1]s">
+<title>Redirecting…</title>
+</head>
+<body>
+<p>This page has moved to <a href="%[1]s">%[1]s</a>.</p>
+</body>
+</html>
+`
+
+// redirectTarget resolves the Location header loc of a redirect from
+// urlPath. Redirects within the site resolve to a URL path, and are local.
+// Other redirects must be to http or https URLs.
+func redirectTarget(urlPath, loc string) (target string, local bool, err error) {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return "", false, fmt.Errorf("redirect to %q: %w", loc, err)
+	}
+	if u.Scheme != "" || u.Host != "" {
+		if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+			return "", false, fmt.Errorf("redirect to %q: unsupported scheme", loc)
+		}
+		return u.String(), false, nil
+	}
+	return (&url.URL{Path: urlPath}).ResolveReference(u).String(), true, nil
+}
+
+// writeRedirectStub writes the stub page for the redirect from urlPath to
+// loc, as resolved by redirectTarget. A local loc has already been written.
+func writeRedirectStub(urlPath, loc string, out *siteOutput, consumers pageConsumers) error {
+	stubPath, err := urlPathToFilePath(urlPath, out.dir, pagePathKind)
+	if err != nil {
+		return err
+	}
+	refresh := loc
+	if strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+		// On a case-insensitive file system, a redirect to the canonical
+		// casing of a path leads to the same file.
+		if targetPath, err := urlPathToFilePath(loc, out.dir, pagePathKind); err == nil && sameFile(stubPath, targetPath) {
+			return nil
+		}
+		refresh = relativePrefix(urlPath) + canonicalURLPath(loc)[1:]
+	}
+	body := fmt.Sprintf(redirectStub, template.HTMLEscapeString(loc), template.HTMLEscapeString(refresh))
+
+	ev := &pageEvent{URLPath: urlPath, HTML: true, Redirect: loc}
+	processed, err := processHTML([]byte(body), urlPath, ev, out.pageTransforms(urlPath, nil)...)
+	if err != nil {
+		return fmt.Errorf("processing redirect stub for %s: %w", urlPath, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(stubPath), 0o755); err != nil {
+		return err
+	}
+	if err := out.writeFile(stubPath, processed); err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(out.dir, stubPath)
+	if err != nil {
+		return err
+	}
+	ev.File = filepath.ToSlash(rel)
+	ev.Size = len(processed)
+	return consumers.consumePage(ev)
+}
+
+// sameFile reports whether the files a and b exist and are the same file.
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fa, fb)
+}
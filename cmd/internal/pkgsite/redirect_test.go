@@ -0,0 +1,178 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// eventList is a pageConsumer that records every page event.
+type eventList []*pageEvent
+
+func (l *eventList) consumePage(ev *pageEvent) error {
+	*l = append(*l, ev)
+	return nil
+}
+
+func (l *eventList) finish(context.Context, *siteOutput) error { return nil }
+
+func TestRenderAndWriteRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Example.com/M", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/example.com/m", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/example.com/m", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/example.com/m/v2", http.StatusFound)
+	})
+	mux.HandleFunc("/example.com/m/v2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>m</title></head><body>final</body></html>`))
+	})
+	outDir := t.TempDir()
+	var events eventList
+	if err := renderAndWrite(mux, "/Example.com/M", testSiteOutput(t, outDir), pageConsumers{&events}); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(file string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if page := read("example.com/m/v2/index.html"); !strings.Contains(page, "final") {
+		t.Errorf("final page:\n%s", page)
+	}
+	// On a case-insensitive file system, the first hop leads to the file of
+	// the second, which is then left alone.
+	if !sameFile(filepath.Join(outDir, "Example.com", "M", "index.html"), filepath.Join(outDir, "example.com", "m", "index.html")) {
+		stub := read("Example.com/M/index.html")
+		for _, want := range []string{
+			`<meta http-equiv="refresh" content="0; url=../../example.com/m"/>`,
+			`<link rel="canonical" href="../../example.com/m"/>`,
+		} {
+			if !strings.Contains(stub, want) {
+				t.Errorf("first stub does not contain %q:\n%s", want, stub)
+			}
+		}
+	}
+	stub := read("example.com/m/index.html")
+	for _, want := range []string{
+		`<meta http-equiv="refresh" content="0; url=../../example.com/m/v2"/>`,
+		`<link rel="canonical" href="../../example.com/m/v2"/>`,
+		`<a href="../../example.com/m/v2">/example.com/m/v2</a>`,
+		`http-equiv="Content-Security-Policy"`,
+	} {
+		if !strings.Contains(stub, want) {
+			t.Errorf("second stub does not contain %q:\n%s", want, stub)
+		}
+	}
+
+	type event struct{ URLPath, File, Redirect string }
+	var got []event
+	for _, ev := range events {
+		got = append(got, event{ev.URLPath, ev.File, ev.Redirect})
+	}
+	want := []event{
+		{"/example.com/m/v2", "example.com/m/v2/index.html", ""},
+		{"/example.com/m", "example.com/m/index.html", "/example.com/m/v2"},
+		{"/Example.com/M", "Example.com/M/index.html", "/example.com/m"},
+	}
+	if sameFile(filepath.Join(outDir, "Example.com", "M", "index.html"), filepath.Join(outDir, "example.com", "m", "index.html")) {
+		want = want[:2]
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("page events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRenderAndWriteRedirectLoop(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/b", http.StatusFound)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/a", http.StatusFound)
+	})
+	outDir := t.TempDir()
+	if err := renderAndWrite(mux, "/a", testSiteOutput(t, outDir), nil); err == nil {
+		t.Fatal("got nil error")
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "a", "index.html")); err == nil {
+		t.Error("a stub was written for a redirect loop")
+	}
+}
+
+func TestRenderAndWriteExternalRedirect(t *testing.T) {
+	var requests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.String())
+		if r.URL.Path == "/example.com/m" {
+			http.Redirect(w, r, "https://pkg.go.dev/example.com/m?tab=doc", http.StatusFound)
+			return
+		}
+		w.Write([]byte(`<!DOCTYPE html><html><head></head><body>wrong page</body></html>`))
+	})
+	outDir := t.TempDir()
+	var events eventList
+	if err := renderAndWrite(mux, "/example.com/m", testSiteOutput(t, outDir), pageConsumers{&events}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"/example.com/m"}, requests); diff != "" {
+		t.Errorf("requests mismatch (-want +got):\n%s", diff)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := string(data)
+	for _, want := range []string{
+		`<meta http-equiv="refresh" content="0; url=https://pkg.go.dev/example.com/m?tab=doc"/>`,
+		`<link rel="canonical" href="https://pkg.go.dev/example.com/m?tab=doc"/>`,
+	} {
+		if !strings.Contains(stub, want) {
+			t.Errorf("stub does not contain %q:\n%s", want, stub)
+		}
+	}
+	if len(events) != 1 || events[0].Redirect != "https://pkg.go.dev/example.com/m?tab=doc" {
+		t.Errorf("got events %+v, want one for the stub", events)
+	}
+}
+
+func TestRedirectTarget(t *testing.T) {
+	for _, test := range []struct {
+		urlPath, loc string
+		want         string
+		local        bool
+		wantErr      bool
+	}{
+		{"/a/b", "/c", "/c", true, false},
+		{"/a/b", "c?x=1", "/a/c?x=1", true, false},
+		{"/a/b", "../c", "/c", true, false},
+		{"/a/b", "https://pkg.go.dev/c", "https://pkg.go.dev/c", false, false},
+		{"/a/b", "//pkg.go.dev/c", "//pkg.go.dev/c", false, false},
+		{"/a/b", "javascript:alert(1)", "", false, true},
+		{"/a/b", "%zz", "", false, true},
+	} {
+		got, local, err := redirectTarget(test.urlPath, test.loc)
+		if (err != nil) != test.wantErr {
+			t.Errorf("redirectTarget(%q, %q): got error %v, want error %t", test.urlPath, test.loc, err, test.wantErr)
+			continue
+		}
+		if got != test.want || local != test.local {
+			t.Errorf("redirectTarget(%q, %q) = %q, %t, want %q, %t", test.urlPath, test.loc, got, local, test.want, test.local)
+		}
+	}
+}
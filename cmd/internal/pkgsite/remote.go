@@ -0,0 +1,134 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+)
+
+// Modules that are not on disk can be documented from a module proxy, as
+// ServerConfig.RemoteModules lists them. Before anything is served, the go
+// command downloads them into the module cache with "go mod download",
+// which honors GOPROXY, GOPRIVATE, GONOPROXY, GONOSUMDB and GOSUMDB as it
+// does for a build. They are then served from the module cache, which is
+// laid out like a proxy, each at its version only, so that the pages are
+// rendered without network access. Their pages are at their module paths,
+// like those of local modules.
+
+// ParseRemoteModule parses a remote module written as "path@version", such
+// as "golang.org/x/text@v0.14.0". The version may be any query the go
+// command resolves, such as latest.
+func ParseRemoteModule(s string) (ModuleVersion, error) {
+	i := strings.LastIndex(s, "@")
+	if i <= 0 || i == len(s)-1 {
+		return ModuleVersion{}, fmt.Errorf("invalid remote module %q: want path@version", s)
+	}
+	return ModuleVersion{Path: s[:i], Version: s[i+1:]}, nil
+}
+
+// A downloadedModule is a module downloaded by "go mod download -json".
+type downloadedModule struct {
+	Path    string
+	Version string // resolved
+	Dir     string // the extracted module in the module cache
+	Error   string
+}
+
+// downloadModules downloads the remote modules mvs into the module cache.
+// It returns the downloaded modules, in the order of mvs.
+func downloadModules(mvs []ModuleVersion) ([]downloadedModule, error) {
+	// The modules are downloaded outside of any module, so that the
+	// settings of the current one, such as vendoring, do not apply.
+	dir, err := os.MkdirTemp("", "pkgsite-download-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	args := []string{"mod", "download", "-json"}
+	for _, mv := range mvs {
+		args = append(args, mv.Path+"@"+mv.Version)
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, runErr := cmd.Output()
+
+	// The go command reports the modules it fails to download in its
+	// output, and exits with an error.
+	var mods []downloadedModule
+	var errs []error
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var m downloadedModule
+		if err := dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("downloading modules: %v", err)
+		}
+		if m.Error != "" {
+			errs = append(errs, fmt.Errorf("downloading %s: %s", m.Path, m.Error))
+			continue
+		}
+		mods = append(mods, m)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("downloading modules: %v: %s", runErr, stderr.Bytes())
+	}
+	if len(mods) != len(mvs) {
+		return nil, fmt.Errorf("downloading modules: got %d modules, want %d", len(mods), len(mvs))
+	}
+	return mods, nil
+}
+
+// newRemoteGetters downloads the remote modules mvs and returns their
+// getters, which read them from the module cache at their versions. local
+// holds the paths of the modules read from Paths, and versioned those of
+// the modules with ModuleVersions, which cannot also be remote.
+func newRemoteGetters(mvs []ModuleVersion, local, versioned map[string]bool) ([]*versionGetter, error) {
+	if len(mvs) == 0 {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	for _, mv := range mvs {
+		switch {
+		case mv.Path == "" || mv.Version == "":
+			return nil, fmt.Errorf("remote module %s@%s: missing module path or version", mv.Path, mv.Version)
+		case seen[mv.Path]:
+			return nil, fmt.Errorf("remote module %s is given twice", mv.Path)
+		case local[mv.Path]:
+			return nil, fmt.Errorf("remote module %s is also a local module", mv.Path)
+		case versioned[mv.Path]:
+			return nil, fmt.Errorf("remote module %s also has module versions", mv.Path)
+		}
+		seen[mv.Path] = true
+	}
+	mods, err := downloadModules(mvs)
+	if err != nil {
+		return nil, err
+	}
+	cacheDir, err := defaultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	mc, err := fetch.NewModCacheGetter(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	var getters []*versionGetter
+	for _, m := range mods {
+		getters = append(getters, &versionGetter{ModuleGetter: mc, modulePath: m.Path, version: m.Version, dir: m.Dir, latest: true})
+	}
+	return getters, nil
+}
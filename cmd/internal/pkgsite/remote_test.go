@@ -0,0 +1,169 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestParseRemoteModule(t *testing.T) {
+	got, err := ParseRemoteModule("golang.org/x/text@v0.14.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ModuleVersion{Path: "golang.org/x/text", Version: "v0.14.0"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	for _, s := range []string{"golang.org/x/text", "@v0.14.0", "golang.org/x/text@"} {
+		if _, err := ParseRemoteModule(s); err == nil {
+			t.Errorf("ParseRemoteModule(%q): got nil error", s)
+		}
+	}
+}
+
+// writeFileProxy writes a module proxy serving the module versions of
+// mods, keyed by path@version, to a directory, and points the go command
+// at it, with an empty module cache.
+func writeFileProxy(t *testing.T, mods map[string]map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	lists := map[string][]string{}
+	for modver, files := range mods {
+		path, version, _ := strings.Cut(modver, "@")
+		zipFiles := map[string]string{}
+		for name, content := range files {
+			zipFiles[modver+"/"+name] = content
+		}
+		data, err := testhelper.ZipContents(zipFiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vdir := filepath.Join(dir, filepath.FromSlash(path), "@v")
+		if err := os.MkdirAll(vdir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range map[string][]byte{
+			version + ".info": []byte(fmt.Sprintf(`{"Version":%q,"Time":"2023-10-01T00:00:00Z"}`, version)),
+			version + ".mod":  []byte(files["go.mod"]),
+			version + ".zip":  data,
+		} {
+			if err := os.WriteFile(filepath.Join(vdir, name), content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lists[vdir] = append(lists[vdir], version)
+	}
+	for vdir, versions := range lists {
+		if err := os.WriteFile(filepath.Join(vdir, "list"), []byte(strings.Join(versions, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(dir))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOPRIVATE", "")
+	t.Setenv("GONOPROXY", "")
+	t.Setenv("GOFLAGS", "-modcacherw")
+	t.Setenv("GOMODCACHE", t.TempDir())
+}
+
+func TestGenerateStaticSiteRemoteModules(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	writeFileProxy(t, map[string]map[string]string{
+		"example.com/r@v1.0.0": {
+			"go.mod": "module example.com/r\n\ngo 1.21\n",
+			"r.go":   "// Package r did things.\npackage r\n",
+		},
+		"example.com/r@v1.1.0": {
+			"go.mod":   "module example.com/r\n\ngo 1.21\n",
+			"r.go":     "// Package r does things.\npackage r\n",
+			"sub/s.go": "// Package sub does other things.\npackage sub\n\n// F does it.\nfunc F() {}\n",
+		},
+	})
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/local
+
+go 1.21
+-- local.go --
+// Package local is on disk.
+package local
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{modDir},
+		UseListedMods: true,
+		RemoteModules: []ModuleVersion{{Path: "example.com/r", Version: "latest"}},
+	}
+	report, err := GenerateStaticSiteReport(context.Background(), cfg, outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string][]string{
+		"example.com/r":     {"Package r does things.", `href="../../example.com/r/sub"`, "v1.1.0"},
+		"example.com/r/sub": {"Package sub does other things.", "func F()"},
+		"example.com/local": {"Package local is on disk."},
+	} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p), "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(data), w) {
+				t.Errorf("page of %s does not contain %s", p, w)
+			}
+		}
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+	if len(report.BrokenLinks) > 0 {
+		t.Errorf("broken links: %+v", report.BrokenLinks)
+	}
+}
+
+func TestRemoteModuleErrors(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	writeFileProxy(t, map[string]map[string]string{
+		"example.com/r@v1.0.0": {
+			"go.mod": "module example.com/r\n\ngo 1.21\n",
+			"r.go":   "package r\n",
+		},
+	})
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/local
+
+go 1.21
+-- local.go --
+package local
+`)
+	for _, test := range []struct {
+		name    string
+		remotes []ModuleVersion
+		want    string
+	}{
+		{"missing version", []ModuleVersion{{Path: "example.com/r", Version: "v9.9.9"}}, "downloading example.com/r"},
+		{"local", []ModuleVersion{{Path: "example.com/local", Version: "v1.0.0"}}, "also a local module"},
+		{"twice", []ModuleVersion{{Path: "example.com/r", Version: "v1.0.0"}, {Path: "example.com/r", Version: "latest"}}, "given twice"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := ServerConfig{
+				Paths:         []string{modDir},
+				UseListedMods: true,
+				RemoteModules: test.remotes,
+			}
+			_, err := BuildServer(context.Background(), cfg)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+	"golang.org/x/mod/modfile"
+)
+
+// The replace directives of the go.mod files of the local modules are
+// followed, as the go command follows them for a build. A module replaced
+// by a directory, as in
+//
+//	replace example.com/lib => ../lib
+//
+// is documented from that directory, under the module path it replaces,
+// so that the links of the local modules to its packages lead to their
+// pages. Its own getter loads all of its packages, not only those the
+// local modules import, and is tried before the getters of the local
+// modules, which also have the packages they import. The go command lists
+// it with GOWORK=off, so that it is a main module of its own.
+//
+// A module replaced by another module version is documented from the
+// module proxy, as if it were in ServerConfig.RemoteModules, if
+// ServerConfig.Proxy is set; its pages are then at the path of the
+// replacement. Otherwise it is left out, with a warning, as is a
+// replacement directory without a go.mod file.
+
+// replacements are the replacements of the local modules to document.
+type replacements struct {
+	dirs     []string        // directories of the modules replaced by directories
+	remote   []ModuleVersion // module versions replacing modules, if fetched
+	warnings []string        // about the replacements left out
+}
+
+// findReplacements returns the replacements of the go.mod files of the
+// local modules of dirs. Modules that are local modules themselves, or
+// in remote, are not replaced. The module versions replacing modules are
+// returned only if fetch is set.
+func findReplacements(dirs map[string][]frontend.LocalModule, remote []ModuleVersion, fetch bool) (*replacements, error) {
+	local := map[string]bool{}
+	var modDirs []string
+	for _, modules := range dirs {
+		for _, m := range modules {
+			local[m.ModulePath] = true
+			if m.Dir != "" {
+				modDirs = append(modDirs, m.Dir)
+			}
+		}
+	}
+	for _, mv := range remote {
+		local[mv.Path] = true
+	}
+	// The go.mod files are read in a fixed order, so that the warnings and
+	// the replacement chosen for a module replaced twice do not vary.
+	sort.Strings(modDirs)
+
+	r := &replacements{}
+	replaced := map[string]string{} // replacements by module path
+	for _, dir := range modDirs {
+		file := filepath.Join(dir, "go.mod")
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		f, err := modfile.Parse(file, data, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, rep := range f.Replace {
+			old, line := rep.Old.Path, rep.Syntax.Start.Line
+			warn := func(format string, args ...any) {
+				r.warnings = append(r.warnings, fmt.Sprintf("%s:%d: ", file, line)+fmt.Sprintf(format, args...))
+			}
+			if local[old] {
+				continue
+			}
+			if !modfile.IsDirectoryPath(rep.New.Path) {
+				with := rep.New.Path + "@" + rep.New.Version
+				if !fetch {
+					warn("%s is replaced by %s, which is not on disk; not documenting it without a proxy", old, with)
+					continue
+				}
+				if prev, ok := replaced[old]; ok {
+					if prev != with {
+						warn("%s is also replaced by %s; documenting it from %s", old, with, prev)
+					}
+					continue
+				}
+				replaced[old] = with
+				if !local[rep.New.Path] {
+					local[rep.New.Path] = true
+					r.remote = append(r.remote, ModuleVersion{Path: rep.New.Path, Version: rep.New.Version})
+				}
+				continue
+			}
+			d := filepath.FromSlash(rep.New.Path)
+			if !filepath.IsAbs(d) {
+				d = filepath.Join(dir, d)
+			}
+			if prev, ok := replaced[old]; ok {
+				if prev != d {
+					warn("%s is also replaced by %s; documenting it from %s", old, d, prev)
+				}
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(d, "go.mod")); err != nil {
+				warn("replacement directory %s of %s has no go.mod file; not documenting it", rep.New.Path, old)
+				continue
+			}
+			replaced[old] = d
+			r.dirs = append(r.dirs, d)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+// replaceTxtar is a module whose dependency is replaced by a sibling
+// directory, with replacements by a module version, by a directory
+// without a module, and of a module that is local too.
+const replaceTxtar = `
+-- m/go.mod --
+module example.com/m
+
+go 1.21
+
+require example.com/lib v1.0.0
+
+replace example.com/lib => ../lib
+
+replace example.com/remote v1.0.0 => example.com/fork v1.2.0
+
+replace example.com/empty => ../empty
+
+replace example.com/other => ../other
+-- m/m.go --
+// Package m uses lib.
+package m
+
+import "example.com/lib"
+
+// F returns a [lib.T].
+func F() lib.T { return lib.T{} }
+-- lib/go.mod --
+module example.com/lib
+
+go 1.21
+-- lib/lib.go --
+// Package lib replaces the published one.
+package lib
+
+// T is a type.
+type T struct{}
+-- lib/sub/sub.go --
+// Package sub is not imported by m.
+package sub
+-- empty/README --
+No module here.
+-- other/go.mod --
+module example.com/other
+
+go 1.21
+-- other/other.go --
+package other
+`
+
+func TestFindReplacements(t *testing.T) {
+	dir, _ := testhelper.WriteTxtarToTempDir(t, replaceTxtar)
+	dirs := map[string][]frontend.LocalModule{
+		"m":     {{ModulePath: "example.com/m", Dir: filepath.Join(dir, "m")}},
+		"other": {{ModulePath: "example.com/other", Dir: filepath.Join(dir, "other")}},
+	}
+	file := filepath.Join(dir, "m", "go.mod")
+	for _, test := range []struct {
+		fetch        bool
+		wantRemote   []ModuleVersion
+		wantWarnings []string
+	}{
+		{
+			fetch: false,
+			wantWarnings: []string{
+				file + ":9: example.com/remote is replaced by example.com/fork@v1.2.0, which is not on disk; not documenting it without a proxy",
+				file + ":11: replacement directory ../empty of example.com/empty has no go.mod file; not documenting it",
+			},
+		},
+		{
+			fetch:      true,
+			wantRemote: []ModuleVersion{{Path: "example.com/fork", Version: "v1.2.0"}},
+			wantWarnings: []string{
+				file + ":11: replacement directory ../empty of example.com/empty has no go.mod file; not documenting it",
+			},
+		},
+	} {
+		r, err := findReplacements(dirs, nil, test.fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{filepath.Join(dir, "lib")}, r.dirs); diff != "" {
+			t.Errorf("fetch=%t: directories mismatch (-want +got):\n%s", test.fetch, diff)
+		}
+		if diff := cmp.Diff(test.wantRemote, r.remote); diff != "" {
+			t.Errorf("fetch=%t: remote modules mismatch (-want +got):\n%s", test.fetch, diff)
+		}
+		if diff := cmp.Diff(test.wantWarnings, r.warnings); diff != "" {
+			t.Errorf("fetch=%t: warnings mismatch (-want +got):\n%s", test.fetch, diff)
+		}
+	}
+
+	// A replacement that is a remote module already is not fetched twice.
+	r, err := findReplacements(dirs, []ModuleVersion{{Path: "example.com/fork", Version: "v1.3.0"}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.remote) != 0 {
+		t.Errorf("got remote modules %v, want none", r.remote)
+	}
+}
+
+func TestGenerateStaticSiteReplace(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, replaceTxtar)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{filepath.Join(dir, "m")},
+		UseListedMods: true,
+	}
+	if err := GenerateStaticSite(context.Background(), cfg, outDir); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		"example.com/m":       `href="../../example.com/lib#T"`,
+		"example.com/lib":     "Package lib replaces the published one.",
+		"example.com/lib/sub": "Package sub is not imported by m.",
+	} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p), "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("page of %s does not contain %s", p, want)
+		}
+	}
+	for _, p := range []string{"example.com/fork", "example.com/empty"} {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p))); !os.IsNotExist(err) {
+			t.Errorf("%s: got %v, want not exist", p, err)
+		}
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// The report is one of the machine-readable files defined by package
+// schema, which tools import to decode it.
+type (
+	Report             = schema.Report
+	BrokenLink         = schema.BrokenLink
+	PlatformDivergence = schema.PlatformDivergence
+	DivergentSymbol    = schema.DivergentSymbol
+	EmptyDoc           = schema.EmptyDoc
+	Redaction          = schema.Redaction
+	Hiding             = schema.Hiding
+	ArchiveSnapshot    = schema.ArchiveSnapshot
+	FailedPage         = schema.FailedPage
+	DownloadBundle     = schema.DownloadBundle
+	Degradation        = schema.Degradation
+	Batch              = schema.Batch
+	BatchOutcome       = schema.BatchOutcome
+)
+
+// A PageFailuresError reports the pages that could not be written, in
+// strict mode.
+type PageFailuresError struct {
+	Pages []FailedPage
+}
+
+func (e *PageFailuresError) Error() string {
+	paths := make([]string, len(e.Pages))
+	for i, p := range e.Pages {
+		paths[i] = p.URLPath
+	}
+	return fmt.Sprintf("%d pages failed: %s", len(e.Pages), strings.Join(paths, ", "))
+}
+
+// schemasDir is the directory of the output holding the JSON Schema
+// documents of the machine-readable files.
+const schemasDir = "schemas"
+
+// writeSchemas writes the JSON Schema documents of schema.Files to the
+// schemas directory of out. The files are added to assets.
+func writeSchemas(out *siteOutput, assets *assetGraph) error {
+	if err := os.MkdirAll(filepath.Join(out.dir, schemasDir), 0o755); err != nil {
+		return err
+	}
+	for _, a := range schema.Artifacts {
+		data, err := schema.Files.ReadFile(a.File())
+		if err != nil {
+			return err
+		}
+		sitePath := path.Join(schemasDir, path.Base(a.File()))
+		if err := out.writeFile(filepath.Join(out.dir, filepath.FromSlash(sitePath)), data); err != nil {
+			return err
+		}
+		assets.addFile(sitePath, data)
+	}
+	return nil
+}
+
+// writeReport writes a summary of r for humans.
+func writeReport(w io.Writer, r *Report) {
+	if r.Partial {
+		fmt.Fprintf(w, "Partial site: wrote %d pages for %d units; do not publish it.\n", r.Pages, r.Units)
+	}
+	if len(r.FailedPages) > 0 {
+		fmt.Fprintf(w, "%d pages failed:\n", len(r.FailedPages))
+		for _, p := range r.FailedPages {
+			fmt.Fprintf(w, "  %s: %s\n", p.URLPath, p.Error)
+		}
+	}
+	if r.IgnoredLinks > 0 {
+		fmt.Fprintf(w, "Ignored %d links to units outside the generated subset.\n", r.IgnoredLinks)
+	}
+	if len(r.BrokenLinks) > 0 {
+		fmt.Fprintf(w, "Found %d broken links:\n", len(r.BrokenLinks))
+		for _, l := range r.BrokenLinks {
+			fmt.Fprintf(w, "  %s: %s\n", l.Page, l.Href)
+		}
+	}
+	if len(r.RootPaths) > 0 {
+		fmt.Fprintf(w, "Found %d references to paths from the root of the host, which break under a subpath:\n", len(r.RootPaths))
+		for _, p := range r.RootPaths {
+			fmt.Fprintf(w, "  %s:%d: %s\n", p.File, p.Line, p.Snippet)
+		}
+	}
+	if len(r.MissingAssets) > 0 {
+		fmt.Fprintf(w, "Found %d references to missing assets:\n", len(r.MissingAssets))
+		for _, l := range r.MissingAssets {
+			fmt.Fprintf(w, "  %s: %s\n", l.Page, l.Href)
+		}
+	}
+	writeDivergenceReport(w, r.PlatformDivergence)
+	writeEmptyDocReport(w, r.EmptyDocs)
+	if len(r.Redactions) > 0 {
+		fmt.Fprintf(w, "Applied %d redactions:\n", len(r.Redactions))
+		for _, rd := range r.Redactions {
+			fmt.Fprintf(w, "  %s: %s (%.12s)\n", rd.Page, rd.Rule, rd.Hash)
+		}
+	}
+	if len(r.HiddenSymbols) > 0 {
+		fmt.Fprintf(w, "Hid the documentation of %d symbols:\n", len(r.HiddenSymbols))
+		for _, h := range r.HiddenSymbols {
+			fmt.Fprintf(w, "  %s.%s (%s)\n", h.Package, h.Symbol, h.Mode)
+		}
+	}
+	if len(r.DownloadBundles) > 0 {
+		var bytes int64
+		for _, b := range r.DownloadBundles {
+			bytes += b.Bytes
+		}
+		fmt.Fprintf(w, "Wrote %d download bundles (%d bytes) in %s, apart from the pages.\n", len(r.DownloadBundles), bytes, downloadsDir)
+	}
+	if len(r.Degradations) > 0 {
+		fmt.Fprintf(w, "Degraded the site to meet the time budget:\n")
+		for _, d := range r.Degradations {
+			fmt.Fprintf(w, "  %s, after %s: skipped %d\n", d.Feature, formatETA(time.Duration(d.Elapsed*float64(time.Second))), d.Skipped)
+		}
+	}
+	if len(r.Frozen) > 0 {
+		fmt.Fprintf(w, "Copied the files of %d frozen modules from a previous run: %s\n", len(r.Frozen), strings.Join(r.Frozen, ", "))
+	}
+	fmt.Fprintf(w, "Since the previous run, %d files changed and %d were deleted (see %s and %s).\n",
+		r.ChangedFiles, r.DeletedFiles, changedFilesFile, deletedFilesFile)
+	switch r.Invalidated {
+	case invalidatedPages:
+		fmt.Fprintf(w, "Options affecting every page changed since the previous run.\n")
+	case invalidatedAggregates:
+		fmt.Fprintf(w, "Options affecting only the files derived from the whole site changed since the previous run.\n")
+	}
+	if a := r.Archive; a != nil {
+		fmt.Fprintf(w, "Archived %d files (%d bytes) in %s/%s, adding %d bytes to the archive, which holds %d snapshots.\n",
+			a.Files, a.Bytes, archiveDir, a.Name, a.AddedBytes, a.Snapshots)
+		if len(a.Removed) > 0 {
+			fmt.Fprintf(w, "Removed %d archived snapshots: %s\n", len(a.Removed), strings.Join(a.Removed, ", "))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+func TestGenerateStaticSiteSchemas(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Schemas: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := report.SchemaVersion, schema.ReportArtifact.Version.String(); got != want {
+		t.Errorf("report schema version = %q, want %q", got, want)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outDir, "schemas", "report.v1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := schema.Files.ReadFile(schema.ReportArtifact.File())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Error("written schema differs from the embedded one")
+	}
+
+	// The report has every property its schema requires, and decodes.
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		Required []string `json:"required"`
+	}
+	if err := json.Unmarshal(want, &s); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range s.Required {
+		if _, ok := doc[p]; !ok {
+			t.Errorf("report has no %q property", p)
+		}
+	}
+	decoded, err := schema.DecodeReport(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The list of the pages is not part of the report file.
+	if diff := cmp.Diff(report, decoded, cmpopts.IgnoreFields(Report{}, "PageList")); diff != "" {
+		t.Errorf("decoded report mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPageRendererFailures(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<!DOCTYPE html><html><head></head><body>ok</body></html>`))
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+	outDir := t.TempDir()
+	pages := &pageRenderer{mux: mux, out: testSiteOutput(t, outDir), progress: newProgressTracker(textProgress{io.Discard}, 1, time.Now())}
+	for _, p := range []string{"/ok", "/broken"} {
+		pages.render(context.Background(), p)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "ok", "index.html")); err != nil {
+		t.Error(err)
+	}
+	if len(pages.failed) != 1 || pages.failed[0].URLPath != "/broken" || !strings.Contains(pages.failed[0].Error, "500") {
+		t.Fatalf("got failures %+v, want one for /broken", pages.failed)
+	}
+	err := &PageFailuresError{Pages: pages.failed}
+	if got, want := err.Error(), "1 pages failed: /broken"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+
+	var b strings.Builder
+	writeReport(&b, &Report{FailedPages: pages.failed})
+	if !strings.HasPrefix(b.String(), "1 pages failed:\n  /broken: ") {
+		t.Errorf("report does not list the failed page:\n%s", b.String())
+	}
+}
+
+// failingConsumer is a pageConsumer that fails for the page at urlPath.
+type failingConsumer struct{ urlPath string }
+
+func (c failingConsumer) consumePage(ev *pageEvent) error {
+	if ev.URLPath == c.urlPath {
+		return fmt.Errorf("cannot consume %s", ev.URLPath)
+	}
+	return nil
+}
+
+func (failingConsumer) finish(context.Context, *siteOutput) error { return nil }
+
+func TestGenerateStaticSiteStrict(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- a/a.go --
+// Package a does other things.
+package a
+`)
+	consumers := pageConsumers{failingConsumer{"/example.com/m/a"}}
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%t", strict), func(t *testing.T) {
+			cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+			report, err := generateStaticSite(context.Background(), cfg, GenerateOptions{OutDir: t.TempDir(), Strict: strict}, consumers)
+			if report == nil {
+				t.Fatalf("got no report, error %v", err)
+			}
+			if len(report.FailedPages) != 1 || report.FailedPages[0].URLPath != "/example.com/m/a" {
+				t.Errorf("got failed pages %+v, want /example.com/m/a", report.FailedPages)
+			}
+			if !strict {
+				if err != nil {
+					t.Errorf("got error %v, want nil", err)
+				}
+				return
+			}
+			var pfe *PageFailuresError
+			if !errors.As(err, &pfe) || !strings.Contains(err.Error(), "/example.com/m/a") {
+				t.Errorf("got error %v, want a *PageFailuresError naming /example.com/m/a", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"runtime"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// A repro bundle, written with GenerateOptions.ReproBundle, is a zip
+// archive of what it takes to reproduce a run, to attach to a bug report:
+//
+//	config.json    the settings of the run, without secrets
+//	env.json       the environment of the go command, without secrets
+//	modules.json   the local modules, with the hashes of their files
+//	versions.json  the versions of the generator and of Go
+//	report.json    the report of the run, listing the failed pages
+//	sources/       with GenerateOptions.IncludeSources, the files of the
+//	               local modules, under their module paths
+//
+// The entries are stored uncompressed, so that the bundle can be searched
+// for text that should not be in it before it is attached.
+
+// reproEnv lists the environment variables of the go command that affect
+// the modules a run loads.
+var reproEnv = []string{
+	"CGO_ENABLED", "GOARCH", "GOFLAGS", "GOMODCACHE", "GONOPROXY", "GONOSUMDB",
+	"GOOS", "GOPRIVATE", "GOPROXY", "GOSUMDB", "GOTOOLCHAIN", "GOWORK",
+}
+
+// A reproModule is a local module of a repro bundle.
+type reproModule struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"` // number of files, as listed by moduleFiles
+	Hash  string `json:"hash"`  // hash of the files, as by dirhash.Hash1
+}
+
+// reproVersions are the versions of a repro bundle.
+type reproVersions struct {
+	Generator string `json:"generator"`
+	Go        string `json:"go"`
+	Platform  string `json:"platform"` // GOOS/GOARCH of the generator
+}
+
+// writeReproBundle writes the repro bundle of a run with serverCfg and
+// opts, which generated the local modules and the report, to file.
+func writeReproBundle(file string, serverCfg ServerConfig, opts GenerateOptions, modules []frontend.LocalModule, report *Report) (err error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	zw := zip.NewWriter(f)
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	}
+	add := func(name string, v any) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		w, err := create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+
+	env := map[string]string{}
+	for _, k := range reproEnv {
+		if v, ok := os.LookupEnv(k); ok {
+			env[k] = stripSecrets(v)
+		}
+	}
+	var mods []reproModule
+	for _, m := range modules {
+		fsys, err := moduleFS(m.Dir)
+		if err != nil {
+			return err
+		}
+		files, err := moduleFiles(fsys)
+		if err != nil {
+			return err
+		}
+		hash, err := dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+			return fsys.Open(name)
+		})
+		if err != nil {
+			return err
+		}
+		mods = append(mods, reproModule{Path: m.ModulePath, Files: len(files), Hash: hash})
+		if !opts.IncludeSources {
+			continue
+		}
+		for _, name := range files {
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return err
+			}
+			w, err := create(path.Join("sources", m.ModulePath, name))
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range []struct {
+		name string
+		v    any
+	}{
+		{"config.json", map[string]any{"server": reproSettings(serverCfg), "generate": reproSettings(opts)}},
+		{"env.json", env},
+		{"modules.json", mods},
+		{"versions.json", reproVersions{
+			Generator: generatorVersion(),
+			Go:        runtime.Version(),
+			Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		}},
+		{"report.json", report},
+	} {
+		if err := add(e.name, e.v); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// reproSettings returns the exported fields of the struct v, by name, as
+// they are recorded in a repro bundle. Secrets are left out: URLs lose
+// their credentials, the proxy, functions and writers are recorded only as
+// set or not, and redaction rules only by name, as their patterns spell out what
+// they hide.
+func reproSettings(v any) map[string]any {
+	settings := map[string]any{}
+	rv := reflect.ValueOf(v)
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fv := rv.Field(i)
+		switch {
+		case f.Name == "Redactions":
+			var names []string
+			for _, r := range fv.Interface().([]*RedactionRule) {
+				names = append(names, r.Name)
+			}
+			settings[f.Name] = names
+		case fv.Kind() == reflect.String:
+			settings[f.Name] = stripSecrets(fv.String())
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+			var ss []string
+			for j := 0; j < fv.Len(); j++ {
+				ss = append(ss, stripSecrets(fv.Index(j).String()))
+			}
+			settings[f.Name] = ss
+		case fv.Kind() == reflect.Func, fv.Kind() == reflect.Interface, f.Name == "Proxy":
+			settings[f.Name] = !fv.IsNil()
+		default:
+			settings[f.Name] = fv.Interface()
+		}
+	}
+	return settings
+}
+
+// stripSecrets returns s without the credentials it holds if it is a URL,
+// or a comma- or pipe-separated list of them, as GOPROXY is: the user
+// information and the values of the query.
+func stripSecrets(s string) string {
+	var b []byte
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && s[i] != ',' && s[i] != '|' {
+			continue
+		}
+		b = append(b, stripURLSecrets(s[start:i])...)
+		if i < len(s) {
+			b = append(b, s[i])
+		}
+		start = i + 1
+	}
+	return string(b)
+}
+
+// stripURLSecrets returns s without its user information and the values
+// of its query, if it is an absolute URL.
+func stripURLSecrets(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() || u.User == nil && u.RawQuery == "" {
+		return s
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			q[k] = []string{"redacted"}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Two runs on the same modules and options write the same bytes, so that
+// deployments can be diffed and their files cached: the pages and the
+// aggregate files list what they list in order of path, whatever order
+// the workers rendered the pages in, and the embedded assets are copied in
+// order of path too. What would differ between runs is pinned:
+//
+//   - the time of the build, which templates can show, is
+//     GenerateOptions.BuildTime if it is set, as SOURCE_DATE_EPOCH sets it
+//     for the command, and so is the name of an untagged archived
+//     snapshot;
+//   - the modification times of the sitemap, the times of the newest
+//     files of the modules, are capped at the build time, so that a fresh
+//     checkout of the same sources makes the same sitemap;
+//   - the files of the site have the mode siteFileMode, whatever the umask
+//     or the mode of the file a previous run wrote, and an archived site
+//     has the modification times of archiveModTime.
+
+// siteFileMode is the mode of the files of the site.
+const siteFileMode fs.FileMode = 0o644
+
+// writeSiteFile writes data to file with the mode siteFileMode.
+func writeSiteFile(file string, data []byte) error {
+	if err := os.WriteFile(file, data, siteFileMode); err != nil {
+		return err
+	}
+	// WriteFile leaves the mode of an existing file, and is subject to
+	// the umask.
+	return os.Chmod(file, siteFileMode)
+}
+
+// buildTime returns the time of the build of a run with opts.
+func buildTime(opts GenerateOptions) time.Time {
+	if !opts.BuildTime.IsZero() {
+		return opts.BuildTime
+	}
+	return time.Now()
+}
+
+// capTimes caps the times of times at max, unless it is zero.
+func capTimes(times map[string]time.Time, max time.Time) {
+	if max.IsZero() {
+		return
+	}
+	for k, t := range times {
+		if t.After(max) {
+			times[k] = max
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+// readTree returns the files under dir, by slash-separated path, with
+// their modes.
+func readTree(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	if err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, file)
+		files[filepath.ToSlash(rel)] = append([]byte(fi.Mode().String()+"\n"), data...)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestGenerateStaticSiteReproducible(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+
+// F does things.
+func F() {}
+-- a/a.go --
+// Package a does other things.
+package a
+
+// G does other things.
+func G() {}
+-- b/b.go --
+// Package b does yet other things.
+package b
+
+// T is a thing.
+type T int
+`)
+	overrideDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(overrideDir, "build.tmpl"),
+		[]byte(`{{define "pre-content"}}<p class="Built">{{.Build.Time.Unix}}</p>{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := ServerConfig{
+		Paths:               []string{modDir},
+		UseListedMods:       true,
+		SymbolIndex:         true,
+		SiteURL:             "https://example.com/docs",
+		TemplateOverrideDir: overrideDir,
+	}
+	built := time.Unix(1700000000, 0)
+	// The files of the module are newer than the time of the build, but old
+	// enough that the time of the module is known, and the same for both
+	// runs.
+	modTime := time.Now().Add(-time.Hour)
+	for _, f := range []string{"go.mod", "m.go", "a/a.go", "b/b.go"} {
+		if err := os.Chtimes(filepath.Join(modDir, filepath.FromSlash(f)), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		dirs  []string
+		trees []map[string][]byte
+	)
+	generate := func(outDir string) map[string][]byte {
+		opts := GenerateOptions{
+			OutDir:          outDir,
+			BuildTime:       built,
+			Workers:         4,
+			Archive:         true,
+			Precompress:     true,
+			SourcePages:     true,
+			DownloadBundles: true,
+			Sitemap:         true,
+		}
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+			t.Fatal(err)
+		}
+		return readTree(t, outDir)
+	}
+	for i := 0; i < 2; i++ {
+		dirs = append(dirs, t.TempDir())
+		trees = append(trees, generate(dirs[i]))
+	}
+	first, second := trees[0], trees[1]
+	for p, data := range first {
+		if !bytes.Equal(data, second[p]) {
+			t.Errorf("%s differs between runs", p)
+		}
+		if mode := strings.SplitN(string(data), "\n", 2)[0]; mode != siteFileMode.String() {
+			t.Errorf("%s has mode %s, want %s", p, mode, siteFileMode)
+		}
+	}
+	for p := range second {
+		if _, ok := first[p]; !ok {
+			t.Errorf("%s written by the second run only", p)
+		}
+	}
+	if page := first["example.com/m/index.html"]; !bytes.Contains(page, []byte(`<p class="Built">1700000000</p>`)) {
+		t.Errorf("the page of example.com/m does not record the time of the build:\n%s", page)
+	}
+	if _, ok := first["archive/20231114T221320Z/index.html"]; !ok {
+		t.Error("the snapshot is not named after the time of the build")
+	}
+	if sitemap := first["sitemap.xml"]; !bytes.Contains(sitemap, []byte("2023-11-14")) {
+		t.Errorf("the sitemap does not cap its times at the time of the build:\n%s", sitemap)
+	}
+
+	// A run over a previous one restores the mode of the files it would
+	// otherwise leave alone.
+	page := filepath.Join(dirs[0], "example.com", "m", "index.html")
+	if err := os.Chmod(page, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	generate(dirs[0])
+	if fi, err := os.Stat(page); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != siteFileMode {
+		t.Errorf("a second run left %s with mode %s, want %s", page, fi.Mode().Perm(), siteFileMode)
+	}
+}
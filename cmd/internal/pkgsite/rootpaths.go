@@ -0,0 +1,278 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// The pages link each other and their assets by relative URLs, so that the
+// site works from any subpath, such as that of a GitHub Pages project.
+// walkNodes and the rewriting of stylesheets make the absolute paths of
+// the templates relative, but a reference that they do not know of, such
+// as one in a new template or script, stays a path from the root of the
+// host, which works when the site is served from the root and breaks when
+// it is not. Once the site is written, every HTML, CSS and JavaScript file
+// of the output is scanned for such references, which are listed in the
+// report. In strict mode, they fail the run. The not-found page is served
+// at any depth, and so has paths from the root on purpose, under the base
+// path of the site; only its other paths from the root are listed.
+
+// RootPath is a reference to a path from the root of the host.
+type RootPath = schema.RootPath
+
+// A RootPathsError reports the references to paths from the root of the
+// host in the output, in strict mode.
+type RootPathsError struct {
+	Paths []RootPath
+}
+
+func (e *RootPathsError) Error() string {
+	files := map[string]bool{}
+	for _, p := range e.Paths {
+		files[p.File] = true
+	}
+	return fmt.Sprintf("%d references to paths from the root of the host in %d files", len(e.Paths), len(files))
+}
+
+// rootPathExts are the extensions of the files that are scanned.
+var rootPathExts = map[string]bool{".html": true, ".css": true, ".js": true, ".mjs": true}
+
+// rootPathSnippet is the number of bytes of context on either side of a
+// reference in its snippet.
+const rootPathSnippet = 40
+
+// findRootPaths returns the references to paths from the root of the host
+// in the files written, given by their slash-separated paths in dir,
+// sorted by file and line, other than those of the not-found page under
+// basePath.
+func findRootPaths(dir string, written map[string]string, basePath string) ([]RootPath, error) {
+	var found []RootPath
+	for p := range written {
+		if !rootPathExts[path.Ext(p)] {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+		if err != nil {
+			return nil, err
+		}
+		base := ""
+		if p == notFoundURLPath[1:] {
+			base = basePath
+		}
+		found = append(found, scanRootPaths(p, data, base)...)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].File != found[j].File {
+			return found[i].File < found[j].File
+		}
+		return found[i].Line < found[j].Line
+	})
+	return found, nil
+}
+
+// scanRootPaths returns the references to paths from the root of the host
+// in data, the contents of the file at the slash-separated path file,
+// other than those to paths under base, if it is not empty.
+func scanRootPaths(file string, data []byte, base string) []RootPath {
+	// Blank out the data: URIs, keeping the offsets of the rest.
+	masked := data
+	if uris := dataURIs(data); len(uris) > 0 {
+		masked = bytes.Clone(data)
+		for _, u := range uris {
+			for i := u[0]; i < u[1]; i++ {
+				masked[i] = ' '
+			}
+		}
+	}
+	var found []RootPath
+	line, counted := 1, 0 // the line of data[counted]
+	for _, m := range rootPathRefs(masked) {
+		slash := m[0] + bytes.IndexByte(masked[m[0]:m[1]], '/')
+		if base != "" && bytes.HasPrefix(data[slash:], []byte(base)) {
+			continue
+		}
+		line += bytes.Count(data[counted:m[0]], []byte("\n"))
+		counted = m[0]
+		found = append(found, RootPath{
+			File:    file,
+			Line:    line,
+			Snippet: snippetAround(data, m[0], m[1]),
+		})
+	}
+	return found
+}
+
+// rootPathRefs returns the offsets of the start and end of the references
+// to paths from the root of the host in data, in order. They are href=/,
+// src=/ and url(/, with or without quotes, with spaces around the = and
+// after the (, and with the names in any ASCII case and starting a word,
+// and a quoted path into /static/. Protocol-relative URLs, which start
+// with //, are not paths. A reference ends after the character following
+// its slash, or after /static/. This is what the pattern
+//
+//	(?i)\b(?:href|src)\s*=\s*["']?/(?:[^/]|$)|url\(\s*["']?/(?:[^/]|$)|["']/static/
+//
+// matches, without the cost of a regular expression over every script of
+// the site.
+func rootPathRefs(data []byte) [][2]int {
+	var refs [][2]int
+	end := 0 // of the last reference, before which none starts
+	for i := 0; i < len(data); i++ {
+		j := bytes.IndexByte(data[i:], '/')
+		if j < 0 {
+			break
+		}
+		i += j
+		if start, stop, ok := rootPathRef(data, i, end); ok {
+			refs = append(refs, [2]int{start, stop})
+			end = stop
+		}
+	}
+	return refs
+}
+
+// rootPathRef returns the reference whose slash is data[slash], if there
+// is one starting at or after from.
+func rootPathRef(data []byte, slash, from int) (start, end int, ok bool) {
+	if slash+1 < len(data) && data[slash+1] == '/' {
+		return 0, 0, false
+	}
+	end = slash + 1
+	if end < len(data) {
+		_, size := utf8.DecodeRune(data[end:])
+		end += size
+	}
+	i := slash
+	if i > 0 && isQuote(data[i-1]) {
+		i--
+	}
+	i = trimSpaceBack(data, i)
+	switch {
+	case i == 0:
+	case data[i-1] == '(':
+		if n := i - 1 - len("url"); n >= from && hasFoldPrefix(data[n:], "url") {
+			return n, end, true
+		}
+	case data[i-1] == '=':
+		i = trimSpaceBack(data, i-1)
+		for _, name := range []string{"href", "src"} {
+			if n := i - len(name); n >= from && hasFoldPrefix(data[n:], name) && (n == 0 || !isWordByte(data[n-1])) {
+				return n, end, true
+			}
+		}
+	}
+	if slash > from && isQuote(data[slash-1]) && hasFoldPrefix(data[slash+1:], "static/") {
+		return slash - 1, slash + len("/static/"), true
+	}
+	return 0, 0, false
+}
+
+// trimSpaceBack returns the offset in data of the spaces that end
+// data[:i], as \s of a regular expression matches them.
+func trimSpaceBack(data []byte, i int) int {
+	for i > 0 {
+		switch data[i-1] {
+		case ' ', '\t', '\n', '\f', '\r':
+			i--
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func isQuote(b byte) bool {
+	return b == '"' || b == '\''
+}
+
+// isWordByte reports whether b is a character of a word, as \b of a
+// regular expression has it.
+func isWordByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// hasFoldPrefix reports whether data starts with lower, which is in lower
+// case, in any ASCII case.
+func hasFoldPrefix(data []byte, lower string) bool {
+	if len(data) < len(lower) {
+		return false
+	}
+	for i := 0; i < len(lower); i++ {
+		b := data[i]
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		if b != lower[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// dataURIs returns the offsets of the start and end of the data: URIs in
+// data, in order, which may hold the text of an SVG image with references
+// of its own that are not fetched. A quoted one, which may have spaces
+// after its opening quote, ends at its closing quote; another ends at a
+// quote, parenthesis, space or >. This is what the pattern
+//
+//	(?i)"\s*data:[^"]*|'\s*data:[^']*|\bdata:[^"'()\s>]*
+//
+// matches.
+func dataURIs(data []byte) [][2]int {
+	var uris [][2]int
+	end := 0 // of the last URI, before which none starts
+	for i := 0; i < len(data); i++ {
+		j := bytes.IndexByte(data[i:], ':')
+		if j < 0 {
+			break
+		}
+		i += j
+		d := i - len("data")
+		if d < end || !hasFoldPrefix(data[d:], "data") {
+			continue
+		}
+		rest := data[i+1:]
+		if q := trimSpaceBack(data, d); q > end && isQuote(data[q-1]) {
+			n := bytes.IndexByte(rest, data[q-1])
+			if n < 0 {
+				n = len(rest)
+			}
+			end = i + 1 + n
+			uris = append(uris, [2]int{q - 1, end})
+		} else if d == 0 || !isWordByte(data[d-1]) {
+			n := bytes.IndexAny(rest, "\"'() \t\n\f\r>")
+			if n < 0 {
+				n = len(rest)
+			}
+			end = i + 1 + n
+			uris = append(uris, [2]int{d, end})
+		}
+	}
+	return uris
+}
+
+// snippetAround returns the text of the line of data[start:end] around it,
+// with at most rootPathSnippet bytes on either side.
+func snippetAround(data []byte, start, end int) string {
+	from := max(start-rootPathSnippet, 0)
+	if i := bytes.LastIndexByte(data[from:start], '\n'); i >= 0 {
+		from += i + 1
+	}
+	to := min(end+rootPathSnippet, len(data))
+	if i := bytes.IndexByte(data[end:to], '\n'); i >= 0 {
+		to = end + i
+	}
+	return strings.TrimSpace(strings.ToValidUTF8(string(data[from:to]), ""))
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/static"
+)
+
+func TestScanRootPaths(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []int // lines of the references
+	}{
+		{`<a href="/example.com/m">m</a>`, []int{1}},
+		{`<img src='/static/x.svg'>`, []int{1}},
+		{`<a href=/about>about</a>`, []int{1}},
+		{`<a href="/">home</a>`, []int{1}},
+		{"p {}\n.x { background: url(/static/x.png) }", []int{2}},
+		{`.x { background: url("/static/x.png") }`, []int{1}},
+		{`const icon = "/static/shared/icon/x.svg";`, []int{1}},
+		{`<div data-src="/x.png"></div>`, []int{1}},
+		// Relative, absolute and protocol-relative URLs.
+		{`<a href="./about">about</a> <a href="../m">m</a>`, nil},
+		{`<a href="https://example.com/x">x</a>`, nil},
+		{`<script src="//cdn.example.com/x.js"></script>`, nil},
+		{`.x { background: url(//cdn.example.com/x.png) }`, nil},
+		// data: URIs, whose references are not fetched.
+		{`<img src="data:image/svg+xml;utf8,<svg><use href='/x'/></svg>">`, nil},
+		{`.x { background: url("data:image/svg+xml,<svg href='/static/x'/>") }`, nil},
+		{`.x { background: url(data:image/png;base64,iVBORw0KGgo/static/) }`, nil},
+		// Text, which the HTML renderer escapes.
+		{`<pre>a.href = &#34;/x&#34;</pre>`, nil},
+		{`<p>See /static/x.</p>`, nil},
+	} {
+		var got []int
+		for _, p := range scanRootPaths("f", []byte(test.in), "") {
+			got = append(got, p.Line)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%s: lines mismatch (-want +got):\n%s", test.in, diff)
+		}
+	}
+
+	// The not-found page has paths from the root under the base path.
+	page := []byte(`<a href="/docs/">home</a><img src="/docs/static/x.svg"><img src="/static/x.svg">`)
+	if got := scanRootPaths("404.html", page, "/docs/"); len(got) != 1 || !strings.HasSuffix(got[0].Snippet, `<img src="/static/x.svg">`) {
+		t.Errorf("the paths of the not-found page under its base path: got %v, want only /static/x.svg", got)
+	}
+}
+
+// The patterns that rootPathRefs and dataURIs match.
+var (
+	rootPathPattern = regexp.MustCompile(`(?i)\b(?:href|src)\s*=\s*["']?/(?:[^/]|$)|url\(\s*["']?/(?:[^/]|$)|["']/static/`)
+	dataURIPattern  = regexp.MustCompile(`(?i)"\s*data:[^"]*|'\s*data:[^']*|\bdata:[^"'()\s>]*`)
+)
+
+var rootPathSeeds = []string{
+	`<a href="/x">`, `<a HREF = '/'>`, `<img src=/x.png>`, `<a xhref="/x">`, `a.src='/'`,
+	`url(/x)`, `URL( "/static/x")`, `url(//cdn)`, `"/static/x"`, `'/STATIC/'`, `href="/"/static/`,
+	"src=\n\t/\u00e9", "href=/", `href=//x`, `src="/\xff`,
+	`<img src="data:image/svg+xml,<use href='/x'/>">`, `url( ' DATA:x')`, `xdata:x data:y>z`, `"data:"data:'`,
+}
+
+func FuzzRootPathScanners(f *testing.F) {
+	for _, s := range rootPathSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(checkRootPathScanners)
+}
+
+func TestRootPathScanners(t *testing.T) {
+	for _, s := range mutate(rootPathSeeds, fuzzIterations()) {
+		checkRootPathScanners(t, s)
+	}
+	// The scripts and style sheets of the site, where references abound.
+	err := fs.WalkDir(static.FS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !rootPathExts[path.Ext(p)] {
+			return err
+		}
+		data, err := fs.ReadFile(static.FS, p)
+		if err != nil {
+			return err
+		}
+		checkRootPathScanners(t, string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkRootPathScanners checks that rootPathRefs and dataURIs find in s
+// what their patterns match, except for the letters whose case folds to
+// ASCII ones outside ASCII, which they leave out.
+func checkRootPathScanners(t *testing.T, s string) {
+	if strings.ContainsAny(s, "\u017f\u212a") {
+		return
+	}
+	for _, test := range []struct {
+		name    string
+		scan    func([]byte) [][2]int
+		pattern *regexp.Regexp
+	}{
+		{"rootPathRefs", rootPathRefs, rootPathPattern},
+		{"dataURIs", dataURIs, dataURIPattern},
+	} {
+		var want [][2]int
+		for _, m := range test.pattern.FindAllStringIndex(s, -1) {
+			want = append(want, [2]int{m[0], m[1]})
+		}
+		if diff := cmp.Diff(want, test.scan([]byte(s))); diff != "" {
+			t.Errorf("%s(%.200q) mismatch (-want +got):\n%s", test.name, s, diff)
+		}
+	}
+}
+
+func TestGenerateStaticSiteRootPaths(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	mods := writeStaticPagesModules(t)
+	// The template has a path from the root in an inline style, which the
+	// rewriting of URL attributes does not see.
+	overrideDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(overrideDir, "banner.tmpl"),
+		[]byte(`{{define "pre-content"}}<div class="Banner" style="background: url(/static/shared/logo/go-blue.svg)"></div>{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := ServerConfig{Paths: mods, UseListedMods: true, TemplateOverrideDir: overrideDir}
+	report, err := GenerateStaticSiteReport(context.Background(), cfg, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.RootPaths) == 0 {
+		t.Fatal("no paths from the root found")
+	}
+	for _, p := range report.RootPaths {
+		if !strings.Contains(p.Snippet, "url(/static/shared/logo/go-blue.svg)") {
+			t.Errorf("unexpected path from the root in %s:%d: %s", p.File, p.Line, p.Snippet)
+		}
+	}
+
+	outDir := filepath.Join(t.TempDir(), "site.zip")
+	report, err = GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Strict: true})
+	var rpe *RootPathsError
+	if !errors.As(err, &rpe) || len(rpe.Paths) != len(report.RootPaths) {
+		t.Fatalf("strict: got error %v, want a *RootPathsError", err)
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Errorf("strict: the site was written to %s", outDir)
+	}
+}
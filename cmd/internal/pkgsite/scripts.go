@@ -0,0 +1,182 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The generator rewrites the absolute URL paths of pages to relative ones.
+// Attributes are rewritten by name wherever they are, including in the
+// contents of <template> elements, which become DOM when a script clones
+// them. The text of scripts is rewritten according to what it is:
+//
+//   - the string literals of executable scripts by relativizeScriptText,
+//     a plain string replacement;
+//   - the values of jsonLDURLKeys of JSON-LD scripts, by decoding the JSON;
+//   - nothing else, such as the text of data blocks or of scripts inside
+//     a <template>, which a string replacement could corrupt.
+
+// A scriptKind says how the text of a <script> element is rewritten.
+type scriptKind int
+
+const (
+	// scriptOther is the kind of scripts whose text is left alone.
+	scriptOther scriptKind = iota
+	// scriptJS is the kind of executable scripts outside <template>
+	// elements.
+	scriptJS
+	// scriptJSONLD is the kind of JSON-LD scripts, type
+	// application/ld+json.
+	scriptJSONLD
+)
+
+// jsTypes are the values of the type attribute, other than none, of the
+// scripts browsers execute.
+var jsTypes = map[string]bool{
+	"module":                   true,
+	"text/javascript":          true,
+	"application/javascript":   true,
+	"text/ecmascript":          true,
+	"application/ecmascript":   true,
+	"application/x-javascript": true,
+	"text/x-javascript":        true,
+}
+
+// jsonLDURLKeys are the keys of JSON-LD objects whose string values, or
+// arrays of them, are URLs.
+var jsonLDURLKeys = map[string]bool{
+	"@id":              true,
+	"url":              true,
+	"image":            true,
+	"logo":             true,
+	"sameAs":           true,
+	"contentUrl":       true,
+	"thumbnailUrl":     true,
+	"mainEntityOfPage": true,
+	"codeRepository":   true,
+	"downloadUrl":      true,
+	"license":          true,
+}
+
+// scriptTextKind returns the kind of the <script> element n. Scripts inside
+// a <template> element are never scriptJS.
+func scriptTextKind(n *html.Node) scriptKind {
+	if n == nil || n.Type != html.ElementNode || n.Data != "script" {
+		return scriptOther
+	}
+	typ, _, _ := strings.Cut(strings.ToLower(attrValue(n, "type")), ";")
+	typ = strings.TrimSpace(typ)
+	if typ == "application/ld+json" {
+		return scriptJSONLD
+	}
+	if typ != "" && !jsTypes[typ] {
+		return scriptOther
+	}
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.Data == "template" {
+			return scriptOther
+		}
+	}
+	return scriptJS
+}
+
+// rewriteJSONLD returns the JSON-LD text with each string value of
+// jsonLDURLKeys, including those in arrays, replaced by rewrite of it. The
+// rest of the text is kept byte for byte. If text is not valid JSON, it is
+// returned unchanged.
+func rewriteJSONLD(text string, rewrite func(string) string) string {
+	type frame struct {
+		object  bool // an object, else an array
+		wantKey bool // the next string of an object is a key
+		urls    bool // the current values are URLs
+	}
+	type edit struct {
+		start, end int
+		repl       string
+	}
+	var (
+		stack []frame
+		edits []edit
+	)
+	// valueDone records that a value of the innermost object was read.
+	valueDone := func() {
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].wantKey = true
+			stack[n-1].urls = false
+		}
+	}
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	for {
+		before := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF && len(stack) == 0 {
+			break
+		}
+		if err != nil {
+			return text
+		}
+		top := len(stack) - 1
+		switch tok := tok.(type) {
+		case json.Delim:
+			switch tok {
+			case '{':
+				stack = append(stack, frame{object: true, wantKey: true})
+			case '[':
+				stack = append(stack, frame{urls: top >= 0 && stack[top].urls})
+			default:
+				stack = stack[:top]
+				valueDone()
+			}
+		case string:
+			if top >= 0 && stack[top].object && stack[top].wantKey {
+				stack[top].wantKey = false
+				stack[top].urls = jsonLDURLKeys[tok]
+				continue
+			}
+			if top >= 0 && stack[top].urls {
+				if repl := rewrite(tok); repl != tok {
+					// Only whitespace and delimiters separate the literal from
+					// the previous token.
+					start := before + int64(strings.IndexByte(text[before:], '"'))
+					edits = append(edits, edit{int(start), int(dec.InputOffset()), jsonLDString(repl)})
+				}
+			}
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+	if len(edits) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, e := range edits {
+		b.WriteString(text[last:e.start])
+		b.WriteString(e.repl)
+		last = e.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// jsonLDString returns the JSON string literal of s for the text of a
+// <script> element. Unlike json.Marshal, it keeps &, < and > as they are,
+// so that the URL reads as written, but escapes the slash of "</", which
+// would end the element.
+func jsonLDString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s) // cannot fail for a string
+	return strings.ReplaceAll(strings.TrimSuffix(buf.String(), "\n"), "</", `<\/`)
+}
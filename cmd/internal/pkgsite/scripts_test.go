@@ -0,0 +1,152 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/html"
+)
+
+func TestScriptTextKind(t *testing.T) {
+	for _, test := range []struct {
+		page string
+		want scriptKind
+	}{
+		{`<script>x</script>`, scriptJS},
+		{`<script type="module">x</script>`, scriptJS},
+		{`<script type=" Text/JavaScript ">x</script>`, scriptJS},
+		{`<script type="application/ld+json">{}</script>`, scriptJSONLD},
+		{`<script type="application/ld+json; charset=utf-8">{}</script>`, scriptJSONLD},
+		{`<script type="application/json">{}</script>`, scriptOther},
+		{`<script type="text/x-template">x</script>`, scriptOther},
+		{`<template><script>x</script></template>`, scriptOther},
+		{`<template><div><script type="module">x</script></div></template>`, scriptOther},
+		{`<template><script type="application/ld+json">{}</script></template>`, scriptJSONLD},
+	} {
+		doc, err := html.Parse(strings.NewReader(test.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := scriptTextKind(findElement(doc, "script")); got != test.want {
+			t.Errorf("%s: got kind %d, want %d", test.page, got, test.want)
+		}
+	}
+}
+
+func TestRewriteJSONLD(t *testing.T) {
+	rewrite := func(val string) string {
+		if strings.HasPrefix(val, "/") {
+			return "../" + val[1:]
+		}
+		return val
+	}
+	for _, test := range []struct{ in, want string }{
+		{`{"url": "/a"}`, `{"url": "../a"}`},
+		{`{"name": "/a", "url":"/b"}`, `{"name": "/a", "url":"../b"}`},
+		{`{"sameAs": ["/a", "https://x", ["/b"]]}`, `{"sameAs": ["../a", "https://x", ["../b"]]}`},
+		{`{"image": {"url": "/a", "caption": "/b"}, "logo": "/c"}`, `{"image": {"url": "../a", "caption": "/b"}, "logo": "../c"}`},
+		{`[{"@id": "/a"}, {"name": "/b"}]`, `[{"@id": "../a"}, {"name": "/b"}]`},
+		{`{"url": "/a?x=1&y=2"}`, `{"url": "../a?x=1&y=2"}`},
+		{`{"url": "/a&b"}`, `{"url": "../a&b"}`},
+		{`{"url": 1, "logo": null, "name": "/a"}`, `{"url": 1, "logo": null, "name": "/a"}`},
+		// Invalid JSON is left alone.
+		{`{"url": "/a",}`, `{"url": "/a",}`},
+		{`{"url": "/a"`, `{"url": "/a"`},
+	} {
+		if got := rewriteJSONLD(test.in, rewrite); got != test.want {
+			t.Errorf("rewriteJSONLD(%s) = %s, want %s", test.in, got, test.want)
+		}
+	}
+	// A rewritten value cannot end the <script> element.
+	if got, want := rewriteJSONLD(`{"url": "/a"}`, func(string) string { return "</script>" }), `{"url": "<\/script>"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// TestRewriteCorpus checks the rewriting of the documents of
+// testdata/rewrite, which hold scripts and templates that string
+// replacement gets wrong, against their goldens.
+func TestRewriteCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "rewrite", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no documents in testdata/rewrite")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err := html.Parse(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			walkNodes(doc, "../../")
+			var buf bytes.Buffer
+			if err := html.Render(&buf, doc); err != nil {
+				t.Fatal(err)
+			}
+			got := buf.Bytes()
+
+			// The JSON-LD that was valid still is.
+			before, _ := html.Parse(bytes.NewReader(data))
+			valid := map[int]bool{}
+			for i, s := range jsonLDTexts(before) {
+				valid[i] = json.Valid([]byte(s))
+			}
+			after, err := html.Parse(bytes.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, s := range jsonLDTexts(after) {
+				if valid[i] && !json.Valid([]byte(s)) {
+					t.Errorf("JSON-LD script %d is no longer valid:\n%s", i, s)
+				}
+			}
+
+			golden := strings.TrimSuffix(file, ".html") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(want), string(got)); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// jsonLDTexts returns the texts of the JSON-LD scripts of doc, in document
+// order.
+func jsonLDTexts(doc *html.Node) []string {
+	var texts []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if scriptTextKind(n) == scriptJSONLD && n.FirstChild != nil {
+			texts = append(texts, n.FirstChild.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return texts
+}
@@ -0,0 +1,308 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A static site has no search backend. Instead, the generator writes an
+// index of the packages of the site, and the search forms of the pages load
+// a script that searches it in the browser.
+
+const (
+	// searchIndexFile is the site path of the search index.
+	searchIndexFile = "search-index.json"
+	// searchScriptPath and searchStylePath are the site paths of the
+	// search script and its style sheet, built from static/frontend.
+	searchScriptPath = "static/frontend/staticsearch/staticsearch.js"
+	searchStylePath  = "static/frontend/staticsearch/staticsearch.min.css"
+	// searchAttr marks the search forms handled by the script.
+	searchAttr = "data-pkgsite-search"
+)
+
+// A searchIndex collects the packages of the site.
+type searchIndex struct {
+	entries []schema.SearchEntry
+}
+
+// searchIndexSize is the size of a written search index.
+type searchIndexSize struct {
+	bytes    int // of the index
+	keyBytes int // of the normalized keys in the index
+}
+
+// searchKey returns the key that queries are matched against for the text
+// s, or "" if s is ASCII and its key is its lower case. The key is the
+// compatibility decomposition of s without combining marks, case-folded by
+// upper- then lower-casing it, as JavaScript can, with final sigmas made
+// ordinary. The search script and the jump-to-symbol dialog normalize
+// queries and names the same way, with static/shared/normalize.
+func searchKey(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return ""
+	}
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.M)), cases.Upper(language.Und), cases.Lower(language.Und))
+	key, _, err := transform.String(t, s)
+	if err != nil {
+		return ""
+	}
+	return strings.ReplaceAll(key, "ς", "σ")
+}
+
+// add adds the package u, loaded as unit, to the index.
+func (x *searchIndex) add(u *siteUnit, unit *internal.Unit) {
+	e := schema.SearchEntry{Path: displayUnitPath(u.path), URL: u.path + "/"}
+	seen := map[string]bool{}
+	for _, d := range unit.Documentation {
+		if e.Synopsis == "" {
+			e.Synopsis = d.Synopsis
+		}
+		for _, s := range d.API {
+			seen[s.Name] = true
+			for _, c := range s.Children {
+				seen[c.Name] = true
+			}
+		}
+	}
+	for name := range seen {
+		e.Symbols = append(e.Symbols, name)
+	}
+	sort.Strings(e.Symbols)
+	e.PathKey = searchKey(e.Path)
+	e.SynopsisKey = searchKey(e.Synopsis)
+	for i, name := range e.Symbols {
+		if key := searchKey(name); key != "" {
+			if e.SymbolKeys == nil {
+				e.SymbolKeys = make([]string, len(e.Symbols))
+			}
+			e.SymbolKeys[i] = key
+		}
+	}
+	x.entries = append(x.entries, e)
+}
+
+// write writes the index to out and adds it to assets. It returns the size
+// of the index.
+func (x *searchIndex) write(out *siteOutput, assets *assetGraph) (searchIndexSize, error) {
+	entries := append([]schema.SearchEntry{}, x.entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	encode := func(entries []schema.SearchEntry) ([]byte, error) {
+		return json.Marshal(&schema.SearchIndex{
+			SchemaVersion: schema.SearchIndexArtifact.Version.String(),
+			Packages:      entries,
+		})
+	}
+	data, err := encode(entries)
+	if err != nil {
+		return searchIndexSize{}, err
+	}
+	// Measure the keys by leaving them out.
+	var keyless []schema.SearchEntry
+	for _, e := range entries {
+		e.PathKey, e.SynopsisKey, e.SymbolKeys = "", "", nil
+		keyless = append(keyless, e)
+	}
+	without, err := encode(keyless)
+	if err != nil {
+		return searchIndexSize{}, err
+	}
+	if err := out.writeFile(filepath.Join(out.dir, searchIndexFile), data); err != nil {
+		return searchIndexSize{}, err
+	}
+	assets.addFile(searchIndexFile, data)
+	return searchIndexSize{bytes: len(data), keyBytes: len(data) - len(without)}, nil
+}
+
+// searchTransform returns the page transform that hands the search forms
+// of the page, which submit to the search page of a server, to the search
+// script. Forms it has already handed over, in a page processed before,
+// keep the script.
+func searchTransform() pageTransform {
+	return func(doc *html.Node, head *headManager) {
+		forms := searchForms(doc)
+		if len(forms) == 0 {
+			return
+		}
+		for _, f := range forms {
+			setAttr(f, searchAttr, "")
+			removeSearchMode(f)
+		}
+		head.register("search", headOrderScript,
+			&html.Node{
+				Type:     html.ElementNode,
+				Data:     "link",
+				DataAtom: atom.Link,
+				Attr: []html.Attribute{
+					{Key: "rel", Val: "stylesheet"},
+					{Key: "href", Val: "/" + searchStylePath},
+				},
+			},
+			&html.Node{
+				Type:     html.ElementNode,
+				Data:     "script",
+				DataAtom: atom.Script,
+				Attr: []html.Attribute{
+					{Key: "type", Val: "module"},
+					{Key: "src", Val: "/" + searchScriptPath},
+				},
+			})
+	}
+}
+
+// searchForms returns the search forms of doc: those that submit to the
+// search page of a server, and those handed to the search script before.
+func searchForms(doc *html.Node) []*html.Node {
+	var forms []*html.Node
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "form" && (attrValue(n, "action") == "/search" || hasAttr(n, searchAttr)) {
+			forms = append(forms, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	return forms
+}
+
+// removeSearchMode removes the search mode input of the search form f,
+// which is for the server.
+func removeSearchMode(f *html.Node) {
+	for c := f.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && c.Data == "input" && attrValue(c, "name") == "m" {
+			f.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+// pkgGoDevSearchURL is the search page of pkg.go.dev.
+const pkgGoDevSearchURL = "https://pkg.go.dev/search"
+
+// A SearchFallback decides what becomes of the search forms of the pages
+// when client-side search is disabled: they submit to the search page of
+// another site, pkg.go.dev by default, or they are removed.
+type SearchFallback struct {
+	Remove bool
+	// URL is the search page the forms submit their query to, as the q
+	// parameter. If empty, it is https://pkg.go.dev/search.
+	URL string
+}
+
+// ParseSearchFallback parses a search fallback: "pkgdotdev", "remove" or
+// "custom:URL", where URL is an absolute http or https URL, or a path on
+// the site. The URL has no query, which submitting the form replaces.
+func ParseSearchFallback(s string) (SearchFallback, error) {
+	switch s {
+	case "pkgdotdev":
+		return SearchFallback{}, nil
+	case "remove":
+		return SearchFallback{Remove: true}, nil
+	}
+	raw, ok := strings.CutPrefix(s, "custom:")
+	if !ok {
+		return SearchFallback{}, fmt.Errorf("search fallback %q: want pkgdotdev, remove or custom:URL", s)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return SearchFallback{}, fmt.Errorf("search fallback %q: %v", s, err)
+	}
+	switch {
+	case u.Scheme == "http" || u.Scheme == "https":
+		if u.Host == "" {
+			return SearchFallback{}, fmt.Errorf("search fallback %q: URL has no host", s)
+		}
+	case u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/"):
+	default:
+		return SearchFallback{}, fmt.Errorf("search fallback %q: want an http or https URL, or a path starting with /", s)
+	}
+	if u.RawQuery != "" || u.ForceQuery {
+		return SearchFallback{}, fmt.Errorf("search fallback %q: URL has a query, which the search form replaces", s)
+	}
+	return SearchFallback{URL: raw}, nil
+}
+
+// searchURL returns the URL the search forms submit to.
+func (fb SearchFallback) searchURL() string {
+	if fb.URL == "" {
+		return pkgGoDevSearchURL
+	}
+	return fb.URL
+}
+
+// formAction returns the form-action directive of the Content-Security-Policy
+// of the pages whose search forms submit off the site, or "" if they
+// submit to the site. form-action does not fall back to default-src, so
+// without it forms may submit anywhere; with it, the site's own forms
+// still can.
+func (fb SearchFallback) formAction() string {
+	u, err := url.Parse(fb.searchURL())
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return "form-action 'self' " + u.Scheme + "://" + u.Host
+}
+
+// searchFallbackTransform returns the page transform that points the search
+// forms of the page at fb's search page, keeping their query input, or
+// removes them, when there is no client-side search to hand them to.
+func searchFallbackTransform(fb SearchFallback) pageTransform {
+	formAction := fb.formAction()
+	return func(doc *html.Node, head *headManager) {
+		forms := searchForms(doc)
+		if len(forms) == 0 {
+			return
+		}
+		for _, f := range forms {
+			if fb.Remove {
+				// The header form is wrapped with the button that
+				// expands it.
+				n := f
+				if p := f.Parent; p != nil && hasClass(p, "js-searchForm") {
+					n = p
+				}
+				if n.Parent != nil {
+					n.Parent.RemoveChild(n)
+				}
+				continue
+			}
+			setAttr(f, "action", fb.searchURL())
+			f.Attr = slices.DeleteFunc(f.Attr, func(a html.Attribute) bool { return a.Key == searchAttr })
+			removeSearchMode(f)
+		}
+		if !fb.Remove && formAction != "" {
+			head.register("csp", headOrderCSP, cspMeta(formAction))
+		}
+	}
+}
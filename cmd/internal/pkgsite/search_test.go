@@ -0,0 +1,319 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+func TestSearchTransform(t *testing.T) {
+	page := `<html><head><title>T</title></head><body>` +
+		`<form class="go-SearchForm-form" action="/search" role="search">` +
+		`<input name="q"><input name="m" value="" hidden><button>Search</button></form>` +
+		`<form action="/other"><input name="q"></form></body></html>`
+	got, err := processHTML([]byte(page), "/example.com/m", nil, searchTransform())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<form class="go-SearchForm-form" action="../../search" role="search" data-pkgsite-search="">`,
+		`<form action="../../other">`,
+		`<link rel="stylesheet" href="../../static/frontend/staticsearch/staticsearch.min.css"/>`,
+		`<script type="module" src="../../static/frontend/staticsearch/staticsearch.js"></script>`,
+		`connect-src &#39;self&#39;`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("page does not contain %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(string(got), `name="m"`) {
+		t.Errorf("search mode input was not removed:\n%s", got)
+	}
+
+	// Pages without a search form do not load the script.
+	got, err = processHTML([]byte(`<html><head></head><body></body></html>`), "/", nil, searchTransform())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "staticsearch") {
+		t.Errorf("page without a search form loads the search script:\n%s", got)
+	}
+}
+
+func TestGenerateStaticSiteSearchIndex(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- httpx/httpx.go --
+// Package httpx serves requests.
+package httpx
+
+// A Handler handles requests.
+type Handler struct{}
+
+// ServeHTTP serves a request.
+func (Handler) ServeHTTP() {}
+
+// ListenAndServe listens.
+func ListenAndServe() {}
+-- internal/empty/doc.txt --
+Not a package.
+-- zurich/zurich.go --
+// Package zurich greets Mu`+"\u0308"+`ller.
+package zurich
+
+// Grüße greets.
+func Grüße() {}
+
+// Hello greets.
+func Hello() {}
+`, nil)
+	data, err := os.ReadFile(filepath.Join(outDir, searchIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := schema.DecodeSearchIndex(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &schema.SearchIndex{
+		SchemaVersion: schema.SearchIndexArtifact.Version.String(),
+		Packages: []schema.SearchEntry{
+			{Path: "example.com/m", URL: "example.com/m/", Synopsis: "Package m does things."},
+			{
+				Path:     "example.com/m/httpx",
+				URL:      "example.com/m/httpx/",
+				Synopsis: "Package httpx serves requests.",
+				Symbols:  []string{"Handler", "Handler.ServeHTTP", "ListenAndServe"},
+			},
+			{
+				Path:        "example.com/m/zurich",
+				URL:         "example.com/m/zurich/",
+				Synopsis:    "Package zurich greets Mu\u0308ller.",
+				Symbols:     []string{"Grüße", "Hello"},
+				SynopsisKey: "package zurich greets muller.",
+				SymbolKeys:  []string{"grusse", ""},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, index); diff != "" {
+		t.Errorf("search index mismatch (-want +got):\n%s", diff)
+	}
+
+	// Every page's search form uses the script, which is in the output.
+	for _, p := range []string{"index.html", "about/index.html", "example.com/m/httpx/index.html", "404.html"} {
+		page, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(page), searchAttr) || !strings.Contains(string(page), "staticsearch.js") {
+			t.Errorf("%s: search form does not use the search script", p)
+		}
+	}
+	js, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(searchScriptPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The script finds the packages in the index.
+	testenv.MustHaveExecPath(t, "node")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "staticsearch.mjs"), js, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner := `globalThis.document = {documentElement: {dataset: {}}, querySelectorAll: () => []};
+globalThis.location = {href: "https://example.com/"};
+const {searchPackages} = await import("./staticsearch.mjs");
+const index = JSON.parse(process.argv[2]);
+const results = {};
+for (const q of ["httpx", "servehttp", "things", "mhx", "nothing", "MULLER", "grusse"]) {
+	results[q] = searchPackages(index.packages, q).map(r => r.url);
+}
+results.matches = searchPackages(index.packages, "muller").map(r => JSON.stringify(r.synopsisMatches));
+console.log(JSON.stringify(results));
+`
+	if err := os.WriteFile(filepath.Join(dir, "run.mjs"), []byte(runner), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("node", "run.mjs", string(data))
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("node: %v\n%s", err, out)
+	}
+	var got map[string][]string
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	wantResults := map[string][]string{
+		"httpx":     {"example.com/m/httpx/"},
+		"servehttp": {"example.com/m/httpx/#Handler.ServeHTTP"},
+		"things":    {"example.com/m/"},
+		"mhx":       {"example.com/m/httpx/"},
+		"nothing":   {},
+		"MULLER":    {"example.com/m/zurich/"},
+		"grusse":    {"example.com/m/zurich/#Grüße"},
+		// The match covers the u and its combining diaeresis.
+		"matches": {"[[22,29]]"},
+	}
+	if diff := cmp.Diff(wantResults, got); diff != "" {
+		t.Errorf("search results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSearchKey(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"Handler.ServeHTTP", ""},
+		{"M\u00fcller", "muller"},
+		{"Mu\u0308ller", "muller"},
+		{"Straße", "strasse"},
+		{"ﬁle", "file"},
+		{"ΟΔΟΣ", "οδοσ"},
+		{"İstanbul", "istanbul"},
+	} {
+		if got := searchKey(test.in); got != test.want {
+			t.Errorf("searchKey(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseSearchFallback(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want SearchFallback
+	}{
+		{"pkgdotdev", SearchFallback{}},
+		{"remove", SearchFallback{Remove: true}},
+		{"custom:https://search.example.com/go", SearchFallback{URL: "https://search.example.com/go"}},
+		{"custom:/search.html", SearchFallback{URL: "/search.html"}},
+	} {
+		got, err := ParseSearchFallback(test.in)
+		if err != nil {
+			t.Errorf("ParseSearchFallback(%q): %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseSearchFallback(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+	}
+	for _, s := range []string{
+		"",
+		"google",
+		"custom:",
+		"custom:search.html",
+		"custom:ftp://example.com/search",
+		"custom:https:///search",
+		"custom:https://example.com/search?lang=go",
+	} {
+		if _, err := ParseSearchFallback(s); err == nil {
+			t.Errorf("ParseSearchFallback(%q): got nil error", s)
+		}
+	}
+}
+
+func TestSearchFallbackTransform(t *testing.T) {
+	page := `<html><head><title>T</title></head><body>` +
+		`<div class="go-SearchForm js-searchForm">` +
+		`<form class="go-SearchForm-form" action="/search" role="search">` +
+		`<input name="q"><input name="m" value="" hidden><button>Search</button></form>` +
+		`<button class="js-expandSearch">Open</button></div>` +
+		`<form class="Homepage-search" action="/search"><input name="q"></form>` +
+		`<form action="/other"><input name="q"></form></body></html>`
+	for _, test := range []struct {
+		name       string
+		fallback   SearchFallback
+		want, dont []string
+	}{
+		{"pkgdotdev", SearchFallback{}, []string{
+			`<form class="go-SearchForm-form" action="https://pkg.go.dev/search" role="search"><input name="q"/><button>`,
+			`<form class="Homepage-search" action="https://pkg.go.dev/search">`,
+			`form-action &#39;self&#39; https://pkg.go.dev"`,
+			`js-expandSearch`,
+		}, []string{`name="m"`, searchAttr, "staticsearch"}},
+		{"custom off-site", SearchFallback{URL: "https://search.example.com/go"}, []string{
+			`action="https://search.example.com/go"`,
+			`form-action &#39;self&#39; https://search.example.com"`,
+		}, []string{"pkg.go.dev"}},
+		{"custom on-site", SearchFallback{URL: "/find"}, []string{
+			`<form class="Homepage-search" action="../../find">`,
+		}, []string{"form-action"}},
+		{"remove", SearchFallback{Remove: true}, []string{
+			`<form action="../../other">`,
+		}, []string{"go-SearchForm", "js-expandSearch", "Homepage-search", "form-action"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := processHTML([]byte(page), "/example.com/m", nil, searchFallbackTransform(test.fallback))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("page does not contain %s:\n%s", want, got)
+				}
+			}
+			for _, dont := range test.dont {
+				if strings.Contains(string(got), dont) {
+					t.Errorf("page contains %s:\n%s", dont, got)
+				}
+			}
+		})
+	}
+
+	// Pages without a search form keep the policy without form-action.
+	got, err := processHTML([]byte(`<html><head></head><body></body></html>`), "/", nil, searchFallbackTransform(SearchFallback{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "form-action") {
+		t.Errorf("page without a search form restricts form actions:\n%s", got)
+	}
+}
+
+func TestGenerateStaticSiteNoClientSearch(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`, func(_ *ServerConfig, opts *GenerateOptions) {
+		opts.NoClientSearch = true
+	})
+	if _, err := os.Stat(filepath.Join(outDir, searchIndexFile)); !os.IsNotExist(err) {
+		t.Errorf("search index: got %v, want not exist", err)
+	}
+	for _, p := range []string{"index.html", "about/index.html", "example.com/m/index.html", "404.html"} {
+		page, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{`action="https://pkg.go.dev/search"`, "form-action"} {
+			if !strings.Contains(string(page), want) {
+				t.Errorf("%s does not contain %s", p, want)
+			}
+		}
+		if strings.Contains(string(page), "staticsearch.js") || strings.Contains(string(page), `action="/search"`) {
+			t.Errorf("%s: search form uses the search script or the server's search page", p)
+		}
+	}
+}
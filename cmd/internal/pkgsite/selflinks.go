@@ -0,0 +1,109 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Doc comments and READMEs sometimes link the published documentation of
+// the site by absolute URLs, such as
+// https://docs.example.com/example.com/m/pkg, which leave a preview of the
+// site or a copy of it opened from file:// URLs for the published site.
+// When the site URL is known, the links of the pages under it to pages of
+// the site are made paths from the root, which walkNodes then makes
+// relative, keeping their query and fragment. A link to a page that the
+// run does not write is left as it is, as are all of them with
+// GenerateOptions.AbsoluteSelfLinks.
+
+// sitePageSet returns the set of the site paths of the pages that a run
+// writes, such as "" for the homepage or "example.com/m/imports": the
+// homepage and informational pages, the pages of units, their tabs, symbol
+// indexes and source files, and those of the frozen modules.
+func sitePageSet(staticPages *siteStaticPages, units []*siteUnit, tabs map[string]bool, indexes map[string][]string, sources []sourcePage, frozen map[string]*moduleContribution) map[string]bool {
+	pages := map[string]bool{"": true, attributionsURLPath[1:]: true}
+	for _, p := range staticPages.urlPaths {
+		pages[p[1:]] = true
+	}
+	for _, u := range units {
+		pages[u.path] = true
+	}
+	for p := range tabs {
+		pages[p] = true
+	}
+	for _, urls := range indexes {
+		for _, u := range urls {
+			pages[tabPagePath(u)[1:]] = true
+		}
+	}
+	for _, f := range sources {
+		pages[f.sitePath] = true
+	}
+	for _, c := range frozen {
+		for _, p := range c.Pages {
+			if p.HTML && p.Redirect == "" && path.Base(p.File) == "index.html" {
+				pages[path.Dir(p.File)] = true
+			}
+		}
+	}
+	return pages
+}
+
+// selfLinksTransform returns the page transform making the links to the
+// pages of the site under siteURL paths from the root, if siteURL is an
+// absolute URL. pages holds the site paths of the pages of the site.
+func selfLinksTransform(siteURL string, pages map[string]bool) pageTransform {
+	base, err := url.Parse(siteURL)
+	if siteURL == "" || err != nil || base.Host == "" {
+		return nil
+	}
+	prefix := strings.TrimSuffix(base.EscapedPath(), "/") + "/"
+	return func(doc *html.Node, _ *headManager) {
+		walkElements(doc, func(n *html.Node) {
+			if n.DataAtom != atom.A {
+				return
+			}
+			if p, ok := selfLinkPath(attrValue(n, "href"), base.Host, prefix, pages); ok {
+				setAttr(n, "href", p)
+			}
+		})
+	}
+}
+
+// selfLinkPath returns the path from the root, with the query and fragment,
+// that the absolute URL href of a page of the site at host, under the URL
+// path prefix, which ends in a slash, is made, if it links one of pages.
+func selfLinkPath(href, host, prefix string, pages map[string]bool) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.User != nil || !strings.EqualFold(u.Host, host) {
+		return "", false
+	}
+	escaped := u.EscapedPath()
+	rest, ok := strings.CutPrefix(escaped, prefix)
+	if !ok {
+		if escaped+"/" != prefix {
+			return "", false
+		}
+		rest = ""
+	}
+	rest = strings.TrimSuffix(rest, "/")
+	p, err := url.PathUnescape(rest)
+	if err != nil || p != path.Clean("/" + p)[1:] || !pages[canonicalUnitPath(p)] {
+		return "", false
+	}
+	target := "/" + rest
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	if u.Fragment != "" {
+		target += "#" + u.EscapedFragment()
+	}
+	return target, true
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestSelfLinkPath(t *testing.T) {
+	pages := map[string]bool{"": true, "example.com/m": true, "example.com/m/sub": true, "xn--bcher-kva.example/b": true}
+	for _, test := range []struct {
+		href, want string
+	}{
+		{"https://docs.example.com/docs/example.com/m", "/example.com/m"},
+		{"https://docs.example.com/docs/example.com/m/sub/", "/example.com/m/sub"},
+		{"http://DOCS.example.com/docs/example.com/m", "/example.com/m"},
+		{"https://docs.example.com/docs/example.com/m/sub?tab=doc#T.M", "/example.com/m/sub?tab=doc#T.M"},
+		{"https://docs.example.com/docs/example.com/m#hdr-Some%20heading", "/example.com/m#hdr-Some%20heading"},
+		{"https://docs.example.com/docs/", "/"},
+		{"https://docs.example.com/docs", "/"},
+		{"https://docs.example.com/docs/b%C3%BCcher.example/b", "/b%C3%BCcher.example/b"},
+		// Pages the run does not write.
+		{"https://docs.example.com/docs/example.com/m/missing", ""},
+		{"https://docs.example.com/docs/example.com/m/sub/../../m", ""},
+		// Other sites, and other paths of the host.
+		{"https://pkg.go.dev/example.com/m", ""},
+		{"https://docs.example.com/example.com/m", ""},
+		{"https://docs.example.com:8080/docs/example.com/m", ""},
+		{"https://user@docs.example.com/docs/example.com/m", ""},
+		{"ftp://docs.example.com/docs/example.com/m", ""},
+		{"/example.com/m", ""},
+		{"./sub", ""},
+	} {
+		got, ok := selfLinkPath(test.href, "docs.example.com", "/docs/", pages)
+		if got != test.want || ok != (test.want != "") {
+			t.Errorf("selfLinkPath(%q) = %q, %t, want %q", test.href, got, ok, test.want)
+		}
+	}
+}
+
+func TestGenerateStaticSiteSelfLinks(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things; see https://docs.example.com/docs/example.com/m/sub?x=1#T
+// and https://docs.example.com/docs/example.com/m/gone.
+package m
+-- sub/sub.go --
+// Package sub does other things.
+package sub
+
+// T is a thing.
+type T int
+`)
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true, SiteURL: "https://docs.example.com/docs/"}
+	opts := GenerateOptions{OutDir: t.TempDir()}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.BrokenLinks) != 0 {
+		t.Errorf("broken links: %v", report.BrokenLinks)
+	}
+	page, err := os.ReadFile(filepath.Join(opts.OutDir, "example.com", "m", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`href="../../example.com/m/sub?x=1#T"`,
+		// Not written, so left as it is.
+		`href="https://docs.example.com/docs/example.com/m/gone"`,
+	} {
+		if !bytes.Contains(page, []byte(want)) {
+			t.Errorf("the page of example.com/m does not contain %s", want)
+		}
+	}
+
+	opts.OutDir, opts.AbsoluteSelfLinks = t.TempDir(), true
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+		t.Fatal(err)
+	}
+	page, err = os.ReadFile(filepath.Join(opts.OutDir, "example.com", "m", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `href="https://docs.example.com/docs/example.com/m/sub?x=1#T"`; !bytes.Contains(page, []byte(want)) {
+		t.Errorf("with AbsoluteSelfLinks, the page of example.com/m does not contain %s", want)
+	}
+}
@@ -8,12 +8,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -23,14 +28,18 @@ import (
 	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
 	"github.com/wow-look-at-my/static-pkgsite/internal/fetchdatasource"
 	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+	pagepkg "github.com/wow-look-at-my/static-pkgsite/internal/frontend/page"
 	"github.com/wow-look-at-my/static-pkgsite/internal/log"
 	"github.com/wow-look-at-my/static-pkgsite/internal/proxy"
 	"github.com/wow-look-at-my/static-pkgsite/internal/source"
+	"github.com/wow-look-at-my/static-pkgsite/internal/stdlib"
 	"github.com/wow-look-at-my/static-pkgsite/static"
 	thirdparty "github.com/wow-look-at-my/static-pkgsite/third_party"
 )
 
-// ServerConfig provides configuration for BuildServer.
+// ServerConfig provides configuration for BuildServer: the modules it
+// loads, and how it serves their pages. A static site generation takes the
+// settings of the site in GenerateOptions.
 type ServerConfig struct {
 	Paths                 []string
 	GOPATHMode            bool
@@ -44,15 +53,111 @@ type ServerConfig struct {
 	GoDocMode             bool
 	RecordCodeWikiMetrics frontend.RecordClickFunc
 
+	// TemplateOverrideDir, if set, is a directory of *.tmpl files whose
+	// {{define}} blocks replace the built-in templates of the same name.
+	// Overrides can use the .Site, .Build and .Page fields described in
+	// internal/frontend/page.BasePage.
+	TemplateOverrideDir string
+	SiteName            string // human-readable site name, exposed as .Site.Name
+	SiteURL             string // absolute URL the site is published at, exposed as .Site.URL
+
+	// ConstrainedPackages decides whether packages whose Go files are all
+	// excluded by build constraints are served.
+	ConstrainedPackages ConstrainedPolicy
+
+	// ReadmeOptions selects the Markdown extensions used to render READMEs.
+	// If nil, frontend.DefaultReadmeOptions is used.
+	ReadmeOptions *frontend.ReadmeOptions
+
+	// ReadmeNames lists the file names a directory's README may have, in
+	// order of preference. If nil, any file named README is one; see
+	// fetch.LoadOptions.
+	ReadmeNames []string
+
+	// Redactions rewrite the text of comments, string literals and READMEs
+	// as packages are loaded, before their documentation is rendered.
+	Redactions []*RedactionRule
+
+	// HiddenSymbols hides the documentation of symbols, by the import path
+	// of their package. See hide.go.
+	HiddenSymbols map[string][]HiddenSymbol
+
+	// ModuleVersions are versions of modules to document besides those of
+	// Paths, each read from a directory of its own. See versions.go.
+	ModuleVersions []ModuleVersion
+
+	// DiscoverModules serves every module found in the directory trees of
+	// Paths, rather than the modules of the directories. See discover.go.
+	DiscoverModules bool
+
+	// Workspace is the root directory of a go.work workspace, whose modules
+	// are documented along with those of Paths. See workspace.go.
+	Workspace string
+
+	// RemoteModules are modules to document besides those of Paths,
+	// downloaded at their versions through the module proxy. Their Dir is
+	// unused. See remote.go.
+	RemoteModules []ModuleVersion
+
+	// ModuleZips are modules to document besides those of Paths, each
+	// read from a module zip file, which is its Dir. See modulezip.go.
+	ModuleZips []ModuleVersion
+
+	// CachedModules are modules to document besides those of Paths, read
+	// at their versions from the module cache of CacheDir, or GOMODCACHE,
+	// without network access. Their Dir is unused. See modcache.go.
+	CachedModules []ModuleVersion
+
+	// Stdlib documents the standard library, from the Go tree of
+	// StdlibArchive, GoRepoPath or GOROOT. StdlibInternal keeps its
+	// internal packages. See stdlib.go.
+	Stdlib         bool
+	StdlibArchive  string
+	StdlibInternal bool
+
+	// SymbolIndex gives each module a symbol index tab, listing the
+	// exported symbols of all its packages, linked from the module page.
+	SymbolIndex bool
+	// SymbolIndexPageSize is the number of symbols on a page of a symbol
+	// index. If it is not positive, the index has pages of 2000 symbols.
+	SymbolIndexPageSize int
+	// GlanceThreshold, if positive, gives the documentation of packages
+	// with more symbols than it a collapsed "At a glance" section: a dense
+	// index listing each type with its constructors and its numbers of
+	// methods and values, linked from the outline.
+	GlanceThreshold int
+
 	Proxy *proxy.Client // client, or nil; controlled by the -proxy flag
+
+	basePath  string                         // set from GenerateOptions.BasePath
+	buildTime time.Time                      // set from GenerateOptions.BuildTime
+	strict    bool                           // set from GenerateOptions.Strict
+	frozen    map[string]*moduleContribution // the recorded contributions of GenerateOptions.Frozen, set by generateSite; non-nil if it lists any
+	logOut    io.Writer                      // the messages of the run, set from GenerateOptions.Logger; os.Stderr if nil
+}
+
+// logOutput returns the writer of the messages of the run.
+func (cfg ServerConfig) logOutput() io.Writer {
+	if cfg.logOut == nil {
+		return os.Stderr
+	}
+	return cfg.logOut
 }
 
 // buildResult holds the intermediate results of building a server,
 // exposing the getters and modules for use by static site generation.
 type buildResult struct {
-	Server     *frontend.Server
-	Getters    []fetch.ModuleGetter
-	AllModules []frontend.LocalModule
+	Server      *frontend.Server
+	DataSource  *fetchdatasource.FetchDataSource // the server's
+	Getters     []fetch.ModuleGetter
+	Versions    []*versionGetter // the getters of ServerConfig.ModuleVersions, also in Getters
+	AllModules  []frontend.LocalModule
+	LoadOptions fetch.LoadOptions
+	Redactor    *redactor // nil if there are no redaction rules
+	Hider       *hider    // nil if there are no hidden symbols
+	// Renamed holds the paths that the go.mod files of modules declare, by
+	// the other paths the configuration gives them; see modpath.go.
+	Renamed map[string]string
 }
 
 // BuildServer builds a *frontend.Server using the given configuration.
@@ -68,7 +173,9 @@ func BuildServer(ctx context.Context, serverCfg ServerConfig) (*frontend.Server,
 // list used to construct it. This is used by both BuildServer and
 // GenerateStaticSite.
 func buildServerAndGetters(ctx context.Context, serverCfg ServerConfig) (*buildResult, error) {
-	if len(serverCfg.Paths) == 0 && !serverCfg.UseCache && serverCfg.Proxy == nil {
+	// A run whose modules are all frozen, such as the last one of a batch,
+	// documents no other.
+	if len(serverCfg.Paths) == 0 && !serverCfg.UseCache && serverCfg.Proxy == nil && len(serverCfg.RemoteModules) == 0 && len(serverCfg.ModuleZips) == 0 && len(serverCfg.CachedModules) == 0 && serverCfg.Workspace == "" && !serverCfg.Stdlib && serverCfg.frozen == nil {
 		serverCfg.Paths = []string{"."}
 	}
 
@@ -76,23 +183,96 @@ func buildServerAndGetters(ctx context.Context, serverCfg ServerConfig) (*buildR
 		all:        serverCfg.UseListedMods,
 		proxy:      serverCfg.Proxy,
 		goRepoPath: serverCfg.GoRepoPath,
+		env:        map[string][]string{},
+	}
+
+	// The modules under Paths are served as if they were in Paths.
+	if serverCfg.DiscoverModules {
+		if serverCfg.GOPATHMode {
+			return nil, errors.New("modules cannot be discovered in GOPATH mode")
+		}
+		dirs, err := discoverModules(serverCfg.Paths)
+		if err != nil {
+			return nil, err
+		}
+		env := append(os.Environ(), "GOWORK=off")
+		for _, dir := range dirs {
+			cfg.env[dir] = env
+		}
+		serverCfg.Paths = dirs
+	}
+
+	// The modules of a workspace are listed and loaded from its root.
+	if serverCfg.Workspace != "" {
+		if serverCfg.GOPATHMode {
+			return nil, errors.New("a workspace cannot be used in GOPATH mode")
+		}
+		ws, err := loadWorkspace(serverCfg.Workspace)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range ws.warnings {
+			fmt.Fprintf(serverCfg.logOutput(), "Warning: %s\n", w)
+		}
+		env, cleanup, err := ws.goEnv()
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		if env != nil {
+			cfg.env[ws.root] = env
+		}
+		serverCfg.Paths = append(slices.Clip(serverCfg.Paths), ws.root)
 	}
 
 	// By default, the requested Paths are interpreted as directories. However,
 	// if -gopath_mode is set, they are interpreted as relative Paths to modules
 	// in a GOPATH directory.
+	var mismatches []modulePathMismatch
 	if serverCfg.GOPATHMode {
 		var err error
-		cfg.dirs, err = getGOPATHModuleDirs(ctx, serverCfg.Paths)
+		cfg.dirs, mismatches, err = getGOPATHModuleDirs(ctx, serverCfg.Paths)
 		if err != nil {
 			return nil, fmt.Errorf("searching GOPATH: %v", err)
 		}
 	} else {
 		var err error
-		cfg.dirs, err = getModuleDirs(ctx, serverCfg.Paths, serverCfg.GoRepoPath, serverCfg.GoDocMode)
+		cfg.dirs, err = getModuleDirs(ctx, serverCfg.Paths, cfg.env, serverCfg.GoRepoPath, serverCfg.GoDocMode)
 		if err != nil {
 			return nil, fmt.Errorf("searching modules: %v", err)
 		}
+
+		// The modules that the local modules replace are documented too.
+		repl, err := findReplacements(cfg.dirs, serverCfg.RemoteModules, serverCfg.Proxy != nil)
+		if err != nil {
+			return nil, fmt.Errorf("reading replace directives: %v", err)
+		}
+		for _, w := range repl.warnings {
+			fmt.Fprintf(serverCfg.logOutput(), "Warning: %s\n", w)
+		}
+		env := append(os.Environ(), "GOWORK=off")
+		for _, dir := range repl.dirs {
+			cfg.env[dir] = env
+		}
+		cfg.replacements, err = getModuleDirs(ctx, repl.dirs, cfg.env, serverCfg.GoRepoPath, true)
+		if err != nil {
+			return nil, fmt.Errorf("searching replacement modules: %v", err)
+		}
+		serverCfg.RemoteModules = append(slices.Clip(serverCfg.RemoteModules), repl.remote...)
+	}
+
+	// Frozen modules are not loaded, wherever they come from.
+	if serverCfg.frozen != nil {
+		cfg.dirs = withoutFrozen(cfg.dirs, serverCfg.frozen)
+		cfg.replacements = withoutFrozen(cfg.replacements, serverCfg.frozen)
+		isFrozen := func(mv ModuleVersion) bool { return serverCfg.frozen[mv.Path] != nil }
+		serverCfg.RemoteModules = slices.DeleteFunc(slices.Clone(serverCfg.RemoteModules), isFrozen)
+		serverCfg.ModuleVersions = slices.DeleteFunc(slices.Clone(serverCfg.ModuleVersions), isFrozen)
+		serverCfg.ModuleZips = slices.DeleteFunc(slices.Clone(serverCfg.ModuleZips), isFrozen)
+		serverCfg.CachedModules = slices.DeleteFunc(slices.Clone(serverCfg.CachedModules), isFrozen)
+		if serverCfg.frozen[stdlib.ModulePath] != nil {
+			serverCfg.Stdlib = false
+		}
 	}
 
 	if serverCfg.UseCache {
@@ -112,6 +292,18 @@ func buildServerAndGetters(ctx context.Context, serverCfg ServerConfig) (*buildR
 	if serverCfg.UseLocalStdlib {
 		cfg.useLocalStdlib = true
 	}
+	// The standard library is documented from a local Go tree only.
+	var goroot string
+	if serverCfg.Stdlib {
+		var err error
+		goroot, err = stdlibRoot(serverCfg)
+		if err != nil {
+			return nil, err
+		}
+		cfg.useLocalStdlib = true
+		cfg.requireLocalStdlib = true
+		cfg.goRepoPath = goroot
+	}
 
 	getters, err := buildGetters(ctx, cfg)
 	if err != nil {
@@ -121,27 +313,119 @@ func buildServerAndGetters(ctx context.Context, serverCfg ServerConfig) (*buildR
 	// Collect unique module Paths served by this server.
 	seenModules := make(map[frontend.LocalModule]bool)
 	var allModules []frontend.LocalModule
-	for _, modules := range cfg.dirs {
-		for _, m := range modules {
-			if seenModules[m] {
-				continue
+	for _, dirs := range []map[string][]frontend.LocalModule{cfg.replacements, cfg.dirs} {
+		for _, modules := range dirs {
+			for _, m := range modules {
+				if seenModules[m] {
+					continue
+				}
+				seenModules[m] = true
+				allModules = append(allModules, m)
+			}
+		}
+	}
+
+	if serverCfg.Stdlib && !seenModules[frontend.LocalModule{ModulePath: stdlib.ModulePath, Dir: filepath.Join(goroot, "src")}] {
+		allModules = append(allModules, frontend.LocalModule{ModulePath: stdlib.ModulePath, Dir: filepath.Join(goroot, "src")})
+	}
+
+	// The module versions, the remote modules, the modules of zips and the
+	// cached modules are served before the local modules, which serve any
+	// version. A module with versions only is served at its latest
+	// version, and the others at their own.
+	local := map[string]bool{}
+	for _, m := range allModules {
+		local[m.ModulePath] = true
+	}
+	versions, versionMismatches, err := newVersionGetters(serverCfg.ModuleVersions, local)
+	if err != nil {
+		return nil, err
+	}
+	// The paths that go.mod files declare win over the configured ones.
+	renamed, err := checkModulePaths(append(mismatches, versionMismatches...), serverCfg.strict, serverCfg.logOutput())
+	if err != nil {
+		return nil, err
+	}
+	versioned := map[string]bool{}
+	for _, g := range versions {
+		versioned[g.modulePath] = true
+	}
+	remotes, err := newRemoteGetters(serverCfg.RemoteModules, local, versioned)
+	if err != nil {
+		return nil, err
+	}
+	remote := map[string]bool{}
+	for _, g := range remotes {
+		remote[g.modulePath] = true
+	}
+	zips, err := newZipGetters(serverCfg.ModuleZips, local, versioned, remote)
+	if err != nil {
+		return nil, err
+	}
+	var cached []*versionGetter
+	if len(serverCfg.CachedModules) > 0 {
+		cacheDir := serverCfg.CacheDir
+		if cacheDir == "" {
+			cacheDir, err = defaultCacheDir()
+			if err != nil {
+				return nil, err
 			}
-			seenModules[m] = true
-			allModules = append(allModules, m)
+			if cacheDir == "" {
+				return nil, fmt.Errorf("empty value for GOMODCACHE")
+			}
+		}
+		zipped := map[string]bool{}
+		for _, g := range zips {
+			zipped[g.modulePath] = true
+		}
+		cached, err = newCachedGetters(serverCfg.CachedModules, cacheDir, local, versioned, remote, zipped)
+		if err != nil {
+			return nil, err
+		}
+	}
+	served := slices.Concat(versions, remotes, zips, cached)
+	for i := len(served) - 1; i >= 0; i-- {
+		g := served[i]
+		getters = append([]fetch.ModuleGetter{g}, getters...)
+		if g.latest {
+			allModules = append(allModules, frontend.LocalModule{ModulePath: g.modulePath, Dir: g.dir})
 		}
 	}
 	sort.Slice(allModules, func(i, j int) bool {
 		return allModules[i].ModulePath < allModules[j].ModulePath
 	})
 
-	server, err := newServer(getters, allModules, cfg.proxy, serverCfg.GoDocMode, serverCfg.DevMode, serverCfg.DevModeStaticDir)
+	pres, err := newPresentation(serverCfg)
+	if err != nil {
+		return nil, err
+	}
+	rd, err := newRedactor(serverCfg.Redactions)
+	if err != nil {
+		return nil, err
+	}
+	hd, err := newHider(serverCfg.HiddenSymbols)
+	if err != nil {
+		return nil, err
+	}
+	loadOpts := hd.loadOptions(rd.loadOptions(serverCfg.ConstrainedPackages.loadOptions()))
+	loadOpts.ReadmeNames = serverCfg.ReadmeNames
+	server, lds, err := newServer(getters, allModules, frozenLocalModules(serverCfg.frozen), cfg.proxy, serverCfg.GoDocMode, serverCfg.DevMode, serverCfg.DevModeStaticDir, pres, loadOpts)
 	if err != nil {
 		return nil, err
 	}
+	if len(versions) > 0 {
+		lds.SetVersions(versionInfos(versions, local))
+	}
 	return &buildResult{
-		Server:     server,
-		Getters:    getters,
-		AllModules: allModules,
+		Server:      server,
+		DataSource:  lds,
+		Getters:     getters,
+		Versions:    versions,
+		AllModules:  allModules,
+		LoadOptions: loadOpts,
+		Redactor:    rd,
+		Hider:       hd,
+		Renamed:     renamed,
 	}, nil
 }
 
@@ -149,11 +433,12 @@ func buildServerAndGetters(ctx context.Context, serverCfg ServerConfig) (*buildR
 // determined by running go list -m.
 //
 // An error is returned if any operations failed unexpectedly, or if no
-// requested directories contain any valid modules.
-func getModuleDirs(ctx context.Context, dirs []string, goRepoPath string, allowNoModules bool) (map[string][]frontend.LocalModule, error) {
+// requested directories contain any valid modules. The go command is run
+// with the environment env holds for a directory, if it has one.
+func getModuleDirs(ctx context.Context, dirs []string, env map[string][]string, goRepoPath string, allowNoModules bool) (map[string][]frontend.LocalModule, error) {
 	dirModules := make(map[string][]frontend.LocalModule)
 	for _, dir := range dirs {
-		output, err := runGo(dir, "list", "-m", "-json")
+		output, err := runGoEnv(dir, env[dir], "list", "-m", "-json")
 		if err != nil {
 			return nil, fmt.Errorf("listing modules in %s: %v", dir, err)
 		}
@@ -189,15 +474,17 @@ func getModuleDirs(ctx context.Context, dirs []string, goRepoPath string, allowN
 //
 // An error is returned if any operations failed unexpectedly, or if no modules
 // were resolved. If individual module Paths are not found, an error is logged
-// and the path skipped.
-func getGOPATHModuleDirs(ctx context.Context, modulePaths []string) (map[string][]frontend.LocalModule, error) {
+// and the path skipped. The modules whose go.mod files declare another path
+// have that path, and are returned as mismatches too.
+func getGOPATHModuleDirs(ctx context.Context, modulePaths []string) (map[string][]frontend.LocalModule, []modulePathMismatch, error) {
 	gopath, err := runGo("", "env", "GOPATH")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	gopaths := filepath.SplitList(strings.TrimSpace(string(gopath)))
 
 	dirs := make(map[string][]frontend.LocalModule)
+	var mismatches []modulePathMismatch
 	for _, path := range modulePaths {
 		dir := ""
 		for _, gopath := range gopaths {
@@ -208,57 +495,70 @@ func getGOPATHModuleDirs(ctx context.Context, modulePaths []string) (map[string]
 				break
 			}
 			if err != nil && !os.IsNotExist(err) {
-				return nil, err
+				return nil, nil, err
 			}
 		}
 		if dir == "" {
 			log.Errorf(ctx, "ERROR: no GOPATH directory contains %q", path)
-		} else {
-			dirs[dir] = []frontend.LocalModule{{ModulePath: path, Dir: dir}}
+			continue
 		}
+		// The module is the one its go.mod file declares, if it has one.
+		declared, mismatch, err := declaredModulePath(path, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if mismatch != nil {
+			mismatches = append(mismatches, *mismatch)
+		}
+		dirs[dir] = []frontend.LocalModule{{ModulePath: declared, Dir: dir}}
 	}
 
 	if len(modulePaths) > 0 && len(dirs) == 0 {
-		return nil, fmt.Errorf("no GOPATH directories contain any of the requested module(s)")
+		return nil, nil, fmt.Errorf("no GOPATH directories contain any of the requested module(s)")
 	}
-	return dirs, nil
+	return dirs, mismatches, nil
 }
 
 // getterConfig defines the set of getters for the server to use.
 // See buildGetters.
 type getterConfig struct {
-	all            bool                              // if set, request "all" instead of ["<modulePath>/..."]
-	dirs           map[string][]frontend.LocalModule // local modules to serve
-	modCacheDir    string                            // path to module cache, or ""
-	proxy          *proxy.Client                     // proxy client, or nil
-	useLocalStdlib bool                              // use go/packages for the local stdlib
-	goRepoPath     string                            // repo path for local stdlib
+	all                bool                              // if set, request "all" instead of ["<modulePath>/..."]
+	dirs               map[string][]frontend.LocalModule // local modules to serve
+	replacements       map[string][]frontend.LocalModule // local modules replacing dependencies of dirs, served first
+	modCacheDir        string                            // path to module cache, or ""
+	proxy              *proxy.Client                     // proxy client, or nil
+	useLocalStdlib     bool                              // use go/packages for the local stdlib
+	requireLocalStdlib bool                              // fail if the local stdlib cannot be loaded
+	goRepoPath         string                            // repo path for local stdlib
+	env                map[string][]string               // environment of the go command in some dirs, if not the process's
 }
 
 // buildGetters constructs module getters based on the given configuration.
 //
 // Getters are returned in the following priority order:
-//  1. local getters for cfg.dirs, in the given order
+//  1. local getters for cfg.replacements, then for cfg.dirs, in the given order
 //  2. a module cache getter, if cfg.modCacheDir != ""
 //  3. a proxy getter, if cfg.proxy != nil
 func buildGetters(ctx context.Context, cfg getterConfig) ([]fetch.ModuleGetter, error) {
 	var getters []fetch.ModuleGetter
 
 	// Load local getters for each directory.
-	for dir, modules := range cfg.dirs {
-		var patterns []string
-		if cfg.all {
-			patterns = append(patterns, "all")
-		} else {
-			for _, m := range modules {
-				patterns = append(patterns, fmt.Sprintf("%s/...", m))
+	for _, dirs := range []map[string][]frontend.LocalModule{cfg.replacements, cfg.dirs} {
+		for dir, modules := range dirs {
+			var patterns []string
+			if cfg.all {
+				patterns = append(patterns, "all")
+			} else {
+				for _, m := range modules {
+					patterns = append(patterns, m.ModulePath+"/...")
+				}
+			}
+			mg, err := fetch.NewGoPackagesModuleGetterWithEnv(ctx, dir, cfg.env[dir], patterns...)
+			if err != nil {
+				log.Errorf(ctx, "Loading packages from %s: %v", dir, err)
+			} else {
+				getters = append(getters, mg)
 			}
-		}
-		mg, err := fetch.NewGoPackagesModuleGetter(ctx, dir, patterns...)
-		if err != nil {
-			log.Errorf(ctx, "Loading packages from %s: %v", dir, err)
-		} else {
-			getters = append(getters, mg)
 		}
 	}
 	if len(getters) == 0 && len(cfg.dirs) > 0 {
@@ -282,6 +582,9 @@ func buildGetters(ctx context.Context, cfg getterConfig) ([]fetch.ModuleGetter,
 		}
 		if goRepo != "" { // if goRepo == "" we didn't get a *goRepoPath and couldn't find GOROOT. Fall back to the zip files.
 			mg, err := fetch.NewGoPackagesStdlibModuleGetter(ctx, goRepo)
+			if err != nil && cfg.requireLocalStdlib {
+				return nil, fmt.Errorf("loading packages from stdlib: %v", err)
+			}
 			if err != nil {
 				log.Errorf(ctx, "loading packages from stdlib: %v", err)
 			} else {
@@ -303,11 +606,100 @@ func buildGetters(ctx context.Context, cfg getterConfig) ([]fetch.ModuleGetter,
 	return getters, nil
 }
 
-func newServer(getters []fetch.ModuleGetter, localModules []frontend.LocalModule, prox *proxy.Client, goDocMode bool, devMode bool, staticFlag string) (*frontend.Server, error) {
+// presentation holds the settings that affect how pages look rather than
+// which modules are served.
+type presentation struct {
+	templateOverrides   []template.TrustedFS
+	site                pagepkg.SiteData
+	build               pagepkg.BuildData
+	readmeOptions       *frontend.ReadmeOptions
+	symbolIndexPageSize int // symbols on a page of a symbol index; zero if there is none
+	glanceThreshold     int // see ServerConfig.GlanceThreshold
+}
+
+// newPresentation validates the presentation settings in serverCfg.
+func newPresentation(serverCfg ServerConfig) (presentation, error) {
+	site, err := siteData(serverCfg.SiteName, serverCfg.SiteURL, serverCfg.basePath)
+	if err != nil {
+		return presentation{}, err
+	}
+	p := presentation{
+		site:            site,
+		build:           pagepkg.BuildData{GeneratorVersion: generatorVersion(), Time: serverCfg.buildTime},
+		readmeOptions:   serverCfg.ReadmeOptions,
+		glanceThreshold: serverCfg.GlanceThreshold,
+	}
+	if p.build.Time.IsZero() {
+		p.build.Time = time.Now()
+	}
+	if serverCfg.SymbolIndex {
+		p.symbolIndexPageSize = symbolIndexPageSize(serverCfg)
+	}
+	if dir := serverCfg.TemplateOverrideDir; dir != "" {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return presentation{}, err
+		}
+		if len(matches) == 0 {
+			return presentation{}, fmt.Errorf("template override directory %s contains no *.tmpl files", dir)
+		}
+		// The directory is named by the person running the program, so it is
+		// as trusted as a command-line flag.
+		ts := template.TrustedSourceFromFlag(dirValue(dir))
+		p.templateOverrides = []template.TrustedFS{template.TrustedFSFromTrustedSource(ts)}
+	}
+	return p, nil
+}
+
+// siteData returns the site data for the given name and site URL. The base
+// path is the path component of siteURL, or basePath, which must be as
+// cleanBasePath returns it, if siteURL is empty.
+func siteData(name, siteURL, basePath string) (pagepkg.SiteData, error) {
+	sd := pagepkg.SiteData{Name: name, URL: siteURL, BasePath: "/"}
+	if siteURL == "" {
+		if basePath != "" {
+			sd.BasePath = basePath
+		}
+		return sd, nil
+	}
+	u, err := url.Parse(siteURL)
+	if err != nil {
+		return sd, fmt.Errorf("invalid site URL: %v", err)
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return sd, fmt.Errorf("site URL %q is not an absolute URL", siteURL)
+	}
+	sd.BasePath = "/" + strings.Trim(u.Path, "/") + "/"
+	if sd.BasePath == "//" {
+		sd.BasePath = "/"
+	}
+	return sd, nil
+}
+
+// generatorVersion returns the module version of the running binary.
+func generatorVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// dirValue is a flag.Value holding a directory name.
+type dirValue string
+
+func (d dirValue) String() string   { return string(d) }
+func (d dirValue) Set(string) error { return errors.New("dirValue is read-only") }
+
+// httpClient is the client with which unit pages look up their module on
+// deps.dev and codewiki.google, replaced by tests.
+var httpClient = http.DefaultClient
+
+func newServer(getters []fetch.ModuleGetter, localModules, frozenModules []frontend.LocalModule, prox *proxy.Client, goDocMode bool, devMode bool, staticFlag string, pres presentation, loadOpts fetch.LoadOptions) (*frontend.Server, *fetchdatasource.FetchDataSource, error) {
 	lds := fetchdatasource.Options{
 		Getters:              getters,
 		ProxyClientForLatest: prox,
 		BypassLicenseCheck:   true,
+		LoadOptions:          loadOpts,
 	}.New()
 
 	// In dev mode, use a dirFS to pick up template/JS/CSS changes without
@@ -325,26 +717,43 @@ func newServer(getters []fetch.ModuleGetter, localModules []frontend.LocalModule
 	}
 	go lds.GetUnitMeta(context.Background(), "", "std", "latest")
 
+	// Frozen modules are listed on the homepage, but not loaded.
+	listed := localModules
+	if len(frozenModules) > 0 {
+		listed = slices.Concat(localModules, frozenModules)
+		sort.Slice(listed, func(i, j int) bool { return listed[i].ModulePath < listed[j].ModulePath })
+	}
+
 	server, err := frontend.NewServer(frontend.ServerConfig{
-		DataSourceGetter: func(context.Context) internal.DataSource { return lds },
-		TemplateFS:       template.TrustedFSFromEmbed(static.FS),
-		StaticFS:         staticFS,
-		DevMode:          devMode,
-		GoDocMode:        goDocMode,
-		LocalMode:        true,
-		LocalModules:     localModules,
-		ThirdPartyFS:     thirdparty.FS,
+		DataSourceGetter:    func(context.Context) internal.DataSource { return lds },
+		TemplateFS:          template.TrustedFSFromEmbed(static.FS),
+		TemplateOverrides:   pres.templateOverrides,
+		StaticFS:            staticFS,
+		DevMode:             devMode,
+		GoDocMode:           goDocMode,
+		LocalMode:           true,
+		LocalModules:        listed,
+		ThirdPartyFS:        thirdparty.FS,
+		Site:                pres.site,
+		Build:               pres.build,
+		ReadmeOptions:       pres.readmeOptions,
+		SymbolIndexPageSize: pres.symbolIndexPageSize,
+		GlanceThreshold:     pres.glanceThreshold,
+		HTTPClient:          httpClient,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	// The getters of remote modules share the module cache.
+	installed := map[string]bool{}
 	for _, g := range getters {
 		p, fsys := g.SourceFS()
-		if p != "" {
+		if p != "" && !installed[p] {
+			installed[p] = true
 			server.InstallFS(p, fsys)
 		}
 	}
-	return server, nil
+	return server, lds, nil
 }
 
 func defaultCacheDir() (string, error) {
@@ -356,8 +765,15 @@ func defaultCacheDir() (string, error) {
 }
 
 func runGo(dir string, args ...string) ([]byte, error) {
+	return runGoEnv(dir, nil, args...)
+}
+
+// runGoEnv is like runGo, but runs the go command with the environment
+// env, if it is not nil.
+func runGoEnv(dir string, env []string, args ...string) ([]byte, error) {
 	cmd := exec.Command("go", args...)
 	cmd.Dir = dir
+	cmd.Env = env
 	out, err := cmd.Output()
 	if err != nil {
 		if ee, ok := err.(*exec.ExitError); ok {
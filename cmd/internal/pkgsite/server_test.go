@@ -11,10 +11,13 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 
 	"golang.org/x/net/html"
+	pagepkg "github.com/wow-look-at-my/static-pkgsite/internal/frontend/page"
 	"github.com/wow-look-at-my/static-pkgsite/internal/proxy/proxytest"
 	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
 	"github.com/wow-look-at-my/static-pkgsite/internal/testing/htmlcheck"
@@ -221,6 +224,101 @@ package a
 	}
 }
 
+// overrideTemplate uses every field of the template data that is promised
+// to custom template overrides. Removing or renaming one of those fields
+// makes TestTemplateOverrides fail.
+const overrideTemplate = `{{define "pre-content"}}<div class="Override">` +
+	`{{.Site.Name}}|{{.Site.URL}}|{{.Site.BasePath}}|` +
+	`{{.Build.GeneratorVersion}}|{{.Build.Time.Year}}|` +
+	`{{.Page.UnitPath}}|{{.Page.ModulePath}}|{{.Page.Version}}|{{.Page.Synopsis}}` +
+	`</div>{{end}}`
+
+func TestTemplateOverrides(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go") // for local modules
+
+	// Every exported field must be exercised by overrideTemplate.
+	for _, v := range []any{pagepkg.SiteData{}, pagepkg.BuildData{}, pagepkg.PageData{}} {
+		typ := reflect.TypeOf(v)
+		for i := 0; i < typ.NumField(); i++ {
+			ref := "." + strings.TrimSuffix(typ.Name(), "Data") + "." + typ.Field(i).Name
+			if !strings.Contains(overrideTemplate, ref) {
+				t.Errorf("overrideTemplate does not use %s", ref)
+			}
+		}
+	}
+
+	localModule, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/testmod
+-- a.go --
+// Package a is a test package.
+package a
+`)
+	overrideDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(overrideDir, "override.tmpl"), []byte(overrideTemplate), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server, err := BuildServer(context.Background(), ServerConfig{
+		Paths:               []string{localModule},
+		UseListedMods:       true,
+		TemplateOverrideDir: overrideDir,
+		SiteName:            "Test Docs",
+		SiteURL:             "https://example.github.io/docs",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	server.Install(mux.Handle, nil, nil)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/example.com/testmod", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	doc, err := html.Parse(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := in(".Override", hasText(regexp.QuoteMeta(
+		"Test Docs|https://example.github.io/docs|/docs/|(devel)|")+
+		`\d{4}`+regexp.QuoteMeta("|example.com/testmod|example.com/testmod|v0.0.0|Package a is a test package.")))
+	if err := want(doc); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTemplateOverridesEmptyDir(t *testing.T) {
+	_, err := newPresentation(ServerConfig{TemplateOverrideDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "no *.tmpl files") {
+		t.Errorf("got error %v, want one mentioning missing *.tmpl files", err)
+	}
+}
+
+func TestSiteData(t *testing.T) {
+	for _, test := range []struct {
+		url, wantBase string
+		wantErr       bool
+	}{
+		{"", "/", false},
+		{"https://docs.example.com", "/", false},
+		{"https://docs.example.com/", "/", false},
+		{"https://example.github.io/repo", "/repo/", false},
+		{"https://example.github.io/a/b/", "/a/b/", false},
+		{"/relative", "", true},
+		{"://bad", "", true},
+	} {
+		got, err := siteData("", test.url, "")
+		if (err != nil) != test.wantErr {
+			t.Errorf("siteData(%q): got error %v, want error %t", test.url, err, test.wantErr)
+			continue
+		}
+		if err == nil && got.BasePath != test.wantBase {
+			t.Errorf("siteData(%q).BasePath = %q, want %q", test.url, got.BasePath, test.wantBase)
+		}
+	}
+}
+
 func sourceLinks(dir, filename string) htmlcheck.Checker {
 	filesPath := path.Join("/files", dir) + "/"
 	return in("",
@@ -0,0 +1,252 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The page of one unit can be written as a single self-contained HTML
+// file, for sharing the documentation of a package in a code review or an
+// email, with GenerateSingleFile. The page is rendered by renderAndWrite,
+// as those of a static site are, with a transform that inlines what the
+// page loads: its style sheets become <style> elements, with the images
+// they refer to as data: URLs; its scripts, and those it loads with
+// loadScript, become inline scripts, with the images they name as data:
+// URLs; and its images smaller than
+// GenerateOptions.InlineSmallImages, or singleFileImageLimit if it is not
+// set, become data: URLs. The Content-Security-Policy of the pages allows all
+// three. The larger images, and the links to the other pages of the site,
+// point at it under ServerConfig.SiteURL, if it is set; otherwise they are
+// relative, as in the site, and lead nowhere from the file.
+
+// singleFileImageLimit is the size in bytes of the smallest image that a
+// single file does not inline, by default.
+const singleFileImageLimit = 64 << 10
+
+// loadScriptRE matches the calls of the pages to their loadScript function,
+// with the site path of the script and whether it is a module.
+var loadScriptRE = regexp.MustCompile(`loadScript\(\s*(?:'(/[^']*)'|"(/[^"]*)")\s*(?:,\s*(true|false)\s*)?\)`)
+
+// scriptImageRE matches the string literals of scripts holding the site
+// paths of images, such as "/static/shared/icon/x.svg".
+var scriptImageRE = regexp.MustCompile("([\"'`])(/(?:static|third_party)/[\\w./-]+\\.(?:gif|ico|jpe?g|png|svg|webp))([\"'`])")
+
+// GenerateSingleFile writes the page of the unit at unitPath, such as
+// example.com/m/pkg, to file as a self-contained HTML file, which shows
+// the page styled when opened from a file system, without network access.
+// Of the settings of the static site in opts, only InlineSmallImages
+// applies; StrictCSP, which forbids inline scripts and styles, cannot be
+// set.
+func GenerateSingleFile(ctx context.Context, serverCfg ServerConfig, opts GenerateOptions, unitPath, file string) error {
+	if opts.StrictCSP {
+		return errors.New("a single file needs inline scripts and style sheets, which StrictCSP forbids")
+	}
+	unitPath = strings.Trim(unitPath, "/")
+	if unitPath == "" {
+		return errors.New("no unit for the single file")
+	}
+	result, err := buildServerAndGetters(ctx, serverCfg)
+	if err != nil {
+		return fmt.Errorf("building server: %w", err)
+	}
+	mux := http.NewServeMux()
+	result.Server.Install(mux.Handle, nil, nil)
+
+	// The page is written to a temporary directory first, as renderAndWrite
+	// writes pages to their paths in the site.
+	dir, err := os.MkdirTemp("", "pkgsite-single-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	out, err := newSiteOutput(dir, true, false)
+	if err != nil {
+		return err
+	}
+	limit := opts.InlineSmallImages
+	if limit <= 0 {
+		limit = singleFileImageLimit
+	}
+	var pages pageList
+	inline := singleFileTransform(newImageInliner(mux, limit), mux, serverCfg.SiteURL)
+	if err := renderAndWrite(mux, "/"+unitPath, out, pageConsumers{&pages}, inline); err != nil {
+		return fmt.Errorf("rendering %s: %w", unitPath, err)
+	}
+	if len(pages) == 0 {
+		return fmt.Errorf("rendering %s: no page", unitPath)
+	}
+	// A redirect, as for a path in another case, leads to the first page.
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(pages[0].File)))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(serverCfg.logOutput(), "Page of %s written to %s (%d bytes)\n", unitPath, file, len(data))
+	return nil
+}
+
+// singleFileTransform returns the page transform inlining the style
+// sheets, scripts and small images of a page, which mux serves, with the
+// image inliner in. The other paths of the site are made absolute URLs
+// under siteURL, if it is set.
+func singleFileTransform(in *imageInliner, mux http.Handler, siteURL string) pageTransform {
+	load := func(p string) ([]byte, bool) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/"+p, nil))
+		return w.Body.Bytes(), w.Code == http.StatusOK
+	}
+	// inlineCSS returns the style sheet css at the site path p with the
+	// images it refers to as data: URLs.
+	inlineCSS := func(p string, css []byte) []byte {
+		return cssURLRE.ReplaceAllFunc(css, func(m []byte) []byte {
+			sm := cssURLRE.FindSubmatch(m)
+			ref := string(sm[1]) + string(sm[2]) + string(sm[3])
+			if !isLocalReference(ref) {
+				return m
+			}
+			if u := in.dataURL("/" + refTarget(p, ref)); u != "" {
+				return []byte(`url("` + u + `")`)
+			}
+			if siteURL != "" {
+				return []byte(`url("` + strings.TrimSuffix(siteURL, "/") + "/" + refTarget(p, ref) + `")`)
+			}
+			return m
+		})
+	}
+	// inlineScript returns the script js with the images it names as
+	// data: URLs.
+	inlineScript := func(js []byte) []byte {
+		return scriptImageRE.ReplaceAllFunc(js, func(m []byte) []byte {
+			sm := scriptImageRE.FindSubmatch(m)
+			if u := in.dataURL(string(sm[2])); u != "" {
+				return slices.Concat(sm[1], []byte(u), sm[3])
+			}
+			return m
+		})
+	}
+	// sitePath returns the site path of the URL u of the page, and whether
+	// it is a path from the root of the host.
+	sitePath := func(u string) (string, bool) {
+		if !strings.HasPrefix(u, "/") || strings.HasPrefix(u, "//") {
+			return "", false
+		}
+		return refTarget("", cleanURLPath(u)), true
+	}
+	text := func(data []byte, end string) *html.Node {
+		// The contents of a raw text element end at its end tag.
+		s := strings.ReplaceAll(string(data), "</"+end, `<\/`+end)
+		return &html.Node{Type: html.TextNode, Data: s}
+	}
+
+	return func(doc *html.Node, _ *headManager) {
+		var elems []*html.Node
+		walkElements(doc, func(n *html.Node) {
+			if n.Namespace == "" {
+				elems = append(elems, n)
+			}
+		})
+		for _, n := range elems {
+			switch n.Data {
+			case "link":
+				p, ok := sitePath(attrValue(n, "href"))
+				if !ok {
+					continue
+				}
+				switch rel := strings.ToLower(attrValue(n, "rel")); {
+				case rel == "stylesheet":
+					css, ok := load(p)
+					if !ok {
+						continue
+					}
+					style := &html.Node{Type: html.ElementNode, Data: "style"}
+					if media := attrValue(n, "media"); media != "" {
+						style.Attr = []html.Attribute{{Key: "media", Val: media}}
+					}
+					style.AppendChild(text(inlineCSS(p, css), "style"))
+					n.Parent.InsertBefore(style, n)
+					n.Parent.RemoveChild(n)
+				case strings.Contains(rel, "icon"):
+					if u := in.dataURL("/" + p); u != "" {
+						setAttr(n, "href", u)
+					}
+				case rel == "preload" || rel == "modulepreload" || rel == "prefetch":
+					n.Parent.RemoveChild(n)
+				}
+			case "style":
+				if c := n.FirstChild; c != nil && c.Type == html.TextNode {
+					c.Data = text(inlineCSS("", []byte(c.Data)), "style").Data
+				}
+			case "img":
+				if p, ok := sitePath(attrValue(n, "src")); ok {
+					if u := in.dataURL("/" + p); u != "" {
+						setAttr(n, "src", u)
+					}
+				}
+			case "script":
+				if p, ok := sitePath(attrValue(n, "src")); ok {
+					if js, ok := load(p); ok {
+						n.Attr = slices.DeleteFunc(n.Attr, func(a html.Attribute) bool {
+							return slices.Contains([]string{"src", "integrity", "crossorigin", "async", "defer"}, a.Key)
+						})
+						n.AppendChild(text(inlineScript(js), "script"))
+					}
+					continue
+				}
+				c := n.FirstChild
+				if c == nil || c.Type != html.TextNode {
+					continue
+				}
+				// The scripts that the script loads follow it, in order.
+				c.Data = string(inlineScript([]byte(c.Data)))
+				after := n
+				c.Data = loadScriptRE.ReplaceAllStringFunc(c.Data, func(m string) string {
+					sm := loadScriptRE.FindStringSubmatch(m)
+					p, _ := sitePath(sm[1] + sm[2])
+					js, ok := load(p)
+					if !ok {
+						return m
+					}
+					script := &html.Node{Type: html.ElementNode, Data: "script"}
+					if sm[3] != "false" {
+						script.Attr = []html.Attribute{{Key: "type", Val: "module"}}
+					}
+					script.AppendChild(text(inlineScript(js), "script"))
+					n.Parent.InsertBefore(script, after.NextSibling)
+					after = script
+					return ""
+				})
+			}
+		}
+		if siteURL == "" {
+			return
+		}
+		walkElements(doc, func(n *html.Node) {
+			for i, a := range n.Attr {
+				if r, ok := urlAttrRule(n, a); ok {
+					n.Attr[i].Val = mapURLs(r, a.Val, func(u string) string {
+						if _, ok := sitePath(u); !ok {
+							return u
+						}
+						return strings.TrimSuffix(siteURL, "/") + cleanURLPath(u)
+					})
+				}
+			}
+		})
+	}
+}
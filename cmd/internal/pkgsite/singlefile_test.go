@@ -0,0 +1,171 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	"golang.org/x/net/html"
+)
+
+func TestSingleFileTransform(t *testing.T) {
+	files := map[string]string{
+		"/static/a.css":     "p { background: url(img/i.svg) } div { background: url('/static/big.svg') }",
+		"/static/img/i.svg": `<svg xmlns="http://www.w3.org/2000/svg"/>`,
+		"/static/big.svg":   `<svg xmlns="http://www.w3.org/2000/svg">` + strings.Repeat(" ", 200) + `</svg>`,
+		"/static/x.js":      `x("</script>")`,
+		"/static/m.js":      "m()",
+		"/static/c.js":      "c()",
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /static/", func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(data))
+	})
+	page := `<html><head>
+<link rel="stylesheet" href="/static/a.css?version=1">
+<link rel="stylesheet" href="/static/missing.css">
+<link rel="icon" href="/static/img/i.svg">
+<script>function loadScript(src, mod = true) {} loadScript("/static/x.js", false); loadScript('/static/m.js')</script>
+<script src="/static/c.js" defer></script>
+</head><body>
+<img src="/static/img/i.svg"><img src="/static/big.svg">
+<a href="/example.com/other#x">other</a><a href="#y">here</a><a href="https://example.org/">out</a>
+</body></html>`
+	transform := singleFileTransform(newImageInliner(mux, 100), mux, "https://pkg.example.com/docs/")
+	got, err := processHTML([]byte(page), "/example.com/m/pkg", nil, transform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := html.Parse(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		styles, scripts, imgs, links []string
+		stylesheets                  int
+	)
+	walkElements(doc, func(n *html.Node) {
+		switch n.Data {
+		case "style":
+			styles = append(styles, n.FirstChild.Data)
+		case "script":
+			s := attrValue(n, "type") + ":"
+			if n.FirstChild != nil {
+				s += n.FirstChild.Data
+			}
+			if hasAttr(n, "src") || hasAttr(n, "defer") {
+				t.Errorf("script keeps its src or defer: %v", n.Attr)
+			}
+			scripts = append(scripts, s)
+		case "img":
+			imgs = append(imgs, attrValue(n, "src"))
+		case "a":
+			links = append(links, attrValue(n, "href"))
+		case "link":
+			if attrValue(n, "rel") == "stylesheet" {
+				stylesheets++
+			} else if href := attrValue(n, "href"); !strings.HasPrefix(href, "data:image/svg+xml;") {
+				t.Errorf("icon is %s, want a data: URL", href)
+			}
+		}
+	})
+	if len(styles) != 1 || !strings.Contains(styles[0], `url("data:image/svg+xml;`) || !strings.Contains(styles[0], `url("https://pkg.example.com/docs/static/big.svg")`) {
+		t.Errorf("styles = %q, want the style sheet with the small image inlined and the large one on the site", styles)
+	}
+	if stylesheets != 1 {
+		t.Errorf("%d style sheets left, want the missing one", stylesheets)
+	}
+	want := []string{
+		":function loadScript(src, mod = true) {} ; ",
+		`:x("<\/script>")`,
+		"module:m()",
+		":c()",
+	}
+	if strings.Join(scripts, "\n") != strings.Join(want, "\n") {
+		t.Errorf("scripts =\n%s\nwant\n%s", strings.Join(scripts, "\n"), strings.Join(want, "\n"))
+	}
+	if len(imgs) != 2 || !strings.HasPrefix(imgs[0], "data:image/svg+xml;") || imgs[1] != "https://pkg.example.com/docs/static/big.svg" {
+		t.Errorf("images = %q, want the small one inlined and the large one on the site", imgs)
+	}
+	if want := []string{"https://pkg.example.com/docs/example.com/other#x", "#y", "https://example.org/"}; strings.Join(links, " ") != strings.Join(want, " ") {
+		t.Errorf("links = %q, want %q", links, want)
+	}
+}
+
+func TestGenerateSingleFile(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- pkg/p.go --
+// Package pkg does things.
+package pkg
+
+// F does it.
+func F() {}
+`)
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	file := filepath.Join(t.TempDir(), "pkg.html")
+	if err := GenerateSingleFile(context.Background(), cfg, GenerateOptions{}, "example.com/m/pkg", file); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Package pkg does things.", "func F()", "<style>", "data:image/svg+xml;"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("the file does not contain %q", want)
+		}
+	}
+	// The page loads nothing but what it holds.
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := &pageEvent{File: "pkg.html"}
+	summarizePage(doc, ev)
+	for _, a := range ev.Assets {
+		if !strings.HasPrefix(a, "data:") {
+			t.Errorf("the page loads %s", a)
+		}
+	}
+	if bytes.Contains(data, []byte("loadScript(\"")) || bytes.Contains(data, []byte("loadScript('")) {
+		t.Error("the page still loads scripts")
+	}
+
+	for _, test := range []struct {
+		name string
+		opts GenerateOptions
+		unit string
+		want string
+	}{
+		{"missing", GenerateOptions{}, "example.com/m/nope", "example.com/m/nope"},
+		{"strict CSP", GenerateOptions{StrictCSP: true}, "example.com/m/pkg", "StrictCSP"},
+		{"no unit", GenerateOptions{}, "/", "no unit"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := GenerateSingleFile(context.Background(), cfg, test.opts, test.unit, filepath.Join(t.TempDir(), "x.html"))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+)
+
+// The sitemap lists every HTML page of the site by its absolute URL under
+// the site URL, following https://www.sitemaps.org/protocol.html. A sitemap
+// file can hold at most 50,000 URLs and 50 MB; a larger site gets several
+// sitemap files and a sitemap index naming them.
+
+const (
+	sitemapFile     = "sitemap.xml"
+	sitemapMaxURLs  = 50000
+	sitemapMaxBytes = 50 << 20
+	sitemapXMLNS    = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+// A sitemapEntry is a page listed in the sitemap, or a sitemap file
+// listed in the sitemap index.
+type sitemapEntry struct {
+	loc     string
+	lastMod time.Time // zero if unknown
+}
+
+// marshal returns the XML element named elem for e.
+func (e *sitemapEntry) marshal(elem string) ([]byte, error) {
+	x := struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod,omitempty"`
+	}{Loc: e.loc}
+	if !e.lastMod.IsZero() {
+		x.LastMod = e.lastMod.UTC().Format(time.RFC3339)
+	}
+	var buf bytes.Buffer
+	err := xml.NewEncoder(&buf).EncodeElement(x, xml.StartElement{Name: xml.Name{Local: elem}})
+	return buf.Bytes(), err
+}
+
+// A sitemapWriter is a pageConsumer that writes the sitemap of the HTML
+// pages.
+type sitemapWriter struct {
+	siteURL string               // absolute URL the site is published at
+	lastMod map[string]time.Time // by URL path; missing if unknown
+	entries []*sitemapEntry
+}
+
+func newSitemapWriter(siteURL string, lastMod map[string]time.Time) *sitemapWriter {
+	return &sitemapWriter{siteURL: siteURL, lastMod: lastMod}
+}
+
+func (s *sitemapWriter) consumePage(ev *pageEvent) error {
+	// Tab and source pages are not for search engines, like those of the
+	// frontend, except for the symbol index, and neither are the pages of
+	// versions, whose module paths are followed by their versions.
+	if ev.HTML && ev.Redirect == "" && (ev.Tab == "" || isSymbolIndexTab(ev.Tab)) && !ev.Source && !strings.Contains(ev.URLPath, "@") {
+		s.entries = append(s.entries, &sitemapEntry{
+			loc:     pageURL(s.siteURL, ev.URLPath),
+			lastMod: s.lastMod[ev.URLPath],
+		})
+	}
+	return nil
+}
+
+func (s *sitemapWriter) finish(_ context.Context, out *siteOutput) error {
+	return writeSitemaps(out, s.siteURL, s.entries, sitemapMaxURLs, sitemapMaxBytes)
+}
+
+// pageURL returns the absolute URL of the page at urlPath under siteURL.
+// Pages are directories, so the URL ends in a slash.
+func pageURL(siteURL, urlPath string) string {
+	p := strings.Trim(urlPath, "/")
+	if p != "" {
+		p += "/"
+	}
+	return strings.TrimSuffix(siteURL, "/") + "/" + (&url.URL{Path: p}).EscapedPath()
+}
+
+// writeSitemaps writes the sitemap of entries to out. If the entries fit
+// in one file of maxURLs URLs and maxBytes bytes, it is sitemap.xml;
+// otherwise sitemap.xml is an index of the files sitemap-1.xml,
+// sitemap-2.xml and so on.
+func writeSitemaps(out *siteOutput, siteURL string, entries []*sitemapEntry, maxURLs, maxBytes int) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].loc < entries[j].loc })
+
+	// Remove the numbered files of an earlier, larger site.
+	old, err := filepath.Glob(filepath.Join(out.dir, "sitemap-*.xml"))
+	if err != nil {
+		return err
+	}
+
+	const (
+		urlsetStart = xml.Header + `<urlset xmlns="` + sitemapXMLNS + `">` + "\n"
+		urlsetEnd   = "</urlset>\n"
+	)
+	var (
+		files []*bytes.Buffer
+		index []*sitemapEntry // the files, as entries of the index
+		buf   *bytes.Buffer
+		n     int
+	)
+	for _, e := range entries {
+		line, err := e.marshal("url")
+		if err != nil {
+			return err
+		}
+		if buf == nil || n == maxURLs || buf.Len()+len(line)+1+len(urlsetEnd) > maxBytes {
+			buf = bytes.NewBufferString(urlsetStart)
+			files = append(files, buf)
+			index = append(index, &sitemapEntry{})
+			n = 0
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		n++
+		if last := index[len(index)-1]; e.lastMod.After(last.lastMod) {
+			last.lastMod = e.lastMod
+		}
+	}
+	if len(files) == 0 {
+		files = append(files, bytes.NewBufferString(urlsetStart))
+	}
+	for _, b := range files {
+		b.WriteString(urlsetEnd)
+	}
+	numbered := map[string]bool{}
+	if len(files) > 1 {
+		for i := range files {
+			numbered[filepath.Join(out.dir, fmt.Sprintf("sitemap-%d.xml", i+1))] = true
+		}
+	}
+	for _, f := range old {
+		if numbered[f] {
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+	if len(files) == 1 {
+		return out.writeFile(filepath.Join(out.dir, sitemapFile), files[0].Bytes())
+	}
+
+	var ib bytes.Buffer
+	ib.WriteString(xml.Header + `<sitemapindex xmlns="` + sitemapXMLNS + `">` + "\n")
+	for i, b := range files {
+		name := fmt.Sprintf("sitemap-%d.xml", i+1)
+		if err := out.writeFile(filepath.Join(out.dir, name), b.Bytes()); err != nil {
+			return err
+		}
+		e := index[i]
+		e.loc = strings.TrimSuffix(siteURL, "/") + "/" + name
+		line, err := e.marshal("sitemap")
+		if err != nil {
+			return err
+		}
+		ib.Write(line)
+		ib.WriteByte('\n')
+	}
+	ib.WriteString("</sitemapindex>\n")
+	return out.writeFile(filepath.Join(out.dir, sitemapFile), ib.Bytes())
+}
+
+// moduleLastMods returns the modification times of the modules, keyed by
+// module path: the time of the newest file in the directory of the module.
+// Modules without a directory have none.
+func moduleLastMods(modules []frontend.LocalModule) (map[string]time.Time, error) {
+	byModule := map[string]time.Time{}
+	for _, m := range modules {
+		if m.Dir == "" {
+			continue
+		}
+		t, err := newestFileTime(m.Dir)
+		if err != nil {
+			return nil, err
+		}
+		byModule[m.ModulePath] = t
+	}
+	return byModule, nil
+}
+
+// sitemapLastMods returns the last modification times of the unit pages,
+// keyed by URL path: the time of the unit's module, in byModule or, for
+// the units of frozen modules, as recorded. The homepage gets the newest
+// time of all.
+func sitemapLastMods(byModule map[string]time.Time, units []*siteUnit, frozen map[string]*moduleContribution) map[string]time.Time {
+	lastMod := map[string]time.Time{}
+	var newest time.Time
+	add := func(unit string, t time.Time) {
+		lastMod["/"+unit] = t
+		if t.After(newest) {
+			newest = t
+		}
+	}
+	for _, u := range units {
+		if t, ok := byModule[u.meta.ModulePath]; ok {
+			add(u.path, t)
+		}
+	}
+	for _, c := range frozen {
+		if c.LastMod == nil {
+			continue
+		}
+		for _, u := range c.Units {
+			add(u, *c.LastMod)
+		}
+	}
+	if !newest.IsZero() {
+		lastMod["/"] = newest
+	}
+	return lastMod
+}
+
+// newestFileTime returns the modification time of the newest file in the
+// module directory dir. Hidden directories, such as .git, and nested
+// modules are skipped.
+func newestFileTime(dir string) (time.Time, error) {
+	var newest time.Time
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == dir {
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest, err
+}
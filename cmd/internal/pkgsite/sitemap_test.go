@@ -0,0 +1,195 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+// xmlSitemap holds a parsed sitemap or sitemap index.
+type xmlSitemap struct {
+	XMLName xml.Name
+	URLs    []xmlSitemapEntry `xml:"url"`
+	Maps    []xmlSitemapEntry `xml:"sitemap"`
+}
+
+type xmlSitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+func readSitemap(t *testing.T, file string) *xmlSitemap {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s xmlSitemap
+	if err := xml.Unmarshal(data, &s); err != nil {
+		t.Fatalf("%s: %v", file, err)
+	}
+	if s.XMLName.Space != sitemapXMLNS {
+		t.Errorf("%s: namespace %q, want %q", file, s.XMLName.Space, sitemapXMLNS)
+	}
+	return &s
+}
+
+func TestPageURL(t *testing.T) {
+	for _, test := range []struct {
+		siteURL, urlPath, want string
+	}{
+		{"https://example.com", "/", "https://example.com/"},
+		{"https://example.com/", "/about", "https://example.com/about/"},
+		{"https://example.com/docs/", "/", "https://example.com/docs/"},
+		{"https://example.com/docs", "/example.com/m/sub", "https://example.com/docs/example.com/m/sub/"},
+		{"https://example.com/docs/", "/example.com/m/a b", "https://example.com/docs/example.com/m/a%20b/"},
+	} {
+		if got := pageURL(test.siteURL, test.urlPath); got != test.want {
+			t.Errorf("pageURL(%q, %q) = %q, want %q", test.siteURL, test.urlPath, got, test.want)
+		}
+	}
+}
+
+func TestWriteSitemapsSplit(t *testing.T) {
+	outDir := t.TempDir()
+	// A numbered file left by an earlier generation is removed.
+	stale := filepath.Join(outDir, "sitemap-3.xml")
+	if err := os.WriteFile(stale, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var entries []*sitemapEntry
+	for i := 0; i < sitemapMaxURLs+1; i++ {
+		entries = append(entries, &sitemapEntry{
+			loc:     fmt.Sprintf("https://example.com/docs/p%06d/", i),
+			lastMod: base.Add(time.Duration(i) * time.Second),
+		})
+	}
+	if err := writeSitemaps(testSiteOutput(t, outDir), "https://example.com/docs/", entries, sitemapMaxURLs, sitemapMaxBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	index := readSitemap(t, filepath.Join(outDir, "sitemap.xml"))
+	if index.XMLName.Local != "sitemapindex" {
+		t.Fatalf("sitemap.xml is a %s, want a sitemapindex", index.XMLName.Local)
+	}
+	want := []xmlSitemapEntry{
+		{"https://example.com/docs/sitemap-1.xml", "2024-01-01T13:53:19Z"},
+		{"https://example.com/docs/sitemap-2.xml", "2024-01-01T13:53:20Z"},
+	}
+	if diff := cmp.Diff(want, index.Maps); diff != "" {
+		t.Errorf("index mismatch (-want +got):\n%s", diff)
+	}
+	for i, wantN := range []int{sitemapMaxURLs, 1} {
+		s := readSitemap(t, filepath.Join(outDir, fmt.Sprintf("sitemap-%d.xml", i+1)))
+		if s.XMLName.Local != "urlset" || len(s.URLs) != wantN {
+			t.Errorf("sitemap-%d.xml: %s of %d URLs, want urlset of %d", i+1, s.XMLName.Local, len(s.URLs), wantN)
+		}
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale sitemap file: got %v, want not exist", err)
+	}
+}
+
+func TestWriteSitemapsSizeLimit(t *testing.T) {
+	outDir := t.TempDir()
+	var entries []*sitemapEntry
+	for i := 0; i < 10; i++ {
+		entries = append(entries, &sitemapEntry{loc: fmt.Sprintf("https://example.com/p%d/", i)})
+	}
+	// Room for the header and about four URLs per file.
+	if err := writeSitemaps(testSiteOutput(t, outDir), "https://example.com", entries, sitemapMaxURLs, 300); err != nil {
+		t.Fatal(err)
+	}
+	index := readSitemap(t, filepath.Join(outDir, "sitemap.xml"))
+	var n int
+	for i := range index.Maps {
+		file := filepath.Join(outDir, fmt.Sprintf("sitemap-%d.xml", i+1))
+		fi, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() > 300 {
+			t.Errorf("%s has %d bytes, more than the limit", file, fi.Size())
+		}
+		n += len(readSitemap(t, file).URLs)
+	}
+	if len(index.Maps) < 2 || n != len(entries) {
+		t.Errorf("got %d URLs in %d files, want %d in several", n, len(index.Maps), len(entries))
+	}
+}
+
+func TestGenerateStaticSiteSitemap(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- sub/sub.go --
+// Package sub does other things.
+package sub
+`)
+	// The go.mod file has a go directive, so that the go command does
+	// not add one and change its modification time.
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	err := filepath.WalkDir(modDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return os.Chtimes(p, mtime, mtime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("subpath", func(t *testing.T) {
+		outDir := t.TempDir()
+		cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true, SiteURL: "https://example.com/docs/"}
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Sitemap: true}); err != nil {
+			t.Fatal(err)
+		}
+		s := readSitemap(t, filepath.Join(outDir, "sitemap.xml"))
+		const lastMod = "2024-03-01T12:00:00Z"
+		want := []xmlSitemapEntry{
+			{"https://example.com/docs/", lastMod},
+			{"https://example.com/docs/about/", ""},
+			{"https://example.com/docs/attributions/", ""},
+			{"https://example.com/docs/example.com/m/", lastMod},
+			{"https://example.com/docs/example.com/m/sub/", lastMod},
+			{"https://example.com/docs/license-policy/", ""},
+			{"https://example.com/docs/search-help/", ""},
+		}
+		if diff := cmp.Diff(want, s.URLs); diff != "" {
+			t.Errorf("sitemap mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("no site URL", func(t *testing.T) {
+		outDir := t.TempDir()
+		cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+		if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Sitemap: true}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(outDir, "sitemap.xml")); !os.IsNotExist(err) {
+			t.Errorf("sitemap.xml: got %v, want not exist", err)
+		}
+	})
+}
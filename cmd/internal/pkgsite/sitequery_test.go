@@ -0,0 +1,134 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	"github.com/wow-look-at-my/static-pkgsite/sitequery"
+)
+
+// TestSiteQuery queries generated sites through package sitequery.
+func TestSiteQuery(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- m/go.mod --
+module example.com/m
+
+go 1.21
+-- m/m.go --
+// Package m does things.
+package m
+
+// F does things.
+func F() {}
+-- m/a/a.go --
+// Package a does other things.
+package a
+-- m/internal/x/x.go --
+// Package x is internal.
+package x
+-- v1.1.0/go.mod --
+module example.com/m
+
+go 1.21
+-- v1.1.0/m.go --
+// Package m did things.
+package m
+-- v1.1.0/old/old.go --
+// Package old is gone.
+package old
+`)
+	cfg := ServerConfig{
+		Paths:         []string{filepath.Join(dir, "m")},
+		UseListedMods: true,
+		ModuleVersions: []ModuleVersion{
+			{Path: "example.com/m", Version: "v1.1.0", Dir: filepath.Join(dir, "v1.1.0")},
+		},
+	}
+	outDir := t.TempDir()
+	opts := GenerateOptions{OutDir: outDir, ExcludeGlobs: []string{"**/internal/**"}}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipFile := filepath.Join(t.TempDir(), "site.zip")
+	opts.OutDir = zipFile
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{outDir, zipFile} {
+		s, err := sitequery.Open(name, sitequery.Options{Report: report})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, u := range s.ListUnits(nil) {
+			got = append(got, u.URL)
+		}
+		want := []string{
+			"example.com/m/",
+			"example.com/m/a/",
+			"example.com/m@v1.1.0/",
+			"example.com/m@v1.1.0/old/",
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s: units mismatch (-want +got):\n%s", name, diff)
+		}
+		m, err := s.UnitByPath("example.com/m")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m.Package || m.Synopsis != "Package m does things." || !cmp.Equal(m.Symbols, []string{"F"}) || m.Version != "v0.0.0" {
+			t.Errorf("%s: got unit %+v", name, m)
+		}
+		// The URLs of the units and of their tabs are those of pages of
+		// the site.
+		for _, u := range s.ListUnits(nil) {
+			for _, p := range append([]string{u.URL}, tabURLs(u)...) {
+				if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p), "index.html")); err != nil {
+					t.Errorf("%s: unit %s: %v", name, u.Path, err)
+				}
+			}
+			if len(u.Tabs) == 0 {
+				t.Errorf("%s: unit %s has no tabs", name, u.Path)
+			}
+		}
+		if u, err := s.UnitAt("example.com/m/old", "v1.1.0"); err != nil || u.URL != "example.com/m@v1.1.0/old/" {
+			t.Errorf("%s: UnitAt(example.com/m/old, v1.1.0) = %+v, %v", name, u, err)
+		}
+		if v, err := s.ModuleVersion("example.com/m"); err != nil || v != "v0.0.0" {
+			t.Errorf("%s: ModuleVersion(example.com/m) = %q, %v", name, v, err)
+		}
+		if url, err := s.URLFor("example.com/m", "F"); err != nil || url != "example.com/m/#F" {
+			t.Errorf("%s: URLFor(example.com/m, F) = %q, %v", name, url, err)
+		}
+		for p, want := range map[string]error{
+			"example.com/m/internal/x": sitequery.ErrLeftOut,
+			"example.com/m/old":        sitequery.ErrNotGenerated,
+		} {
+			if _, err := s.UnitByPath(p); !errors.Is(err, want) {
+				t.Errorf("%s: UnitByPath(%s): got error %v, want %v", name, p, err, want)
+			}
+		}
+	}
+}
+
+// tabURLs returns the URLs of the tab pages of u.
+func tabURLs(u *sitequery.Unit) []string {
+	var urls []string
+	for _, tab := range u.Tabs {
+		urls = append(urls, u.URL+tab+"/")
+	}
+	return urls
+}
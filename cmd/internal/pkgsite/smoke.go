@@ -0,0 +1,71 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+)
+
+// smokeMarkerFile is written to the output directory of a smoke test, to
+// tell it apart from a full site.
+const smokeMarkerFile = ".pkgsite-smoke"
+
+const smokeMarkerContent = "This directory holds a partial site generated as a smoke test. Do not publish it.\n"
+
+// smokeUnits returns the units generated by a smoke test: the root unit of
+// each module, or its first unit if the module root is not a unit. The
+// units must be sorted by path, as returned by enumerateUnits.
+func smokeUnits(units []*siteUnit) []*siteUnit {
+	chosen := map[*fetch.LazyModule]*siteUnit{}
+	var modules []*fetch.LazyModule
+	for _, u := range units {
+		c, ok := chosen[u.module]
+		if !ok {
+			modules = append(modules, u.module)
+		}
+		if !ok || (u.meta.IsModule() && !c.meta.IsModule()) {
+			chosen[u.module] = u
+		}
+	}
+	var selected []*siteUnit
+	for _, u := range units {
+		if chosen[u.module] == u {
+			selected = append(selected, u)
+		}
+	}
+	return selected
+}
+
+// prepareSmokeOutDir checks that outDir does not hold a full site, which a
+// smoke test would leave partially overwritten, and marks it as holding a
+// partial one.
+func prepareSmokeOutDir(outDir string) error {
+	_, err := os.Stat(filepath.Join(outDir, "index.html"))
+	if err == nil {
+		if _, err := os.Stat(filepath.Join(outDir, smokeMarkerFile)); errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s holds a full site; write the smoke test to a separate directory", outDir)
+		}
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return err
+	}
+	return writeSiteFile(filepath.Join(outDir, smokeMarkerFile), []byte(smokeMarkerContent))
+}
+
+// removeSmokeMarker removes the smoke test marker from outDir, which is
+// about to hold a full site.
+func removeSmokeMarker(outDir string) error {
+	err := os.Remove(filepath.Join(outDir, smokeMarkerFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestSmokeUnits(t *testing.T) {
+	m1 := &fetch.LazyModule{}
+	m2 := &fetch.LazyModule{}
+	unit := func(path, modulePath string, m *fetch.LazyModule) *siteUnit {
+		return &siteUnit{
+			path:   path,
+			meta:   &internal.UnitMeta{Path: path, ModuleInfo: internal.ModuleInfo{ModulePath: modulePath}},
+			module: m,
+		}
+	}
+	units := []*siteUnit{
+		unit("example.com/a", "example.com/a", m1),
+		unit("example.com/a/x", "example.com/a", m1),
+		// A module whose root is not the first of its units.
+		unit("example.com/b/cmd", "example.com/b", m2),
+		unit("example.com/b", "example.com/b", m2),
+	}
+	got := unitPaths(smokeUnits(units))
+	want := []string{"example.com/a", "example.com/b"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+const smokeFixture = `
+-- go.mod --
+module example.com/m
+-- m.go --
+// Package m uses packages a and b.
+package m
+
+import (
+	"example.com/m/a"
+	"example.com/m/b"
+)
+
+// F calls [a.F] and [b.F].
+func F() { a.F(); b.F() }
+-- a/a.go --
+// Package a is used by m.
+package a
+
+// F is a function.
+func F() {}
+-- b/b.go --
+// Package b is used by m.
+package b
+
+// F is a function.
+func F() {}
+`
+
+func TestGenerateStaticSiteSmoke(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, smokeFixture)
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	ctx := context.Background()
+
+	fullDir := t.TempDir()
+	full, err := GenerateStaticSiteReport(ctx, cfg, fullDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Partial || len(full.BrokenLinks) != 0 || full.IgnoredLinks != 0 {
+		t.Errorf("full site: got %+v", full)
+	}
+
+	// A smoke test must not overwrite a full site.
+	if _, err := GenerateStaticSiteWithOptions(ctx, cfg, GenerateOptions{OutDir: fullDir, Smoke: true}); err == nil {
+		t.Error("smoke test into a full site's directory: got nil error")
+	}
+
+	smokeDir := t.TempDir()
+	smoke, err := GenerateStaticSiteWithOptions(ctx, cfg, GenerateOptions{OutDir: smokeDir, Smoke: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !smoke.Partial {
+		t.Error("smoke report is not partial")
+	}
+	// The homepage, three static pages, the third-party notices, and the
+	// module root and its imports, imported-by and licenses pages.
+	if smoke.Pages != 9 || smoke.Units != full.Units {
+		t.Errorf("got %d pages for %d units, want 9 pages for %d units", smoke.Pages, smoke.Units, full.Units)
+	}
+	if len(smoke.BrokenLinks) != 0 {
+		t.Errorf("got broken links %v", smoke.BrokenLinks)
+	}
+	for _, f := range []string{"index.html", "example.com/m/index.html", "static/frontend/frontend.js", smokeMarkerFile} {
+		if _, err := os.Stat(filepath.Join(smokeDir, filepath.FromSlash(f))); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(smokeDir, "example.com", "m", "a")); err == nil {
+		t.Error("smoke test generated a non-root unit")
+	}
+
+	// Smoke tests can be repeated in the same directory, and a full site
+	// written there is no longer marked partial.
+	if _, err := GenerateStaticSiteWithOptions(ctx, cfg, GenerateOptions{OutDir: smokeDir, Smoke: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateStaticSiteReport(ctx, cfg, smokeDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(smokeDir, smokeMarkerFile)); err == nil {
+		t.Error("full site still has the smoke test marker")
+	}
+}
+
+func TestLinkChecker(t *testing.T) {
+	m := &fetch.LazyModule{}
+	unit := func(path string) *siteUnit {
+		return &siteUnit{path: path, meta: &internal.UnitMeta{Path: path, ModuleInfo: internal.ModuleInfo{ModulePath: "example.com/m"}}, module: m}
+	}
+	all := []*siteUnit{unit("example.com/m"), unit("example.com/m/a"), unit("example.com/m/b")}
+	lc := newLinkChecker(all, all[:2])
+	ev := &pageEvent{
+		File: "example.com/m/index.html",
+		Links: []string{
+			"../../example.com/m/a?tab=doc#F", // generated
+			"../../example.com/m/b",           // skipped
+			"../../example.com/m/c",           // broken
+			"../../example.com/m@v1.0.0",      // versioned
+			"../../fmt",                       // outside the modules
+			"https://example.com/m/c",         // absolute
+			"#section-readme",
+		},
+	}
+	for _, e := range []*pageEvent{{File: "index.html"}, ev, {File: "example.com/m/a/index.html"}} {
+		if err := lc.consumePage(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lc.finish(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []BrokenLink{{Page: "example.com/m/index.html", Href: "../../example.com/m/c"}}
+	if diff := cmp.Diff(want, lc.broken); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if lc.ignored != 1 {
+		t.Errorf("got %d ignored links, want 1", lc.ignored)
+	}
+}
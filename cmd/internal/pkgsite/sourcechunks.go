@@ -0,0 +1,258 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// The source page of a large file, such as generated code, can weigh
+// megabytes, which browsers struggle to lay out. With
+// GenerateOptions.SourceChunkLines, a file with more lines is split into
+// chunks of that many lines, after it is highlighted: its page holds the
+// first chunk, and each other chunk is written next to the page, as
+// chunk-<n>.html, holding the rows of its lines. In place of each chunk,
+// the page has an empty <tbody> naming the first and last line of the
+// chunk and its file, which the script at sourceChunksScriptPath loads
+// when it comes near the screen, or when the line anchor of the page
+// points into it, scrolling to the line once it is loaded.
+//
+// Without scripts, the placeholders say which lines they stand for, and
+// link to the text of the file, written next to the page as raw.txt, which
+// the "View raw" link of the page points at too.
+
+const (
+	// sourceChunksScriptPath and sourceChunksStylePath are the site paths
+	// of the script loading the chunks and of its style sheet, built from
+	// static/frontend.
+	sourceChunksScriptPath = "static/frontend/sourcechunks/sourcechunks.js"
+	sourceChunksStylePath  = "static/frontend/sourcechunks/sourcechunks.min.css"
+	// sourceRawFile is the name of the text of a chunked file, in the
+	// directory of its page.
+	sourceRawFile = "raw.txt"
+)
+
+// sourceChunkFile returns the name of the file of the chunk numbered n,
+// counting the one on the page as 1.
+func sourceChunkFile(n int) string {
+	return "chunk-" + strconv.Itoa(n) + ".html"
+}
+
+// A sourceChunker splits the source pages of large files into chunks. It
+// is safe for concurrent use.
+type sourceChunker struct {
+	lines   int // lines of a chunk
+	mu      sync.Mutex
+	pending map[string]map[string][]byte // files of the pages not yet written, by site path of the page and file name
+	files   []string                     // site paths of the files written
+}
+
+// newSourceChunker returns a sourceChunker splitting files into chunks of
+// lines lines, or nil if lines is not positive.
+func newSourceChunker(lines int) *sourceChunker {
+	if lines <= 0 {
+		return nil
+	}
+	return &sourceChunker{lines: lines, pending: map[string]map[string][]byte{}}
+}
+
+// transform returns the page transform splitting the source page at the
+// site path sitePath, if its file has more lines than a chunk. It must
+// come after the transforms that change the lines, such as highlighting.
+// The files of the chunks are kept for write.
+func (c *sourceChunker) transform(sitePath string) pageTransform {
+	if c == nil {
+		return nil
+	}
+	return func(doc *html.Node, head *headManager) {
+		table := findElementFunc(doc, func(n *html.Node) bool {
+			return n.DataAtom == atom.Table && hasClass(n, "Source-lines")
+		})
+		if table == nil {
+			return
+		}
+		var rows []*html.Node
+		walkElements(table, func(n *html.Node) {
+			if n.DataAtom == atom.Tr && hasClass(n, "Source-line") {
+				rows = append(rows, n)
+			}
+		})
+		if len(rows) <= c.lines {
+			return
+		}
+		files := map[string][]byte{}
+		var raw strings.Builder
+		for _, r := range rows {
+			if text := findElementFunc(r, func(n *html.Node) bool { return hasClass(n, "Source-text") }); text != nil {
+				raw.WriteString(nodeText(text))
+			}
+			raw.WriteByte('\n')
+		}
+		files[sourceRawFile] = []byte(raw.String())
+		rawURL := "/" + sitePath + "/" + sourceRawFile
+		for n, start := 2, c.lines; start < len(rows); n, start = n+1, start+c.lines {
+			chunk := rows[start:min(start+c.lines, len(rows))]
+			var buf bytes.Buffer
+			for _, r := range chunk {
+				r.Parent.RemoveChild(r)
+				if err := html.Render(&buf, r); err != nil {
+					return // rendering to a buffer does not fail
+				}
+				buf.WriteByte('\n')
+			}
+			files[sourceChunkFile(n)] = buf.Bytes()
+			table.AppendChild(sourceChunkPlaceholder(start+1, start+len(chunk), len(rows), sourceChunkFile(n), rawURL))
+		}
+		addSourceRawLink(doc, rawURL)
+		head.register("sourcechunks", headOrderScript,
+			&html.Node{
+				Type:     html.ElementNode,
+				Data:     "link",
+				DataAtom: atom.Link,
+				Attr: []html.Attribute{
+					{Key: "rel", Val: "stylesheet"},
+					{Key: "href", Val: "/" + sourceChunksStylePath},
+				},
+			},
+			&html.Node{
+				Type:     html.ElementNode,
+				Data:     "script",
+				DataAtom: atom.Script,
+				Attr: []html.Attribute{
+					{Key: "type", Val: "module"},
+					{Key: "src", Val: "/" + sourceChunksScriptPath},
+				},
+			})
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.pending[sitePath] = files
+	}
+}
+
+// sourceChunkPlaceholder returns the <tbody> standing for the lines first
+// to last, out of total, loaded from file, a URL relative to the page.
+// rawURL is the URL of the text of the file.
+func sourceChunkPlaceholder(first, last, total int, file, rawURL string) *html.Node {
+	message := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "td",
+		DataAtom: atom.Td,
+		Attr:     []html.Attribute{{Key: "class", Val: "spk-SourceChunk-message"}},
+	}
+	message.AppendChild(&html.Node{Type: html.TextNode, Data: fmt.Sprintf("Lines %d to %d of %d are loaded as you scroll to them. ", first, last, total)})
+	a := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "a",
+		DataAtom: atom.A,
+		Attr:     []html.Attribute{{Key: "href", Val: rawURL}},
+	}
+	a.AppendChild(&html.Node{Type: html.TextNode, Data: "View raw"})
+	message.AppendChild(a)
+	row := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "tr",
+		DataAtom: atom.Tr,
+		Attr:     []html.Attribute{{Key: "class", Val: "spk-SourceChunk-placeholder"}},
+	}
+	row.AppendChild(&html.Node{
+		Type:     html.ElementNode,
+		Data:     "td",
+		DataAtom: atom.Td,
+		Attr:     []html.Attribute{{Key: "class", Val: "Source-number"}},
+	})
+	row.AppendChild(message)
+	body := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "tbody",
+		DataAtom: atom.Tbody,
+		Attr: []html.Attribute{
+			{Key: "class", Val: "spk-SourceChunk"},
+			{Key: "data-first", Val: strconv.Itoa(first)},
+			{Key: "data-last", Val: strconv.Itoa(last)},
+			{Key: "data-src", Val: file},
+		},
+	}
+	body.AppendChild(row)
+	return body
+}
+
+// addSourceRawLink adds the "View raw" link to the header of the source
+// page doc, pointing at rawURL, in place of the one sourcePageTransform
+// removed.
+func addSourceRawLink(doc *html.Node, rawURL string) {
+	header := findElementFunc(doc, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && hasClass(n, "Source-header")
+	})
+	if header == nil {
+		return
+	}
+	a := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "a",
+		DataAtom: atom.A,
+		Attr: []html.Attribute{
+			{Key: "href", Val: rawURL},
+			{Key: "data-test-id", Val: "source-raw"},
+		},
+	}
+	a.AppendChild(&html.Node{Type: html.TextNode, Data: "View raw"})
+	header.AppendChild(a)
+}
+
+// write writes the files of the chunks of the source page at the site
+// path sitePath, if it was split, to the directory of the page.
+func (c *sourceChunker) write(out *siteOutput, sitePath string) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	files := c.pending[sitePath]
+	delete(c.pending, sitePath)
+	c.mu.Unlock()
+	if files == nil {
+		return nil
+	}
+	dir := filepath.Join(out.dir, filepath.FromSlash(sitePath))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := out.writeFile(filepath.Join(dir, name), files[name]); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.files = append(c.files, path.Join(sitePath, name))
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// written returns the site paths of the files written, sorted.
+func (c *sourceChunker) written() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files := append([]string(nil), c.files...)
+	sort.Strings(files)
+	return files
+}
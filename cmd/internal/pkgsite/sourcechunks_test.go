@@ -0,0 +1,175 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+// testSourcePage returns a source page of a file with n lines.
+func testSourcePage(n int) string {
+	var b strings.Builder
+	b.WriteString(`<html><head></head><body><main><div class="Source-header"><h1>m.go</h1></div><table class="Source-lines">`)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, `<tr class="Source-line" id="L%d"><td class="Source-number"><a href="#L%d">%d</a></td><td class="Source-text">var v%d = &#34;%d&#34;</td></tr>`, i, i, i, i, i)
+	}
+	b.WriteString(`</table></main></body></html>`)
+	return b.String()
+}
+
+func TestSourceChunksTransform(t *testing.T) {
+	c := newSourceChunker(5)
+	transform := func(sitePath string, lines int) string {
+		t.Helper()
+		doc, err := html.Parse(strings.NewReader(testSourcePage(lines)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var head headManager
+		c.transform(sitePath)(doc, &head)
+		var buf bytes.Buffer
+		if err := html.Render(&buf, doc); err != nil {
+			t.Fatal(err)
+		}
+		if lines > 5 && head.fragments["sourcechunks"].nodes == nil {
+			t.Error("the page does not load the chunk script")
+		}
+		return buf.String()
+	}
+
+	// A file with no more lines than a chunk is left alone.
+	if got, want := transform("example.com/m/file/s.go", 5), testSourcePage(5); !strings.Contains(got, `id="L5"`) || strings.Contains(got, "spk-SourceChunk") {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if c.pending["example.com/m/file/s.go"] != nil {
+		t.Error("a short file has chunks")
+	}
+
+	page := transform("example.com/m/file/m.go", 12)
+	for i := 1; i <= 12; i++ {
+		if got, want := strings.Contains(page, fmt.Sprintf(`id="L%d"`, i)), i <= 5; got != want {
+			t.Errorf("line %d on the page: %t, want %t", i, got, want)
+		}
+	}
+	for _, want := range []string{
+		`<tbody class="spk-SourceChunk" data-first="6" data-last="10" data-src="chunk-2.html">`,
+		`<tbody class="spk-SourceChunk" data-first="11" data-last="12" data-src="chunk-3.html">`,
+		`Lines 11 to 12 of 12 are loaded as you scroll to them. <a href="/example.com/m/file/m.go/raw.txt">View raw</a>`,
+		`<a href="/example.com/m/file/m.go/raw.txt" data-test-id="source-raw">View raw</a></div>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the page does not contain %s", want)
+		}
+	}
+	files := c.pending["example.com/m/file/m.go"]
+	for name, lines := range map[string][]int{"chunk-2.html": {6, 10}, "chunk-3.html": {11, 12}} {
+		got := regexp.MustCompile(`id="L(\d+)"`).FindAllStringSubmatch(string(files[name]), -1)
+		if len(got) != lines[1]-lines[0]+1 || got[0][1] != fmt.Sprint(lines[0]) || got[len(got)-1][1] != fmt.Sprint(lines[1]) {
+			t.Errorf("%s holds lines %v, want %d to %d", name, got, lines[0], lines[1])
+		}
+	}
+	if got := string(files["raw.txt"]); !strings.HasPrefix(got, "var v1 = \"1\"\nvar v2") || !strings.HasSuffix(got, "var v12 = \"12\"\n") {
+		t.Errorf("raw.txt is\n%s", got)
+	}
+
+	if newSourceChunker(0) != nil {
+		t.Error("got a chunker for chunks of no lines")
+	}
+}
+
+func TestGenerateStaticSiteSourceChunks(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	var src strings.Builder
+	src.WriteString("// Package m does things.\npackage m\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&src, "\nconst C%d = %d\n", i, i)
+	}
+	src.WriteString("\n// F does things.\nfunc F() {}\n")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+`+src.String())
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{
+		OutDir:           outDir,
+		SourcePages:      true,
+		SourceChunkLines: 30,
+		HighlightTheme:   "default",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.BrokenLinks) > 0 {
+		t.Errorf("broken links: %v", report.BrokenLinks)
+	}
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// F is on line 85, in the third chunk: the link to its source points at
+	// the page, whose placeholder for the lines 61 to 90 names the file that
+	// holds the line, highlighted.
+	const line = 85
+	main := read("example.com/m/index.html")
+	if want := fmt.Sprintf(`href="../../example.com/m/file/m.go#L%d"`, line); !strings.Contains(main, want) {
+		t.Fatalf("main page does not link to the source of F with %s", want)
+	}
+	source := read("example.com/m/file/m.go/index.html")
+	if strings.Contains(source, fmt.Sprintf(`id="L%d"`, line)) {
+		t.Error("the page has the line of F")
+	}
+	m := regexp.MustCompile(`<tbody class="spk-SourceChunk" data-first="(\d+)" data-last="(\d+)" data-src="([^"]+)">`).FindAllStringSubmatch(source, -1)
+	var chunk string
+	for _, p := range m {
+		var first, last int
+		fmt.Sscan(p[1], &first)
+		fmt.Sscan(p[2], &last)
+		if first <= line && line <= last {
+			chunk = p[3]
+		}
+	}
+	if chunk != "chunk-3.html" {
+		t.Fatalf("the placeholder of line %d names %q, want chunk-3.html; placeholders: %v", line, chunk, m)
+	}
+	rows := read("example.com/m/file/m.go/" + chunk)
+	if want := fmt.Sprintf(`<tr class="Source-line" id="L%d"><td class="Source-number"><a href="#L%d">%d</a></td><td class="Source-text"><span class="keyword">func</span> F() {}</td></tr>`, line, line, line); !strings.Contains(rows, want) {
+		t.Errorf("%s does not contain %s:\n%s", chunk, want, rows)
+	}
+	for _, want := range []string{
+		`src="../../../../static/frontend/sourcechunks/sourcechunks.js"`,
+		`href="../../../../example.com/m/file/m.go/raw.txt" data-test-id="source-raw"`,
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("the page does not contain %s", want)
+		}
+	}
+	if got := read("example.com/m/file/m.go/raw.txt"); got != src.String() {
+		t.Errorf("raw.txt is\n%s\nwant\n%s", got, src.String())
+	}
+	if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(sourceChunksScriptPath))); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+)
+
+// The "View Source" links of the declarations of local modules, and the
+// links to their files and directories, point at the files on the dynamic
+// server, under filesPrefix. A module whose ModuleSettings have a
+// SourceLink template gets them pointed at its repository instead, such as
+// https://github.com/org/repo/blob/{commit}/{path}#L{line}: {path} is the
+// slash-separated path of the file or directory in the module, {line} the
+// line of a declaration, and {commit} GenerateOptions.SourceRef or, if it is
+// empty, the commit checked out in the git repository of the module's
+// directory. For a link without a line, the template is cut at the # that
+// precedes {line}. Source pages, if the site has them, take precedence;
+// the pages of module versions keep their links.
+
+// sourceLinker points the links to the files of local modules at their
+// repositories.
+type sourceLinker struct {
+	templates map[string]string // SourceLink templates by canonical module path
+	commits   map[string]string // {commit} by canonical module path
+}
+
+// newSourceLinker returns the sourceLinker of the modules with a SourceLink
+// in settings. modules are the modules of the site, with their directories;
+// ref is GenerateOptions.SourceRef.
+func newSourceLinker(settings moduleSettingsIndex, modules []frontend.LocalModule, ref string) (*sourceLinker, error) {
+	sl := &sourceLinker{templates: map[string]string{}, commits: map[string]string{}}
+	for _, m := range modules {
+		p := canonicalUnitPath(m.ModulePath)
+		tmpl := settings[p].SourceLink
+		if tmpl == "" {
+			continue
+		}
+		commit := ref
+		if commit == "" && strings.Contains(tmpl, "{commit}") {
+			var err error
+			commit, err = gitHead(m.Dir)
+			if err != nil {
+				return nil, fmt.Errorf("module %s: the source link needs a commit, and there is no source ref: %v", m.ModulePath, err)
+			}
+		}
+		sl.templates[p] = tmpl
+		sl.commits[p] = commit
+	}
+	return sl, nil
+}
+
+// transform returns the page transform pointing the links to the files of
+// the module of u at its repository, or nil if they keep their links.
+func (sl *sourceLinker) transform(u *siteUnit) pageTransform {
+	p := canonicalUnitPath(u.meta.ModulePath)
+	tmpl, ok := sl.templates[p]
+	if !ok || u.version != "" || u.module == nil {
+		return nil
+	}
+	repo := strings.TrimSuffix(u.module.SourceInfo.RepoURL(), "/")
+	if !strings.HasPrefix(repo, filesPrefix) {
+		return nil // not a local module
+	}
+	commit := sl.commits[p]
+	return func(doc *html.Node, _ *headManager) {
+		walkElements(doc, func(n *html.Node) {
+			if n.Data != "a" {
+				return
+			}
+			href, frag, _ := strings.Cut(attrValue(n, "href"), "#")
+			if href != repo && !strings.HasPrefix(href, repo+"/") {
+				return
+			}
+			line, _ := strings.CutPrefix(frag, "L")
+			setAttr(n, "href", expandSourceLink(tmpl, commit, strings.Trim(href[len(repo):], "/"), line))
+		})
+	}
+}
+
+// expandSourceLink returns the link of the template tmpl to the file or
+// directory at file, in the module, and the line, if it is not empty.
+func expandSourceLink(tmpl, commit, file, line string) string {
+	if line == "" {
+		if i := strings.LastIndex(tmpl, "#"); i >= 0 && strings.Contains(tmpl[i:], "{line}") {
+			tmpl = tmpl[:i]
+		}
+	}
+	return strings.NewReplacer("{commit}", commit, "{path}", file, "{line}", line).Replace(tmpl)
+}
+
+// checkSourceLink checks that the SourceLink template tmpl is an absolute
+// http or https URL with a {path}.
+func checkSourceLink(tmpl string) error {
+	u, err := url.Parse(strings.NewReplacer("{commit}", "c", "{path}", "p", "{line}", "1").Replace(tmpl))
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http or https URL", tmpl)
+	}
+	if !strings.Contains(tmpl, "{path}") {
+		return fmt.Errorf("%q has no {path}", tmpl)
+	}
+	return nil
+}
+
+// gitHead returns the commit checked out in the git repository holding
+// dir, or in its worktree.
+func gitHead(dir string) (string, error) {
+	gitDir, err := findGitDir(dir)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	head := strings.TrimSpace(string(data))
+	ref, ok := strings.CutPrefix(head, "ref: ")
+	if !ok {
+		return head, nil // a detached HEAD
+	}
+	// The refs of a worktree are those of its common directory.
+	common := gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		common = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+	}
+	for _, d := range []string{gitDir, common} {
+		if data, err := os.ReadFile(filepath.Join(d, filepath.FromSlash(ref))); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(common, "packed-refs")); err == nil {
+		s := bufio.NewScanner(bytes.NewReader(data))
+		for s.Scan() {
+			if hash, name, ok := strings.Cut(s.Text(), " "); ok && name == ref {
+				return hash, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s: HEAD is %s, which has no commit", gitDir, ref)
+}
+
+// findGitDir returns the git directory of the repository holding dir: the
+// .git directory of dir or of the closest directory above it, or the
+// directory that a .git file names.
+func findGitDir(dir string) (string, error) {
+	d, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		dotGit := filepath.Join(d, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			if info.IsDir() {
+				return dotGit, nil
+			}
+			data, err := os.ReadFile(dotGit)
+			if err != nil {
+				return "", err
+			}
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+			if !ok {
+				return "", fmt.Errorf("%s does not name a git directory", dotGit)
+			}
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(d, gitDir)
+			}
+			return gitDir, nil
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", fmt.Errorf("%s is not in a git repository", dir)
+		}
+		d = parent
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestExpandSourceLink(t *testing.T) {
+	const tmpl = "https://github.com/org/repo/blob/{commit}/{path}#L{line}"
+	for _, test := range []struct {
+		file, line, want string
+	}{
+		{"a/b/b.go", "12", "https://github.com/org/repo/blob/abc/a/b/b.go#L12"},
+		{"m.go", "", "https://github.com/org/repo/blob/abc/m.go"},
+		{"a/b", "", "https://github.com/org/repo/blob/abc/a/b"},
+	} {
+		if got := expandSourceLink(tmpl, "abc", test.file, test.line); got != test.want {
+			t.Errorf("expandSourceLink(%q, %q): got %q, want %q", test.file, test.line, got, test.want)
+		}
+	}
+}
+
+func TestCheckSourceLink(t *testing.T) {
+	if err := checkSourceLink("https://git.example.com/repo/-/blob/{commit}/{path}#L{line}"); err != nil {
+		t.Error(err)
+	}
+	for _, tmpl := range []string{"/repo/{path}", "ftp://example.com/{path}", "https://example.com/blob/{commit}"} {
+		if err := checkSourceLink(tmpl); err == nil {
+			t.Errorf("checkSourceLink(%q): got nil error", tmpl)
+		}
+	}
+}
+
+func TestGitHead(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	write := func(file, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := t.TempDir()
+	sub := filepath.Join(repo, "sub", "module")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitHead(sub); err == nil {
+		t.Error("got nil error outside a repository")
+	}
+
+	write(filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/main\n")
+	write(filepath.Join(repo, ".git", "packed-refs"), "# pack-refs with: peeled fully-peeled sorted\n"+commit+" refs/heads/main\n")
+	if got, err := gitHead(sub); err != nil || got != commit {
+		t.Errorf("packed ref: got %q, %v; want %q", got, err, commit)
+	}
+	other := strings.Repeat("f", 40)
+	write(filepath.Join(repo, ".git", "refs", "heads", "main"), other+"\n")
+	if got, err := gitHead(sub); err != nil || got != other {
+		t.Errorf("loose ref: got %q, %v; want %q", got, err, other)
+	}
+
+	// A worktree has a .git file naming its git directory, whose refs are
+	// those of the common directory.
+	worktree := t.TempDir()
+	write(filepath.Join(worktree, ".git"), "gitdir: "+filepath.Join(repo, ".git", "worktrees", "w")+"\n")
+	write(filepath.Join(repo, ".git", "worktrees", "w", "HEAD"), "ref: refs/heads/main\n")
+	write(filepath.Join(repo, ".git", "worktrees", "w", "commondir"), "../..\n")
+	if got, err := gitHead(worktree); err != nil || got != other {
+		t.Errorf("worktree: got %q, %v; want %q", got, err, other)
+	}
+	write(filepath.Join(repo, ".git", "worktrees", "w", "HEAD"), commit+"\n")
+	if got, err := gitHead(worktree); err != nil || got != commit {
+		t.Errorf("detached worktree: got %q, %v; want %q", got, err, commit)
+	}
+}
+
+func TestGenerateStaticSiteSourceLinks(t *testing.T) {
+	const txtar = `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- .git/HEAD --
+ref: refs/heads/main
+-- .git/refs/heads/main --
+0123456789abcdef0123456789abcdef01234567
+-- m.go --
+// Package m is the root.
+package m
+-- a/b/b.go --
+// Package b is nested.
+package b
+
+// F does it.
+func F() {}
+`
+	settings := map[string]ModuleSettings{
+		"example.com/m": {SourceLink: "https://github.com/org/repo/blob/{commit}/{path}#L{line}"},
+	}
+	for _, test := range []struct {
+		ref, commit string
+	}{
+		{"", "0123456789abcdef0123456789abcdef01234567"},
+		{"v1.2.3", "v1.2.3"},
+	} {
+		outDir := generateTestSite(t, txtar, func(_ *ServerConfig, opts *GenerateOptions) {
+			opts.ModuleSettings = settings
+			opts.SourceRef = test.ref
+		})
+		data, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "a", "b", "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := string(data)
+		base := "https://github.com/org/repo/blob/" + test.commit + "/"
+		for _, want := range []string{
+			`href="` + base + `a/b/b.go#L5"`, // the declaration of F
+			`href="` + base + `a/b/b.go"`,    // the file in the list of source files
+		} {
+			if !strings.Contains(page, want) {
+				t.Errorf("ref %q: page does not contain %s", test.ref, want)
+			}
+		}
+		if m := regexp.MustCompile(`href="[^"]*/files/[^"]*"`).FindString(page); m != "" {
+			t.Errorf("ref %q: page still links the files of the module: %s", test.ref, m)
+		}
+		checkInternalLinks(t, outDir, "example.com/")
+	}
+}
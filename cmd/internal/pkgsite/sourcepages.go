@@ -0,0 +1,129 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The "View Source" links of the pages of local modules point at the files
+// of the modules on the dynamic server, under filesPrefix, which a static
+// site does not have. With GenerateOptions.SourcePages, the generator writes a
+// page for each Go file of a package, as the frontend shows it under
+// sourcePrefix, at <package>/file/<name>, and points the links to the file
+// at it, keeping line anchors.
+
+const (
+	// sourcePrefix is the URL path prefix under which the frontend shows
+	// the files it serves under filesPrefix, with line anchors.
+	sourcePrefix = "/source/"
+	// sourceDir is the directory of a package's page holding the pages of
+	// its files.
+	sourceDir = "file"
+)
+
+// A sourcePage is the page of a source file.
+type sourcePage struct {
+	urlPath  string // URL path the frontend shows the file at, under sourcePrefix
+	sitePath string // site path of the page, such as "example.com/m/file/m.go"
+}
+
+// sourcePages returns the pages of the non-test Go files of the packages of
+// selected, and the site paths of their pages by the URL paths of the files
+// under filesPrefix. units holds the canonical paths of all units of the
+// site. Files larger than maxSize bytes, if it is positive, are left out
+// and listed in skipped. A package whose sourceDir would have the path of a
+// unit, such as its own "file" subdirectory, gets no pages; the returned
+// clashes list those paths.
+func sourcePages(ctx context.Context, units map[string]bool, selected []*siteUnit, maxSize int64) (pages []sourcePage, links map[string]string, skipped, clashes []string) {
+	links = map[string]string{}
+	for _, u := range selected {
+		if !u.meta.IsPackage() || u.getter == nil {
+			continue
+		}
+		if p := u.path + "/" + sourceDir; units[p] {
+			clashes = append(clashes, p)
+			continue
+		}
+		fsys, err := u.getter.ContentDir(ctx, u.meta.ModulePath, u.module.Version)
+		if err != nil {
+			continue
+		}
+		dir := strings.TrimPrefix(strings.TrimPrefix(u.meta.Path, u.meta.ModulePath), "/")
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if !e.Type().IsRegular() || path.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			file := path.Join(dir, name)
+			fileURL := u.module.SourceInfo.FileURL(file)
+			if !strings.HasPrefix(fileURL, filesPrefix) {
+				continue // not a local module
+			}
+			if info, err := e.Info(); err != nil || maxSize > 0 && info.Size() > maxSize {
+				skipped = append(skipped, u.meta.ModulePath+"/"+file)
+				continue
+			}
+			sitePath := u.path + "/" + sourceDir + "/" + name
+			pages = append(pages, sourcePage{
+				urlPath:  sourcePrefix + strings.TrimPrefix(fileURL, filesPrefix),
+				sitePath: sitePath,
+			})
+			links[fileURL] = sitePath
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].sitePath < pages[j].sitePath })
+	return pages, links, skipped, clashes
+}
+
+// sourceLinksTransform returns the page transform pointing the links to
+// files in links, as sourcePages returns them, at their pages. Fragments,
+// such as the line anchors of "View Source" links, are kept.
+func sourceLinksTransform(links map[string]string) pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode && n.Data == "a" {
+				href, frag, hasFrag := strings.Cut(attrValue(n, "href"), "#")
+				if p, ok := links[href]; ok {
+					if hasFrag {
+						p += "#" + frag
+					}
+					setAttr(n, "href", "/"+p)
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+	}
+}
+
+// sourcePageTransform returns the page transform for source pages that
+// removes the link to the raw file, which a static site does not have.
+func sourcePageTransform() pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		raw := findElementFunc(doc, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && attrValue(n, "data-test-id") == "source-raw"
+		})
+		if raw != nil {
+			raw.Parent.RemoveChild(raw)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSourceLinksTransform(t *testing.T) {
+	page := `<html><head></head><body>` +
+		`<a href="/files/home/u/m/example.com/m/m.go#L12">F</a>` +
+		`<a href="/files/home/u/m/example.com/m/m.go">m.go</a>` +
+		`<a href="/files/home/u/m/example.com/m/big.go#L1">G</a>` +
+		`<a href="/files/home/u/m/example.com/m/">repo</a>` +
+		`</body></html>`
+	links := map[string]string{"/files/home/u/m/example.com/m/m.go": "example.com/m/file/m.go"}
+	got, err := processHTML([]byte(page), "/example.com/m", nil, sourceLinksTransform(links))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<a href="../../example.com/m/file/m.go#L12">F</a>`,
+		`<a href="../../example.com/m/file/m.go">m.go</a>`,
+		`<a href="../../files/home/u/m/example.com/m/big.go#L1">G</a>`,
+		`<a href="../../files/home/u/m/example.com/m/">repo</a>`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("page does not contain %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerateStaticSiteSourcePages(t *testing.T) {
+	big := "package m\n\nvar Big = `" + strings.Repeat("x", 2000) + "`\n"
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+
+// F does things.
+func F() {}
+-- m_test.go --
+package m
+-- big.go --
+`+big+`
+-- a/a.go --
+// Package a has a file subdirectory.
+package a
+-- a/file/file.go --
+// Package file is a unit at the path of the source pages of a.
+package file
+`, func(_ *ServerConfig, opts *GenerateOptions) {
+		opts.SourcePages = true
+		opts.MaxSourceSize = 1000
+	})
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// The link to the source of F lands on its line.
+	main := read("example.com/m/index.html")
+	if want := `href="../../example.com/m/file/m.go#L5"`; !strings.Contains(main, want) {
+		t.Errorf("main page does not link to the source of F with %s", want)
+	}
+	source := read("example.com/m/file/m.go/index.html")
+	for _, want := range []string{
+		`<tr class="Source-line" id="L5"><td class="Source-number"><a href="#L5">5</a></td><td class="Source-text">func F() {}</td></tr>`,
+		`href="../../../../static/frontend/source/source.min.css`,
+		`<meta name="robots" content="noindex"/>`,
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("source page does not contain %s", want)
+		}
+	}
+	if strings.Contains(source, "/files/") {
+		t.Error("source page links to the files of the dynamic server")
+	}
+
+	// Test files, files over the size limit, and the files of a package with
+	// a unit at the path of its source pages get no page.
+	for _, p := range []string{"example.com/m/file/m_test.go", "example.com/m/file/big.go", "example.com/m/a/file/a.go"} {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p), "index.html")); err == nil {
+			t.Errorf("%s was written", p)
+		}
+	}
+	if got := read("example.com/m/a/file/index.html"); !strings.Contains(got, "Package file is a unit") {
+		t.Error("source pages of example.com/m/a replaced the page of example.com/m/a/file")
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// With GenerateOptions.SubresourceIntegrity set, the <script> elements of the
+// pages that load files of the site, and their <link> elements to style
+// sheets of the site, get an integrity attribute with the SHA-384 hash of
+// the file, and crossorigin="anonymous", so that browsers refuse a file
+// that a host or CDN changed. The hashes must be of the files as served:
+// assets are written after the pages, rewritten as they are copied, and
+// some, such as the style sheets of a pinned color scheme, are rewritten
+// once every page is. So the attributes are added to the written pages in
+// a pass of their own, at the end of a run.
+//
+// The pages of the download bundles are left alone. They are read from
+// the local file system, from which browsers do not load the files of
+// elements with a crossorigin attribute.
+
+// addIntegrity adds integrity attributes to the pages of out, whose paths
+// from the root of the host are under basePath.
+func addIntegrity(out *siteOutput, basePath string) error {
+	hashes := map[string]string{} // integrity of the files, by slash-separated path; "" if missing
+	integrity := func(p string) string {
+		if h, ok := hashes[p]; ok {
+			return h
+		}
+		h := ""
+		if data, err := os.ReadFile(filepath.Join(out.dir, filepath.FromSlash(p))); err == nil {
+			h = integrityValue(data)
+		}
+		hashes[p] = h
+		return h
+	}
+	for _, p := range slices.Sorted(maps.Keys(out.written)) {
+		if path.Ext(p) != ".html" {
+			continue
+		}
+		file := filepath.Join(out.dir, filepath.FromSlash(p))
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		marked := addPageIntegrity(data, func(ref string) string {
+			target, ok := integrityTarget(p, ref, basePath)
+			if !ok {
+				return ""
+			}
+			return integrity(target)
+		})
+		if !bytes.Equal(marked, data) {
+			if err := out.writeFile(file, marked); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// integrityValue returns the value of the integrity attribute of the
+// elements loading a file with contents data.
+func integrityValue(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// integrityTarget returns the slash-separated path of the file of the
+// output directory that ref, a URL of the page at the path p, refers to,
+// and whether it refers to one. The paths from the root of the host are
+// under basePath.
+func integrityTarget(p, ref, basePath string) (string, bool) {
+	if !isLocalReference(ref) {
+		return "", false
+	}
+	target, _, _ := strings.Cut(ref, "?")
+	target, _, _ = strings.Cut(target, "#")
+	if strings.HasPrefix(target, "/") {
+		rest, ok := strings.CutPrefix(target, basePath)
+		if !ok {
+			return "", false
+		}
+		target = rest
+	} else {
+		target = path.Join(path.Dir(p), target)
+	}
+	if target == "" || target == "." || target == ".." || strings.HasPrefix(target, "../") {
+		return "", false
+	}
+	return target, true
+}
+
+// addPageIntegrity returns the HTML document data with an integrity
+// attribute on each element loading a script or style sheet, whose URL
+// integrity returns a non-empty value for, and crossorigin set. The rest
+// of the document is kept byte for byte.
+func addPageIntegrity(data []byte, integrity func(ref string) string) []byte {
+	z := html.NewTokenizer(bytes.NewReader(data))
+	var buf bytes.Buffer
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return data
+			}
+			return buf.Bytes()
+		}
+		raw := append([]byte(nil), z.Raw()...)
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			buf.Write(raw)
+			continue
+		}
+		tok := z.Token()
+		ref := ""
+		switch tok.Data {
+		case "script":
+			ref = tokenAttr(tok, "src")
+		case "link":
+			if slices.Contains(strings.Fields(strings.ToLower(tokenAttr(tok, "rel"))), "stylesheet") {
+				ref = tokenAttr(tok, "href")
+			}
+		}
+		h := ""
+		if ref != "" {
+			h = integrity(ref)
+		}
+		if h == "" {
+			buf.Write(raw)
+			continue
+		}
+		tok.Attr = slices.DeleteFunc(tok.Attr, func(a html.Attribute) bool { return a.Key == "integrity" })
+		tok.Attr = append(tok.Attr, html.Attribute{Key: "integrity", Val: h})
+		if !hasTokenAttr(tok, "crossorigin") {
+			tok.Attr = append(tok.Attr, html.Attribute{Key: "crossorigin", Val: "anonymous"})
+		}
+		buf.WriteString(tok.String())
+	}
+}
+
+// tokenAttr returns the value of the attribute key of tok, or "" if it has
+// none.
+func tokenAttr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
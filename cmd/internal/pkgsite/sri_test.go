@@ -0,0 +1,137 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestIntegrityTarget(t *testing.T) {
+	for _, test := range []struct {
+		p, ref, basePath string
+		want             string
+	}{
+		{"a/b/index.html", "../../static/x.js?v=1", "/", "static/x.js"},
+		{"index.html", "static/x.css#y", "/", "static/x.css"},
+		{"404.html", "/docs/static/x.js", "/docs/", "static/x.js"},
+		{"404.html", "/other/static/x.js", "/docs/", ""},
+		{"a/index.html", "../../x.js", "/", ""},
+		{"a/index.html", "https://cdn.example.com/x.js", "/", ""},
+		{"a/index.html", "//cdn.example.com/x.js", "/", ""},
+	} {
+		got, ok := integrityTarget(test.p, test.ref, test.basePath)
+		if got != test.want || ok != (test.want != "") {
+			t.Errorf("integrityTarget(%q, %q, %q) = %q, %t, want %q", test.p, test.ref, test.basePath, got, ok, test.want)
+		}
+	}
+}
+
+func TestAddPageIntegrity(t *testing.T) {
+	const page = `<!DOCTYPE html><html><head>` +
+		`<link rel="stylesheet" href="a.css"/>` +
+		`<link rel="icon" href="a.css"/>` +
+		`<link rel="Alternate StyleSheet" href="b.css" crossorigin="use-credentials">` +
+		`<script src="a.js" integrity="sha384-stale"></script>` +
+		`<script src="missing.js"></script>` +
+		`<script>var s = "<script src=a.js>";</script>` +
+		`</head><body><p class=x>a.js</p></body></html>`
+	hashes := map[string]string{"a.css": "sha384-A", "b.css": "sha384-B", "a.js": "sha384-J"}
+	got := string(addPageIntegrity([]byte(page), func(ref string) string { return hashes[ref] }))
+	want := `<!DOCTYPE html><html><head>` +
+		`<link rel="stylesheet" href="a.css" integrity="sha384-A" crossorigin="anonymous"/>` +
+		`<link rel="icon" href="a.css"/>` +
+		`<link rel="Alternate StyleSheet" href="b.css" crossorigin="use-credentials" integrity="sha384-B">` +
+		`<script src="a.js" integrity="sha384-J" crossorigin="anonymous">` + `</script>` +
+		`<script src="missing.js"></script>` +
+		`<script>var s = "<script src=a.js>";</script>` +
+		`</head><body><p class=x>a.js</p></body></html>`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGenerateStaticSiteSRI(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	opts := GenerateOptions{OutDir: outDir, BasePath: "/docs/", SubresourceIntegrity: true, StrictCSP: true, ColorScheme: "dark"}
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	tagRE := regexp.MustCompile(`<(?:script|link)\b[^>]*>`)
+	attrRE := regexp.MustCompile(`\s(src|href|rel|integrity|crossorigin)="([^"]*)"`)
+	checked := map[string]bool{}
+	err := filepath.WalkDir(outDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(file) != ".html" {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(outDir, file)
+		p := filepath.ToSlash(rel)
+		for _, tag := range tagRE.FindAllString(string(data), -1) {
+			attrs := map[string]string{}
+			for _, m := range attrRE.FindAllStringSubmatch(tag, -1) {
+				attrs[m[1]] = m[2]
+			}
+			ref := attrs["src"]
+			if strings.HasPrefix(tag, "<link") {
+				if attrs["rel"] != "stylesheet" {
+					continue
+				}
+				ref = attrs["href"]
+			}
+			if ref == "" {
+				continue
+			}
+			target, _, _ := strings.Cut(ref, "?")
+			if t, ok := strings.CutPrefix(target, "/docs/"); ok {
+				target = t
+			} else {
+				target = path.Join(path.Dir(p), target)
+			}
+			asset, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(target)))
+			if err != nil {
+				t.Errorf("%s: %s: %v", p, tag, err)
+				continue
+			}
+			if want := integrityValue(asset); attrs["integrity"] != want || attrs["crossorigin"] != "anonymous" {
+				t.Errorf("%s: %s: want integrity %q and crossorigin anonymous", p, tag, want)
+			}
+			checked[p] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"index.html", "example.com/m/index.html", "404.html"} {
+		if !checked[p] {
+			t.Errorf("%s: no element with an integrity attribute", p)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"rsc.io/markdown"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/licenses"
+	"github.com/wow-look-at-my/static-pkgsite/internal/sanitizer"
+)
+
+// The site has three informational pages, /about, /license-policy and
+// /search-help, which the pages of units and the homepage link. Their
+// content on pkg.go.dev describes its proxy, its removal requests and its
+// search backend, so the generator replaces it with that of the Markdown
+// files of staticpages, written for a static site.
+//
+// GenerateOptions.StaticPages, keyed by the names of the pages, replaces the
+// content of a page with that of another Markdown file, or disables it: the
+// page is not written, and the links of the other pages to it are removed.
+// A link within running text, such as "See our license policy.", is
+// replaced by its content; a link on its own, such as the "not legal
+// advice" link of the licenses of a unit, is removed, with the list item
+// holding it if nothing else is left in it.
+
+// staticPageNames are the names of the informational pages, which are
+// their URL paths without the leading slash.
+var staticPageNames = []string{"about", "license-policy", "search-help"}
+
+// defaultStaticPages holds the content of the informational pages, as
+// staticpages/<name>.md.
+//
+//go:embed staticpages/*.md
+var defaultStaticPages embed.FS
+
+// A StaticPage configures one of the informational pages of the site.
+type StaticPage struct {
+	// Markdown is a Markdown file whose content replaces that of the page.
+	Markdown string `json:"markdown,omitempty"`
+	// Disabled leaves the page out of the site, and the links to it out
+	// of the other pages.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// LoadStaticPages reads the configuration of the informational pages from
+// a JSON file: an object mapping the names of the pages, "about",
+// "license-policy" and "search-help", to StaticPages. Markdown file names
+// are relative to the JSON file.
+func LoadStaticPages(file string) (map[string]StaticPage, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pages map[string]StaticPage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&pages); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	dir := filepath.Dir(file)
+	for name, p := range pages {
+		if p.Markdown != "" && !filepath.IsAbs(p.Markdown) {
+			p.Markdown = filepath.Join(dir, p.Markdown)
+			pages[name] = p
+		}
+	}
+	return pages, nil
+}
+
+// siteStaticPages holds the informational pages of the site.
+type siteStaticPages struct {
+	urlPaths []string          // URL paths of the pages to write
+	content  map[string][]byte // HTML content of the pages, by URL path
+	disabled map[string]bool   // URL paths of the disabled pages
+}
+
+// newSiteStaticPages reads the content of the informational pages, as
+// configured by pages, which may be nil.
+func newSiteStaticPages(pages map[string]StaticPage) (*siteStaticPages, error) {
+	for name := range pages {
+		if !slices.Contains(staticPageNames, name) {
+			return nil, fmt.Errorf("unknown static page %q; want one of %s", name, strings.Join(staticPageNames, ", "))
+		}
+	}
+	sp := &siteStaticPages{content: map[string][]byte{}, disabled: map[string]bool{}}
+	for _, name := range staticPageNames {
+		p := pages[name]
+		urlPath := "/" + name
+		if p.Disabled {
+			if p.Markdown != "" {
+				return nil, fmt.Errorf("static page %s: disabled, and has Markdown %s", name, p.Markdown)
+			}
+			sp.disabled[urlPath] = true
+			continue
+		}
+		var (
+			md  []byte
+			err error
+		)
+		if p.Markdown != "" {
+			md, err = os.ReadFile(p.Markdown)
+		} else {
+			md, err = defaultStaticPages.ReadFile("staticpages/" + name + ".md")
+			if err == nil && name == "license-policy" {
+				md = append(md, licenseList()...)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("static page %s: %w", name, err)
+		}
+		sp.urlPaths = append(sp.urlPaths, urlPath)
+		sp.content[urlPath] = renderStaticPage(md)
+	}
+	return sp, nil
+}
+
+// licenseList returns the Markdown listing the license file names and the
+// licenses that are detected, for the license policy page.
+func licenseList() []byte {
+	var b bytes.Buffer
+	names := append([]string(nil), licenses.FileNames...)
+	sort.Strings(names)
+	fmt.Fprintf(&b, "\nLicenses are looked for in files with the following names, which are matched without regard to case: %s.\n", strings.Join(names, ", "))
+	b.WriteString("\nThe following licenses are detected:\n\n")
+	for _, l := range licenses.AcceptedLicenses() {
+		fmt.Fprintf(&b, "- [%s](%s)\n", l.Name, l.URL)
+	}
+	return b.Bytes()
+}
+
+// renderStaticPage returns the sanitized HTML of the Markdown md.
+func renderStaticPage(md []byte) []byte {
+	p := markdown.Parser{
+		HeadingIDs:    true,
+		Strikethrough: true,
+		AutoLinkText:  true,
+		Table:         true,
+	}
+	var buf bytes.Buffer
+	p.Parse(string(md)).PrintHTML(&buf)
+	return sanitizer.SanitizeBytes(buf.Bytes())
+}
+
+// contentTransform returns the page transform replacing the content of
+// the informational page at urlPath with its configured content. The
+// about page keeps its left navigation, which lists its headings.
+func (sp *siteStaticPages) contentTransform(urlPath string) pageTransform {
+	return replaceContent(sp.content[urlPath])
+}
+
+// replaceContent returns the page transform replacing the content of an
+// informational page with the HTML content.
+func replaceContent(content []byte) pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		main := findElementFunc(doc, func(n *html.Node) bool {
+			return n.DataAtom == atom.Main && attrValue(n, "id") == "main-content"
+		})
+		if main == nil {
+			return
+		}
+		container := findElementFunc(main, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && hasClass(n, "go-Content")
+		})
+		if container == nil {
+			return
+		}
+		nodes, err := html.ParseFragment(bytes.NewReader(content), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+		if err != nil {
+			return // sanitized HTML always parses
+		}
+		for container.FirstChild != nil {
+			container.RemoveChild(container.FirstChild)
+		}
+		for _, n := range nodes {
+			container.AppendChild(n)
+		}
+	}
+}
+
+// isDisabled reports whether href, a URL path, is that of a disabled page.
+func (sp *siteStaticPages) isDisabled(href string) bool {
+	p, _, _ := strings.Cut(href, "#")
+	p, _, _ = strings.Cut(p, "?")
+	if p != "/" {
+		p = strings.TrimSuffix(p, "/")
+	}
+	return sp.disabled[p]
+}
+
+// linksTransform returns the page transform removing the links to the
+// disabled pages, or nil if no page is disabled. It must come after the
+// transforms that add such links.
+func (sp *siteStaticPages) linksTransform() pageTransform {
+	if len(sp.disabled) == 0 {
+		return nil
+	}
+	return func(doc *html.Node, _ *headManager) {
+		var links []*html.Node
+		walkElements(doc, func(n *html.Node) {
+			if n.DataAtom == atom.A && sp.isDisabled(attrValue(n, "href")) {
+				links = append(links, n)
+			}
+		})
+		for _, a := range links {
+			parent := a.Parent
+			if parent == nil {
+				continue
+			}
+			if inRunningText(a) {
+				for a.FirstChild != nil {
+					c := a.FirstChild
+					a.RemoveChild(c)
+					parent.InsertBefore(c, a)
+				}
+				parent.RemoveChild(a)
+				continue
+			}
+			parent.RemoveChild(a)
+			if parent.DataAtom == atom.Li && isBlank(parent) && parent.Parent != nil {
+				parent.Parent.RemoveChild(parent)
+			}
+		}
+	}
+}
+
+// inRunningText reports whether the link a is followed by text, such as
+// the end of a sentence, which its content is part of.
+func inRunningText(a *html.Node) bool {
+	for n := a.NextSibling; n != nil; n = n.NextSibling {
+		switch n.Type {
+		case html.TextNode:
+			if strings.TrimSpace(n.Data) != "" {
+				return true
+			}
+		case html.ElementNode:
+			return false
+		}
+	}
+	return false
+}
+
+// isBlank reports whether n has nothing in it but spaces and comments.
+func isBlank(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.TextNode:
+			if strings.TrimSpace(c.Data) != "" {
+				return false
+			}
+		case html.CommentNode:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,294 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestLoadStaticPages(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pages.json")
+	if err := os.WriteFile(file, []byte(`{"about": {"markdown": "about.md"}, "search-help": {"disabled": true}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := LoadStaticPages(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pages["about"].Markdown, filepath.Join(dir, "about.md"); got != want {
+		t.Errorf("about: got Markdown %q, want %q", got, want)
+	}
+	if !pages["search-help"].Disabled {
+		t.Error("search-help is not disabled")
+	}
+
+	if err := os.WriteFile(file, []byte(`{"about": {"title": "x"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadStaticPages(file); err == nil {
+		t.Error("unknown field: got nil error")
+	}
+}
+
+func TestNewSiteStaticPages(t *testing.T) {
+	sp, err := newSiteStaticPages(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(sp.urlPaths, " "), "/about /license-policy /search-help"; got != want {
+		t.Errorf("got pages %s, want %s", got, want)
+	}
+	for p, content := range sp.content {
+		if bytes.Contains(content, []byte("pkg.go.dev")) {
+			t.Errorf("%s mentions pkg.go.dev:\n%s", p, content)
+		}
+	}
+	for _, id := range []string{"adding-a-package", "build-context", "best-practices"} {
+		if !bytes.Contains(sp.content["/about"], []byte(`id="`+id+`"`)) {
+			t.Errorf("the about page has no heading %s", id)
+		}
+	}
+	if !bytes.Contains(sp.content["/license-policy"], []byte("Apache-2.0")) {
+		t.Error("the license policy does not list the detected licenses")
+	}
+
+	for _, pages := range []map[string]StaticPage{
+		{"faq": {Disabled: true}},
+		{"about": {Markdown: filepath.Join(t.TempDir(), "missing.md")}},
+		{"about": {Markdown: "about.md", Disabled: true}},
+	} {
+		if _, err := newSiteStaticPages(pages); err == nil {
+			t.Errorf("%v: got nil error", pages)
+		}
+	}
+}
+
+func TestStaticPagesLinksTransform(t *testing.T) {
+	sp, err := newSiteStaticPages(map[string]StaticPage{"about": {Disabled: true}, "license-policy": {Disabled: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		in, want string
+	}{
+		{
+			`<p>See our <a href="/license-policy">license policy</a>.</p>`,
+			`<p>See our license policy.</p>`,
+		},
+		{
+			`<p>This is not legal advice. <a href="/license-policy">Read disclaimer.</a></p>`,
+			`<p>This is not legal advice. </p>`,
+		},
+		{
+			`<span><span>None detected</span> <a href="/license-policy" class="Disclaimer-link"><em>not legal advice</em></a> </span>`,
+			`<span><span>None detected</span>  </span>`,
+		},
+		{
+			`<ul><li>x</li><li> <a href="/about#best-practices">Learn more</a> </li></ul>`,
+			`<ul><li>x</li></ul>`,
+		},
+		{
+			`<div><a href="/about#build-context">Rendered for</a> linux/amd64</div>`,
+			`<div>Rendered for linux/amd64</div>`,
+		},
+		{
+			`<p><a href="/search-help">Search help</a><a href="/about/">About</a></p>`,
+			`<p><a href="/search-help">Search help</a></p>`,
+		},
+	} {
+		doc, err := html.Parse(strings.NewReader(test.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sp.linksTransform()(doc, nil)
+		body := findElement(doc, "body")
+		var buf bytes.Buffer
+		for c := body.FirstChild; c != nil; c = c.NextSibling {
+			if err := html.Render(&buf, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.in, got, test.want)
+		}
+	}
+
+	sp, err = newSiteStaticPages(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp.linksTransform() != nil {
+		t.Error("got a links transform with no disabled page")
+	}
+}
+
+// staticPagesModules is a site of two modules, one with a license and one
+// without, whose pages link all the informational pages.
+const staticPagesModules = `
+-- a/go.mod --
+module example.com/a
+
+go 1.21
+-- a/a.go --
+//go:build linux
+
+// Package a is licensed.
+package a
+
+// A is a.
+const A = 1
+-- b/go.mod --
+module example.com/b
+
+go 1.21
+-- b/b.go --
+// Package b is not licensed.
+package b
+`
+
+// writeStaticPagesModules writes staticPagesModules, and the license of
+// example.com/a, and returns the directories of the modules.
+func writeStaticPagesModules(t *testing.T) []string {
+	t.Helper()
+	dir, _ := testhelper.WriteTxtarToTempDir(t, staticPagesModules)
+	license, err := os.ReadFile(filepath.Join("..", "..", "..", "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a", "LICENSE"), license, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+}
+
+func TestGenerateStaticSiteStaticPages(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	mods := writeStaticPagesModules(t)
+	mdDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(mdDir, "about.md"), []byte("# About us {#about-us}\n\nThe docs of [a](/example.com/a).\n\n<script>alert(1)</script>\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: mods, UseListedMods: true}
+	opts := GenerateOptions{
+		OutDir:      outDir,
+		StaticPages: map[string]StaticPage{"about": {Markdown: filepath.Join(mdDir, "about.md")}},
+	}
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+		t.Fatal(err)
+	}
+	// The pages link each informational page, which the test of disabled
+	// pages relies on.
+	links := staticPageLinks(t, outDir)
+	for _, name := range staticPageNames {
+		if len(links[name]) == 0 {
+			t.Errorf("no page links %s", name)
+		}
+	}
+	about, err := os.ReadFile(filepath.Join(outDir, "about", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`<h1 id="about-us">About us</h1>`, `href="../example.com/a"`, `class="LeftNav"`} {
+		if !bytes.Contains(about, []byte(want)) {
+			t.Errorf("the about page does not contain %s", want)
+		}
+	}
+	if bytes.Contains(about, []byte("alert(1)")) {
+		t.Error("the about page has the script of its Markdown")
+	}
+	for _, p := range []string{"license-policy", "search-help"} {
+		page, err := os.ReadFile(filepath.Join(outDir, p, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := page[bytes.Index(page, []byte(`id="main-content"`)):]
+		content = content[:bytes.Index(content, []byte("</main>"))]
+		if bytes.Contains(content, []byte("pkg.go.dev")) {
+			t.Errorf("%s mentions pkg.go.dev", p)
+		}
+	}
+}
+
+func TestGenerateStaticSiteDisabledStaticPages(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	mods := writeStaticPagesModules(t)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: mods, UseListedMods: true}
+	opts := GenerateOptions{
+		OutDir: outDir,
+		StaticPages: map[string]StaticPage{
+			"about":          {Disabled: true},
+			"license-policy": {Disabled: true},
+			"search-help":    {Disabled: true},
+		},
+	}
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range staticPageNames {
+		if _, err := os.Stat(filepath.Join(outDir, name)); !os.IsNotExist(err) {
+			t.Errorf("the disabled page %s is written", name)
+		}
+	}
+	for name, files := range staticPageLinks(t, outDir) {
+		for _, f := range files {
+			t.Errorf("%s links the disabled page %s", f, name)
+		}
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+}
+
+// staticPageLinks returns the HTML files of the site in outDir that link
+// each informational page, by page name.
+func staticPageLinks(t *testing.T, outDir string) map[string][]string {
+	t.Helper()
+	links := map[string][]string{}
+	err := filepath.WalkDir(outDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".html" {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		doc, err := html.Parse(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(outDir, filepath.Dir(p))
+		walkElements(doc, func(n *html.Node) {
+			href := attrValue(n, "href")
+			if n.Data != "a" || href == "" || strings.Contains(href, "://") {
+				return
+			}
+			target, _, _ := strings.Cut(href, "#")
+			target, _, _ = strings.Cut(target, "?")
+			if name := path.Join(filepath.ToSlash(rel), target); slices.Contains(staticPageNames, name) {
+				links[name] = append(links[name], p)
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return links
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/stdlib"
+)
+
+// With ServerConfig.Stdlib set, the standard library is documented from
+// the sources of a Go tree, without network access: that of
+// StdlibArchive, GoRepoPath, or the GOROOT of the go command, in that
+// order. The go command loads its packages as those of the std module,
+// which has a single go.mod file, in GOROOT/src, for all of them. Their
+// pages are at their import paths, such as /net/http, and that of the
+// module at /std, as on pkg.go.dev. The commands of the cmd module are
+// not documented. Internal packages are left out, as if std did not have
+// them, unless StdlibInternal is set.
+//
+// StdlibArchive is a Go release archive, as downloaded from
+// https://go.dev/dl, such as go1.22.0.src.tar.gz or a .zip file, which
+// holds the Go tree in its go directory. It is extracted once into the
+// user cache directory, where later runs find it.
+
+// stdlibRoot returns the GOROOT that the standard library of serverCfg is
+// documented from.
+func stdlibRoot(serverCfg ServerConfig) (string, error) {
+	goroot := serverCfg.GoRepoPath
+	if serverCfg.StdlibArchive != "" {
+		var err error
+		goroot, err = extractGoArchive(serverCfg.StdlibArchive)
+		if err != nil {
+			return "", fmt.Errorf("extracting Go release archive: %w", err)
+		}
+	} else if goroot == "" {
+		goroot = internal.GOROOT()
+		if goroot == "" {
+			return "", errors.New("cannot document the standard library: no GOROOT")
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(goroot, "src", "go.mod")); err != nil || !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("cannot document the standard library: %s is not a Go tree", goroot)
+	}
+	return filepath.Abs(goroot)
+}
+
+// extractGoArchive extracts the Go tree of the release archive file into
+// the user cache directory, unless an earlier call did, and returns its
+// directory.
+func extractGoArchive(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cache, "pkgsite", "goroot-"+hex.EncodeToString(h.Sum(nil))[:16])
+	goroot := filepath.Join(dir, "go")
+	if _, err := os.Stat(goroot); err == nil {
+		return goroot, nil
+	}
+
+	// The archive is extracted next to its final place, which it takes
+	// once complete, so that an interrupted run leaves nothing behind that
+	// a later one would use.
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), "extract-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasSuffix(file, ".zip"):
+		fi, err := f.Stat()
+		if err != nil {
+			return "", err
+		}
+		err = extractZip(f, fi.Size(), tmp)
+	case strings.HasSuffix(file, ".tar.gz"), strings.HasSuffix(file, ".tgz"):
+		err = extractTarGz(f, tmp)
+	default:
+		return "", fmt.Errorf("%s: want a .tar.gz or .zip file", file)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", file, err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "go", "src", "go.mod")); err != nil {
+		return "", fmt.Errorf("%s: no Go tree in its go directory", file)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		// Another run may have extracted the same archive meanwhile.
+		if _, statErr := os.Stat(goroot); statErr == nil {
+			return goroot, nil
+		}
+		return "", err
+	}
+	return goroot, nil
+}
+
+// extractTarGz extracts the regular files of the gzipped tar archive r into
+// dir.
+func extractTarGz(r io.Reader, dir string) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := extractFile(dir, hdr.Name, hdr.FileInfo().Mode(), tr); err != nil {
+			return err
+		}
+	}
+}
+
+// extractZip extracts the regular files of the zip archive r of the given
+// size into dir.
+func extractZip(r io.ReaderAt, size int64, dir string) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = extractFile(dir, zf.Name, zf.Mode(), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile writes the contents of r to the file name of an archive
+// under dir, with the permissions of mode. The name must not leave dir.
+func extractFile(dir, name string, mode os.FileMode, r io.Reader) error {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dropStdlibInternal returns units without the internal units of std,
+// which it adds to left.
+func dropStdlibInternal(units []*siteUnit, left map[string]bool) []*siteUnit {
+	return slices.DeleteFunc(slices.Clone(units), func(u *siteUnit) bool {
+		if u.meta.ModulePath != stdlib.ModulePath || !slices.Contains(strings.Split(u.path, "/"), "internal") {
+			return false
+		}
+		left[u.path] = true
+		return true
+	})
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+)
+
+func TestGenerateStaticSiteStdlib(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	// Nothing is fetched.
+	t.Setenv("GOPROXY", "off")
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Stdlib:         true,
+		UseListedMods:  true,
+		UseLocalStdlib: true,
+	}
+	opts := GenerateOptions{OutDir: outDir, IncludeGlobs: []string{"std", "net/http", "net/http/**"}}
+	if _, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string][]string{
+		"net/http":          {"Package http provides HTTP client and server implementations.", "func ListenAndServe("},
+		"net/http/httptest": {"Package httptest provides utilities for HTTP testing."},
+		"std":               {`href="../net/http"`},
+	} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p), "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(data), w) {
+				t.Errorf("page of %s does not contain %s", p, w)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "net", "http", "internal")); !os.IsNotExist(err) {
+		t.Errorf("internal package: got %v, want not exist", err)
+	}
+	checkInternalLinks(t, outDir, "net/")
+}
+
+// goTree holds the files of a fake Go tree, as in the go directory of a
+// release archive.
+var goTree = map[string]string{
+	"go/VERSION":         "go1.22.0\n",
+	"go/src/go.mod":      "module std\n\ngo 1.22\n",
+	"go/src/fmt/doc.go":  "// Package fmt formats.\npackage fmt\n",
+	"go/src/errors/e.go": "package errors\n",
+}
+
+func TestExtractGoArchive(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+
+	var tgz bytes.Buffer
+	zw := gzip.NewWriter(&tgz)
+	tw := tar.NewWriter(zw)
+	for name, content := range goTree {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var zipData bytes.Buffer
+	w := zip.NewWriter(&zipData)
+	for name, content := range goTree {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"go1.22.0.src.tar.gz": tgz.Bytes(), "go1.22.0.windows-amd64.zip": zipData.Bytes()} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		goroot, err := extractGoArchive(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range goTree {
+			got, err := os.ReadFile(filepath.Join(goroot, "..", filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("%s: got %q, want %q", name, got, want)
+			}
+		}
+		// A second extraction finds the first one.
+		again, err := extractGoArchive(file)
+		if err != nil || again != goroot {
+			t.Errorf("second extraction: got %q, %v, want %q", again, err, goroot)
+		}
+		root, err := stdlibRoot(ServerConfig{Stdlib: true, StdlibArchive: file})
+		if err != nil || root != goroot {
+			t.Errorf("stdlibRoot: got %q, %v, want %q", root, err, goroot)
+		}
+	}
+
+	// Files must stay in the directory they are extracted to.
+	var evil bytes.Buffer
+	w = zip.NewWriter(&evil)
+	if _, err := w.Create("../escape"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "evil.zip")
+	if err := os.WriteFile(file, evil.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := extractGoArchive(file); err == nil {
+		t.Error("archive with a file outside its directory: got nil error")
+	}
+}
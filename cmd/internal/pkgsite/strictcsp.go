@@ -0,0 +1,386 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// With GenerateOptions.StrictCSP set, the Content-Security-Policy of the pages
+// has no 'unsafe-inline', and the inline code that it would block is moved
+// out of the pages into files under inlineCodeDir, named by the hash of
+// their contents, so that pages with the same code share its file:
+//
+//   - an inline script loads the file of its text instead. A script file
+//     serves pages at any depth, so it cannot hold their relative paths:
+//     the string literals of root paths of the site in a classic script,
+//     such as loadScript('/static/...'), become URLs resolved at run time
+//     against the site root that setBase records on the page. Those of a
+//     module script are made relative to its file, for its imports.
+//   - a <style> element becomes a <link> to the file of its text.
+//   - the style attributes of a page become classes, whose rules are in a
+//     style sheet of their own, marked !important so that they still win
+//     over the other style sheets, as the attributes did.
+//
+// Inline event handlers, such as onclick attributes, and javascript: URLs
+// cannot be moved out of a page. They are left for the policy to block,
+// and reported.
+
+// inlineCodeDir is the site directory of the files of the inline code.
+const inlineCodeDir = "static/inline"
+
+// styleClassPrefix starts the names of the classes of style attributes.
+const styleClassPrefix = "pkgsite-style-"
+
+// A cspExternalizer moves the inline code of pages out of them. It is safe
+// for concurrent use.
+type cspExternalizer struct {
+	mu      sync.Mutex
+	files   map[string][]byte          // contents of the files, by site path
+	refs    map[string][]assetRef      // the files that scripts load, by site path
+	blocked map[string]map[string]bool // URL paths of the pages with code the policy blocks, by kind
+}
+
+func newCSPExternalizer() *cspExternalizer {
+	return &cspExternalizer{files: map[string][]byte{}, refs: map[string][]assetRef{}, blocked: map[string]map[string]bool{}}
+}
+
+// add records the file of content, with extension ext, loading refs, and
+// returns its site path.
+func (e *cspExternalizer) add(content []byte, ext string, refs []assetRef) string {
+	sum := sha256.Sum256(content)
+	p := inlineCodeDir + "/" + hex.EncodeToString(sum[:8]) + ext
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.files[p]; !ok {
+		e.files[p] = content
+		if len(refs) > 0 {
+			e.refs[p] = refs
+		}
+	}
+	return p
+}
+
+// block records that the page at urlPath has code of the given kind,
+// which the policy blocks.
+func (e *cspExternalizer) block(kind, urlPath string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.blocked[kind] == nil {
+		e.blocked[kind] = map[string]bool{}
+	}
+	e.blocked[kind][urlPath] = true
+}
+
+// transform returns the page transform moving the inline code of the page
+// at urlPath out of it, including that of the head fragments, and dropping
+// 'unsafe-inline' from its policy. It must come after the transforms that
+// add code to the page.
+func (e *cspExternalizer) transform(urlPath string) pageTransform {
+	return func(doc *html.Node, head *headManager) {
+		rules := map[string]string{} // rules of the style attributes, by class
+		for name, f := range head.fragments {
+			var nodes []*html.Node
+			for _, n := range f.nodes {
+				if r := e.externalize(n, urlPath, rules); r != nil {
+					nodes = append(nodes, r)
+				}
+			}
+			f.nodes = nodes
+			head.fragments[name] = f
+		}
+		e.externalizeChildren(doc, urlPath, rules)
+
+		if len(rules) > 0 {
+			var css strings.Builder
+			for _, class := range slices.Sorted(maps.Keys(rules)) {
+				fmt.Fprintf(&css, ".%s{%s}\n", class, rules[class])
+			}
+			p := e.add([]byte(css.String()), ".css", nil)
+			head.register("inline-styles", headOrderStyle, styleSheetLink("/"+p, nil))
+		}
+		if f, ok := head.fragments["csp"]; ok {
+			for _, n := range f.nodes {
+				setAttr(n, "content", strictPolicy(attrValue(n, "content")))
+			}
+		}
+	}
+}
+
+// externalizeChildren applies externalize to the descendants of n.
+func (e *cspExternalizer) externalizeChildren(n *html.Node, urlPath string, rules map[string]string) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch r := e.externalize(c, urlPath, rules); {
+		case r == nil:
+			n.RemoveChild(c)
+		case r != c:
+			n.InsertBefore(r, c)
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+// externalize moves the inline code of n and of its descendants out of
+// the page at urlPath, adding the rules of their style attributes to
+// rules, and returns the node to put in place of n, which is nil to remove
+// it.
+func (e *cspExternalizer) externalize(n *html.Node, urlPath string, rules map[string]string) *html.Node {
+	if n.Type != html.ElementNode {
+		return n
+	}
+	e.externalizeAttrs(n, urlPath, rules)
+	switch {
+	case n.Data == "script" && n.Namespace == "" && !hasAttr(n, "src"):
+		text := nodeText(n)
+		switch scriptTextKind(n) {
+		case scriptJS:
+		case scriptOther:
+			if isTemplateScript(n) && strings.TrimSpace(text) != "" {
+				e.block("inline scripts in <template> elements", urlPath)
+			}
+			return n
+		default:
+			return n // data, which the policy does not cover
+		}
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		var (
+			js   []byte
+			refs []assetRef
+		)
+		if strings.EqualFold(strings.TrimSpace(attrValue(n, "type")), "module") {
+			js = absoluteToRelativeAsset([]byte(text), inlineCodeDir+"/x.js")
+		} else {
+			js, refs = resolveRootLiterals(text)
+			// A classic script file with defer or async would no longer
+			// run where the inline script did.
+			n.Attr = slices.DeleteFunc(n.Attr, func(a html.Attribute) bool { return a.Key == "defer" || a.Key == "async" })
+		}
+		for n.FirstChild != nil {
+			n.RemoveChild(n.FirstChild)
+		}
+		setAttr(n, "src", "/"+e.add(js, ".js", refs))
+		return n
+	case n.Data == "style" && n.Namespace == "":
+		if strings.TrimSpace(nodeText(n)) == "" {
+			return nil
+		}
+		css := absoluteToRelativeAsset([]byte(nodeText(n)), inlineCodeDir+"/x.css")
+		return styleSheetLink("/"+e.add(css, ".css", nil), n)
+	case (n.Data == "style" || n.Data == "script") && n.Namespace != "":
+		if strings.TrimSpace(nodeText(n)) != "" {
+			e.block("<"+n.Data+"> elements of "+n.Namespace+" content", urlPath)
+		}
+		return n
+	}
+	e.externalizeChildren(n, urlPath, rules)
+	return n
+}
+
+// externalizeAttrs replaces the style attribute of n by a class, adding
+// its rule to rules, and records the attributes of n that the policy
+// blocks.
+func (e *cspExternalizer) externalizeAttrs(n *html.Node, urlPath string, rules map[string]string) {
+	style := ""
+	hasStyle := false
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		switch {
+		case a.Namespace == "" && a.Key == "style":
+			style, hasStyle = a.Val, true
+			continue
+		case a.Namespace == "" && strings.HasPrefix(a.Key, "on"):
+			e.block(a.Key+" attributes", urlPath)
+		case isURLAttr(n, a) && urlScheme(a.Val) == "javascript":
+			e.block("javascript: URLs", urlPath)
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+	if !hasStyle {
+		return
+	}
+	decls := importantDeclarations(style)
+	if decls == "" {
+		return
+	}
+	sum := sha256.Sum256([]byte(decls))
+	class := styleClassPrefix + hex.EncodeToString(sum[:5])
+	rules[class] = decls
+	setAttr(n, "class", strings.TrimSpace(attrValue(n, "class")+" "+class))
+}
+
+// isTemplateScript reports whether the script element n is inside a
+// <template> element and executable once the template is used.
+func isTemplateScript(n *html.Node) bool {
+	typ, _, _ := strings.Cut(strings.ToLower(attrValue(n, "type")), ";")
+	if typ = strings.TrimSpace(typ); typ != "" && !jsTypes[typ] {
+		return false
+	}
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.Data == "template" {
+			return true
+		}
+	}
+	return false
+}
+
+// styleSheetLink returns a <link> to the style sheet at href, with the
+// media and title attributes of the <style> element style, if not nil.
+func styleSheetLink(href string, style *html.Node) *html.Node {
+	link := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "link",
+		DataAtom: atom.Link,
+		Attr: []html.Attribute{
+			{Key: "rel", Val: "stylesheet"},
+			{Key: "href", Val: href},
+		},
+	}
+	if style != nil {
+		for _, key := range []string{"media", "title"} {
+			if hasAttr(style, key) {
+				setAttr(link, key, attrValue(style, key))
+			}
+		}
+	}
+	return link
+}
+
+// rootLiteralRE matches the string literals of scripts holding root paths
+// of the site's assets.
+var rootLiteralRE = regexp.MustCompile(`"/((?:static|third_party)/[^"'\\\s]*)"|'/((?:static|third_party)/[^"'\\\s]*)'`)
+
+// resolveRootLiterals returns the classic script js with its string
+// literals of root paths of assets replaced by expressions of their URLs
+// under the site root of the page, and references to the assets.
+func resolveRootLiterals(js string) ([]byte, []assetRef) {
+	var refs []assetRef
+	js = rootLiteralRE.ReplaceAllStringFunc(js, func(lit string) string {
+		p := lit[2 : len(lit)-1]
+		target, _, _ := strings.Cut(p, "?")
+		target, _, _ = strings.Cut(target, "#")
+		refs = append(refs, assetRef{Href: lit[1 : len(lit)-1], Target: target})
+		return `new URL("` + p + `",` + jsBaseURL + `).href`
+	})
+	return []byte(js), refs
+}
+
+// importantDeclarations returns the CSS declarations of a style attribute,
+// each marked !important.
+func importantDeclarations(style string) string {
+	var (
+		decls []string
+		start int
+		depth int
+		quote rune
+	)
+	add := func(d string) {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			return
+		}
+		if !strings.HasSuffix(strings.ToLower(strings.ReplaceAll(d, " ", "")), "!important") {
+			d += " !important"
+		}
+		decls = append(decls, d)
+	}
+	for i, r := range style {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case r == ';' && depth == 0:
+			add(style[start:i])
+			start = i + 1
+		}
+	}
+	add(style[start:])
+	return strings.Join(decls, "; ")
+}
+
+// strictPolicy returns the Content-Security-Policy policy without
+// 'unsafe-inline'.
+func strictPolicy(policy string) string {
+	return strings.ReplaceAll(policy, " 'unsafe-inline'", "")
+}
+
+// writeFiles writes the files of the code moved out of the pages to out,
+// and records them in assets.
+func (e *cspExternalizer) writeFiles(out *siteOutput, assets *assetGraph) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.files) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(out.dir, filepath.FromSlash(inlineCodeDir)), 0o755); err != nil {
+		return err
+	}
+	for _, p := range slices.Sorted(maps.Keys(e.files)) {
+		if err := out.writeFile(filepath.Join(out.dir, filepath.FromSlash(p)), e.files[p]); err != nil {
+			return err
+		}
+		assets.addFile(p, e.files[p])
+		assets.refs[p] = append(assets.refs[p], e.refs[p]...)
+	}
+	return nil
+}
+
+// loads returns the files that the scripts moved out of the pages load,
+// relative to the output directory.
+func (e *cspExternalizer) loads() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var files []string
+	for _, p := range slices.Sorted(maps.Keys(e.refs)) {
+		for _, r := range e.refs[p] {
+			files = append(files, r.Target)
+		}
+	}
+	return files
+}
+
+// warn writes to w a warning for each kind of code that the policy blocks
+// on some pages.
+func (e *cspExternalizer) warn(w io.Writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, kind := range slices.Sorted(maps.Keys(e.blocked)) {
+		pages := slices.Sorted(maps.Keys(e.blocked[kind]))
+		fmt.Fprintf(w, "Warning: the strict Content-Security-Policy blocks the %s of %d pages, such as %s\n", kind, len(pages), pages[0])
+	}
+}
+
+// pageTransforms returns transforms, followed by the transform moving the
+// inline code of the page at urlPath out of it if o moves it.
+func (o *siteOutput) pageTransforms(urlPath string, transforms []pageTransform) []pageTransform {
+	if o.external == nil {
+		return transforms
+	}
+	return append(transforms[:len(transforms):len(transforms)], o.external.transform(urlPath))
+}
@@ -0,0 +1,222 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestImportantDeclarations(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{" ; ", ""},
+		{"display: block;", "display: block !important"},
+		{"color:red;margin: 0 !important", "color:red !important; margin: 0 !important"},
+		{`background: url("a;b.png"); content: ';'`, `background: url("a;b.png") !important; content: ';' !important`},
+	} {
+		if got := importantDeclarations(test.in); got != test.want {
+			t.Errorf("importantDeclarations(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestResolveRootLiterals(t *testing.T) {
+	js, refs := resolveRootLiterals(`loadScript('/static/a/b.js?v=1'); f("/third_party/x.js"); g("/other/y.js", '//static/z.js')`)
+	want := `loadScript(new URL("static/a/b.js?v=1",` + jsBaseURL + `).href); f(new URL("third_party/x.js",` + jsBaseURL + `).href); g("/other/y.js", '//static/z.js')`
+	if string(js) != want {
+		t.Errorf("got\n%s\nwant\n%s", js, want)
+	}
+	wantRefs := []assetRef{{Href: "/static/a/b.js?v=1", Target: "static/a/b.js"}, {Href: "/third_party/x.js", Target: "third_party/x.js"}}
+	if diff := cmp.Diff(wantRefs, refs); diff != "" {
+		t.Errorf("refs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCSPExternalizer(t *testing.T) {
+	const page = `<!DOCTYPE html><html><head>
+<script>loadScript('/static/frontend/x.js')</script>
+<script defer>var a = 1;</script>
+<script type="module">import {f} from "/static/m.js"; f();</script>
+<script type="application/ld+json">{"url": "/"}</script>
+<script src="/static/ext.js"></script>
+<script> </script>
+<style media="print">.a { background: url(/static/i.png) }</style>
+</head><body>
+<div class="d" style="display: block;">x</div>
+<p style="display: block">y</p>
+<button onclick="go()">z</button>
+<a href="javascript:void(0)">w</a>
+<template><script>t()</script></template>
+</body></html>`
+	e := newCSPExternalizer()
+	var outputs [2]string
+	for i, urlPath := range []string{"/a", "/b/c"} {
+		got, err := processHTML([]byte(page), urlPath, nil, e.transform(urlPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs[i] = string(got)
+	}
+
+	files := map[string]string{}
+	for p, content := range e.files {
+		files[p] = string(content)
+	}
+	fileOf := func(substr string) string {
+		t.Helper()
+		for p, content := range files {
+			if strings.Contains(content, substr) {
+				return p
+			}
+		}
+		t.Fatalf("no file contains %q", substr)
+		return ""
+	}
+	classic := fileOf(`loadScript(new URL("static/frontend/x.js",`)
+	deferred := fileOf("var a = 1;")
+	module := fileOf(`import {f} from "../../static/m.js"`)
+	style := fileOf(".a { background: url(../../static/i.png) }")
+	attrs := fileOf("{display: block !important}")
+	if len(files) != 5 {
+		t.Errorf("got %d files, want 5: %v", len(files), files)
+	}
+	class := regexp.MustCompile(`pkgsite-style-[0-9a-f]+`).FindString(files[attrs])
+	if strings.Count(files[attrs], "\n") != 1 {
+		t.Errorf("the style attributes with the same declarations do not share a class: %q", files[attrs])
+	}
+
+	for i, prefix := range []string{"../", "../../"} {
+		got := outputs[i]
+		for _, want := range []string{
+			`<script src="` + prefix + classic + `"></script>`,
+			`<script src="` + prefix + deferred + `"></script>`,
+			`<script type="module" src="` + prefix + module + `"></script>`,
+			`<script type="application/ld+json">`,
+			`<script src="` + prefix + `static/ext.js"></script>`,
+			`<link rel="stylesheet" href="` + prefix + style + `" media="print"/>`,
+			`<link rel="stylesheet" href="` + prefix + attrs + `"/>`,
+			`<div class="d ` + class + `">x</div>`,
+			`<p class="` + class + `">y</p>`,
+			`<template><script>t()</script></template>`,
+			"script-src &#39;self&#39;; style-src &#39;self&#39;;",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("page %d does not contain %s:\n%s", i, want, got)
+			}
+		}
+		for _, dontWant := range []string{"unsafe-inline", "<style", "style=", "<script> </script>", "defer"} {
+			if strings.Contains(got, dontWant) {
+				t.Errorf("page %d contains %s:\n%s", i, dontWant, got)
+			}
+		}
+	}
+
+	var warnings bytes.Buffer
+	e.warn(&warnings)
+	want := `Warning: the strict Content-Security-Policy blocks the inline scripts in <template> elements of 2 pages, such as /a
+Warning: the strict Content-Security-Policy blocks the javascript: URLs of 2 pages, such as /a
+Warning: the strict Content-Security-Policy blocks the onclick attributes of 2 pages, such as /a
+`
+	if diff := cmp.Diff(want, warnings.String()); diff != "" {
+		t.Errorf("warnings mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateStaticSiteStrictCSP(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+-- a/a.go --
+// Package a does other things.
+package a
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+	var l recordingLogger
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Logger: &l, StrictCSP: true, Prefetch: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.MissingAssets) > 0 {
+		t.Errorf("missing assets: %v", report.MissingAssets)
+	}
+	if messages := strings.Join(l.lines, "\n"); strings.Contains(messages, "Content-Security-Policy") {
+		t.Errorf("the pages have code the policy blocks:\n%s", messages)
+	}
+
+	inlineScriptRE := regexp.MustCompile(`<script(?:\s+type="module")?>`)
+	srcRE := regexp.MustCompile(`(?:src|href)="((?:\.\./)*static/inline/[^"]*)"`)
+	pages := 0
+	err = filepath.WalkDir(outDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(file) != ".html" {
+			return err
+		}
+		pages++
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		page := string(data)
+		rel, _ := filepath.Rel(outDir, file)
+		if strings.Contains(page, "unsafe-inline") || !strings.Contains(page, "Content-Security-Policy") {
+			t.Errorf("%s: the policy is missing or allows inline code", rel)
+		}
+		if inlineScriptRE.MatchString(page) || strings.Contains(page, "<style") || strings.Contains(page, " style=") {
+			t.Errorf("%s: has inline code", rel)
+		}
+		for _, m := range srcRE.FindAllStringSubmatch(page, -1) {
+			if _, err := os.Stat(filepath.Join(filepath.Dir(file), filepath.FromSlash(m[1]))); err != nil {
+				t.Errorf("%s: %v", rel, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages == 0 {
+		t.Fatal("no pages")
+	}
+
+	// The scripts that set the theme and load the unit page scripts, and
+	// the prefetch hints, are loaded from files.
+	page, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scripts []string
+	for _, m := range srcRE.FindAllStringSubmatch(string(page), -1) {
+		data, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", filepath.FromSlash(m[1])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scripts = append(scripts, string(data))
+	}
+	all := strings.Join(scripts, "\n")
+	for _, want := range []string{"prefers-color-scheme", `loadScript(new URL("static/frontend/unit/unit.js",`, prefetchScript} {
+		if !strings.Contains(all, want) {
+			t.Errorf("the files loaded by the module page do not contain %s", want)
+		}
+	}
+}
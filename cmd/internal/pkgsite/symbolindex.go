@@ -0,0 +1,94 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend"
+	"github.com/wow-look-at-my/static-pkgsite/internal/log"
+)
+
+// With ServerConfig.SymbolIndex, the frontend serves the symbol index tab
+// of a module, listing the exported symbols of all its packages, a page of
+// symbols at a time: /<module>?tab=index, then /<module>?page=2&tab=index
+// and so on. The generator writes the pages at <module>/index,
+// <module>/index/2 and so on. Unlike the other tabs, they are meant for
+// search engines too.
+
+const (
+	// symbolIndexTab is the tab of the symbol index of a module.
+	symbolIndexTab = "index"
+	// defaultSymbolIndexPageSize is the number of symbols on a page of a
+	// symbol index if ServerConfig.SymbolIndexPageSize is not positive.
+	defaultSymbolIndexPageSize = 2000
+)
+
+// isSymbolIndexTab reports whether tab, as tabRequest returns it, is a page
+// of a symbol index.
+func isSymbolIndexTab(tab string) bool {
+	return tab == symbolIndexTab || strings.HasPrefix(tab, symbolIndexTab+"/")
+}
+
+// symbolIndexPages returns the URL paths to request the pages of the
+// symbol indexes of the modules of selected from, by the canonical path of
+// the module, with pageSize symbols a page. units holds the canonical paths
+// of all units of the site. links maps the site paths of the pages, such as
+// "example.com/m/index/2", to themselves, as tabPages returns them. A
+// module with a page at the path of a unit, such as of its own "index"
+// package, gets no index; the returned clashes list those paths.
+func symbolIndexPages(ctx context.Context, ds internal.DataSource, units map[string]bool, selected []*siteUnit, pageSize int) (pages map[string][]string, links map[string]string, clashes []string) {
+	pages = map[string][]string{}
+	links = map[string]string{}
+	for _, u := range selected {
+		if u.meta.Path != u.meta.ModulePath {
+			continue
+		}
+		pkgs, err := frontend.SymbolIndex(ctx, ds, u.meta)
+		if err != nil {
+			log.Errorf(ctx, "listing the symbols of %s: %v", u.path, err)
+			continue
+		}
+		total := 0
+		for _, p := range pkgs {
+			total += len(p.Symbols)
+		}
+		n := max((total+pageSize-1)/pageSize, 1)
+		var urls, paths []string
+		for i := 1; i <= n; i++ {
+			p, urlPath := u.path+"/"+symbolIndexTab, "/"+u.path+"?tab="+symbolIndexTab
+			if i > 1 {
+				p, urlPath = fmt.Sprintf("%s/%d", p, i), fmt.Sprintf("/%s?page=%d&tab=%s", u.path, i, symbolIndexTab)
+			}
+			if units[p] {
+				clashes = append(clashes, p)
+				paths = nil
+				break
+			}
+			urls = append(urls, urlPath)
+			paths = append(paths, p)
+		}
+		if paths == nil {
+			continue
+		}
+		pages[u.path] = urls
+		for _, p := range paths {
+			links[p] = p
+		}
+	}
+	return pages, links, clashes
+}
+
+// symbolIndexPageSize returns the number of symbols on a page of a symbol
+// index of serverCfg.
+func symbolIndexPageSize(serverCfg ServerConfig) int {
+	if serverCfg.SymbolIndexPageSize > 0 {
+		return serverCfg.SymbolIndexPageSize
+	}
+	return defaultSymbolIndexPageSize
+}
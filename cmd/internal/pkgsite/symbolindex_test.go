@@ -0,0 +1,137 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/html"
+)
+
+func TestTabRequestSymbolIndex(t *testing.T) {
+	for _, test := range []struct {
+		urlPath, want string
+	}{
+		{"/example.com/m?tab=index", "/example.com/m/index"},
+		{"/example.com/m?page=1&tab=index", "/example.com/m/index"},
+		{"/example.com/m?page=3&tab=index", "/example.com/m/index/3"},
+		{"/example.com/m?page=x&tab=index", "/example.com/m/index"},
+		{"/example.com/m?page=2&tab=imports", "/example.com/m/imports"},
+	} {
+		if got := tabPagePath(test.urlPath); got != test.want {
+			t.Errorf("tabPagePath(%q) = %q, want %q", test.urlPath, got, test.want)
+		}
+	}
+}
+
+func TestGenerateStaticSiteSymbolIndex(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+
+// Answer is the answer. It is 42.
+const Answer = 42
+
+// Client does things for you.
+type Client struct{}
+
+// NewClient returns a new client.
+func NewClient() *Client { return nil }
+
+// Do does a thing.
+func (c *Client) Do() {}
+
+// Hello says hello.
+func Hello() {}
+-- a/a.go --
+// Package a does other things.
+package a
+
+// Version is the version of a.
+var Version = "v1"
+
+// F returns nothing.
+func F() {}
+-- cmd/tool/main.go --
+// Command tool does nothing.
+package main
+
+func main() {}
+`, func(cfg *ServerConfig, opts *GenerateOptions) {
+		cfg.SymbolIndex = true
+		cfg.SymbolIndexPageSize = 4
+		cfg.SiteURL = "https://example.org/"
+		opts.Sitemap = true
+	})
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// Seven symbols make two pages of four.
+	var got bytes.Buffer
+	for _, p := range []string{"example.com/m/index/index.html", "example.com/m/index/2/index.html"} {
+		doc, err := html.Parse(strings.NewReader(read(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		index := findElementFunc(doc, func(n *html.Node) bool { return hasClass(n, "spk-SymbolIndex") })
+		if index == nil {
+			t.Fatalf("%s has no symbol index", p)
+		}
+		fmt.Fprintf(&got, "-- %s --\n", p)
+		if err := html.Render(&got, index); err != nil {
+			t.Fatal(err)
+		}
+		got.WriteString("\n")
+	}
+	golden := filepath.Join("testdata", "symbolindex.golden")
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), got.String()); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	// The module page links to the index; its packages do not.
+	if want := `href="../../example.com/m/index"`; !strings.Contains(read("example.com/m/index.html"), want) {
+		t.Errorf("module page does not link to its symbol index with %s", want)
+	}
+	if strings.Contains(read("example.com/m/a/index.html"), "tab=index") {
+		t.Error("package page links to a symbol index")
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "m", "index", "3")); !os.IsNotExist(err) {
+		t.Errorf("third page of the index: got %v, want not exist", err)
+	}
+	sitemap := read(sitemapFile)
+	for _, want := range []string{"https://example.org/example.com/m/index/", "https://example.org/example.com/m/index/2/"} {
+		if !strings.Contains(sitemap, "<loc>"+want+"</loc>") {
+			t.Errorf("sitemap does not list %s", want)
+		}
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+}
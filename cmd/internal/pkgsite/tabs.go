@@ -0,0 +1,247 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// The frontend serves the tabs of a unit page at the URL of the unit with
+// a tab query, such as /example.com/m?tab=imports, which a static file
+// server cannot tell apart from the unit page. The generator writes the
+// tabs it supports as pages of their own, such as
+// example.com/m/imports/index.html, and rewrites the links to them. The
+// licenses tab is written once per module, for all its units.
+
+const (
+	// importsTab is the tab listing the imports of a package.
+	importsTab = "imports"
+	// importedByTab is the tab listing the packages of the site that import
+	// a package. The data source reports them from the import graph of the
+	// site's packages, which it cannot compute itself.
+	importedByTab = "importedby"
+	// licensesTab is the tab with the licenses of a unit. The page of a
+	// module lists the licenses of all its directories.
+	licensesTab = "licenses"
+	// versionsTab is the tab listing the versions of a unit, which only
+	// the units of modules with versions get. See versions.go.
+	versionsTab = "versions"
+)
+
+// staticTabs are the tabs written as pages, in the order they are written.
+var staticTabs = []string{importsTab, importedByTab, licensesTab, versionsTab}
+
+// tabPagePath returns the URL path of the page written for urlPath: a tab
+// requested as /<unit>?tab=<tab> is written at /<unit>/<tab>, and other
+// pages at their URL paths.
+func tabPagePath(urlPath string) string {
+	if unit, tab, ok := tabRequest(urlPath); ok {
+		return "/" + unit + "/" + tab
+	}
+	return urlPath
+}
+
+// tabRequest returns the unit path and tab of urlPath, if it requests one
+// of staticTabs of a unit, or a page of its symbol index. The tab of page n
+// of a symbol index, past the first, is "index/n".
+func tabRequest(urlPath string) (unit, tab string, ok bool) {
+	p, query, found := strings.Cut(urlPath, "?")
+	unit = strings.Trim(p, "/")
+	if !found || !strings.HasPrefix(p, "/") || unit == "" {
+		return "", "", false
+	}
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		return "", "", false
+	}
+	tab = v.Get("tab")
+	if tab == symbolIndexTab {
+		if n, err := strconv.Atoi(v.Get("page")); err == nil && n > 1 {
+			tab += "/" + strconv.Itoa(n)
+		}
+		return unit, tab, true
+	}
+	if !slices.Contains(staticTabs, tab) {
+		return "", "", false
+	}
+	return unit, tab, true
+}
+
+// tabPages returns the site paths of the tab pages of the units of
+// selected, such as "example.com/m/imports", out of units, the canonical
+// paths of all units of the site. Packages get their imports and
+// imported-by tabs, and modules their licenses tab. The units of the
+// modules in versioned, by canonical module path, get their versions tab.
+// links maps the tabs of the units of selected, such as
+// "example.com/m/sub/licenses", to the site paths of their pages. A tab
+// page that would have the path of a unit, such as of a package's own
+// "imports" subdirectory, is not written; the returned slice lists those
+// paths.
+func tabPages(units map[string]bool, selected []*siteUnit, versioned map[string]bool) (pages map[string]bool, links map[string]string, clashes []string) {
+	pages = map[string]bool{}
+	links = map[string]string{}
+	add := func(p string) bool {
+		if units[p] {
+			clashes = append(clashes, p)
+			return false
+		}
+		pages[p] = true
+		return true
+	}
+	for _, u := range selected {
+		if u.meta.Path == u.meta.ModulePath {
+			add(u.path + "/" + licensesTab)
+		}
+		if p := u.path + "/" + versionsTab; versioned[canonicalUnitPath(u.meta.ModulePath)] && add(p) {
+			links[p] = p
+		}
+		if !u.meta.IsPackage() {
+			continue
+		}
+		for _, tab := range []string{importsTab, importedByTab} {
+			if p := u.path + "/" + tab; add(p) {
+				links[p] = p
+			}
+		}
+	}
+	for _, u := range selected {
+		if p := u.moduleSitePath() + "/" + licensesTab; pages[p] {
+			links[u.path+"/"+licensesTab] = p
+		}
+	}
+	return pages, links, clashes
+}
+
+// tabLinksTransform returns the page transform pointing the links to the
+// tabs in links, and the options of the tab menus, at their pages, as
+// tabPages returns them. Links to other tabs are left alone.
+func tabLinksTransform(links map[string]string) pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode {
+				key := ""
+				switch n.Data {
+				case "a":
+					key = "href"
+				case "option":
+					key = "value"
+				}
+				if unit, tab, ok := tabRequest(attrValue(n, key)); key != "" && ok {
+					if p, ok := links[canonicalUnitPath(unit)+"/"+tab]; ok {
+						setAttr(n, key, "/"+p)
+					}
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+	}
+}
+
+// importLinksTransform returns the page transform for imports pages that
+// points the links to imported packages outside units, the canonical paths
+// of the site's units, at their documentation under externalBase, as
+// externalDocsURL does, or, if strip is set, replaces them by their text.
+func importLinksTransform(units map[string]bool, externalBase string, strip bool) pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		var links []*html.Node
+		var paths []string
+		var walk func(n *html.Node, inList bool)
+		walk = func(n *html.Node, inList bool) {
+			if n.Type == html.ElementNode {
+				if n.Data == "ul" && hasClass(n, "Imports-list") {
+					inList = true
+				}
+				if inList && n.Data == "a" {
+					if p, ok := externalLinkPath(attrValue(n, "href"), units); ok {
+						links = append(links, n)
+						paths = append(paths, p)
+					}
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c, inList)
+			}
+		}
+		walk(doc, false)
+		for i, a := range links {
+			pointExternalLink(a, paths[i], externalBase, strip)
+		}
+	}
+}
+
+// importersSiteMessage replaces the message of the frontend for packages
+// without importers, which on a static site may have importers elsewhere.
+const importersSiteMessage = "No importers within this site."
+
+// importedByTransform returns the page transform for imported-by pages that
+// says that a package without importers has none within the site.
+func importedByTransform() pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		list := findElementFunc(doc, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && hasClass(n, "ImportedBy")
+		})
+		if list == nil {
+			return
+		}
+		msg := findElementFunc(list, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && attrValue(n, "data-test-id") == "gopher-message"
+		})
+		if msg == nil {
+			return
+		}
+		for msg.FirstChild != nil {
+			msg.RemoveChild(msg.FirstChild)
+		}
+		msg.AppendChild(&html.Node{Type: html.TextNode, Data: importersSiteMessage})
+	}
+}
+
+// noLicenseSection is shown on the licenses page of a module without any
+// license the license detector recognizes, which the frontend leaves empty.
+const noLicenseSection = `<h2 class="go-textTitle">No license detected</h2>` +
+	`<p>None of the files of this module is a license that pkgsite recognizes. ` +
+	`This is not legal advice. <a href="/license-policy">Read disclaimer.</a></p>`
+
+// licensesTransform returns the page transform for licenses pages that
+// says that a module has no detected license.
+func licensesTransform() pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		article := findElementFunc(doc, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && n.Data == "article" && hasClass(n, "go-Main-article")
+		})
+		if article == nil || findElementFunc(article, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && hasClass(n, "License")
+		}) != nil {
+			return
+		}
+		section := &html.Node{
+			Type:     html.ElementNode,
+			Data:     "section",
+			DataAtom: atom.Section,
+			Attr: []html.Attribute{
+				{Key: "class", Val: "License"},
+				{Key: "data-test-id", Val: "License-none"},
+			},
+		}
+		nodes, err := html.ParseFragment(strings.NewReader(noLicenseSection), section)
+		if err != nil {
+			return
+		}
+		for _, n := range nodes {
+			section.AppendChild(n)
+		}
+		article.AppendChild(section)
+	}
+}
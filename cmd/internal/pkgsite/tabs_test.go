@@ -0,0 +1,369 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestTabRequest(t *testing.T) {
+	for _, test := range []struct {
+		in, unit, tab, page string
+	}{
+		{"/example.com/m?tab=imports", "example.com/m", "imports", "/example.com/m/imports"},
+		{"/example.com/m/?tab=imports", "example.com/m", "imports", "/example.com/m/imports"},
+		{"/example.com/m?tab=versions", "example.com/m", "versions", "/example.com/m/versions"},
+		{"/example.com/m?tab=doc", "", "", "/example.com/m?tab=doc"},
+		{"/example.com/m", "", "", "/example.com/m"},
+		{"/?tab=imports", "", "", "/?tab=imports"},
+		{"example.com/m?tab=imports", "", "", "example.com/m?tab=imports"},
+	} {
+		unit, tab, ok := tabRequest(test.in)
+		if unit != test.unit || tab != test.tab || ok != (test.unit != "") {
+			t.Errorf("tabRequest(%q) = %q, %q, %t, want %q, %q", test.in, unit, tab, ok, test.unit, test.tab)
+		}
+		if got := tabPagePath(test.in); got != test.page {
+			t.Errorf("tabPagePath(%q) = %q, want %q", test.in, got, test.page)
+		}
+	}
+}
+
+func TestTabLinksTransform(t *testing.T) {
+	page := `<html><head></head><body>` +
+		`<a href="/example.com/m?tab=imports">Imports</a>` +
+		`<a href="/example.com/other?tab=imports">Other</a>` +
+		`<a href="/example.com/m?tab=versions">Versions</a>` +
+		`<select><option value="example.com/m?tab=doc">Main</option>` +
+		`<option value="/example.com/m?tab=imports">Imports</option></select>` +
+		`</body></html>`
+	got, err := processHTML([]byte(page), "/example.com/m", nil, tabLinksTransform(map[string]string{"example.com/m/imports": "example.com/m/imports"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<a href="../../example.com/m/imports">Imports</a>`,
+		`<a href="../../example.com/other?tab=imports">Other</a>`,
+		`<a href="../../example.com/m?tab=versions">Versions</a>`,
+		`<option value="example.com/m?tab=doc">Main</option>`,
+		`<option value="/example.com/m/imports">Imports</option>`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("page does not contain %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestImportLinksTransform(t *testing.T) {
+	page := `<html><head></head><body>` +
+		`<a href="/fmt">Outside the list</a>` +
+		`<ul class="Imports-list"><li><a href="/example.com/m/a">example.com/m/a</a></li>` +
+		`<li><a href="/fmt">fmt</a></li><li><a href="/golang.org/x/net/html">html</a></li></ul>` +
+		`</body></html>`
+	units := map[string]bool{"example.com/m": true, "example.com/m/a": true}
+	for _, test := range []struct {
+		base string
+		want []string
+	}{
+		{"", []string{
+			`<a href="../../../fmt">Outside the list</a>`,
+			`<a href="../../../example.com/m/a">example.com/m/a</a>`,
+			`<a href="https://pkg.go.dev/fmt">fmt</a>`,
+			`<a href="https://pkg.go.dev/golang.org/x/net/html">html</a>`,
+		}},
+		{"https://docs.example.com/", []string{
+			`<a href="../../../example.com/m/a">example.com/m/a</a>`,
+			`<a href="https://docs.example.com/fmt">fmt</a>`,
+		}},
+	} {
+		got, err := processHTML([]byte(page), "/example.com/m/imports", nil, importLinksTransform(units, test.base, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(got), want) {
+				t.Errorf("base %q: page does not contain %s:\n%s", test.base, want, got)
+			}
+		}
+	}
+}
+
+func TestGenerateStaticSiteImportsPages(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+
+import (
+	"fmt"
+
+	"example.com/m/a"
+)
+
+var _ = fmt.Sprint(a.X)
+-- a/a.go --
+// Package a has an imports subdirectory.
+package a
+
+const X = 1
+-- a/imports/imports.go --
+// Package imports is a unit at the path of an imports page.
+package imports
+`, nil)
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	main := read("example.com/m/index.html")
+	if want := `href="../../example.com/m/imports"`; !strings.Contains(main, want) {
+		t.Errorf("main page does not link to its imports page with %s", want)
+	}
+	imports := read("example.com/m/imports/index.html")
+	for _, want := range []string{
+		`href="../../../example.com/m/a"`,
+		`href="https://pkg.go.dev/fmt"`,
+	} {
+		if !strings.Contains(imports, want) {
+			t.Errorf("imports page does not contain %s", want)
+		}
+	}
+
+	// The package with a unit at the path of its imports page keeps the
+	// unit's page there.
+	if got := read("example.com/m/a/imports/index.html"); !strings.Contains(got, "Package imports is a unit") {
+		t.Error("imports page of example.com/m/a replaced the page of example.com/m/a/imports")
+	}
+}
+
+func TestImportedByTransform(t *testing.T) {
+	page := `<html><head></head><body><div class="ImportedBy">` +
+		`<div class="go-GopherMessage"><p data-test-id="gopher-message">No known importers for this package!</p></div>` +
+		`</div></body></html>`
+	got, err := processHTML([]byte(page), "/example.com/m/importedby", nil, importedByTransform())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<p data-test-id="gopher-message">` + importersSiteMessage + `</p>`; !strings.Contains(string(got), want) {
+		t.Errorf("page does not contain %s:\n%s", want, got)
+	}
+}
+
+func TestGenerateStaticSiteImportedByPages(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- a/go.mod --
+module example.com/a
+
+go 1.21
+-- a/a.go --
+// Package a is imported by b.
+package a
+
+const X = 1
+-- a/lonely/lonely.go --
+// Package lonely is imported by nothing.
+package lonely
+-- b/go.mod --
+module example.com/b
+
+go 1.21
+
+require example.com/a v0.0.0
+
+replace example.com/a => ../a
+-- b/b.go --
+// Package b imports a.
+package b
+
+import "example.com/a"
+
+const Y = a.X
+-- b/c/c.go --
+// Package c imports a too.
+package c
+
+import "example.com/a"
+
+const Z = a.X
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}, UseListedMods: true}
+	if err := GenerateStaticSite(context.Background(), cfg, outDir); err != nil {
+		t.Fatal(err)
+	}
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	main := read("example.com/a/index.html")
+	if want := `href="../../example.com/a/importedby"`; !strings.Contains(main, want) {
+		t.Errorf("main page does not link to its imported-by page with %s", want)
+	}
+	if want := `Imported by: </span>2`; !strings.Contains(main, want) {
+		t.Errorf("main page does not count its importers with %s", want)
+	}
+	importedBy := read("example.com/a/importedby/index.html")
+	for _, want := range []string{
+		`href="../../../example.com/b"`,
+		`href="../../../example.com/b/c"`,
+	} {
+		if !strings.Contains(importedBy, want) {
+			t.Errorf("imported-by page of example.com/a does not contain %s", want)
+		}
+	}
+	if got := read("example.com/a/lonely/importedby/index.html"); !strings.Contains(got, importersSiteMessage) {
+		t.Errorf("imported-by page of a package without importers does not say %q", importersSiteMessage)
+	}
+}
+
+func TestTabPages(t *testing.T) {
+	unit := func(path, modulePath string, isPackage bool) *siteUnit {
+		um := &internal.UnitMeta{Path: path, ModuleInfo: internal.ModuleInfo{ModulePath: modulePath}}
+		if isPackage {
+			um.Name = path[strings.LastIndex(path, "/")+1:]
+		}
+		return &siteUnit{path: path, meta: um}
+	}
+	selected := []*siteUnit{
+		unit("example.com/m", "example.com/m", false),
+		unit("example.com/m/a", "example.com/m", true),
+		unit("example.com/m/a/imports", "example.com/m", true),
+		unit("example.com/n", "example.com/n", true),
+		unit("example.com/n/licenses", "example.com/n", true),
+	}
+	units := map[string]bool{}
+	for _, u := range selected {
+		units[u.path] = true
+	}
+	pages, links, clashes := tabPages(units, selected, nil)
+	wantPages := map[string]bool{
+		"example.com/m/licenses":             true,
+		"example.com/m/a/importedby":         true,
+		"example.com/m/a/imports/imports":    true,
+		"example.com/m/a/imports/importedby": true,
+		"example.com/n/imports":              true,
+		"example.com/n/importedby":           true,
+		"example.com/n/licenses/imports":     true,
+		"example.com/n/licenses/importedby":  true,
+	}
+	if diff := cmp.Diff(wantPages, pages); diff != "" {
+		t.Errorf("pages mismatch (-want +got):\n%s", diff)
+	}
+	wantLinks := map[string]string{
+		"example.com/m/licenses":             "example.com/m/licenses",
+		"example.com/m/a/licenses":           "example.com/m/licenses",
+		"example.com/m/a/importedby":         "example.com/m/a/importedby",
+		"example.com/m/a/imports/licenses":   "example.com/m/licenses",
+		"example.com/m/a/imports/imports":    "example.com/m/a/imports/imports",
+		"example.com/m/a/imports/importedby": "example.com/m/a/imports/importedby",
+		"example.com/n/imports":              "example.com/n/imports",
+		"example.com/n/importedby":           "example.com/n/importedby",
+		"example.com/n/licenses/imports":     "example.com/n/licenses/imports",
+		"example.com/n/licenses/importedby":  "example.com/n/licenses/importedby",
+	}
+	if diff := cmp.Diff(wantLinks, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"example.com/m/a/imports", "example.com/n/licenses"}, clashes); diff != "" {
+		t.Errorf("clashes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateStaticSiteLicensesPages(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- licensed/go.mod --
+module example.com/licensed
+
+go 1.21
+-- licensed/LICENSE --
+`+testhelper.MITLicense+`
+-- licensed/l.go --
+// Package licensed has licenses.
+package licensed
+-- licensed/vendored/COPYING --
+`+testhelper.BSD0License+`
+-- licensed/vendored/v.go --
+// Package vendored has a license of its own.
+package vendored
+-- unlicensed/go.mod --
+module example.com/unlicensed
+
+go 1.21
+-- unlicensed/u.go --
+// Package unlicensed has no license.
+package unlicensed
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{Paths: []string{filepath.Join(dir, "licensed"), filepath.Join(dir, "unlicensed")}, UseListedMods: true}
+	if err := GenerateStaticSite(context.Background(), cfg, outDir); err != nil {
+		t.Fatal(err)
+	}
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// The module's page has the licenses of all its directories.
+	licenses := read("example.com/licensed/licenses/index.html")
+	for _, want := range []string{
+		`<div id="#lic-0">MIT</div>`,
+		`<div id="#lic-1">0BSD</div>`,
+		`Source: example.com/licensed@v0.0.0/vendored/COPYING`,
+		`href="../../../licenses/texts/`,
+	} {
+		if !strings.Contains(licenses, want) {
+			t.Errorf("licenses page does not contain %s", want)
+		}
+	}
+	// The texts of the licenses have pages of their own.
+	text, err := os.ReadFile(filepath.Join(dir, "licensed", "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mit := licenseTextHash(licensePageText(text))
+	if got := read("licenses/texts/" + mit + "/index.html"); !strings.Contains(got, "Permission is hereby granted") {
+		t.Error("the page of the MIT license does not have its text")
+	}
+	// The packages of the module link to it.
+	for _, test := range []struct{ page, want string }{
+		{"example.com/licensed/index.html", `href="../../example.com/licensed/licenses"`},
+		{"example.com/licensed/vendored/index.html", `href="../../../example.com/licensed/licenses"`},
+	} {
+		if !strings.Contains(read(test.page), test.want) {
+			t.Errorf("%s does not link to the licenses page with %s", test.page, test.want)
+		}
+	}
+
+	if got := read("example.com/unlicensed/licenses/index.html"); !strings.Contains(got, "No license detected") {
+		t.Error("licenses page of a module without licenses does not say so")
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/doc/comment"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// With GenerateOptions.EmitText, the documentation of each package is also
+// written as plain text to <unit>/doc.txt, for tools that ingest text
+// better than HTML, and llms.txt at the root of the site lists the
+// packages, following https://llmstxt.org: a Markdown file with the
+// synopsis of each package and the relative link to its doc.txt. Both are
+// rendered from the documentation model, as the Markdown export is, so
+// they are the same from one run to the next. Doc comments are wrapped as
+// go doc wraps them, with their code blocks indented and their headings
+// underlined. A file longer than textFileLimit is cut at a line, with a
+// line saying so. The files are not pages: their links are not rewritten,
+// and the sitemap does not list them.
+
+const (
+	// llmsFile is the path of the list of the text files in the site.
+	llmsFile = "llms.txt"
+	// textFileLimit is the size in bytes of the longest text file.
+	textFileLimit = 512 << 10
+	// textWidth is the width of the wrapped paragraphs of text files.
+	textWidth = 80
+)
+
+// writeUnitText writes the plain-text documentation of u to <unit>/doc.txt
+// in out, and returns its synopsis. Units that are not packages are
+// skipped, and reported as not written.
+func writeUnitText(ctx context.Context, u *siteUnit, out *siteOutput) (synopsis string, written bool, err error) {
+	fset, d, synopsis, err := unitDoc(ctx, u)
+	if err != nil || d == nil {
+		return "", false, err
+	}
+	text, err := unitText(fset, d)
+	if err != nil {
+		return "", false, err
+	}
+	outPath, err := outputPath(out.dir, u.path+"/doc.txt")
+	if err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+		return "", false, err
+	}
+	if err := out.writeFile(outPath, truncateText(text, textFileLimit)); err != nil {
+		return "", false, err
+	}
+	return synopsis, true, nil
+}
+
+// A textEntry is a package listed in llms.txt.
+type textEntry struct {
+	path     string // canonical path of the unit
+	synopsis string
+}
+
+// llmsText returns the contents of llms.txt, listing entries, which are
+// sorted by path, under the title name.
+func llmsText(name string, entries []textEntry) []byte {
+	if name == "" {
+		name = "Go documentation"
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\n", name)
+	b.WriteString("> The documentation of the Go packages of this site, as plain text.\n\n")
+	b.WriteString("## Packages\n\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "- [%s](%s/doc.txt)", e.path, e.path)
+		if e.synopsis != "" {
+			fmt.Fprintf(&b, ": %s", strings.Join(strings.Fields(e.synopsis), " "))
+		}
+		b.WriteString("\n")
+	}
+	return truncateText(b.Bytes(), textFileLimit)
+}
+
+// truncateText returns text, cut to at most limit bytes, if it is longer,
+// at the end of a line, and followed by a line saying so.
+func truncateText(text []byte, limit int) []byte {
+	if len(text) <= limit {
+		return text
+	}
+	marker := fmt.Sprintf("\n[truncated: the full text is %d bytes]\n", len(text))
+	keep := max(limit-len(marker), 0)
+	if i := bytes.LastIndexByte(text[:keep], '\n'); i >= 0 {
+		keep = i + 1
+	} else {
+		for keep > 0 && !utf8.RuneStart(text[keep]) {
+			keep--
+		}
+	}
+	return append(text[:keep:keep], marker...)
+}
+
+// unitText renders the documentation of d as plain text: a title, the
+// import path, the package doc comment, and a section per kind of exported
+// symbol, with the declaration of each symbol indented.
+func unitText(fset *token.FileSet, d *doc.Package) ([]byte, error) {
+	tw := &textWriter{fset: fset, pkg: d}
+	tw.printer = d.Printer()
+	tw.printer.TextWidth = textWidth
+
+	tw.heading("package "+d.Name, '=')
+	fmt.Fprintf(&tw.buf, "\timport %q\n\n", d.ImportPath)
+	tw.docComment(d.Doc)
+
+	if len(d.Consts) > 0 {
+		tw.heading("Constants", '=')
+		tw.values(d.Consts)
+	}
+	if len(d.Vars) > 0 {
+		tw.heading("Variables", '=')
+		tw.values(d.Vars)
+	}
+	if len(d.Funcs) > 0 {
+		tw.heading("Functions", '=')
+		for _, f := range d.Funcs {
+			tw.function(f)
+		}
+	}
+	if len(d.Types) > 0 {
+		tw.heading("Types", '=')
+		for _, t := range d.Types {
+			tw.typ(t)
+		}
+	}
+	return append(bytes.TrimRight(tw.buf.Bytes(), "\n"), '\n'), tw.err
+}
+
+type textWriter struct {
+	buf     bytes.Buffer
+	fset    *token.FileSet
+	pkg     *doc.Package
+	printer *comment.Printer
+	err     error
+}
+
+// heading writes text underlined with c.
+func (tw *textWriter) heading(text string, c rune) {
+	fmt.Fprintf(&tw.buf, "%s\n%s\n\n", text, strings.Repeat(string(c), utf8.RuneCountInString(text)))
+}
+
+// docComment writes a doc comment as wrapped text. comment.Printer writes
+// headings as "# Heading", so they are written here instead, and the link
+// definitions that the comment uses follow all of its blocks.
+func (tw *textWriter) docComment(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	parsed := tw.pkg.Parser().Parse(text)
+	var pending []comment.Block
+	flush := func() {
+		if len(pending) > 0 {
+			tw.buf.Write(tw.printer.Text(&comment.Doc{Content: pending}))
+			tw.buf.WriteString("\n")
+			pending = nil
+		}
+	}
+	for _, b := range parsed.Content {
+		h, ok := b.(*comment.Heading)
+		if !ok {
+			pending = append(pending, b)
+			continue
+		}
+		flush()
+		title := tw.printer.Text(&comment.Doc{Content: []comment.Block{&comment.Paragraph{Text: h.Text}}})
+		tw.heading(strings.Join(strings.Fields(string(title)), " "), '-')
+	}
+	flush()
+	used := false
+	for _, def := range parsed.Links {
+		if def.Used {
+			fmt.Fprintf(&tw.buf, "[%s]: %s\n", def.Text, def.URL)
+			used = true
+		}
+	}
+	if used {
+		tw.buf.WriteString("\n")
+	}
+}
+
+// decl writes a declaration, without its doc comment, indented.
+func (tw *textWriter) decl(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		c := *n
+		c.Doc = nil
+		c.Body = nil
+		n = &c
+	case *ast.GenDecl:
+		c := *n
+		c.Doc = nil
+		n = &c
+	}
+	var b bytes.Buffer
+	if err := format.Node(&b, tw.fset, n); err != nil {
+		if tw.err == nil {
+			tw.err = err
+		}
+		return
+	}
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line != "" {
+			tw.buf.WriteString("\t" + line)
+		}
+		tw.buf.WriteString("\n")
+	}
+	tw.buf.WriteString("\n")
+}
+
+func (tw *textWriter) values(vs []*doc.Value) {
+	for _, v := range vs {
+		tw.decl(v.Decl)
+		tw.docComment(v.Doc)
+	}
+}
+
+func (tw *textWriter) function(f *doc.Func) {
+	title := "func " + f.Name
+	if f.Recv != "" {
+		title = fmt.Sprintf("func (%s) %s", f.Recv, f.Name)
+	}
+	tw.heading(title, '-')
+	tw.decl(f.Decl)
+	tw.docComment(f.Doc)
+}
+
+func (tw *textWriter) typ(t *doc.Type) {
+	tw.heading("type "+t.Name, '-')
+	tw.decl(t.Decl)
+	tw.docComment(t.Doc)
+	tw.values(t.Consts)
+	tw.values(t.Vars)
+	for _, f := range t.Funcs {
+		tw.function(f)
+	}
+	for _, m := range t.Methods {
+		tw.function(m)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const textFixture = `// Package pkg exercises the plain-text export. Its paragraphs are wrapped at eighty columns, as go doc wraps them.
+//
+// # Usage
+//
+// Call [F] with a [Config], or see [example.com/m/other.T]. The
+// [Go documentation] has more, and so does https://go.dev/doc.
+//
+//   - first item
+//   - second item, which is long enough to be wrapped onto a line of its own
+//
+// The steps are:
+//
+//  1. make a Config
+//  2. call F
+//
+// Example:
+//
+//	c := pkg.Config{Name: "x"}
+//	if err := pkg.F(c); err != nil {
+//		return err
+//	}
+//
+// [Go documentation]: https://go.dev/doc
+package pkg
+
+import "errors"
+
+// Version is the package version.
+const Version = "1.0"
+
+// Errors returned by F.
+var (
+	ErrName = errors.New("no name")
+	ErrSize = errors.New("too large")
+)
+
+// Config configures F.
+type Config struct {
+	Name string // the name
+}
+
+// NewConfig returns a default [Config].
+func NewConfig() *Config { return nil }
+
+// Validate reports whether c is usable.
+func (c *Config) Validate() error { return nil }
+
+// F does the thing.
+//
+// Deprecated: use [G] instead.
+func F(c Config) error { return nil }
+
+// G does the thing better.
+func G(c Config) error { return nil }
+`
+
+func TestUnitText(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "pkg.go", textFixture, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := doc.NewFromFiles(fset, []*ast.File{f}, "example.com/m/pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := unitText(fset, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "text.golden")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	text := strings.Repeat("line\n", 20)
+	const marker = "\n[truncated: the full text is 100 bytes]\n"
+	for _, test := range []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{text, len(text), text},
+		{text, 60, "line\nline\nline\n" + marker},
+		{text, 61, "line\nline\nline\nline\n" + marker},
+		// A line longer than the limit is cut between runes.
+		{strings.Repeat("é", 30), 43, "é\n[truncated: the full text is 60 bytes]\n"},
+		{text, 0, marker},
+	} {
+		got := string(truncateText([]byte(test.text), test.limit))
+		if got != test.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", test.text, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestLLMSText(t *testing.T) {
+	got := string(llmsText("", []textEntry{
+		{path: "example.com/m/a", synopsis: "Package a is\ndocumented."},
+		{path: "example.com/m/b"},
+	}))
+	want := `# Go documentation
+
+> The documentation of the Go packages of this site, as plain text.
+
+## Packages
+
+- [example.com/m/a](example.com/m/a/doc.txt): Package a is documented.
+- [example.com/m/b](example.com/m/b/doc.txt)
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestGenerateStaticSiteText(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+-- a/a.go --
+// Package a is documented.
+package a
+
+// F returns [b.T].
+func F() {}
+-- b/b.go --
+// Package b is documented too.
+package b
+
+// T is a type.
+type T int
+`, func(cfg *ServerConfig, opts *GenerateOptions) {
+		cfg.SiteName = "Example"
+		cfg.SiteURL = "https://docs.example.com"
+		opts.EmitText = true
+		opts.Sitemap = true
+	})
+
+	data, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "a", "doc.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package a\n=========\n", "\timport \"example.com/m/a\"\n", "func F\n------\n\n\tfunc F()\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("a/doc.txt does not contain %q:\n%s", want, data)
+		}
+	}
+	// The module root is not a package.
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "m", "doc.txt")); err == nil {
+		t.Error("doc.txt written for module root")
+	}
+
+	llms, err := os.ReadFile(filepath.Join(outDir, llmsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# Example\n",
+		"- [example.com/m/a](example.com/m/a/doc.txt): Package a is documented.\n- [example.com/m/b](example.com/m/b/doc.txt): Package b is documented too.\n",
+	} {
+		if !strings.Contains(string(llms), want) {
+			t.Errorf("%s does not contain %q:\n%s", llmsFile, want, llms)
+		}
+	}
+
+	// The text files are not pages.
+	sitemap, err := os.ReadFile(filepath.Join(outDir, sitemapFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sitemap), ".txt") {
+		t.Errorf("the sitemap lists text files:\n%s", sitemap)
+	}
+}
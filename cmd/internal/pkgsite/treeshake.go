@@ -0,0 +1,126 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	thirdparty "github.com/wow-look-at-my/static-pkgsite/third_party"
+)
+
+// The directories static and third_party of the site hold only the files
+// of static.FS and thirdparty.FS that the site uses: those that the pages
+// refer to, as subresources or links, and those that these refer to in
+// turn, as the url() and @import references of style sheets, which take in
+// fonts and images, the imports of scripts and the asset paths they
+// mention, and source maps. The files written by the generator itself, such
+// as the search index, the favicons and the code moved out of the pages,
+// are used too, and so is the license file of a component of third_party
+// with files in the output. The rest of the two file systems, such as the TypeScript
+// sources, the templates and the files of the pages that a static site
+// does not have, is left out. GenerateOptions.CopyAllAssets copies every
+// file, for sites whose own pages load the files.
+//
+// The files are copied in two steps: before the page of third-party
+// notices is written, which lists the components whose files are in the
+// output (see attributions.go), and once the code moved out of the pages,
+// which loads files of its own, is written.
+
+// An assetShaker holds the files of the embedded file systems until the
+// site is known to use them.
+type assetShaker struct {
+	basePath string            // the path of the site from the root of the host
+	licenses map[string]string // the site paths of the license files, by directory of component
+	mu       sync.Mutex
+	roots    map[string]bool   // the files that the pages refer to
+	held     map[string][]byte // contents of the files not written, by site path
+}
+
+func newAssetShaker(basePath string, components []thirdparty.Component) *assetShaker {
+	licenses := map[string]string{}
+	for _, c := range components {
+		licenses[c.Dir] = path.Join("third_party", c.LicenseFile)
+	}
+	return &assetShaker{basePath: basePath, licenses: licenses, roots: map[string]bool{}, held: map[string][]byte{}}
+}
+
+// consumePage records the local files that the page of ev refers to, as
+// subresources or links. The not-found page refers to them by their paths
+// from the root of the host.
+func (s *assetShaker) consumePage(ev *pageEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ref := range slices.Concat(ev.Assets, ev.Links) {
+		if p, ok := integrityTarget(ev.File, ref, s.basePath); ok {
+			s.roots[p] = true
+		}
+	}
+	return nil
+}
+
+func (s *assetShaker) finish(context.Context, *siteOutput) error { return nil }
+
+// hold records the file at sitePath, with the given content, to be written
+// if the site uses it.
+func (s *assetShaker) hold(sitePath string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held[sitePath] = content
+}
+
+// write writes to out the held files that the pages, the files of assets,
+// or roots, refer to or mention, directly or not, and adds them to assets.
+func (s *assetShaker) write(out *siteOutput, assets *assetGraph, roots []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := slices.Concat(slices.Sorted(maps.Keys(s.roots)), slices.Sorted(maps.Keys(assets.files)), roots)
+	seen := map[string]bool{}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if content, ok := s.held[p]; ok {
+			file := filepath.Join(out.dir, filepath.FromSlash(p))
+			if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+				return err
+			}
+			if err := out.writeFile(file, content); err != nil {
+				return err
+			}
+			assets.addFile(p, content)
+			delete(s.held, p)
+			if rest, ok := strings.CutPrefix(p, "third_party/"); ok {
+				dir, _, _ := strings.Cut(rest, "/")
+				if license, ok := s.licenses[dir]; ok {
+					queue = append(queue, license)
+				}
+			}
+		} else if !assets.files[p] {
+			continue
+		}
+		for _, r := range assets.refs[p] {
+			queue = append(queue, r.Target)
+		}
+		queue = append(queue, assets.mentions[p]...)
+	}
+	return nil
+}
+
+// left returns the number of the held files that were not written.
+func (s *assetShaker) left() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.held)
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+	thirdparty "github.com/wow-look-at-my/static-pkgsite/third_party"
+)
+
+func TestAssetShaker(t *testing.T) {
+	held := map[string]string{
+		"static/a.css":            "@import './b.css'; body { background: url(../static/img/bg.png) }\n/*# sourceMappingURL=a.css.map */",
+		"static/a.css.map":        "{}",
+		"static/b.css":            "@font-face { src: url('fonts/x.woff2') format('woff2') }",
+		"static/fonts/x.woff2":    "font",
+		"static/img/bg.png":       "png",
+		"static/img/unused.png":   "png",
+		"static/x.js":             `import { f } from "./y.js"; f("static/img/icon.svg")`,
+		"static/y.js":             "export function f() {}\n//# sourceMappingURL=y.js.map",
+		"static/y.js.map":         "{}",
+		"static/img/icon.svg":     "<svg/>",
+		"static/z.js":             "unused()",
+		"static/x.ts":             "source",
+		"static/gen.css":          "p { background: url(img/gen.png) }",
+		"static/img/gen.png":      "png",
+		"static/inline.js":        "loaded()",
+		"static/page.pdf":         "pdf",
+		"third_party/lib/lib.js":  "lib()",
+		"third_party/lib/COPYING": "license",
+		"third_party/lib/README":  "readme",
+	}
+	out := &siteOutput{dir: t.TempDir(), written: map[string]string{}, touched: map[string]bool{}}
+	assets := newAssetGraph()
+	s := newAssetShaker("/docs/", []thirdparty.Component{{Dir: "lib", LicenseFile: "lib/COPYING"}})
+	for p, content := range held {
+		s.hold(p, []byte(content))
+	}
+	// A file the generator wrote refers to a held file.
+	assets.addFile("static/gen/gen.css", []byte("p { background: url(../img/gen.png) }"))
+	for _, ev := range []*pageEvent{
+		{File: "m/index.html", Assets: []string{"../static/a.css", "../static/x.js?v=1", "../third_party/lib/lib.js", "https://example.com/static/z.js"}},
+		{File: "m/sub/index.html", Links: []string{"../../static/page.pdf", "#x"}},
+		{File: "404.html", Assets: []string{"/docs/static/a.css", "/other/static/z.js"}},
+	} {
+		if err := s.consumePage(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.write(out, assets, []string{"static/inline.js"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"static/a.css", "static/a.css.map", "static/b.css", "static/fonts/x.woff2",
+		"static/img/bg.png", "static/img/gen.png", "static/img/icon.svg", "static/inline.js",
+		"static/page.pdf", "static/x.js", "static/y.js", "static/y.js.map",
+		"third_party/lib/COPYING", "third_party/lib/lib.js",
+	}
+	if diff := cmp.Diff(want, slices.Sorted(maps.Keys(out.written))); diff != "" {
+		t.Errorf("written files mismatch (-want +got):\n%s", diff)
+	}
+	for _, p := range want {
+		if !assets.files[p] {
+			t.Errorf("%s is not in the asset graph", p)
+		}
+		if _, err := os.Stat(filepath.Join(out.dir, filepath.FromSlash(p))); err != nil {
+			t.Error(err)
+		}
+	}
+	if got := s.left(); got != len(held)-len(want) {
+		t.Errorf("left %d files, want %d", got, len(held)-len(want))
+	}
+	if missing := assets.missing(); len(missing) > 0 {
+		t.Errorf("missing assets: %v", missing)
+	}
+}
+
+func TestGenerateStaticSiteTreeShaking(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things.
+package m
+`)
+	outDir := t.TempDir()
+	generate := func(opts GenerateOptions) {
+		t.Helper()
+		opts.OutDir, opts.BasePath = outDir, "/docs/"
+		cfg := ServerConfig{Paths: []string{modDir}, UseListedMods: true}
+		report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.MissingAssets) > 0 {
+			t.Errorf("missing assets: %v", report.MissingAssets)
+		}
+	}
+	// No page or style sheet refers to the image.
+	unused := filepath.Join(outDir, "static", "shared", "logo", "go-blue-gradient.svg")
+	exists := func(file string) bool {
+		_, err := os.Stat(file)
+		return err == nil
+	}
+
+	generate(GenerateOptions{CopyAllAssets: true})
+	if !exists(unused) {
+		t.Fatalf("%s is missing with CopyAllAssets", unused)
+	}
+	generate(GenerateOptions{StrictCSP: true})
+	if exists(unused) {
+		t.Errorf("%s is left", unused)
+	}
+	if exists(filepath.Join(outDir, "static", "frontend", "frontend.ts")) {
+		t.Error("the TypeScript sources are copied")
+	}
+
+	// Every asset that the pages, the style sheets and the scripts refer to
+	// is there, and the notices list the components whose files are.
+	refRE := regexp.MustCompile(`(?:static|third_party)/[\w./-]*\.\w+`)
+	err := filepath.WalkDir(outDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch filepath.Ext(file) {
+		case ".html", ".css", ".js":
+		default:
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(outDir, file)
+		for _, m := range refRE.FindAllString(string(data), -1) {
+			if strings.HasSuffix(m, ".ts") || strings.HasSuffix(m, ".tmpl") {
+				continue // in the source maps, which are not read here, and comments
+			}
+			if !exists(filepath.Join(outDir, filepath.FromSlash(m))) {
+				t.Errorf("%s: refers to %s, which is missing", filepath.ToSlash(rel), m)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	components, err := thirdparty.Components()
+	if err != nil {
+		t.Fatal(err)
+	}
+	notices, err := os.ReadFile(filepath.Join(outDir, "attributions", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range components {
+		included := exists(filepath.Join(outDir, "third_party", filepath.FromSlash(c.Dir)))
+		if listed := strings.Contains(string(notices), c.Name); listed != included {
+			t.Errorf("component %s: listed in the notices: %t, files in the output: %t", c.Dir, listed, included)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// GenerateOptions.IncludeGlobs and ExcludeGlobs select the units of the
+// modules that get pages, by their paths, such as
+//
+//	**/internal/**
+//
+// A pattern is matched against the whole unit path, element by element:
+// an element "**" matches any number of elements, including none, and
+// the others are patterns of path.Match. A unit is left out if it
+// matches an exclude pattern, or if there are include patterns and it
+// matches none of them. GenerateOptions.NoInternal also leaves out the units
+// that only the packages of their module can import: those with an
+// "internal" path element.
+//
+// Units that are left out are as if the modules did not have them: they
+// have no pages and are missing from the search index, the sitemap and
+// the symbol indexes. The rows of the directory listings that point at
+// them are removed, and other links to them are replaced by their text.
+
+// A unitFilter selects units by their paths.
+type unitFilter struct {
+	include, exclude []string
+	noInternal       bool
+}
+
+// newUnitFilter validates the patterns and returns a filter for them and
+// noInternal, or nil if it keeps every unit.
+func newUnitFilter(include, exclude []string, noInternal bool) (*unitFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 && !noInternal {
+		return nil, nil
+	}
+	for _, p := range slices.Concat(include, exclude) {
+		if p == "" {
+			return nil, fmt.Errorf("empty unit path pattern")
+		}
+		for _, elem := range strings.Split(p, "/") {
+			if _, err := path.Match(elem, ""); err != nil {
+				return nil, fmt.Errorf("unit path pattern %q: %v", p, err)
+			}
+		}
+	}
+	return &unitFilter{include: include, exclude: exclude, noInternal: noInternal}, nil
+}
+
+// keeps reports whether the unit at unitPath gets pages.
+func (f *unitFilter) keeps(unitPath string) bool {
+	if f == nil {
+		return true
+	}
+	if f.noInternal && slices.Contains(strings.Split(unitPath, "/"), "internal") {
+		return false
+	}
+	for _, p := range f.exclude {
+		if matchGlob(p, unitPath) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if matchGlob(p, unitPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the units f keeps, and the set of the paths of the others.
+func (f *unitFilter) filter(units []*siteUnit) (kept []*siteUnit, left map[string]bool) {
+	left = map[string]bool{}
+	for _, u := range units {
+		if f.keeps(u.path) {
+			kept = append(kept, u)
+		} else {
+			left[u.path] = true
+		}
+	}
+	return kept, left
+}
+
+// matchGlob reports whether the slash-separated name matches pattern, in
+// which an element "**" matches any number of elements.
+func matchGlob(pattern, name string) bool {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// leftOutLinksTransform returns the page transform removing the links to
+// the units left out of the site: the rows of directory listings holding
+// them are removed, and other links are replaced by their contents. units
+// holds the paths of the units of the site, and left those of the units
+// left out.
+func leftOutLinksTransform(units, left map[string]bool) pageTransform {
+	if len(left) == 0 {
+		return nil
+	}
+	// isLeftOut reports whether the URL path of href, which may have a
+	// version, belongs to a unit left out, which is the nearest unit at or
+	// above it.
+	isLeftOut := func(href string) bool {
+		p, ok := strings.CutPrefix(href, "/")
+		if !ok {
+			return false
+		}
+		p, _, _ = strings.Cut(p, "?")
+		p, _, _ = strings.Cut(p, "#")
+		if mod, rest, ok := strings.Cut(p, "@"); ok {
+			_, rest, _ = strings.Cut(rest, "/")
+			p = path.Join(mod, rest)
+		}
+		for p = canonicalUnitPath(p); p != "." && p != ""; p = path.Dir(p) {
+			if units[p] {
+				return false
+			}
+			if left[p] {
+				return true
+			}
+		}
+		return false
+	}
+	return func(doc *html.Node, _ *headManager) {
+		var links []*html.Node
+		var walk func(n *html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode && n.DataAtom == atom.A && isLeftOut(attrValue(n, "href")) {
+				links = append(links, n)
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+		tables := map[*html.Node]bool{}
+		for _, a := range links {
+			if table := directoryTableOf(a); table != nil {
+				tables[table] = true
+				removeDirectoryLink(table, a)
+				continue
+			}
+			for a.FirstChild != nil {
+				c := a.FirstChild
+				a.RemoveChild(c)
+				a.Parent.InsertBefore(c, a)
+			}
+			a.Parent.RemoveChild(a)
+		}
+		for table := range tables {
+			pruneDirectoryTable(table)
+		}
+	}
+}
+
+// directoryTableOf returns the directory listing holding n, or nil.
+func directoryTableOf(n *html.Node) *html.Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.DataAtom == atom.Table && hasClass(p, "UnitDirectories-table") {
+			return p
+		}
+	}
+	return nil
+}
+
+// removeDirectoryLink removes the link a from the directory listing
+// table. A row of a subdirectory is removed, and the other rows stop
+// controlling it. The link of a directory with subdirectories is replaced
+// by its name, without its synopsis; the row of one without them is
+// removed.
+func removeDirectoryLink(table, a *html.Node) {
+	row := a.Parent
+	for row.DataAtom != atom.Tr {
+		row = row.Parent
+	}
+	if id := attrValue(row, "data-id"); id != "" {
+		row.Parent.RemoveChild(row)
+		walkElements(table, func(n *html.Node) {
+			for _, key := range []string{"data-aria-controls", "data-aria-owns"} {
+				if hasAttr(n, key) {
+					ids := strings.Fields(attrValue(n, key))
+					ids = slices.DeleteFunc(ids, func(s string) bool { return s == id })
+					setAttr(n, key, strings.Join(ids, " "))
+				}
+			}
+		})
+		return
+	}
+	if !hasAttr(row, "data-aria-controls") {
+		row.Parent.RemoveChild(row)
+		return
+	}
+	name := &html.Node{Type: html.ElementNode, Data: "span", DataAtom: atom.Span}
+	for a.FirstChild != nil {
+		c := a.FirstChild
+		a.RemoveChild(c)
+		name.AppendChild(c)
+	}
+	a.Parent.InsertBefore(name, a)
+	// The chip saying that the directory is a module goes with the link.
+	for s := a.NextSibling; s != nil; s = s.NextSibling {
+		if s.DataAtom == atom.Span && hasClass(s, "go-Chip") {
+			s.Parent.RemoveChild(s)
+			break
+		}
+	}
+	a.Parent.RemoveChild(a)
+	walkElements(row, func(n *html.Node) {
+		if hasClass(n, "UnitDirectories-mobileSynopsis") || hasClass(n, "UnitDirectories-desktopSynopsis") {
+			for n.FirstChild != nil {
+				n.RemoveChild(n.FirstChild)
+			}
+		}
+	})
+}
+
+// pruneDirectoryTable removes from the directory listing table the
+// buttons expanding directories without subdirectories left, and the rows
+// of such directories that have no link left.
+func pruneDirectoryTable(table *html.Node) {
+	var rows []*html.Node
+	walkElements(table, func(n *html.Node) {
+		if n.DataAtom == atom.Tr && hasAttr(n, "data-aria-controls") && strings.TrimSpace(attrValue(n, "data-aria-controls")) == "" {
+			rows = append(rows, n)
+		}
+	})
+	for _, row := range rows {
+		if findElement(row, "a") == nil {
+			row.Parent.RemoveChild(row)
+			continue
+		}
+		if b := findElement(row, "button"); b != nil {
+			b.Parent.RemoveChild(b)
+		}
+		walkElements(row, func(n *html.Node) {
+			n.Attr = slices.DeleteFunc(n.Attr, func(a html.Attribute) bool {
+				return a.Key == "data-aria-controls" || a.Key == "data-aria-owns"
+			})
+		})
+	}
+}
+
+// walkElements calls f with each element of the tree rooted at n, in
+// document order. f may change the attributes of the elements.
+func walkElements(n *html.Node, f func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		f(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkElements(c, f)
+	}
+}
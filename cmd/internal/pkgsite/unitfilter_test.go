@@ -0,0 +1,232 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, test := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"**/internal/**", "example.com/m/internal", true},
+		{"**/internal/**", "example.com/m/internal/x/y", true},
+		{"**/internal/**", "example.com/m/internalx", false},
+		{"**/internal", "example.com/m/internal/x", false},
+		{"example.com/m/*", "example.com/m/a", true},
+		{"example.com/m/*", "example.com/m/a/b", false},
+		{"example.com/m/*", "example.com/m", false},
+		{"example.com/**/gen*", "example.com/m/a/generated", true},
+		{"**", "example.com/m", true},
+		{"example.com/m", "example.com/m", true},
+	} {
+		if got := matchGlob(test.pattern, test.name); got != test.want {
+			t.Errorf("matchGlob(%q, %q) = %t, want %t", test.pattern, test.name, got, test.want)
+		}
+	}
+}
+
+func TestUnitFilter(t *testing.T) {
+	f, err := newUnitFilter([]string{"example.com/m/**"}, []string{"**/internal/**"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]bool{
+		"example.com/m":            true,
+		"example.com/m/a":          true,
+		"example.com/m/a/internal": false,
+		"example.com/other":        false,
+	} {
+		if got := f.keeps(p); got != want {
+			t.Errorf("keeps(%q) = %t, want %t", p, got, want)
+		}
+	}
+	f, err = newUnitFilter(nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]bool{
+		"example.com/m/internal":        false,
+		"example.com/m/pkg/internal/x":  false,
+		"example.com/internal":          false,
+		"example.com/m/pkg/internalize": true,
+		"example.com/m/pkg":             true,
+	} {
+		if got := f.keeps(p); got != want {
+			t.Errorf("no internal: keeps(%q) = %t, want %t", p, got, want)
+		}
+	}
+	if f, err := newUnitFilter(nil, nil, false); f != nil || err != nil {
+		t.Errorf("newUnitFilter(nil, nil, false) = %v, %v; want nil, nil", f, err)
+	}
+	for _, p := range []string{"", "example.com/[m"} {
+		if _, err := newUnitFilter(nil, []string{p}, false); err == nil {
+			t.Errorf("newUnitFilter with pattern %q: got nil error", p)
+		}
+	}
+}
+
+func TestLeftOutLinksTransform(t *testing.T) {
+	units := map[string]bool{"example.com/m": true, "example.com/m/a": true}
+	left := map[string]bool{"example.com/m/b": true, "example.com/m/b/c": true, "example.com/m/d": true}
+	page := `<html><head></head><body>` +
+		`<p>See <a href="/example.com/m/b?tab=doc#F">b.F</a> and <a href="/example.com/m/a">a</a>.</p>` +
+		`<table class="UnitDirectories-table">` +
+		`<tr><td><a href="/example.com/m/a">a</a></td><td class="UnitDirectories-desktopSynopsis">A.</td></tr>` +
+		`<tr data-aria-controls="b-c "><td data-id="b" data-aria-owns="b-c "><div><button data-aria-controls="b-c ">v</button>` +
+		`<a href="/example.com/m/b">b</a></div></td><td class="UnitDirectories-desktopSynopsis">B.</td></tr>` +
+		`<tr data-id="b-c"><td><a href="/example.com/m/b/c">c</a></td><td class="UnitDirectories-desktopSynopsis">C.</td></tr>` +
+		`<tr><td><a href="/example.com/m/d">d</a></td><td class="UnitDirectories-desktopSynopsis">D.</td></tr>` +
+		`</table></body></html>`
+	got, err := processHTML([]byte(page), "/example.com/m", nil, leftOutLinksTransform(units, left))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p>See b.F and <a href="../../example.com/m/a">a</a>.</p>` +
+		`<table class="UnitDirectories-table"><tbody>` +
+		`<tr><td><a href="../../example.com/m/a">a</a></td><td class="UnitDirectories-desktopSynopsis">A.</td></tr>` +
+		`</tbody></table>`
+	if !strings.Contains(string(got), want) {
+		t.Errorf("got\n%s\nwant it to contain\n%s", got, want)
+	}
+
+	// A directory whose subdirectories are in the site keeps its row,
+	// without its link.
+	units["example.com/m/b/c"] = true
+	delete(left, "example.com/m/b/c")
+	got, err = processHTML([]byte(page), "/example.com/m", nil, leftOutLinksTransform(units, left))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<button data-aria-controls="b-c ">v</button><span>b</span></div></td><td class="UnitDirectories-desktopSynopsis"></td></tr>`,
+		`<tr data-id="b-c"><td><a href="../../example.com/m/b/c">c</a></td>`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("got\n%s\nwant it to contain\n%s", got, want)
+		}
+	}
+}
+
+func TestGenerateStaticSiteExclude(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	modDir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m does things. See [example.com/m/internal/secret.F].
+package m
+
+import _ "example.com/m/internal/secret"
+-- a/a.go --
+// Package a does other things.
+package a
+-- a/internal/helper/helper.go --
+// Package helper helps a.
+package helper
+-- internal/secret/secret.go --
+// Package secret is internal.
+package secret
+
+// F is internal.
+func F() {}
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{modDir},
+		UseListedMods: true,
+		SiteURL:       "https://docs.example.com",
+	}
+	opts := GenerateOptions{OutDir: outDir, Sitemap: true, ExcludeGlobs: []string{"**/internal/**"}}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists := func(p string) bool {
+		_, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p)))
+		return err == nil
+	}
+	for _, p := range []string{"example.com/m/index.html", "example.com/m/a/index.html"} {
+		if !exists(p) {
+			t.Errorf("%s was not generated", p)
+		}
+	}
+	for _, p := range []string{"example.com/m/internal", "example.com/m/a/internal"} {
+		if exists(p) {
+			t.Errorf("%s was generated", p)
+		}
+	}
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	for _, file := range []string{sitemapFile, searchIndexFile} {
+		if strings.Contains(read(file), "internal") {
+			t.Errorf("%s lists an internal package", file)
+		}
+	}
+	// The pages name the internal packages they import or refer to, but do
+	// not link to them.
+	internalLink := regexp.MustCompile(`href="[^"]*internal`)
+	for _, file := range []string{"example.com/m/index.html", "example.com/m/a/index.html", "example.com/m/imports/index.html"} {
+		if l := internalLink.FindString(read(file)); l != "" {
+			t.Errorf("%s links to an internal package: %s", file, l)
+		}
+	}
+	if strings.Contains(read("example.com/m/a/index.html"), "helper") {
+		t.Error("directory listing of example.com/m/a lists an internal package")
+	}
+	if len(report.BrokenLinks) > 0 {
+		t.Errorf("broken links: %+v", report.BrokenLinks)
+	}
+}
+
+func TestGenerateStaticSiteNoInternal(t *testing.T) {
+	outDir := generateTestSite(t, `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- pkg/pkg.go --
+// Package pkg does things.
+package pkg
+-- pkg/internal/impl/impl.go --
+// Package impl implements pkg.
+package impl
+`, func(_ *ServerConfig, opts *GenerateOptions) { opts.NoInternal = true })
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "m", "pkg", "internal")); !os.IsNotExist(err) {
+		t.Errorf("internal package page: got %v, want not exist", err)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "pkg", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "internal/impl") {
+		t.Error("page of example.com/m/pkg lists its internal package")
+	}
+	data, err = os.ReadFile(filepath.Join(outDir, searchIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "impl") {
+		t.Error("search index lists the internal package")
+	}
+}
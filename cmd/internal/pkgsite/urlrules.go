@@ -0,0 +1,220 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+	"golang.org/x/net/html"
+)
+
+// The attributes of the pages that hold URLs, and what becomes of their
+// URLs, are the tables below, which processHTML and the other steps that
+// read the URLs of the pages go by, and which URLRules returns for audit
+// (pkgsite -url_rules prints them). A URL is classified by its scheme, read
+// as browsers read it, so that "  JavaScript:" and "java\tscript:" are
+// javascript: URLs. Paths from the root of the host are made relative to
+// the page. In the content derived from documentation, written by the
+// authors of the modules, URLs that could run code are replaced by an
+// innocuous URL, as the sanitizer of the documentation does; the rest of
+// the markup of the pages is the generator's own, such as the bookmarklet
+// of the about page, and is left alone.
+
+// neutralizedURL replaces the neutralized URLs, as in safehtml.
+const neutralizedURL = "about:invalid#zGoSafez"
+
+// urlAttributes lists the attributes holding URLs.
+var urlAttributes = []schema.URLAttribute{
+	{Element: "html", Name: "href"},
+	{Element: "html", Name: "src"},
+	{Element: "html", Name: "action"},
+	{Element: "html", Name: "formaction"},
+	{Element: "html", Name: "poster"},
+	{Element: "html", Name: "data"},
+	{Element: "html", Name: "srcset", List: true},
+	{Element: "svg", Name: "href"}, // SVG 2 links, <use> and <image>
+	{Element: "svg", Namespace: "xlink", Name: "href"},
+	{Element: "math", Name: "href"},
+}
+
+// urlSchemes lists what is done to URLs, by scheme.
+var urlSchemes = []schema.URLScheme{
+	{Scheme: "", Action: schema.URLRelativize},
+	{Scheme: "http", Action: schema.URLPass},
+	{Scheme: "https", Action: schema.URLPass},
+	{Scheme: "mailto", Action: schema.URLPass},
+	{Scheme: "tel", Action: schema.URLPass},
+	{Scheme: "data", Action: schema.URLPassImages},
+	{Scheme: "javascript", Action: schema.URLNeutralize},
+	{Scheme: "vbscript", Action: schema.URLNeutralize},
+	{Scheme: "*", Action: schema.URLNeutralize},
+}
+
+// docContentClasses are the classes of the elements holding the content
+// derived from documentation.
+var docContentClasses = []string{"Documentation-content", "Overview-readmeContent"}
+
+// URLRules returns the rules that the generator applies to the URLs of the
+// pages.
+func URLRules() *schema.URLRules {
+	return &schema.URLRules{
+		SchemaVersion:        schema.URLRulesArtifact.Version.String(),
+		Attributes:           urlAttributes,
+		Schemes:              urlSchemes,
+		Neutralized:          neutralizedURL,
+		DocumentationContent: docContentClasses,
+	}
+}
+
+// urlAttrRule returns the rule of the attribute a of the element n, and
+// whether a holds URLs.
+func urlAttrRule(n *html.Node, a html.Attribute) (schema.URLAttribute, bool) {
+	ns := n.Namespace
+	if ns == "" {
+		ns = "html"
+	}
+	for _, r := range urlAttributes {
+		if r.Element == ns && r.Namespace == a.Namespace && r.Name == a.Key {
+			return r, true
+		}
+	}
+	return schema.URLAttribute{}, false
+}
+
+// isURLAttr reports whether the attribute a of the element n holds URLs.
+func isURLAttr(n *html.Node, a html.Attribute) bool {
+	_, ok := urlAttrRule(n, a)
+	return ok
+}
+
+// mapURLs returns val, the value of an attribute with the rule r, with f
+// applied to each of its URLs.
+func mapURLs(r schema.URLAttribute, val string, f func(u string) string) string {
+	if !r.List {
+		return f(val)
+	}
+	return mapSrcset(val, f)
+}
+
+// mapSrcset returns the list of image candidates of a srcset attribute
+// with f applied to the URL of each, parsed as browsers do. The rest of
+// the list is kept as is.
+func mapSrcset(s string, f func(u string) string) string {
+	var b strings.Builder
+	last, i := 0, 0
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r' }
+	for i < len(s) {
+		for i < len(s) && (isSpace(s[i]) || s[i] == ',') {
+			i++
+		}
+		if i == len(s) {
+			break
+		}
+		start := i
+		for i < len(s) && !isSpace(s[i]) {
+			i++
+		}
+		end := i
+		// A URL ending in commas has no descriptors; the commas end it.
+		for end > start && s[end-1] == ',' {
+			end--
+		}
+		if end == i {
+			depth := 0
+			for ; i < len(s); i++ {
+				if s[i] == '(' {
+					depth++
+				} else if s[i] == ')' && depth > 0 {
+					depth--
+				} else if s[i] == ',' && depth == 0 {
+					break
+				}
+			}
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(f(s[start:end]))
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// urlScheme returns the scheme of the URL u in lower case, as browsers
+// read it, or "" if it has none.
+func urlScheme(u string) string {
+	u = strings.TrimLeft(u, "\x00\x01\x02\x03\x04\x05\x06\x07\x08\t\n\x0b\x0c\r\x0e\x0f\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f ")
+	u = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(u)
+	for i := 0; i < len(u); i++ {
+		c := u[i]
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		case i > 0 && c == ':':
+			return strings.ToLower(u[:i])
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// urlAction returns what is done to the URL u.
+func urlAction(u string) string {
+	scheme := urlScheme(u)
+	action := ""
+	for _, r := range urlSchemes {
+		if r.Scheme == scheme {
+			return r.Action
+		}
+		if r.Scheme == "*" {
+			action = r.Action
+		}
+	}
+	return action
+}
+
+// isImageDataURL reports whether u is a data: URL of an image.
+func isImageDataURL(u string) bool {
+	_, rest, _ := strings.Cut(u, ":")
+	return strings.HasPrefix(strings.ToLower(strings.TrimLeft(rest, " ")), "image/")
+}
+
+// rewriteURL returns the URL u of an attribute of the element n, as the
+// rules have it for a page whose relative path to the site root is
+// prefix.
+func rewriteURL(n *html.Node, u, prefix string) string {
+	switch urlAction(u) {
+	case schema.URLRelativize:
+		if strings.HasPrefix(u, "/") && !strings.HasPrefix(u, "//") {
+			return prefix + canonicalURLPath(cleanURLPath(u))[1:]
+		}
+	case schema.URLPassImages:
+		if !isImageDataURL(u) && inDocContent(n) {
+			return neutralizedURL
+		}
+	case schema.URLNeutralize:
+		if inDocContent(n) {
+			return neutralizedURL
+		}
+	}
+	return u
+}
+
+// inDocContent reports whether the element n is content derived from
+// documentation.
+func inDocContent(n *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		for _, c := range docContentClasses {
+			if hasClass(n, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,293 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+	"golang.org/x/net/html"
+)
+
+func TestIsURLAttr(t *testing.T) {
+	for _, test := range []struct {
+		ns, elem string
+		attr     html.Attribute
+		want     bool
+	}{
+		{"", "a", html.Attribute{Key: "href"}, true},
+		{"", "img", html.Attribute{Key: "src"}, true},
+		{"", "img", html.Attribute{Key: "srcset"}, true},
+		{"", "form", html.Attribute{Key: "action"}, true},
+		{"", "button", html.Attribute{Key: "formaction"}, true},
+		{"", "video", html.Attribute{Key: "poster"}, true},
+		{"", "object", html.Attribute{Key: "data"}, true},
+		{"svg", "use", html.Attribute{Key: "href"}, true},
+		{"svg", "a", html.Attribute{Namespace: "xlink", Key: "href"}, true},
+		{"math", "mi", html.Attribute{Key: "href"}, true},
+		{"", "a", html.Attribute{Key: "class"}, false},
+		{"", "a", html.Attribute{Key: "id"}, false},
+		{"", "a", html.Attribute{Key: "style"}, false},
+		{"", "input", html.Attribute{Key: "value"}, false},
+		{"svg", "rect", html.Attribute{Key: "data"}, false},
+		{"", "a", html.Attribute{Namespace: "xlink", Key: "href"}, false},
+	} {
+		n := &html.Node{Type: html.ElementNode, Namespace: test.ns, Data: test.elem}
+		if got := isURLAttr(n, test.attr); got != test.want {
+			t.Errorf("isURLAttr(<%s:%s>, %s:%s) = %t, want %t", test.ns, test.elem, test.attr.Namespace, test.attr.Key, got, test.want)
+		}
+	}
+}
+
+func TestURLScheme(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"https://example.com", "https"},
+		{"JavaScript:alert(1)", "javascript"},
+		{" \x01\x1fjavascript:x", "javascript"},
+		{"java\tscr\nipt:x", "javascript"},
+		{"c++:x", "c++"},
+		{"mailto:a@example.com", "mailto"},
+		{"/a:b", ""},
+		{"a/b:c", ""},
+		{"1a:b", ""},
+		{"#x:y", ""},
+		{"?a:b", ""},
+		{"", ""},
+		{":x", ""},
+	} {
+		if got := urlScheme(test.in); got != test.want {
+			t.Errorf("urlScheme(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestMapSrcset(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"a.png", "[a.png]"},
+		{"a.png 1x, /b.png 2x", "[a.png] 1x, [/b.png] 2x"},
+		{" a.png,b.png 2x ,, ", " [a.png,b.png] 2x ,, "},
+		{"a.png, b.png", "[a.png], [b.png]"},
+		{"data:image/png;base64,AA== 1x, c.png 100w", "[data:image/png;base64,AA==] 1x, [c.png] 100w"},
+		{"a.png (x, y), b.png", "[a.png] (x, y), [b.png]"},
+		{"a.png,,, b.png", "[a.png],,, [b.png]"},
+		{"", ""},
+	} {
+		if got := mapSrcset(test.in, func(u string) string { return "[" + u + "]" }); got != test.want {
+			t.Errorf("mapSrcset(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestURLRulesJSON(t *testing.T) {
+	data, err := json.Marshal(URLRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := schema.DecodeURLRules(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Attributes) != len(urlAttributes) || len(rules.Schemes) != len(urlSchemes) || rules.Neutralized != neutralizedURL {
+		t.Errorf("decoded rules %+v differ from the tables", rules)
+	}
+	star := false
+	for _, s := range rules.Schemes {
+		switch s.Action {
+		case schema.URLRelativize, schema.URLPass, schema.URLPassImages, schema.URLNeutralize:
+		default:
+			t.Errorf("scheme %q: unknown action %q", s.Scheme, s.Action)
+		}
+		star = star || s.Scheme == "*"
+	}
+	if !star {
+		t.Error("no rule for the other schemes")
+	}
+}
+
+// urlRulePage returns a page with an element, of id x, having the attribute
+// of the rule r set to val, inside documentation content if doc is set.
+func urlRulePage(r schema.URLAttribute, val string, doc bool) string {
+	attr := r.Name
+	if r.Namespace != "" {
+		attr = r.Namespace + ":" + r.Name
+	}
+	elem := fmt.Sprintf(`<span id="x" %s="%s"></span>`, attr, html.EscapeString(val))
+	switch r.Element {
+	case "svg":
+		elem = fmt.Sprintf(`<svg><use id="x" %s="%s"></use></svg>`, attr, html.EscapeString(val))
+	case "math":
+		elem = fmt.Sprintf(`<math><mi id="x" %s="%s"></mi></math>`, attr, html.EscapeString(val))
+	}
+	if doc {
+		elem = `<div class="Documentation-content">` + elem + `</div>`
+	}
+	return `<html><head></head><body>` + elem + `</body></html>`
+}
+
+// urlRuleValue returns the value of the attribute of the rule r of the
+// element with the id x of the page.
+func urlRuleValue(t *testing.T, page []byte, r schema.URLAttribute) string {
+	t.Helper()
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := findElementFunc(doc, func(n *html.Node) bool { return n.Type == html.ElementNode && attrValue(n, "id") == "x" })
+	if n == nil {
+		t.Fatalf("no element in %s", page)
+	}
+	for _, a := range n.Attr {
+		if a.Namespace == r.Namespace && a.Key == r.Name {
+			return a.Val
+		}
+	}
+	t.Fatalf("no %s:%s attribute in %s", r.Namespace, r.Name, page)
+	return ""
+}
+
+// randomURLPath returns a path from the root of the host, with a query or
+// fragment now and then.
+func randomURLPath(r *rand.Rand) string {
+	const chars = "abcxyz019._-~"
+	var b strings.Builder
+	for range 1 + r.IntN(4) {
+		b.WriteByte('/')
+		for range 1 + r.IntN(8) {
+			b.WriteByte(chars[r.IntN(len(chars))])
+		}
+	}
+	if r.IntN(3) == 0 {
+		b.WriteString("?q=/x")
+	}
+	if r.IntN(3) == 0 {
+		b.WriteString("#frag")
+	}
+	return b.String()
+}
+
+// Every attribute of the table has its paths from the root made relative to
+// the page, and they resolve to the same paths, in documentation content
+// and out of it.
+func TestURLRulesRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	for _, rule := range urlAttributes {
+		for i := range fuzzIterations() / 10 {
+			urlPath := fuzzURLPaths[i%len(fuzzURLPaths)]
+			prefix := relativePrefix(urlPath)
+			paths := []string{randomURLPath(r)}
+			val := paths[0]
+			if rule.List {
+				paths = append(paths, randomURLPath(r))
+				val = paths[0] + " 1x, " + paths[1] + " 2x"
+			}
+			got, err := processHTML([]byte(urlRulePage(rule, val, i%2 == 0)), urlPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rewritten := urlRuleValue(t, got, rule)
+			var back []string
+			mapURLs(rule, rewritten, func(u string) string {
+				if strings.HasPrefix(u, "/") || urlScheme(u) != "" {
+					t.Errorf("%+v at %s: %q became %q, not relative", rule, urlPath, val, rewritten)
+				}
+				back = append(back, normalizeURL(u, prefix, true))
+				return u
+			})
+			for j, p := range paths {
+				if want := canonicalURLPath(cleanURLPath(p)); j >= len(back) || back[j] != want {
+					t.Errorf("%+v at %s: %q became %q, which resolves to %q, want %q", rule, urlPath, val, rewritten, back, want)
+				}
+			}
+		}
+	}
+}
+
+// randomDangerousURL returns a URL whose scheme runs code or is unknown,
+// spelled in the ways browsers still read. Without space, it uses no
+// whitespace, which ends the URLs of lists.
+func randomDangerousURL(r *rand.Rand, space bool) string {
+	schemes := []string{"javascript", "vbscript", "livescript", "x-unknown", "about", "data"}
+	s := []byte(schemes[r.IntN(len(schemes))])
+	for i := range s {
+		if r.IntN(2) == 0 {
+			s[i] = byte(strings.ToUpper(string(s[i]))[0])
+		}
+	}
+	scheme := string(s)
+	if space {
+		if i := r.IntN(len(scheme)); r.IntN(2) == 0 {
+			scheme = scheme[:i] + []string{"\t", "\n", "\r\n"}[r.IntN(3)] + scheme[i:]
+		}
+		scheme = strings.Repeat([]string{" ", "\x01", "\x1f", "\t"}[r.IntN(4)], r.IntN(3)) + scheme
+	}
+	if strings.EqualFold(string(s), "data") {
+		return scheme + ":text/html;base64,PHNjcmlwdD4="
+	}
+	return scheme + ":alert(1)"
+}
+
+// URLs that run code, or of unknown schemes, are neutralized in
+// documentation content, and left alone in the rest of the page.
+func TestURLRulesNeutralize(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	for _, rule := range urlAttributes {
+		for i := range fuzzIterations() / 10 {
+			urlPath := fuzzURLPaths[i%len(fuzzURLPaths)]
+			val := randomDangerousURL(r, !rule.List)
+			if rule.List {
+				val = "a.png 1x, " + val + " 2x"
+			}
+			for _, doc := range []bool{true, false} {
+				page := urlRulePage(rule, val, doc)
+				got, err := processHTML([]byte(page), urlPath, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rewritten := urlRuleValue(t, got, rule)
+				want := urlRuleValue(t, []byte(page), rule)
+				if doc {
+					want = neutralizedURL
+					if rule.List {
+						want = "a.png 1x, " + neutralizedURL + " 2x"
+					}
+				}
+				if rewritten != want {
+					t.Errorf("%+v in documentation: %t: %q became %q, want %q", rule, doc, val, rewritten, want)
+				}
+			}
+		}
+	}
+}
+
+func TestURLRulesPass(t *testing.T) {
+	rule := schema.URLAttribute{Element: "html", Name: "href"}
+	for _, val := range []string{
+		"https://example.com/a",
+		"HTTP://example.com/a",
+		"mailto:gopher@example.com",
+		"tel:+1-555-0100",
+		"data:image/png;base64,AA==",
+		"#frag",
+		"a/b?c",
+		"//example.com/x",
+	} {
+		got, err := processHTML([]byte(urlRulePage(rule, val, true)), "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rewritten := urlRuleValue(t, got, rule); rewritten != val {
+			t.Errorf("%q became %q, want it unchanged", val, rewritten)
+		}
+	}
+}
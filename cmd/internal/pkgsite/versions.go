@@ -0,0 +1,371 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+	"golang.org/x/net/html"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/derrors"
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+	"github.com/wow-look-at-my/static-pkgsite/internal/proxy"
+	"github.com/wow-look-at-my/static-pkgsite/internal/source"
+	"github.com/wow-look-at-my/static-pkgsite/internal/stdlib"
+	"github.com/wow-look-at-my/static-pkgsite/internal/version"
+)
+
+// A module can be documented at several versions, each read from a
+// directory of its own, as ServerConfig.ModuleVersions lists them. The
+// pages of a version are written under the module path and the version:
+//
+//	example.com/m/a/          the unversioned pages
+//	example.com/m@v1.2.0/a/   the pages of v1.2.0
+//
+// The unversioned pages are those of the module's directory in Paths, if
+// it has one, and otherwise those of its latest version, which also gets
+// its versioned pages. Every unit of a module with versions gets a versions
+// tab, listing the versions that have the unit, with links to their pages.
+//
+// The links of the frontend name the version of the unit they point at,
+// such as /example.com/m@v0.0.0/a. They are pointed at the pages of that
+// version, if it has pages, or at the unversioned pages, if those are of
+// that version, before they are made relative like the others. The pages
+// of the versions are left out of the search index, the sitemap and the
+// Markdown export, which are those of the unversioned pages.
+
+// A ModuleVersion is a version of a module, read from a directory.
+type ModuleVersion struct {
+	Path    string // module path
+	Version string // canonical semantic version, such as v1.2.0, or a query such as latest for a remote module
+	Dir     string // directory holding the module at the version; empty for a remote module
+}
+
+// ParseModuleVersion parses a module version written as
+// "path@version=dir", such as "example.com/m@v1.2.0=../m-1.2.0".
+func ParseModuleVersion(s string) (ModuleVersion, error) {
+	modver, dir, ok := strings.Cut(s, "=")
+	i := strings.LastIndex(modver, "@")
+	if !ok || i < 0 || dir == "" {
+		return ModuleVersion{}, fmt.Errorf("invalid module version %q: want path@version=dir", s)
+	}
+	mv := ModuleVersion{Path: modver[:i], Version: modver[i+1:], Dir: dir}
+	if err := mv.check(); err != nil {
+		return ModuleVersion{}, err
+	}
+	return mv, nil
+}
+
+// check checks that mv has a module path and a canonical version, other
+// than the version of local modules.
+func (mv ModuleVersion) check() error {
+	if mv.Path == "" || mv.Dir == "" {
+		return fmt.Errorf("module version %s@%s: missing module path or directory", mv.Path, mv.Version)
+	}
+	if !semver.IsValid(mv.Version) || semver.Canonical(mv.Version) != mv.Version {
+		return fmt.Errorf("module version %s@%s: not a canonical semantic version", mv.Path, mv.Version)
+	}
+	if mv.Version == fetch.LocalVersion {
+		return fmt.Errorf("module version %s@%s: %s is the version of local modules", mv.Path, mv.Version, fetch.LocalVersion)
+	}
+	return nil
+}
+
+// A versionGetter serves a version of a module from a directory, or from
+// the module cache for a remote module. The getter of the latest version of
+// a module without a local directory also serves the latest and local
+// versions of the module, as that version.
+type versionGetter struct {
+	fetch.ModuleGetter // of the directory or the module cache, asked for version
+	modulePath         string
+	version            string
+	dir                string
+	latest             bool
+}
+
+// newVersionGetters returns the getters of the module versions mvs,
+// ordered by module path and descending version, and the versions whose
+// directories hold another module than mvs gives them, whose getters are
+// of that module. local holds the paths of the modules read from Paths.
+func newVersionGetters(mvs []ModuleVersion, local map[string]bool) ([]*versionGetter, []modulePathMismatch, error) {
+	seen := map[string]bool{}
+	var (
+		getters    []*versionGetter
+		mismatches []modulePathMismatch
+	)
+	for _, mv := range mvs {
+		if err := mv.check(); err != nil {
+			return nil, nil, err
+		}
+		key := mv.Path + "@" + mv.Version
+		if seen[key] {
+			return nil, nil, fmt.Errorf("module version %s is given twice", key)
+		}
+		seen[key] = true
+		if _, err := os.Stat(filepath.Join(mv.Dir, "go.mod")); err != nil {
+			return nil, nil, fmt.Errorf("module version %s: %v", key, err)
+		}
+		// The version is of the module that its go.mod file declares.
+		modulePath, mismatch, err := declaredModulePath(mv.Path, mv.Dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("module version %s: %v", key, err)
+		}
+		if mismatch != nil {
+			mismatches = append(mismatches, *mismatch)
+			key = modulePath + "@" + mv.Version
+			if seen[key] {
+				return nil, nil, fmt.Errorf("module version %s is given twice", key)
+			}
+			seen[key] = true
+		}
+		g, err := fetch.NewDirectoryModuleGetter(modulePath, mv.Dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		getters = append(getters, &versionGetter{ModuleGetter: g, modulePath: modulePath, version: mv.Version, dir: mv.Dir})
+	}
+	sort.Slice(getters, func(i, j int) bool {
+		if gi, gj := getters[i], getters[j]; gi.modulePath != gj.modulePath {
+			return gi.modulePath < gj.modulePath
+		}
+		return semver.Compare(getters[i].version, getters[j].version) > 0
+	})
+	for i, g := range getters {
+		g.latest = !local[g.modulePath] && (i == 0 || getters[i-1].modulePath != g.modulePath)
+	}
+	return getters, mismatches, nil
+}
+
+// serves reports whether g serves the module at modulePath at vers.
+func (g *versionGetter) serves(modulePath, vers string) bool {
+	if modulePath != g.modulePath {
+		return false
+	}
+	return vers == g.version || g.latest && (vers == version.Latest || vers == fetch.LocalVersion)
+}
+
+// check returns an error wrapping derrors.NotFound if g does not serve the
+// module at modulePath at vers.
+func (g *versionGetter) check(modulePath, vers string) error {
+	if !g.serves(modulePath, vers) {
+		return fmt.Errorf("%s@%s is not %s@%s: %w", modulePath, vers, g.modulePath, g.version, derrors.NotFound)
+	}
+	return nil
+}
+
+// Info returns basic information about the module, at the version of g.
+func (g *versionGetter) Info(ctx context.Context, modulePath, vers string) (*proxy.VersionInfo, error) {
+	if err := g.check(modulePath, vers); err != nil {
+		return nil, err
+	}
+	info, err := g.ModuleGetter.Info(ctx, modulePath, g.version)
+	if err != nil {
+		return nil, err
+	}
+	info.Version = g.version
+	return info, nil
+}
+
+// Mod returns the contents of the module's go.mod file.
+func (g *versionGetter) Mod(ctx context.Context, modulePath, vers string) ([]byte, error) {
+	if err := g.check(modulePath, vers); err != nil {
+		return nil, err
+	}
+	return g.ModuleGetter.Mod(ctx, modulePath, g.version)
+}
+
+// ContentDir returns an FS for the module's contents.
+func (g *versionGetter) ContentDir(ctx context.Context, modulePath, vers string) (fs.FS, error) {
+	if err := g.check(modulePath, vers); err != nil {
+		return nil, err
+	}
+	return g.ModuleGetter.ContentDir(ctx, modulePath, g.version)
+}
+
+// SourceInfo returns information about where to find the module's files.
+func (g *versionGetter) SourceInfo(ctx context.Context, modulePath, vers string) (*source.Info, error) {
+	if err := g.check(modulePath, vers); err != nil {
+		return nil, err
+	}
+	return g.ModuleGetter.SourceInfo(ctx, modulePath, g.version)
+}
+
+func (g *versionGetter) String() string {
+	return fmt.Sprintf("Version(%s@%s, %s)", g.modulePath, g.version, g.ModuleGetter)
+}
+
+// versionInfos returns the versions of the modules of getters, keyed by
+// module path, as FetchDataSource.SetVersions takes them. The modules
+// read from Paths, whose paths local holds, also have the local version.
+func versionInfos(getters []*versionGetter, local map[string]bool) map[string][]*internal.ModuleInfo {
+	infos := map[string][]*internal.ModuleInfo{}
+	for _, g := range getters {
+		if infos[g.modulePath] == nil && local[g.modulePath] {
+			infos[g.modulePath] = append(infos[g.modulePath], &internal.ModuleInfo{ModulePath: g.modulePath, Version: fetch.LocalVersion})
+		}
+		infos[g.modulePath] = append(infos[g.modulePath], &internal.ModuleInfo{ModulePath: g.modulePath, Version: g.version})
+	}
+	return infos
+}
+
+// enumerateVersionUnits returns the units of the module versions of
+// getters, at their versioned site paths, sorted by path. A version that
+// fails to load is an error.
+func enumerateVersionUnits(ctx context.Context, getters []*versionGetter, opts fetch.LoadOptions) ([]*siteUnit, error) {
+	var units []*siteUnit
+	for _, g := range getters {
+		lm := fetch.FetchLazyModuleWithOptions(ctx, g.modulePath, g.version, g, opts)
+		if lm.Error != nil {
+			return nil, fmt.Errorf("loading %s@%s: %w", g.modulePath, g.version, lm.Error)
+		}
+		for _, um := range lm.UnitMetas {
+			units = append(units, &siteUnit{
+				path:    versionedUnitPath(canonicalUnitPath(um.Path), canonicalUnitPath(g.modulePath), g.version),
+				version: g.version,
+				meta:    um,
+				module:  lm,
+				getter:  g,
+			})
+		}
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].path < units[j].path })
+	return units, nil
+}
+
+// versionedUnitPath returns the site path of the unit at unitPath, in the
+// module at modulePath, at version v, such as "example.com/m@v1.2.0/a".
+func versionedUnitPath(unitPath, modulePath, v string) string {
+	return modulePath + "@" + v + strings.TrimPrefix(unitPath, modulePath)
+}
+
+// unversionedPath returns the canonical path of u, without its version.
+func (u *siteUnit) unversionedPath() string {
+	if u.version == "" {
+		return u.path
+	}
+	return canonicalUnitPath(u.meta.Path)
+}
+
+// moduleSitePath returns the site path of the module of u, with the
+// version of u, if it has one.
+func (u *siteUnit) moduleSitePath() string {
+	p := canonicalUnitPath(u.meta.ModulePath)
+	if u.version != "" {
+		p += "@" + u.version
+	}
+	return p
+}
+
+// A versionLinker points the links to versions of units at their pages.
+type versionLinker struct {
+	current map[string]string // the version of the unversioned pages, by canonical module path
+	units   map[string]bool   // the paths of the unversioned units
+	// The links to the units of the standard library have its tag, such
+	// as go1.22.0, after the unit path rather than after the module path.
+	stdTag   string          // the tag of the unversioned pages of std, if any
+	stdUnits map[string]bool // the paths of the units of std
+}
+
+// newVersionLinker returns the versionLinker of a site with the
+// unversioned units.
+func newVersionLinker(units []*siteUnit) *versionLinker {
+	l := &versionLinker{current: map[string]string{}, units: map[string]bool{}, stdUnits: map[string]bool{}}
+	for _, u := range units {
+		l.current[canonicalUnitPath(u.meta.ModulePath)] = u.module.Version
+		l.units[u.path] = true
+		if u.meta.ModulePath == stdlib.ModulePath {
+			l.stdUnits[u.path] = true
+			if tag, err := stdlib.TagForVersion(u.module.Version); err == nil {
+				l.stdTag = tag
+			}
+		}
+	}
+	return l
+}
+
+// transform returns the page transform for the pages of u, or of no unit
+// if u is nil. A link to the version of the unversioned pages of a module
+// loses its version, so that it points at those pages, unless u is of that
+// version. Links to other versions are left alone. The page of a version
+// of a unit that the unversioned pages do not have loses the link to its
+// latest version.
+func (l *versionLinker) transform(u *siteUnit) pageTransform {
+	own, gone := "", false
+	if u != nil && u.version != "" {
+		own, gone = u.moduleSitePath(), !l.units[u.unversionedPath()]
+	}
+	rewrite := func(href string) (string, bool) {
+		p, ok := strings.CutPrefix(href, "/")
+		if !ok {
+			return "", false
+		}
+		mod, rest, ok := strings.Cut(p, "@")
+		if !ok || strings.ContainsAny(mod, "?#") {
+			return "", false
+		}
+		vers, tail := rest, ""
+		if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+			vers, tail = rest[:i], rest[i:]
+		}
+		mod = canonicalUnitPath(mod)
+		if l.stdUnits[mod] && vers == l.stdTag {
+			return "/" + mod + tail, true
+		}
+		if current, ok := l.current[mod]; !ok || current != vers || mod+"@"+vers == own {
+			return "", false
+		}
+		return "/" + mod + tail, true
+	}
+	return func(doc *html.Node, _ *headManager) {
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode {
+				key := ""
+				switch n.Data {
+				case "a":
+					key = "href"
+				case "option":
+					key = "value"
+				}
+				if href, ok := rewrite(attrValue(n, key)); key != "" && ok {
+					setAttr(n, key, href)
+				}
+				if gone && n.Data == "a" && attrValue(n, "aria-label") == "Go to Latest Version" {
+					n.Attr = slices.DeleteFunc(n.Attr, func(a html.Attribute) bool { return a.Key == "href" })
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+	}
+}
+
+// versionsHeaderLinkTransform returns the page transform pointing the
+// version link of the header of the page of the unit at the site path
+// unitPath, which is relative, at the versions tab of the unit.
+func versionsHeaderLinkTransform(unitPath string) pageTransform {
+	return func(doc *html.Node, _ *headManager) {
+		item := findElementFunc(doc, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && attrValue(n, "data-test-id") == "UnitHeader-version"
+		})
+		if item == nil {
+			return
+		}
+		if a := findElement(item, "a"); a != nil && attrValue(a, "href") == "?tab="+versionsTab {
+			setAttr(a, "href", "/"+unitPath+"?tab="+versionsTab)
+		}
+	}
+}
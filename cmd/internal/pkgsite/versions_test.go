@@ -0,0 +1,291 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestParseModuleVersion(t *testing.T) {
+	got, err := ParseModuleVersion("example.com/m@v1.2.0=../m=1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ModuleVersion{Path: "example.com/m", Version: "v1.2.0", Dir: "../m=1.2"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	for _, s := range []string{
+		"example.com/m@v1.2.0",
+		"example.com/m=dir",
+		"@v1.2.0=dir",
+		"example.com/m@v1.2.0=",
+		"example.com/m@v1.2=dir",
+		"example.com/m@latest=dir",
+		"example.com/m@" + fetch.LocalVersion + "=dir",
+	} {
+		if _, err := ParseModuleVersion(s); err == nil {
+			t.Errorf("ParseModuleVersion(%q): got nil error", s)
+		}
+	}
+}
+
+func TestVersionLinker(t *testing.T) {
+	unit := func(path, version, modulePath, modVersion string) *siteUnit {
+		return &siteUnit{
+			path:    path,
+			version: version,
+			meta:    &internal.UnitMeta{Path: path, ModuleInfo: internal.ModuleInfo{ModulePath: modulePath}},
+			module:  &fetch.LazyModule{ModuleInfo: internal.ModuleInfo{ModulePath: modulePath, Version: modVersion}},
+		}
+	}
+	l := newVersionLinker([]*siteUnit{unit("example.com/m", "", "example.com/m", "v1.1.0")})
+	page := `<html><head></head><body>` +
+		`<a href="/example.com/m@v1.1.0/a?tab=imports">a</a>` +
+		`<a href="/example.com/m@v1.0.0/a">a</a>` +
+		`<a href="/example.com/m@v1.1.0#section">m</a>` +
+		`<a href="/other.com/x@v1.1.0/y">y</a>` +
+		`<select><option value="/example.com/m@v1.1.0?tab=versions">Versions</option></select>` +
+		`</body></html>`
+	for _, test := range []struct {
+		unit *siteUnit
+		want []string
+	}{
+		{nil, []string{
+			`href="../../example.com/m/a?tab=imports"`,
+			`href="../../example.com/m@v1.0.0/a"`,
+			`href="../../example.com/m#section"`,
+			`href="../../other.com/x@v1.1.0/y"`,
+			`value="/example.com/m?tab=versions"`,
+		}},
+		// The pages of the version of the unversioned pages link to
+		// themselves.
+		{unit("example.com/m@v1.1.0", "v1.1.0", "example.com/m", "v1.1.0"), []string{
+			`href="../../example.com/m@v1.1.0/a?tab=imports"`,
+			`href="../../example.com/m@v1.0.0/a"`,
+		}},
+	} {
+		got, err := processHTML([]byte(page), "/example.com/m", nil, l.transform(test.unit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(got), want) {
+				t.Errorf("got\n%s\nwant it to contain %s", got, want)
+			}
+		}
+	}
+}
+
+func TestTabPagesVersions(t *testing.T) {
+	um := &internal.UnitMeta{Path: "example.com/m", ModuleInfo: internal.ModuleInfo{ModulePath: "example.com/m"}}
+	selected := []*siteUnit{
+		{path: "example.com/m", meta: um},
+		{path: "example.com/m@v1.0.0", version: "v1.0.0", meta: um},
+	}
+	units := map[string]bool{"example.com/m": true, "example.com/m@v1.0.0": true}
+	pages, links, _ := tabPages(units, selected, map[string]bool{"example.com/m": true})
+	wantPages := map[string]bool{
+		"example.com/m/licenses":        true,
+		"example.com/m/versions":        true,
+		"example.com/m@v1.0.0/licenses": true,
+		"example.com/m@v1.0.0/versions": true,
+	}
+	if diff := cmp.Diff(wantPages, pages); diff != "" {
+		t.Errorf("pages mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := links["example.com/m@v1.0.0/licenses"], "example.com/m@v1.0.0/licenses"; got != want {
+		t.Errorf("licenses of v1.0.0 link to %q, want %q", got, want)
+	}
+}
+
+func TestGenerateStaticSiteVersions(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- m/go.mod --
+module example.com/m
+
+go 1.21
+-- m/m.go --
+// Package m does things.
+package m
+-- m/a/a.go --
+// Package a does other things.
+package a
+-- v1.0.0/go.mod --
+module example.com/m
+
+go 1.21
+-- v1.0.0/m.go --
+// Package m did things.
+package m
+-- v1.1.0/go.mod --
+module example.com/m
+
+go 1.21
+-- v1.1.0/m.go --
+// Package m did things.
+package m
+-- v1.1.0/a/a.go --
+// Package a did other things.
+package a
+-- v1.1.0/old/old.go --
+// Package old is gone.
+package old
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{filepath.Join(dir, "m")},
+		UseListedMods: true,
+		SiteURL:       "https://docs.example.com",
+		ModuleVersions: []ModuleVersion{
+			{Path: "example.com/m", Version: "v1.0.0", Dir: filepath.Join(dir, "v1.0.0")},
+			{Path: "example.com/m", Version: "v1.1.0", Dir: filepath.Join(dir, "v1.1.0")},
+		},
+	}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Sitemap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(p string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p), "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got := read("example.com/m@v1.1.0/old"); !strings.Contains(got, "Package old is gone.") {
+		t.Error("page of example.com/m@v1.1.0/old does not document it")
+	}
+	if got := read("example.com/m@v1.0.0"); !strings.Contains(got, "Package m did things.") {
+		t.Error("page of example.com/m@v1.0.0 does not document it")
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "m@v1.0.0", "a")); !os.IsNotExist(err) {
+		t.Errorf("page of a unit missing from v1.0.0: got %v, want not exist", err)
+	}
+
+	// The versions tab of a unit links to the versions that have it, and
+	// to the unversioned pages for the local version.
+	for _, test := range []struct {
+		page       string
+		want, dont []string
+	}{
+		{"example.com/m/versions", []string{`href="../../../example.com/m@v1.1.0"`, `href="../../../example.com/m@v1.0.0"`, `href="../../../example.com/m"`}, nil},
+		{"example.com/m/a/versions", []string{`href="../../../../example.com/m@v1.1.0/a"`}, []string{"m@v1.0.0/a"}},
+		{"example.com/m@v1.0.0/versions", []string{`href="../../../example.com/m@v1.1.0"`}, nil},
+		{"example.com/m", []string{`href="../../example.com/m/versions"`}, []string{`m@v0.0.0/a"`}},
+		{"example.com/m@v1.1.0", []string{`href="../../example.com/m@v1.1.0/a"`, `href="../../example.com/m@v1.1.0/versions"`}, nil},
+	} {
+		got := read(test.page)
+		for _, want := range test.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s does not contain %s", test.page, want)
+			}
+		}
+		for _, dont := range test.dont {
+			if strings.Contains(got, dont) {
+				t.Errorf("%s contains %s", test.page, dont)
+			}
+		}
+	}
+
+	// Every link to a version leads to a page.
+	versionLink := regexp.MustCompile(`href="((?:\.\./)+)([^"?#]*@[^"?#]*)`)
+	for _, p := range []string{"example.com/m/versions", "example.com/m@v1.1.0", "example.com/m@v1.1.0/a"} {
+		for _, m := range versionLink.FindAllStringSubmatch(read(p), -1) {
+			if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(m[2]), "index.html")); err != nil {
+				t.Errorf("%s: broken link %s%s", p, m[1], m[2])
+			}
+		}
+	}
+	checkInternalLinks(t, outDir, "example.com/m")
+	if len(report.BrokenLinks) > 0 {
+		t.Errorf("broken links: %+v", report.BrokenLinks)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, sitemapFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "@") {
+		t.Error("sitemap lists the pages of versions")
+	}
+}
+
+func TestGenerateStaticSiteVersionsOnly(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- other/go.mod --
+module example.com/other
+
+go 1.21
+-- other/other.go --
+// Package other is local.
+package other
+-- v1.0.0/go.mod --
+module example.com/m
+
+go 1.21
+-- v1.0.0/m.go --
+// Package m did things.
+package m
+-- v1.1.0/go.mod --
+module example.com/m
+
+go 1.21
+-- v1.1.0/m.go --
+// Package m does things.
+package m
+-- v1.1.0/a/a.go --
+// Package a does other things.
+package a
+`)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Paths:         []string{filepath.Join(dir, "other")},
+		UseListedMods: true,
+		ModuleVersions: []ModuleVersion{
+			{Path: "example.com/m", Version: "v1.0.0", Dir: filepath.Join(dir, "v1.0.0")},
+			{Path: "example.com/m", Version: "v1.1.0", Dir: filepath.Join(dir, "v1.1.0")},
+		},
+	}
+	report, err := GenerateStaticSiteWithOptions(context.Background(), cfg, GenerateOptions{OutDir: outDir, Sitemap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The unversioned pages are those of the latest version, which link to
+	// each other.
+	data, err := os.ReadFile(filepath.Join(outDir, "example.com", "m", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Package m does things.", `href="../../example.com/m/a"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("page of example.com/m does not contain %s", want)
+		}
+	}
+	for _, p := range []string{"example.com/m@v1.0.0", "example.com/m@v1.1.0/a", "example.com/m/a/versions", "example.com/other"} {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(p), "index.html")); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "other", "versions")); !os.IsNotExist(err) {
+		t.Errorf("versions tab of a module without versions: got %v, want not exist", err)
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+	if len(report.BrokenLinks) > 0 {
+		t.Errorf("broken links: %+v", report.BrokenLinks)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// The modules of a go.work workspace can be documented together, as
+// ServerConfig.Workspace names its root. The modules of its use directives
+// are served from the root, where the go command lists them all, as it
+// does in the workspace. A use directive of a directory without a module,
+// or a replace directive of a missing directory, would make the go command
+// reject the whole workspace, so they are left out, with a warning naming
+// their line; the go command is then run with a copy of go.work without
+// them. Commented-out use directives get a warning too.
+
+// A workspace is a go.work workspace.
+type workspace struct {
+	root     string   // absolute directory of go.work
+	modDirs  []string // absolute directories of the modules of its use directives
+	warnings []string // about the lines of go.work that are left out
+	// work is the contents of a go.work without the lines that are left
+	// out, with absolute paths, or nil if none are.
+	work []byte
+}
+
+// commentedUse matches a commented-out use directive, or a commented-out
+// entry of a use block.
+var (
+	commentedUse      = regexp.MustCompile(`^\s*//\s*use\s+(\S+)\s*$`)
+	commentedUseEntry = regexp.MustCompile(`^\s*//\s*(\.{1,2}(?:/\S*)?|/\S*)\s*$`)
+)
+
+// loadWorkspace reads the go.work file of the workspace at root.
+func loadWorkspace(root string) (*workspace, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(abs, "go.work")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading workspace: %v", err)
+	}
+	wf, err := modfile.ParseWork(file, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	ws := &workspace{root: abs}
+	warn := func(line int, format string, args ...any) {
+		ws.warnings = append(ws.warnings, fmt.Sprintf("%s:%d: ", file, line)+fmt.Sprintf(format, args...))
+	}
+	dir := func(p string) string {
+		if filepath.IsAbs(p) {
+			return filepath.Clean(p)
+		}
+		return filepath.Join(abs, filepath.FromSlash(p))
+	}
+
+	// The go command ignores comments, so commented-out directives are
+	// found in the text.
+	inUse := false
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "use") && strings.HasSuffix(trimmed, "("):
+			inUse = true
+		case inUse && trimmed == ")":
+			inUse = false
+		}
+		if m := commentedUse.FindStringSubmatch(line); m != nil {
+			warn(i+1, "use of %s is commented out; not documenting it", m[1])
+		} else if m := commentedUseEntry.FindStringSubmatch(line); inUse && m != nil {
+			warn(i+1, "use of %s is commented out; not documenting it", m[1])
+		}
+	}
+
+	var dropUses []string
+	for _, u := range wf.Use {
+		d := dir(u.Path)
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err != nil {
+			warn(u.Syntax.Start.Line, "%s has no go.mod file; not documenting it", u.Path)
+			dropUses = append(dropUses, u.Path)
+			continue
+		}
+		ws.modDirs = append(ws.modDirs, d)
+	}
+	var dropReplaces []*modfile.Replace
+	for _, r := range wf.Replace {
+		if !modfile.IsDirectoryPath(r.New.Path) {
+			continue
+		}
+		if _, err := os.Stat(dir(r.New.Path)); err != nil {
+			warn(r.Syntax.Start.Line, "replacement directory %s of %s does not exist; not replacing it", r.New.Path, r.Old.Path)
+			dropReplaces = append(dropReplaces, r)
+		}
+	}
+	if len(ws.modDirs) == 0 {
+		return nil, fmt.Errorf("workspace %s uses no modules", file)
+	}
+	if len(dropUses) == 0 && len(dropReplaces) == 0 {
+		return ws, nil
+	}
+
+	// The copy is written elsewhere, so its paths are made absolute.
+	for _, p := range dropUses {
+		if err := wf.DropUse(p); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range dropReplaces {
+		if err := wf.DropReplace(r.Old.Path, r.Old.Version); err != nil {
+			return nil, err
+		}
+	}
+	wf.Cleanup()
+	var uses []modfile.Use
+	for _, u := range wf.Use {
+		uses = append(uses, *u)
+	}
+	for _, u := range uses {
+		if err := wf.DropUse(u.Path); err != nil {
+			return nil, err
+		}
+	}
+	wf.Cleanup()
+	for _, u := range uses {
+		if err := wf.AddUse(filepath.ToSlash(dir(u.Path)), u.ModulePath); err != nil {
+			return nil, err
+		}
+	}
+	var replaces []modfile.Replace
+	for _, r := range wf.Replace {
+		replaces = append(replaces, *r)
+	}
+	for _, r := range replaces {
+		if !modfile.IsDirectoryPath(r.New.Path) {
+			continue
+		}
+		if err := wf.AddReplace(r.Old.Path, r.Old.Version, filepath.ToSlash(dir(r.New.Path)), ""); err != nil {
+			return nil, err
+		}
+	}
+	wf.Cleanup()
+	ws.work = modfile.Format(wf.Syntax)
+	return ws, nil
+}
+
+// goEnv writes the copy of go.work, if there is one, to a temporary file,
+// and returns the environment of the go command that uses it, and a
+// function that removes the file. The environment is nil if there is no
+// copy.
+func (ws *workspace) goEnv() ([]string, func(), error) {
+	if ws.work == nil {
+		return nil, func() {}, nil
+	}
+	dir, err := os.MkdirTemp("", "pkgsite-work-")
+	if err != nil {
+		return nil, nil, err
+	}
+	file := filepath.Join(dir, "go.work")
+	if err := os.WriteFile(file, ws.work, 0o644); err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	return append(os.Environ(), "GOWORK="+file), func() { os.RemoveAll(dir) }, nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+// workspaceTxtar is a workspace of two modules, one of which imports the
+// other, with a use of a missing module, a commented-out use and a
+// replacement by a missing directory.
+const workspaceTxtar = `
+-- go.work --
+go 1.21
+
+use (
+	./a
+	./b
+	./missing
+	// ./legacy
+)
+
+// use ./old
+
+replace (
+	example.com/gone v1.0.0 => ./gone
+)
+-- a/go.mod --
+module example.com/a
+
+go 1.21
+-- a/a.go --
+// Package a is used by b.
+package a
+
+// A is a.
+const A = 1
+-- b/go.mod --
+module example.com/b
+
+go 1.21
+
+require example.com/a v0.0.0
+-- b/b.go --
+// Package b uses a.
+package b
+
+import "example.com/a"
+
+// B is b.
+const B = a.A
+-- legacy/go.mod --
+module example.com/legacy
+
+go 1.21
+-- legacy/legacy.go --
+package legacy
+`
+
+func TestLoadWorkspace(t *testing.T) {
+	dir, _ := testhelper.WriteTxtarToTempDir(t, workspaceTxtar)
+	ws, err := loadWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}, ws.modDirs); diff != "" {
+		t.Errorf("module directories mismatch (-want +got):\n%s", diff)
+	}
+	file := filepath.Join(dir, "go.work")
+	want := []string{
+		file + ":7: use of ./legacy is commented out; not documenting it",
+		file + ":10: use of ./old is commented out; not documenting it",
+		file + ":6: ./missing has no go.mod file; not documenting it",
+		file + ":13: replacement directory ./gone of example.com/gone does not exist; not replacing it",
+	}
+	if diff := cmp.Diff(want, ws.warnings); diff != "" {
+		t.Errorf("warnings mismatch (-want +got):\n%s", diff)
+	}
+	work := string(ws.work)
+	for _, want := range []string{filepath.ToSlash(filepath.Join(dir, "a")), filepath.ToSlash(filepath.Join(dir, "b"))} {
+		if !strings.Contains(work, want) {
+			t.Errorf("go.work copy does not use %s:\n%s", want, work)
+		}
+	}
+	for _, dont := range []string{"missing", "gone"} {
+		if strings.Contains(work, dont) {
+			t.Errorf("go.work copy contains %s:\n%s", dont, work)
+		}
+	}
+
+	// A workspace without problems is used as it is.
+	if err := os.WriteFile(filepath.Join(dir, "go.work"), []byte("go 1.21\n\nuse ./a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err = loadWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.work != nil || len(ws.warnings) > 0 {
+		t.Errorf("got copy %q and warnings %q, want neither", ws.work, ws.warnings)
+	}
+}
+
+func TestGenerateStaticSiteWorkspace(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	// The go command rejects -mod=mod in workspace mode.
+	t.Setenv("GOFLAGS", "")
+	dir, _ := testhelper.WriteTxtarToTempDir(t, workspaceTxtar)
+	outDir := t.TempDir()
+	cfg := ServerConfig{
+		Workspace:     dir,
+		UseListedMods: true,
+	}
+	if err := GenerateStaticSite(context.Background(), cfg, outDir); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		"example.com/a": "Package a is used by b.",
+		"example.com/b": "Package b uses a.",
+	} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(p), "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("page of %s does not contain %q", p, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "example.com", "legacy")); !os.IsNotExist(err) {
+		t.Errorf("commented-out module: got %v, want not exist", err)
+	}
+	checkInternalLinks(t, outDir, "example.com/")
+}
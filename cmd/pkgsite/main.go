@@ -27,6 +27,15 @@
 //
 //	go work init repos/cue repos/other && pkgsite
 //
+// For a repository of several modules without a go.work file, -recursive
+// serves every module under the directories given:
+//
+//	pkgsite -recursive repos/cue
+//
+// The modules that replace directives of their go.mod files point at local
+// directories are documented too, under the module paths they replace.
+// Those replaced by other module versions are downloaded with -proxy.
+//
 // By default, the resulting server will also serve all of the module's
 // dependencies at their required versions. You can disable serving the
 // required modules by passing -list=false.
@@ -47,16 +56,26 @@
 // processed. If you clone the repo yourself (https://go.googlesource.com/go),
 // you can provide its location with the -gorepo flag to save a little time.
 //
+// A site generated with -out is published to GitHub Pages with the publish
+// subcommand, which commits it to the gh-pages branch of a repository,
+// keeping the history of the branch and its CNAME file, and pushes it:
+//
+//	pkgsite -out site -report report.json && pkgsite publish github-pages -report report.json site
+//
 // [workspace]: https://go.dev/ref/mod#workspaces
 package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"time"
 
@@ -71,16 +90,48 @@ import (
 const defaultAddr = "localhost:8080" // default webserver address
 
 var (
-	httpAddr   = flag.String("http", defaultAddr, "HTTP service address to listen for incoming requests on")
-	goRepoPath = flag.String("gorepo", "", "path to Go repo on local filesystem")
-	useProxy   = flag.Bool("proxy", false, "fetch from GOPROXY if not found locally")
-	openFlag   = flag.Bool("open", false, "open a browser window to the server's address")
-	outDir   = flag.String("out", "", "output directory for static site generation (generates static HTML/CSS/JS instead of starting a server)")
+	httpAddr       = flag.String("http", defaultAddr, "HTTP service address to listen for incoming requests on")
+	goRepoPath     = flag.String("gorepo", "", "path to Go repo on local filesystem")
+	useProxy       = flag.Bool("proxy", false, "fetch from GOPROXY if not found locally")
+	openFlag       = flag.Bool("open", false, "open a browser window to the server's address")
+	reportFile     = flag.String("report", "", "with -out, write a JSON report on the generated site to this file")
+	verify         = flag.Bool("verify_against_dynamic", false, "generate the static site into a temporary directory and compare its pages with those of the dynamic server, instead of serving")
+	outDir         = flag.String("out", "", "output directory for static site generation (generates static HTML/CSS/JS instead of starting a server), or archive file with -format")
+	outFormat      = flag.String("format", "", "with -out, output `format`: dir, tar.gz or zip; by default, tar.gz if -out ends in .tar.gz or .tgz, zip if it ends in .zip, and dir otherwise")
+	singleFile     = flag.String("single_file", "", "with -out, write only the page of the unit at this `path`, such as example.com/m/pkg, to the file -out as a self-contained HTML file, with its style sheets, scripts and small images inlined")
+	basePath       = flag.String("base_path", "", "with -out, URL `path` the site is served under, if not that of -site_url")
+	force          = flag.Bool("force", false, "with -out, write every file, even those a previous run wrote with the same contents")
+	prune          = flag.Bool("prune", false, "with -out, delete every file of the output directory that the run does not write; do not use on a directory that holds other files")
+	atomic         = flag.Bool("atomic", false, "with -out, write the site to a copy of the output directory that replaces it only if the run succeeds")
+	minify         = flag.Bool("minify", false, "with -out, remove the white space and comments of the pages, style sheets and scripts, leaving code blocks as they are")
+	crlf           = flag.Bool("crlf", false, "with -out, write text files with CRLF line endings instead of LF, for hosts that need them")
+	precompress    = flag.Bool("precompress", false, "with -out, also write gzip and brotli compressed copies of the text files, as file.gz and file.br, for hosts that serve them")
+	timeBudget     = flag.Duration("time_budget", 0, "with -out, `duration` the run should take at most, such as 20m; a run projected to take longer skips source pages, symbol indexes and download bundles, then writes stubs for the units left, as the report records")
+	sourceDate     = flag.String("source_date_epoch", os.Getenv("SOURCE_DATE_EPOCH"), "with -out, Unix `time` in seconds that pages record as the time of the build, instead of the time of the run, for reproducible output; defaults to $SOURCE_DATE_EPOCH")
+	workers        = flag.Int("workers", 1, "with -out, number of pages to render at once, lowered to what the limit on open files allows")
+	reproBundle    = flag.String("repro_bundle", "", "with -out, write to this zip `file` the settings, environment, module hashes, versions and report of the run, without secrets, to attach to a bug report")
+	includeSources = flag.Bool("include_sources", false, "with -repro_bundle, also add the files of the local modules; only for modules you can share")
+	archive        = flag.Bool("archive", false, "with -out, also keep a snapshot of the site under archive/ in the output directory")
+	archiveTag     = flag.String("archive_tag", "", "with -archive, name the snapshot `tag`, such as a release version, instead of after the time of the run, and always keep it")
+	archiveKeep    = flag.Int("archive_keep", 0, "with -archive, keep only the `n` newest snapshots without a tag; 0 keeps them all")
+	progressFormat = flag.String("progress", "text", "with -out, `format` of the progress: text, a line for each page, or json, a line of JSON for each event, for CI systems")
+	progressFile   = flag.String("progress_file", "", "with -out, write the progress to this `file` instead of standard error")
+	batch          = flag.String("batch", "", "with -out, generate in waves the site of the modules of the entries of this JSON `file`, each with a getter (local, git or proxy), source, dir, version, module and mount, sharing the assets, homepage and search index of the output directory")
+	batchWaveSize  = flag.Int("batch_wave_size", 16, "with -batch, number of entries generated by each run of the generator")
+	batchFetches   = flag.Int("batch_concurrency", 4, "with -batch, number of entries cloned or downloaded at once")
+	batchResume    = flag.Bool("batch_resume", false, "with -batch, keep the pages of the entries that the checkpoint in the output directory records as generated, and generate only the others")
+	urlRules       = flag.Bool("url_rules", false, "print as JSON the attributes of the pages that hold URLs and what the generator does to their URLs, by scheme, and exit")
 	// other flags are bound to ServerConfig below
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "publish" {
+		publishMain(os.Args[2:])
+		return
+	}
+
 	var serverCfg pkgsite.ServerConfig
+	var opts pkgsite.GenerateOptions
 
 	flag.BoolVar(&serverCfg.GOPATHMode, "gopath_mode", false, "assume that local modules' Paths are relative to GOPATH/src")
 	flag.BoolVar(&serverCfg.UseCache, "cache", false, "fetch from the module cache")
@@ -88,16 +139,167 @@ func main() {
 	flag.BoolVar(&serverCfg.UseListedMods, "list", true, "for each path, serve all modules in build list")
 	flag.BoolVar(&serverCfg.DevMode, "dev", false, "enable developer mode (reload templates on each page load, serve non-minified JS/CSS, etc.)")
 	flag.StringVar(&serverCfg.DevModeStaticDir, "static", "static", "path to folder containing static files served")
+	flag.StringVar(&serverCfg.TemplateOverrideDir, "template_overrides", "", "path to folder of *.tmpl files overriding the built-in templates")
+	flag.StringVar(&serverCfg.SiteName, "site_name", "", "site name made available to template overrides")
+	flag.StringVar(&serverCfg.SiteURL, "site_url", "", "absolute URL the site is published at")
+	flag.BoolVar(&opts.EmitMarkdown, "markdown", false, "with -out, also write each package's documentation as Markdown to <unit>/doc.md")
+	flag.BoolVar(&opts.MarkdownAbsoluteLinks, "markdown_absolute_links", false, "with -markdown, link other units at their pages under -site_url instead of their doc.md files")
+	flag.BoolVar(&opts.EmitText, "text", false, "with -out, also write each package's documentation as plain text to <unit>/doc.txt, listed in llms.txt at the root of the site")
+	flag.BoolVar(&opts.Smoke, "smoke", false, "with -out, generate only the homepage, the static pages, the root unit of each module and the assets, as a quick check")
+	flag.BoolVar(&opts.SourcePages, "source_pages", false, "with -out, write a page for each Go file of the site's packages, and link to it from the documentation")
+	flag.StringVar(&opts.SourceRef, "source_ref", "", "with -out, the commit `ref` of the sourceLink templates of -module_settings (default the commit checked out in each module's git repository)")
+	flag.Int64Var(&opts.MaxSourceSize, "max_source_size", 1<<20, "with -source_pages, leave out files larger than `n` bytes; 0 means no limit")
+	flag.IntVar(&opts.SourceChunkLines, "source_chunk_lines", 0, "with -source_pages, split the pages of files with more than `n` lines into chunks of n lines, loaded as they are scrolled to; 0 means no split")
+	flag.StringVar(&opts.HighlightTheme, "highlight_theme", "", "with -out, highlight the Go code of source pages, declarations and examples with the built-in `theme` default or high-contrast")
+	flag.StringVar(&opts.ColorScheme, "color_scheme", "auto", "with -out, the color `scheme` of the static site: auto keeps the theme toggle, light or dark pins the scheme and leaves out the style rules of the other")
+	flag.StringVar(&opts.HighlightCSS, "highlight_css", "", "with -out, CSS `file` copied into the site and loaded after the highlight theme, to override its colors")
+	flag.BoolVar(&serverCfg.SymbolIndex, "symbol_index", false, "give each module a page listing the exported symbols of all its packages, linked from the module page")
+	flag.IntVar(&serverCfg.SymbolIndexPageSize, "symbol_index_page_size", 2000, "with -symbol_index, split the index into pages of `n` symbols")
+	flag.IntVar(&serverCfg.GlanceThreshold, "glance_threshold", 0, "give the documentation of packages with more than `n` symbols a collapsed \"At a glance\" section listing each type with its constructors and method count; 0 means none")
+	flag.IntVar(&opts.Prefetch, "prefetch", 0, "with -out, have each unit page prefetch up to `n` pages of its child units, then its parent")
+	flag.BoolVar(&opts.DownloadBundles, "download_bundles", false, "with -out, write a zip file of the pages of each module and the assets they need to downloads/<module>.zip, linked from the module page")
+	flag.BoolVar(&opts.SkipNotFoundPage, "skip_404", false, "with -out, do not write a 404.html page, for hosts that do not serve custom not-found pages")
+	flag.BoolVar(&opts.Strict, "strict", false, "with -out, fail if any page fails to render or the output has paths from the root of the host")
+	flag.IntVar(&opts.InlineSmallImages, "inline_small_images", 0, "with -out, inline the images of the pages smaller than `n` bytes as data: URLs; 0 inlines none")
+	flag.BoolVar(&opts.StrictCSP, "strict_csp", false, "with -out, move the inline scripts and styles of the pages to files of the site, so that their Content-Security-Policy does without 'unsafe-inline'")
+	flag.BoolVar(&opts.SubresourceIntegrity, "sri", false, "with -out, give the elements of the pages that load the scripts and style sheets of the site integrity attributes with the SHA-384 hashes of the files")
+	flag.BoolVar(&opts.FingerprintAssets, "fingerprint_assets", false, "with -out, name the style sheets and scripts of the site after their contents, for immutable caching, and list their names in asset-manifest.json")
+	flag.BoolVar(&opts.CopyAllAssets, "copy_all_assets", false, "with -out, copy every file of the static and third_party directories, rather than only those that the pages use")
+	flag.BoolVar(&opts.NoClientSearch, "no_client_search", false, "with -out, do not write the search index and do not search it in the browser; see -search_fallback")
+	flag.Func("search_fallback", "with -no_client_search, what the search forms become: pkgdotdev (the default) to submit to pkg.go.dev, remove, or custom:`URL` to submit to another search page", func(s string) error {
+		var err error
+		opts.SearchFallback, err = pkgsite.ParseSearchFallback(s)
+		return err
+	})
+	flag.StringVar(&opts.ExternalDocsURL, "external_docs_url", "", "with -out, base `URL` under which the documentation of packages outside the site is linked (default https://pkg.go.dev)")
+	flag.BoolVar(&opts.AbsoluteSelfLinks, "absolute_self_links", false, "with -out and -site_url, leave the absolute links to pages of the site under -site_url as they are, rather than making them relative")
+	flag.BoolVar(&opts.StripExternalLinks, "strip_external_links", false, "with -out, replace the links to packages outside the site by their text, rather than linking them under -external_docs_url")
+	flag.BoolVar(&opts.ContentHash, "content_hash", false, "with -out, record the fingerprint of each page, as listed in fingerprints.json, in the data-content-hash attribute of its <html> element")
+	flag.BoolVar(&opts.Schemas, "schemas", false, "with -out, write the JSON Schema documents of the report and other machine-readable files to schemas/")
+	flag.BoolVar(&opts.Sitemap, "sitemap", false, "with -out and -site_url, also write a sitemap.xml listing every page")
+	flag.StringVar(&opts.DiagramScript, "diagram_script", "", "with -out, JavaScript `file` copied into the site and loaded by pages with README diagrams, to render them")
+	flag.BoolVar(&opts.PlatformDivergence, "platform_divergence", false, "with -out, report the packages with symbols documented on only some platforms")
+	flag.BoolVar(&opts.PlatformTable, "platform_table", false, "with -out, add to the pages of packages with symbols documented on only some platforms a table of their availability")
+	flag.Func("fail_on_divergence", "with -out, fail if a package matching one of these comma-separated import path `patterns` has symbols documented on only some platforms", func(s string) error {
+		opts.FailOnDivergence = append(opts.FailOnDivergence, strings.Split(s, ",")...)
+		return nil
+	})
+	flag.IntVar(&opts.EmptyDocMinExported, "empty_doc_min_exported", 0, "with -out, report packages whose documentation has no exported declarations although their Go files declare at least `n` exported identifiers, and note it on their pages; 0 means 1, -1 turns the check off")
+	flag.StringVar(&opts.EmptyDocNote, "empty_doc_note", "", "with -out, the `text` of the note on the pages of the packages that -empty_doc_min_exported reports, instead of one naming the likely causes")
+	flag.Func("include", "with -out, generate only the units whose paths match this `pattern`, in which ** matches any number of path elements; repeatable", func(s string) error {
+		opts.IncludeGlobs = append(opts.IncludeGlobs, s)
+		return nil
+	})
+	flag.Func("exclude", "with -out, leave out the units whose paths match this `pattern`, such as **/internal/**, even if they match -include; repeatable", func(s string) error {
+		opts.ExcludeGlobs = append(opts.ExcludeGlobs, s)
+		return nil
+	})
+	flag.Func("module_version", "with -out, also document a version of a module, as `path@version=dir` for the directory holding the module at that version, under <module>@<version>/; repeatable", func(s string) error {
+		mv, err := pkgsite.ParseModuleVersion(s)
+		if err != nil {
+			return err
+		}
+		serverCfg.ModuleVersions = append(serverCfg.ModuleVersions, mv)
+		return nil
+	})
+	flag.BoolVar(&serverCfg.Stdlib, "stdlib", false, "also document the standard library, from the Go tree of -stdlib_archive, -gorepo or GOROOT, without network access")
+	flag.StringVar(&serverCfg.StdlibArchive, "stdlib_archive", "", "with -stdlib, document the standard library of the Go release archive `file`, such as go1.22.0.src.tar.gz")
+	flag.BoolVar(&serverCfg.StdlibInternal, "stdlib_internal", false, "with -stdlib, also document the internal packages of the standard library")
+	flag.BoolVar(&serverCfg.DiscoverModules, "recursive", false, "document every module under the directories given, found by their go.mod files, skipping vendor, testdata and hidden directories")
+	flag.StringVar(&serverCfg.Workspace, "workspace", "", "also document the modules of the go.work workspace in `dir`")
+	flag.Func("module", "also document a module downloaded through GOPROXY, as `path@version`, such as golang.org/x/text@v0.14.0 or golang.org/x/text@latest; repeatable", func(s string) error {
+		mv, err := pkgsite.ParseRemoteModule(s)
+		if err != nil {
+			return err
+		}
+		serverCfg.RemoteModules = append(serverCfg.RemoteModules, mv)
+		return nil
+	})
+	flag.Func("module_zip", "also document the module of a module zip file, as `path@version=file`, such as example.com/m@v1.2.3=./m.zip; repeatable", func(s string) error {
+		mv, err := pkgsite.ParseModuleZip(s)
+		if err != nil {
+			return err
+		}
+		serverCfg.ModuleZips = append(serverCfg.ModuleZips, mv)
+		return nil
+	})
+	flag.Func("cached_module", "also document a module already in the module cache of -cachedir, without network access, as `path@version`; repeatable", func(s string) error {
+		mv, err := pkgsite.ParseCachedModule(s)
+		if err != nil {
+			return err
+		}
+		serverCfg.CachedModules = append(serverCfg.CachedModules, mv)
+		return nil
+	})
+	flag.Func("frozen", "with -out, copy the files of the module with this `path` from the output of a previous run, without loading it; repeatable", func(s string) error {
+		opts.Frozen = append(opts.Frozen, s)
+		return nil
+	})
+	flag.StringVar(&opts.FrozenFrom, "frozen_from", "", "with -frozen, `dir`ectory of the previous output to copy the files of frozen modules from (default the -out directory)")
+	flag.BoolVar(&opts.NoInternal, "no_internal", false, "with -out, leave out the units with an internal path element, which other modules cannot import")
+	flag.Func("module_settings", "JSON `file` of per-module version suffixes, banners and sourceLink templates, keyed by module path (with -out)", func(s string) error {
+		var err error
+		opts.ModuleSettings, err = pkgsite.LoadModuleSettings(s)
+		return err
+	})
+	flag.Func("branding", "JSON `file` of the favicons and theme colors of the static site: themeColor, themeColorDark, favicon (.ico), faviconSVG and faviconSVGDark, with file names relative to the JSON file", func(s string) error {
+		var err error
+		opts.Branding, err = pkgsite.LoadBranding(s)
+		return err
+	})
+	flag.Func("static_pages", "JSON `file` configuring the about, license-policy and search-help pages of the static site: an object mapping their names to objects with a markdown file replacing their content, relative to the JSON file, or disabled, which removes the page and the links to it", func(s string) error {
+		var err error
+		opts.StaticPages, err = pkgsite.LoadStaticPages(s)
+		return err
+	})
+	flag.Func("redactions", "JSON `file` of rules redacting the text of comments, string literals and READMEs: an array of objects with a name, a regular expression pattern, a replacement and optional module path patterns", func(s string) error {
+		var err error
+		serverCfg.Redactions, err = pkgsite.LoadRedactionRules(s)
+		return err
+	})
+	flag.Func("hidden_symbols", "JSON `file` of symbols whose documentation is hidden: an object mapping import paths to arrays of objects with a name, such as F or T.M, and an optional mode, withhold (the default) or remove", func(s string) error {
+		var err error
+		serverCfg.HiddenSymbols, err = pkgsite.LoadHiddenSymbols(s)
+		return err
+	})
+	flag.Func("constrained_packages", "`policy` for packages whose files are all excluded by build constraints: include or exclude (the default), followed by optional comma-separated pattern=include or pattern=exclude overrides", func(s string) error {
+		var err error
+		serverCfg.ConstrainedPackages, err = pkgsite.ParseConstrainedPolicy(s)
+		return err
+	})
+	flag.Func("readme_names", "comma-separated `list` of the file names a directory's README may have, such as README.md,README,doc.md, in order of preference (default any file named README, preferring Markdown)", func(s string) error {
+		for _, n := range strings.Split(s, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				serverCfg.ReadmeNames = append(serverCfg.ReadmeNames, n)
+			}
+		}
+		return nil
+	})
+	flag.Func("readme_extensions", "comma-separated `list` of the README Markdown extensions to enable, replacing the default of all: tables, strikethrough, tasklists, footnotes, and diagram=LANG for each language of fenced blocks to show as collapsed diagram source", func(s string) error {
+		var err error
+		serverCfg.ReadmeOptions, err = pkgsite.ParseReadmeOptions(s)
+		return err
+	})
 
 	flag.Usage = func() {
 		out := flag.CommandLine.Output()
 		fmt.Fprintf(out, "usage: %s [flags] [PATHS ...]\n", os.Args[0])
 		fmt.Fprintf(out, "    where each PATHS is a single path or a comma-separated list\n")
 		fmt.Fprintf(out, "    (default is current directory if neither -cache nor -proxy is provided)\n")
+		fmt.Fprintf(out, "   or: %s publish github-pages [flags] DIR\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
+	if *urlRules {
+		data, err := json.MarshalIndent(pkgsite.URLRules(), "", "  ")
+		if err != nil {
+			dief("%s", err)
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+
 	serverCfg.UseLocalStdlib = true
 	serverCfg.GoRepoPath = *goRepoPath
 	serverCfg.Paths = collectPaths(flag.Args())
@@ -125,11 +327,104 @@ func main() {
 
 	ctx := context.Background()
 
+	// Conformance check of the static site against the dynamic server.
+	if *verify {
+		diffs, err := pkgsite.VerifyAgainstDynamic(ctx, serverCfg, opts)
+		if err != nil {
+			dief("%s", err)
+		}
+		for _, d := range diffs {
+			fmt.Fprintf(os.Stderr, "%s differs from the dynamic page (-dynamic +static):\n%s\n", d.URLPath, d.Diff)
+		}
+		if len(diffs) > 0 {
+			dief("%d pages differ from the dynamic server", len(diffs))
+		}
+		fmt.Fprintf(os.Stderr, "All pages match the dynamic server.\n")
+		return
+	}
+
+	// A single self-contained page.
+	if *singleFile != "" {
+		if *outDir == "" {
+			dief("-single_file needs -out, the file to write")
+		}
+		if err := pkgsite.GenerateSingleFile(ctx, serverCfg, opts, *singleFile, *outDir); err != nil {
+			dief("%s", err)
+		}
+		return
+	}
+
 	// Static site generation mode.
 	if *outDir != "" {
-		if err := pkgsite.GenerateStaticSite(ctx, serverCfg, *outDir); err != nil {
+		// An interrupt stops the generation, which with -atomic leaves the
+		// output directory as it was.
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		var buildTime time.Time
+		if *sourceDate != "" {
+			secs, err := strconv.ParseInt(*sourceDate, 10, 64)
+			if err != nil {
+				dief("invalid -source_date_epoch %q: not a number of seconds", *sourceDate)
+			}
+			buildTime = time.Unix(secs, 0)
+		}
+		var progressOut io.Writer
+		if *progressFile != "" {
+			f, err := os.Create(*progressFile)
+			if err != nil {
+				dief("%s", err)
+			}
+			defer f.Close()
+			progressOut = f
+		}
+		opts.OutDir = *outDir
+		opts.Format = *outFormat
+		opts.BasePath = *basePath
+		opts.Force = *force
+		opts.Prune = *prune
+		opts.Atomic = *atomic
+		opts.CRLF = *crlf
+		opts.Minify = *minify
+		opts.Precompress = *precompress
+		opts.TimeBudget = *timeBudget
+		opts.BuildTime = buildTime
+		opts.Workers = *workers
+		opts.ReproBundle = *reproBundle
+		opts.IncludeSources = *includeSources
+		opts.Archive = *archive
+		opts.ArchiveTag = *archiveTag
+		opts.ArchiveKeep = *archiveKeep
+		opts.ProgressFormat = *progressFormat
+		opts.ProgressOutput = progressOut
+		var report *pkgsite.Report
+		var err error
+		if *batch != "" {
+			report, err = generateBatch(ctx, serverCfg, opts)
+		} else {
+			report, err = pkgsite.GenerateStaticSiteWithOptions(ctx, serverCfg, opts)
+		}
+		// Failed pages in strict mode come with a report, which is written.
+		if report == nil {
+			dief("%s", err)
+		}
+		if *reportFile != "" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				dief("%s", err)
+			}
+			if err := os.WriteFile(*reportFile, append(data, '\n'), 0o644); err != nil {
+				dief("writing report: %s", err)
+			}
+		}
+		if err != nil {
 			dief("%s", err)
 		}
+		if report.Partial && len(report.BrokenLinks) > 0 {
+			dief("smoke test found %d broken links", len(report.BrokenLinks))
+		}
+		if n := report.DivergenceFailures(); n > 0 {
+			dief("%d packages have documentation that differs across platforms", n)
+		}
 		return
 	}
 
@@ -167,6 +462,23 @@ func main() {
 	dief("%v", srv.Serve(ln))
 }
 
+// generateBatch generates the site of the entries of the -batch manifest.
+func generateBatch(ctx context.Context, serverCfg pkgsite.ServerConfig, opts pkgsite.GenerateOptions) (*pkgsite.Report, error) {
+	if len(serverCfg.Paths) > 0 {
+		dief("-batch takes its modules from its entries, not from PATHS")
+	}
+	entries, err := pkgsite.LoadBatchManifest(*batch)
+	if err != nil {
+		dief("%s", err)
+	}
+	return pkgsite.GenerateBatch(ctx, serverCfg, opts, pkgsite.BatchOptions{
+		Entries:     entries,
+		WaveSize:    *batchWaveSize,
+		Concurrency: *batchFetches,
+		Resume:      *batchResume,
+	})
+}
+
 func dief(format string, args ...any) {
 	fmt.Fprintf(os.Stderr, format, args...)
 	fmt.Fprintln(os.Stderr)
@@ -0,0 +1,79 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/wow-look-at-my/static-pkgsite/cmd/internal/pkgsite"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// publishMain runs the publish subcommand with args, the arguments that
+// follow it.
+func publishMain(args []string) {
+	if len(args) == 0 || args[0] != "github-pages" {
+		dief("usage: %s publish github-pages [flags] DIR", os.Args[0])
+	}
+	var opts pkgsite.PublishOptions
+	fs := flag.NewFlagSet("publish github-pages", flag.ExitOnError)
+	fs.StringVar(&opts.Remote, "remote", "origin", "`URL` or path of the repository to publish to, or name of a remote of the repository of the current directory")
+	fs.StringVar(&opts.Branch, "branch", "gh-pages", "`branch` to commit the site to, created if the repository does not have it")
+	fs.StringVar(&opts.Message, "message", "", "first paragraph of the commit `message` (default \"Publish the documentation site\")")
+	reportFile := fs.String("report", "", "JSON report `file` written by the run that generated the site, whose summary is added to the commit message")
+	fs.Func("keep", "`file` of the branch to keep if the site does not have it, besides CNAME and .nojekyll; repeatable", func(s string) error {
+		opts.Keep = append(opts.Keep, s)
+		return nil
+	})
+	fs.StringVar(&opts.Author, "author", "", "author of the commit, as `\"Name <email>\"` (default the user of the git configuration)")
+	tokenEnv := fs.String("token_env", "", "environment `variable` holding a token to send to an https remote, such as GITHUB_TOKEN, instead of the credentials git is configured with")
+	fs.StringVar(&opts.SSHCommand, "ssh_command", "", "ssh `command` to run for an ssh remote, such as \"ssh -i deploy_key\"")
+	fs.BoolVar(&opts.DryRun, "dry_run", false, "print how the branch would change, without pushing")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: %s publish github-pages [flags] DIR\n", os.Args[0])
+		fmt.Fprintf(out, "    where DIR is the output directory of a generated site\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	opts.OutDir = fs.Arg(0)
+	if *reportFile != "" {
+		data, err := os.ReadFile(*reportFile)
+		if err != nil {
+			dief("%s", err)
+		}
+		if opts.Report, err = schema.DecodeReport(data); err != nil {
+			dief("reading report: %s", err)
+		}
+	}
+	if *tokenEnv != "" {
+		if opts.Token = os.Getenv(*tokenEnv); opts.Token == "" {
+			dief("$%s is not set", *tokenEnv)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	res, err := pkgsite.PublishGitHubPages(ctx, opts)
+	if err != nil {
+		dief("%s", err)
+	}
+	switch {
+	case res.Unchanged:
+		fmt.Fprintf(os.Stderr, "The %s branch already holds the site.\n", res.Branch)
+	case opts.DryRun:
+		fmt.Fprintf(os.Stderr, "%s\nDry run: did not push the commit to the %s branch.\n", res.Stat, res.Branch)
+	default:
+		fmt.Fprintf(os.Stderr, "%s\nPushed %.12s to the %s branch.\n", res.Stat, res.Commit, res.Branch)
+	}
+}
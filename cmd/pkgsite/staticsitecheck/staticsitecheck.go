@@ -0,0 +1,150 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package staticsitecheck checks that the static documentation site of a
+// module generates cleanly, from a test of the module, so that its own CI
+// catches what would break its documentation:
+//
+//	func TestDocs(t *testing.T) {
+//		staticsitecheck.Run(t, staticsitecheck.Options{ModuleDir: "."})
+//	}
+//
+// Run generates the site in strict mode, as pkgsite -strict does, into a
+// temporary directory of the test, and reports each problem it finds as an
+// error of the test: the pages that failed to render, the links to pages
+// that were not generated, the references of stylesheets to missing files
+// and the paths from the root of the host.
+//
+// The site is generated from the files of the module, with the default
+// settings of pkgsite. Nothing is written outside the temporary directory
+// but by the go command, to its build cache, which makes later runs of the
+// check faster.
+package staticsitecheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/wow-look-at-my/static-pkgsite/cmd/internal/pkgsite"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// Options are the options of Run.
+type Options struct {
+	// ModuleDir is a directory of the module to check, "." if empty. The
+	// module is the one whose go.mod file is in ModuleDir or the closest
+	// directory above it, so that "." checks the module of the package of
+	// the test.
+	ModuleDir string
+	// Filters select the units of the module to check.
+	Filters Filters
+}
+
+// Filters select the units that get pages, as the -include, -exclude and
+// -no_internal flags of pkgsite do.
+type Filters struct {
+	// Include and Exclude are path patterns such as "**/internal/**". A
+	// unit is checked if it matches a pattern of Include, or Include is
+	// empty, and no pattern of Exclude.
+	Include []string
+	Exclude []string
+	// NoInternal leaves out the units with an "internal" path element.
+	NoInternal bool
+}
+
+// Run generates the site of the module of opts into a temporary directory
+// of tb, and reports each problem of the site with tb.Error. It calls
+// tb.Fatal if the site cannot be generated at all. It returns the report
+// of the run, for further checks, or nil if there is none.
+func Run(tb testing.TB, opts Options) *schema.Report {
+	tb.Helper()
+	dir := opts.ModuleDir
+	if dir == "" {
+		dir = "."
+	}
+	root, err := moduleRoot(dir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cfg := pkgsite.ServerConfig{
+		Paths:         []string{root},
+		UseListedMods: true,
+	}
+	gen := pkgsite.GenerateOptions{
+		OutDir:       tb.TempDir(),
+		Workers:      runtime.GOMAXPROCS(0),
+		IncludeGlobs: opts.Filters.Include,
+		ExcludeGlobs: opts.Filters.Exclude,
+		NoInternal:   opts.Filters.NoInternal,
+		Strict:       true,
+		// The messages of the run are shown with the test's, and its
+		// progress is left out.
+		Logger:   tbLogger{tb},
+		Progress: func(pkgsite.ProgressEvent) {},
+	}
+	report, err := pkgsite.GenerateStaticSiteWithOptions(context.Background(), cfg, gen)
+	var (
+		pfe *pkgsite.PageFailuresError
+		rpe *pkgsite.RootPathsError
+	)
+	if err != nil && !errors.As(err, &pfe) && !errors.As(err, &rpe) {
+		tb.Fatalf("generating the site of %s: %v", root, err)
+	}
+	reportProblems(tb, report)
+	return report
+}
+
+// moduleRoot returns the closest directory holding a go.mod file from dir
+// up.
+func moduleRoot(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for d := abs; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("no go.mod file in %s or the directories above it", abs)
+		}
+	}
+}
+
+// reportProblems reports each problem of the site of report with tb.Error.
+// The files are those of the generated site, relative to its directory.
+func reportProblems(tb testing.TB, report *schema.Report) {
+	tb.Helper()
+	for _, p := range report.FailedPages {
+		tb.Errorf("page %s failed to render: %s", p.URLPath, p.Error)
+	}
+	for _, l := range report.BrokenLinks {
+		tb.Errorf("%s: link to a page that was not generated: %s", l.Page, l.Href)
+	}
+	for _, l := range report.MissingAssets {
+		tb.Errorf("%s: reference to a missing file: %s", l.Page, l.Href)
+	}
+	for _, p := range report.RootPaths {
+		tb.Errorf("%s:%d: path from the root of the host: %s", p.File, p.Line, p.Snippet)
+	}
+	for _, d := range report.PlatformDivergence {
+		if d.Enforced {
+			tb.Errorf("package %s is documented differently on %d platforms", d.Package, len(d.Platforms))
+		}
+	}
+}
+
+// A tbLogger is a pkgsite.Logger logging to a test.
+type tbLogger struct {
+	tb testing.TB
+}
+
+func (l tbLogger) Printf(format string, args ...any) {
+	l.tb.Logf(format, args...)
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package staticsitecheck
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+func TestRun(t *testing.T) {
+	testenv.MustHaveExecPath(t, "go")
+	// The module of testdata/m is found from a directory of it.
+	report := Run(t, Options{
+		ModuleDir: filepath.Join("testdata", "m", "sub"),
+		Filters:   Filters{NoInternal: true},
+	})
+	if report.Units != 2 || report.Pages == 0 {
+		t.Errorf("got %d units and %d pages, want 2 units and their pages", report.Units, report.Pages)
+	}
+	if diff := cmp.Diff([]string{"example.com/checked/internal", "example.com/checked/internal/x"}, report.LeftOut); diff != "" {
+		t.Errorf("left out units mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// A recordingTB is a testing.TB recording the errors reported to it.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestReportProblems(t *testing.T) {
+	var tb recordingTB
+	reportProblems(&tb, &schema.Report{
+		FailedPages:   []schema.FailedPage{{URLPath: "/example.com/m/a", Error: "500"}},
+		BrokenLinks:   []schema.BrokenLink{{Page: "example.com/m/index.html", Href: "../m/b"}},
+		MissingAssets: []schema.BrokenLink{{Page: "static/site.css", Href: "x.png"}},
+		RootPaths:     []schema.RootPath{{File: "index.html", Line: 3, Snippet: `href="/x"`}},
+		PlatformDivergence: []*schema.PlatformDivergence{
+			{Package: "example.com/m/sys", Platforms: []string{"linux/amd64", "windows/amd64"}, Enforced: true},
+			{Package: "example.com/m/os", Platforms: []string{"linux/amd64", "windows/amd64"}},
+		},
+	})
+	want := []string{
+		"page /example.com/m/a failed to render: 500",
+		"example.com/m/index.html: link to a page that was not generated: ../m/b",
+		"static/site.css: reference to a missing file: x.png",
+		`index.html:3: path from the root of the host: href="/x"`,
+		"package example.com/m/sys is documented differently on 2 platforms",
+	}
+	if diff := cmp.Diff(want, tb.errors); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
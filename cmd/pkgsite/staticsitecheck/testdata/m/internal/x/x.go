@@ -0,0 +1,5 @@
+// Package x is left out by the filters of the test.
+package x
+
+// X is a number.
+const X = 1
@@ -0,0 +1,9 @@
+// Package checked is documented by the test of package staticsitecheck.
+//
+// See [sub.Hello] for a greeting.
+package checked
+
+import "example.com/checked/sub"
+
+// Greet returns the greeting of [sub.Hello] for name.
+func Greet(name string) string { return sub.Hello(name) }
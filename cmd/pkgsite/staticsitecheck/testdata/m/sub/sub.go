@@ -0,0 +1,5 @@
+// Package sub greets.
+package sub
+
+// Hello returns a greeting for name.
+func Hello(name string) string { return "Hello, " + name }
@@ -14,6 +14,7 @@ require (
 	contrib.go.opencensus.io/integrations/ocsql v0.1.4
 	github.com/Masterminds/squirrel v1.5.2
 	github.com/alicebob/miniredis/v2 v2.17.0
+	github.com/andybalholm/brotli v1.2.0
 	github.com/evanw/esbuild v0.17.8
 	github.com/go-redis/redis/v8 v8.11.4
 	github.com/go-redis/redis_rate/v9 v9.1.2
@@ -0,0 +1,177 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"go/ast"
+	"go/build/constraint"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/godoc"
+	"github.com/wow-look-at-my/static-pkgsite/internal/stdlib"
+)
+
+// LoadOptions control how packages are loaded from a module's contents.
+type LoadOptions struct {
+	// IncludeConstrained reports whether to load a package whose Go files
+	// are excluded by build constraints in every build context. Such a
+	// package is loaded with the build tags its constraints require, and its
+	// UnitMeta records the constraint. If IncludeConstrained is nil, these
+	// packages are skipped.
+	IncludeConstrained func(importPath string) bool
+	// RewriteFiles, if set, is called with the parsed Go files of a package,
+	// including its test files, before its documentation is computed. It may
+	// change the text of comments and literals in place, to change the
+	// documentation, synopses and examples derived from them.
+	RewriteFiles func(modulePath, importPath string, files map[string]*ast.File)
+	// RewriteReadme, if set, returns the README contents to use for the unit
+	// at unitPath instead of contents.
+	RewriteReadme func(modulePath, unitPath, contents string) string
+	// ReadmeNames, if set, lists the file names that a directory's README
+	// may have, such as "README.md" or "doc.md", in order of preference.
+	// Names are compared without regard to case. If ReadmeNames is nil, any
+	// file named README, with any extension but .go and .vendor, is a
+	// README, and Markdown ones are preferred.
+	ReadmeNames []string
+}
+
+// A ConstrainedPackage is a directory of Go files that every build context
+// excludes, such as a tools.go package or a program guarded by
+// "//go:build ignore".
+type ConstrainedPackage struct {
+	Path       string // import path
+	Constraint string // build constraint of its files, or "" if they have none
+	Included   bool   // loaded anyway, as requested by LoadOptions
+
+	tags []string // build tags that satisfy Constraint
+}
+
+// loadConstrainedPackageMeta is called for a directory of Go files that no
+// build context matches. It returns the ConstrainedPackage describing the
+// directory and, if opts asks for it, the package loaded with the build tags
+// its constraints require.
+func loadConstrainedPackageMeta(ctx context.Context, contentDir fs.FS, goFilePaths []string, innerPath string, modInfo *godoc.ModuleInfo, opts LoadOptions) (*packageMeta, *ConstrainedPackage, error) {
+	cp := &ConstrainedPackage{Path: path.Join(modInfo.ModulePath, innerPath)}
+	if modInfo.ModulePath == stdlib.ModulePath {
+		cp.Path = innerPath
+	}
+	files := make(map[string][]byte)
+	for _, p := range goFilePaths {
+		b, err := readFSFile(contentDir, p, MaxFileSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[path.Base(p)] = b
+	}
+	cp.Constraint, cp.tags = fileConstraints(files)
+	if opts.IncludeConstrained == nil || len(cp.tags) == 0 || !opts.IncludeConstrained(cp.Path) {
+		return nil, cp, nil
+	}
+	pkg, err := loadPackageMeta(ctx, contentDir, goFilePaths, innerPath, cp.tags, modInfo)
+	if err != nil || pkg == nil {
+		return nil, cp, err
+	}
+	pkg.constraint = cp.Constraint
+	cp.Included = true
+	return pkg, cp, nil
+}
+
+// fileConstraints returns the build constraint under which the given files
+// apply, and the build tags that satisfy it. Files with different
+// constraints are combined with "||".
+func fileConstraints(files map[string][]byte) (expr string, tags []string) {
+	exprs := map[string]bool{}
+	tagSet := map[string]bool{}
+	for _, content := range files {
+		x := headerConstraint(content)
+		if x == nil {
+			continue
+		}
+		exprs[x.String()] = true
+		addRequiredTags(x, false, tagSet)
+	}
+	var all []string
+	for e := range exprs {
+		all = append(all, e)
+	}
+	sort.Strings(all)
+	if len(all) > 1 {
+		for i, e := range all {
+			all[i] = "(" + e + ")"
+		}
+	}
+	for t := range tagSet {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return strings.Join(all, " || "), tags
+}
+
+// headerConstraint returns the build constraint in the header of a Go file,
+// preferring a //go:build line to // +build lines. It returns nil if there
+// is none.
+func headerConstraint(content []byte) constraint.Expr {
+	var plus []constraint.Expr
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		switch {
+		case constraint.IsGoBuild(line):
+			if x, err := constraint.Parse(line); err == nil {
+				return x
+			}
+		case constraint.IsPlusBuild(line):
+			if x, err := constraint.Parse(line); err == nil {
+				plus = append(plus, x)
+			}
+		}
+	}
+	if len(plus) == 0 {
+		return nil
+	}
+	x := plus[0]
+	for _, y := range plus[1:] {
+		x = &constraint.AndExpr{X: x, Y: y}
+	}
+	return x
+}
+
+// addRequiredTags adds to tags the build tags that appear un-negated in x,
+// other than those the build context itself decides.
+func addRequiredTags(x constraint.Expr, negated bool, tags map[string]bool) {
+	switch x := x.(type) {
+	case *constraint.TagExpr:
+		if !negated && !isContextTag(x.Tag) {
+			tags[x.Tag] = true
+		}
+	case *constraint.NotExpr:
+		addRequiredTags(x.X, !negated, tags)
+	case *constraint.AndExpr:
+		addRequiredTags(x.X, negated, tags)
+		addRequiredTags(x.Y, negated, tags)
+	case *constraint.OrExpr:
+		addRequiredTags(x.X, negated, tags)
+		addRequiredTags(x.Y, negated, tags)
+	}
+}
+
+// isContextTag reports whether tag is set by the toolchain rather than by
+// the user.
+func isContextTag(tag string) bool {
+	switch tag {
+	case "cgo", "gc", "gccgo", "unix":
+		return true
+	}
+	return strings.HasPrefix(tag, "go1.") || strings.HasPrefix(tag, "goexperiment.")
+}
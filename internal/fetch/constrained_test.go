@@ -0,0 +1,145 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
+)
+
+func TestFileConstraints(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		files    map[string]string
+		wantExpr string
+		wantTags []string
+	}{
+		{
+			name:     "ignore",
+			files:    map[string]string{"gen.go": "//go:build ignore\n\npackage main\n"},
+			wantExpr: "ignore",
+			wantTags: []string{"ignore"},
+		},
+		{
+			name:     "plus build",
+			files:    map[string]string{"tools.go": "// +build tools\n\npackage tools\n"},
+			wantExpr: "tools",
+			wantTags: []string{"tools"},
+		},
+		{
+			name: "several files",
+			files: map[string]string{
+				"a.go": "// Copyright.\n\n//go:build tools && !go1.20\n\npackage tools\n",
+				"b.go": "//go:build integration || !e2e\n\npackage tools\n",
+				"c.go": "package tools\n\n//go:build ignore\n",
+			},
+			wantExpr: "(integration || !e2e) || (tools && !go1.20)",
+			wantTags: []string{"integration", "tools"},
+		},
+		{
+			name:  "none",
+			files: map[string]string{"a_plan9.go": "package p\n"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			files := map[string][]byte{}
+			for n, c := range test.files {
+				files[n] = []byte(c)
+			}
+			gotExpr, gotTags := fileConstraints(files)
+			if gotExpr != test.wantExpr {
+				t.Errorf("constraint: got %q, want %q", gotExpr, test.wantExpr)
+			}
+			if diff := cmp.Diff(test.wantTags, gotTags); diff != "" {
+				t.Errorf("tags mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+const constrainedModule = `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- m.go --
+// Package m is the root package.
+package m
+-- gen/gen.go --
+//go:build ignore
+
+// Command gen generates code.
+package main
+
+func main() {}
+-- tools/tools.go --
+//go:build tools
+
+// Package tools tracks tool dependencies.
+package tools
+
+// Version is the tools version.
+const Version = 1
+`
+
+func TestFetchLazyModuleConstrained(t *testing.T) {
+	ctx := context.Background()
+	dir, _ := testhelper.WriteTxtarToTempDir(t, constrainedModule)
+	g, err := NewDirectoryModuleGetter("", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unitNames := func(lm *LazyModule) map[string]string {
+		names := map[string]string{}
+		for _, um := range lm.UnitMetas {
+			names[um.Path] = um.Name + " " + um.BuildConstraint
+		}
+		return names
+	}
+
+	t.Run("exclude", func(t *testing.T) {
+		lm := FetchLazyModule(ctx, "example.com/m", LocalVersion, g)
+		if lm.Error != nil {
+			t.Fatal(lm.Error)
+		}
+		want := map[string]string{"example.com/m": "m "}
+		if diff := cmp.Diff(want, unitNames(lm)); diff != "" {
+			t.Errorf("units mismatch (-want +got):\n%s", diff)
+		}
+		wantCP := []*ConstrainedPackage{
+			{Path: "example.com/m/gen", Constraint: "ignore", tags: []string{"ignore"}},
+			{Path: "example.com/m/tools", Constraint: "tools", tags: []string{"tools"}},
+		}
+		if diff := cmp.Diff(wantCP, lm.ConstrainedPackages, cmp.AllowUnexported(ConstrainedPackage{})); diff != "" {
+			t.Errorf("constrained packages mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("include tools", func(t *testing.T) {
+		opts := LoadOptions{IncludeConstrained: func(p string) bool { return p == "example.com/m/tools" }}
+		lm := FetchLazyModuleWithOptions(ctx, "example.com/m", LocalVersion, g, opts)
+		if lm.Error != nil {
+			t.Fatal(lm.Error)
+		}
+		want := map[string]string{
+			"example.com/m":       "m ",
+			"example.com/m/tools": "tools tools",
+		}
+		if diff := cmp.Diff(want, unitNames(lm)); diff != "" {
+			t.Errorf("units mismatch (-want +got):\n%s", diff)
+		}
+		u, err := lm.Unit(ctx, "example.com/m/tools")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(u.Documentation) == 0 || u.Documentation[0].Synopsis != "Package tools tracks tool dependencies." {
+			t.Errorf("got documentation %+v, want the tools package doc", u.Documentation)
+		}
+	})
+}
@@ -54,7 +54,12 @@ type LazyModule struct {
 	licenseDetector  *licenses.Detector
 	contentDir       fs.FS
 	godocModInfo     *godoc.ModuleInfo
+	opts             LoadOptions
 	Error            error
+
+	// ConstrainedPackages are the directories whose Go files are all
+	// excluded by build constraints, sorted by path.
+	ConstrainedPackages []*ConstrainedPackage
 }
 
 // FetchModule queries the proxy or the Go repo for the requested module
@@ -71,16 +76,23 @@ func FetchModule(ctx context.Context, modulePath, requestedVersion string, mg Mo
 // version, downloads the module zip, and does just enough processing to produce
 // UnitMetas for all the modules. The full units are computed as needed.
 func FetchLazyModule(ctx context.Context, modulePath, requestedVersion string, mg ModuleGetter) *LazyModule {
-	lm, err := fetchLazyModule(ctx, modulePath, requestedVersion, mg)
+	return FetchLazyModuleWithOptions(ctx, modulePath, requestedVersion, mg, LoadOptions{})
+}
+
+// FetchLazyModuleWithOptions is like FetchLazyModule, but loads the module's
+// packages according to opts.
+func FetchLazyModuleWithOptions(ctx context.Context, modulePath, requestedVersion string, mg ModuleGetter, opts LoadOptions) *LazyModule {
+	lm, err := fetchLazyModule(ctx, modulePath, requestedVersion, mg, opts)
 	if err != nil {
 		lm.Error = err
 	}
 	return lm
 }
 
-func fetchLazyModule(ctx context.Context, modulePath, requestedVersion string, mg ModuleGetter) (*LazyModule, error) {
+func fetchLazyModule(ctx context.Context, modulePath, requestedVersion string, mg ModuleGetter, opts LoadOptions) (*LazyModule, error) {
 	lm := &LazyModule{
 		requestedVersion: requestedVersion,
+		opts:             opts,
 	}
 	lm.ModuleInfo.ModulePath = modulePath
 
@@ -162,7 +174,7 @@ func fetchLazyModule(ctx context.Context, modulePath, requestedVersion string, m
 	}
 	lm.licenseDetector = licenses.NewDetectorFS(modulePath, v, contentDir, logf)
 	lm.ModuleInfo.IsRedistributable = lm.licenseDetector.ModuleIsRedistributable()
-	lm.UnitMetas, lm.godocModInfo, lm.failedPackages, err = extractUnitMetas(ctx, lm.ModuleInfo, contentDir)
+	lm.UnitMetas, lm.godocModInfo, lm.failedPackages, lm.ConstrainedPackages, err = extractUnitMetas(ctx, lm.ModuleInfo, contentDir, opts)
 	if err != nil {
 		return lm, err
 	}
@@ -189,19 +201,33 @@ func (lm *LazyModule) Unit(ctx context.Context, path string) (*internal.Unit, er
 	return u, err
 }
 
+// Licenses returns the licenses of the module, from all its directories.
+func (lm *LazyModule) Licenses() []*licenses.License {
+	return lm.licenseDetector.AllLicenses()
+}
+
 // unit returns the Unit for the given path. It also returns a packageVersionState representing
 // the state of the work of computing the Unit after the LazyModule was computed. PackageVersionStates
 // representing packages that failed while the LazyModule was computed are set on the LazyModule.
 func (lm *LazyModule) unit(ctx context.Context, unitMeta *internal.UnitMeta) (*internal.Unit, *internal.PackageVersionState, error) {
-	readme, err := extractReadme(lm.ModulePath, unitMeta.Path, lm.ModuleInfo.Version, lm.contentDir)
+	readme, err := extractReadme(lm.ModulePath, unitMeta.Path, lm.ModuleInfo.Version, lm.contentDir, lm.opts.ReadmeNames)
 	if err != nil {
 		return nil, nil, err
 	}
+	if readme != nil && lm.opts.RewriteReadme != nil {
+		readme.Contents = lm.opts.RewriteReadme(lm.ModulePath, unitMeta.Path, readme.Contents)
+	}
 	// This unit represents the module itself, not a package.
 	if !unitMeta.IsPackage() {
 		return moduleUnit(lm.ModulePath, unitMeta, nil, readme, lm.licenseDetector), nil, nil
 	}
-	pkg, pvs, err := extractPackage(ctx, lm.ModulePath, unitMeta.Path, lm.contentDir, lm.licenseDetector, lm.SourceInfo, lm.godocModInfo)
+	var buildTags []string
+	for _, cp := range lm.ConstrainedPackages {
+		if cp.Path == unitMeta.Path && cp.Included {
+			buildTags = cp.tags
+		}
+	}
+	pkg, pvs, err := extractPackage(ctx, lm.ModulePath, unitMeta.Path, lm.contentDir, buildTags, lm.licenseDetector, lm.SourceInfo, lm.godocModInfo, lm.opts)
 	if err != nil || (pvs != nil && pvs.Status != 200) {
 		// pvs can be non-nil even if err is non-nil.
 		return nil, pvs, err
@@ -295,20 +321,20 @@ func getGoModPath(ctx context.Context, modulePath, resolvedVersion string, mg Mo
 // extractUnitMetas extracts UnitMeta information from the module filesystem and
 // populates the LazyModule with that information and additional module-level data.
 func extractUnitMetas(ctx context.Context, minfo internal.ModuleInfo,
-	contentDir fs.FS) (unitMetas []*internal.UnitMeta, _ *godoc.ModuleInfo, _ []*internal.PackageVersionState, err error) {
+	contentDir fs.FS, opts LoadOptions) (unitMetas []*internal.UnitMeta, _ *godoc.ModuleInfo, _ []*internal.PackageVersionState, _ []*ConstrainedPackage, err error) {
 	defer derrors.Wrap(&err, "extractUnitMetas(%q, %q)", minfo.ModulePath, minfo.Version)
 
 	ctx, span := trace.StartSpan(ctx, "fetch.extractUnitMetas")
 	defer span.End()
 
-	packageMetas, godocModInfo, failedMetaPackages, err := extractPackageMetas(ctx, minfo.ModulePath, minfo.Version, contentDir)
+	packageMetas, godocModInfo, failedMetaPackages, constrained, err := extractPackageMetas(ctx, minfo.ModulePath, minfo.Version, contentDir, opts)
 	if errors.Is(err, ErrModuleContainsNoPackages) {
-		return nil, nil, nil, fmt.Errorf("%v: %w", err.Error(), derrors.BadModule)
+		return nil, nil, nil, nil, fmt.Errorf("%v: %w", err.Error(), derrors.BadModule)
 	}
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
-	return moduleUnitMetas(minfo, packageMetas), godocModInfo, failedMetaPackages, nil
+	return moduleUnitMetas(minfo, packageMetas), godocModInfo, failedMetaPackages, constrained, nil
 }
 
 func hasGoModFile(contentDir fs.FS) bool {
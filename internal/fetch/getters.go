@@ -22,12 +22,15 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/mod/modfile"
 	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
 	"github.com/wow-look-at-my/static-pkgsite/internal"
 	"github.com/wow-look-at-my/static-pkgsite/internal/derrors"
 	"github.com/wow-look-at-my/static-pkgsite/internal/fuzzy"
@@ -225,6 +228,282 @@ func (g *directoryModuleGetter) String() string {
 	return fmt.Sprintf("Dir(%s, %s)", g.modulePath, g.dir)
 }
 
+// A zipModuleGetter is a ModuleGetter whose source is a module zip file,
+// laid out as the module proxy serves it, with the files of the module
+// under a <module>@<version>/ directory.
+type zipModuleGetter struct {
+	modulePath string
+	version    string
+	file       string // absolute path to the zip file
+	content    fs.FS  // the files of the module
+	mod        []byte // the go.mod file, or nil if there is none
+	time       time.Time
+}
+
+// NewZipModuleGetter returns a ModuleGetter for reading the module at
+// modulePath and version from the zip file. The zip is checked as the go
+// command checks the zips it downloads; the time of the version is that of
+// the .info file beside it, if there is one.
+func NewZipModuleGetter(modulePath, version, file string) (_ *zipModuleGetter, err error) {
+	defer derrors.Wrap(&err, "NewZipModuleGetter(%q, %q, %q)", modulePath, version, file)
+
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	cf, err := modzip.CheckZip(module.Version{Path: modulePath, Version: version}, abs)
+	if err == nil {
+		err = cf.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, derrors.BadModule)
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	content, err := fs.Sub(zr, modulePath+"@"+version)
+	if err != nil {
+		return nil, err
+	}
+	g := &zipModuleGetter{
+		modulePath: modulePath,
+		version:    version,
+		file:       abs,
+		content:    content,
+		time:       LocalCommitTime,
+	}
+	g.mod, err = fs.ReadFile(content, "go.mod")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if g.mod != nil {
+		if p := modfile.ModulePath(g.mod); p != modulePath {
+			return nil, fmt.Errorf("go.mod is of module %q: %w", p, derrors.BadModule)
+		}
+	}
+	infoFile := strings.TrimSuffix(abs, filepath.Ext(abs)) + ".info"
+	if data, err := os.ReadFile(infoFile); err == nil {
+		var info proxy.VersionInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, fmt.Errorf("%s: %v", infoFile, err)
+		}
+		g.time = info.Time
+	}
+	return g, nil
+}
+
+func (g *zipModuleGetter) check(path, version string) error {
+	if path != g.modulePath || version != g.version {
+		return fmt.Errorf("%s@%s is not %s@%s of zip file %q: %w",
+			path, version, g.modulePath, g.version, g.file, derrors.NotFound)
+	}
+	return nil
+}
+
+// Info returns basic information about the module.
+func (g *zipModuleGetter) Info(ctx context.Context, path, version string) (*proxy.VersionInfo, error) {
+	if err := g.check(path, version); err != nil {
+		return nil, err
+	}
+	return &proxy.VersionInfo{Version: g.version, Time: g.time}, nil
+}
+
+// Mod returns the contents of the module's go.mod file.
+// If the file does not exist, it returns a synthesized one.
+func (g *zipModuleGetter) Mod(ctx context.Context, path, version string) ([]byte, error) {
+	if err := g.check(path, version); err != nil {
+		return nil, err
+	}
+	if g.mod == nil {
+		return []byte(fmt.Sprintf("module %s\n", g.modulePath)), nil
+	}
+	return g.mod, nil
+}
+
+// ContentDir returns an fs.FS for the module's contents.
+func (g *zipModuleGetter) ContentDir(ctx context.Context, path, version string) (fs.FS, error) {
+	if err := g.check(path, version); err != nil {
+		return nil, err
+	}
+	return g.content, nil
+}
+
+// SourceInfo returns a source.Info that will link to the files in the zip,
+// under /files/zip/modulePath@version.
+func (g *zipModuleGetter) SourceInfo(ctx context.Context, _, _ string) (*source.Info, error) {
+	return source.FilesInfo(g.fileServingPath()), nil
+}
+
+// SourceFS returns the path under which the files in the zip are served,
+// along with an FS for serving them.
+func (g *zipModuleGetter) SourceFS() (string, fs.FS) {
+	return g.fileServingPath(), g.content
+}
+
+func (g *zipModuleGetter) fileServingPath() string {
+	return path.Join(filepath.ToSlash(g.file), g.modulePath+"@"+g.version)
+}
+
+// For testing.
+func (g *zipModuleGetter) String() string {
+	return fmt.Sprintf("Zip(%s@%s, %s)", g.modulePath, g.version, g.file)
+}
+
+// A cachedModuleGetter is a ModuleGetter for a version of a module already
+// in a module cache, such as $(go env GOMODCACHE), read without network
+// access and without writing to the cache, whose files the go command
+// makes read-only. The files of the module are those of its extracted
+// <module>@<version> directory, or else of the zip in cache/download.
+type cachedModuleGetter struct {
+	modulePath string
+	version    string
+	cacheDir   string // absolute path to the module cache
+	dir        string // the extracted module, or the zip file
+	content    fs.FS  // the files of the module
+	mod        []byte // the go.mod file, or nil if there is none
+	time       time.Time
+}
+
+// NewCachedModuleGetter returns a ModuleGetter for reading the module at
+// modulePath and version from the module cache at cacheDir. The paths in
+// the cache are case-encoded, as module.EscapePath has them. It is a
+// NotFound error for the version not to be in the cache, with a hint to
+// download it.
+func NewCachedModuleGetter(cacheDir, modulePath, version string) (_ *cachedModuleGetter, err error) {
+	defer derrors.Wrap(&err, "NewCachedModuleGetter(%q, %q, %q)", cacheDir, modulePath, version)
+
+	abs, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	ep, err := module.EscapePath(modulePath)
+	if err != nil {
+		return nil, fmt.Errorf("path: %v: %w", err, derrors.InvalidArgument)
+	}
+	ev, err := module.EscapeVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("version: %v: %w", err, derrors.InvalidArgument)
+	}
+	g := &cachedModuleGetter{
+		modulePath: modulePath,
+		version:    version,
+		cacheDir:   abs,
+		time:       LocalCommitTime,
+	}
+	download := filepath.Join(abs, "cache", "download", filepath.FromSlash(ep), "@v", ev)
+	extracted := filepath.Join(abs, filepath.FromSlash(ep)+"@"+ev)
+
+	// The go command leaves a .partial file while it extracts a module.
+	_, partialErr := os.Stat(download + ".partial")
+	if info, err := os.Stat(extracted); err == nil && info.IsDir() && errors.Is(partialErr, fs.ErrNotExist) {
+		g.dir = extracted
+		g.content = os.DirFS(extracted)
+		g.mod, err = fs.ReadFile(g.content, "go.mod")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	} else if _, err := os.Stat(download + ".zip"); err == nil {
+		zg, err := NewZipModuleGetter(modulePath, version, download+".zip")
+		if err != nil {
+			return nil, err
+		}
+		g.dir, g.content, g.mod = zg.file, zg.content, zg.mod
+	} else {
+		mv := modulePath + "@" + version
+		return nil, fmt.Errorf("%s is not in the module cache %s; run \"go mod download %s\" to add it: %w",
+			mv, abs, mv, derrors.NotFound)
+	}
+	// The .mod file is the go.mod file the go command uses, synthesized
+	// for a module without one.
+	if data, err := os.ReadFile(download + ".mod"); err == nil {
+		g.mod = data
+	}
+	if g.mod != nil {
+		if p := modfile.ModulePath(g.mod); p != modulePath {
+			return nil, fmt.Errorf("go.mod is of module %q: %w", p, derrors.BadModule)
+		}
+	}
+	if data, err := os.ReadFile(download + ".info"); err == nil {
+		var info proxy.VersionInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, fmt.Errorf("%s.info: %v", download, err)
+		}
+		if info.Version != version {
+			return nil, fmt.Errorf("%s.info is of version %q: %w", download, info.Version, derrors.BadModule)
+		}
+		g.time = info.Time
+	}
+	return g, nil
+}
+
+func (g *cachedModuleGetter) check(path, version string) error {
+	if path != g.modulePath || version != g.version {
+		return fmt.Errorf("%s@%s is not %s@%s of module cache %q: %w",
+			path, version, g.modulePath, g.version, g.cacheDir, derrors.NotFound)
+	}
+	return nil
+}
+
+// Info returns basic information about the module.
+func (g *cachedModuleGetter) Info(ctx context.Context, path, version string) (*proxy.VersionInfo, error) {
+	if err := g.check(path, version); err != nil {
+		return nil, err
+	}
+	return &proxy.VersionInfo{Version: g.version, Time: g.time}, nil
+}
+
+// Mod returns the contents of the module's go.mod file.
+// If the file does not exist, it returns a synthesized one.
+func (g *cachedModuleGetter) Mod(ctx context.Context, path, version string) ([]byte, error) {
+	if err := g.check(path, version); err != nil {
+		return nil, err
+	}
+	if g.mod == nil {
+		return []byte(fmt.Sprintf("module %s\n", g.modulePath)), nil
+	}
+	return g.mod, nil
+}
+
+// ContentDir returns an fs.FS for the module's contents.
+func (g *cachedModuleGetter) ContentDir(ctx context.Context, path, version string) (fs.FS, error) {
+	if err := g.check(path, version); err != nil {
+		return nil, err
+	}
+	return g.content, nil
+}
+
+// SourceInfo returns a source.Info that will link to the files of the
+// module, under /files/cacheDir/modulePath@version.
+func (g *cachedModuleGetter) SourceInfo(ctx context.Context, _, _ string) (*source.Info, error) {
+	return source.FilesInfo(g.fileServingPath()), nil
+}
+
+// SourceFS returns the path under which the files of the module are
+// served, along with an FS for serving them.
+func (g *cachedModuleGetter) SourceFS() (string, fs.FS) {
+	return g.fileServingPath(), g.content
+}
+
+func (g *cachedModuleGetter) fileServingPath() string {
+	return path.Join(filepath.ToSlash(g.cacheDir), g.modulePath+"@"+g.version)
+}
+
+// Dir returns the extracted directory of the module in the cache, or its
+// zip file if it is not extracted.
+func (g *cachedModuleGetter) Dir() string {
+	return g.dir
+}
+
+// For testing.
+func (g *cachedModuleGetter) String() string {
+	return fmt.Sprintf("Cached(%s@%s, %s)", g.modulePath, g.version, g.cacheDir)
+}
+
 // A goPackagesModuleGetter is a ModuleGetter whose source is go/packages.Load
 // from a directory in the local file system.
 type goPackagesModuleGetter struct {
@@ -237,6 +516,12 @@ type goPackagesModuleGetter struct {
 // NewGoPackagesModuleGetter returns a ModuleGetter that loads packages using
 // go/packages.Load(pattern), from the requested directory.
 func NewGoPackagesModuleGetter(ctx context.Context, dir string, patterns ...string) (*goPackagesModuleGetter, error) {
+	return NewGoPackagesModuleGetterWithEnv(ctx, dir, nil, patterns...)
+}
+
+// NewGoPackagesModuleGetterWithEnv is like NewGoPackagesModuleGetter, but
+// runs the go command with the environment env, if it is not nil.
+func NewGoPackagesModuleGetterWithEnv(ctx context.Context, dir string, env []string, patterns ...string) (*goPackagesModuleGetter, error) {
 	abs, err := filepath.Abs(dir)
 	if err != nil {
 		return nil, err
@@ -245,6 +530,7 @@ func NewGoPackagesModuleGetter(ctx context.Context, dir string, patterns ...stri
 	cfg := &packages.Config{
 		Context: ctx,
 		Dir:     abs,
+		Env:     env,
 		Mode: packages.NeedName |
 			packages.NeedModule |
 			packages.NeedCompiledGoFiles |
@@ -650,8 +936,26 @@ func (g *stdlibZipModuleGetter) String() string {
 // this getter.
 type modCacheModuleGetter struct {
 	dir string
+
+	mu       sync.Mutex
+	maxBytes int64                 // the most bytes of zips kept
+	zips     map[string]*cachedZip // recently used zips, by module@version
+	lru      []string              // keys of zips, least recently used first
+	size     int64                 // bytes of the zips kept
 }
 
+// A cachedZip is a zip a modCacheModuleGetter keeps in memory.
+type cachedZip struct {
+	r    *zip.Reader
+	size int64
+}
+
+// modCacheZipBytes is the most bytes of zips a modCacheModuleGetter keeps
+// in memory, so that the pages of a module do not each open and read its
+// zip. A zip is read whole and its file closed at once, so the zips kept
+// hold no file open; one larger than the limit is read again when used.
+const modCacheZipBytes = 64 << 20
+
 // NewModCacheGetter returns a ModuleGetter that reads modules from a filesystem
 // directory organized like the proxy.
 // If allowed is non-empty, only module@versions in allowed are served; others
@@ -663,7 +967,7 @@ func NewModCacheGetter(dir string) (_ *modCacheModuleGetter, err error) {
 	if err != nil {
 		return nil, err
 	}
-	g := &modCacheModuleGetter{dir: abs}
+	g := &modCacheModuleGetter{dir: abs, maxBytes: modCacheZipBytes}
 	return g, nil
 }
 
@@ -726,15 +1030,52 @@ func (g *modCacheModuleGetter) ContentDir(ctx context.Context, path, vers string
 		}
 	}
 
+	zr, err := g.zipReader(path, vers)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Sub(zr, path+"@"+vers)
+}
+
+// zipReader returns a reader of the zip of the module, reusing that of an
+// earlier call if it is among the most recently used, which take up at most
+// maxBytes.
+func (g *modCacheModuleGetter) zipReader(path, vers string) (*zip.Reader, error) {
+	key := path + "@" + vers
+	g.mu.Lock()
+	if z, ok := g.zips[key]; ok {
+		g.lru = append(slices.DeleteFunc(g.lru, func(k string) bool { return k == key }), key)
+		g.mu.Unlock()
+		return z.r, nil
+	}
+	g.mu.Unlock()
+
 	data, err := g.readFile(path, vers, "zip")
 	if err != nil {
 		return nil, err
 	}
-	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	size := int64(len(data))
+	zr, err := zip.NewReader(bytes.NewReader(data), size)
 	if err != nil {
 		return nil, err
 	}
-	return fs.Sub(zr, path+"@"+vers)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.zips[key]; ok || size > g.maxBytes {
+		return zr, nil // read by another call meanwhile, or too large to keep
+	}
+	if g.zips == nil {
+		g.zips = map[string]*cachedZip{}
+	}
+	for g.size+size > g.maxBytes {
+		g.size -= g.zips[g.lru[0]].size
+		delete(g.zips, g.lru[0])
+		g.lru = g.lru[1:]
+	}
+	g.zips[key] = &cachedZip{r: zr, size: size}
+	g.lru = append(g.lru, key)
+	g.size += size
+	return zr, nil
 }
 
 // SourceInfo returns a source.Info that will create /files links to modules in
@@ -5,12 +5,14 @@
 package fetch
 
 import (
+	"archive/zip"
 	"context"
 	"errors"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -37,6 +39,39 @@ func TestDirectoryModuleGetterEmpty(t *testing.T) {
 	}
 }
 
+func TestDirectoryModuleGetterNestedModule(t *testing.T) {
+	dir, _ := testhelper.WriteTxtarToTempDir(t, `
+-- go.mod --
+module example.com/outer
+-- outer.go --
+package outer
+-- sub/sub.go --
+package sub
+-- inner/go.mod --
+module example.com/outer/inner
+-- inner/inner.go --
+package inner
+-- inner/deeper/deeper.go --
+package deeper
+`)
+	g, err := NewDirectoryModuleGetter("", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm := FetchLazyModule(context.Background(), "example.com/outer", LocalVersion, g)
+	if lm.Error != nil {
+		t.Fatal(lm.Error)
+	}
+	var got []string
+	for _, um := range lm.UnitMetas {
+		got = append(got, um.Path)
+	}
+	want := []string{"example.com/outer", "example.com/outer/sub"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("units mismatch (-want +got):\n%s", diff)
+	}
+}
+
 const multiModule = `
 -- go.work --
 go 1.21
@@ -329,4 +364,311 @@ func TestFSProxyGetter(t *testing.T) {
 			t.Errorf("got %v, want NotFound", err)
 		}
 	})
+	t.Run("contentdir reuses zip", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.CopyFS(dir, os.DirFS("testdata/modcache")); err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewModCacheGetter(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := g.ContentDir(ctx, modulePath, vers); err != nil {
+			t.Fatal(err)
+		}
+		// Without the zip, the module is read from the reader of the first
+		// call.
+		zip, err := g.escapedPath(modulePath, vers, "zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(zip); err != nil {
+			t.Fatal(err)
+		}
+		fsys, err := g.ContentDir(ctx, modulePath, vers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := fs.ReadFile(fsys, "go.mod")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != goMod {
+			t.Errorf("got %q, want %q", got, goMod)
+		}
+	})
+	t.Run("contentdir keeps zips up to a size", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.CopyFS(dir, os.DirFS("testdata/modcache")); err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewModCacheGetter(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zipFile := func(modulePath string) string {
+			t.Helper()
+			zip, err := g.escapedPath(modulePath, vers, "zip")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return zip
+		}
+		fi, err := os.Stat(zipFile(modulePath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Only the zip of modulePath fits, so reading another drops it.
+		g.maxBytes = fi.Size()
+		for _, m := range []string{modulePath, "modcache.com"} {
+			if _, err := g.ContentDir(ctx, m, vers); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got, want := g.lru, []string{"modcache.com@" + vers}; !cmp.Equal(got, want) {
+			t.Errorf("kept zips %v, want %v", got, want)
+		}
+		if err := os.Remove(zipFile(modulePath)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := g.ContentDir(ctx, modulePath, vers); !errors.Is(err, derrors.NotFound) {
+			t.Errorf("got %v for a dropped zip that is gone, want NotFound", err)
+		}
+
+		// A zip larger than the limit is not kept.
+		g.maxBytes = 1
+		if _, err := g.ContentDir(ctx, "modcache.com", vers); err != nil {
+			t.Fatal(err)
+		}
+		g.zips, g.lru, g.size = nil, nil, 0
+		if _, err := g.ContentDir(ctx, "modcache.com", vers); err != nil {
+			t.Fatal(err)
+		}
+		if len(g.zips) != 0 || g.size != 0 {
+			t.Errorf("kept %d bytes of zips %v over a limit of 1", g.size, g.lru)
+		}
+	})
+}
+
+func TestZipModuleGetter(t *testing.T) {
+	ctx := context.Background()
+	const (
+		modulePath = "github.com/jackc/pgio"
+		vers       = "v1.0.0"
+		goMod      = "module github.com/jackc/pgio\n\ngo 1.12\n"
+	)
+	file := "testdata/modcache/cache/download/github.com/jackc/pgio/@v/v1.0.0.zip"
+	g, err := NewZipModuleGetter(modulePath, vers, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := time.Parse(time.RFC3339, "2019-03-30T17:04:38Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := g.Info(ctx, modulePath, vers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&proxy.VersionInfo{Version: vers, Time: ts}); !cmp.Equal(info, want) {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+	mod, err := g.Mod(ctx, modulePath, vers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(mod) != goMod {
+		t.Errorf("got %q, want %q", mod, goMod)
+	}
+	fsys, err := g.ContentDir(ctx, modulePath, vers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(fsys, "doc.go"); err != nil {
+		t.Error(err)
+	}
+	if _, err := g.ContentDir(ctx, modulePath, "v1.0.1"); !errors.Is(err, derrors.NotFound) {
+		t.Errorf("got %v, want NotFound", err)
+	}
+
+	// A zip for another module, or with files outside the directory of
+	// the module, is malformed.
+	if _, err := NewZipModuleGetter("example.com/other", vers, file); !errors.Is(err, derrors.BadModule) {
+		t.Errorf("got %v, want BadModule", err)
+	}
+	bad := filepath.Join(t.TempDir(), "bad.zip")
+	f, err := os.Create(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"example.com/m@v1.0.0/go.mod", "example.com/m@v1.0.0/../stray.go"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, "module example.com/m\n")
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewZipModuleGetter("example.com/m", "v1.0.0", bad)
+	if err == nil || !strings.Contains(err.Error(), "stray.go") {
+		t.Errorf("got %v, want an error naming stray.go", err)
+	}
+}
+
+// writeModCache writes files to a directory laid out as a module cache and
+// makes it read-only, as the go command does. It returns the directory.
+func writeModCache(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o444); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var dirs []string
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			dirs = append(dirs, p)
+		}
+		return err
+	})
+	for _, d := range dirs {
+		os.Chmod(d, 0o555)
+	}
+	t.Cleanup(func() {
+		for _, d := range dirs {
+			os.Chmod(d, 0o755)
+		}
+	})
+	return dir
+}
+
+func TestCachedModuleGetter(t *testing.T) {
+	ctx := context.Background()
+	zipData, err := testhelper.ZipContents(map[string]string{
+		"example.com/zipped@v1.2.0/go.mod": "module example.com/zipped\n",
+		"example.com/zipped@v1.2.0/z.go":   "package zipped\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The module paths and versions with upper-case letters are
+	// case-encoded, with a '!' before the lower-case letter.
+	cache := writeModCache(t, map[string]string{
+		"github.com/!gopher/!x@v1.0.0-!r/go.mod":                 "module github.com/Gopher/X\n",
+		"github.com/!gopher/!x@v1.0.0-!r/x.go":                   "package x\n",
+		"cache/download/github.com/!gopher/!x/@v/v1.0.0-!r.info": `{"Version":"v1.0.0-R","Time":"2019-03-30T17:04:38Z"}`,
+		"cache/download/github.com/!gopher/!x/@v/v1.0.0-!r.mod":  "module github.com/Gopher/X\n",
+		"cache/download/example.com/zipped/@v/v1.2.0.info":       `{"Version":"v1.2.0","Time":"2020-01-02T03:04:05Z"}`,
+		"cache/download/example.com/zipped/@v/v1.2.0.mod":        "module example.com/zipped\n",
+		"cache/download/example.com/zipped/@v/v1.2.0.zip":        string(zipData),
+		"example.com/partial@v1.0.0/p.go":                        "package partial\n",
+		"cache/download/example.com/partial/@v/v1.0.0.partial":   "",
+		"cache/download/example.com/wrongversion/@v/v1.0.0.info": `{"Version":"v1.0.1"}`,
+		"example.com/wrongversion@v1.0.0/w.go":                   "package wrongversion\n",
+		"cache/download/example.com/infoonly/@v/v1.0.0.info":     `{"Version":"v1.0.0"}`,
+		"cache/download/example.com/infoonly/@v/v1.0.0.mod":      "module example.com/infoonly\n",
+		"cache/download/example.com/nomod/@v/v1.0.0.info":        `{"Version":"v1.0.0"}`,
+		"example.com/nomod@v1.0.0/n.go":                          "package nomod\n",
+	})
+	snapshot := func() map[string]time.Time {
+		files := map[string]time.Time{}
+		filepath.WalkDir(cache, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files[p] = info.ModTime()
+			return nil
+		})
+		return files
+	}
+	before := snapshot()
+
+	for _, test := range []struct {
+		path, version string
+		file          string // a file of the module
+		time          string
+		mod           string
+	}{
+		{"github.com/Gopher/X", "v1.0.0-R", "x.go", "2019-03-30T17:04:38Z", "module github.com/Gopher/X\n"},
+		{"example.com/zipped", "v1.2.0", "z.go", "2020-01-02T03:04:05Z", "module example.com/zipped\n"},
+		{"example.com/nomod", "v1.0.0", "n.go", "", "module example.com/nomod\n"},
+	} {
+		g, err := NewCachedModuleGetter(cache, test.path, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ts time.Time
+		if test.time != "" {
+			ts, err = time.Parse(time.RFC3339, test.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		info, err := g.Info(ctx, test.path, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (&proxy.VersionInfo{Version: test.version, Time: ts}); !cmp.Equal(info, want) {
+			t.Errorf("%s: got %+v, want %+v", test.path, info, want)
+		}
+		mod, err := g.Mod(ctx, test.path, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(mod) != test.mod {
+			t.Errorf("%s: got go.mod %q, want %q", test.path, mod, test.mod)
+		}
+		fsys, err := g.ContentDir(ctx, test.path, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fs.Stat(fsys, test.file); err != nil {
+			t.Error(err)
+		}
+		if _, err := g.ContentDir(ctx, test.path, "v9.9.9"); !errors.Is(err, derrors.NotFound) {
+			t.Errorf("%s: got %v, want NotFound", test.path, err)
+		}
+	}
+
+	// A version not in the cache, or not in it completely, is an error
+	// with a hint to download it.
+	for _, mv := range [][2]string{
+		{"example.com/zipped", "v1.3.0"},
+		{"example.com/absent", "v1.0.0"},
+		{"example.com/partial", "v1.0.0"},
+		{"example.com/infoonly", "v1.0.0"},
+		{"github.com/gopher/x", "v1.0.0-R"}, // the case matters
+	} {
+		_, err := NewCachedModuleGetter(cache, mv[0], mv[1])
+		if !errors.Is(err, derrors.NotFound) {
+			t.Errorf("%s@%s: got %v, want NotFound", mv[0], mv[1], err)
+		} else if want := `"go mod download ` + mv[0] + "@" + mv[1] + `"`; !strings.Contains(err.Error(), want) {
+			t.Errorf("%s@%s: got %v, want it to contain %s", mv[0], mv[1], err, want)
+		}
+	}
+	if _, err := NewCachedModuleGetter(cache, "example.com/wrongversion", "v1.0.0"); !errors.Is(err, derrors.BadModule) {
+		t.Errorf("got %v, want BadModule", err)
+	}
+	if _, err := NewCachedModuleGetter(cache, "example.com/zipped", "v1.2"); !errors.Is(err, derrors.NotFound) {
+		t.Errorf("got %v, want NotFound", err)
+	}
+
+	if diff := cmp.Diff(before, snapshot()); diff != "" {
+		t.Errorf("the module cache changed (-before +after):\n%s", diff)
+	}
 }
@@ -25,6 +25,8 @@ import (
 	"github.com/wow-look-at-my/static-pkgsite/internal"
 	"github.com/wow-look-at-my/static-pkgsite/internal/derrors"
 	"github.com/wow-look-at-my/static-pkgsite/internal/godoc"
+	"github.com/wow-look-at-my/static-pkgsite/internal/goembed"
+	"github.com/wow-look-at-my/static-pkgsite/internal/log"
 	"github.com/wow-look-at-my/static-pkgsite/internal/source"
 	"github.com/wow-look-at-my/static-pkgsite/internal/stdlib"
 	"github.com/wow-look-at-my/static-pkgsite/internal/trace"
@@ -49,8 +51,10 @@ func (bpe *BadPackageError) Error() string { return bpe.Err.Error() }
 //
 // If a package is fine except that its documentation is too large, loadPackage
 // returns a goPackage whose err field is a non-nil error with godoc.ErrTooLarge in its chain.
-func loadPackage(ctx context.Context, contentDir fs.FS, goFilePaths []string, innerPath string,
-	sourceInfo *source.Info, modInfo *godoc.ModuleInfo) (_ *goPackage, err error) {
+//
+// The buildTags, usually nil, are set in every build context.
+func loadPackage(ctx context.Context, contentDir fs.FS, goFilePaths []string, innerPath string, buildTags []string,
+	sourceInfo *source.Info, modInfo *godoc.ModuleInfo, opts LoadOptions) (_ *goPackage, err error) {
 	defer derrors.Wrap(&err, "loadPackage(ctx, zipGoFiles, %q, sourceInfo, modInfo)", innerPath)
 	ctx, span := trace.StartSpan(ctx, "fetch.loadPackage")
 	defer span.End()
@@ -71,6 +75,13 @@ func loadPackage(ctx context.Context, contentDir fs.FS, goFilePaths []string, in
 	if modulePath == stdlib.ModulePath {
 		importPath = innerPath
 	}
+	// The files that //go:embed directives name are never read: they can be
+	// large, and the documentation does not depend on them. A directive
+	// that names no file breaks the build of the package, but not its
+	// documentation.
+	for _, p := range goembed.Missing(contentDir, innerPath, files) {
+		log.Warningf(ctx, "%s: //go:embed %s: no matching files; documenting the package without them", importPath, p)
+	}
 	v1path := internal.V1Path(importPath, modulePath)
 
 	var pkg *goPackage
@@ -79,7 +90,7 @@ func loadPackage(ctx context.Context, contentDir fs.FS, goFilePaths []string, in
 	// track of those to avoid duplication.
 	docsByFiles := map[string]*internal.Documentation{}
 	for _, bc := range internal.BuildContexts {
-		mfiles, err := matchingFiles(bc.GOOS, bc.GOARCH, importPath, files)
+		mfiles, err := matchingFiles(bc.GOOS, bc.GOARCH, importPath, buildTags, files)
 		if err != nil {
 			return nil, err
 		}
@@ -104,7 +115,7 @@ func loadPackage(ctx context.Context, contentDir fs.FS, goFilePaths []string, in
 			continue
 		}
 		name, imports, synopsis, source, api, err := loadPackageForBuildContext(ctx,
-			mfiles, innerPath, sourceInfo, modInfo)
+			mfiles, innerPath, sourceInfo, modInfo, opts)
 		for _, s := range api {
 			s.GOOS = bc.GOOS
 			s.GOARCH = bc.GOARCH
@@ -184,7 +195,7 @@ func loadPackage(ctx context.Context, contentDir fs.FS, goFilePaths []string, in
 
 // loadPackageMeta loads only the parts of a package that are needed to load a
 // packageMeta.
-func loadPackageMeta(ctx context.Context, contentDir fs.FS, goFilePaths []string, innerPath string, modInfo *godoc.ModuleInfo) (_ *packageMeta, err error) {
+func loadPackageMeta(ctx context.Context, contentDir fs.FS, goFilePaths []string, innerPath string, buildTags []string, modInfo *godoc.ModuleInfo) (_ *packageMeta, err error) {
 	defer derrors.Wrap(&err, "loadPackageMeta(ctx, zipGoFiles, %q, sourceInfo, modInfo)", innerPath)
 
 	// Make a map with all the zip file contents.
@@ -213,7 +224,7 @@ func loadPackageMeta(ctx context.Context, contentDir fs.FS, goFilePaths []string
 	// in the file and then run the logic in loadPackageName on the collection of
 	// package name values.
 	for _, bc := range internal.BuildContexts {
-		mfiles, err := matchingFiles(bc.GOOS, bc.GOARCH, importPath, files)
+		mfiles, err := matchingFiles(bc.GOOS, bc.GOARCH, importPath, buildTags, files)
 		if err != nil {
 			return nil, err
 		}
@@ -283,7 +294,7 @@ var httpPost = http.Post
 //
 // If it returns an error with ErrTooLarge in its chain, the other return values
 // are still valid.
-func loadPackageForBuildContext(ctx context.Context, files map[string][]byte, innerPath string, sourceInfo *source.Info, modInfo *godoc.ModuleInfo) (
+func loadPackageForBuildContext(ctx context.Context, files map[string][]byte, innerPath string, sourceInfo *source.Info, modInfo *godoc.ModuleInfo, opts LoadOptions) (
 	name string, imports []string, synopsis string, source []byte, api []*internal.Symbol, err error) {
 	modulePath := modInfo.ModulePath
 	defer derrors.Wrap(&err, "loadPackageWithBuildContext(files, %q, %q, %+v)", innerPath, modulePath, sourceInfo)
@@ -292,6 +303,13 @@ func loadPackageForBuildContext(ctx context.Context, files map[string][]byte, in
 	if err != nil {
 		return "", nil, "", nil, nil, err
 	}
+	if opts.RewriteFiles != nil {
+		importPath := path.Join(modulePath, innerPath)
+		if modulePath == stdlib.ModulePath {
+			importPath = innerPath
+		}
+		opts.RewriteFiles(modulePath, importPath, goFiles)
+	}
 	docPkg := godoc.NewPackage(fset, modInfo.ModulePackages)
 	for _, pf := range goFiles {
 		removeNodes := true
@@ -407,8 +425,9 @@ func loadPackageName(innerPath string, files map[string][]byte) (pkgName string,
 }
 
 // matchingFiles returns a map from file names to their contents, read from zipGoFiles.
-// It includes only those files that match the build context determined by goos and goarch.
-func matchingFiles(goos, goarch string, importPath string, allFiles map[string][]byte) (matchedFiles map[string][]byte, err error) {
+// It includes only those files that match the build context determined by goos
+// and goarch, with buildTags set.
+func matchingFiles(goos, goarch string, importPath string, buildTags []string, allFiles map[string][]byte) (matchedFiles map[string][]byte, err error) {
 	defer derrors.Wrap(&err, "matchingFiles(%q, %q, zipGoFiles)", goos, goarch)
 
 	// bctx is used to make decisions about which of the .go files are included
@@ -419,6 +438,7 @@ func matchingFiles(goos, goarch string, importPath string, allFiles map[string][
 		CgoEnabled:  true,
 		Compiler:    build.Default.Compiler,
 		ReleaseTags: build.Default.ReleaseTags,
+		BuildTags:   append([]string(nil), buildTags...),
 
 		JoinPath: path.Join,
 		OpenFile: func(name string) (io.ReadCloser, error) {
@@ -5,9 +5,15 @@
 package fetch
 
 import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
 	"testing"
+	"testing/fstest"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal/godoc"
 	"github.com/wow-look-at-my/static-pkgsite/internal/testing/testhelper"
 )
 
@@ -113,7 +119,7 @@ func TestMatchingFiles(t *testing.T) {
 			for n, c := range test.contents {
 				files[n] = []byte(c)
 			}
-			got, err := matchingFiles(test.goos, test.goarch, test.importPath, files)
+			got, err := matchingFiles(test.goos, test.goarch, test.importPath, nil, files)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -123,3 +129,51 @@ func TestMatchingFiles(t *testing.T) {
 		})
 	}
 }
+
+// goFilesOnlyFS is an FS whose files other than Go files cannot be opened.
+type goFilesOnlyFS struct{ fstest.MapFS }
+
+func (f goFilesOnlyFS) Open(name string) (fs.File, error) {
+	if fi, err := fs.Stat(f.MapFS, name); err == nil && !fi.IsDir() && path.Ext(name) != ".go" {
+		return nil, fmt.Errorf("%s: read a file that is not a Go file", name)
+	}
+	return f.MapFS.Open(name)
+}
+
+func TestLoadPackageEmbed(t *testing.T) {
+	// The package embeds a file that is there, which must not be read, and a
+	// file that is not.
+	fsys := goFilesOnlyFS{fstest.MapFS{
+		"p/p.go": {Data: []byte(`// Package p embeds data.
+package p
+
+import _ "embed"
+
+//go:embed big.bin
+var Big []byte
+
+//go:embed gone.txt
+var Gone string
+`)},
+		"p/big.bin": {Data: make([]byte, 1<<20)},
+	}}
+	modInfo := &godoc.ModuleInfo{ModulePath: "example.com/m", ResolvedVersion: "v1.0.0"}
+	pkg, err := loadPackage(context.Background(), fsys, []string{"p/p.go"}, "p", nil, nil, modInfo, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg == nil || pkg.err != nil || len(pkg.docs) == 0 {
+		t.Fatalf("got %+v, want the documentation of the package", pkg)
+	}
+	doc := pkg.docs[0]
+	if doc.Synopsis != "Package p embeds data." {
+		t.Errorf("synopsis = %q", doc.Synopsis)
+	}
+	var names []string
+	for _, s := range doc.API {
+		names = append(names, s.Name)
+	}
+	if diff := cmp.Diff([]string{"Big", "Gone"}, names); diff != "" {
+		t.Errorf("API mismatch (-want +got):\n%s", diff)
+	}
+}
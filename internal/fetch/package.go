@@ -12,6 +12,7 @@ import (
 	"io/fs"
 	"path"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
 
@@ -57,7 +58,8 @@ func rel(pkgPath, modulePath string) string {
 // It returns a packageVersionState representing the status of doing the work
 // of computing the package after the UnitMeta was computed. The packageVersionState
 // of a package that failed to have a UnitMeta produced was produced by extractPackageMetas.
-func extractPackage(ctx context.Context, modulePath, pkgPath string, contentDir fs.FS, d *licenses.Detector, sourceInfo *source.Info, modInfo *godoc.ModuleInfo) (*goPackage, *internal.PackageVersionState, error) {
+// The buildTags are set when loading the package; see loadPackage.
+func extractPackage(ctx context.Context, modulePath, pkgPath string, contentDir fs.FS, buildTags []string, d *licenses.Detector, sourceInfo *source.Info, modInfo *godoc.ModuleInfo, opts LoadOptions) (*goPackage, *internal.PackageVersionState, error) {
 	innerPath := rel(pkgPath, modulePath)
 	f, err := contentDir.Open(innerPath)
 	if err != nil {
@@ -91,7 +93,7 @@ func extractPackage(ctx context.Context, modulePath, pkgPath string, contentDir
 		status error
 		errMsg string
 	)
-	pkg, err := loadPackage(ctx, contentDir, goFiles, innerPath, sourceInfo, modInfo)
+	pkg, err := loadPackage(ctx, contentDir, goFiles, innerPath, buildTags, sourceInfo, modInfo, opts)
 	if bpe := (*BadPackageError)(nil); errors.As(err, &bpe) {
 		log.Infof(ctx, "Error loading %s: %v", innerPath, err)
 		status = derrors.PackageInvalidContents
@@ -135,8 +137,9 @@ func extractPackage(ctx context.Context, modulePath, pkgPath string, contentDir
 }
 
 type packageMeta struct {
-	path string
-	name string
+	path       string
+	name       string
+	constraint string // build constraint, for a package loaded despite excluding all build contexts
 }
 
 // extractPackageMetas returns a slice of packageMetas containing only the information
@@ -150,7 +153,10 @@ type packageMeta struct {
 // * a maximum file size (MaxFileSize)
 // * the particular set of build contexts we consider (goEnvs)
 // * whether the import path is valid.
-func extractPackageMetas(ctx context.Context, modulePath, resolvedVersion string, contentDir fs.FS) (_ []*packageMeta, _ *godoc.ModuleInfo, _ []*internal.PackageVersionState, err error) {
+//
+// Directories whose Go files are all excluded by build constraints are
+// returned as ConstrainedPackages, and loaded as packages only if opts says so.
+func extractPackageMetas(ctx context.Context, modulePath, resolvedVersion string, contentDir fs.FS, opts LoadOptions) (_ []*packageMeta, _ *godoc.ModuleInfo, _ []*internal.PackageVersionState, _ []*ConstrainedPackage, err error) {
 	defer derrors.Wrap(&err, "extractPackages(ctx, %q, %q, r, d)", modulePath, resolvedVersion)
 	ctx, span := trace.StartSpan(ctx, "fetch.extractPackages")
 	defer span.End()
@@ -207,7 +213,13 @@ func extractPackageMetas(ctx context.Context, modulePath, resolvedVersion string
 			return err
 		}
 		if d.IsDir() {
-			// Skip directories.
+			// A nested module, which only a local module can have, is
+			// not part of this one, as for the go command.
+			if pathname != "." {
+				if _, err := fs.Stat(contentDir, path.Join(pathname, "go.mod")); err == nil {
+					return fs.SkipDir
+				}
+			}
 			return nil
 		}
 		innerPath := path.Dir(pathname)
@@ -266,10 +278,10 @@ func extractPackageMetas(ctx context.Context, modulePath, resolvedVersion string
 		return nil
 	})
 	if errors.Is(err, fs.ErrNotExist) {
-		return nil, nil, nil, fmt.Errorf("no files: %w", ErrModuleContainsNoPackages)
+		return nil, nil, nil, nil, fmt.Errorf("no files: %w", ErrModuleContainsNoPackages)
 	}
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	for pkgName := range dirs {
@@ -281,7 +293,8 @@ func extractPackageMetas(ctx context.Context, modulePath, resolvedVersion string
 	// Start reading the file contents now to extract information
 	// about Go packages.
 	var pkgs []*packageMeta
-	var mu sync.Mutex // guards pkgs, incompleteDirs, packageVersionStates
+	var constrained []*ConstrainedPackage
+	var mu sync.Mutex // guards pkgs, constrained, incompleteDirs, packageVersionStates
 	var errgroup errgroup.Group
 	for innerPath, goFiles := range dirs {
 		innerPath, goFiles := innerPath, goFiles
@@ -300,7 +313,18 @@ func extractPackageMetas(ctx context.Context, modulePath, resolvedVersion string
 				status error
 				errMsg string
 			)
-			pkg, err := loadPackageMeta(ctx, contentDir, goFiles, innerPath, modInfo)
+			pkg, err := loadPackageMeta(ctx, contentDir, goFiles, innerPath, nil, modInfo)
+			if err == nil && pkg == nil && len(goFiles) > 0 {
+				// No build context matched the files. Record the constraints
+				// that exclude them, and load the package anyway if asked to.
+				var cp *ConstrainedPackage
+				pkg, cp, err = loadConstrainedPackageMeta(ctx, contentDir, goFiles, innerPath, modInfo, opts)
+				if cp != nil {
+					mu.Lock()
+					constrained = append(constrained, cp)
+					mu.Unlock()
+				}
+			}
 			if bpe := (*BadPackageError)(nil); errors.As(err, &bpe) {
 				log.Infof(ctx, "Error loading %s: %v", innerPath, err)
 				mu.Lock()
@@ -346,13 +370,14 @@ func extractPackageMetas(ctx context.Context, modulePath, resolvedVersion string
 	}
 
 	if err := errgroup.Wait(); err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
+	sort.Slice(constrained, func(i, j int) bool { return constrained[i].Path < constrained[j].Path })
 	if len(pkgs) == 0 {
-		return nil, nil, packageVersionStates, ErrModuleContainsNoPackages
+		return nil, nil, packageVersionStates, constrained, ErrModuleContainsNoPackages
 	}
-	return pkgs, modInfo, packageVersionStates, nil
+	return pkgs, modInfo, packageVersionStates, constrained, nil
 }
 
 // ignoredByGoTool reports whether the given import path corresponds
@@ -18,7 +18,10 @@ import (
 
 // extractReadme returns the file path and contents the unit's README,
 // if there is one. dir is the directory path prefixed with the modulePath.
-func extractReadme(modulePath, dir, resolvedVersion string, contentDir fs.FS) (_ *internal.Readme, err error) {
+// If names is non-nil, the README is the file of the directory whose name
+// is the earliest of names, compared without regard to case; otherwise it
+// is chosen as isReadme describes.
+func extractReadme(modulePath, dir, resolvedVersion string, contentDir fs.FS, names []string) (_ *internal.Readme, err error) {
 	defer derrors.Wrap(&err, "extractReadme(ctx, %q, %q %q, r)", modulePath, dir, resolvedVersion)
 
 	innerPath := rel(dir, modulePath)
@@ -50,21 +53,23 @@ func extractReadme(modulePath, dir, resolvedVersion string, contentDir fs.FS) (_
 		return nil, err
 	}
 	var readme *internal.Readme
+	rank := len(names)
 	for _, e := range entries {
 		pathname := path.Join(innerPath, e.Name())
-		if !e.IsDir() && isReadme(pathname) {
-			info, err := e.Info()
-			if err != nil {
-				return nil, err
-			}
-			if info.Size() > MaxFileSize {
-				return nil, fmt.Errorf("file size %d exceeds max limit %d: %w", info.Size(), MaxFileSize, derrors.ModuleTooLarge)
+		if e.IsDir() {
+			continue
+		}
+		if names != nil {
+			// Take the earliest name listed.
+			r := readmeNameRank(e.Name(), names)
+			if r >= rank {
+				continue
 			}
-			c, err := readFSFile(contentDir, pathname, MaxFileSize)
-			if err != nil {
-				return nil, err
+			rank = r
+		} else {
+			if !isReadme(pathname) {
+				continue
 			}
-
 			if readme != nil {
 				// Prefer READMEs written in markdown, since we style these on
 				// the frontend.
@@ -73,15 +78,37 @@ func extractReadme(modulePath, dir, resolvedVersion string, contentDir fs.FS) (_
 					continue
 				}
 			}
-			readme = &internal.Readme{
-				Filepath: pathname,
-				Contents: string(c),
-			}
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() > MaxFileSize {
+			return nil, fmt.Errorf("file size %d exceeds max limit %d: %w", info.Size(), MaxFileSize, derrors.ModuleTooLarge)
+		}
+		c, err := readFSFile(contentDir, pathname, MaxFileSize)
+		if err != nil {
+			return nil, err
+		}
+		readme = &internal.Readme{
+			Filepath: pathname,
+			Contents: string(c),
 		}
 	}
 	return readme, nil
 }
 
+// readmeNameRank returns the index in names of the file name, compared
+// without regard to case, or len(names) if it is not there.
+func readmeNameRank(name string, names []string) int {
+	for i, n := range names {
+		if strings.EqualFold(name, n) {
+			return i
+		}
+	}
+	return len(names)
+}
+
 var excludedReadmeExts = map[string]bool{".go": true, ".vendor": true}
 
 // isReadme reports whether file is README or if the base name of file, with or
@@ -27,6 +27,7 @@ func TestExtractReadme(t *testing.T) {
 	for _, test := range []struct {
 		name, modulePath, pkgPath, version string
 		files                              map[string]string
+		names                              []string
 		want                               *internal.Readme
 	}{
 		{
@@ -77,6 +78,32 @@ func TestExtractReadme(t *testing.T) {
 				Contents: "README",
 			},
 		},
+		{
+			name:       "names in order of preference",
+			modulePath: "github.com/my/module",
+			pkgPath:    "github.com/my/module/foo",
+			version:    "v1.0.0",
+			files: map[string]string{
+				"foo/README.md": "README",
+				"foo/DOC.md":    "doc",
+			},
+			names: []string{"doc.md", "README.md"},
+			want: &internal.Readme{
+				Filepath: "foo/DOC.md",
+				Contents: "doc",
+			},
+		},
+		{
+			name:       "names not listed",
+			modulePath: "github.com/my/module",
+			pkgPath:    "github.com/my/module/foo",
+			version:    "v1.0.0",
+			files: map[string]string{
+				"foo/README.rst": "README",
+			},
+			names: []string{"README.md", "README"},
+			want:  nil,
+		},
 		{
 			name:       "no readme",
 			modulePath: "emp.ty/module",
@@ -116,7 +143,7 @@ func TestExtractReadme(t *testing.T) {
 					t.Fatal(err)
 				}
 			}
-			got, err := extractReadme(test.modulePath, test.pkgPath, test.version, contentDir)
+			got, err := extractReadme(test.modulePath, test.pkgPath, test.version, contentDir, test.names)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -154,7 +181,7 @@ func TestExtractReadmesError(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	got, err := extractReadme(modulePath, pkgPath, version, contentDir)
+	got, err := extractReadme(modulePath, pkgPath, version, contentDir, nil)
 	if err == nil {
 		t.Fatalf("want error, got %v", cmp.Diff([]*internal.Readme{}, got))
 	}
@@ -69,6 +69,7 @@ func moduleUnitMetas(minfo internal.ModuleInfo, pkgs []*packageMeta) []*internal
 		}
 		if pkg, ok := pkgLookup[dirPath]; ok {
 			um.Name = pkg.name
+			um.BuildConstraint = pkg.constraint
 		}
 		ums = append(ums, um)
 	}
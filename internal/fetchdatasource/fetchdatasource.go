@@ -14,12 +14,14 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/mod/semver"
 	"github.com/wow-look-at-my/static-pkgsite/internal"
 	"github.com/wow-look-at-my/static-pkgsite/internal/derrors"
 	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
+	"github.com/wow-look-at-my/static-pkgsite/internal/licenses"
 	"github.com/wow-look-at-my/static-pkgsite/internal/log"
 	"github.com/wow-look-at-my/static-pkgsite/internal/lru"
 	"github.com/wow-look-at-my/static-pkgsite/internal/proxy"
@@ -31,6 +33,10 @@ import (
 type FetchDataSource struct {
 	opts  Options
 	cache *lru.Cache[internal.Modver, cacheEntry]
+
+	mu         sync.Mutex
+	importedBy map[string][]string               // see SetImportedBy
+	versions   map[string][]*internal.ModuleInfo // see SetVersions
 }
 
 // Options are parameters for creating a new FetchDataSource.
@@ -41,6 +47,8 @@ type Options struct {
 	// include a ProxyModuleGetter in Getters.
 	ProxyClientForLatest *proxy.Client
 	BypassLicenseCheck   bool
+	// LoadOptions control how packages are loaded from fetched modules.
+	LoadOptions fetch.LoadOptions
 }
 
 // New creates a new FetchDataSource from the options.
@@ -69,8 +77,13 @@ const maxCachedModules = 100
 // cacheGet returns information from the cache if it is present, and (nil, nil) otherwise.
 func (ds *FetchDataSource) cacheGet(path, version string) (fetch.ModuleGetter, *fetch.LazyModule, error) {
 	// Look for an exact match first, then use LocalVersion, as for a
-	// directory-based or GOPATH-mode module.
-	for _, v := range []string{version, fetch.LocalVersion} {
+	// directory-based or GOPATH-mode module, unless the version is one
+	// set by SetVersions, which is served on its own.
+	vs := []string{version, fetch.LocalVersion}
+	if ds.hasVersion(path, version) {
+		vs = vs[:1]
+	}
+	for _, v := range vs {
 		if e, ok := ds.cache.Get(internal.Modver{Path: path, Version: v}); ok {
 			return e.g, e.module, e.err
 		}
@@ -134,6 +147,19 @@ func (ds *FetchDataSource) getModule(ctx context.Context, modulePath, vers strin
 	return m, err
 }
 
+// ModuleGetter returns the getter that serves the module at the given path
+// and version, as the frontend gets it, and the module it serves.
+func (ds *FetchDataSource) ModuleGetter(ctx context.Context, modulePath, version string) (_ fetch.ModuleGetter, _ *fetch.LazyModule, err error) {
+	defer derrors.Wrap(&err, "FetchDataSource.ModuleGetter(%q, %q)", modulePath, version)
+
+	m, err := ds.getModule(ctx, modulePath, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	g, _, _ := ds.cacheGet(modulePath, version)
+	return g, m, nil
+}
+
 // fetch fetches a module using the configured ModuleGetters.
 // It tries each getter in turn until it finds one that has the module.
 func (ds *FetchDataSource) fetch(ctx context.Context, modulePath, version string) (_ *fetch.LazyModule, g fetch.ModuleGetter, err error) {
@@ -143,7 +169,7 @@ func (ds *FetchDataSource) fetch(ctx context.Context, modulePath, version string
 		log.Infof(ctx, "FetchDataSource: fetched %s@%s using %T in %s with error %v", modulePath, version, g, time.Since(start), err)
 	}()
 	for _, g := range ds.opts.Getters {
-		m := fetch.FetchLazyModule(ctx, modulePath, version, g)
+		m := fetch.FetchLazyModuleWithOptions(ctx, modulePath, version, g, ds.opts.LoadOptions)
 		if m.Error == nil {
 			if ds.opts.BypassLicenseCheck {
 				m.IsRedistributable = true
@@ -234,6 +260,13 @@ func (ds *FetchDataSource) findUnit(ctx context.Context, m *fetch.LazyModule, pa
 		return nil, err
 	}
 	ds.populateUnitSubdirectories(unit, m)
+	// Fetched units have their imports, but not the count that the
+	// database records.
+	unit.NumImports = len(unit.Imports)
+	if importers, ok := ds.importers(path); ok {
+		unit.NumImportedBy = len(importers)
+	}
+	unit.LicenseContents = unitLicenses(m, unit)
 	if ds.opts.BypassLicenseCheck {
 		unit.IsRedistributable = true
 	} else {
@@ -242,6 +275,27 @@ func (ds *FetchDataSource) findUnit(ctx context.Context, m *fetch.LazyModule, pa
 	return unit, nil
 }
 
+// unitLicenses returns the licenses of u, which has the metadata of those
+// that apply to it. The module itself has the licenses of all its
+// directories, so that its licenses tab lists every license of the module.
+func unitLicenses(m *fetch.LazyModule, u *internal.Unit) []*licenses.License {
+	all := m.Licenses()
+	if u.Path == m.ModulePath {
+		return all
+	}
+	applies := map[string]bool{}
+	for _, l := range u.Licenses {
+		applies[l.FilePath] = true
+	}
+	var lics []*licenses.License
+	for _, l := range all {
+		if applies[l.FilePath] {
+			lics = append(lics, l)
+		}
+	}
+	return lics
+}
+
 func findUnitMeta(m *fetch.LazyModule, path string) (*internal.UnitMeta, error) {
 	for _, um := range m.UnitMetas {
 		if um.Path == path {
@@ -339,6 +393,117 @@ func (ds *FetchDataSource) getLatestMajorVersion(ctx context.Context, fullPath,
 	}
 }
 
+// SetImportedBy sets the importers of packages that the data source reports,
+// as sorted lists of package paths keyed by the path of the package they
+// import. The modules the data source fetches do not tell which packages
+// import a package, so without importers, the data source does not report
+// any.
+func (ds *FetchDataSource) SetImportedBy(importedBy map[string][]string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.importedBy = importedBy
+}
+
+// importers returns the importers of the package at pkgPath, and whether
+// they are known.
+func (ds *FetchDataSource) importers(pkgPath string) ([]string, bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.importedBy == nil {
+		return nil, false
+	}
+	return ds.importedBy[pkgPath], true
+}
+
+// GetImportedBy returns up to limit importers of the package at pkgPath, as
+// set by SetImportedBy. Without importers, it returns an error wrapping
+// derrors.Unsupported.
+func (ds *FetchDataSource) GetImportedBy(ctx context.Context, pkgPath, modulePath string, limit int) (_ []string, err error) {
+	importers, ok := ds.importers(pkgPath)
+	if !ok {
+		return nil, fmt.Errorf("importers of %s: %w", pkgPath, derrors.Unsupported)
+	}
+	if len(importers) > limit {
+		importers = importers[:limit]
+	}
+	return importers, nil
+}
+
+// GetImportedByCount returns the number of importers of the package at
+// pkgPath, as set by SetImportedBy. Without importers, it returns an error
+// wrapping derrors.Unsupported.
+func (ds *FetchDataSource) GetImportedByCount(ctx context.Context, pkgPath, modulePath string) (_ int, err error) {
+	importers, ok := ds.importers(pkgPath)
+	if !ok {
+		return 0, fmt.Errorf("importers of %s: %w", pkgPath, derrors.Unsupported)
+	}
+	return len(importers), nil
+}
+
+// SetVersions sets the versions of modules that the data source reports,
+// keyed by module path. Each version is fetched on its own, rather than as
+// the local version of the module. Without versions, the data source does
+// not report any.
+func (ds *FetchDataSource) SetVersions(versions map[string][]*internal.ModuleInfo) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.versions = versions
+}
+
+// hasVersion reports whether version is one of the versions of the module
+// at modulePath set by SetVersions.
+func (ds *FetchDataSource) hasVersion(modulePath, version string) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for _, mi := range ds.versions[modulePath] {
+		if mi.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// GetVersionsForPath returns the versions of the module containing the
+// unit at path, as set by SetVersions, that have the unit, in descending
+// semver order. If no module with versions contains path, it returns an
+// error wrapping derrors.Unsupported.
+func (ds *FetchDataSource) GetVersionsForPath(ctx context.Context, path string) (_ []*internal.ModuleInfo, err error) {
+	defer derrors.Wrap(&err, "FetchDataSource.GetVersionsForPath(%q)", path)
+
+	ds.mu.Lock()
+	var (
+		modulePath string
+		versions   []*internal.ModuleInfo
+	)
+	for mp, vs := range ds.versions {
+		if (path == mp || strings.HasPrefix(path, mp+"/")) && len(mp) > len(modulePath) {
+			modulePath, versions = mp, vs
+		}
+	}
+	ds.mu.Unlock()
+	if modulePath == "" {
+		return nil, fmt.Errorf("versions of %s: %w", path, derrors.Unsupported)
+	}
+	var infos []*internal.ModuleInfo
+	for _, mi := range versions {
+		m, err := ds.getModule(ctx, modulePath, mi.Version)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := findUnitMeta(m, path); err == nil {
+			infos = append(infos, mi)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return semver.Compare(infos[i].Version, infos[j].Version) > 0 })
+	return infos, nil
+}
+
+// GetSymbolHistory returns an empty history: the data source does not know
+// the versions symbols were added in.
+func (ds *FetchDataSource) GetSymbolHistory(ctx context.Context, packagePath, modulePath string) (*internal.SymbolHistory, error) {
+	return internal.NewSymbolHistory(), nil
+}
+
 // GetNestedModules is not implemented.
 func (ds *FetchDataSource) GetNestedModules(ctx context.Context, modulePath string) ([]*internal.ModuleInfo, error) {
 	return nil, nil
@@ -519,6 +519,124 @@ func TestGetUnit(t *testing.T) {
 	}
 }
 
+func TestUnitLicenses(t *testing.T) {
+	ctx, ds, teardown := setup(t, nil, true)
+	defer teardown()
+
+	for _, test := range []struct {
+		path string
+		want []string
+	}{
+		// The module has the licenses of all its directories.
+		{"github.com/my/module", []string{"LICENSE", "bar/COPYING", "foo/LICENSE.md"}},
+		{"github.com/my/module/bar", []string{"LICENSE", "bar/COPYING"}},
+	} {
+		um := &internal.UnitMeta{Path: test.path, ModuleInfo: internal.ModuleInfo{ModulePath: "github.com/my/module"}}
+		u, err := ds.GetUnit(ctx, um, internal.AllFields, internal.BuildContext{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, l := range u.LicenseContents {
+			if len(l.Contents) == 0 {
+				t.Errorf("%s: license %s has no contents", test.path, l.FilePath)
+			}
+			got = append(got, l.FilePath)
+		}
+		if diff := cmp.Diff(test.want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+			t.Errorf("%s: licenses mismatch (-want +got):\n%s", test.path, diff)
+		}
+	}
+}
+
+func TestImportedBy(t *testing.T) {
+	ctx, ds, teardown := setup(t, nil, true)
+	defer teardown()
+
+	const (
+		bar = "github.com/my/module/bar"
+		mod = "github.com/my/module"
+	)
+	um := &internal.UnitMeta{Path: bar, ModuleInfo: internal.ModuleInfo{ModulePath: mod}}
+
+	// Importers are unknown until they are set.
+	if _, err := ds.GetImportedBy(ctx, bar, mod, 10); !errors.Is(err, derrors.Unsupported) {
+		t.Errorf("GetImportedBy before SetImportedBy: got %v, want an unsupported error", err)
+	}
+	if _, err := ds.GetImportedByCount(ctx, bar, mod); !errors.Is(err, derrors.Unsupported) {
+		t.Errorf("GetImportedByCount before SetImportedBy: got %v, want an unsupported error", err)
+	}
+
+	ds.SetImportedBy(map[string][]string{bar: {"github.com/my/module/a", "github.com/my/module/foo"}})
+	got, err := ds.GetImportedBy(ctx, bar, mod, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"github.com/my/module/a"}; !cmp.Equal(got, want) {
+		t.Errorf("GetImportedBy: got %v, want %v", got, want)
+	}
+	if n, err := ds.GetImportedByCount(ctx, "github.com/my/module/foo", mod); err != nil || n != 0 {
+		t.Errorf("GetImportedByCount of a package without importers: got %d, %v, want 0, nil", n, err)
+	}
+	u, err := ds.GetUnit(ctx, um, internal.AllFields, internal.BuildContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.NumImportedBy != 2 {
+		t.Errorf("got NumImportedBy %d, want 2", u.NumImportedBy)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	ctx, ds, teardown := setup(t, defaultTestModules, true)
+	defer teardown()
+
+	const mod = "example.com/symbols"
+
+	// Versions are unknown until they are set.
+	if _, err := ds.GetVersionsForPath(ctx, mod); !errors.Is(err, derrors.Unsupported) {
+		t.Errorf("GetVersionsForPath before SetVersions: got %v, want an unsupported error", err)
+	}
+
+	var infos []*internal.ModuleInfo
+	for _, v := range []string{"v1.0.0", "v1.2.0", "v1.1.0"} {
+		infos = append(infos, &internal.ModuleInfo{ModulePath: mod, Version: v})
+	}
+	ds.SetVersions(map[string][]*internal.ModuleInfo{mod: infos})
+	for _, test := range []struct {
+		path string
+		want []string
+	}{
+		{mod, []string{"v1.2.0", "v1.1.0", "v1.0.0"}},
+		{mod + "/hello", []string{"v1.2.0", "v1.1.0"}}, // added in v1.1.0
+	} {
+		got, err := ds.GetVersionsForPath(ctx, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vs []string
+		for _, mi := range got {
+			vs = append(vs, mi.Version)
+		}
+		if diff := cmp.Diff(test.want, vs); diff != "" {
+			t.Errorf("GetVersionsForPath(%q) mismatch (-want +got):\n%s", test.path, diff)
+		}
+	}
+	if _, err := ds.GetVersionsForPath(ctx, "example.com/basic"); !errors.Is(err, derrors.Unsupported) {
+		t.Errorf("GetVersionsForPath of a module without versions: got %v, want an unsupported error", err)
+	}
+
+	// A set version is not served from the cached local version.
+	local := &fetch.LazyModule{}
+	ds.cachePut(nil, mod, fetch.LocalVersion, local, nil)
+	if _, m, _ := ds.cacheGet(mod, "v1.1.0"); m == local {
+		t.Error("cacheGet of a set version returned the local version")
+	}
+	if _, m, _ := ds.cacheGet(mod, "v1.3.0"); m != local {
+		t.Errorf("cacheGet of another version: got %v, want the local version", m)
+	}
+}
+
 func TestBuildConstraints(t *testing.T) {
 	// The Unit returned by GetUnit should have a single Documentation that
 	// matches the BuildContext argument.
@@ -580,3 +698,28 @@ func TestCache(t *testing.T) {
 		}
 	}
 }
+
+func TestModuleGetter(t *testing.T) {
+	ctx, ds, teardown := setup(t, defaultTestModules, true)
+	defer teardown()
+
+	for _, test := range []struct {
+		modulePath, version string
+		wantGetter          fetch.ModuleGetter
+		wantVersion         string
+	}{
+		{"github.com/my/module", version.Latest, ds.opts.Getters[0], fetch.LocalVersion},
+		{"example.com/single", version.Latest, ds.opts.Getters[len(ds.opts.Getters)-1], "v1.0.0"},
+	} {
+		g, m, err := ds.ModuleGetter(ctx, test.modulePath, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g != test.wantGetter || m.Version != test.wantVersion {
+			t.Errorf("%s@%s: got getter %s and version %s, want %s and %s", test.modulePath, test.version, g, m.Version, test.wantGetter, test.wantVersion)
+		}
+	}
+	if _, _, err := ds.ModuleGetter(ctx, "example.com/unknown", version.Latest); !errors.Is(err, derrors.NotFound) {
+		t.Errorf("unknown module: got %v, want a not found error", err)
+	}
+}
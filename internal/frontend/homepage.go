@@ -62,10 +62,16 @@ type LocalModule struct {
 }
 
 func (s *Server) serveHomepage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	// Locally, the page is the same every time, so that static sites
+	// generated from it are reproducible.
+	tipIndex := 0
+	if !s.localMode {
+		tipIndex = rand.Intn(len(searchTips))
+	}
 	s.servePage(ctx, w, "homepage", Homepage{
 		BasePage:     s.newBasePage(r, "Go Packages"),
 		SearchTips:   searchTips,
-		TipIndex:     rand.Intn(len(searchTips)),
+		TipIndex:     tipIndex,
 		LocalModules: s.localModules,
 	})
 }
@@ -6,9 +6,11 @@ package frontend
 
 import (
 	"context"
+	"errors"
 	"strings"
 
 	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/derrors"
 	"github.com/wow-look-at-my/static-pkgsite/internal/frontend/serrors"
 	"github.com/wow-look-at-my/static-pkgsite/internal/log"
 	"github.com/wow-look-at-my/static-pkgsite/internal/stdlib"
@@ -95,13 +97,16 @@ var (
 // fetchImportedByDetails fetches importers for the package version specified by
 // path and version from the database and returns a ImportedByDetails.
 func fetchImportedByDetails(ctx context.Context, ds internal.DataSource, pkgPath, modulePath string) (*ImportedByDetails, error) {
-	db, ok := ds.(internal.PostgresDB)
+	db, ok := ds.(internal.ImportedByDataSource)
 	if !ok {
 		// The proxydatasource does not support the imported by page.
 		return nil, serrors.DatasourceNotSupportedError()
 	}
 
 	importedBy, err := db.GetImportedBy(ctx, pkgPath, modulePath, importedByLimit)
+	if errors.Is(err, derrors.Unsupported) {
+		return nil, serrors.DatasourceNotSupportedError()
+	}
 	if err != nil {
 		return nil, err
 	}
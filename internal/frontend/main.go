@@ -111,7 +111,7 @@ type File struct {
 }
 
 func fetchMainDetails(ctx context.Context, ds internal.DataSource, um *internal.UnitMeta,
-	requestedVersion string, expandReadme bool, bc internal.BuildContext) (_ *MainDetails, err error) {
+	requestedVersion string, expandReadme bool, bc internal.BuildContext, ro ReadmeOptions, glanceThreshold int) (_ *MainDetails, err error) {
 	defer stats.Elapsed(ctx, "fetchMainDetails")()
 
 	unit, err := ds.GetUnit(ctx, um, internal.WithMain, bc)
@@ -126,7 +126,7 @@ func fetchMainDetails(ctx context.Context, ds internal.DataSource, um *internal.
 	if err != nil {
 		return nil, err
 	}
-	readme, err := readmeContent(ctx, unit)
+	readme, err := readmeContent(ctx, unit, ro)
 	if err != nil {
 		return nil, err
 	}
@@ -164,7 +164,7 @@ func fetchMainDetails(ctx context.Context, ds internal.DataSource, um *internal.
 			return nil, err
 		}
 
-		docParts, err = getHTML(ctx, unit, docPkg, unit.SymbolHistory, bc)
+		docParts, err = getHTML(ctx, unit, docPkg, unit.SymbolHistory, bc, glanceThreshold)
 		// If err  is ErrTooLarge, then docBody will have an appropriate message.
 		if err != nil && !errors.Is(err, dochtml.ErrTooLarge) {
 			return nil, err
@@ -186,7 +186,7 @@ func fetchMainDetails(ctx context.Context, ds internal.DataSource, um *internal.
 			return nil, err
 		}
 		if err == nil {
-			rm, err := processReadme(ctx, modReadme, um.SourceInfo)
+			rm, err := processReadme(ctx, modReadme, um.SourceInfo, ro)
 			if err != nil {
 				return nil, err
 			}
@@ -257,23 +257,23 @@ func cleanDocumentation(docs []*internal.Documentation) []*internal.Documentatio
 
 // readmeContent renders the readme to html and collects the headings
 // into an outline.
-func readmeContent(ctx context.Context, u *internal.Unit) (_ *Readme, err error) {
+func readmeContent(ctx context.Context, u *internal.Unit, ro ReadmeOptions) (_ *Readme, err error) {
 	defer derrors.Wrap(&err, "readmeContent(%q, %q, %q)", u.Path, u.ModulePath, u.Version)
 	defer stats.Elapsed(ctx, "readmeContent")()
 	if !u.IsRedistributable {
 		return &Readme{}, nil
 	}
-	return ProcessReadme(ctx, u)
+	return processReadme(ctx, u.Readme, u.SourceInfo, ro)
 }
 
 const missingDocReplacement = `<p>Documentation is missing.</p>`
 
 func getHTML(ctx context.Context, u *internal.Unit, docPkg *godoc.Package,
-	nameToVersion map[string]string, bc internal.BuildContext) (_ *dochtml.Parts, err error) {
+	nameToVersion map[string]string, bc internal.BuildContext, glanceThreshold int) (_ *dochtml.Parts, err error) {
 	defer derrors.Wrap(&err, "getHTML(%s)", u.Path)
 
 	if len(u.Documentation[0].Source) > 0 {
-		return renderDocParts(ctx, u, docPkg, nameToVersion, bc)
+		return renderDocParts(ctx, u, docPkg, nameToVersion, bc, glanceThreshold)
 	}
 	log.Errorf(ctx, "unit %s (%s@%s) missing documentation source", u.Path, u.ModulePath, u.Version)
 	return &dochtml.Parts{Body: template.MustParseAndExecuteToHTML(missingDocReplacement)}, nil
@@ -30,13 +30,14 @@ import (
 //
 // The extracted links are for display outside of the readme contents.
 //
-// This function is exported for use by external tools.
+// This function is exported for use by external tools. It renders the README
+// with DefaultReadmeOptions.
 func ProcessReadme(ctx context.Context, u *internal.Unit) (_ *Readme, err error) {
 	defer derrors.WrapAndReport(&err, "ProcessReadme(%q, %q, %q)", u.Path, u.ModulePath, u.Version)
-	return processReadme(ctx, u.Readme, u.SourceInfo)
+	return processReadme(ctx, u.Readme, u.SourceInfo, DefaultReadmeOptions())
 }
 
-func processReadme(ctx context.Context, readme *internal.Readme, info *source.Info) (frontendReadme *Readme, err error) {
+func processReadme(ctx context.Context, readme *internal.Readme, info *source.Info, opts ReadmeOptions) (frontendReadme *Readme, err error) {
 	if readme == nil || readme.Contents == "" {
 		return &Readme{}, nil
 	}
@@ -49,17 +50,23 @@ func processReadme(ctx context.Context, readme *internal.Readme, info *source.In
 		return &Readme{HTML: h}, nil
 	}
 
+	contents := readme.Contents
+	if opts.Footnotes {
+		contents = expandFootnotes(contents)
+	}
 	p := markdown.Parser{
 		HeadingIDs:    true,
-		Strikethrough: true,
-		TaskListItems: true,
+		Strikethrough: opts.Strikethrough,
+		TaskListItems: opts.TaskLists,
 		AutoLinkText:  true,
-		Table:         true,
+		Table:         opts.Tables,
 		Emoji:         true,
 	}
-	doc := p.Parse(readme.Contents)
+	doc := p.Parse(contents)
 	(&linkRewriter{info, readme}).rewriteLinks(doc)
 	rewriteImgSrc(doc, info, readme)
+	rewriteTaskItems(doc)
+	rewriteDiagrams(doc, opts.DiagramLanguages)
 	rewriteHeadingIDs(doc) // rewrite heading ids before extractTOC extracts them
 	et := &extractTOC{ctx: ctx, removeTitle: true}
 	et.extract(doc)
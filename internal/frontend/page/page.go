@@ -6,6 +6,8 @@
 package page
 
 import (
+	"time"
+
 	"github.com/google/safehtml"
 	"github.com/google/safehtml/template"
 	"github.com/wow-look-at-my/static-pkgsite/internal/experiment"
@@ -57,6 +59,45 @@ type BasePage struct {
 	// SearchModeSymbol is the value of const searchModeSymbol. It is used in
 	// the search bar dropdown.
 	SearchModeSymbol string
+
+	// Site, Build and Page are the stable data available to custom template
+	// overrides. Fields may be added to them, but existing fields must not
+	// be removed or renamed.
+	Site  SiteData
+	Build BuildData
+	Page  PageData
+}
+
+// SiteData describes the site a page is rendered for.
+type SiteData struct {
+	// Name is the human-readable name of the site, or "".
+	Name string
+
+	// URL is the absolute URL the site is published at, or "".
+	URL string
+
+	// BasePath is the path component of URL, with leading and trailing
+	// slashes. It is "/" if URL is empty or has no path.
+	BasePath string
+}
+
+// BuildData describes the program that rendered a page.
+type BuildData struct {
+	// GeneratorVersion is the module version of the running binary, or
+	// "(devel)" for a binary built from a working tree.
+	GeneratorVersion string
+
+	// Time is when the server was created or the site generation started.
+	Time time.Time
+}
+
+// PageData describes the unit shown on a page. It is the zero value for
+// pages that do not show a unit.
+type PageData struct {
+	UnitPath   string
+	ModulePath string
+	Version    string
+	Synopsis   string
 }
 
 func (p *BasePage) SetBasePage(bp BasePage) {
@@ -0,0 +1,359 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"rsc.io/markdown"
+)
+
+// ReadmeOptions selects the Markdown extensions used to render READMEs.
+type ReadmeOptions struct {
+	Tables        bool // GitHub-style pipe tables
+	Strikethrough bool // ~~deleted~~ text
+	TaskLists     bool // "- [x]" list items, shown with a check mark
+	Footnotes     bool // [^label] references and [^label]: definitions
+
+	// DiagramLanguages lists the languages of fenced code blocks, such as
+	// "mermaid", that hold diagram source. Such a block is shown collapsed,
+	// in a <details class="readme-diagram readme-diagram-LANG"> element
+	// that a renderer script can find, instead of as a wall of code.
+	DiagramLanguages []string
+}
+
+// DefaultReadmeOptions returns the options used when none are configured:
+// every extension is enabled, and the common diagram languages are
+// recognized.
+func DefaultReadmeOptions() ReadmeOptions {
+	return ReadmeOptions{
+		Tables:           true,
+		Strikethrough:    true,
+		TaskLists:        true,
+		Footnotes:        true,
+		DiagramLanguages: []string{"mermaid", "plantuml", "dot", "graphviz", "d2"},
+	}
+}
+
+// rewriteTaskItems replaces the checkboxes of task list items, which the
+// sanitizer removes along with all other form elements, with check mark
+// characters.
+func rewriteTaskItems(doc *markdown.Document) {
+	walkBlocks(doc.Blocks, func(b markdown.Block) error {
+		if text, ok := b.(*markdown.Text); ok {
+			for i, inl := range text.Inline {
+				if task, ok := inl.(*markdown.Task); ok {
+					mark := "☐" // ballot box
+					if task.Checked {
+						mark = "☑" // ballot box with check
+					}
+					text.Inline[i] = &markdown.Plain{Text: mark}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// diagramLanguageRE matches the languages that can be part of a class name
+// the sanitizer keeps.
+var diagramLanguageRE = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// rewriteDiagrams replaces the fenced code blocks whose language is one of
+// langs with a collapsed block holding the diagram source.
+func rewriteDiagrams(doc *markdown.Document, langs []string) {
+	if len(langs) == 0 {
+		return
+	}
+	isDiagram := map[string]bool{}
+	for _, l := range langs {
+		isDiagram[strings.ToLower(l)] = true
+	}
+	var rewrite func([]markdown.Block)
+	rewrite = func(blocks []markdown.Block) {
+		for i, b := range blocks {
+			switch x := b.(type) {
+			case *markdown.List:
+				rewrite(x.Items)
+			case *markdown.Item:
+				rewrite(x.Blocks)
+			case *markdown.Quote:
+				rewrite(x.Blocks)
+			case *markdown.CodeBlock:
+				if x.Fence == "" {
+					continue
+				}
+				lang, _, _ := strings.Cut(strings.TrimSpace(x.Info), " ")
+				lang = strings.ToLower(lang)
+				if !isDiagram[lang] {
+					continue
+				}
+				class := "readme-diagram"
+				if diagramLanguageRE.MatchString(lang) {
+					class += " readme-diagram-" + lang
+				}
+				var buf strings.Builder
+				fmt.Fprintf(&buf, `<details class="%s"><summary>Diagram source (%s)</summary><pre><code>`,
+					class, html.EscapeString(lang))
+				for _, line := range x.Text {
+					buf.WriteString(html.EscapeString(line))
+					buf.WriteByte('\n')
+				}
+				buf.WriteString("</code></pre></details>")
+				blocks[i] = &markdown.HTMLBlock{Text: []string{buf.String()}}
+			}
+		}
+	}
+	rewrite(doc.Blocks)
+}
+
+// The Markdown parser has no footnote support, so expandFootnotes rewrites
+// footnotes into inline HTML and Markdown before parsing, the way GitHub
+// renders them: each reference becomes a superscript number linking to its
+// note, and the notes, in order of first reference, become a list at the
+// end of the document with a link back to the reference. Definitions that
+// are never referenced are dropped, and references to undefined labels are
+// left as written. Footnotes in fenced code blocks and code spans are left
+// alone.
+//
+// A definition is a line "[^label]: text", followed by any lines indented
+// by four spaces or a tab, which continue it.
+
+var (
+	footnoteDefRE = regexp.MustCompile(`^ {0,3}\[\^([^\]\s]+)\]:[ \t]?(.*)$`)
+	footnoteRefRE = regexp.MustCompile(`\[\^([^\]\s]+)\]`)
+)
+
+// The ids of footnotes and references contain an underscore, which heading
+// ids never do, so that they cannot collide.
+func footnoteID(n int) string    { return fmt.Sprintf("readme-fn_%d", n) }
+func footnoteRefID(n int) string { return fmt.Sprintf("readme-fnref_%d", n) }
+
+func expandFootnotes(src string) string {
+	lines := strings.Split(src, "\n")
+	var (
+		body  []string
+		defs  = map[string][]string{}
+		fence fenceTracker
+	)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if fence.code(line) {
+			body = append(body, line)
+			continue
+		}
+		m := footnoteDefRE.FindStringSubmatch(line)
+		if m == nil {
+			body = append(body, line)
+			continue
+		}
+		note := []string{m[2]}
+		j := i + 1
+		for j < len(lines) {
+			if isIndentedLine(lines[j]) {
+				note = append(note, unindentLine(lines[j]))
+				j++
+				continue
+			}
+			// Blank lines belong to the note if an indented line follows.
+			k := j
+			for k < len(lines) && strings.TrimSpace(lines[k]) == "" {
+				k++
+			}
+			if k == j || k == len(lines) || !isIndentedLine(lines[k]) {
+				break
+			}
+			for ; j < k; j++ {
+				note = append(note, "")
+			}
+		}
+		label := strings.ToLower(m[1]) // labels are case-insensitive
+		if _, ok := defs[label]; !ok {
+			defs[label] = note // the first definition wins
+		}
+		i = j - 1
+	}
+	if len(defs) == 0 {
+		return src
+	}
+
+	nums := map[string]int{}
+	var order []string
+	ref := func(label string) (string, bool) {
+		label = strings.ToLower(label)
+		if _, ok := defs[label]; !ok {
+			return "", false
+		}
+		n, seen := nums[label]
+		if seen {
+			return fmt.Sprintf(`<sup><a href="#%s">%d</a></sup>`, footnoteID(n), n), true
+		}
+		order = append(order, label)
+		n = len(order)
+		nums[label] = n
+		return fmt.Sprintf(`<sup><a href="#%s" id="%s">%d</a></sup>`, footnoteID(n), footnoteRefID(n), n), true
+	}
+	body = replaceFootnoteRefs(body, ref)
+	if len(order) == 0 {
+		return strings.Join(body, "\n")
+	}
+	if fence.fence != "" {
+		// Close a code block left open, so that the notes are not part of it.
+		body = append(body, strings.TrimSpace(fence.fence))
+	}
+
+	out := append(body, "", "<section>", "<hr>", "<ol>")
+	// Notes can refer to other notes, which adds them to order.
+	for i := 0; i < len(order); i++ {
+		n := i + 1
+		note := replaceFootnoteRefs(defs[order[i]], ref)
+		for len(note) > 0 && strings.TrimSpace(note[len(note)-1]) == "" {
+			note = note[:len(note)-1]
+		}
+		backref := fmt.Sprintf(`<a href="#%s" title="Back to reference %d">&#x21a9;</a>`, footnoteRefID(n), n)
+		if i > 0 {
+			out = append(out, "</li>")
+		}
+		out = append(out, fmt.Sprintf(`<li id="%s">`, footnoteID(n)), "")
+		if len(note) == 0 || endsInCode(note) {
+			out = append(out, note...)
+			out = append(out, "", backref)
+		} else {
+			note[len(note)-1] += " " + backref
+			out = append(out, note...)
+		}
+		out = append(out, "")
+	}
+	out = append(out, "</li>", "</ol>", "</section>")
+	return strings.Join(out, "\n")
+}
+
+// replaceFootnoteRefs returns lines with each footnote reference outside
+// code replaced by the result of ref, if it returns true.
+func replaceFootnoteRefs(lines []string, ref func(label string) (string, bool)) []string {
+	var (
+		out   []string
+		fence fenceTracker
+	)
+	for _, line := range lines {
+		if fence.code(line) || !strings.Contains(line, "[^") {
+			out = append(out, line)
+			continue
+		}
+		var b strings.Builder
+		for line != "" {
+			// Copy code spans as they are.
+			start, end := nextCodeSpan(line)
+			b.WriteString(footnoteRefRE.ReplaceAllStringFunc(line[:start], func(s string) string {
+				if r, ok := ref(s[2 : len(s)-1]); ok {
+					return r
+				}
+				return s
+			}))
+			b.WriteString(line[start:end])
+			line = line[end:]
+		}
+		out = append(out, b.String())
+	}
+	return out
+}
+
+// nextCodeSpan returns the bounds of the first code span in s, or
+// len(s), len(s) if there is none.
+func nextCodeSpan(s string) (start, end int) {
+	for i := 0; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		n := 1
+		for i+n < len(s) && s[i+n] == '`' {
+			n++
+		}
+		// Look for a closing run of exactly n backticks.
+		for j := i + n; j < len(s); {
+			if s[j] != '`' {
+				j++
+				continue
+			}
+			m := 1
+			for j+m < len(s) && s[j+m] == '`' {
+				m++
+			}
+			if m == n {
+				return i, j + m
+			}
+			j += m
+		}
+		i += n
+	}
+	return len(s), len(s)
+}
+
+// A fenceTracker follows fenced code blocks through the lines of a
+// Markdown document.
+type fenceTracker struct {
+	fence string // the opening fence of the current code block, or ""
+}
+
+// code reports whether line is part of a fenced code block, including its
+// fences.
+func (t *fenceTracker) code(line string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	if t.fence != "" {
+		if run := fenceRun(trimmed); run != "" && run[0] == t.fence[0] && len(run) >= len(t.fence) &&
+			strings.TrimSpace(trimmed[len(run):]) == "" {
+			t.fence = ""
+		}
+		return true
+	}
+	run := fenceRun(trimmed)
+	if run == "" || (run[0] == '`' && strings.Contains(trimmed[len(run):], "`")) {
+		return false
+	}
+	t.fence = run
+	return true
+}
+
+// fenceRun returns the run of three or more backticks or tildes at the
+// start of s, or "".
+func fenceRun(s string) string {
+	if s == "" || (s[0] != '`' && s[0] != '~') {
+		return ""
+	}
+	n := 1
+	for n < len(s) && s[n] == s[0] {
+		n++
+	}
+	if n < 3 {
+		return ""
+	}
+	return s[:n]
+}
+
+// endsInCode reports whether the last line of lines is part of a fenced
+// code block.
+func endsInCode(lines []string) bool {
+	var t fenceTracker
+	in := false
+	for _, l := range lines {
+		in = t.code(l)
+	}
+	return in
+}
+
+func isIndentedLine(s string) bool {
+	return strings.HasPrefix(s, "    ") || strings.HasPrefix(s, "\t")
+}
+
+func unindentLine(s string) string {
+	if strings.HasPrefix(s, "\t") {
+		return s[1:]
+	}
+	return strings.TrimPrefix(s, "    ")
+}
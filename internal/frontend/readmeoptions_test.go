@@ -0,0 +1,205 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/testing/sample"
+)
+
+func TestReadmeExtensions(t *testing.T) {
+	ctx := context.Background()
+	unit := sample.UnitEmpty(sample.PackagePath, sample.ModulePath, sample.VersionString)
+	none := ReadmeOptions{}
+	for _, test := range []struct {
+		name     string
+		opts     ReadmeOptions
+		contents string
+		wantHTML string
+	}{
+		{
+			name:     "table",
+			opts:     DefaultReadmeOptions(),
+			contents: "| a | b |\n|---|:-:|\n| 1 | 2 |",
+			wantHTML: "<table>\n<thead>\n<tr>\n<th>a</th>\n<th align=\"center\">b</th>\n</tr>\n</thead>\n" +
+				"<tbody>\n<tr>\n<td>1</td>\n<td align=\"center\">2</td>\n</tr>\n</tbody>\n</table>",
+		},
+		{
+			name:     "table disabled",
+			opts:     none,
+			contents: "| a |\n|---|\n| 1 |",
+			wantHTML: "<p>| a |\n|---|\n| 1 |</p>",
+		},
+		{
+			name:     "strikethrough",
+			opts:     DefaultReadmeOptions(),
+			contents: "~~gone~~",
+			wantHTML: "<p><del>gone</del></p>",
+		},
+		{
+			name:     "strikethrough disabled",
+			opts:     none,
+			contents: "~~gone~~",
+			wantHTML: "<p>~~gone~~</p>",
+		},
+		{
+			name:     "task list",
+			opts:     DefaultReadmeOptions(),
+			contents: "- [ ] todo\n- [x] done",
+			wantHTML: "<ul>\n<li>☐ todo</li>\n<li>☑ done</li>\n</ul>",
+		},
+		{
+			name:     "task list disabled",
+			opts:     none,
+			contents: "- [ ] todo",
+			wantHTML: "<ul>\n<li>[ ] todo</li>\n</ul>",
+		},
+		{
+			name:     "footnotes",
+			opts:     DefaultReadmeOptions(),
+			contents: "Text[^a] and[^B], again[^a].\n\n[^a]: First *note*.\n[^b]: Second note.",
+			wantHTML: `<p>Text<sup><a href="#readme-fn_1" id="readme-fnref_1" rel="nofollow">1</a></sup>` +
+				` and<sup><a href="#readme-fn_2" id="readme-fnref_2" rel="nofollow">2</a></sup>` +
+				`, again<sup><a href="#readme-fn_1" rel="nofollow">1</a></sup>.</p>` + "\n" +
+				"<section>\n<hr/>\n<ol>\n" +
+				`<li id="readme-fn_1">` + "\n" +
+				`<p>First <em>note</em>. <a href="#readme-fnref_1" title="Back to reference 1" rel="nofollow">↩</a></p>` + "\n" +
+				"</li>\n" +
+				`<li id="readme-fn_2">` + "\n" +
+				`<p>Second note. <a href="#readme-fnref_2" title="Back to reference 2" rel="nofollow">↩</a></p>` + "\n" +
+				"</li>\n</ol>\n</section>",
+		},
+		{
+			name:     "footnotes disabled",
+			opts:     none,
+			contents: "Text[^a].\n\n[^a]: Note.",
+			// Without the extension, the definition is a link reference
+			// definition.
+			wantHTML: `<p>Text<a href="https://github.com/valid/module_name/blob/v1.0.0/Note." rel="nofollow">^a</a>.</p>`,
+		},
+		{
+			name:     "footnote content is sanitized",
+			opts:     DefaultReadmeOptions(),
+			contents: "Text[^a].\n\n[^a]: Click [x](javascript:alert(1))<b onclick=alert(1)>!</b>",
+			wantHTML: `<p>Text<sup><a href="#readme-fn_1" id="readme-fnref_1" rel="nofollow">1</a></sup>.</p>` + "\n" +
+				"<section>\n<hr/>\n<ol>\n" +
+				`<li id="readme-fn_1">` + "\n" +
+				`<p>Click x<b>!</b> <a href="#readme-fnref_1" title="Back to reference 1" rel="nofollow">↩</a></p>` + "\n" +
+				"</li>\n</ol>\n</section>",
+		},
+		{
+			name:     "diagram",
+			opts:     DefaultReadmeOptions(),
+			contents: "```mermaid\ngraph TD\n  A-->B\n```",
+			wantHTML: `<details class="readme-diagram readme-diagram-mermaid"><summary>Diagram source (mermaid)</summary>` +
+				"<pre><code>graph TD\n  A--&gt;B\n</code></pre></details>",
+		},
+		{
+			name:     "diagram source is escaped",
+			opts:     DefaultReadmeOptions(),
+			contents: "```Mermaid\n</code></pre></details><script>alert(1)</script>\n```",
+			wantHTML: `<details class="readme-diagram readme-diagram-mermaid"><summary>Diagram source (mermaid)</summary>` +
+				"<pre><code>&lt;/code&gt;&lt;/pre&gt;&lt;/details&gt;&lt;script&gt;alert(1)&lt;/script&gt;\n</code></pre></details>",
+		},
+		{
+			name:     "diagram in a list",
+			opts:     ReadmeOptions{DiagramLanguages: []string{"d2"}},
+			contents: "- item\n\n  ```d2\n  a -> b\n  ```",
+			wantHTML: "<ul>\n<li>\n<p>item</p>\n" +
+				`<details class="readme-diagram readme-diagram-d2"><summary>Diagram source (d2)</summary>` +
+				"<pre><code>a -&gt; b\n</code></pre></details>\n</li>\n</ul>",
+		},
+		{
+			name:     "diagram language not configured",
+			opts:     none,
+			contents: "```mermaid\ngraph TD\n```",
+			wantHTML: "<pre><code>graph TD\n</code></pre>",
+		},
+		{
+			name:     "author markup cannot claim other classes",
+			opts:     DefaultReadmeOptions(),
+			contents: `<details class="js-expandAll readme-diagram"><summary>s</summary></details>`,
+			wantHTML: `<details><summary>s</summary></details>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			readme := &internal.Readme{Filepath: "README.md", Contents: test.contents}
+			got, err := processReadme(ctx, readme, unit.SourceInfo, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.wantHTML, strings.TrimSpace(got.HTML.String())); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExpandFootnotes(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "no definitions",
+			in:   "Text[^a].",
+			want: "Text[^a].",
+		},
+		{
+			name: "undefined and unreferenced",
+			in:   "Text[^a].\n\n[^b]: Note.",
+			want: "Text[^a].\n",
+		},
+		{
+			name: "code is left alone",
+			in:   "`[^a]` and[^a]\n\n```\n[^a]\n```\n\n[^a]: Note.",
+			want: "`[^a]` and" + `<sup><a href="#readme-fn_1" id="readme-fnref_1">1</a></sup>` + "\n\n```\n[^a]\n```\n\n" +
+				"\n<section>\n<hr>\n<ol>\n" + `<li id="readme-fn_1">` + "\n\n" +
+				`Note. <a href="#readme-fnref_1" title="Back to reference 1">&#x21a9;</a>` + "\n\n</li>\n</ol>\n</section>",
+		},
+		{
+			name: "definition in code is not a definition",
+			in:   "Text[^a].\n\n```\n[^a]: Note.\n```",
+			want: "Text[^a].\n\n```\n[^a]: Note.\n```",
+		},
+		{
+			name: "continuation lines and code in a note",
+			in:   "Text[^a].\n\n[^a]: First.\n\n    Second.\n\n    ```\n    code\n    ```\nAfter.",
+			want: "Text" + `<sup><a href="#readme-fn_1" id="readme-fnref_1">1</a></sup>` + ".\n\nAfter.\n\n" +
+				"<section>\n<hr>\n<ol>\n" + `<li id="readme-fn_1">` + "\n\n" +
+				"First.\n\nSecond.\n\n```\ncode\n```\n\n" +
+				`<a href="#readme-fnref_1" title="Back to reference 1">&#x21a9;</a>` + "\n\n</li>\n</ol>\n</section>",
+		},
+		{
+			name: "notes referring to notes",
+			in:   "Text[^a].\n\n[^a]: See[^b].\n[^b]: Note.",
+			want: "Text" + `<sup><a href="#readme-fn_1" id="readme-fnref_1">1</a></sup>` + ".\n\n\n" +
+				"<section>\n<hr>\n<ol>\n" + `<li id="readme-fn_1">` + "\n\n" +
+				"See" + `<sup><a href="#readme-fn_2" id="readme-fnref_2">2</a></sup>` + ". " +
+				`<a href="#readme-fnref_1" title="Back to reference 1">&#x21a9;</a>` + "\n\n</li>\n" +
+				`<li id="readme-fn_2">` + "\n\n" +
+				`Note. <a href="#readme-fnref_2" title="Back to reference 2">&#x21a9;</a>` + "\n\n</li>\n</ol>\n</section>",
+		},
+		{
+			name: "unclosed code block",
+			in:   "Text[^a].\n\n[^a]: Note.\n\n```\ncode",
+			want: "Text" + `<sup><a href="#readme-fn_1" id="readme-fnref_1">1</a></sup>` + ".\n\n\n```\ncode\n```\n\n" +
+				"<section>\n<hr>\n<ol>\n" + `<li id="readme-fn_1">` + "\n\n" +
+				`Note. <a href="#readme-fnref_1" title="Back to reference 1">&#x21a9;</a>` + "\n\n</li>\n</ol>\n</section>",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, expandFootnotes(test.in)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
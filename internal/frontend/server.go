@@ -45,6 +45,7 @@ type Server struct {
 	getDataSource         func(context.Context) internal.DataSource
 	queue                 queue.Queue
 	templateFS            template.TrustedFS
+	templateOverrides     []template.TrustedFS
 	staticFS              fs.FS
 	thirdPartyFS          fs.FS
 	devMode               bool
@@ -57,11 +58,17 @@ type Server struct {
 	serveStats            bool
 	reporter              derrors.Reporter
 	fileMux               *http.ServeMux
+	sourceFSs             map[string]fs.FS // by path under /files, for /source
 	vulnClient            *vuln.Client
 	versionID             string
 	instanceID            string
 	HTTPClient            *http.Client
 	recordCodeWikiMetrics RecordClickFunc
+	site                  pagepkg.SiteData
+	build                 pagepkg.BuildData
+	readmeOptions         ReadmeOptions
+	symbolIndexPageSize   int
+	glanceThreshold       int
 
 	mu        sync.Mutex // Protects all fields below
 	templates map[string]*template.Template
@@ -89,9 +96,10 @@ type ServerConfig struct {
 	// It should be goroutine-safe.
 	DataSourceGetter      func(context.Context) internal.DataSource
 	Queue                 queue.Queue
-	TemplateFS            template.TrustedFS // for loading templates safely
-	StaticFS              fs.FS              // for static/ directory
-	ThirdPartyFS          fs.FS              // for third_party/ directory
+	TemplateFS            template.TrustedFS   // for loading templates safely
+	TemplateOverrides     []template.TrustedFS // parsed after TemplateFS; see templates.ParsePageTemplates
+	StaticFS              fs.FS                // for static/ directory
+	ThirdPartyFS          fs.FS                // for third_party/ directory
 	DevMode               bool
 	LocalMode             bool
 	GoDocMode             bool
@@ -100,12 +108,24 @@ type ServerConfig struct {
 	VulndbClient          *vuln.Client
 	HTTPClient            *http.Client
 	RecordCodeWikiMetrics RecordClickFunc
+	// Site and Build are passed to every page template.
+	Site  pagepkg.SiteData
+	Build pagepkg.BuildData
+	// ReadmeOptions selects the Markdown extensions used to render READMEs.
+	// If nil, DefaultReadmeOptions is used.
+	ReadmeOptions *ReadmeOptions
+	// SymbolIndexPageSize, if positive, gives modules an index tab listing
+	// the exported symbols of their packages, this many a page.
+	SymbolIndexPageSize int
+	// GlanceThreshold, if positive, gives the documentation of packages
+	// with more symbols than it an "At a glance" section.
+	GlanceThreshold int
 }
 
 // NewServer creates a new Server for the given database and template directory.
 func NewServer(scfg ServerConfig) (_ *Server, err error) {
 	defer derrors.Wrap(&err, "NewServer(...)")
-	ts, err := templates.ParsePageTemplates(scfg.TemplateFS)
+	ts, err := templates.ParsePageTemplates(scfg.TemplateFS, scfg.TemplateOverrides...)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing templates: %v", err)
 	}
@@ -115,6 +135,7 @@ func NewServer(scfg ServerConfig) (_ *Server, err error) {
 		getDataSource:         scfg.DataSourceGetter,
 		queue:                 scfg.Queue,
 		templateFS:            scfg.TemplateFS,
+		templateOverrides:     scfg.TemplateOverrides,
 		staticFS:              scfg.StaticFS,
 		thirdPartyFS:          scfg.ThirdPartyFS,
 		devMode:               scfg.DevMode,
@@ -124,9 +145,21 @@ func NewServer(scfg ServerConfig) (_ *Server, err error) {
 		templates:             ts,
 		reporter:              scfg.Reporter,
 		fileMux:               http.NewServeMux(),
+		sourceFSs:             map[string]fs.FS{},
 		vulnClient:            scfg.VulndbClient,
 		HTTPClient:            scfg.HTTPClient,
 		recordCodeWikiMetrics: scfg.RecordCodeWikiMetrics,
+		site:                  scfg.Site,
+		build:                 scfg.Build,
+		readmeOptions:         DefaultReadmeOptions(),
+		symbolIndexPageSize:   scfg.SymbolIndexPageSize,
+		glanceThreshold:       scfg.GlanceThreshold,
+	}
+	if scfg.ReadmeOptions != nil {
+		s.readmeOptions = *scfg.ReadmeOptions
+	}
+	if s.site.BasePath == "" {
+		s.site.BasePath = "/"
 	}
 	if s.HTTPClient == nil {
 		s.HTTPClient = http.DefaultClient
@@ -234,6 +267,7 @@ func (s *Server) Install(handle func(string, http.Handler), cacher Cacher, authV
 	handle("GET /codewiki", http.HandlerFunc(s.handleCodeWikiRedirect))
 	handle("GET /golang.org/x", s.staticPageHandler("subrepo", "Sub-repositories"))
 	handle("GET /files/", http.StripPrefix("/files", s.fileMux))
+	handle("GET /source/", http.HandlerFunc(s.sourceHandler))
 	handle("GET /vuln/", vulnHandler)
 	handle("/opensearch.xml", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		serveFileFS(w, r, s.staticFS, "shared/opensearch.xml")
@@ -334,8 +368,10 @@ func (s *Server) installDebugHandlers(handle func(string, http.Handler)) {
 }
 
 // InstallFS adds path under the /files handler, serving the files in fsys.
+// The files are also shown with line numbers under the /source handler.
 func (s *Server) InstallFS(path string, fsys fs.FS) {
 	s.fileMux.Handle("GET "+path+"/", http.StripPrefix(path, http.FileServer(http.FS(fsys))))
+	s.sourceFSs[path] = fsys
 }
 
 const (
@@ -504,6 +540,8 @@ func (s *Server) newBasePage(r *http.Request, title string) pagepkg.BasePage {
 		// indicates that we should use heuristics to determine whether the
 		// user wants to search for symbols or packages.
 		SearchMode: "",
+		Site:       s.site,
+		Build:      s.build,
 	}
 }
 
@@ -535,6 +573,11 @@ func (s *Server) errorHandler(f func(w http.ResponseWriter, r *http.Request, ds
 	}
 }
 
+// ServeNotFound serves the error page for a path with nothing at it.
+func (s *Server) ServeNotFound(w http.ResponseWriter, r *http.Request) {
+	s.serveError(w, r, &serrors.ServerError{Status: http.StatusNotFound})
+}
+
 func (s *Server) serveError(w http.ResponseWriter, r *http.Request, err error) {
 	ctx := r.Context()
 	var serr *serrors.ServerError
@@ -669,7 +712,7 @@ func (s *Server) findTemplate(templateName string) (*template.Template, error) {
 		s.mu.Lock()
 		defer s.mu.Unlock()
 		var err error
-		s.templates, err = templates.ParsePageTemplates(s.templateFS)
+		s.templates, err = templates.ParsePageTemplates(s.templateFS, s.templateOverrides...)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing templates: %v", err)
 		}
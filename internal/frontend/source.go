@@ -0,0 +1,119 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/uncheckedconversions"
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend/page"
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend/serrors"
+	"github.com/wow-look-at-my/static-pkgsite/internal/goembed"
+)
+
+// SourcePage shows a source file installed with InstallFS, with a line
+// anchor for each line.
+type SourcePage struct {
+	page.BasePage
+	// Name is the name of the file, such as "http.go".
+	Name string
+	// Path is the path of the file under the /files handler, such as
+	// "/files/home/u/m/example.com/m/http.go".
+	Path string
+	// Lines are the lines of the file.
+	Lines []SourceLine
+	// Embedded reports whether the file is embedded in a package by a
+	// //go:embed directive. Its contents, which can be large, are not read,
+	// and Size is its size in bytes.
+	Embedded bool
+	Size     int64
+}
+
+// A SourceLine is a line of a source file.
+type SourceLine struct {
+	Number int
+	ID     safehtml.Identifier // "L" and the number, as in source.FilesInfo
+	Text   string
+}
+
+// sourceHandler serves the page of the file at /source/<path>, whose
+// contents are served at /files/<path>.
+func (s *Server) sourceHandler(w http.ResponseWriter, r *http.Request) {
+	filePath := strings.TrimPrefix(r.URL.Path, "/source")
+	notFound := &serrors.ServerError{Status: http.StatusNotFound}
+	fsys, name, ok := s.sourceFile(filePath)
+	if !ok {
+		s.serveError(w, r, notFound)
+		return
+	}
+	page := SourcePage{
+		BasePage: s.newBasePage(r, path.Base(filePath)),
+		Name:     path.Base(filePath),
+		Path:     "/files" + filePath,
+	}
+	if _, ok := goembed.EmbeddingDir(fsys, name); ok {
+		fi, err := fs.Stat(fsys, name)
+		if err != nil || !fi.Mode().IsRegular() {
+			s.serveError(w, r, notFound)
+			return
+		}
+		page.Embedded = true
+		page.Size = fi.Size()
+	} else {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil || !utf8.Valid(data) {
+			s.serveError(w, r, notFound)
+			return
+		}
+		page.Lines = sourceLines(data)
+	}
+	page.AllowWideContent = true
+	s.servePage(r.Context(), w, "source", page)
+}
+
+// sourceFile returns the installed FS holding the file at filePath under
+// the /files handler, and the name of the file in it. The file is looked up
+// in the longest installed path that contains it.
+func (s *Server) sourceFile(filePath string) (fs.FS, string, bool) {
+	prefix := ""
+	for p := range s.sourceFSs {
+		if strings.HasPrefix(filePath, p+"/") && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	fsys, ok := s.sourceFSs[prefix]
+	if !ok {
+		return nil, "", false
+	}
+	name := strings.TrimPrefix(filePath, prefix+"/")
+	if !fs.ValidPath(name) {
+		return nil, "", false
+	}
+	return fsys, name, true
+}
+
+// sourceLines returns the lines of a source file, numbered from 1.
+func sourceLines(data []byte) []SourceLine {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	var lines []SourceLine
+	for i, l := range strings.Split(text, "\n") {
+		lines = append(lines, SourceLine{
+			Number: i + 1,
+			// An L followed by digits is a valid identifier.
+			ID:   uncheckedconversions.IdentifierFromStringKnownToSatisfyTypeContract(fmt.Sprintf("L%d", i+1)),
+			Text: strings.TrimSuffix(l, "\r"),
+		})
+	}
+	return lines
+}
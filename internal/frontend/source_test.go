@@ -0,0 +1,104 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSourceHandler(t *testing.T) {
+	s, handler := newTestServer(t, nil)
+	s.InstallFS("/home/u/m", fstest.MapFS{
+		"example.com/m/m.go":     {Data: []byte("package m\n\n// F returns <b>.\nfunc F() string { return \"<b>\" }\n")},
+		"example.com/m/a.bin":    {Data: []byte{0xff, 0xfe}},
+		"example.com/m/e.go":     {Data: []byte("package m\n\nimport _ \"embed\"\n\n//go:embed data.txt\nvar Data string\n")},
+		"example.com/m/data.txt": {Data: []byte("the embedded data\n")},
+	})
+	s.InstallFS("/home/u/m/example.com/m/sub", fstest.MapFS{
+		"sub.go": {Data: []byte("package sub\n")},
+	})
+
+	for _, test := range []struct {
+		urlPath    string
+		wantStatus int
+		want       []string
+		dontWant   []string
+	}{
+		{
+			urlPath:    "/source/home/u/m/example.com/m/m.go",
+			wantStatus: http.StatusOK,
+			want: []string{
+				`<meta name="robots" content="noindex">`,
+				`<h1 data-test-id="source-heading">m.go</h1>`,
+				`<a href="/files/home/u/m/example.com/m/m.go" data-test-id="source-raw">View raw</a>`,
+				`<tr class="Source-line" id="L1"><td class="Source-number"><a href="#L1">1</a></td><td class="Source-text">package m</td></tr>`,
+				`<tr class="Source-line" id="L4"><td class="Source-number"><a href="#L4">4</a></td><td class="Source-text">func F() string { return &#34;&lt;b&gt;&#34; }</td></tr>`,
+			},
+		},
+		// The longest installed path holding the file is used.
+		{
+			urlPath:    "/source/home/u/m/example.com/m/sub/sub.go",
+			wantStatus: http.StatusOK,
+			want:       []string{`<td class="Source-text">package sub</td>`},
+		},
+		// The contents of an embedded file are not shown.
+		{
+			urlPath:    "/source/home/u/m/example.com/m/data.txt",
+			wantStatus: http.StatusOK,
+			want:       []string{`<p data-test-id="source-embedded">`, `Its contents, 18 bytes, are not shown.`},
+			dontWant:   []string{`the embedded data`},
+		},
+		{urlPath: "/source/home/u/m/example.com/m/missing.go", wantStatus: http.StatusNotFound},
+		{urlPath: "/source/home/u/m/example.com/m", wantStatus: http.StatusNotFound},
+		{urlPath: "/source/home/u/m/example.com/m/a.bin", wantStatus: http.StatusNotFound},
+		{urlPath: "/source/elsewhere/m.go", wantStatus: http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", test.urlPath, nil))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: got status %d, want %d", test.urlPath, w.Code, test.wantStatus)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("%s: page does not contain %s", test.urlPath, want)
+			}
+		}
+		for _, dontWant := range test.dontWant {
+			if strings.Contains(w.Body.String(), dontWant) {
+				t.Errorf("%s: page contains %s", test.urlPath, dontWant)
+			}
+		}
+	}
+}
+
+func TestSourceLines(t *testing.T) {
+	type sourceLine struct {
+		Number   int
+		ID, Text string
+	}
+	for _, test := range []struct {
+		in   string
+		want []sourceLine
+	}{
+		{"", nil},
+		{"a\n", []sourceLine{{1, "L1", "a"}}},
+		{"a\r\n\nb", []sourceLine{{1, "L1", "a"}, {2, "L2", ""}, {3, "L3", "b"}}},
+	} {
+		var got []sourceLine
+		for _, l := range sourceLines([]byte(test.in)) {
+			got = append(got, sourceLine{l.Number, l.ID.String(), l.Text})
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("sourceLines(%q) mismatch (-want +got):\n%s", test.in, diff)
+		}
+	}
+}
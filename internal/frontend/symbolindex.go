@@ -0,0 +1,157 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"go/doc"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/derrors"
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend/serrors"
+	"github.com/wow-look-at-my/static-pkgsite/internal/frontend/versions"
+	"github.com/wow-look-at-my/static-pkgsite/internal/godoc"
+)
+
+// SymbolIndexDetails lists the exported symbols of the packages of a
+// module, like the index of godoc, one page at a time.
+type SymbolIndexDetails struct {
+	ModulePath string
+	// Packages are the packages with symbols on the page, in order of
+	// their paths. A package whose symbols start on an earlier page is
+	// listed again.
+	Packages   []*SymbolIndexPackage
+	Pagination pagination
+}
+
+// A SymbolIndexPackage is a package of a symbol index.
+type SymbolIndexPackage struct {
+	Path    string
+	URL     string // URL of the package page, at the requested version
+	Symbols []*IndexSymbol
+}
+
+// An IndexSymbol is an exported symbol of a symbol index.
+type IndexSymbol struct {
+	// Name is the name of the symbol, which is also its anchor on the
+	// package page, such as "Client.Do".
+	Name string
+	// Kind is "const", "var", "func", "type" or "method".
+	Kind string
+	// Synopsis is the first sentence of the symbol's doc comment.
+	Synopsis string
+}
+
+// SymbolIndex returns the packages of the module um, with their exported
+// symbols in the order of the package documentation. Packages without
+// exported symbols are left out.
+func SymbolIndex(ctx context.Context, ds internal.DataSource, um *internal.UnitMeta) (_ []*SymbolIndexPackage, err error) {
+	defer derrors.Wrap(&err, "SymbolIndex(%q, %q)", um.ModulePath, um.Version)
+	mod, err := ds.GetUnit(ctx, um, internal.WithMain, internal.BuildContext{})
+	if err != nil {
+		return nil, err
+	}
+	// The subdirectories of a unit may or may not include the unit itself.
+	dirs := mod.Subdirectories
+	if mod.IsPackage() && !slices.ContainsFunc(dirs, func(pm *internal.PackageMeta) bool { return pm.Path == mod.Path }) {
+		dirs = append([]*internal.PackageMeta{{Path: mod.Path, Name: mod.Name}}, dirs...)
+	}
+	var pkgs []*SymbolIndexPackage
+	for _, pm := range dirs {
+		if pm.Name == "main" {
+			continue
+		}
+		u, err := ds.GetUnit(ctx, &internal.UnitMeta{
+			Path:       pm.Path,
+			ModuleInfo: internal.ModuleInfo{ModulePath: um.ModulePath, Version: um.Version},
+		}, internal.WithMain, internal.BuildContext{})
+		if err != nil {
+			return nil, err
+		}
+		if len(u.Documentation) == 0 {
+			continue
+		}
+		_, d, err := godoc.DocPackageFromUnit(u)
+		if err != nil {
+			return nil, err
+		}
+		if syms := indexSymbols(d); len(syms) > 0 {
+			pkgs = append(pkgs, &SymbolIndexPackage{Path: pm.Path, Symbols: syms})
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Path < pkgs[j].Path })
+	return pkgs, nil
+}
+
+// indexSymbols returns the exported symbols of d, in the order of the
+// index of its documentation.
+func indexSymbols(d *doc.Package) []*IndexSymbol {
+	var syms []*IndexSymbol
+	values := func(vs []*doc.Value, kind string) {
+		for _, v := range vs {
+			for _, name := range v.Names {
+				syms = append(syms, &IndexSymbol{Name: name, Kind: kind, Synopsis: d.Synopsis(v.Doc)})
+			}
+		}
+	}
+	funcs := func(fs []*doc.Func, prefix, kind string) {
+		for _, f := range fs {
+			syms = append(syms, &IndexSymbol{Name: prefix + f.Name, Kind: kind, Synopsis: d.Synopsis(f.Doc)})
+		}
+	}
+	values(d.Consts, "const")
+	values(d.Vars, "var")
+	funcs(d.Funcs, "", "func")
+	for _, t := range d.Types {
+		syms = append(syms, &IndexSymbol{Name: t.Name, Kind: "type", Synopsis: d.Synopsis(t.Doc)})
+		values(t.Consts, "const")
+		values(t.Vars, "var")
+		funcs(t.Funcs, "", "func")
+		funcs(t.Methods, t.Name+".", "method")
+	}
+	return syms
+}
+
+// fetchSymbolIndexDetails returns the page of the symbol index of the
+// module um requested by r, with pageSize symbols a page.
+func fetchSymbolIndexDetails(ctx context.Context, r *http.Request, ds internal.DataSource, um *internal.UnitMeta,
+	requestedVersion string, pageSize int) (*SymbolIndexDetails, error) {
+	pkgs, err := SymbolIndex(ctx, ds, um)
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	for _, p := range pkgs {
+		total += len(p.Symbols)
+	}
+	// The page size is fixed; a limit in the request is ignored.
+	params := paginationParams{baseURL: &url.URL{Path: r.URL.Path, RawQuery: r.URL.RawQuery}, page: 1, limit: pageSize}
+	if p := newPaginationParams(r, pageSize).page; p > 1 {
+		if p > numPages(pageSize, total) {
+			return nil, &serrors.ServerError{Status: http.StatusNotFound}
+		}
+		params.page = p
+	}
+	start, end := params.offset(), params.offset()+pageSize
+	details := &SymbolIndexDetails{ModulePath: um.ModulePath}
+	n := 0
+	for _, p := range pkgs {
+		lo, hi := max(start-n, 0), min(end-n, len(p.Symbols))
+		if lo < hi {
+			details.Packages = append(details.Packages, &SymbolIndexPackage{
+				Path:    p.Path,
+				URL:     versions.ConstructUnitURL(p.Path, um.ModulePath, requestedVersion),
+				Symbols: p.Symbols[lo:hi],
+			})
+		}
+		n += len(p.Symbols)
+	}
+	details.Pagination = newPagination(params, min(end, total)-min(start, total), total)
+	return details, nil
+}
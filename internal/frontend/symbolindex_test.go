@@ -0,0 +1,70 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIndexSymbols(t *testing.T) {
+	const src = `// Package p is a package.
+package p
+
+// Group doc. More doc.
+const (
+	A = iota
+	B
+	unexported
+)
+
+// V is a variable.
+var V int
+
+// F is a function.
+func F() {}
+
+// T is a type.
+type T int
+
+// Zero is the zero T.
+const Zero T = 0
+
+// NewT returns a T.
+func NewT() T { return 0 }
+
+// M is a method.
+func (T) M() {}
+
+func (T) m() {}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := doc.NewFromFiles(fset, []*ast.File{f}, "example.com/p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*IndexSymbol{
+		{Name: "A", Kind: "const", Synopsis: "Group doc."},
+		{Name: "B", Kind: "const", Synopsis: "Group doc."},
+		{Name: "V", Kind: "var", Synopsis: "V is a variable."},
+		{Name: "F", Kind: "func", Synopsis: "F is a function."},
+		{Name: "T", Kind: "type", Synopsis: "T is a type."},
+		{Name: "Zero", Kind: "const", Synopsis: "Zero is the zero T."},
+		{Name: "NewT", Kind: "func", Synopsis: "NewT returns a T."},
+		{Name: "T.M", Kind: "method", Synopsis: "M is a method."},
+	}
+	if diff := cmp.Diff(want, indexSymbols(d)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
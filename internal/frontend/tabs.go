@@ -41,6 +41,9 @@ const (
 	tabImports    = "imports"
 	tabImportedBy = "importedby"
 	tabLicenses   = "licenses"
+	// tabSymbolIndex lists the exported symbols of the packages of a
+	// module. It is served only if the symbol index is enabled.
+	tabSymbolIndex = "index"
 )
 
 var (
@@ -65,6 +68,10 @@ var (
 			Name:         tabLicenses,
 			TemplateName: "unit/licenses",
 		},
+		{
+			Name:         tabSymbolIndex,
+			TemplateName: "unit/index",
+		},
 	}
 	unitTabLookup = make(map[string]TabSettings, len(unitTabs))
 )
@@ -79,12 +86,12 @@ func init() {
 // handler.
 func fetchDetailsForUnit(ctx context.Context, r *http.Request, tab string, ds internal.DataSource, um *internal.UnitMeta,
 	requestedVersion string, bc internal.BuildContext,
-	vc *vuln.Client) (_ any, err error) {
+	vc *vuln.Client, ro ReadmeOptions, symbolIndexSize, glanceThreshold int) (_ any, err error) {
 	defer derrors.Wrap(&err, "fetchDetailsForUnit(r, %q, ds, um=%q,%q,%q)", tab, um.Path, um.ModulePath, um.Version)
 	switch tab {
 	case tabMain:
 		_, expandReadme := r.URL.Query()["readme"]
-		return fetchMainDetails(ctx, ds, um, requestedVersion, expandReadme, bc)
+		return fetchMainDetails(ctx, ds, um, requestedVersion, expandReadme, bc, ro, glanceThreshold)
 	case tabVersions:
 		return versions.FetchVersionsDetails(ctx, ds, um, vc)
 	case tabImports:
@@ -93,6 +100,8 @@ func fetchDetailsForUnit(ctx context.Context, r *http.Request, tab string, ds in
 		return fetchImportedByDetails(ctx, ds, um.Path, um.ModulePath)
 	case tabLicenses:
 		return fetchLicensesDetails(ctx, ds, um)
+	case tabSymbolIndex:
+		return fetchSymbolIndexDetails(ctx, r, ds, um, requestedVersion, symbolIndexSize)
 	}
 	return nil, fmt.Errorf("BUG: unable to fetch details: unknown tab %q", tab)
 }
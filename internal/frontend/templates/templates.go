@@ -47,7 +47,11 @@ func stripScheme(url string) string {
 //
 // Templates in directories prefixed with an underscore are considered helper
 // templates and parsed together with the files in each base directory.
-func ParsePageTemplates(fsys template.TrustedFS) (map[string]*template.Template, error) {
+//
+// The *.tmpl files at the root of each override filesystem are parsed last
+// into every page template, so that their {{define}} blocks replace the
+// built-in definitions of the same name.
+func ParsePageTemplates(fsys template.TrustedFS, overrides ...template.TrustedFS) (map[string]*template.Template, error) {
 	templates := make(map[string]*template.Template)
 	htmlSets := [][]string{
 		{"about"},
@@ -58,8 +62,10 @@ func ParsePageTemplates(fsys template.TrustedFS) (map[string]*template.Template,
 		{"license-policy"},
 		{"search"},
 		{"search-help"},
+		{"source"},
 		{"subrepo"},
 		{"unit/importedby", "unit"},
+		{"unit/index", "unit"},
 		{"unit/imports", "unit"},
 		{"unit/licenses", "unit"},
 		{"unit/main", "unit"},
@@ -84,6 +90,11 @@ func ParsePageTemplates(fsys template.TrustedFS) (map[string]*template.Template,
 				return nil, fmt.Errorf("ParseFS(%v): %v", f, err)
 			}
 		}
+		for _, o := range overrides {
+			if _, err := t.ParseFS(o, "*.tmpl"); err != nil {
+				return nil, fmt.Errorf("ParseFS(overrides): %v", err)
+			}
+		}
 		templates[set[0]] = t
 	}
 
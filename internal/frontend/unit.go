@@ -112,6 +112,10 @@ type UnitPage struct {
 	// IsGoProject is true if the package is from the standard library or a
 	// golang.org sub-repository.
 	IsGoProject bool
+
+	// HasSymbolIndex is true if the unit is a module with a symbol index
+	// tab.
+	HasSymbolIndex bool
 }
 
 // serveUnitPage serves a unit page for a path.
@@ -126,7 +130,7 @@ func (s *Server) serveUnitPage(ctx context.Context, w http.ResponseWriter, r *ht
 		tab = tabMain
 	}
 	// Redirect to clean URL path when tab param is invalid.
-	if _, ok := unitTabLookup[tab]; !ok || (s.goDocMode && tab != tabMain) {
+	if _, ok := unitTabLookup[tab]; !ok || (s.goDocMode && tab != tabMain) || (tab == tabSymbolIndex && s.symbolIndexPageSize <= 0) {
 		http.Redirect(w, r, r.URL.Path, http.StatusFound)
 		return nil
 	}
@@ -156,7 +160,7 @@ func (s *Server) serveUnitPage(ctx context.Context, w http.ResponseWriter, r *ht
 	// It's also okay to provide just one (e.g. GOOS=windows), which will select
 	// the first doc with that value, ignoring the other one.
 	bc := internal.BuildContext{GOOS: r.FormValue("GOOS"), GOARCH: r.FormValue("GOARCH")}
-	d, err := fetchDetailsForUnit(ctx, r, tab, ds, um, info.RequestedVersion, bc, s.vulnClient)
+	d, err := fetchDetailsForUnit(ctx, r, tab, ds, um, info.RequestedVersion, bc, s.vulnClient, s.readmeOptions, s.symbolIndexPageSize, s.glanceThreshold)
 	if err != nil {
 		return err
 	}
@@ -217,6 +221,11 @@ func (s *Server) serveUnitPage(ctx context.Context, w http.ResponseWriter, r *ht
 	basePage := s.newBasePage(r, title)
 	tabSettings := unitTabLookup[tab]
 	basePage.AllowWideContent = true
+	basePage.Page = page.PageData{
+		UnitPath:   um.Path,
+		ModulePath: um.ModulePath,
+		Version:    um.Version,
+	}
 	if tabSettings.Name == "" {
 		basePage.UseResponsiveLayout = true
 	}
@@ -240,6 +249,7 @@ func (s *Server) serveUnitPage(ctx context.Context, w http.ResponseWriter, r *ht
 		IsGoProject:           isGoProject(um.ModulePath),
 		IsLatestMinor:         lv == latestInfo.MinorVersion,
 		GoDocMode:             s.goDocMode,
+		HasSymbolIndex:        s.symbolIndexPageSize > 0 && um.Path == um.ModulePath,
 	}
 
 	if !s.goDocMode {
@@ -258,6 +268,7 @@ func (s *Server) serveUnitPage(ctx context.Context, w http.ResponseWriter, r *ht
 	main, ok := d.(*MainDetails)
 	if ok {
 		page.MetaDescription = metaDescription(main.DocSynopsis)
+		page.Page.Synopsis = main.DocSynopsis
 	}
 
 	if !s.goDocMode {
@@ -326,6 +337,9 @@ func isValidTabForUnit(tab string, um *internal.UnitMeta, details any) bool {
 	if !um.IsPackage() && (tab == tabImports || tab == tabImportedBy) {
 		return false
 	}
+	if tab == tabSymbolIndex && um.Path != um.ModulePath {
+		return false
+	}
 	return true
 }
 
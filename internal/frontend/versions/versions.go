@@ -6,6 +6,7 @@ package versions
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path"
 	"sort"
@@ -15,6 +16,7 @@ import (
 
 	"golang.org/x/mod/semver"
 	"github.com/wow-look-at-my/static-pkgsite/internal"
+	"github.com/wow-look-at-my/static-pkgsite/internal/derrors"
 	"github.com/wow-look-at-my/static-pkgsite/internal/fetch"
 	"github.com/wow-look-at-my/static-pkgsite/internal/frontend/serrors"
 	"github.com/wow-look-at-my/static-pkgsite/internal/log"
@@ -88,12 +90,15 @@ type VersionSummary struct {
 }
 
 func FetchVersionsDetails(ctx context.Context, ds internal.DataSource, um *internal.UnitMeta, vc *vuln.Client) (*VersionsDetails, error) {
-	db, ok := ds.(internal.PostgresDB)
+	db, ok := ds.(internal.VersionsDataSource)
 	if !ok {
-		// The proxydatasource does not support the imported by page.
+		// The proxydatasource does not support the versions page.
 		return nil, serrors.DatasourceNotSupportedError()
 	}
 	versions, err := db.GetVersionsForPath(ctx, um.Path)
+	if errors.Is(err, derrors.Unsupported) {
+		return nil, serrors.DatasourceNotSupportedError()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +67,10 @@ type RenderOptions struct {
 	ModInfo      *ModuleInfo
 	Limit        int64 // If zero, a default limit of 10 megabytes is used.
 	BuildContext internal.BuildContext
+	// GlanceThreshold, if positive, gives the documentation of packages
+	// with more symbols than it an "At a glance" section, a dense index
+	// of the symbols grouped by type.
+	GlanceThreshold int
 }
 
 // TemplateData holds the data passed to the HTML templates in this package.
@@ -76,6 +80,7 @@ type TemplateData struct {
 	Consts, Vars, Funcs, Types []*item
 	Examples                   *examples
 	NoteHeaders                map[string]noteHeader
+	Glance                     *glance // nil if the package has no "At a glance" section
 }
 
 // Parts contains HTML for each part of the documentation.
@@ -316,6 +321,7 @@ func renderInfo(ctx context.Context, fset *token.FileSet, p *doc.Package, opt Re
 		RootURL:     "/pkg",
 		Examples:    examples,
 		NoteHeaders: buildNoteHeaders(p.Notes),
+		Glance:      newGlance(p, opt.GlanceThreshold),
 	}
 	data.Consts, data.Vars, data.Funcs, data.Types = packageToItems(p, examples.Map)
 	return funcs, data, r.Links
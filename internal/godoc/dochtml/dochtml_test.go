@@ -23,6 +23,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/safehtml"
 	"github.com/google/safehtml/template"
 	"golang.org/x/net/html"
 	"github.com/wow-look-at-my/static-pkgsite/internal/godoc/dochtml/internal/render"
@@ -92,6 +93,34 @@ func TestRenderDeprecated(t *testing.T) {
 	compareWithGolden(t, parts, "deprecated-on", *update)
 }
 
+func TestRenderGlance(t *testing.T) {
+	LoadTemplates(templateFS)
+	fset, d := mustLoadPackageWithMode("glance", 0)
+	opts := testRenderOptions
+	opts.GlanceThreshold = 20 // the package has 21 exported symbols
+	parts, err := Render(context.Background(), fset, d, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareWithGolden(t, parts, "glance", *update)
+	bodyDoc, err := html.Parse(strings.NewReader(parts.Body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDuplicateIDs(t, bodyDoc)
+
+	opts.GlanceThreshold = 21
+	parts, err = Render(context.Background(), fset, d, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []safehtml.HTML{parts.Body, parts.Outline, parts.MobileOutline} {
+		if strings.Contains(part.String(), "pkg-glance") {
+			t.Errorf("a package with as many symbols as the threshold has an At a glance section:\n%s", part)
+		}
+	}
+}
+
 func compareWithGolden(t *testing.T, parts *Parts, name string, update bool) {
 	got := fmt.Sprintf("%s\n----\n%s\n----\n%s\n", parts.Body, parts.Outline, parts.MobileOutline)
 	// Remove blank lines and whitespace around lines.
@@ -563,6 +592,13 @@ func attr(n *html.Node, key string) string {
 
 // Copied from internal/render/render_test.go, with the slight modification of returning the fset.
 func mustLoadPackage(path string) (*token.FileSet, *doc.Package) {
+	return mustLoadPackageWithMode(path, doc.AllDecls)
+}
+
+// mustLoadPackageWithMode is like mustLoadPackage, but computes the
+// documentation with mode, as godoc does for packages other than builtin
+// with mode 0.
+func mustLoadPackageWithMode(path string, mode doc.Mode) (*token.FileSet, *doc.Package) {
 	srcName := filepath.Base(path) + ".go"
 	code, err := os.ReadFile(filepath.Join("testdata", srcName))
 	if err != nil {
@@ -581,7 +617,7 @@ func mustLoadPackage(path string) (*token.FileSet, *doc.Package) {
 	//lint:ignore SA1019 We had a preexisting dependency on ast.Object.
 	ast.NewPackage(fset, filesMap, importer.SimpleImporter, nil)
 
-	astPackage, err := doc.NewFromFiles(fset, files, path, doc.AllDecls)
+	astPackage, err := doc.NewFromFiles(fset, files, path, mode)
 	if err != nil {
 		panic(err)
 	}
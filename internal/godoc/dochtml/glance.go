@@ -0,0 +1,144 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dochtml
+
+import (
+	"go/ast"
+	"go/doc"
+	"slices"
+
+	"github.com/wow-look-at-my/static-pkgsite/internal/natural"
+)
+
+// A glance is the data of the "At a glance" section of the documentation
+// of a large package: a dense index of its documented symbols, grouped the
+// way its documentation groups them. Constants and variables are grouped
+// by the declarations the package author wrote them in, and the functions
+// returning a type, which go/doc associates with it, are listed with the
+// type as its constructors.
+type glance struct {
+	Symbols      int            // number of documented symbols of the package
+	Consts, Vars [][]glanceName // the names of each declaration
+	Funcs        []glanceName   // functions not associated with a type
+	Types        []*glanceType
+}
+
+// A glanceName is a symbol listed in a glance.
+type glanceName struct {
+	Name         string
+	ID           string // id of the symbol's anchor in the documentation
+	IsDeprecated bool
+}
+
+// A glanceType is a type listed in a glance.
+type glanceType struct {
+	glanceName
+	Kind         string       // "struct", "interface", or "" for other types
+	Constructors []glanceName // functions returning the type
+	// Methods is the number of methods of the type. For an interface,
+	// they are the methods it declares, not counting those of the
+	// interfaces it embeds.
+	Methods int
+	// Values is the number of constants and variables of the type.
+	Values int
+}
+
+// newGlance returns the glance of the package p, or nil if p documents no
+// more than threshold symbols or threshold is not positive.
+func newGlance(p *doc.Package, threshold int) *glance {
+	if threshold <= 0 {
+		return nil
+	}
+	g := &glance{
+		Consts: valueGroups(p.Consts),
+		Vars:   valueGroups(p.Vars),
+		Funcs:  funcNames(p.Funcs),
+	}
+	for _, c := range g.Consts {
+		g.Symbols += len(c)
+	}
+	for _, v := range g.Vars {
+		g.Symbols += len(v)
+	}
+	g.Symbols += len(g.Funcs)
+	for _, t := range p.Types {
+		gt := &glanceType{
+			glanceName:   glanceName{Name: t.Name, ID: t.Name, IsDeprecated: typeIsDeprecated(t)},
+			Constructors: funcNames(t.Funcs),
+			Methods:      len(t.Methods),
+		}
+		for _, v := range slices.Concat(t.Consts, t.Vars) {
+			gt.Values += len(v.Names)
+		}
+		if len(t.Decl.Specs) > 0 {
+			if spec, ok := t.Decl.Specs[0].(*ast.TypeSpec); ok {
+				switch typ := spec.Type.(type) {
+				case *ast.StructType:
+					gt.Kind = "struct"
+				case *ast.InterfaceType:
+					gt.Kind = "interface"
+					gt.Methods += interfaceMethods(typ)
+				}
+			}
+		}
+		g.Types = append(g.Types, gt)
+		g.Symbols += 1 + len(gt.Constructors) + gt.Methods + gt.Values
+	}
+	if g.Symbols <= threshold {
+		return nil
+	}
+	slices.SortFunc(g.Funcs, compareGlanceNames)
+	slices.SortFunc(g.Types, func(a, b *glanceType) int { return compareGlanceNames(a.glanceName, b.glanceName) })
+	for _, t := range g.Types {
+		slices.SortFunc(t.Constructors, compareGlanceNames)
+	}
+	return g
+}
+
+// valueGroups returns the names of the constants or variables of each
+// declaration of vs, in source order.
+func valueGroups(vs []*doc.Value) [][]glanceName {
+	var groups [][]glanceName
+	for _, v := range vs {
+		var names []glanceName
+		for _, name := range v.Names {
+			if name != "_" {
+				names = append(names, glanceName{Name: name, ID: name, IsDeprecated: valueIsDeprecated(v)})
+			}
+		}
+		if len(names) > 0 {
+			groups = append(groups, names)
+		}
+	}
+	return groups
+}
+
+// funcNames returns the names of the functions fs.
+func funcNames(fs []*doc.Func) []glanceName {
+	var names []glanceName
+	for _, f := range fs {
+		names = append(names, glanceName{Name: f.Name, ID: f.Name, IsDeprecated: funcIsDeprecated(f)})
+	}
+	return names
+}
+
+// interfaceMethods returns the number of methods that the interface type
+// it declares, not counting those of embedded interfaces. go/doc has
+// already removed the unexported methods, unless told to keep every
+// declaration.
+func interfaceMethods(it *ast.InterfaceType) int {
+	n := 0
+	for _, f := range it.Methods.List {
+		if _, ok := f.Type.(*ast.FuncType); !ok {
+			continue // an embedded interface or a type constraint
+		}
+		n += len(f.Names)
+	}
+	return n
+}
+
+func compareGlanceNames(a, b glanceName) int {
+	return natural.Compare(a.Name, b.Name)
+}
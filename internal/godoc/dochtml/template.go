@@ -36,7 +36,8 @@ func LoadTemplates(fsys template.TrustedFS) {
 			ParseFS(fsys,
 				path.Join(dir, "body.tmpl"),
 				path.Join(dir, "declaration.tmpl"),
-				path.Join(dir, "example.tmpl")))
+				path.Join(dir, "example.tmpl"),
+				path.Join(dir, "glance.tmpl")))
 		outlineTemplate = template.Must(template.New("outline.tmpl").
 			Funcs(tmpl).
 			ParseFS(fsys, path.Join(dir, "outline.tmpl")))
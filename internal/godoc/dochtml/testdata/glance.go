@@ -0,0 +1,81 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package glance has enough symbols for an "At a glance" section.
+package glance
+
+import "io"
+
+// Modes of a Client.
+const (
+	ModeFast Mode = iota
+	ModeSafe
+)
+
+// Limits.
+const (
+	MaxConns = 10
+	MaxIdle  = 2
+)
+
+// Timeout is the default timeout.
+const Timeout = 30
+
+// ErrClosed is returned by a closed Client.
+var ErrClosed error
+
+// A Mode selects how a Client works.
+type Mode int
+
+// String returns the name of m.
+func (m Mode) String() string { return "" }
+
+// A Client talks to a server.
+type Client struct {
+	Mode Mode
+}
+
+// NewClient returns a Client.
+func NewClient() *Client { return nil }
+
+// Dial returns a connected Client.
+func Dial(addr string) (*Client, error) { return nil, nil }
+
+// DialLegacy returns a connected Client.
+//
+// Deprecated: use Dial.
+func DialLegacy(addr string) *Client { return nil }
+
+// Close closes c.
+func (c *Client) Close() error { return nil }
+
+// Do sends a request.
+func (c *Client) Do(r Request) error { return nil }
+
+// Request is a request of a Client.
+type Request interface {
+	io.Reader
+	// Method returns the method of the request.
+	Method() string
+	// URL returns the URL of the request.
+	URL() string
+}
+
+// Number is a constraint.
+type Number interface {
+	~int | ~float64
+}
+
+// Parse parses a request.
+func Parse(s string) Request { return nil }
+
+// Sum adds numbers.
+func Sum[T Number](xs ...T) T { var t T; return t }
+
+// Version returns the version of the package.
+func Version() string { return "" }
+
+func helper() {}
+
+func (c *Client) reset() {}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"go/ast"
 	"go/doc"
+	"go/token"
 	"path"
 	"sort"
 	"strings"
@@ -153,7 +154,7 @@ func (p *Package) DocPackage(innerPath string, modInfo *ModuleInfo) (_ *doc.Pack
 
 // renderOptions returns a RenderOptions for p.
 func (p *Package) renderOptions(innerPath string, sourceInfo *source.Info, modInfo *ModuleInfo,
-	nameToVersion map[string]string, bc internal.BuildContext) dochtml.RenderOptions {
+	nameToVersion map[string]string, bc internal.BuildContext, glanceThreshold int) dochtml.RenderOptions {
 	sourceLinkFunc := func(n ast.Node) string {
 		if sourceInfo == nil {
 			return ""
@@ -178,6 +179,7 @@ func (p *Package) renderOptions(innerPath string, sourceInfo *source.Info, modIn
 		SinceVersionFunc: sinceVersionFunc(modInfo.ModulePath, nameToVersion),
 		Limit:            int64(MaxDocumentationHTML),
 		BuildContext:     bc,
+		GlanceThreshold:  glanceThreshold,
 	}
 }
 
@@ -224,10 +226,12 @@ func sinceVersionFunc(modulePath string, nameToVersion map[string]string) func(n
 }
 
 // Render renders the documentation for the package.
+// Packages with more than glanceThreshold symbols, if it is positive, get an
+// "At a glance" section; see dochtml.RenderOptions.
 // Rendering destroys p's AST; do not call any methods of p after it returns.
 func (p *Package) Render(ctx context.Context, innerPath string,
 	sourceInfo *source.Info, modInfo *ModuleInfo, nameToVersion map[string]string,
-	bc internal.BuildContext) (_ *dochtml.Parts, err error) {
+	bc internal.BuildContext, glanceThreshold int) (_ *dochtml.Parts, err error) {
 	p.renderCalled = true
 
 	d, err := p.DocPackage(innerPath, modInfo)
@@ -235,7 +239,7 @@ func (p *Package) Render(ctx context.Context, innerPath string,
 		return nil, err
 	}
 
-	opts := p.renderOptions(innerPath, sourceInfo, modInfo, nameToVersion, bc)
+	opts := p.renderOptions(innerPath, sourceInfo, modInfo, nameToVersion, bc, glanceThreshold)
 	parts, err := dochtml.Render(ctx, p.Fset, d, opts)
 	if errors.Is(err, ErrTooLarge) {
 		return &dochtml.Parts{Body: template.MustParseAndExecuteToHTML(DocTooLargeReplacement)}, nil
@@ -254,16 +258,38 @@ func RenderFromUnit(ctx context.Context, u *internal.Unit,
 	if err != nil {
 		return nil, err
 	}
-	modInfo := &ModuleInfo{
+	innerPath, modInfo := unitModuleInfo(u)
+	return docPkg.Render(ctx, innerPath, u.SourceInfo, modInfo, nil, bc, 0)
+}
+
+// DocPackageFromUnit is a convenience function that first decodes the source
+// in the unit, which must exist, and then calls DocPackage. It returns the
+// file set needed to print the declarations in the returned doc.Package.
+func DocPackageFromUnit(u *internal.Unit) (_ *token.FileSet, _ *doc.Package, err error) {
+	docPkg, err := DecodePackage(u.Documentation[0].Source)
+	if err != nil {
+		return nil, nil, err
+	}
+	innerPath, modInfo := unitModuleInfo(u)
+	d, err := docPkg.DocPackage(innerPath, modInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return docPkg.Fset, d, nil
+}
+
+// unitModuleInfo returns the path of u within its module, and the module
+// information needed to compute its documentation.
+func unitModuleInfo(u *internal.Unit) (innerPath string, modInfo *ModuleInfo) {
+	modInfo = &ModuleInfo{
 		ModulePath:      u.ModulePath,
 		ResolvedVersion: u.Version,
 		ModulePackages:  nil, // will be provided by docPkg
 	}
-	var innerPath string
 	if u.ModulePath == stdlib.ModulePath {
 		innerPath = u.Path
 	} else if u.Path != u.ModulePath {
 		innerPath = u.Path[len(u.ModulePath)+1:]
 	}
-	return docPkg.Render(ctx, innerPath, u.SourceInfo, modInfo, nil, bc)
+	return innerPath, modInfo
 }
@@ -119,7 +119,7 @@ func TestRenderParts_SinceVersion(t *testing.T) {
 		// TF is a method.
 		"T.M": "v1.4.0",
 	}
-	parts, err := p.Render(ctx, "p", si, mi, nameToVersion, internal.BuildContext{})
+	parts, err := p.Render(ctx, "p", si, mi, nameToVersion, internal.BuildContext{}, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
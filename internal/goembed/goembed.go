@@ -0,0 +1,181 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package goembed finds the files that the //go:embed directives of Go
+// files name. It looks only at the names of the files, never at their
+// contents: the documentation of a package needs its declarations, not
+// the data it embeds, which can be large.
+package goembed
+
+import (
+	"go/scanner"
+	"go/token"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Patterns returns the patterns of the //go:embed directives of the Go
+// source src, in order. A malformed directive is ignored.
+func Patterns(src []byte) []string {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(src)), src, nil, scanner.ScanComments)
+	var patterns []string
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return patterns
+		}
+		if tok != token.COMMENT {
+			continue
+		}
+		args, ok := strings.CutPrefix(lit, "//go:embed")
+		if !ok || args == "" || (args[0] != ' ' && args[0] != '\t') {
+			continue
+		}
+		if ps, ok := parseArgs(args); ok {
+			patterns = append(patterns, ps...)
+		}
+	}
+}
+
+// parseArgs splits the arguments of a directive, which may be quoted with
+// double quotes or back quotes.
+func parseArgs(args string) ([]string, bool) {
+	var patterns []string
+	for {
+		args = strings.TrimLeft(args, " \t")
+		if args == "" {
+			return patterns, true
+		}
+		var arg string
+		switch args[0] {
+		case '"', '`':
+			i := 1
+			for i < len(args) && args[i] != args[0] {
+				if args[0] == '"' && args[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(args) {
+				return nil, false
+			}
+			q, err := strconv.Unquote(args[:i+1])
+			if err != nil {
+				return nil, false
+			}
+			arg, args = q, args[i+1:]
+		default:
+			i := strings.IndexAny(args, " \t")
+			if i < 0 {
+				i = len(args)
+			}
+			arg, args = args[:i], args[i:]
+		}
+		patterns = append(patterns, arg)
+	}
+}
+
+// Matches reports whether pattern, of a directive of a Go file in a
+// directory, embeds the file at the slash-separated path rel from that
+// directory, as the go command does: a pattern naming a directory embeds
+// the files under it, except those whose names begin with "." or "_"
+// unless the pattern begins with "all:".
+func Matches(pattern, rel string) bool {
+	pattern, all := strings.CutPrefix(pattern, "all:")
+	elems := strings.Split(rel, "/")
+	for i := range elems {
+		ok, err := path.Match(pattern, strings.Join(elems[:i+1], "/"))
+		if err != nil || !ok {
+			continue
+		}
+		if i == len(elems)-1 {
+			return true // named by the pattern
+		}
+		// Under a directory the pattern names.
+		hidden := false
+		for _, e := range elems[i+1:] {
+			if strings.HasPrefix(e, ".") || strings.HasPrefix(e, "_") {
+				hidden = true
+			}
+		}
+		return all || !hidden
+	}
+	return false
+}
+
+// Missing returns the patterns of the directives of files, the Go files of
+// the directory dir of fsys by name, that match no file of fsys. The go
+// command does not build such a package, but its documentation does not
+// need the files. An empty dir is the root of fsys.
+func Missing(fsys fs.FS, dir string, files map[string][]byte) []string {
+	if dir == "" {
+		dir = "."
+	}
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		return nil
+	}
+	var missing []string
+	seen := map[string]bool{}
+	for _, src := range files {
+		for _, p := range Patterns(src) {
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			if m, err := fs.Glob(sub, strings.TrimPrefix(p, "all:")); err != nil || len(m) == 0 {
+				missing = append(missing, p)
+			}
+		}
+	}
+	return missing
+}
+
+// EmbeddingDir returns the directory of the Go files whose directives embed
+// the file name of fsys, looking in the directories holding it up to the
+// root of its module, and whether there is one. Test files count, as their
+// directives embed files in tests.
+func EmbeddingDir(fsys fs.FS, name string) (string, bool) {
+	if strings.HasSuffix(name, ".go") {
+		return "", false
+	}
+	dir := name
+	for dir != "." {
+		dir = path.Dir(dir)
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			return "", false
+		}
+		rel := strings.TrimPrefix(name, dir+"/")
+		if dir == "." {
+			rel = name
+		}
+		root := false
+		for _, e := range entries {
+			if e.Name() == "go.mod" {
+				root = true
+			}
+			if !e.Type().IsRegular() || path.Ext(e.Name()) != ".go" {
+				continue
+			}
+			src, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+			if err != nil {
+				continue
+			}
+			for _, p := range Patterns(src) {
+				if Matches(p, rel) {
+					return dir, true
+				}
+			}
+		}
+		if root {
+			break
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goembed
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPatterns(t *testing.T) {
+	src := []byte("package p\n\nimport \"embed\"\n\n" +
+		"//go:embed a.txt \"b c.txt\" `d*.bin`\n" +
+		"var f embed.FS\n\n" +
+		"//go:embed\tall:static\n" +
+		"var g embed.FS\n\n" +
+		"// go:embed not.txt\n" +
+		"//go:embedded not.txt\n" +
+		"//go:embed \"unterminated\n" +
+		"var s = `\n//go:embed not.txt\n`\n")
+	want := []string{"a.txt", "b c.txt", "d*.bin", "all:static"}
+	if diff := cmp.Diff(want, Patterns(src)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	for _, test := range []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"big.bin", "big.bin", true},
+		{"*.bin", "big.bin", true},
+		{"*.bin", "data/big.bin", false},
+		{"data", "data/big.bin", true},
+		{"data", "data/sub/big.bin", true},
+		{"data", "data/.hidden", false},
+		{"data", "data/_sub/big.bin", false},
+		{"all:data", "data/.hidden", true},
+		{"data/.hidden", "data/.hidden", true},
+		{"other", "data/big.bin", false},
+		{"[", "data", false},
+	} {
+		if got := Matches(test.pattern, test.rel); got != test.want {
+			t.Errorf("Matches(%q, %q) = %t, want %t", test.pattern, test.rel, got, test.want)
+		}
+	}
+}
+
+func TestMissing(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/p/p.go":          {},
+		"m/p/big.bin":       {},
+		"m/p/static/a.css":  {},
+		"m/p/testdata/x.go": {},
+	}
+	files := map[string][]byte{
+		"p.go":   []byte("package p\n//go:embed big.bin static gone.txt\nvar b []byte\n"),
+		"q.go":   []byte("package p\n//go:embed *.bin all:missing\nvar c []byte\n"),
+		"doc.go": []byte("package p\n"),
+	}
+	got := Missing(fsys, "m/p", files)
+	want := map[string]bool{"gone.txt": true, "all:missing": true}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want the patterns of %v", got, want)
+	}
+	for _, p := range got {
+		if !want[p] {
+			t.Errorf("%q is reported missing", p)
+		}
+	}
+}
+
+func TestEmbeddingDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/go.mod":              {Data: []byte("module example.com/m\n")},
+		"m/root.go":             {Data: []byte("package m\n//go:embed templates\nvar t embed.FS\n")},
+		"m/templates/a.tmpl":    {},
+		"m/p/p.go":              {Data: []byte("package p\n//go:embed big.bin\nvar b []byte\n")},
+		"m/p/big.bin":           {},
+		"m/p/other.bin":         {},
+		"m/p/sub/data.txt":      {},
+		"m/q/q_test.go":         {Data: []byte("package q\n//go:embed testdata/*.golden\nvar g embed.FS\n")},
+		"m/q/testdata/a.golden": {},
+		"outside/x.go":          {Data: []byte("package x\n//go:embed m\nvar x embed.FS\n")},
+	}
+	for _, test := range []struct {
+		name    string
+		wantDir string
+	}{
+		{"m/p/big.bin", "m/p"},
+		{"m/templates/a.tmpl", "m"},
+		{"m/q/testdata/a.golden", "m/q"},
+		{"m/p/other.bin", ""},
+		{"m/p/sub/data.txt", ""},
+		{"m/p/p.go", ""},
+	} {
+		dir, ok := EmbeddingDir(fsys, test.name)
+		if dir != test.wantDir || ok != (test.wantDir != "") {
+			t.Errorf("EmbeddingDir(%q) = %q, %t, want %q", test.name, dir, ok, test.wantDir)
+		}
+	}
+}
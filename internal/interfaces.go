@@ -10,17 +10,34 @@ import "context"
 // packages in pkgsite can use the database if it exists without needing a
 // dependency on the database driver packages.
 type PostgresDB interface {
-	DataSource
+	ImportedByDataSource
+	VersionsDataSource
 
 	IsExcluded(ctx context.Context, path, version string) bool
-	GetImportedBy(ctx context.Context, pkgPath, modulePath string, limit int) (paths []string, err error)
-	GetImportedByCount(ctx context.Context, pkgPath, modulePath string) (_ int, err error)
 	GetLatestMajorPathForV1Path(ctx context.Context, v1path string) (_ string, _ int, err error)
 	GetStdlibPathsWithSuffix(ctx context.Context, suffix string) (paths []string, err error)
-	GetSymbolHistory(ctx context.Context, packagePath, modulePath string) (_ *SymbolHistory, err error)
 	GetVersionMap(ctx context.Context, modulePath, requestedVersion string) (_ *VersionMap, err error)
 	GetVersionMaps(ctx context.Context, paths []string, requestedVersion string) (_ []*VersionMap, err error)
-	GetVersionsForPath(ctx context.Context, path string) (_ []*ModuleInfo, err error)
 	InsertModule(ctx context.Context, m *Module, lmv *LatestModuleVersions) (isLatest bool, err error)
 	UpsertVersionMap(ctx context.Context, vm *VersionMap) (err error)
 }
+
+// ImportedByDataSource is a DataSource that knows the importers of
+// packages. Its methods return an error wrapping derrors.Unsupported if it
+// cannot report them after all.
+type ImportedByDataSource interface {
+	DataSource
+
+	GetImportedBy(ctx context.Context, pkgPath, modulePath string, limit int) (paths []string, err error)
+	GetImportedByCount(ctx context.Context, pkgPath, modulePath string) (_ int, err error)
+}
+
+// VersionsDataSource is a DataSource that knows the versions of units. Its
+// methods return an error wrapping derrors.Unsupported if it cannot report
+// them after all.
+type VersionsDataSource interface {
+	DataSource
+
+	GetSymbolHistory(ctx context.Context, packagePath, modulePath string) (_ *SymbolHistory, err error)
+	GetVersionsForPath(ctx context.Context, path string) (_ []*ModuleInfo, err error)
+}
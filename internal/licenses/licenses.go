@@ -335,8 +335,10 @@ type Detector struct {
 	logf           func(string, ...any)
 	moduleRedist   bool
 	moduleLicenses []*License // licenses at module root directory, or list from exceptions
-	allLicenses    []*License
-	licsByDir      map[string][]*License // from directory to list of licenses
+
+	allOnce     sync.Once // computes allLicenses and licsByDir
+	allLicenses []*License
+	licsByDir   map[string][]*License // from directory to list of licenses
 }
 
 // NewDetector returns a Detector for the given module and version.
@@ -382,9 +384,7 @@ func (d *Detector) ModuleLicenses() []*License {
 // AllLicenses returns all the licenses detected in the entire module, including
 // package licenses.
 func (d *Detector) AllLicenses() []*License {
-	if d.allLicenses == nil {
-		d.computeAllLicenseInfo()
-	}
+	d.allOnce.Do(d.computeAllLicenseInfo)
 	return d.allLicenses
 }
 
@@ -396,9 +396,7 @@ func (d *Detector) PackageInfo(dir string) (isRedistributable bool, lics []*Lice
 	if path.IsAbs(cleanDir) || strings.HasPrefix(cleanDir, "..") {
 		return false, nil
 	}
-	if d.allLicenses == nil {
-		d.computeAllLicenseInfo()
-	}
+	d.allOnce.Do(d.computeAllLicenseInfo)
 	// Collect all the license metadata for directories dir and above, excluding the root.
 	for prefix, plics := range d.licsByDir {
 		// append a slash so that prefix a/b does not match a/bc/d
@@ -351,6 +351,9 @@ var allowAttrs = []allowAttr{
 	{"h4", "class", spaceSepTokens},
 	{"h5", "class", spaceSepTokens},
 	{"h6", "class", spaceSepTokens},
+
+	// Marks the collapsed source of a README diagram for a renderer script.
+	{"details", "class", re(`^readme-diagram( readme-diagram-[a-z0-9]+)?$`)},
 }
 
 // roundtripAttrs is a map from attribute keys which should be checked
@@ -99,6 +99,14 @@ func TestSanitizeBytes(t *testing.T) {
 			`<details open=""></details>`,
 			`<details open=""></details>`,
 		},
+		{
+			`<details class="readme-diagram readme-diagram-mermaid"></details>`,
+			`<details class="readme-diagram readme-diagram-mermaid"></details>`,
+		},
+		{
+			`<details class="readme-diagram js-expandAll"></details>`,
+			`<details></details>`,
+		},
 		{
 			`<div align="center">`,
 			`<div align="center"></div>`,
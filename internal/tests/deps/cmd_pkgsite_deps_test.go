@@ -13,14 +13,19 @@ import (
 	"github.com/wow-look-at-my/static-pkgsite/internal/testenv"
 )
 
-// non-test packages are allowed to depend on licensecheck and safehtml, x/ repos, and markdown.
+// non-test packages are allowed to depend on licensecheck and safehtml, x/ repos, markdown,
+// brotli, for the precompressed copies of static sites, and esbuild, which -minify
+// uses to minify their style sheets and scripts.
 var allowedModDeps = map[string]bool{
+	"github.com/andybalholm/brotli":  true,
+	"github.com/evanw/esbuild":       true,
 	"github.com/google/licensecheck": true,
 	"github.com/google/safehtml":     true,
 	"golang.org/x/mod":               true,
 	"golang.org/x/net":               true,
 	"github.com/wow-look-at-my/static-pkgsite":           true,
 	"golang.org/x/sync":              true,
+	"golang.org/x/sys":               true,
 	"golang.org/x/text":              true,
 	"golang.org/x/tools":             true,
 	"rsc.io/markdown":                true,
@@ -45,6 +45,8 @@ func TestCheckFrontendTemplates(t *testing.T) {
 		},
 		{"unit/importedby", nil, frontend.UnitPage{}},
 		{"unit/importedby", []string{"importedby"}, frontend.ImportedByDetails{}},
+		{"unit/index", nil, frontend.UnitPage{}},
+		{"unit/index", []string{"symbol-index"}, frontend.SymbolIndexDetails{}},
 		{"unit/imports", nil, frontend.UnitPage{}},
 		{"unit/imports", []string{"imports"}, frontend.ImportsDetails{}},
 		{"unit/licenses", nil, frontend.UnitPage{}},
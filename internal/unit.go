@@ -14,6 +14,10 @@ type UnitMeta struct {
 	//
 	Path string
 	Name string
+	// BuildConstraint is set for a package whose files are all excluded by
+	// build constraints but which was loaded anyway. It is the constraint
+	// under which the package applies, such as "tools".
+	BuildConstraint string
 
 	// Module level information
 	ModuleInfo
@@ -0,0 +1,35 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema
+
+// AssetManifestArtifact maps the style sheets and scripts of a generated
+// static site to their content-hashed names.
+var AssetManifestArtifact = &Artifact{
+	Name:    "asset-manifest",
+	Version: Version{1, 0},
+	new:     func() any { return &AssetManifest{} },
+}
+
+// DecodeAssetManifest decodes the asset manifest of a generated static
+// site.
+func DecodeAssetManifest(data []byte) (*AssetManifest, error) {
+	var m AssetManifest
+	if err := AssetManifestArtifact.Decode(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// AssetManifest maps the style sheets and scripts of a generated static
+// site, written with names that change with their contents, to those
+// names.
+type AssetManifest struct {
+	// SchemaVersion is the version of the schema of the manifest.
+	SchemaVersion string `json:"schemaVersion"`
+	// Assets maps the URL path of each file as it would be named without
+	// its content hash, such as "/static/frontend/frontend.js", to its
+	// URL path, such as "/static/frontend/frontend.1a2b3c4d.js".
+	Assets map[string]string `json:"assets"`
+}
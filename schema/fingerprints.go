@@ -0,0 +1,32 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema
+
+// FingerprintsArtifact lists the fingerprints of the files of a generated
+// static site.
+var FingerprintsArtifact = &Artifact{
+	Name:    "fingerprints",
+	Version: Version{1, 0},
+	new:     func() any { return &Fingerprints{} },
+}
+
+// DecodeFingerprints decodes the fingerprints of a generated static site.
+func DecodeFingerprints(data []byte) (*Fingerprints, error) {
+	var f Fingerprints
+	if err := FingerprintsArtifact.Decode(data, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Fingerprints maps the files of a generated static site to short hashes
+// of their contents, for mirrors to sync only what changed.
+type Fingerprints struct {
+	// SchemaVersion is the version of the schema of the fingerprints.
+	SchemaVersion string `json:"schemaVersion"`
+	// Paths maps the URL path of each file, such as "/example.com/m/" for
+	// a page or "/static/frontend/frontend.js", to its fingerprint.
+	Paths map[string]string `json:"paths"`
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Generate returns the JSON Schema document, in the 2020-12 dialect, of the
+// JSON encoding of v, which must be a struct or a pointer to one, as
+// version version of the schema of the artifact name. Fields are required
+// unless they are omitted when empty. Struct types other than that of v
+// are defined under $defs, by name. The schemaVersion field of v must have
+// the major version of version.
+func Generate(name string, version Version, v any) ([]byte, error) {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema of %s: %s is not a struct", name, t)
+	}
+	g := &generator{version: version, defs: map[string]any{}, types: map[string]reflect.Type{}}
+	s, err := g.object(t, true)
+	if err != nil {
+		return nil, fmt.Errorf("schema of %s: %w", name, err)
+	}
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = name
+	if len(g.defs) > 0 {
+		s["$defs"] = g.defs
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+type generator struct {
+	version Version
+	defs    map[string]any          // schemas of struct types, by name
+	types   map[string]reflect.Type // struct types, by name
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// object returns the schema of the struct type t. The top-level struct
+// has the schemaVersion field.
+func (g *generator) object(t reflect.Type, top bool) (map[string]any, error) {
+	props := map[string]any{}
+	required := []string{}
+	hasVersion := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous {
+			return nil, fmt.Errorf("%s.%s: embedded fields are not supported", t.Name(), f.Name)
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		omitEmpty := strings.Contains(","+opts+",", ",omitempty,")
+		var s map[string]any
+		if top && name == "schemaVersion" {
+			if f.Type.Kind() != reflect.String {
+				return nil, fmt.Errorf("%s.%s: schemaVersion is not a string", t.Name(), f.Name)
+			}
+			s = map[string]any{
+				"type":    "string",
+				"pattern": fmt.Sprintf(`^%d\.[0-9]+$`, g.version.Major),
+			}
+			hasVersion = true
+		} else {
+			var err error
+			s, err = g.schema(f.Type, !omitEmpty)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", t.Name(), f.Name, err)
+			}
+		}
+		props[name] = s
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	}
+	if top && !hasVersion {
+		return nil, fmt.Errorf("%s has no schemaVersion field", t.Name())
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": props,
+		"required":   required,
+	}, nil
+}
+
+// schema returns the schema of the type t. If nullable, nil pointers,
+// slices and maps of the type are encoded as null.
+func (g *generator) schema(t reflect.Type, nullable bool) (map[string]any, error) {
+	var s map[string]any
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]any{"type": "string", "format": "date-time"}, nil
+		}
+		if err := g.define(t); err != nil {
+			return nil, err
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}, nil
+	case reflect.Pointer:
+		elem, err := g.schema(t.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		s = elem
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nil, fmt.Errorf("byte slices are not supported")
+		}
+		items, err := g.schema(t.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		s = map[string]any{"type": "array", "items": items}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys of type %s are not supported", t.Key())
+		}
+		values, err := g.schema(t.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		s = map[string]any{"type": "object", "additionalProperties": values}
+	default:
+		return nil, fmt.Errorf("values of type %s are not supported", t)
+	}
+	if !nullable {
+		return s, nil
+	}
+	if typ, ok := s["type"].(string); ok {
+		s["type"] = []string{typ, "null"}
+		return s, nil
+	}
+	return map[string]any{"anyOf": []any{s, map[string]any{"type": "null"}}}, nil
+}
+
+// define adds the schema of the struct type t to the definitions.
+func (g *generator) define(t reflect.Type) error {
+	if t.Name() == "" {
+		return fmt.Errorf("anonymous structs are not supported")
+	}
+	if prev, ok := g.types[t.Name()]; ok {
+		if prev != t {
+			return fmt.Errorf("types %s and %s have the same name", prev, t)
+		}
+		return nil
+	}
+	g.types[t.Name()] = t
+	s, err := g.object(t, false)
+	if err != nil {
+		return err
+	}
+	g.defs[t.Name()] = s
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ModulesArtifact records what each module contributed to a generated
+// static site, in its .pkgsite-modules.json file.
+var ModulesArtifact = &Artifact{
+	Name:    "modules",
+	Version: Version{1, 2},
+	new:     func() any { return &Modules{} },
+}
+
+// DecodeModules decodes the record of the modules of a generated static
+// site. Records written before they had a schema version hold only the map
+// of Modules, and are read as such.
+func DecodeModules(data []byte) (*Modules, error) {
+	var m Modules
+	if err := ModulesArtifact.Decode(data, &m); err != nil {
+		return nil, err
+	}
+	if m.SchemaVersion == "" && m.Modules == nil {
+		if err := json.Unmarshal(data, &m.Modules); err != nil {
+			return nil, err
+		}
+	}
+	return &m, nil
+}
+
+// Modules records what each module contributed to a generated static site,
+// for the next run to freeze modules and for tools to query the site.
+type Modules struct {
+	// SchemaVersion is the version of the schema of the record.
+	SchemaVersion string `json:"schemaVersion"`
+	// Modules maps the path of each module to its record.
+	Modules map[string]*ModuleRecord `json:"modules"`
+}
+
+// A ModuleRecord is what a module contributed to a site.
+type ModuleRecord struct {
+	// Dir is the directory of the module, as listed on the homepage.
+	Dir string `json:"dir,omitempty"`
+	// Version is the version of the module that the unversioned pages of
+	// its units document, such as v0.0.0 for a local module.
+	Version string `json:"version,omitempty"`
+	// Units are the paths of the units with pages, sorted, with the host
+	// in ASCII. The units of other versions of the module have the version
+	// after the module path, such as example.com/m@v1.2.0/a.
+	Units []string `json:"units"`
+	// Files are the slash-separated paths of the files of the module,
+	// relative to the output directory, sorted.
+	Files []string `json:"files"`
+	// Pages are the pages among Files, sorted by file.
+	Pages []PageRecord `json:"pages"`
+	// Search are the entries of the packages of the module in the search
+	// index.
+	Search []SearchEntry `json:"search,omitempty"`
+	// Imports maps the import path of each package of the module to its
+	// imports.
+	Imports map[string][]string `json:"imports,omitempty"`
+	// LastMod is the modification time of the newest file in the directory
+	// of the module, which the sitemap gives for its pages. (Since 1.1.)
+	LastMod *time.Time `json:"lastMod,omitempty"`
+	// LicenseTexts maps the hash of each license text on the licenses
+	// pages of the module to the text, whose page the site shares with the
+	// modules that have the same text. (Since 1.2.)
+	LicenseTexts map[string]string `json:"licenseTexts,omitempty"`
+	// Sum is the SHA-256 hash, in hex, of the record without its Sum, by
+	// which a run tells a corrupt record from a good one. (Since 1.1.)
+	Sum string `json:"sum,omitempty"`
+}
+
+// A PageRecord is a page of a module.
+type PageRecord struct {
+	URLPath string `json:"urlPath"` // such as /example.com/m/a
+	File    string `json:"file"`    // slash-separated path, relative to the output directory
+	HTML    bool   `json:"html,omitempty"`
+	// Redirect is the URL path that a redirect page points at.
+	Redirect string `json:"redirect,omitempty"`
+	// Tab is the tab of a unit that the page shows, such as "imports".
+	Tab    string `json:"tab,omitempty"`
+	Source bool   `json:"source,omitempty"` // a page of a source file
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema
+
+// PagesArtifact lists the pages of a generated static site, in its
+// pages.json file.
+var PagesArtifact = &Artifact{
+	Name:    "pages",
+	Version: Version{1, 0},
+	new:     func() any { return &Pages{} },
+}
+
+// DecodePages decodes the list of the pages of a generated static site.
+func DecodePages(data []byte) (*Pages, error) {
+	var p Pages
+	if err := PagesArtifact.Decode(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Pages lists the pages of a generated static site, for tools to learn
+// what the site holds without crawling it.
+type Pages struct {
+	// SchemaVersion is the version of the schema of the list.
+	SchemaVersion string `json:"schemaVersion"`
+	// Pages are the pages of the site, sorted by File.
+	Pages []Page `json:"pages"`
+}
+
+// The kinds of pages.
+const (
+	PageHome     = "homepage"
+	PageStatic   = "static"   // an informational page, such as /about
+	PageUnit     = "unit"     // the page of a package, command or directory
+	PageTab      = "tab"      // a tab of a unit, or a page of its symbol index
+	PageSource   = "source"   // the page of a source file
+	PageRedirect = "redirect" // a stub redirecting to another page
+	PageNotFound = "notFound" // 404.html
+)
+
+// A Page is a page of a generated static site.
+type Page struct {
+	// URLPath is the URL path the page was rendered from, such as
+	// "/example.com/m" or "/example.com/m?tab=imports".
+	URLPath string `json:"urlPath"`
+	// File is the slash-separated path of the file of the page, relative
+	// to the output directory.
+	File string `json:"file"`
+	// Kind is the kind of the page, one of the Page constants.
+	Kind string `json:"kind"`
+	// Module is the path of the module of the unit of the page, if it has
+	// one.
+	Module string `json:"module,omitempty"`
+	// Synopsis is the synopsis of the package of a unit page.
+	Synopsis string `json:"synopsis,omitempty"`
+	// Redirect is the URL path, or the external URL, that a redirect stub
+	// points at.
+	Redirect string `json:"redirect,omitempty"`
+	// Hash is the hex SHA-256 hash of the file as written.
+	Hash string `json:"hash"`
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema
+
+// ProgressArtifact is an event of the progress of a static site
+// generation. With the JSON progress format, a run writes one event per
+// line.
+var ProgressArtifact = &Artifact{
+	Name:    "progress",
+	Version: Version{1, 0},
+	new:     func() any { return &ProgressEvent{} },
+}
+
+// DecodeProgressEvent decodes an event of the progress of a static site
+// generation, one line of the JSON progress output.
+func DecodeProgressEvent(data []byte) (*ProgressEvent, error) {
+	var e ProgressEvent
+	if err := ProgressArtifact.Decode(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// The kinds of progress events, in the order a run writes them. The page
+// events are written for each page, in the order the pages start, and a
+// page ends with page-rendered or page-failed.
+const (
+	ProgressStart        = "start"         // the pages are about to be rendered
+	ProgressPageStarted  = "page-started"  // a page starts rendering
+	ProgressPageRendered = "page-rendered" // a page was written
+	ProgressPageFailed   = "page-failed"   // a page could not be written
+	ProgressAssetsCopied = "assets-copied" // the assets of the site were written
+	ProgressDone         = "done"          // the site was generated
+)
+
+// A ProgressEvent is an event of the progress of a static site generation.
+type ProgressEvent struct {
+	// SchemaVersion is the version of the schema of the event.
+	SchemaVersion string `json:"schemaVersion"`
+	// Event is the kind of the event, one of the Progress constants.
+	Event string `json:"event"`
+	// Elapsed is the time since the start of the run, in seconds.
+	Elapsed float64 `json:"elapsed"`
+	// URLPath is the path of the page of a page event, such as
+	// "/example.com/m" or "/example.com/m/imports".
+	URLPath string `json:"urlPath,omitempty"`
+	// Index is the number of the page of a page event, from 1, in the
+	// order the pages start.
+	Index int `json:"index,omitempty"`
+	// Total is the number of pages the run renders, for the start and page
+	// events.
+	Total int `json:"total,omitempty"`
+	// Duration is the time the page of a page-rendered or page-failed
+	// event took, in seconds.
+	Duration float64 `json:"duration,omitempty"`
+	// ETA is the estimated time left to render the pages, in seconds, for
+	// the page-started events once there is an estimate.
+	ETA float64 `json:"eta,omitempty"`
+	// Bytes is the size of the files of a page-rendered event, including
+	// the stubs of the redirects it followed, or of the assets of an
+	// assets-copied event.
+	Bytes int64 `json:"bytes,omitempty"`
+	// Files is the number of files of the assets of an assets-copied
+	// event.
+	Files int `json:"files,omitempty"`
+	// Error is the error of a page-failed event.
+	Error string `json:"error,omitempty"`
+	// Pages and FailedPages are the numbers of pages written and of pages
+	// that failed, for the done event, as in the report.
+	Pages       int `json:"pages,omitempty"`
+	FailedPages int `json:"failedPages,omitempty"`
+}
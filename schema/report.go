@@ -0,0 +1,241 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema
+
+// ReportArtifact is the report on a generated static site.
+var ReportArtifact = &Artifact{
+	Name:    "report",
+	Version: Version{1, 11},
+	new:     func() any { return &Report{} },
+}
+
+// DecodeReport decodes a report on a generated static site.
+func DecodeReport(data []byte) (*Report, error) {
+	var r Report
+	if err := ReportArtifact.Decode(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// A Report describes the outcome of a static site generation.
+type Report struct {
+	// SchemaVersion is the version of the schema of the report.
+	SchemaVersion string `json:"schemaVersion"`
+	// Partial reports that only a subset of the site was generated, as in
+	// a smoke test. A partial site must not be published.
+	Partial bool `json:"partial"`
+	// Units is the number of units found in the modules.
+	Units int `json:"units"`
+	// Pages is the number of pages written.
+	Pages int `json:"pages"`
+	// BrokenLinks lists the links to unit pages that were not generated.
+	BrokenLinks []BrokenLink `json:"brokenLinks,omitempty"`
+	// IgnoredLinks is the number of links to units deliberately left out
+	// of a partial site, which were not checked.
+	IgnoredLinks int `json:"ignoredLinks,omitempty"`
+	// MissingAssets lists the references from stylesheets, through url()
+	// or @import, to files that are not in the output.
+	MissingAssets []BrokenLink `json:"missingAssets,omitempty"`
+	// PlatformDivergence lists the packages whose documentation differs
+	// across platforms.
+	PlatformDivergence []*PlatformDivergence `json:"platformDivergence,omitempty"`
+	// Redactions lists the redactions applied to the documentation.
+	Redactions []Redaction `json:"redactions,omitempty"`
+	// ChangedFiles and DeletedFiles are the numbers of files in the
+	// change lists of the output directory.
+	ChangedFiles int `json:"changedFiles"`
+	DeletedFiles int `json:"deletedFiles"`
+	// FailedPages lists the pages that could not be written. (Since 1.1.)
+	FailedPages []FailedPage `json:"failedPages,omitempty"`
+	// HiddenSymbols lists the symbols whose documentation was hidden.
+	// (Since 1.2.)
+	HiddenSymbols []Hiding `json:"hiddenSymbols,omitempty"`
+	// Archive describes the snapshot of the site that the run archived, if
+	// it archived one. (Since 1.3.)
+	Archive *ArchiveSnapshot `json:"archive,omitempty"`
+	// Invalidated says what of the site the options of the run invalidated,
+	// as they changed since the previous run into the output directory:
+	// "pages" for every page and the files derived from them, such as
+	// after a change of the site name or on a first run, "aggregates" for
+	// only the files derived from the site as a whole, such as the
+	// sitemap, or "" for nothing. (Since 1.4.)
+	Invalidated string `json:"invalidated,omitempty"`
+	// Frozen lists the modules whose files were copied from a previous
+	// run instead of being generated, sorted by path. (Since 1.5.)
+	Frozen []string `json:"frozen,omitempty"`
+	// DownloadBundles lists the download bundles of the modules, whose
+	// files are not counted in Pages. (Since 1.6.)
+	DownloadBundles []DownloadBundle `json:"downloadBundles,omitempty"`
+	// Degradations lists what the run left out of the site to meet its
+	// time budget, in the order it gave them up. (Since 1.7.)
+	Degradations []Degradation `json:"degradations,omitempty"`
+	// LeftOut lists the units of the modules that the unit path filters
+	// left out of the site, sorted, with the host in ASCII. (Since 1.8.)
+	LeftOut []string `json:"leftOut,omitempty"`
+	// RootPaths lists the references in the HTML, CSS and JavaScript files
+	// of the output to paths from the root of the host, which break when
+	// the site is served from a subpath. (Since 1.9.)
+	RootPaths []RootPath `json:"rootPaths,omitempty"`
+	// EmptyDocs lists the packages whose documentation has no exported
+	// declarations, although their Go files declare some. (Since 1.10.)
+	EmptyDocs []*EmptyDoc `json:"emptyDocs,omitempty"`
+	// Batch describes the entries of a batch run, whose report is that of
+	// its last run, with the units and the lists about the pages of the
+	// entries generated by its earlier runs added. (Since 1.11.)
+	Batch *Batch `json:"batch,omitempty"`
+
+	// PageList lists the pages of the site, as its pages.json file does,
+	// for the callers of the generator. It is not part of the report file.
+	PageList *Pages `json:"-"`
+}
+
+// DivergenceFailures returns the number of packages whose platform
+// divergence fails the generation.
+func (r *Report) DivergenceFailures() int {
+	n := 0
+	for _, d := range r.PlatformDivergence {
+		if d.Enforced {
+			n++
+		}
+	}
+	return n
+}
+
+// A BrokenLink is a link from a generated page to a unit page of the site
+// that was not generated.
+type BrokenLink struct {
+	Page string `json:"page"` // slash-separated path of the linking file, relative to the output directory
+	Href string `json:"href"` // link as written
+}
+
+// A RootPath is a reference in a file of the output to a path from the root
+// of the host, such as href="/static/x.css".
+type RootPath struct {
+	File    string `json:"file"`    // slash-separated path of the file, relative to the output directory
+	Line    int    `json:"line"`    // 1-based
+	Snippet string `json:"snippet"` // text around the reference
+}
+
+// A PlatformDivergence lists the symbols of a package that are documented
+// on only some of the platforms the package builds on.
+type PlatformDivergence struct {
+	Package string `json:"package"`
+	// Platforms are the platforms the package builds on, as GOOS/GOARCH.
+	Platforms []string          `json:"platforms"`
+	Symbols   []DivergentSymbol `json:"symbols"`
+	// Enforced reports that the package matches the FailOnDivergence
+	// patterns, so that its divergence fails the generation.
+	Enforced bool `json:"enforced,omitempty"`
+}
+
+// An EmptyDoc is a package whose documentation has no exported
+// declarations, although its Go files declare some.
+type EmptyDoc struct {
+	Package string `json:"package"` // import path
+	// Exported is the number of exported identifiers that the Go files of
+	// the package declare at top level.
+	Exported int `json:"exported"`
+	// Files are the names of the files that declare them.
+	Files []string `json:"files"`
+	// Causes are the likely causes, sorted: "build-constraints" if build
+	// constraints leave some of the files out of the documentation, and
+	// "generated-files" if some of them are generated.
+	Causes []string `json:"causes,omitempty"`
+}
+
+// A Batch describes the entries of a batch run, which generates the site
+// of many independent modules in waves of a few entries.
+type Batch struct {
+	Waves   int            `json:"waves"` // number of waves the entries were generated in
+	Entries []BatchOutcome `json:"entries"`
+}
+
+// A BatchOutcome describes the outcome of an entry of a batch run.
+type BatchOutcome struct {
+	Name   string `json:"name"`
+	Getter string `json:"getter"`           // "local", "git" or "proxy"
+	Module string `json:"module,omitempty"` // module path, unless the entry failed before it was known
+	// Version is the version of a proxy entry, or the commit of a git
+	// entry.
+	Version string `json:"version,omitempty"`
+	// Status is "generated" if the run generated the pages of the entry,
+	// "resumed" if it kept those of the run it resumed, or "failed".
+	Status string `json:"status"`
+	// Error says why the entry failed. A failed entry is left out of the
+	// site.
+	Error string `json:"error,omitempty"`
+	// Units and Pages are the numbers of units and pages of the module.
+	Units int `json:"units"`
+	Pages int `json:"pages"`
+	// FailedPages lists the pages of the module that could not be
+	// written.
+	FailedPages []FailedPage `json:"failedPages,omitempty"`
+}
+
+// A DivergentSymbol is a symbol documented on only some platforms.
+type DivergentSymbol struct {
+	Name      string   `json:"name"` // such as "F" or "T.M"
+	Platforms []string `json:"platforms"`
+}
+
+// A FailedPage is a page that could not be written.
+type FailedPage struct {
+	URLPath string `json:"urlPath"`
+	Error   string `json:"error"`
+}
+
+// A Redaction records that a rule changed the text of a page.
+type Redaction struct {
+	Page string `json:"page"` // unit path
+	Rule string `json:"rule"`
+	// Hash is the hex SHA-256 hash of the original text, which identifies
+	// it without revealing it.
+	Hash string `json:"hash"`
+}
+
+// A Hiding records that the documentation of a symbol was hidden.
+type Hiding struct {
+	Package string `json:"package"` // import path
+	Symbol  string `json:"symbol"`  // such as "F", "T" or "T.M"
+	Mode    string `json:"mode"`    // "withhold" or "remove"
+}
+
+// An ArchiveSnapshot describes a snapshot of the site added to its archive,
+// and how much the archive grew.
+type ArchiveSnapshot struct {
+	Name       string   `json:"name"`              // directory of the snapshot in the archive
+	Files      int      `json:"files"`             // number of files of the snapshot
+	Bytes      int64    `json:"bytes"`             // size of the files of the snapshot
+	AddedBytes int64    `json:"addedBytes"`        // size of the files not linked to the previous snapshot
+	Snapshots  int      `json:"snapshots"`         // number of snapshots the archive holds
+	Removed    []string `json:"removed,omitempty"` // snapshots removed to keep the archive within its retention
+}
+
+// A DownloadBundle describes the zip file of the pages of a module and the
+// assets they need, for viewing them offline.
+type DownloadBundle struct {
+	Module string `json:"module"` // module path
+	File   string `json:"file"`   // slash-separated path of the zip file, relative to the output directory
+	Pages  int    `json:"pages"`  // number of pages in the zip file
+	Assets int    `json:"assets"` // number of asset files in the zip file
+	Bytes  int64  `json:"bytes"`  // size of the zip file
+}
+
+// A Degradation records that a run over its time budget left out a
+// feature of the site from some point on.
+type Degradation struct {
+	// Feature is what was left out: "source-pages", "symbol-index",
+	// "archives" for the download bundles and the archived snapshot, or
+	// "unit-pages" for the unit pages written as stubs of their metadata.
+	Feature string `json:"feature"`
+	// Elapsed is the time into the run, in seconds, at which the feature
+	// was given up.
+	Elapsed float64 `json:"elapsed"`
+	// Skipped is the number of pages or files not written. For
+	// "unit-pages", it counts the unit pages written as stubs, and their
+	// tab pages.
+	Skipped int `json:"skipped"`
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package schema defines the machine-readable files written by pkgsite,
+// such as the report on a generated static site and its search index, and
+// decodes them.
+//
+// Each file records the version of its schema in a top-level
+// "schemaVersion" field, as MAJOR.MINOR. Within a major version, changes
+// are additive: a minor version only adds optional fields, so a reader of
+// any minor version can read the files of every other. A change that
+// removes, renames or retypes a field, or adds a field that is always
+// present, starts a new major version. The tests of this package enforce
+// that policy against the schemas of released versions.
+//
+// A JSON Schema document for each file is embedded in Files, and can be
+// published with a site.
+package schema
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Files holds the JSON Schema document of each artifact, named
+// <name>.v<major>.json.
+//
+//go:embed schemas/*.json
+var Files embed.FS
+
+// An Artifact is a kind of machine-readable file.
+type Artifact struct {
+	Name    string  // such as "report"
+	Version Version // version of the schema written
+	new     func() any
+}
+
+// File returns the name of the JSON Schema document of a in Files.
+func (a *Artifact) File() string {
+	return fmt.Sprintf("schemas/%s.v%d.json", a.Name, a.Version.Major)
+}
+
+// Schema generates the JSON Schema document of a.
+func (a *Artifact) Schema() ([]byte, error) {
+	return Generate(a.Name, a.Version, a.new())
+}
+
+// Artifacts lists the machine-readable files pkgsite writes.
+var Artifacts = []*Artifact{ReportArtifact, SearchIndexArtifact, FingerprintsArtifact, ModulesArtifact, PagesArtifact, ProgressArtifact, AssetManifestArtifact, URLRulesArtifact}
+
+// A Version is the version of a schema.
+type Version struct {
+	Major, Minor int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// ParseVersion parses a version of the form MAJOR.MINOR.
+func ParseVersion(s string) (Version, error) {
+	major, minor, ok := strings.Cut(s, ".")
+	if ok {
+		ma, err1 := strconv.Atoi(major)
+		mi, err2 := strconv.Atoi(minor)
+		if err1 == nil && err2 == nil && ma >= 0 && mi >= 0 {
+			return Version{ma, mi}, nil
+		}
+	}
+	return Version{}, fmt.Errorf("invalid schema version %q", s)
+}
+
+// Decode decodes data, a file of artifact a, into v. The file may have any
+// minor version of the major version of a; fields unknown to v are
+// ignored. Files written before schema versions were recorded have none,
+// and are read as version 1.0.
+func (a *Artifact) Decode(data []byte, v any) error {
+	var header struct {
+		SchemaVersion *string `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("decoding %s: %w", a.Name, err)
+	}
+	got := Version{1, 0}
+	if header.SchemaVersion != nil {
+		var err error
+		got, err = ParseVersion(*header.SchemaVersion)
+		if err != nil {
+			return fmt.Errorf("decoding %s: %w", a.Name, err)
+		}
+	}
+	if got.Major != a.Version.Major {
+		return fmt.Errorf("decoding %s: schema version %s is not supported; want %d.x", a.Name, got, a.Version.Major)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding %s: %w", a.Name, err)
+	}
+	return nil
+}
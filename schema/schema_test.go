@@ -0,0 +1,345 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("update", false, "update goldens instead of checking against them")
+
+// The schema of each artifact is checked against two goldens:
+// schemas/<name>.v<major>.json, which is embedded and may change with the
+// minor version, and testdata/released/<name>.v<major>.<minor>.json, which
+// is written once for each version and never changes. A change to a
+// schema therefore needs a new version, and the schemas of every released
+// minor version must be compatible with the current one.
+
+func releasedFile(a *Artifact, v Version) string {
+	return filepath.Join("testdata", "released", fmt.Sprintf("%s.v%s.json", a.Name, v))
+}
+
+func TestSchemas(t *testing.T) {
+	for _, a := range Artifacts {
+		t.Run(a.Name, func(t *testing.T) {
+			got, err := a.Schema()
+			if err != nil {
+				t.Fatal(err)
+			}
+			released := releasedFile(a, a.Version)
+			if *update {
+				if err := os.WriteFile(filepath.FromSlash(a.File()), got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := os.Stat(released); os.IsNotExist(err) {
+					if err := os.WriteFile(released, got, 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			want, err := Files.ReadFile(a.File())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(want), string(got)); diff != "" {
+				t.Errorf("%s mismatch (-want +got); run with -update:\n%s", a.File(), diff)
+			}
+			want, err = os.ReadFile(released)
+			if err != nil {
+				t.Fatalf("%v; run with -update to release version %s", err, a.Version)
+			}
+			if diff := cmp.Diff(string(want), string(got)); diff != "" {
+				t.Errorf("schema differs from released version %s; change the version (-released +current):\n%s", a.Version, diff)
+			}
+		})
+	}
+}
+
+func TestCompatibility(t *testing.T) {
+	for _, a := range Artifacts {
+		cur, err := a.Schema()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := filepath.Glob(filepath.Join("testdata", "released", a.Name+".v*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			v, err := ParseVersion(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), a.Name+".v"), ".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Major > a.Version.Major || v.Major == a.Version.Major && v.Minor > a.Version.Minor {
+				t.Errorf("%s: released version %s is newer than the current version %s", a.Name, v, a.Version)
+			}
+			if v.Major != a.Version.Major {
+				continue
+			}
+			old, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range incompatibilities(t, old, cur) {
+				t.Errorf("%s %s to %s: %s", a.Name, v, a.Version, p)
+			}
+		}
+	}
+}
+
+// incompatibilities returns the ways in which the schema document cur is
+// not an additive change of old: every document valid under old must be
+// valid under cur, and cur may only add optional properties.
+func incompatibilities(t *testing.T, old, cur []byte) []string {
+	t.Helper()
+	var o, c map[string]any
+	if err := json.Unmarshal(old, &o); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(cur, &c); err != nil {
+		t.Fatal(err)
+	}
+	ck := &compatChecker{oldDefs: defs(o), curDefs: defs(c), seen: map[string]bool{}}
+	ck.compare("", o, c)
+	return ck.problems
+}
+
+func defs(doc map[string]any) map[string]any {
+	d, _ := doc["$defs"].(map[string]any)
+	return d
+}
+
+type compatChecker struct {
+	oldDefs, curDefs map[string]any
+	seen             map[string]bool // definitions compared
+	problems         []string
+}
+
+func (ck *compatChecker) errorf(path, format string, args ...any) {
+	ck.problems = append(ck.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (ck *compatChecker) compare(path string, old, cur any) {
+	om, ok1 := old.(map[string]any)
+	cm, ok2 := cur.(map[string]any)
+	if !ok1 || !ok2 {
+		if !reflect.DeepEqual(old, cur) {
+			ck.errorf(path, "changed from %v to %v", old, cur)
+		}
+		return
+	}
+	for _, key := range sortedKeys(om) {
+		ov, cv := om[key], cm[key]
+		switch key {
+		case "$schema", "$defs", "title":
+		case "$ref":
+			if ov != cv {
+				ck.errorf(path, "reference changed from %v to %v", ov, cv)
+				continue
+			}
+			name := strings.TrimPrefix(ov.(string), "#/$defs/")
+			if !ck.seen[name] {
+				ck.seen[name] = true
+				ck.compare(name, ck.oldDefs[name], ck.curDefs[name])
+			}
+		case "properties":
+			op, _ := ov.(map[string]any)
+			cp, _ := cv.(map[string]any)
+			for _, name := range sortedKeys(op) {
+				if _, ok := cp[name]; !ok {
+					ck.errorf(path, "property %q removed", name)
+					continue
+				}
+				ck.compare(path+"."+name, op[name], cp[name])
+			}
+		case "required":
+			was := map[any]bool{}
+			for _, r := range ov.([]any) {
+				was[r] = true
+			}
+			cr, _ := cv.([]any)
+			for _, r := range cr {
+				if !was[r] {
+					ck.errorf(path, "property %v is newly required", r)
+				}
+			}
+		case "type":
+			types := map[any]bool{}
+			if l, ok := cv.([]any); ok {
+				for _, t := range l {
+					types[t] = true
+				}
+			} else {
+				types[cv] = true
+			}
+			ol, ok := ov.([]any)
+			if !ok {
+				ol = []any{ov}
+			}
+			for _, t := range ol {
+				if !types[t] {
+					ck.errorf(path, "type %v no longer allowed", t)
+				}
+			}
+		case "anyOf":
+			ol, _ := ov.([]any)
+			cl, _ := cv.([]any)
+			if len(ol) != len(cl) {
+				ck.errorf(path, "anyOf changed")
+				continue
+			}
+			for i := range ol {
+				ck.compare(fmt.Sprintf("%s[%d]", path, i), ol[i], cl[i])
+			}
+		default:
+			ck.compare(path+"/"+key, ov, cv)
+		}
+	}
+	if _, ok := om["required"]; !ok {
+		if _, ok := cm["required"]; ok {
+			ck.errorf(path, "properties are newly required")
+		}
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestIncompatibilities(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+	}
+	type v10 struct {
+		SchemaVersion string `json:"schemaVersion"`
+		Count         int    `json:"count"`
+		Items         []item `json:"items,omitempty"`
+	}
+	type added struct {
+		SchemaVersion string `json:"schemaVersion"`
+		Count         int    `json:"count"`
+		Items         []item `json:"items,omitempty"`
+		Extra         string `json:"extra,omitempty"`
+	}
+	type addedRequired struct {
+		SchemaVersion string `json:"schemaVersion"`
+		Count         int    `json:"count"`
+		Items         []item `json:"items,omitempty"`
+		Extra         string `json:"extra"`
+	}
+	type removed struct {
+		SchemaVersion string `json:"schemaVersion"`
+		Items         []item `json:"items,omitempty"`
+	}
+	type retyped struct {
+		SchemaVersion string `json:"schemaVersion"`
+		Count         string `json:"count"`
+		Items         []item `json:"items,omitempty"`
+	}
+	gen := func(v any) []byte {
+		data, err := Generate("test", Version{1, 0}, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	old := gen(v10{})
+	for _, test := range []struct {
+		name string
+		cur  any
+		want int
+	}{
+		{"same", v10{}, 0},
+		{"optional field", added{}, 0},
+		{"required field", addedRequired{}, 1},
+		{"removed field", removed{}, 1},
+		{"changed type", retyped{}, 1},
+	} {
+		if got := incompatibilities(t, old, gen(test.cur)); len(got) != test.want {
+			t.Errorf("%s: got %d problems %v, want %d", test.name, len(got), got, test.want)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	type noVersion struct {
+		Count int `json:"count"`
+	}
+	type bytesField struct {
+		SchemaVersion string `json:"schemaVersion"`
+		Data          []byte `json:"data"`
+	}
+	for _, v := range []any{noVersion{}, bytesField{}, 3} {
+		if _, err := Generate("test", Version{1, 0}, v); err == nil {
+			t.Errorf("Generate(%T): got nil error", v)
+		}
+	}
+}
+
+func TestDecodeReport(t *testing.T) {
+	for _, test := range []struct {
+		data    string
+		want    *Report
+		wantErr bool
+	}{
+		{`{"schemaVersion": "1.0", "pages": 3}`, &Report{SchemaVersion: "1.0", Pages: 3}, false},
+		// A newer minor version only adds fields.
+		{`{"schemaVersion": "1.7", "pages": 3, "newField": true}`, &Report{SchemaVersion: "1.7", Pages: 3}, false},
+		// Reports from before schema versions.
+		{`{"pages": 3}`, &Report{Pages: 3}, false},
+		{`{"schemaVersion": "2.0", "pages": 3}`, nil, true},
+		{`{"schemaVersion": "one", "pages": 3}`, nil, true},
+		{`[]`, nil, true},
+	} {
+		got, err := DecodeReport([]byte(test.data))
+		if (err != nil) != test.wantErr {
+			t.Errorf("DecodeReport(%s): got error %v, want error %t", test.data, err, test.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("DecodeReport(%s) mismatch (-want +got):\n%s", test.data, diff)
+		}
+	}
+}
+
+func TestDecodeModules(t *testing.T) {
+	rec := map[string]*ModuleRecord{"example.com/m": {Units: []string{"example.com/m"}}}
+	for _, test := range []struct {
+		data    string
+		want    *Modules
+		wantErr bool
+	}{
+		{`{"schemaVersion": "1.0", "modules": {"example.com/m": {"units": ["example.com/m"]}}}`, &Modules{SchemaVersion: "1.0", Modules: rec}, false},
+		// Records from before schema versions.
+		{`{"example.com/m": {"units": ["example.com/m"]}}`, &Modules{Modules: rec}, false},
+		{`{}`, &Modules{Modules: map[string]*ModuleRecord{}}, false},
+		{`{"schemaVersion": "2.0", "modules": {}}`, nil, true},
+		{`{"example.com/m": []}`, nil, true},
+	} {
+		got, err := DecodeModules([]byte(test.data))
+		if (err != nil) != test.wantErr {
+			t.Errorf("DecodeModules(%s): got error %v, want error %t", test.data, err, test.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("DecodeModules(%s) mismatch (-want +got):\n%s", test.data, diff)
+		}
+	}
+}
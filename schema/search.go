@@ -0,0 +1,52 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema
+
+// SearchIndexArtifact is the index searched by the pages of a generated
+// static site.
+var SearchIndexArtifact = &Artifact{
+	Name:    "search-index",
+	Version: Version{1, 1},
+	new:     func() any { return &SearchIndex{} },
+}
+
+// DecodeSearchIndex decodes the search index of a generated static site.
+func DecodeSearchIndex(data []byte) (*SearchIndex, error) {
+	var x SearchIndex
+	if err := SearchIndexArtifact.Decode(data, &x); err != nil {
+		return nil, err
+	}
+	return &x, nil
+}
+
+// A SearchIndex lists the packages of a generated static site, for
+// searching them in the browser.
+type SearchIndex struct {
+	// SchemaVersion is the version of the schema of the index.
+	SchemaVersion string `json:"schemaVersion"`
+	// Packages are sorted by path.
+	Packages []SearchEntry `json:"packages"`
+}
+
+// A SearchEntry is a package in a search index.
+type SearchEntry struct {
+	Path string `json:"path"` // import path, for display
+	URL  string `json:"url"`  // URL of the package page, relative to the site root
+	// Synopsis is the first sentence of the package documentation.
+	Synopsis string `json:"synopsis,omitempty"`
+	// Symbols are the names of the exported symbols of the package on any
+	// platform, such as "F" or "T.M", sorted.
+	Symbols []string `json:"symbols,omitempty"`
+
+	// PathKey, SynopsisKey and SymbolKeys are the forms of Path, Synopsis
+	// and Symbols that queries are matched against: compatibility
+	// decomposed, without combining marks, and case-folded. They are left
+	// out for ASCII text, whose key is its lower case. SymbolKeys is left
+	// out if every symbol is ASCII, and otherwise has an element for each
+	// symbol, empty for the ASCII ones. (Since 1.1.)
+	PathKey     string   `json:"pathKey,omitempty"`
+	SynopsisKey string   `json:"synopsisKey,omitempty"`
+	SymbolKeys  []string `json:"symbolKeys,omitempty"`
+}
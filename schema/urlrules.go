@@ -0,0 +1,86 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema
+
+// URLRulesArtifact describes which attributes of the pages of a generated
+// static site hold URLs, and what the generator does to those URLs.
+var URLRulesArtifact = &Artifact{
+	Name:    "url-rules",
+	Version: Version{1, 0},
+	new:     func() any { return &URLRules{} },
+}
+
+// DecodeURLRules decodes the URL rules of the generator.
+func DecodeURLRules(data []byte) (*URLRules, error) {
+	var r URLRules
+	if err := URLRulesArtifact.Decode(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// The actions of URLScheme.
+const (
+	// URLRelativize makes paths from the root of the host relative to the
+	// page, and leaves the other references without a scheme as they are.
+	URLRelativize = "relativize"
+	// URLPass leaves the URLs as they are.
+	URLPass = "pass"
+	// URLPassImages leaves the URLs of images as they are, and neutralizes
+	// the others, as URLNeutralize does.
+	URLPassImages = "pass-images"
+	// URLNeutralize replaces the URLs in documentation content by
+	// URLRules.Neutralized.
+	URLNeutralize = "neutralize"
+)
+
+// URLRules describes which attributes of the pages of a generated static
+// site hold URLs, and what the generator does to those URLs, for audit.
+// Attributes that no rule lists are passed through.
+type URLRules struct {
+	// SchemaVersion is the version of the schema of the rules.
+	SchemaVersion string `json:"schemaVersion"`
+	// Attributes lists the attributes holding URLs.
+	Attributes []URLAttribute `json:"attributes"`
+	// Schemes lists what is done to URLs, by scheme. The rule with the
+	// scheme "*" applies to the schemes no other rule lists.
+	Schemes []URLScheme `json:"schemes"`
+	// Neutralized is the URL that replaces the neutralized URLs.
+	Neutralized string `json:"neutralized"`
+	// DocumentationContent lists the classes of the elements holding the
+	// content derived from documentation, such as doc comments and
+	// READMEs, which is written by the authors of the modules. The other
+	// markup of the pages is the generator's own, and its URLs are not
+	// neutralized.
+	DocumentationContent []string `json:"documentationContent"`
+}
+
+// A URLAttribute is an attribute holding URLs.
+type URLAttribute struct {
+	// Element is the namespace of the elements with the attribute: "html",
+	// "svg" or "math".
+	Element string `json:"element"`
+	// Namespace is the namespace of the attribute, such as "xlink", or
+	// empty for none.
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the local name of the attribute, such as "href".
+	Name string `json:"name"`
+	// List reports whether the attribute holds a list of URLs, each
+	// followed by descriptors, as srcset does, instead of a single URL.
+	List bool `json:"list,omitempty"`
+}
+
+// A URLScheme is what is done to the URLs with a scheme.
+type URLScheme struct {
+	// Scheme is the scheme, in lower case and without the colon, such as
+	// "https"; empty for references without a scheme; or "*" for the
+	// schemes no other rule lists. The scheme of a URL is read as
+	// browsers do, without the tabs and newlines and the leading spaces
+	// and control characters they ignore.
+	Scheme string `json:"scheme"`
+	// Action is what is done to the URLs: URLRelativize, URLPass,
+	// URLPassImages or URLNeutralize.
+	Action string `json:"action"`
+}
@@ -0,0 +1,354 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sitequery answers questions about a static site generated by
+// pkgsite, such as whether it documents a package at a version and at what
+// URL, without generating it again. It reads the record of the modules
+// that every run leaves in the output, as defined by package schema, from
+// the output directory, a zip or tar.gz file of it, or any fs.FS.
+//
+// A unit that the site does not document may have been left out by the
+// unit path filters of the run, or not be part of its modules at all. The
+// report of the run, if it is given, tells the two apart.
+package sitequery
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// ModulesFile is the file of the output holding the record of the modules
+// of the site.
+const ModulesFile = ".pkgsite-modules.json"
+
+var (
+	// ErrNotGenerated is the error of a lookup of a unit or module that
+	// the site does not document.
+	ErrNotGenerated = errors.New("not generated")
+	// ErrLeftOut is the error of a lookup of a unit that the unit path
+	// filters of the run left out of the site.
+	ErrLeftOut = errors.New("left out by the unit path filters")
+)
+
+// Options are the options of Load and Open.
+type Options struct {
+	// Report is the report of the run that generated the site, if known.
+	// Lookups of the units it lists as left out fail with ErrLeftOut
+	// instead of ErrNotGenerated.
+	Report *schema.Report
+}
+
+// A Unit is a package, command or directory that the site documents.
+type Unit struct {
+	// Path is the path of the unit, with the host in ASCII.
+	Path       string
+	ModulePath string
+	// Version is the version of the module that the pages of the unit
+	// document, such as v0.0.0 for a local module, or "" if the record of
+	// the site does not say.
+	Version string
+	// Versioned reports that the pages are those of a version of the
+	// module other than its unversioned pages, under the path of the
+	// module and the version.
+	Versioned bool
+	// URL is the URL of the page of the unit, relative to the root of the
+	// site, such as example.com/m/a/ or example.com/m@v1.2.0/a/.
+	URL string
+	// Package reports that the unit is a package, listed in the search
+	// index with its Synopsis and Symbols. Versioned units are not.
+	Package  bool
+	Synopsis string
+	// Symbols are the names of the exported symbols of the package, such
+	// as "F" or "T.M", sorted.
+	Symbols []string
+	// Tabs are the tabs of the unit that have pages, such as "imports",
+	// sorted.
+	Tabs []string
+}
+
+// A Site is a generated static site, loaded for lookups. Its methods are
+// safe for concurrent use. The Units they return must not be modified.
+type Site struct {
+	units    []*Unit                     // sorted by URL
+	current  map[string]*Unit            // unversioned units, by path
+	versions map[string]map[string]*Unit // versioned units, by path and version
+	modules  map[string]string           // versions of the modules, by path
+	leftOut  map[string]bool
+}
+
+// Open loads the site in the output directory, zip file or tar.gz file
+// name.
+func Open(name string, opts Options) (*Site, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return Load(os.DirFS(name), opts)
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		s, err := Load(zr, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return s, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		data, err := readTarGz(name, ModulesFile)
+		if err != nil {
+			return nil, err
+		}
+		s, err := load(data, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("%s is not a directory, zip file or tar.gz file", name)
+}
+
+// readTarGz returns the contents of the file p in the tar.gz file name.
+func readTarGz(name, p string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: no %s in the site", name, p)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if path.Clean(hdr.Name) == p {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// Load loads the site at the root of fsys.
+func Load(fsys fs.FS, opts Options) (*Site, error) {
+	data, err := fs.ReadFile(fsys, ModulesFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no %s in the site; was it generated by pkgsite?", ModulesFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return load(data, opts)
+}
+
+// load loads the site whose record of modules is data.
+func load(data []byte, opts Options) (*Site, error) {
+	record, err := schema.DecodeModules(data)
+	if err != nil {
+		return nil, err
+	}
+	s := &Site{
+		current:  map[string]*Unit{},
+		versions: map[string]map[string]*Unit{},
+		modules:  map[string]string{},
+		leftOut:  map[string]bool{},
+	}
+	if opts.Report != nil {
+		for _, p := range opts.Report.LeftOut {
+			s.leftOut[p] = true
+		}
+	}
+	for modulePath, m := range record.Modules {
+		s.addModule(modulePath, m)
+	}
+	sort.Slice(s.units, func(i, j int) bool { return s.units[i].URL < s.units[j].URL })
+	return s, nil
+}
+
+// addModule adds the units of the module at modulePath recorded in m.
+func (s *Site) addModule(modulePath string, m *schema.ModuleRecord) {
+	mod := canonicalPath(modulePath)
+	s.modules[mod] = m.Version
+	// Only the units whose pages were written are documented.
+	pages := map[string]bool{}
+	tabs := map[string][]string{}
+	for _, p := range m.Pages {
+		if p.Redirect != "" {
+			continue
+		}
+		if p.Tab != "" {
+			unit := strings.TrimPrefix(path.Dir(p.URLPath), "/")
+			tabs[unit] = append(tabs[unit], p.Tab)
+			continue
+		}
+		pages[strings.TrimPrefix(p.URLPath, "/")] = true
+	}
+	search := map[string]schema.SearchEntry{}
+	for _, e := range m.Search {
+		search[canonicalPath(e.Path)] = e
+	}
+	for _, p := range m.Units {
+		if !pages[p] {
+			continue
+		}
+		u := &Unit{
+			Path:       p,
+			ModulePath: modulePath,
+			Version:    m.Version,
+			URL:        p + "/",
+			Tabs:       tabs[p],
+		}
+		sort.Strings(u.Tabs)
+		if rest, ok := strings.CutPrefix(p, mod+"@"); ok {
+			// The unit of a version, such as example.com/m@v1.2.0/a.
+			version, sub, _ := strings.Cut(rest, "/")
+			u.Path = strings.TrimSuffix(mod+"/"+sub, "/")
+			u.Version = version
+			u.Versioned = true
+			if s.versions[u.Path] == nil {
+				s.versions[u.Path] = map[string]*Unit{}
+			}
+			s.versions[u.Path][version] = u
+		} else {
+			if e, ok := search[p]; ok {
+				u.Package = true
+				u.Synopsis = e.Synopsis
+				u.Symbols = e.Symbols
+			}
+			s.current[p] = u
+		}
+		s.units = append(s.units, u)
+	}
+}
+
+// canonicalPath returns the unit path p with its host in ASCII, as the
+// site has it.
+func canonicalPath(p string) string {
+	host, rest, ok := strings.Cut(p, "/")
+	if isASCII(host) {
+		return p
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return p
+	}
+	if !ok {
+		return ascii
+	}
+	return ascii + "/" + rest
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// notFound returns the error of a lookup of the unit at p, at version if
+// it is not empty, that the site does not document.
+func (s *Site) notFound(p, version string) error {
+	name := p
+	if version != "" {
+		name += "@" + version
+	}
+	if s.leftOut[p] {
+		return fmt.Errorf("%s: %w", name, ErrLeftOut)
+	}
+	return fmt.Errorf("%s: %w", name, ErrNotGenerated)
+}
+
+// UnitByPath returns the unit at the import path p, as its unversioned
+// pages document it.
+func (s *Site) UnitByPath(p string) (*Unit, error) {
+	p = canonicalPath(p)
+	if u, ok := s.current[p]; ok {
+		return u, nil
+	}
+	return nil, s.notFound(p, "")
+}
+
+// UnitAt returns the unit at the import path p as the site documents it at
+// version, in its unversioned pages or in the pages of the version. If
+// version is empty, UnitAt is UnitByPath.
+func (s *Site) UnitAt(p, version string) (*Unit, error) {
+	if version == "" {
+		return s.UnitByPath(p)
+	}
+	p = canonicalPath(p)
+	if u, ok := s.current[p]; ok && u.Version == version {
+		return u, nil
+	}
+	if u, ok := s.versions[p][version]; ok {
+		return u, nil
+	}
+	return nil, s.notFound(p, version)
+}
+
+// ModuleVersion returns the version of the module at modulePath that the
+// unversioned pages of its units document, or "" if the record of the site
+// does not say.
+func (s *Site) ModuleVersion(modulePath string) (string, error) {
+	v, ok := s.modules[canonicalPath(modulePath)]
+	if !ok {
+		return "", fmt.Errorf("module %s: %w", modulePath, ErrNotGenerated)
+	}
+	return v, nil
+}
+
+// URLFor returns the URL of the unversioned page of the unit at the import
+// path p, relative to the root of the site, with the fragment anchor if it
+// is not empty, such as a symbol name.
+func (s *Site) URLFor(p, anchor string) (string, error) {
+	u, err := s.UnitByPath(p)
+	if err != nil {
+		return "", err
+	}
+	if anchor == "" {
+		return u.URL, nil
+	}
+	return u.URL + (&url.URL{Fragment: anchor}).String(), nil
+}
+
+// ListUnits returns the units of the site for which filter returns true,
+// or all of them if filter is nil, sorted by URL.
+func (s *Site) ListUnits(filter func(*Unit) bool) []*Unit {
+	if filter == nil {
+		return slices.Clone(s.units)
+	}
+	var units []*Unit
+	for _, u := range s.units {
+		if filter(u) {
+			units = append(units, u)
+		}
+	}
+	return units
+}
@@ -0,0 +1,219 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sitequery
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wow-look-at-my/static-pkgsite/schema"
+)
+
+// modulesRecord is the record of the modules of a site documenting
+// example.com/m at v0.0.0 and v1.2.0, and the module of the host bücher.example.
+const modulesRecord = `{
+  "schemaVersion": "1.0",
+  "modules": {
+    "example.com/m": {
+      "version": "v0.0.0",
+      "units": ["example.com/m", "example.com/m/a", "example.com/m/failed", "example.com/m@v1.2.0", "example.com/m@v1.2.0/a"],
+      "files": [],
+      "pages": [
+        {"urlPath": "/example.com/m", "file": "example.com/m/index.html", "html": true},
+        {"urlPath": "/example.com/m/imports", "file": "example.com/m/imports/index.html", "html": true, "tab": "imports"},
+        {"urlPath": "/example.com/m/a", "file": "example.com/m/a/index.html", "html": true},
+        {"urlPath": "/example.com/m/a/licenses", "file": "example.com/m/a/licenses/index.html", "html": true, "tab": "licenses"},
+        {"urlPath": "/example.com/m/a/imports", "file": "example.com/m/a/imports/index.html", "html": true, "tab": "imports"},
+        {"urlPath": "/example.com/m/a/file/a.go", "file": "example.com/m/a/file/a.go/index.html", "html": true, "source": true},
+        {"urlPath": "/example.com/m@v1.2.0", "file": "example.com/m@v1.2.0/index.html", "html": true},
+        {"urlPath": "/example.com/m@v1.2.0/a", "file": "example.com/m@v1.2.0/a/index.html", "html": true}
+      ],
+      "search": [
+        {"path": "example.com/m", "url": "example.com/m/", "synopsis": "Package m does things.", "symbols": ["F", "T", "T.M"]},
+        {"path": "example.com/m/a", "url": "example.com/m/a/"}
+      ]
+    },
+    "bücher.example/b": {
+      "units": ["xn--bcher-kva.example/b"],
+      "files": [],
+      "pages": [{"urlPath": "/xn--bcher-kva.example/b", "file": "xn--bcher-kva.example/b/index.html", "html": true}]
+    }
+  }
+}
+`
+
+func TestSite(t *testing.T) {
+	fsys := fstest.MapFS{ModulesFile: {Data: []byte(modulesRecord)}}
+	report := &schema.Report{LeftOut: []string{"example.com/m/internal/x"}}
+	s, err := Load(fsys, Options{Report: report})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Unit{
+		Path:       "example.com/m",
+		ModulePath: "example.com/m",
+		Version:    "v0.0.0",
+		URL:        "example.com/m/",
+		Package:    true,
+		Synopsis:   "Package m does things.",
+		Symbols:    []string{"F", "T", "T.M"},
+		Tabs:       []string{"imports"},
+	}
+	a := &Unit{
+		Path:       "example.com/m/a",
+		ModulePath: "example.com/m",
+		Version:    "v0.0.0",
+		URL:        "example.com/m/a/",
+		Package:    true,
+		Tabs:       []string{"imports", "licenses"},
+	}
+	m12 := &Unit{Path: "example.com/m", ModulePath: "example.com/m", Version: "v1.2.0", Versioned: true, URL: "example.com/m@v1.2.0/"}
+	a12 := &Unit{Path: "example.com/m/a", ModulePath: "example.com/m", Version: "v1.2.0", Versioned: true, URL: "example.com/m@v1.2.0/a/"}
+	b := &Unit{Path: "xn--bcher-kva.example/b", ModulePath: "bücher.example/b", URL: "xn--bcher-kva.example/b/"}
+
+	for _, test := range []struct {
+		path, version string
+		want          *Unit
+		wantErr       error
+	}{
+		{"example.com/m", "", m, nil},
+		{"example.com/m/a", "", a, nil},
+		{"example.com/m/a", "v0.0.0", a, nil},
+		{"example.com/m/a", "v1.2.0", a12, nil},
+		{"example.com/m", "v1.2.0", m12, nil},
+		{"bücher.example/b", "", b, nil},
+		{"xn--bcher-kva.example/b", "", b, nil},
+		{"example.com/m/a", "v1.1.0", nil, ErrNotGenerated},
+		// A unit of the record without a page, which failed.
+		{"example.com/m/failed", "", nil, ErrNotGenerated},
+		{"example.com/m/internal/x", "", nil, ErrLeftOut},
+		{"example.com/other", "", nil, ErrNotGenerated},
+	} {
+		got, err := s.UnitAt(test.path, test.version)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("UnitAt(%q, %q): got error %v, want %v", test.path, test.version, err, test.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("UnitAt(%q, %q) mismatch (-want +got):\n%s", test.path, test.version, diff)
+		}
+	}
+
+	if v, err := s.ModuleVersion("example.com/m"); err != nil || v != "v0.0.0" {
+		t.Errorf(`ModuleVersion("example.com/m") = %q, %v, want "v0.0.0", nil`, v, err)
+	}
+	if _, err := s.ModuleVersion("example.com/m/a"); !errors.Is(err, ErrNotGenerated) {
+		t.Errorf(`ModuleVersion("example.com/m/a"): got error %v, want %v`, err, ErrNotGenerated)
+	}
+
+	for _, test := range []struct {
+		path, anchor, want string
+	}{
+		{"example.com/m", "", "example.com/m/"},
+		{"example.com/m", "T.M", "example.com/m/#T.M"},
+		{"example.com/m/a", "hdr-Some heading", "example.com/m/a/#hdr-Some%20heading"},
+	} {
+		if got, err := s.URLFor(test.path, test.anchor); err != nil || got != test.want {
+			t.Errorf("URLFor(%q, %q) = %q, %v, want %q", test.path, test.anchor, got, err, test.want)
+		}
+	}
+	if _, err := s.URLFor("example.com/m/internal/x", "F"); !errors.Is(err, ErrLeftOut) {
+		t.Errorf("URLFor of a unit left out: got error %v, want %v", err, ErrLeftOut)
+	}
+
+	if diff := cmp.Diff([]*Unit{m, a, m12, a12, b}, s.ListUnits(nil)); diff != "" {
+		t.Errorf("ListUnits(nil) mismatch (-want +got):\n%s", diff)
+	}
+	packages := s.ListUnits(func(u *Unit) bool { return u.Package })
+	if diff := cmp.Diff([]*Unit{m, a}, packages); diff != "" {
+		t.Errorf("ListUnits of packages mismatch (-want +got):\n%s", diff)
+	}
+
+	// Without the report, the units left out are not told apart.
+	s, err = Load(fsys, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UnitByPath("example.com/m/internal/x"); !errors.Is(err, ErrNotGenerated) {
+		t.Errorf("without a report: got error %v, want %v", err, ErrNotGenerated)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"no record":      {"index.html": {Data: []byte("<p>home</p>")}},
+		"invalid record": {ModulesFile: {Data: []byte(`{"schemaVersion": "2.0"}`)}},
+	} {
+		if _, err := Load(fsys, Options{}); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	files := map[string][]byte{
+		"index.html": []byte("<p>home</p>"),
+		ModulesFile:  []byte(modulesRecord),
+	}
+	dir := t.TempDir()
+	var zipData, tarData bytes.Buffer
+	zw := zip.NewWriter(&zipData)
+	gz := gzip.NewWriter(&tarData)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []interface{ Close() error }{zw, tw, gz} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archives := t.TempDir()
+	zipFile := filepath.Join(archives, "site.zip")
+	tarFile := filepath.Join(archives, "site.tgz")
+	if err := os.WriteFile(zipFile, zipData.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tarFile, tarData.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{dir, zipFile, tarFile} {
+		s, err := Open(name, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u, err := s.UnitByPath("example.com/m/a"); err != nil || u.URL != "example.com/m/a/" {
+			t.Errorf("%s: UnitByPath(example.com/m/a) = %+v, %v", name, u, err)
+		}
+	}
+	if _, err := Open(filepath.Join(dir, "index.html"), Options{}); err == nil {
+		t.Error("opened an HTML file as a site")
+	}
+}
@@ -0,0 +1,8 @@
+var c="spk-SourceChunk-target";function l(t,n){return t.find(r=>Number(r.dataset.first)<=n&&n<=Number(r.dataset.last))}var i=new Map;function u(t){var r;let n=i.get(t);if(!n){let o=(r=t.dataset.src)!=null?r:"";n=fetch(new URL(o,location.href).href).then(e=>{if(!e.ok)throw new Error(`fetching ${o}: ${e.status} ${e.statusText}`);return e.text()}).then(e=>{t.innerHTML=e,t.dataset.loaded=""}),n.catch(()=>i.delete(t)),i.set(t,n)}return n}async function a(t,n){let r=/^#L(\d+)$/.exec(n);if(!r||document.getElementById(n.slice(1)))return;let o=l(t,Number(r[1]));if(!o)return;await u(o);let e=document.getElementById(n.slice(1));if(e){for(let s of document.querySelectorAll(`.${c}`))s.classList.remove(c);e.classList.add(c),e.scrollIntoView()}}function d(){var r;let t=Array.from(document.querySelectorAll("tbody.spk-SourceChunk"));if(!t.length)return;let n=((r=document.querySelector(".Source-line"))==null?void 0:r.getBoundingClientRect().height)||24;for(let o of t){let e=o.querySelector(".spk-SourceChunk-placeholder");if(e){let s=Number(o.dataset.last)-Number(o.dataset.first)+1;e.style.height=`${s*n}px`}}if("IntersectionObserver"in window){let o=new IntersectionObserver(e=>{for(let s of e)s.isIntersecting&&(o.unobserve(s.target),u(s.target).catch(console.error))},{rootMargin:"100% 0px"});for(let e of t)o.observe(e)}a(t,location.hash).catch(console.error),window.addEventListener("hashchange",()=>{a(t,location.hash).catch(console.error)})}d();export{l as chunkForLine,u as loadChunk,a as showLine};
+/**
+ * @license
+ * Copyright 2024 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ */
+//# sourceMappingURL=sourcechunks.js.map
@@ -0,0 +1,59 @@
+/**
+ * @license
+ * Copyright 2024 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ */
+
+import { chunkForLine, showLine } from './sourcechunks';
+
+function row(n: number): string {
+  return `<tr class="Source-line" id="L${n}"><td class="Source-number"><a href="#L${n}">${n}</a></td><td class="Source-text">line ${n}</td></tr>`;
+}
+
+function placeholder(first: number, last: number, src: string): string {
+  return `<tbody class="spk-SourceChunk" data-first="${first}" data-last="${last}" data-src="${src}"><tr class="spk-SourceChunk-placeholder"><td></td><td>Lines ${first} to ${last}</td></tr></tbody>`;
+}
+
+describe('source chunks', () => {
+  let placeholders: HTMLElement[];
+  const fetched: string[] = [];
+
+  beforeEach(() => {
+    document.body.innerHTML =
+      `<table class="Source-lines"><tbody>${row(1)}${row(2)}</tbody>` +
+      placeholder(3, 4, 'chunk-2.html') +
+      placeholder(5, 5, 'chunk-3.html') +
+      '</table>';
+    placeholders = Array.from(document.querySelectorAll<HTMLElement>('tbody.spk-SourceChunk'));
+    fetched.length = 0;
+    window.fetch = jest.fn((url: string) => {
+      fetched.push(url);
+      const rows = url.endsWith('chunk-2.html') ? row(3) + row(4) : row(5);
+      return Promise.resolve({ ok: true, text: () => Promise.resolve(rows) } as Response);
+    }) as unknown as typeof window.fetch;
+    Element.prototype.scrollIntoView = jest.fn();
+  });
+
+  it('finds the chunk of a line', () => {
+    expect(chunkForLine(placeholders, 2)).toBeUndefined();
+    expect(chunkForLine(placeholders, 4)?.dataset.src).toBe('chunk-2.html');
+    expect(chunkForLine(placeholders, 5)?.dataset.src).toBe('chunk-3.html');
+    expect(chunkForLine(placeholders, 6)).toBeUndefined();
+  });
+
+  it('loads the chunk of a linked line and scrolls to it', async () => {
+    await showLine(placeholders, '#L4');
+    expect(fetched).toEqual([new URL('chunk-2.html', location.href).href]);
+    const line = document.getElementById('L4');
+    expect(line?.parentElement).toBe(placeholders[0]);
+    expect(line?.classList.contains('spk-SourceChunk-target')).toBe(true);
+    expect(line?.scrollIntoView).toHaveBeenCalled();
+  });
+
+  it('leaves lines on the page to the browser', async () => {
+    await showLine(placeholders, '#L2');
+    await showLine(placeholders, '#pkg-overview');
+    expect(fetched).toEqual([]);
+  });
+});
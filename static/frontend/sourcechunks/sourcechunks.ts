@@ -0,0 +1,119 @@
+/**
+ * @license
+ * Copyright 2024 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ */
+
+/**
+ * Chunks of the source page of a large file on a generated static site. The
+ * page holds the first lines of the file, and each other chunk of lines is a
+ * file of table rows, next to the page. In place of a chunk, the page has an
+ * empty tbody of class spk-SourceChunk, with the numbers of its first and last
+ * lines in data-first and data-last, and the URL of its file, relative to the
+ * page, in data-src. A chunk is loaded when its placeholder comes near the
+ * screen, or when the line anchor of the URL, such as #L1234, points into it.
+ */
+
+const targetClass = 'spk-SourceChunk-target';
+
+/**
+ * chunkForLine returns the placeholder of the chunk holding line, if any.
+ */
+export function chunkForLine(placeholders: HTMLElement[], line: number): HTMLElement | undefined {
+  return placeholders.find(p => Number(p.dataset.first) <= line && line <= Number(p.dataset.last));
+}
+
+const loads = new Map<HTMLElement, Promise<void>>();
+
+/**
+ * loadChunk fills the placeholder with the rows of its chunk. A chunk is
+ * fetched once, unless fetching it fails.
+ */
+export function loadChunk(placeholder: HTMLElement): Promise<void> {
+  let load = loads.get(placeholder);
+  if (!load) {
+    const src = placeholder.dataset.src ?? '';
+    load = fetch(new URL(src, location.href).href)
+      .then(resp => {
+        if (!resp.ok) {
+          throw new Error(`fetching ${src}: ${resp.status} ${resp.statusText}`);
+        }
+        return resp.text();
+      })
+      .then(rows => {
+        placeholder.innerHTML = rows;
+        placeholder.dataset.loaded = '';
+      });
+    load.catch(() => loads.delete(placeholder));
+    loads.set(placeholder, load);
+  }
+  return load;
+}
+
+/**
+ * showLine scrolls to the line of the anchor hash, such as #L1234, once the
+ * chunk holding it is loaded, if it is not on the page.
+ */
+export async function showLine(placeholders: HTMLElement[], hash: string): Promise<void> {
+  const m = /^#L(\d+)$/.exec(hash);
+  if (!m || document.getElementById(hash.slice(1))) {
+    return;
+  }
+  const chunk = chunkForLine(placeholders, Number(m[1]));
+  if (!chunk) {
+    return;
+  }
+  await loadChunk(chunk);
+  const row = document.getElementById(hash.slice(1));
+  if (!row) {
+    return;
+  }
+  // A row added after the navigation is not the :target of the page.
+  for (const t of document.querySelectorAll(`.${targetClass}`)) {
+    t.classList.remove(targetClass);
+  }
+  row.classList.add(targetClass);
+  row.scrollIntoView();
+}
+
+/**
+ * init sizes the placeholders of the page like the lines they stand for, and
+ * loads their chunks as they come near the screen or are linked to.
+ */
+function init() {
+  const placeholders = Array.from(document.querySelectorAll<HTMLElement>('tbody.spk-SourceChunk'));
+  if (!placeholders.length) {
+    return;
+  }
+  const lineHeight = document.querySelector('.Source-line')?.getBoundingClientRect().height || 24;
+  for (const p of placeholders) {
+    const row = p.querySelector<HTMLElement>('.spk-SourceChunk-placeholder');
+    if (row) {
+      const lines = Number(p.dataset.last) - Number(p.dataset.first) + 1;
+      row.style.height = `${lines * lineHeight}px`;
+    }
+  }
+  if ('IntersectionObserver' in window) {
+    const observer = new IntersectionObserver(
+      entries => {
+        for (const e of entries) {
+          if (e.isIntersecting) {
+            observer.unobserve(e.target);
+            loadChunk(e.target as HTMLElement).catch(console.error);
+          }
+        }
+      },
+      { rootMargin: '100% 0px' }
+    );
+    for (const p of placeholders) {
+      observer.observe(p);
+    }
+  }
+  showLine(placeholders, location.hash).catch(console.error);
+  window.addEventListener('hashchange', () => {
+    showLine(placeholders, location.hash).catch(console.error);
+  });
+}
+
+init();
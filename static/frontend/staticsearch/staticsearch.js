@@ -0,0 +1,8 @@
+var S=/\p{M}/gu;function y(a){return a.normalize("NFKD").replace(S,"").toUpperCase().toLowerCase().replace(/ς/g,"\u03C3")}function x(a){let t={key:"",starts:[],ends:[]},n=0,e=0;for(let r of a){let i=y(r);if(i){e=t.key.length;for(let s=0;s<i.length;s++)t.starts.push(n),t.ends.push(n+r.length);t.key+=i}else for(let s=e;s<t.key.length;s++)t.ends[s]=n+r.length;n+=r.length}return t}function k(a,t,n){return[a.starts[t],a.ends[n-1]]}function f(a,t){let n=x(a),e=[];for(let i of t){let s=i?n.key.indexOf(i):-1;s>=0&&e.push(k(n,s,s+i.length))}e.sort((i,s)=>i[0]-s[0]||i[1]-s[1]);let r=[];for(let i of e){let s=r[r.length-1];s&&i[0]<=s[1]?s[1]=Math.max(s[1],i[1]):r.push(i)}return r}function w(a,t,n=10){let e=y(t).split(/\s+/).filter(i=>i);if(!e.length)return[];let r=[];for(let i of a){let s=0,o;for(let c of e){let u=L(i,c);if(!u){s=0;break}s+=u.score,o!=null||(o=u.symbol)}s>0&&r.push({score:s,entry:i,symbol:o})}return r.sort((i,s)=>s.score-i.score||i.entry.path.length-s.entry.path.length||(i.entry.path<s.entry.path?-1:i.entry.path>s.entry.path?1:0)),r.slice(0,n).map(({entry:i,symbol:s})=>{var c;let o=(c=i.synopsis)!=null?c:"";return{path:i.path,url:s?`${i.url}#${s}`:i.url,synopsis:o,symbol:s,pathMatches:f(i.path,e),synopsisMatches:f(o,e),symbolMatches:s?f(s,e):[]}})}function L(a,t){var s,o,c,u;let n,e=(l,p)=>{(!n||l>n.score)&&(n={score:l,symbol:p})},r=a.pathKey||a.path.toLowerCase(),i=r.slice(r.lastIndexOf("/")+1);r===t?e(100):i===t?e(90):i.startsWith(t)?e(80):r.includes(t)&&e(70);for(let[l,p]of((s=a.symbols)!=null?s:[]).entries()){let m=((o=a.symbolKeys)==null?void 0:o[l])||p.toLowerCase(),E=m.slice(m.lastIndexOf(".")+1);m===t||E===t?e(60,p):(m.startsWith(t)||E.startsWith(t))&&e(50,p)}if((u=a.synopsisKey||((c=a.synopsis)==null?void 0:c.toLowerCase()))!=null&&u.includes(t)&&e(30),!n){let l=M(r,t);l>0&&e(l)}return n}function M(a,t){let n=-1,e=0;for(let r of t){if(e=a.indexOf(r,e),e<0)return 0;n<0&&(n=e),e++}return 10+10*t.length/(e-n)}var b=new URL(document.documentElement.dataset.pkgsiteBase||"/",location.href),d;function A(){return d||(d=fetch(new URL("search-index.json",b).href).then(a=>{if(!a.ok)throw new Error(`fetching search index: ${a.status} ${a.statusText}`);return a.json()}).then(a=>{var t;return(t=a.packages)!=null?t:[]}),d.catch(()=>{d=void 0})),d}function h(a){return`spk-${a} ${a}`}function g(a,t,n){let e=document.createElement("span");e.className=a;let r=0;for(let[i,s]of n){let o=document.createElement("mark");o.className=h("StaticSearch-match"),o.textContent=t.slice(i,s),e.append(t.slice(r,i),o),r=s}return e.append(t.slice(r)),e}var N=0,v=class{constructor(t){this.form=t;this.results=[];this.resultsQuery="";this.active=-1;var e;let n=t.querySelector('input[name="q"]');if(!n)throw new Error("search form has no query input");this.input=n,this.list=document.createElement("ul"),this.list.id=`spk-StaticSearch-results${N++}`,this.list.className=h("StaticSearch-results"),this.list.setAttribute("role","listbox"),this.list.hidden=!0,t.after(this.list),(e=t.parentElement)==null||e.classList.add(...h("StaticSearch").split(" ")),n.setAttribute("autocomplete","off"),n.setAttribute("role","combobox"),n.setAttribute("aria-controls",this.list.id),n.setAttribute("aria-expanded","false"),n.addEventListener("input",()=>this.update()),n.addEventListener("focus",()=>this.update()),n.addEventListener("keydown",r=>this.handleKeydown(r)),t.addEventListener("submit",r=>{r.preventDefault(),this.go()}),document.addEventListener("click",r=>{!t.contains(r.target)&&!this.list.contains(r.target)&&this.hide()})}async update(){let t=this.input.value;if(!t.trim()){this.hide();return}let n;try{n=await A()}catch(e){console.error(e),this.show([],"Search is not available.");return}if(this.input.value===t){let e=w(n,t);this.show(e,e.length?"":"No matching packages."),this.resultsQuery=t}}show(t,n){this.results=t,this.resultsQuery="",this.active=-1,this.list.replaceChildren();for(let[e,r]of t.entries()){let i=document.createElement("li");i.id=`${this.list.id}-${e}`,i.setAttribute("role","option");let s=document.createElement("a");s.href=new URL(r.url,b).href,s.append(g(h("StaticSearch-path"),r.path,r.pathMatches)),r.symbol&&s.append(" ",g(h("StaticSearch-symbol"),r.symbol,r.symbolMatches)),r.synopsis&&s.append(g(h("StaticSearch-synopsis"),r.synopsis,r.synopsisMatches)),i.append(s),this.list.append(i)}if(n){let e=document.createElement("li");e.className=h("StaticSearch-message"),e.textContent=n,this.list.append(e)}this.list.hidden=!1,this.input.setAttribute("aria-expanded","true"),this.input.removeAttribute("aria-activedescendant")}hide(){this.list.hidden=!0,this.input.setAttribute("aria-expanded","false"),this.input.removeAttribute("aria-activedescendant")}handleKeydown(t){switch(t.key){case"ArrowDown":case"ArrowUp":if(!this.results.length)return;t.preventDefault(),this.select((this.active+(t.key==="ArrowDown"?1:-1)+this.results.length+1)%(this.results.length+1));break;case"Escape":this.hide();break}}select(t){var e;(e=this.list.querySelector("[aria-selected]"))==null||e.removeAttribute("aria-selected"),this.active=t<this.results.length?t:-1;let n=this.active<0?null:this.list.children[this.active];n?(n.setAttribute("aria-selected","true"),this.input.setAttribute("aria-activedescendant",n.id),n.scrollIntoView({block:"nearest"})):this.input.removeAttribute("aria-activedescendant")}async go(){this.resultsQuery!==this.input.value&&await this.update();let t=this.results[Math.max(this.active,0)];t&&window.location.assign(new URL(t.url,b).href)}};for(let a of document.querySelectorAll("form[data-pkgsite-search]"))new v(a);export{v as StaticSearchController,M as fuzzyScore,w as searchPackages};
+/**
+ * @license
+ * Copyright 2024 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ */
+//# sourceMappingURL=staticsearch.js.map
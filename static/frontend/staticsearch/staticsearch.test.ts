@@ -0,0 +1,76 @@
+/**
+ * @license
+ * Copyright 2024 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ */
+
+import { fuzzyScore, searchPackages } from './staticsearch';
+
+const entries = [
+  { path: 'example.com/m', url: 'example.com/m/', synopsis: 'Package m does things.' },
+  {
+    path: 'example.com/m/http',
+    url: 'example.com/m/http/',
+    synopsis: 'Package http serves requests.',
+    symbols: ['Handler', 'Handler.ServeHTTP', 'ListenAndServe'],
+  },
+  { path: 'example.com/m/internal/httputil', url: 'example.com/m/internal/httputil/' },
+];
+
+describe('searchPackages', () => {
+  it('ranks an exact package name first', () => {
+    const got = searchPackages(entries, 'http').map(r => r.path);
+    expect(got).toEqual(['example.com/m/http', 'example.com/m/internal/httputil']);
+  });
+
+  it('links to matching symbols', () => {
+    expect(searchPackages(entries, 'servehttp')).toEqual([
+      {
+        path: 'example.com/m/http',
+        url: 'example.com/m/http/#Handler.ServeHTTP',
+        synopsis: 'Package http serves requests.',
+        symbol: 'Handler.ServeHTTP',
+        pathMatches: [],
+        synopsisMatches: [],
+        symbolMatches: [[8, 17]],
+      },
+    ]);
+  });
+
+  it('requires every word to match', () => {
+    expect(searchPackages(entries, 'http things')).toEqual([]);
+    expect(searchPackages(entries, 'm things').map(r => r.path)).toEqual(['example.com/m']);
+  });
+
+  it('matches letters in order', () => {
+    expect(searchPackages(entries, 'hutl').map(r => r.path)).toEqual([
+      'example.com/m/internal/httputil',
+    ]);
+    expect(fuzzyScore('httputil', 'lh')).toBe(0);
+  });
+
+  it('ignores case and diacritics', () => {
+    const accented = [
+      {
+        path: 'example.com/m/zurich',
+        url: 'example.com/m/zurich/',
+        synopsis: 'Package zurich greets Mu\u0308ller.',
+        synopsisKey: 'package zurich greets muller.',
+        symbols: ['Grüße', 'Hello'],
+        symbolKeys: ['grusse', ''],
+      },
+    ];
+    const [r] = searchPackages(accented, 'MULLER');
+    expect(r.path).toBe('example.com/m/zurich');
+    // The match covers the u and its combining diaeresis.
+    expect(r.synopsisMatches).toEqual([[22, 29]]);
+    expect(searchPackages(accented, 'grusse')[0].url).toBe('example.com/m/zurich/#Grüße');
+    expect(searchPackages(accented, 'grüße')[0].symbolMatches).toEqual([[0, 5]]);
+    expect(searchPackages(accented, 'hello')[0].symbol).toBe('Hello');
+  });
+
+  it('returns nothing for an empty query', () => {
+    expect(searchPackages(entries, '  ')).toEqual([]);
+  });
+});
@@ -0,0 +1,378 @@
+/**
+ * @license
+ * Copyright 2024 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ */
+
+/**
+ * Search for a generated static site, which has no search backend. The search
+ * forms of the pages are marked with a data-pkgsite-search attribute, and this
+ * module answers them from the search index of the site, search-index.json at
+ * the site root.
+ */
+
+import { matchRanges, normalize } from '../../shared/normalize/normalize';
+
+/**
+ * SearchEntry is a package in the search index.
+ */
+export interface SearchEntry {
+  path: string;
+  url: string;
+  synopsis?: string;
+  symbols?: string[];
+  // The normalized keys of non-ASCII text, as written by the generator.
+  pathKey?: string;
+  synopsisKey?: string;
+  symbolKeys?: string[];
+}
+
+/**
+ * SearchResult is a package matching a query, or a symbol of one. The matches
+ * are the ranges of the path, synopsis and symbol matching words of the query,
+ * as offsets into the displayed strings.
+ */
+export interface SearchResult {
+  path: string;
+  url: string;
+  synopsis: string;
+  symbol?: string;
+  pathMatches: [number, number][];
+  synopsisMatches: [number, number][];
+  symbolMatches: [number, number][];
+}
+
+interface Match {
+  score: number;
+  symbol?: string;
+}
+
+/**
+ * searchPackages returns the entries matching every word of query, best
+ * matches first. A word matches an entry if it is in the package path, is or
+ * starts a symbol name, is in the synopsis, or has its letters in order in the
+ * package path. Case and diacritics are ignored.
+ */
+export function searchPackages(entries: SearchEntry[], query: string, limit = 10): SearchResult[] {
+  const words = normalize(query).split(/\s+/).filter(w => w);
+  if (!words.length) {
+    return [];
+  }
+  const scored: { score: number; entry: SearchEntry; symbol?: string }[] = [];
+  for (const e of entries) {
+    let score = 0;
+    let symbol: string | undefined;
+    for (const w of words) {
+      const m = matchWord(e, w);
+      if (!m) {
+        score = 0;
+        break;
+      }
+      score += m.score;
+      symbol ??= m.symbol;
+    }
+    if (score > 0) {
+      scored.push({ score, entry: e, symbol });
+    }
+  }
+  scored.sort(
+    (a, b) =>
+      b.score - a.score ||
+      a.entry.path.length - b.entry.path.length ||
+      (a.entry.path < b.entry.path ? -1 : a.entry.path > b.entry.path ? 1 : 0)
+  );
+  return scored.slice(0, limit).map(({ entry: e, symbol }) => {
+    const synopsis = e.synopsis ?? '';
+    return {
+      path: e.path,
+      url: symbol ? `${e.url}#${symbol}` : e.url,
+      synopsis,
+      symbol,
+      pathMatches: matchRanges(e.path, words),
+      synopsisMatches: matchRanges(synopsis, words),
+      symbolMatches: symbol ? matchRanges(symbol, words) : [],
+    };
+  });
+}
+
+/**
+ * matchWord returns the best match of the normalized word w in e.
+ */
+function matchWord(e: SearchEntry, w: string): Match | undefined {
+  let best: Match | undefined;
+  const consider = (score: number, symbol?: string) => {
+    if (!best || score > best.score) {
+      best = { score, symbol };
+    }
+  };
+  const path = e.pathKey || e.path.toLowerCase();
+  const name = path.slice(path.lastIndexOf('/') + 1);
+  if (path === w) {
+    consider(100);
+  } else if (name === w) {
+    consider(90);
+  } else if (name.startsWith(w)) {
+    consider(80);
+  } else if (path.includes(w)) {
+    consider(70);
+  }
+  for (const [i, sym] of (e.symbols ?? []).entries()) {
+    const s = e.symbolKeys?.[i] || sym.toLowerCase();
+    const member = s.slice(s.lastIndexOf('.') + 1);
+    if (s === w || member === w) {
+      consider(60, sym);
+    } else if (s.startsWith(w) || member.startsWith(w)) {
+      consider(50, sym);
+    }
+  }
+  if ((e.synopsisKey || e.synopsis?.toLowerCase())?.includes(w)) {
+    consider(30);
+  }
+  if (!best) {
+    const f = fuzzyScore(path, w);
+    if (f > 0) {
+      consider(f);
+    }
+  }
+  return best;
+}
+
+/**
+ * fuzzyScore returns a score between 10 and 20 if the letters of w appear in
+ * order in text, higher the closer together they are, and 0 otherwise.
+ */
+export function fuzzyScore(text: string, w: string): number {
+  let start = -1;
+  let i = 0;
+  for (const c of w) {
+    i = text.indexOf(c, i);
+    if (i < 0) {
+      return 0;
+    }
+    if (start < 0) {
+      start = i;
+    }
+    i++;
+  }
+  return 10 + (10 * w.length) / (i - start);
+}
+
+/**
+ * siteRoot is the URL of the root of the site, which the pages record on their
+ * <html> element.
+ */
+const siteRoot = new URL(document.documentElement.dataset['pkgsiteBase'] || '/', location.href);
+
+let index: Promise<SearchEntry[]> | undefined;
+
+/**
+ * loadIndex fetches the search index of the site, once.
+ */
+function loadIndex(): Promise<SearchEntry[]> {
+  if (!index) {
+    index = fetch(new URL('search-index.json', siteRoot).href)
+      .then(resp => {
+        if (!resp.ok) {
+          throw new Error(`fetching search index: ${resp.status} ${resp.statusText}`);
+        }
+        return resp.json();
+      })
+      .then(data => data.packages ?? []);
+    index.catch(() => {
+      // Try again on the next search.
+      index = undefined;
+    });
+  }
+  return index;
+}
+
+/**
+ * injectedClass returns the class attribute of the elements the script adds
+ * named name: the name with the prefix of the injected elements of the site,
+ * and, until the next release, the unprefixed name that custom styles may
+ * still use.
+ */
+function injectedClass(name: string): string {
+  return `spk-${name} ${name}`;
+}
+
+/**
+ * highlighted returns a span of class className holding text, with the ranges
+ * of matches marked.
+ */
+function highlighted(className: string, text: string, matches: [number, number][]): HTMLElement {
+  const span = document.createElement('span');
+  span.className = className;
+  let end = 0;
+  for (const [start, stop] of matches) {
+    const mark = document.createElement('mark');
+    mark.className = injectedClass('StaticSearch-match');
+    mark.textContent = text.slice(start, stop);
+    span.append(text.slice(end, start), mark);
+    end = stop;
+  }
+  span.append(text.slice(end));
+  return span;
+}
+
+let nextListID = 0;
+
+/**
+ * StaticSearchController shows the packages matching the input of a search
+ * form as it is typed, and goes to the selected one, or the best one, when the
+ * form is submitted.
+ */
+export class StaticSearchController {
+  private input: HTMLInputElement;
+  private list: HTMLUListElement;
+  private results: SearchResult[] = [];
+  private resultsQuery = '';
+  private active = -1;
+
+  constructor(private form: HTMLFormElement) {
+    const input = form.querySelector<HTMLInputElement>('input[name="q"]');
+    if (!input) {
+      throw new Error('search form has no query input');
+    }
+    this.input = input;
+    this.list = document.createElement('ul');
+    this.list.id = `spk-StaticSearch-results${nextListID++}`;
+    this.list.className = injectedClass('StaticSearch-results');
+    this.list.setAttribute('role', 'listbox');
+    this.list.hidden = true;
+    form.after(this.list);
+    form.parentElement?.classList.add(...injectedClass('StaticSearch').split(' '));
+
+    input.setAttribute('autocomplete', 'off');
+    input.setAttribute('role', 'combobox');
+    input.setAttribute('aria-controls', this.list.id);
+    input.setAttribute('aria-expanded', 'false');
+    input.addEventListener('input', () => this.update());
+    input.addEventListener('focus', () => this.update());
+    input.addEventListener('keydown', e => this.handleKeydown(e));
+    form.addEventListener('submit', e => {
+      e.preventDefault();
+      this.go();
+    });
+    document.addEventListener('click', e => {
+      if (!form.contains(e.target as Node) && !this.list.contains(e.target as Node)) {
+        this.hide();
+      }
+    });
+  }
+
+  /**
+   * update shows the results for the current input.
+   */
+  async update(): Promise<void> {
+    const query = this.input.value;
+    if (!query.trim()) {
+      this.hide();
+      return;
+    }
+    let entries: SearchEntry[];
+    try {
+      entries = await loadIndex();
+    } catch (e) {
+      console.error(e);
+      this.show([], 'Search is not available.');
+      return;
+    }
+    if (this.input.value === query) {
+      const results = searchPackages(entries, query);
+      this.show(results, results.length ? '' : 'No matching packages.');
+      this.resultsQuery = query;
+    }
+  }
+
+  private show(results: SearchResult[], message: string) {
+    this.results = results;
+    this.resultsQuery = '';
+    this.active = -1;
+    this.list.replaceChildren();
+    for (const [i, r] of results.entries()) {
+      const li = document.createElement('li');
+      li.id = `${this.list.id}-${i}`;
+      li.setAttribute('role', 'option');
+      const a = document.createElement('a');
+      a.href = new URL(r.url, siteRoot).href;
+      a.append(highlighted(injectedClass('StaticSearch-path'), r.path, r.pathMatches));
+      if (r.symbol) {
+        a.append(' ', highlighted(injectedClass('StaticSearch-symbol'), r.symbol, r.symbolMatches));
+      }
+      if (r.synopsis) {
+        a.append(highlighted(injectedClass('StaticSearch-synopsis'), r.synopsis, r.synopsisMatches));
+      }
+      li.append(a);
+      this.list.append(li);
+    }
+    if (message) {
+      const li = document.createElement('li');
+      li.className = injectedClass('StaticSearch-message');
+      li.textContent = message;
+      this.list.append(li);
+    }
+    this.list.hidden = false;
+    this.input.setAttribute('aria-expanded', 'true');
+    this.input.removeAttribute('aria-activedescendant');
+  }
+
+  private hide() {
+    this.list.hidden = true;
+    this.input.setAttribute('aria-expanded', 'false');
+    this.input.removeAttribute('aria-activedescendant');
+  }
+
+  private handleKeydown(e: KeyboardEvent) {
+    switch (e.key) {
+      case 'ArrowDown':
+      case 'ArrowUp':
+        if (!this.results.length) {
+          return;
+        }
+        e.preventDefault();
+        this.select(
+          (this.active + (e.key === 'ArrowDown' ? 1 : -1) + this.results.length + 1) %
+            (this.results.length + 1)
+        );
+        break;
+      case 'Escape':
+        this.hide();
+        break;
+    }
+  }
+
+  /**
+   * select highlights the result at i, or none if i is out of range.
+   */
+  private select(i: number) {
+    this.list.querySelector('[aria-selected]')?.removeAttribute('aria-selected');
+    this.active = i < this.results.length ? i : -1;
+    const li = this.active < 0 ? null : this.list.children[this.active];
+    if (li) {
+      li.setAttribute('aria-selected', 'true');
+      this.input.setAttribute('aria-activedescendant', li.id);
+      li.scrollIntoView({ block: 'nearest' });
+    } else {
+      this.input.removeAttribute('aria-activedescendant');
+    }
+  }
+
+  /**
+   * go goes to the selected result, or to the best one.
+   */
+  async go(): Promise<void> {
+    if (this.resultsQuery !== this.input.value) {
+      await this.update();
+    }
+    const r = this.results[Math.max(this.active, 0)];
+    if (r) {
+      window.location.assign(new URL(r.url, siteRoot).href);
+    }
+  }
+}
+
+for (const form of document.querySelectorAll<HTMLFormElement>('form[data-pkgsite-search]')) {
+  new StaticSearchController(form);
+}
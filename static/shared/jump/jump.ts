@@ -23,6 +23,7 @@
 // It was modified to remove the dependence on jquery and bootstrap.
 
 import { keyboard } from '../keyboard/keyboard';
+import { normalizeMapped, textRange } from '../normalize/normalize';
 
 export function initModals(): void {
   const jumpDialog = document.querySelector<HTMLDialogElement>('.JumpDialog');
@@ -108,13 +109,13 @@ export function initModals(): void {
 
     if (filter) {
       // A filter is set. We treat the filter as a substring that can appear in
-      // an item name (case insensitive), and find the following matches - in
-      // order of priority:
+      // an item name (ignoring case and diacritics), and find the following
+      // matches - in order of priority:
       //
       // 1. Exact matches (the filter matches the item's name exactly)
       // 2. Prefix matches (the item's name starts with filter)
       // 3. Infix matches (the filter is a substring of the item's name)
-      const filterLowerCase = filter.toLowerCase();
+      const filterKey = normalizeMapped(filter).key;
 
       const exactMatches = [];
       const prefixMatches = [];
@@ -133,20 +134,20 @@ export function initModals(): void {
       };
 
       for (const item of jumpListItems ?? []) {
-        const nameLowerCase = item.name.toLowerCase();
-
-        if (nameLowerCase === filterLowerCase) {
-          item.link.innerHTML = makeLinkHtml(item, 0, item.name.length);
+        // The bolded range is that of the name the matching key comes from.
+        const name = normalizeMapped(item.name);
+        const index = filterKey ? name.key.indexOf(filterKey) : -1;
+        if (index < 0) {
+          continue;
+        }
+        const [boldStart, boldEnd] = textRange(name, index, index + filterKey.length);
+        item.link.innerHTML = makeLinkHtml(item, boldStart, boldEnd);
+        if (name.key === filterKey) {
           exactMatches.push(item);
-        } else if (nameLowerCase.startsWith(filterLowerCase)) {
-          item.link.innerHTML = makeLinkHtml(item, 0, filter.length);
+        } else if (index === 0) {
           prefixMatches.push(item);
         } else {
-          const index = nameLowerCase.indexOf(filterLowerCase);
-          if (index > -1) {
-            item.link.innerHTML = makeLinkHtml(item, index, index + filter.length);
-            infixMatches.push(item);
-          }
+          infixMatches.push(item);
         }
       }
 
@@ -0,0 +1,47 @@
+/**
+ * @license
+ * Copyright 2024 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ */
+
+import { matchRanges, normalize, normalizeMapped, textRange } from './normalize';
+
+describe('normalize', () => {
+  it('strips diacritics and folds case', () => {
+    expect(normalize('Mu\u0308ller')).toBe('muller');
+    expect(normalize('M\u00fcller')).toBe('muller');
+    expect(normalize('Straße')).toBe('strasse');
+    expect(normalize('ﬁle')).toBe('file');
+    expect(normalize('ΟΔΟΣ')).toBe('οδοσ');
+  });
+});
+
+describe('normalizeMapped', () => {
+  it('maps the key to the text', () => {
+    const n = normalizeMapped('Mu\u0308ller');
+    expect(n.key).toBe('muller');
+    // The u of the key comes from the u and its combining diaeresis.
+    expect(textRange(n, 1, 2)).toEqual([1, 3]);
+    expect(textRange(n, 2, 6)).toEqual([3, 7]);
+  });
+
+  it('maps expansions to their code point', () => {
+    const n = normalizeMapped('Straße');
+    expect(n.key).toBe('strasse');
+    expect(textRange(n, 4, 5)).toEqual([4, 5]);
+    expect(textRange(n, 3, 7)).toEqual([3, 6]);
+  });
+});
+
+describe('matchRanges', () => {
+  it('finds words in the text', () => {
+    const text = 'Package zurich greets Mu\u0308ller.';
+    expect(matchRanges(text, ['muller', 'greets'])).toEqual([
+      [15, 21],
+      [22, 29],
+    ]);
+    expect(matchRanges(text, ['mull', 'ller'])).toEqual([[22, 29]]);
+    expect(matchRanges(text, ['nothing', ''])).toEqual([]);
+  });
+});
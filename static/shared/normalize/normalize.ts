@@ -0,0 +1,96 @@
+/**
+ * @license
+ * Copyright 2024 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ */
+
+/**
+ * Normalization of text for matching, so that a query finds text that differs
+ * only in case or diacritics: "muller" finds "Müller". The static site
+ * generator writes the keys of its search index the same way, in searchKey of
+ * cmd/internal/pkgsite.
+ */
+
+const marks = /\p{M}/gu;
+
+/**
+ * normalize returns the key of text that queries are matched against: its
+ * compatibility decomposition (NFKD) without combining marks, case-folded by
+ * upper- then lower-casing it, with final sigmas made ordinary.
+ */
+export function normalize(text: string): string {
+  return text.normalize('NFKD').replace(marks, '').toUpperCase().toLowerCase().replace(/ς/g, 'σ');
+}
+
+/**
+ * A Normalized is the key of a text, with the range of the text that each
+ * code unit of the key comes from.
+ */
+export interface Normalized {
+  key: string;
+  starts: number[];
+  ends: number[];
+}
+
+/**
+ * normalizeMapped returns the key of text, normalized a code point at a time,
+ * mapped to text. Code points left out of the key, such as combining marks,
+ * belong to the range of the code point before them.
+ */
+export function normalizeMapped(text: string): Normalized {
+  const n: Normalized = { key: '', starts: [], ends: [] };
+  let i = 0;
+  let last = 0; // start in the key of the last code point kept
+  for (const c of text) {
+    const k = normalize(c);
+    if (k) {
+      last = n.key.length;
+      for (let j = 0; j < k.length; j++) {
+        n.starts.push(i);
+        n.ends.push(i + c.length);
+      }
+      n.key += k;
+    } else {
+      for (let j = last; j < n.key.length; j++) {
+        n.ends[j] = i + c.length;
+      }
+    }
+    i += c.length;
+  }
+  return n;
+}
+
+/**
+ * textRange returns the range of the text of n that the non-empty range of
+ * its key from start to end comes from.
+ */
+export function textRange(n: Normalized, start: number, end: number): [number, number] {
+  return [n.starts[start], n.ends[end - 1]];
+}
+
+/**
+ * matchRanges returns the ranges of text whose keys are the first occurrences
+ * of the normalized words, sorted and merged.
+ */
+export function matchRanges(text: string, words: string[]): [number, number][] {
+  const n = normalizeMapped(text);
+  const ranges: [number, number][] = [];
+  for (const w of words) {
+    const i = w ? n.key.indexOf(w) : -1;
+    if (i >= 0) {
+      ranges.push(textRange(n, i, i + w.length));
+    }
+  }
+  ranges.sort((a, b) => a[0] - b[0] || a[1] - b[1]);
+  const merged: [number, number][] = [];
+  for (const r of ranges) {
+    const last = merged[merged.length - 1];
+    if (last && r[0] <= last[1]) {
+      last[1] = Math.max(last[1], r[1]);
+    } else {
+      merged.push(r);
+    }
+  }
+  return merged;
+}
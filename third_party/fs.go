@@ -4,7 +4,75 @@
 
 package thirdparty
 
-import "embed"
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+)
 
 //go:embed dialog-polyfill/*
 var FS embed.FS
+
+// manifest describes the components of FS, as a JSON array of Components.
+//
+//go:embed manifest.json
+var manifest []byte
+
+// A Component is a library of FS, whose files are those of its directory.
+type Component struct {
+	Dir     string `json:"dir"`     // directory of the component in FS
+	Name    string `json:"name"`    // name of the library
+	URL     string `json:"url"`     // where the library was copied from
+	License string `json:"license"` // SPDX identifier of its license
+	// LicenseFile is the file of FS holding the text of its license, by
+	// default LICENSE in its directory.
+	LicenseFile string `json:"licenseFile,omitempty"`
+}
+
+// Components returns the components of FS, sorted by directory. Every
+// directory of FS is a component, described by the embedded manifest, with
+// the file of its license.
+func Components() ([]Component, error) {
+	var cs []Component
+	if err := json.Unmarshal(manifest, &cs); err != nil {
+		return nil, fmt.Errorf("third_party manifest: %w", err)
+	}
+	byDir := map[string]bool{}
+	for _, c := range cs {
+		byDir[c.Dir] = true
+	}
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		return nil, err
+	}
+	dirs := map[string]bool{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dirs[e.Name()] = true
+		if !byDir[e.Name()] {
+			return nil, fmt.Errorf("third_party manifest: no component for the directory %s", e.Name())
+		}
+	}
+	var embedded []Component
+	for _, c := range cs {
+		// The manifest may describe libraries that are not embedded.
+		if !dirs[c.Dir] {
+			continue
+		}
+		if c.LicenseFile == "" {
+			c.LicenseFile = "LICENSE"
+		}
+		c.LicenseFile = path.Join(c.Dir, c.LicenseFile)
+		if _, err := fs.Stat(FS, c.LicenseFile); err != nil {
+			return nil, fmt.Errorf("third_party component %s: %w", c.Dir, err)
+		}
+		embedded = append(embedded, c)
+	}
+	sort.Slice(embedded, func(i, j int) bool { return embedded[i].Dir < embedded[j].Dir })
+	return embedded, nil
+}
@@ -15,3 +15,18 @@ func TestFS(t *testing.T) {
 		}
 	}
 }
+
+func TestComponents(t *testing.T) {
+	cs, err := Components()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) == 0 {
+		t.Fatal("no components")
+	}
+	for _, c := range cs {
+		if c.Name == "" || c.URL == "" || c.License == "" {
+			t.Errorf("component %s is not fully described: %+v", c.Dir, c)
+		}
+	}
+}